@@ -16,19 +16,32 @@ package balance
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
+	"strings"
+	"time"
 
 	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/output"
+	"github.com/sboehler/knut/lib/common/compare"
 	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/dict"
 	"github.com/sboehler/knut/lib/common/filter"
 	"github.com/sboehler/knut/lib/common/mapper"
+	"github.com/sboehler/knut/lib/common/regex"
 	"github.com/sboehler/knut/lib/common/table"
 	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/lots"
 	"github.com/sboehler/knut/lib/journal/report"
+	"github.com/sboehler/knut/lib/quotes/cache"
 
+	"github.com/natefinch/atomic"
+	"github.com/shopspring/decimal"
 	"github.com/spf13/cobra"
 )
 
@@ -39,9 +52,11 @@ func CreateCmd() *cobra.Command {
 
 	// Cmd is the balance command.
 	c := &cobra.Command{
-		Use:    "balance",
-		Short:  "create a balance sheet",
-		Long:   `Compute a balance for a date or set of dates.`,
+		Use:   "balance",
+		Short: "create a balance sheet",
+		Long: `Compute a balance for a date or set of dates. With --format json, the report is printed as
+JSON, wrapped in the envelope described in doc/output.md. With --output report.xlsx, the report is
+written to an Excel workbook instead, with one sheet per household member with --group-by member.`,
 		Args:   cobra.ExactValidArgs(1),
 		Run:    r.run,
 		Hidden: true,
@@ -57,6 +72,8 @@ type runner struct {
 	// journal structure
 	close     bool
 	valuation flags.CommodityFlag
+	valMode   string
+	cached    bool
 
 	// alignment
 	period   flags.PeriodFlag
@@ -70,16 +87,45 @@ type runner struct {
 	// filters
 	accounts    flags.RegexFlag
 	commodities flags.RegexFlag
+	metadata    flags.RegexFlag
+	links       flags.RegexFlag
+	tags        []string
+	pending     bool
+	cleared     bool
+
+	// valuation gains
+	hideGains, separateGains flags.RegexFlag
+	gainsAccount             flags.AccountFlag
+
+	// realized gains
+	realizeGains        bool
+	capitalGainsAccount flags.AccountFlag
+	lotMethod           string
 
 	// report structure
+	groupBy            string
 	diff               bool
 	showCommodities    bool
 	sortAlphabetically bool
+	totals             bool
+	percentOfTotal     bool
+	percentChange      bool
+	rolling            int
+	isoWeeks           bool
+	pivot              string
+	pivotTags          flags.RegexFlag
 
 	// formatting
 	thousands bool
 	color     bool
 	digits    int32
+	template  string
+	format    string
+	output    string
+	chart     bool
+
+	// checkpoint file
+	checkpoint string
 }
 
 func (r *runner) run(cmd *cobra.Command, args []string) {
@@ -106,15 +152,43 @@ func (r *runner) setupFlags(c *cobra.Command) {
 	c.Flags().BoolVar(&r.close, "close", true, "close")
 	c.Flags().BoolVarP(&r.sortAlphabetically, "sort", "a", false, "Sort accounts alphabetically")
 	c.Flags().BoolVarP(&r.showCommodities, "show-commodities", "s", false, "Show commodities on their own rows")
+	c.Flags().BoolVar(&r.totals, "totals", false, "Show totals per section, the net assets (A-L) and a check row (A-L-E)")
+	c.Flags().BoolVar(&r.percentOfTotal, "percent-of-total", false, "Show the share of each row in the total of its section")
+	c.Flags().BoolVar(&r.percentChange, "percent-change", false, "Show the change of each row versus the previous period in percent")
+	c.Flags().IntVar(&r.rolling, "rolling", 0, "Show the average of each row over the trailing n periods")
+	c.Flags().BoolVar(&r.isoWeeks, "iso-weeks", false, "Title the columns with the ISO week of their date, such as 2020-W05")
+	c.Flags().StringVar(&r.pivot, "pivot", "", "show a column per tag, per value of a tag or per commodity instead of per date (tag, tag:<key> or commodity)")
+	c.Flags().Var(&r.pivotTags, "pivot-tag", "with --pivot tag, only show the tags matching a regex")
+	c.Flags().StringVar(&r.groupBy, "group-by", "", "print a report per household member (member)")
 	r.interval.Setup(c, date.Yearly)
 	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity")
-	c.Flags().VarP(&r.mapping, "map", "m", "<level>,<regex>")
+	c.Flags().BoolVar(&r.cached, "cached-quotes", false, "also valuate with the quotes cached by knut fetch")
+	c.Flags().StringVar(&r.valMode, "val-mode", "historic", "valuate at the prices of each date (historic) or at the latest prices at the end of the period (latest)")
+	c.Flags().VarP(&r.mapping, "map", "m", "<level>,<regex>, <glob> -> <account> or <account>:<depth>,...")
+	c.Flags().Var(r.mapping.File(), "map-file", "read --map rules from the given file, one per line")
 	c.Flags().VarP(&r.remap, "remap", "r", "<regex>")
 	c.Flags().Var(&r.accounts, "account", "filter accounts with a regex")
 	c.Flags().Var(&r.commodities, "commodity", "filter commodities with a regex")
+	c.Flags().Var(&r.metadata, "meta", "filter postings with metadata matching a regex, as key=value")
+	c.Flags().Var(&r.links, "link", "filter transactions with a link matching a regex")
+	c.Flags().StringArrayVar(&r.tags, "tag", nil, "filter postings with a tag, given as key or key=value")
+	c.Flags().BoolVar(&r.pending, "pending", false, "only include pending transactions (flagged with !)")
+	c.Flags().BoolVar(&r.cleared, "cleared", false, "only include cleared transactions (flagged with *)")
+	c.MarkFlagsMutuallyExclusive("pending", "cleared")
+	c.Flags().Var(&r.hideGains, "hide-gains", "hide the valuation gains of commodities matching a regex")
+	c.Flags().Var(&r.separateGains, "separate-gains", "book the valuation gains of commodities matching a regex to --gains-account")
+	c.Flags().Var(&r.gainsAccount, "gains-account", "account for separated valuation gains (default Equity:Revaluation)")
+	c.Flags().BoolVar(&r.realizeGains, "realize-gains", false, "book the realized gains of disposed lots to --capital-gains-account")
+	c.Flags().Var(&r.capitalGainsAccount, "capital-gains-account", "account for realized gains (default Income:CapitalGains)")
+	c.Flags().StringVar(&r.lotMethod, "lot-method", "average", "the method to reduce lots when realizing gains (average, fifo or lifo)")
 	c.Flags().Int32Var(&r.digits, "digits", 0, "round to number of digits")
 	c.Flags().BoolVarP(&r.thousands, "thousands", "k", false, "show numbers in units of 1000")
 	c.Flags().BoolVar(&r.color, "color", true, "print output in color")
+	c.Flags().StringVar(&r.template, "template", "", "render the report with the given text/template file")
+	c.Flags().StringVar(&r.format, "format", "text", "output format (text or json)")
+	c.Flags().BoolVar(&r.chart, "chart", false, "show the balances over the periods as sparklines")
+	c.Flags().StringVar(&r.output, "output", "", "write the report to the given Excel file (.xlsx)")
+	c.Flags().StringVar(&r.checkpoint, "checkpoint", "", "resume from and save the state before the first period to the given file")
 }
 
 func (r runner) execute(cmd *cobra.Command, args []string) error {
@@ -123,17 +197,110 @@ func (r runner) execute(cmd *cobra.Command, args []string) error {
 		valuation *journal.Commodity
 		err       error
 	)
+	if err := output.ValidateFormat(r.format); err != nil {
+		return err
+	}
+	if r.format == "json" && r.template != "" {
+		return fmt.Errorf("--template cannot be combined with --format json")
+	}
+	if r.output != "" && strings.ToLower(filepath.Ext(r.output)) != ".xlsx" {
+		return fmt.Errorf("invalid --output %q, expected an .xlsx file", r.output)
+	}
+	if r.output != "" && (r.format == "json" || r.template != "") {
+		return fmt.Errorf("--output cannot be combined with --format json or --template")
+	}
+	if r.chart && (r.format == "json" || r.template != "" || r.output != "") {
+		return fmt.Errorf("--chart cannot be combined with --format json, --template or --output")
+	}
+	if (r.percentOfTotal || r.percentChange) && (r.format == "json" || r.template != "" || r.chart) {
+		return fmt.Errorf("--percent-of-total and --percent-change cannot be combined with --format json, --template or --chart")
+	}
+	if r.rolling < 0 {
+		return fmt.Errorf("invalid --rolling %d, expected a nonnegative number of periods", r.rolling)
+	}
+	if r.rolling > 0 && (r.format == "json" || r.template != "" || r.chart) {
+		return fmt.Errorf("--rolling cannot be combined with --format json, --template or --chart")
+	}
+	pivot, pivotKey, hasKey := strings.Cut(r.pivot, ":")
+	if _, ok := pivots[pivot]; !ok || hasKey && (pivot != "tag" || pivotKey == "") {
+		return fmt.Errorf("invalid --pivot %q, expected tag, tag:<key> or commodity", r.pivot)
+	}
+	if r.pivot != "" && (r.format == "json" || r.template != "" || r.chart || r.checkpoint != "") {
+		return fmt.Errorf("--pivot cannot be combined with --format json, --template, --chart or --checkpoint")
+	}
+	if r.pivot != "" && (r.diff || r.percentChange || r.rolling > 0) {
+		return fmt.Errorf("--pivot cannot be combined with --diff, --percent-change or --rolling")
+	}
+	if r.groupBy != "" && r.groupBy != "member" {
+		return fmt.Errorf("invalid --group-by %q, expected member", r.groupBy)
+	}
+	if r.groupBy != "" && (r.format == "json" || r.template != "") {
+		return fmt.Errorf("--group-by cannot be combined with --format json or --template")
+	}
+	if r.valMode != "historic" && r.valMode != "latest" {
+		return fmt.Errorf("invalid --val-mode %q, expected historic or latest", r.valMode)
+	}
+	if r.valMode == "latest" && r.checkpoint != "" {
+		return fmt.Errorf("--val-mode latest cannot be combined with --checkpoint")
+	}
+	if r.realizeGains && r.checkpoint != "" {
+		return fmt.Errorf("--realize-gains cannot be combined with --checkpoint")
+	}
+	if r.checkpoint != "" {
+		for _, name := range checkpointConflicts {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("--%s cannot be combined with --checkpoint", name)
+			}
+		}
+	}
+	lotMethod, err := lots.ParseMethod(r.lotMethod)
+	if err != nil {
+		return err
+	}
 	if valuation, err = r.valuation.Value(jctx); err != nil {
 		return err
 	}
+	if r.realizeGains && valuation == nil {
+		return fmt.Errorf("--realize-gains requires a valuation commodity")
+	}
+	gainsAccount, err := r.gainsAccount.ValueWithDefault(jctx, jctx.Account("Equity:Revaluation"))
+	if err != nil {
+		return err
+	}
+	capitalGainsAccount, err := r.capitalGainsAccount.ValueWithDefault(jctx, jctx.Account("Income:CapitalGains"))
+	if err != nil {
+		return err
+	}
 	r.showCommodities = r.showCommodities || valuation == nil
 	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
 	if err != nil {
 		return err
 	}
+	if r.cached {
+		if err := addCachedQuotes(j); err != nil {
+			return err
+		}
+	}
 	period := r.period.Value().Clip(j.Period())
-	dates := period.Dates(r.interval.Value(), r.last)
+	dates := r.interval.Dates(period, r.last)
+	if r.pivot != "" && len(dates) > 0 {
+		// a pivoted report shows the totals at the end of the period
+		dates = dates[len(dates)-1:]
+	}
+	// a checkpoint can only replace the days which are aggregated into
+	// the first period, before any income accounts are closed
+	checkpoint := r.checkpoint != "" && len(dates) > 0 && !period.Start.After(j.Min())
+	if checkpoint {
+		if err := resume(j, r.checkpoint, valuation, dates[0]); err != nil {
+			return err
+		}
+	}
 	rep := report.NewReport(jctx, dates)
+	members := memberReports{jctx: jctx, dates: dates, reports: make(map[string]*report.Report)}
+	var collection journal.Collection = rep
+	if r.groupBy == "member" {
+		collection = members
+	}
 	f := filter.And(
 		journal.FilterDates(period.Contains),
 		filter.Or(
@@ -141,8 +308,13 @@ func (r runner) execute(cmd *cobra.Command, args []string) error {
 			journal.FilterOther(r.accounts.Regex()),
 		),
 		journal.FilterCommodity(r.commodities.Regex()),
+		journal.FilterMetadata(r.metadata.Regex()),
+		journal.FilterLink(r.links.Regex()),
+		journal.FilterTagValues(r.tags),
+		journal.FilterFlags(r.flags()...),
+		journal.FilterValuationGains(jctx, r.hideGains.Regex()),
 	)
-	m := journal.KeyMapper{
+	m := mapper.Combine(journal.MapValuationGains(jctx, r.separateGains.Regex(), gainsAccount), journal.KeyMapper{
 		Date: date.Align(dates),
 		Account: mapper.Combine(
 			journal.RemapAccount(jctx, r.remap.Regex()),
@@ -151,27 +323,192 @@ func (r runner) execute(cmd *cobra.Command, args []string) error {
 		Other:     mapper.Identity[*journal.Account],
 		Commodity: mapper.Identity[*journal.Commodity],
 		Valuation: journal.MapCommodity(valuation != nil),
-	}.Build()
+		Member:    mapper.If[string](r.groupBy == "member"),
+		Tags:      pivotTags(pivot == "tag", pivotKey, r.pivotTags.Regex()),
+	}.Build())
+	var cp journal.Checkpoint
+	computePrices := journal.ComputePrices(valuation)
+	if r.valMode == "latest" {
+		computePrices = journal.ComputeLatestPrices(j, valuation, period.End)
+	}
 	processors := []journal.DayFn{
-		journal.ComputePrices(valuation),
+		computePrices,
 		journal.Balance(jctx, valuation),
-		journal.CloseAccounts(j, dates),
-		journal.Query(f, m, valuation, rep),
 	}
+	if r.realizeGains {
+		tracker := lots.New(jctx, valuation, lotMethod)
+		tracker.BookGains(capitalGainsAccount)
+		processors = append(processors, tracker.Process)
+	}
+	if checkpoint {
+		processors = append(processors, journal.Record(j, valuation, dates[0], &cp))
+	}
+	processors = append(processors,
+		journal.CloseAccounts(j, dates),
+		journal.Query(f, m, valuation, collection),
+	)
 	if _, err := j.Process(processors...); err != nil {
 		return err
 	}
+	if checkpoint && !cp.Date.IsZero() {
+		if err := cp.WriteFile(r.checkpoint); err != nil {
+			return err
+		}
+	}
 	reportRenderer := report.Renderer{
 		ShowCommodities:    r.showCommodities,
 		SortAlphabetically: r.sortAlphabetically,
 		Diff:               r.diff,
+		Totals:             r.totals,
+		PercentOfTotal:     r.percentOfTotal,
+		PercentChange:      r.percentChange,
+		Rolling:            r.rolling,
+		ISOWeeks:           r.isoWeeks,
+		Pivot:              pivots[pivot],
 	}
-	tableRenderer := table.TextRenderer{
+	if r.output != "" {
+		sheets := []table.Sheet{{Name: "Balance", Table: reportRenderer.Render(rep)}}
+		if r.groupBy == "member" {
+			sheets = members.tables(reportRenderer)
+		}
+		xr := table.XLSXRenderer{Thousands: r.thousands, Round: r.digits}
+		var buf bytes.Buffer
+		if err := xr.RenderSheets(&buf, sheets...); err != nil {
+			return err
+		}
+		return atomic.WriteFile(r.output, &buf)
+	}
+	out := bufio.NewWriter(cmd.OutOrStdout())
+	defer out.Flush()
+	if r.format == "json" {
+		return output.WriteJSON(out, cmd, args, reportRenderer.Model(rep))
+	}
+	if r.template != "" {
+		tmpl, err := report.ParseTemplate(r.template)
+		if err != nil {
+			return err
+		}
+		return reportRenderer.RenderTemplate(rep, tmpl, out)
+	}
+	var tableRenderer table.Renderer = &table.TextRenderer{
 		Color:     r.color,
 		Thousands: r.thousands,
 		Round:     r.digits,
 	}
-	out := bufio.NewWriter(cmd.OutOrStdout())
-	defer out.Flush()
+	if r.chart {
+		tableRenderer = &table.SparklineRenderer{
+			Color:     r.color,
+			Thousands: r.thousands,
+			Round:     r.digits,
+		}
+	}
+	if r.groupBy == "member" {
+		return members.render(out, reportRenderer, tableRenderer)
+	}
 	return tableRenderer.Render(reportRenderer.Render(rep), out)
 }
+
+var pivots = map[string]report.Pivot{
+	"":          report.PivotDates,
+	"tag":       report.PivotTags,
+	"commodity": report.PivotCommodities,
+}
+
+// checkpointConflicts are the flags which filter, map or group postings.
+// They cannot be combined with a checkpoint, which only restores the
+// balances per account and commodity, without the other accounts, tags,
+// members and metadata of the postings.
+var checkpointConflicts = []string{
+	"account", "commodity", "meta", "link", "tag", "pending", "cleared",
+	"group-by", "map", "map-file", "remap", "hide-gains", "separate-gains",
+}
+
+// pivotTags returns the mapper for the tags of a report pivoted by tags, or
+// by the values of the tag with the given key.
+func pivotTags(pivot bool, key string, rx regex.Regexes) mapper.Mapper[string] {
+	if !pivot {
+		return nil
+	}
+	if key != "" {
+		return mapper.Combine(journal.MapTagKey(key), journal.MapTags(rx))
+	}
+	return journal.MapTags(rx)
+}
+
+// memberReports is a collection which keeps a report per household member.
+type memberReports struct {
+	jctx    journal.Context
+	dates   []time.Time
+	reports map[string]*report.Report
+}
+
+func (mr memberReports) Insert(k journal.Key, v decimal.Decimal) {
+	rep, ok := mr.reports[k.Member]
+	if !ok {
+		rep = report.NewReport(mr.jctx, mr.dates)
+		mr.reports[k.Member] = rep
+	}
+	rep.Insert(k, v)
+}
+
+// tables renders the reports of the members in alphabetical order,
+// followed by the report of the shared transactions.
+func (mr memberReports) tables(rn report.Renderer) []table.Sheet {
+	members := dict.SortedKeys(mr.reports, compare.Ordered[string])
+	if len(members) > 0 && members[0] == "" {
+		members = append(members[1:], "")
+	}
+	res := make([]table.Sheet, 0, len(members))
+	for _, member := range members {
+		name := member
+		if name == "" {
+			name = "(shared)"
+		}
+		res = append(res, table.Sheet{Name: name, Table: rn.Render(mr.reports[member])})
+	}
+	return res
+}
+
+func (mr memberReports) render(w io.Writer, rn report.Renderer, tr table.Renderer) error {
+	for _, s := range mr.tables(rn) {
+		if _, err := fmt.Fprintf(w, "Member: %s\n", s.Name); err != nil {
+			return err
+		}
+		if err := tr.Render(s.Table, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flags returns the transaction flags to filter by.
+func (r runner) flags() []journal.Flag {
+	switch {
+	case r.pending:
+		return []journal.Flag{journal.Pending}
+	case r.cleared:
+		return []journal.Flag{journal.Cleared}
+	}
+	return nil
+}
+
+// addCachedQuotes adds the quotes in the default quotes cache as prices
+// to the journal.
+func addCachedQuotes(j *journal.Journal) error {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return err
+	}
+	return cache.New(dir).AddPrices(j)
+}
+
+// resume resumes the journal from the checkpoint in the given file, if it
+// exists and still matches the journal.
+func resume(j *journal.Journal, path string, valuation *journal.Commodity, t time.Time) error {
+	cp, err := journal.ReadCheckpoint(path)
+	if err != nil || cp == nil || cp.Date.After(t) {
+		return err
+	}
+	_, err = j.Resume(cp, valuation)
+	return err
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package budget
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/budget"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	c := &cobra.Command{
+		Use:   "budget",
+		Short: "compare budgeted and actual spending",
+		Long: `Compare the amounts assigned to accounts by budget directives with the actual spending, per
+month, quarter or year. For each period, the report shows the budget, the actual spending and
+the variance, which is negative if the budget is exceeded. Spending on an account counts towards
+the budget of the account or its closest ancestor with a budget. With --val, spending in other
+commodities counts towards budgets in the valuation commodity.`,
+		Args: cobra.ExactValidArgs(1),
+		Run:  r.run,
+	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	period    flags.PeriodFlag
+	interval  flags.IntervalFlags
+	last      int
+	valuation flags.CommodityFlag
+	accounts  flags.RegexFlag
+	digits    int32
+	thousands bool
+	color     bool
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	r.period.Setup(c, date.Period{End: date.Today()})
+	r.interval.Setup(c, date.Monthly)
+	c.Flags().IntVar(&r.last, "last", 0, "last n periods")
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity")
+	c.Flags().Var(&r.accounts, "account", "filter budgeted accounts with a regex")
+	c.Flags().Int32Var(&r.digits, "digits", 0, "round to number of digits")
+	c.Flags().BoolVarP(&r.thousands, "thousands", "k", false, "show numbers in units of 1000")
+	c.Flags().BoolVar(&r.color, "color", true, "print output in color")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *runner) execute(cmd *cobra.Command, args []string) (errors error) {
+	interval := r.interval.Value()
+	switch interval {
+	case date.Monthly, date.Quarterly, date.Yearly:
+	default:
+		return fmt.Errorf("budgets are monthly, use --months, --quarters or --years")
+	}
+	jctx := journal.NewContext()
+	valuation, err := r.valuation.Value(jctx)
+	if err != nil {
+		return err
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	dates := r.interval.Dates(r.period.Value().Clip(j.Period()), r.last)
+	rep := budget.New(jctx, dates, r.interval.StartOf, valuation)
+	if _, err := j.Process(
+		journal.ComputePrices(valuation),
+		journal.Balance(jctx, valuation),
+		rep.Process,
+	); err != nil {
+		return err
+	}
+	var (
+		rows []*budget.Row
+		f    = journal.FilterAccount(r.accounts.Regex())
+	)
+	for _, row := range rep.Rows() {
+		if f(journal.Key{Account: row.Account}) {
+			rows = append(rows, row)
+		}
+	}
+	out := bufio.NewWriter(cmd.OutOrStdout())
+	defer func() { errors = multierr.Append(errors, out.Flush()) }()
+	tr := table.TextRenderer{
+		Color:     r.color,
+		Thousands: r.thousands,
+		Round:     r.digits,
+	}
+	return tr.Render(budget.Render(dates, rows), out)
+}
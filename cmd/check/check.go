@@ -0,0 +1,173 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/output"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	c := &cobra.Command{
+		Use:   "check",
+		Short: "check the journal",
+		Long: `Parse and balance the journal, reporting any errors. With --format json, the output is
+an envelope (see doc/output.md) whose data is an array of errors with a machine-readable code,
+the source position, the offending directive and a suggested fix.
+
+Budgets whose month-to-date spending has reached their alert threshold or exceeds the budgeted
+amount are reported as warnings (code WARN_BUDGET). Warnings do not cause a non-zero exit code.
+Use --date to check the budgets of another month than the current one.
+
+With --strict, using an account before it is opened or a commodity which is not declared with
+a commodity or currency directive is an error, as if the journal contained "option strict".
+
+With --repair, a transaction which books the difference of a failed balance assertion against
+a suspense account (--suspense, Expenses:TBD by default) is printed as a comment block below the
+error. Review it before pasting it into the journal.`,
+		Args: cobra.ExactValidArgs(1),
+		Run:  r.run,
+	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	valuation flags.CommodityFlag
+	format    string
+	date      flags.DateFlag
+	repair    bool
+	suspense  flags.AccountFlag
+	strict    bool
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity")
+	c.Flags().StringVar(&r.format, "format", "text", "output format (text or json)")
+	c.Flags().Var(&r.date, "date", "check budgets for the month up to the given date (default today)")
+	c.Flags().BoolVar(&r.repair, "repair", false, "suggest transactions which fix failed balance assertions")
+	c.Flags().Var(&r.suspense, "suspense", "book repairs against the given account (default Expenses:TBD)")
+	c.Flags().BoolVar(&r.strict, "strict", false, "require accounts to be opened and commodities to be declared before they are used")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	errs, err := r.execute(cmd, args)
+	if err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+	if err := r.print(cmd, args, errs); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+	for _, e := range errs {
+		if e.Code != journal.WarnBudget {
+			os.Exit(1)
+		}
+	}
+}
+
+func (r *runner) execute(cmd *cobra.Command, args []string) ([]journal.Error, error) {
+	if err := output.ValidateFormat(r.format); err != nil {
+		return nil, err
+	}
+	var (
+		jctx      = journal.NewContext()
+		valuation *journal.Commodity
+		err       error
+	)
+	if valuation, err = r.valuation.Value(jctx); err != nil {
+		return nil, err
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return journal.Errors(err), nil
+	}
+	return r.withRepairs(jctx, j.Check(r.date.ValueOr(date.Today()), valuation, r.strict))
+}
+
+func (r *runner) print(cmd *cobra.Command, args []string, errs []journal.Error) error {
+	w := cmd.OutOrStdout()
+	if r.format == "json" {
+		if errs == nil {
+			errs = []journal.Error{}
+		}
+		return output.WriteJSON(w, cmd, args, errs)
+	}
+	for _, e := range errs {
+		if _, err := fmt.Fprintln(w, e.Error()); err != nil {
+			return err
+		}
+		if e.Repair == nil {
+			continue
+		}
+		if err := printRepair(w, e.Repair); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printRepair prints the transaction as a comment block.
+func printRepair(w io.Writer, t *journal.Transaction) error {
+	var (
+		p journal.Printer
+		b strings.Builder
+	)
+	if _, err := p.PrintDirective(&b, t); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "# suggested transaction:"); err != nil {
+		return err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if _, err := fmt.Fprintf(w, "# %s\n", line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// withRepairs adds repairs to the failed assertions if they have been
+// requested, booking the difference against the suspense account.
+func (r *runner) withRepairs(jctx journal.Context, errs []journal.Error) ([]journal.Error, error) {
+	if !r.repair {
+		return errs, nil
+	}
+	suspense, err := r.suspense.ValueWithDefault(jctx, jctx.TBDAccount())
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range errs {
+		a, ok := e.Directive.(*journal.Assertion)
+		if !ok || e.Code != journal.ErrAssertionFailed || e.Difference.IsZero() {
+			continue
+		}
+		errs[i].Repair = journal.RepairAssertion(a, e.Difference, suspense)
+	}
+	return errs, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmdtest
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Archive is a txtar archive, a comment followed by a sequence of files:
+//
+//	comment
+//	-- name --
+//	content
+//
+// See golang.org/x/tools/txtar for the format.
+type Archive struct {
+	Comment []byte
+	Files   []File
+}
+
+// File is a file in an archive.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Get returns the file with the given name.
+func (a *Archive) Get(name string) (*File, bool) {
+	for i := range a.Files {
+		if a.Files[i].Name == name {
+			return &a.Files[i], true
+		}
+	}
+	return nil, false
+}
+
+// ParseArchive parses a txtar archive.
+func ParseArchive(data []byte) *Archive {
+	var (
+		a       = new(Archive)
+		current = &a.Comment
+	)
+	for len(data) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i+1], data[i+1:]
+		} else {
+			line, data = data, nil
+		}
+		if name, ok := fileMarker(line); ok {
+			a.Files = append(a.Files, File{Name: name})
+			current = &a.Files[len(a.Files)-1].Data
+			continue
+		}
+		*current = append(*current, line...)
+	}
+	return a
+}
+
+// Format returns the archive in txtar format.
+func (a *Archive) Format() []byte {
+	var buf bytes.Buffer
+	buf.Write(fixNewline(a.Comment))
+	for _, f := range a.Files {
+		buf.WriteString("-- " + f.Name + " --\n")
+		buf.Write(fixNewline(f.Data))
+	}
+	return buf.Bytes()
+}
+
+func fileMarker(line []byte) (string, bool) {
+	s := strings.TrimRight(string(line), "\r\n")
+	if !strings.HasPrefix(s, "-- ") || !strings.HasSuffix(s, " --") || len(s) < 7 {
+		return "", false
+	}
+	return strings.TrimSpace(s[3 : len(s)-3]), true
+}
+
+func fixNewline(data []byte) []byte {
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		return append(data, '\n')
+	}
+	return data
+}
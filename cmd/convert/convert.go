@@ -0,0 +1,92 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+
+	"github.com/spf13/cobra"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	c := &cobra.Command{
+		Use:   "convert <amount> <commodity> <target> <journal>",
+		Short: "convert an amount to another commodity",
+		Long: `Convert an amount of a commodity to the target commodity, with the latest prices in the journal
+as of --date (default today). Indirect prices are derived as for valuations. The result is printed
+as "<amount> <target>".`,
+		Example: `knut convert 100 USD CHF --date 2023-06-01 journal.knut`,
+		Args:    cobra.ExactArgs(4),
+		Run:     r.run,
+	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	date   flags.DateFlag
+	digits int32
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	c.Flags().Var(&r.date, "date", "the date of the prices (default today)")
+	c.Flags().Int32Var(&r.digits, "digits", -1, "round to number of digits (default no rounding)")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *runner) execute(cmd *cobra.Command, args []string) error {
+	jctx := journal.NewContext()
+	amount, err := decimal.NewFromString(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid amount %q: %w", args[0], err)
+	}
+	commodity, err := jctx.GetCommodity(args[1])
+	if err != nil {
+		return err
+	}
+	target, err := jctx.GetCommodity(args[2])
+	if err != nil {
+		return err
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[3])
+	if err != nil {
+		return err
+	}
+	t := r.date.ValueOr(date.Today())
+	price, ok := journal.LatestPrices(j, target, t)[commodity]
+	if !ok {
+		return fmt.Errorf("no price of %s in %s as of %s", commodity.Name(), target.Name(), t.Format("2006-01-02"))
+	}
+	res := amount.Mul(price)
+	if r.digits >= 0 {
+		res = res.Round(r.digits)
+	}
+	_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", res, target.Name())
+	return err
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sboehler/knut/cmd/cmdtest"
+
+	// enable importers here
+	_ "github.com/sboehler/knut/cmd/importer/binance"
+	_ "github.com/sboehler/knut/cmd/importer/camt"
+	_ "github.com/sboehler/knut/cmd/importer/cembra"
+	_ "github.com/sboehler/knut/cmd/importer/cumulus"
+	_ "github.com/sboehler/knut/cmd/importer/fidelity"
+	_ "github.com/sboehler/knut/cmd/importer/imap"
+	_ "github.com/sboehler/knut/cmd/importer/interactivebrokers"
+	_ "github.com/sboehler/knut/cmd/importer/migrosbank"
+	_ "github.com/sboehler/knut/cmd/importer/monzo"
+	_ "github.com/sboehler/knut/cmd/importer/mt940"
+	_ "github.com/sboehler/knut/cmd/importer/nordigen"
+	_ "github.com/sboehler/knut/cmd/importer/postfinance"
+	_ "github.com/sboehler/knut/cmd/importer/revolut"
+	_ "github.com/sboehler/knut/cmd/importer/revolut2"
+	_ "github.com/sboehler/knut/cmd/importer/starling"
+	_ "github.com/sboehler/knut/cmd/importer/supercard"
+	_ "github.com/sboehler/knut/cmd/importer/swisscard"
+	_ "github.com/sboehler/knut/cmd/importer/swissquote"
+	_ "github.com/sboehler/knut/cmd/importer/vanguard"
+	_ "github.com/sboehler/knut/cmd/importer/viac"
+)
+
+var update = flag.Bool("update", false, "update the expected output in the test archives")
+
+// TestEndToEnd runs the test cases in testdata/*.txtar. The comment of each
+// archive contains the command line, starting with "knut", and the files of
+// the archive are made available to the command under their names. The
+// archive's "stdout" file holds the expected output. If the command is
+// expected to fail, its "error" file holds the error message. The "stdin"
+// file, if any, is passed to the command as its standard input. A file
+// "want/<name>" holds the expected contents of file <name> after running
+// the command. Run the test with -update to record the actual output.
+func TestEndToEnd(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.txtar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".txtar"), func(t *testing.T) {
+			t.Parallel()
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := cmdtest.ParseArchive(data)
+			stdout, errMsg, files := runArchive(t, a)
+			if *update {
+				setFile(a, "stdout", stdout)
+				setFile(a, "error", errMsg)
+				for name, data := range files {
+					setFile(a, name, data)
+				}
+				if err := os.WriteFile(path, a.Format(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, _ := a.Get("stdout")
+			if want == nil {
+				t.Fatalf("%s: no stdout file", path)
+			}
+			if diff := cmp.Diff(string(want.Data), string(stdout)); diff != "" {
+				t.Errorf("%s: unexpected output (-want/+got):\n%s", path, diff)
+			}
+			var wantErr string
+			if f, ok := a.Get("error"); ok {
+				wantErr = string(f.Data)
+			}
+			if diff := cmp.Diff(wantErr, string(errMsg)); diff != "" {
+				t.Errorf("%s: unexpected error (-want/+got):\n%s", path, diff)
+			}
+			for name, data := range files {
+				want, _ := a.Get(name)
+				if diff := cmp.Diff(string(want.Data), string(data)); diff != "" {
+					t.Errorf("%s: unexpected contents of %s (-want/+got):\n%s", path, strings.TrimPrefix(name, wantPrefix), diff)
+				}
+			}
+		})
+	}
+}
+
+const wantPrefix = "want/"
+
+// runArchive writes the files of the archive to a temporary directory and
+// runs its command. It returns the output, the error message, if any, and
+// the actual contents of the files with expected contents, keyed by the
+// name of the archive file.
+func runArchive(t *testing.T, a *cmdtest.Archive) ([]byte, []byte, map[string][]byte) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, f := range a.Files {
+		if f.Name == "stdout" || f.Name == "error" || f.Name == "stdin" || strings.HasPrefix(f.Name, wantPrefix) {
+			continue
+		}
+		p := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, f.Data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	args := commandLine(t, a)
+	for i, arg := range args {
+		name, value, isFlag := strings.Cut(arg, "=")
+		if !isFlag {
+			name, value = "", arg
+		} else {
+			name += "="
+		}
+		if _, ok := a.Get(value); ok {
+			args[i] = name + filepath.Join(dir, filepath.FromSlash(value))
+		}
+	}
+	var (
+		cmd    = CreateCmd("test")
+		stdout bytes.Buffer
+		errMsg []byte
+	)
+	cmd.SetArgs(args)
+	if f, ok := a.Get("stdin"); ok {
+		cmd.SetIn(bytes.NewReader(f.Data))
+	}
+	cmd.SetOut(&stdout)
+	cmd.SetErr(new(bytes.Buffer))
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	if err := cmd.Execute(); err != nil {
+		errMsg = []byte(err.Error() + "\n")
+	}
+	files := make(map[string][]byte)
+	for _, f := range a.Files {
+		if !strings.HasPrefix(f.Name, wantPrefix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(f.Name, wantPrefix))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = data
+	}
+	prefix := dir + string(filepath.Separator)
+	return bytes.ReplaceAll(stdout.Bytes(), []byte(prefix), nil), bytes.ReplaceAll(errMsg, []byte(prefix), nil), files
+}
+
+// commandLine returns the arguments of the first line of the archive's
+// comment which is neither empty nor a comment.
+func commandLine(t *testing.T, a *cmdtest.Archive) []string {
+	t.Helper()
+	for _, line := range strings.Split(string(a.Comment), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if fields[0] != "knut" {
+			t.Fatalf("command %q does not start with knut", line)
+		}
+		return fields[1:]
+	}
+	t.Fatal("archive has no command")
+	return nil
+}
+
+// setFile sets the contents of the named file, removing it if data is empty
+// and it is not the expected output.
+func setFile(a *cmdtest.Archive, name string, data []byte) {
+	for i, f := range a.Files {
+		if f.Name != name {
+			continue
+		}
+		if len(data) == 0 && name != "stdout" {
+			a.Files = append(a.Files[:i], a.Files[i+1:]...)
+		} else {
+			a.Files[i].Data = data
+		}
+		return
+	}
+	if len(data) > 0 || name == "stdout" {
+		a.Files = append(a.Files, cmdtest.File{Name: name, Data: data})
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package equity
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/equity"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	c := &cobra.Command{
+		Use:   "equity",
+		Short: "print a statement of changes in equity",
+		Long: `Reconcile the opening and closing equity, i.e. the value of all assets and liabilities, of
+each period. The changes are split into contributions and withdrawals (bookings against equity
+accounts), retained earnings (bookings against income and expense accounts) and valuation gains
+(the adjustments to market prices, booked against the valuation accounts).`,
+		Args: cobra.ExactValidArgs(1),
+		Run:  r.run,
+	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	period    flags.PeriodFlag
+	interval  flags.IntervalFlags
+	last      int
+	valuation flags.CommodityFlag
+	digits    int32
+	thousands bool
+	color     bool
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	r.period.Setup(c, date.Period{End: date.Today()})
+	r.interval.Setup(c, date.Yearly)
+	c.Flags().IntVar(&r.last, "last", 0, "last n periods")
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity (required)")
+	c.Flags().Int32Var(&r.digits, "digits", 0, "round to number of digits")
+	c.Flags().BoolVarP(&r.thousands, "thousands", "k", false, "show numbers in units of 1000")
+	c.Flags().BoolVar(&r.color, "color", true, "print output in color")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *runner) execute(cmd *cobra.Command, args []string) (errors error) {
+	jctx := journal.NewContext()
+	valuation, err := r.valuation.Value(jctx)
+	if err != nil {
+		return err
+	}
+	if valuation == nil {
+		return fmt.Errorf("equity requires a valuation commodity")
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	period := r.period.Value().Clip(j.Period())
+	dates := r.interval.Dates(period, r.last)
+	start := r.interval.Start(period, dates)
+	s := equity.New(jctx, start, dates)
+	if _, err := j.Process(
+		journal.ComputePrices(valuation),
+		journal.Balance(jctx, valuation),
+		journal.Query(nil, nil, valuation, s),
+	); err != nil {
+		return err
+	}
+	out := bufio.NewWriter(cmd.OutOrStdout())
+	defer func() { errors = multierr.Append(errors, out.Flush()) }()
+	tr := table.TextRenderer{
+		Color:     r.color,
+		Thousands: r.thousands,
+		Round:     r.digits,
+	}
+	return tr.Render(equity.Render(s.Periods()), out)
+}
@@ -0,0 +1,98 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/filter"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func createCSVCmd() *cobra.Command {
+	var r csvRunner
+	cmd := &cobra.Command{
+		Use:   "csv <journal>",
+		Short: "export the postings as CSV",
+		Long: `Print all postings of the journal as CSV, one row per posting, with the date, account,
+other account, commodity, amount, value, description and tags. Every booking appears as two
+rows, one for each of its accounts. The value is only set with --val.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		Run: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+type csvRunner struct {
+	period      flags.PeriodFlag
+	valuation   flags.CommodityFlag
+	accounts    flags.RegexFlag
+	commodities flags.RegexFlag
+}
+
+func (r *csvRunner) setupFlags(c *cobra.Command) {
+	r.period.Setup(c, date.Period{End: date.Today()})
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity")
+	c.Flags().Var(&r.accounts, "account", "filter accounts with a regex")
+	c.Flags().Var(&r.commodities, "commodity", "filter commodities with a regex")
+}
+
+func (r *csvRunner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *csvRunner) execute(cmd *cobra.Command, args []string) error {
+	jctx := journal.NewContext()
+	valuation, err := r.valuation.Value(jctx)
+	if err != nil {
+		return err
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	period := r.period.Value().Clip(j.Period())
+	w := csv.NewWriter(cmd.OutOrStdout())
+	if err := w.Write(journal.CSVHeader); err != nil {
+		return err
+	}
+	f := filter.And(
+		journal.FilterDates(period.Contains),
+		journal.FilterAccount(r.accounts.Regex()),
+		journal.FilterCommodity(r.commodities.Regex()),
+	)
+	if _, err := j.Process(
+		journal.ComputePrices(valuation),
+		journal.Balance(jctx, valuation),
+		journal.Sort(),
+		journal.WriteCSV(w, f, valuation),
+	); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
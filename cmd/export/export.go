@@ -0,0 +1,56 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/natefinch/atomic"
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "export the journal",
+		Long:  `Export the processed journal into other formats, for analysis with external tools.`,
+	}
+	cmd.AddCommand(createCSVCmd())
+	cmd.AddCommand(createJSONCmd())
+	cmd.AddCommand(createParquetCmd())
+	cmd.AddCommand(createPricesCmd())
+	cmd.AddCommand(createSQLiteCmd())
+	return cmd
+}
+
+// replaceFile calls write with the path of a new file next to target, and
+// replaces target with it if write succeeds.
+func replaceFile(target string, write func(path string) error) error {
+	f, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err := multierr.Append(f.Chmod(0644), f.Close()); err != nil {
+		return multierr.Append(err, os.Remove(tmp))
+	}
+	if err := write(tmp); err != nil {
+		return multierr.Append(err, os.Remove(tmp))
+	}
+	return atomic.ReplaceFile(tmp, target)
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/output"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func createJSONCmd() *cobra.Command {
+	var r jsonRunner
+	cmd := &cobra.Command{
+		Use:   "json <journal>",
+		Short: "export the journal as JSON",
+		Long: `Print the processed journal as JSON, wrapped in the envelope described in doc/output.md.
+The data holds the days of the journal with their prices, openings, transactions, balance
+assertions and closings. With --val, the value of each posting in the valuation commodity is
+included, as well as the transactions which adjust the values to market prices.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		Run: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+type jsonRunner struct {
+	valuation flags.CommodityFlag
+}
+
+func (r *jsonRunner) setupFlags(c *cobra.Command) {
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity")
+}
+
+func (r *jsonRunner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *jsonRunner) execute(cmd *cobra.Command, args []string) (errors error) {
+	jctx := journal.NewContext()
+	valuation, err := r.valuation.Value(jctx)
+	if err != nil {
+		return err
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	l, err := j.Process(
+		journal.ComputePrices(valuation),
+		journal.Balance(jctx, valuation),
+	)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(cmd.OutOrStdout())
+	defer func() { errors = multierr.Append(errors, out.Flush()) }()
+	return output.WriteJSON(out, cmd, args, journal.NewJSONJournal(l.Days, valuation, false))
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/filter"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/parquet"
+)
+
+func createParquetCmd() *cobra.Command {
+	var r parquetRunner
+	cmd := &cobra.Command{
+		Use:   "parquet <journal> <out.parquet>",
+		Short: "export the postings as Parquet",
+		Long: `Write all postings of the journal into a Parquet file, with the same columns as export csv,
+for analysis with tools like DuckDB or Pandas. Amounts and values are stored as doubles. An
+existing file at the given path is replaced.`,
+
+		Args: cobra.ExactValidArgs(2),
+
+		Run: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+type parquetRunner struct {
+	period      flags.PeriodFlag
+	valuation   flags.CommodityFlag
+	accounts    flags.RegexFlag
+	commodities flags.RegexFlag
+}
+
+func (r *parquetRunner) setupFlags(c *cobra.Command) {
+	r.period.Setup(c, date.Period{End: date.Today()})
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity")
+	c.Flags().Var(&r.accounts, "account", "filter accounts with a regex")
+	c.Flags().Var(&r.commodities, "commodity", "filter commodities with a regex")
+}
+
+func (r *parquetRunner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *parquetRunner) execute(cmd *cobra.Command, args []string) error {
+	jctx := journal.NewContext()
+	valuation, err := r.valuation.Value(jctx)
+	if err != nil {
+		return err
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	period := r.period.Value().Clip(j.Period())
+	f := filter.And(
+		journal.FilterDates(period.Contains),
+		journal.FilterAccount(r.accounts.Regex()),
+		journal.FilterCommodity(r.commodities.Regex()),
+	)
+	return replaceFile(args[1], func(path string) error {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+		if err != nil {
+			return err
+		}
+		out := bufio.NewWriter(file)
+		w, err := parquet.NewWriter(out)
+		if err != nil {
+			return multierr.Append(err, file.Close())
+		}
+		if _, err := j.Process(
+			journal.ComputePrices(valuation),
+			journal.Balance(jctx, valuation),
+			journal.Sort(),
+			w.Write(f, valuation),
+		); err != nil {
+			return multierr.Append(err, file.Close())
+		}
+		return multierr.Combine(w.Close(), out.Flush(), file.Close())
+	})
+}
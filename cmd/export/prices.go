@@ -0,0 +1,149 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/output"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func createPricesCmd() *cobra.Command {
+	var r pricesRunner
+	cmd := &cobra.Command{
+		Use:   "prices <journal>",
+		Short: "export the price history in a valuation commodity",
+		Long: `Print the prices of all commodities in the valuation commodity, as computed from the
+price directives of the journal, including prices derived through other commodities. By default,
+the prices are printed for each day on which a price is given. With --days, --weeks, --months,
+--quarters or --years, the most recent prices as of the end of each period are printed instead.
+The output is CSV with the columns date, commodity and price, or JSON with --format json.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		Run: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+type pricesRunner struct {
+	period      flags.PeriodFlag
+	interval    flags.IntervalFlags
+	valuation   flags.CommodityFlag
+	commodities flags.RegexFlag
+	format      string
+}
+
+func (r *pricesRunner) setupFlags(c *cobra.Command) {
+	r.period.Setup(c, date.Period{End: date.Today()})
+	r.interval.Setup(c, date.Once)
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity")
+	c.Flags().Var(&r.commodities, "commodity", "filter commodities with a regex")
+	c.Flags().StringVar(&r.format, "format", "csv", "output format (csv or json)")
+	c.MarkFlagRequired("val")
+}
+
+func (r *pricesRunner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *pricesRunner) execute(cmd *cobra.Command, args []string) (errors error) {
+	if r.format != "csv" && r.format != "json" {
+		return fmt.Errorf("invalid format %q, expected csv or json", r.format)
+	}
+	jctx := journal.NewContext()
+	valuation, err := r.valuation.Value(jctx)
+	if err != nil {
+		return err
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	l, err := j.Process(journal.ComputePrices(valuation))
+	if err != nil {
+		return err
+	}
+	// the period of the journal only starts with its first transaction
+	period := r.period.Value()
+	if len(l.Days) > 0 {
+		period = period.Clip(date.Period{Start: l.Days[0].Date, End: j.Max()})
+	}
+	var dates []time.Time
+	if interval := r.interval.Value(); interval != date.Once {
+		dates = r.interval.Dates(period, 0)
+	}
+	var (
+		quotes []journal.PriceQuote
+		f      = journal.FilterCommodity(r.commodities.Regex())
+	)
+	for _, q := range journal.PriceHistory(l.Days, valuation, dates) {
+		if period.Contains(q.Date) && f(journal.Key{Commodity: q.Commodity}) {
+			quotes = append(quotes, q)
+		}
+	}
+	out := bufio.NewWriter(cmd.OutOrStdout())
+	defer func() { errors = multierr.Append(errors, out.Flush()) }()
+	if r.format == "json" {
+		return output.WriteJSON(out, cmd, args, newJSONPrices(valuation, quotes))
+	}
+	w := csv.NewWriter(out)
+	w.Write([]string{"date", "commodity", "price"})
+	for _, q := range quotes {
+		w.Write([]string{q.Date.Format("2006-01-02"), q.Commodity.Name(), q.Price.String()})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+type jsonPrices struct {
+	Valuation string      `json:"valuation"`
+	Prices    []jsonQuote `json:"prices"`
+}
+
+type jsonQuote struct {
+	Date      string `json:"date"`
+	Commodity string `json:"commodity"`
+	Price     string `json:"price"`
+}
+
+func newJSONPrices(valuation *journal.Commodity, quotes []journal.PriceQuote) jsonPrices {
+	res := jsonPrices{
+		Valuation: valuation.Name(),
+		Prices:    make([]jsonQuote, 0, len(quotes)),
+	}
+	for _, q := range quotes {
+		res.Prices = append(res.Prices, jsonQuote{
+			Date:      q.Date.Format("2006-01-02"),
+			Commodity: q.Commodity.Name(),
+			Price:     q.Price.String(),
+		})
+	}
+	return res
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/sqlite"
+)
+
+func createSQLiteCmd() *cobra.Command {
+	var r sqliteRunner
+	cmd := &cobra.Command{
+		Use:   "sqlite <journal> <out.db>",
+		Short: "export the journal into a SQLite database",
+		Long: `Write the accounts, commodities, transactions, postings and prices of the journal into a
+new SQLite database, to run ad-hoc SQL queries over the journal. An existing database at the
+given path is replaced. With --val, the value of each posting in the valuation commodity is
+written as well.`,
+
+		Args: cobra.ExactValidArgs(2),
+
+		Run: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+type sqliteRunner struct {
+	valuation flags.CommodityFlag
+}
+
+func (r *sqliteRunner) setupFlags(c *cobra.Command) {
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity")
+}
+
+func (r *sqliteRunner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *sqliteRunner) execute(cmd *cobra.Command, args []string) error {
+	jctx := journal.NewContext()
+	valuation, err := r.valuation.Value(jctx)
+	if err != nil {
+		return err
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	l, err := j.Process(
+		journal.ComputePrices(valuation),
+		journal.Balance(jctx, valuation),
+	)
+	if err != nil {
+		return err
+	}
+	return replaceFile(args[1], func(tmp string) error {
+		db, err := sqlite.Open(tmp)
+		if err != nil {
+			return err
+		}
+		return multierr.Append(sqlite.Export(cmd.Context(), db, l.Days, valuation), db.Close())
+	})
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/sboehler/knut/lib/common/date"
 	"github.com/sboehler/knut/lib/common/regex"
 	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/payees"
 )
 
 // DateFlag manages a flag to determine a date.
@@ -37,7 +38,10 @@ type DateFlag time.Time
 var _ pflag.Value = (*DateFlag)(nil)
 
 func (tf DateFlag) String() string {
-	return tf.Value().String()
+	if tf.Value().IsZero() {
+		return ""
+	}
+	return tf.Value().Format("2006-01-02")
 }
 
 // Set implements pflag.Value.
@@ -102,10 +106,53 @@ func (rf *RegexFlag) Regex() regex.Regexes {
 	return rf.rxs
 }
 
+// MonthFlag manages a flag to determine a month, given by its number or
+// its English name.
+type MonthFlag time.Month
+
+var _ pflag.Value = (*MonthFlag)(nil)
+
+func (mf MonthFlag) String() string {
+	if mf == 0 {
+		return ""
+	}
+	return strings.ToLower(time.Month(mf).String())
+}
+
+// Set implements pflag.Value.
+func (mf *MonthFlag) Set(v string) error {
+	if n, err := strconv.Atoi(v); err == nil {
+		if n < 1 || n > 12 {
+			return fmt.Errorf("invalid month %d, expected 1-12", n)
+		}
+		*mf = MonthFlag(n)
+		return nil
+	}
+	for m := time.January; m <= time.December; m++ {
+		if name := strings.ToLower(m.String()); len(v) >= 3 && strings.HasPrefix(name, strings.ToLower(v)) {
+			*mf = MonthFlag(m)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid month %q", v)
+}
+
+// Type implements pflag.Value.
+func (mf MonthFlag) Type() string {
+	return "<month>"
+}
+
+// Value returns the flag value.
+func (mf MonthFlag) Value() time.Month {
+	return time.Month(mf)
+}
+
 // IntervalFlags manages multiple flags to determine a time period.
 type IntervalFlags struct {
-	def   date.Interval
-	flags [6]bool
+	def       date.Interval
+	flags     [6]bool
+	every     int
+	yearStart MonthFlag
 }
 
 // Setup configures the flags.
@@ -116,6 +163,8 @@ func (pf *IntervalFlags) Setup(cmd *cobra.Command, def date.Interval) {
 	cmd.Flags().BoolVar(&pf.flags[date.Quarterly], "quarters", false, "quarters")
 	cmd.Flags().BoolVar(&pf.flags[date.Yearly], "years", false, "years")
 	cmd.MarkFlagsMutuallyExclusive("days", "weeks", "months", "quarters", "years")
+	cmd.Flags().IntVar(&pf.every, "every", 1, "number of intervals per period, e.g. --weeks --every 2 for bi-weekly periods")
+	cmd.Flags().Var(&pf.yearStart, "fiscal-year-start", "first month of the fiscal year, for quarters and years")
 	pf.def = def
 }
 
@@ -129,6 +178,40 @@ func (pf IntervalFlags) Value() date.Interval {
 	return pf.def
 }
 
+// Calendar returns the calendar with the fiscal year.
+func (pf IntervalFlags) Calendar() date.Calendar {
+	return date.Calendar{YearStart: pf.yearStart.Value()}
+}
+
+// Dates returns the ends of the periods within period, or the last n of
+// them if n is positive.
+func (pf IntervalFlags) Dates(period date.Period, n int) []time.Time {
+	return pf.Calendar().Every(period, pf.Value(), pf.every, n)
+}
+
+// StartOf returns the start of the period ending at t, which is one of
+// the dates returned by Dates.
+func (pf IntervalFlags) StartOf(t time.Time) time.Time {
+	s := pf.Calendar().StartOf(t, pf.Value())
+	if pf.every > 1 {
+		s = date.Add(s, pf.Value(), 1-pf.every)
+	}
+	return s
+}
+
+// Start returns the start of the first of the periods ending at dates,
+// which are returned by Dates for period. With a limited number of dates,
+// the first period may start after the start of period.
+func (pf IntervalFlags) Start(period date.Period, dates []time.Time) time.Time {
+	if len(dates) == 0 || pf.Value() == date.Once {
+		return period.Start
+	}
+	if s := pf.StartOf(dates[0]); s.After(period.Start) {
+		return s
+	}
+	return period.Start
+}
+
 type PeriodFlag struct {
 	start, end DateFlag
 }
@@ -144,7 +227,8 @@ func (pf *PeriodFlag) Value() date.Period {
 	return date.Period{Start: pf.start.Value(), End: pf.end.Value()}
 }
 
-// MappingFlag manages a flag of type -c1,<regex>.
+// MappingFlag manages a flag of type <level>,<regex>, <glob> -> <account>
+// or <account>:<depth>,... .
 type MappingFlag struct {
 	m journal.AccountMapping
 }
@@ -157,13 +241,29 @@ func (cf MappingFlag) String() string {
 
 // Type implements pflag.Value.
 func (cf MappingFlag) Type() string {
-	return "<level>,<regex>"
+	return "<level>,<regex>|<glob> -> <account>|<account>:<depth>,..."
 }
 
 // Set implements pflag.Value.
 func (cf *MappingFlag) Set(v string) error {
+	if strings.Contains(v, "->") {
+		g, err := journal.ParseGlob(v)
+		if err != nil {
+			return err
+		}
+		cf.m = append(cf.m, journal.Rule{Glob: g})
+		return nil
+	}
 	s := strings.SplitN(v, ",", 2)
 	l, err := strconv.Atoi(s[0])
+	if err != nil && strings.Contains(s[0], ":") {
+		m, err := journal.ParseDepths(v)
+		if err != nil {
+			return err
+		}
+		cf.m = append(cf.m, m...)
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("expected integer level, got %q (error: %v)", s[0], err)
 	}
@@ -182,6 +282,77 @@ func (cf *MappingFlag) Value() journal.AccountMapping {
 	return cf.m
 }
 
+// File returns a flag which adds the rules in the given file, one per line.
+// Empty lines and lines starting with # are ignored.
+func (cf *MappingFlag) File() pflag.Value {
+	return fileFlag{cf}
+}
+
+// PayeeFlag manages a flag of type <regex> -> <payee>.
+type PayeeFlag struct {
+	rules payees.Rules
+}
+
+var _ pflag.Value = (*PayeeFlag)(nil)
+
+func (pf PayeeFlag) String() string {
+	return pf.rules.String()
+}
+
+// Type implements pflag.Value.
+func (pf PayeeFlag) Type() string {
+	return "<regex> -> <payee>"
+}
+
+// Set implements pflag.Value.
+func (pf *PayeeFlag) Set(v string) error {
+	r, err := payees.ParseRule(v)
+	if err != nil {
+		return err
+	}
+	pf.rules = append(pf.rules, r)
+	return nil
+}
+
+// Value returns the value of this flag.
+func (pf *PayeeFlag) Value() payees.Rules {
+	return pf.rules
+}
+
+// File returns a flag which adds the rules in the given file, one per line.
+// Empty lines and lines starting with # are ignored.
+func (pf *PayeeFlag) File() pflag.Value {
+	return fileFlag{pf}
+}
+
+// fileFlag sets the wrapped flag for each line of a file.
+type fileFlag struct {
+	pflag.Value
+}
+
+// Type implements pflag.Value.
+func (ff fileFlag) Type() string {
+	return "<file>"
+}
+
+// Set implements pflag.Value.
+func (ff fileFlag) Set(v string) error {
+	bs, err := os.ReadFile(v)
+	if err != nil {
+		return err
+	}
+	for i, line := range strings.Split(string(bs), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := ff.Value.Set(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", v, i+1, err)
+		}
+	}
+	return nil
+}
+
 // CommodityFlag manages a flag to parse a commodity.
 type CommodityFlag struct {
 	val string
@@ -0,0 +1,115 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forecast
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/forecast"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	c := &cobra.Command{
+		Use:   "forecast",
+		Short: "project the balances of asset and liability accounts",
+		Long: `Project the balances of the asset and liability accounts for the next months by extrapolating
+recurring income and expenses. A transaction tagged with #recurring (monthly) or #recurring:<interval>,
+where the interval is daily, weekly, monthly, quarterly or yearly, is repeated at that interval,
+starting from the last transaction with the same description. Other bookings against income and
+expense accounts are considered recurring if they occur in each of the --history months before the
+date, and are projected with their monthly average.`,
+		Args: cobra.ExactValidArgs(1),
+		Run:  r.run,
+	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	date      flags.DateFlag
+	horizon   int
+	history   int
+	accounts  flags.RegexFlag
+	digits    int32
+	thousands bool
+	color     bool
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	c.Flags().Var(&r.date, "date", "the date from which to project (default today)")
+	c.Flags().IntVar(&r.horizon, "horizon", 12, "number of months to project")
+	c.Flags().IntVar(&r.history, "history", 3, "number of months used to detect recurring bookings")
+	c.Flags().Var(&r.accounts, "account", "filter accounts with a regex")
+	c.Flags().Int32Var(&r.digits, "digits", 0, "round to number of digits")
+	c.Flags().BoolVarP(&r.thousands, "thousands", "k", false, "show numbers in units of 1000")
+	c.Flags().BoolVar(&r.color, "color", true, "print output in color")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *runner) execute(cmd *cobra.Command, args []string) (errors error) {
+	if r.horizon <= 0 {
+		return fmt.Errorf("invalid --horizon %d, expected a positive number", r.horizon)
+	}
+	if r.history < 0 {
+		return fmt.Errorf("invalid --history %d, expected a nonnegative number", r.history)
+	}
+	jctx := journal.NewContext()
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	fc := forecast.New(r.date.ValueOr(date.Today()), r.history)
+	if _, err := j.Process(
+		journal.Balance(jctx, nil),
+		fc.Process,
+	); err != nil {
+		return err
+	}
+	var (
+		dates = fc.Dates(r.horizon)
+		rows  []*forecast.Row
+		f     = journal.FilterAccount(r.accounts.Regex())
+	)
+	for _, row := range fc.Rows(dates) {
+		if f(journal.AccountKey(row.Account)) {
+			rows = append(rows, row)
+		}
+	}
+	out := bufio.NewWriter(cmd.OutOrStdout())
+	defer func() { errors = multierr.Append(errors, out.Flush()) }()
+	tr := table.TextRenderer{
+		Color:     r.color,
+		Thousands: r.thousands,
+		Round:     r.digits,
+	}
+	return tr.Render(forecast.Render(dates, rows), out)
+}
@@ -16,59 +16,107 @@ package format
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
-	"path"
 
-	"github.com/natefinch/atomic"
 	"github.com/spf13/cobra"
 	"go.uber.org/multierr"
 
 	"github.com/sboehler/knut/lib/common/cpr"
+	"github.com/sboehler/knut/lib/common/diff"
+	"github.com/sboehler/knut/lib/common/staging"
 	"github.com/sboehler/knut/lib/journal"
 	"github.com/sboehler/knut/lib/journal/format"
 )
 
 // CreateCmd creates the command.
 func CreateCmd() *cobra.Command {
-	return &cobra.Command{
+	var r runner
+	c := &cobra.Command{
 		Use:   "format",
 		Short: "Format the given journal",
-		Long:  `Format the given journal in-place. Any white space and comments between directives is preserved.`,
+		Long: `Format the given journal in-place. Any white space and comments between directives is preserved.
+The files are only replaced once all of them have been formatted successfully.
 
-		Run: run,
+With --sort, the dated directives of each file are sorted chronologically, e.g. after appending
+imports out of order. Comments and directives without a date, such as includes, move along with
+the dated directive which follows them. Text before the first and after the last dated directive
+stays in place.
+
+With --check, no files are modified. Instead, a unified diff is printed for every file which is
+not formatted, and the command exits with a non-zero status if there is any such file.
+
+With --wrap, descriptions which would make the first line of a transaction longer than the given
+width are split at spaces and continued on indented lines, as far as possible. The parts of a
+description are concatenated when it is read, so wrapping does not change the description.
+Trailing comments of postings, which start with a semicolon, are aligned within each transaction.
+With --normalize-comments, comment lines starting with "#" or ";" are rewritten to start with "#"
+and a space. Comment lines starting with "*", e.g. org mode headings, are left alone.
+
+If the only argument is "-", the journal is read from the standard input and the formatted journal
+is written to the standard output, e.g. for editors which format on save.`,
+
+		Run: r.run,
 	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	sort, check bool
+	options     format.Options
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	c.Flags().BoolVar(&r.sort, "sort", false, "sort the directives of each file by date")
+	c.Flags().BoolVar(&r.check, "check", false, "print a diff for files which are not formatted, without modifying them")
+	c.Flags().IntVar(&r.options.Wrap, "wrap", 0, "wrap descriptions of transactions longer than the given width (0: do not wrap)")
+	c.Flags().BoolVar(&r.options.NormalizeComments, "normalize-comments", false, "rewrite comment lines to start with '# '")
 }
 
 const concurrency = 10
 
-func run(cmd *cobra.Command, args []string) {
-	if err := execute(cmd, args); err != nil {
-		fmt.Fprintln(cmd.ErrOrStderr(), err)
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		for _, e := range multierr.Errors(err) {
+			fmt.Fprintln(cmd.ErrOrStderr(), e)
+		}
 		os.Exit(1)
 	}
 }
 
-func execute(cmd *cobra.Command, args []string) error {
+func (r *runner) execute(cmd *cobra.Command, args []string) error {
+	for _, arg := range args {
+		if arg != journal.Stdin {
+			continue
+		}
+		if len(args) > 1 {
+			return fmt.Errorf("cannot format the standard input together with files")
+		}
+		return r.formatStdin(cmd)
+	}
 	var (
 		ctx   = cmd.Context()
 		errCh = make(chan error)
+		stage staging.Stage
+		diffs = make([]string, len(args))
 	)
 	go func() {
 		defer close(errCh)
 		sema := make(chan bool, concurrency)
 		defer close(sema)
-		for _, arg := range args {
+		for i, arg := range args {
 			sema <- true
-			go func(arg string) {
+			go func(i int, arg string) {
 				defer func() { <-sema }()
-				if err := formatFile(arg); err != nil {
+				if err := r.formatFile(&stage, &diffs[i], arg); err != nil {
 					if cpr.Push(ctx, errCh, err) != nil {
 						return
 					}
 				}
-			}(arg)
+			}(i, arg)
 		}
 		for i := 0; i < concurrency; i++ {
 			sema <- true
@@ -79,49 +127,107 @@ func execute(cmd *cobra.Command, args []string) error {
 	for err := range errCh {
 		errors = multierr.Append(errors, err)
 	}
-	return errors
+	for _, d := range diffs {
+		fmt.Fprint(cmd.OutOrStdout(), d)
+	}
+	if errors != nil {
+		return multierr.Append(errors, stage.Abort())
+	}
+	return stage.Commit()
 }
 
-func formatFile(target string) error {
-	var (
-		directives           []journal.Directive
-		err                  error
-		srcFile, tmpDestFile *os.File
-	)
-	if directives, err = readDirectives(target); err != nil {
+// formatFile formats the target. In check mode, it stores the diff to the
+// formatted file in out instead of writing it.
+func (r *runner) formatFile(stage *staging.Stage, out *string, target string) error {
+	if journal.IsCompressed(target) {
+		return fmt.Errorf("%s: cannot format compressed files", target)
+	}
+	src, err := os.ReadFile(target)
+	if err != nil {
 		return err
 	}
-	if srcFile, err = os.Open(target); err != nil {
+	formatted, err := r.format(target, src)
+	if err != nil {
 		return err
 	}
-	if tmpDestFile, err = os.CreateTemp(path.Dir(target), "format-"); err != nil {
-		return multierr.Append(err, srcFile.Close())
+	if r.check {
+		return check(out, target, src, formatted)
 	}
-	dest := bufio.NewWriter(tmpDestFile)
-	err = format.Format(directives, bufio.NewReader(srcFile), dest)
-	err = multierr.Combine(err, srcFile.Close(), dest.Flush(), tmpDestFile.Close())
+	return stage.Write(target, func(w io.Writer) error {
+		_, err := w.Write(formatted)
+		return err
+	})
+}
+
+// formatStdin formats the standard input and writes the result, or in
+// check mode the diff to it, to the standard output.
+func (r *runner) formatStdin(cmd *cobra.Command) error {
+	src, err := io.ReadAll(cmd.InOrStdin())
 	if err != nil {
-		return multierr.Append(err, os.Remove(tmpDestFile.Name()))
+		return err
+	}
+	formatted, err := r.format(stdinName, src)
+	if err != nil {
+		return err
 	}
-	return multierr.Append(err, atomic.ReplaceFile(tmpDestFile.Name(), target))
+	if r.check {
+		var out string
+		err := check(&out, stdinName, src, formatted)
+		fmt.Fprint(cmd.OutOrStdout(), out)
+		return err
+	}
+	_, err = cmd.OutOrStdout().Write(formatted)
+	return err
 }
 
-func readDirectives(target string) ([]journal.Directive, error) {
-	p, close, err := journal.ParserFromPath(journal.NewContext(), target)
+// stdinName is the name of the standard input in error messages and diffs.
+const stdinName = "<stdin>"
+
+// format returns the formatted source of the named file.
+func (r *runner) format(name string, src []byte) ([]byte, error) {
+	directives, err := readDirectives(name, src)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if r.sort {
+		err = r.options.Sort(directives, bytes.NewReader(src), &buf)
+	} else {
+		err = r.options.Format(directives, bufio.NewReader(bytes.NewReader(src)), &buf)
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer close()
+	return buf.Bytes(), nil
+}
 
-	var directives []journal.Directive
+// check stores the diff between the source and the formatted source of the
+// named file in out, and returns an error if they differ.
+func check(out *string, name string, src, formatted []byte) error {
+	if bytes.Equal(src, formatted) {
+		return nil
+	}
+	*out = diff.Unified(name, name, src, formatted, 3)
+	return fmt.Errorf("%s: file is not formatted", name)
+}
 
+func readDirectives(name string, src []byte) ([]journal.Directive, error) {
+	p, err := journal.ParserFromReader(journal.NewContext(), bytes.NewReader(src), name)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		directives []journal.Directive
+		errs       error
+	)
 	for {
 		d, err := p.Next()
 		if err == io.EOF {
-			return directives, nil
+			return directives, errs
 		}
 		if err != nil {
-			return nil, err
+			errs = multierr.Append(errs, err)
+			continue
 		}
 		directives = append(directives, d)
 	}
@@ -0,0 +1,119 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gains
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/gains"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	c := &cobra.Command{
+		Use:   "gains",
+		Short: "print the realized and unrealized gains",
+		Long: `Split the valuation gains of each period, i.e. the adjustments to market prices, into realized
+and unrealized gains per commodity. Gains accumulate on a position and are realized when the
+position is disposed of, in proportion to the quantity disposed. Transfers between asset and
+liability accounts do not realize gains.`,
+		Args: cobra.ExactValidArgs(1),
+		Run:  r.run,
+	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	period      flags.PeriodFlag
+	interval    flags.IntervalFlags
+	last        int
+	valuation   flags.CommodityFlag
+	commodities flags.RegexFlag
+	digits      int32
+	thousands   bool
+	color       bool
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	r.period.Setup(c, date.Period{End: date.Today()})
+	r.interval.Setup(c, date.Yearly)
+	c.Flags().IntVar(&r.last, "last", 0, "last n periods")
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity (required)")
+	c.Flags().Var(&r.commodities, "commodity", "filter commodities with a regex")
+	c.Flags().Int32Var(&r.digits, "digits", 0, "round to number of digits")
+	c.Flags().BoolVarP(&r.thousands, "thousands", "k", false, "show numbers in units of 1000")
+	c.Flags().BoolVar(&r.color, "color", true, "print output in color")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *runner) execute(cmd *cobra.Command, args []string) (errors error) {
+	jctx := journal.NewContext()
+	valuation, err := r.valuation.Value(jctx)
+	if err != nil {
+		return err
+	}
+	if valuation == nil {
+		return fmt.Errorf("gains requires a valuation commodity")
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	period := r.period.Value().Clip(j.Period())
+	dates := r.interval.Dates(period, r.last)
+	start := r.interval.Start(period, dates)
+	rep := gains.New(jctx, start, dates)
+	if _, err := j.Process(
+		journal.ComputePrices(valuation),
+		journal.Balance(jctx, valuation),
+		rep.Process,
+	); err != nil {
+		return err
+	}
+	var (
+		rows []*gains.Row
+		f    = journal.FilterCommodity(r.commodities.Regex())
+	)
+	for _, row := range rep.Rows() {
+		if f(journal.Key{Commodity: row.Commodity}) {
+			rows = append(rows, row)
+		}
+	}
+	out := bufio.NewWriter(cmd.OutOrStdout())
+	defer func() { errors = multierr.Append(errors, out.Flush()) }()
+	tr := table.TextRenderer{
+		Color:     r.color,
+		Thousands: r.thousands,
+		Round:     r.digits,
+	}
+	return tr.Render(gains.Render(dates, rows), out)
+}
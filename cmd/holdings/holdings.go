@@ -0,0 +1,127 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holdings
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/holdings"
+	"github.com/sboehler/knut/lib/journal/lots"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	c := &cobra.Command{
+		Use:   "holdings",
+		Short: "print the holdings with cost basis and market value",
+		Long: `Print each commodity position in the asset and liability accounts with its quantity, its
+cost basis, its market value and the unrealized gain, all in the valuation commodity. Acquisitions
+are booked as lots at the price of their lot annotation, if given, and at their value at the time
+of booking otherwise. Reductions remove lots with the given --method: average (the default),
+which reduces all lots proportionally, fifo or lifo. Reductions with a lot annotation with a date
+or label reduce the matching lots first. With --lots, the lots are printed as well.`,
+		Args: cobra.ExactValidArgs(1),
+		Run:  r.run,
+	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	date        flags.DateFlag
+	valuation   flags.CommodityFlag
+	accounts    flags.RegexFlag
+	commodities flags.RegexFlag
+	method      string
+	lots        bool
+	digits      int32
+	thousands   bool
+	color       bool
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	c.Flags().Var(&r.date, "date", "the date of the holdings (default today)")
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity (required)")
+	c.Flags().Var(&r.accounts, "account", "filter accounts with a regex")
+	c.Flags().Var(&r.commodities, "commodity", "filter commodities with a regex")
+	c.Flags().StringVar(&r.method, "method", "average", "the method to reduce lots (average, fifo or lifo)")
+	c.Flags().BoolVar(&r.lots, "lots", false, "print the lots of each holding")
+	c.Flags().Int32Var(&r.digits, "digits", 0, "round to number of digits")
+	c.Flags().BoolVarP(&r.thousands, "thousands", "k", false, "show numbers in units of 1000")
+	c.Flags().BoolVar(&r.color, "color", true, "print output in color")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *runner) execute(cmd *cobra.Command, args []string) (errors error) {
+	jctx := journal.NewContext()
+	method, err := lots.ParseMethod(r.method)
+	if err != nil {
+		return err
+	}
+	valuation, err := r.valuation.Value(jctx)
+	if err != nil {
+		return err
+	}
+	if valuation == nil {
+		return fmt.Errorf("holdings requires a valuation commodity")
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	h := holdings.New(jctx, r.date.ValueOr(date.Today()), valuation, method)
+	if _, err := j.Process(
+		journal.ComputePrices(valuation),
+		journal.Balance(jctx, valuation),
+		h.Process,
+	); err != nil {
+		return err
+	}
+	var (
+		rows []*holdings.Holding
+		fa   = journal.FilterAccount(r.accounts.Regex())
+		fc   = journal.FilterCommodity(r.commodities.Regex())
+	)
+	for _, hd := range h.Holdings() {
+		k := journal.AccountCommodityKey(hd.Account, hd.Commodity)
+		if fa(k) && fc(k) {
+			rows = append(rows, hd)
+		}
+	}
+	out := bufio.NewWriter(cmd.OutOrStdout())
+	defer func() { errors = multierr.Append(errors, out.Flush()) }()
+	tr := table.TextRenderer{
+		Color:     r.color,
+		Thousands: r.thousands,
+		Round:     r.digits,
+	}
+	return tr.Render(holdings.Render(rows, r.lots), out)
+}
@@ -0,0 +1,381 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binance
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/common/csvkit"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	cmd := &cobra.Command{
+		Use:   "binance",
+		Short: "Import Binance trade, deposit and withdrawal history",
+		Long: `Export the spot trade history or the deposit or withdrawal history as CSV. Partial fills
+of the same order are aggregated into one transaction, and a price is added for the executed
+rate of every order. Use --withdrawal for withdrawal histories.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		RunE: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+func init() {
+	importer.Register(CreateCmd)
+}
+
+type runner struct {
+	accountFlag, feeFlag, tradingFlag flags.AccountFlag
+	withdrawal                        bool
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	c.Flags().VarP(&r.accountFlag, "account", "a", "account name")
+	c.Flags().VarP(&r.feeFlag, "fee", "f", "account name of the fee account")
+	c.Flags().VarP(&r.tradingFlag, "trading", "t", "account name of the trading gain / loss account")
+	c.Flags().BoolVar(&r.withdrawal, "withdrawal", false, "the file is a withdrawal history")
+	c.MarkFlagRequired("account")
+	c.MarkFlagRequired("fee")
+	c.MarkFlagRequired("trading")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) error {
+	var (
+		ctx = journal.NewContext()
+		f   *bufio.Reader
+		err error
+	)
+	if f, err = flags.OpenFile(args[0]); err != nil {
+		return err
+	}
+	p := parser{
+		builder:    journal.New(ctx),
+		withdrawal: r.withdrawal,
+	}
+	if p.reader, err = csvkit.NewReader(f); err != nil {
+		return err
+	}
+	if p.account, err = r.accountFlag.Value(ctx); err != nil {
+		return err
+	}
+	if p.fee, err = r.feeFlag.Value(ctx); err != nil {
+		return err
+	}
+	if p.trading, err = r.tradingFlag.Value(ctx); err != nil {
+		return err
+	}
+	if err = p.parse(); err != nil {
+		return err
+	}
+	return importer.Print(cmd, p.builder.ToLedger())
+}
+
+type parser struct {
+	reader     *csv.Reader
+	builder    *journal.Journal
+	withdrawal bool
+
+	account, fee, trading *journal.Account
+
+	// columns maps the lower-case header names to their column index.
+	columns map[string]int
+
+	// orders holds the trades, in the order of their first fill.
+	orders []*order
+}
+
+type order struct {
+	key         string
+	date        time.Time
+	buy         bool
+	base, quote *journal.Commodity
+	qty, total  decimal.Decimal
+
+	// fees holds the fees by coin, in the order of their first fill, as
+	// the fills of an order may be charged in different coins.
+	feeCoins []*journal.Commodity
+	fees     map[*journal.Commodity]decimal.Decimal
+}
+
+// addFee adds a fee to the order.
+func (o *order) addFee(coin *journal.Commodity, amount decimal.Decimal) {
+	if _, ok := o.fees[coin]; !ok {
+		o.feeCoins = append(o.feeCoins, coin)
+	}
+	o.fees[coin] = o.fees[coin].Add(amount)
+}
+
+func (p *parser) parse() error {
+	p.reader.TrimLeadingSpace = true
+	header, err := p.reader.Read()
+	if err != nil {
+		return err
+	}
+	p.columns = make(map[string]int)
+	for i, h := range header {
+		p.columns[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	var parseLine func([]string) error
+	switch {
+	case p.has("pair", "side", "executed", "amount", "fee"):
+		parseLine = p.parseFill
+	case p.has("coin", "amount"):
+		parseLine = p.parseTransfer
+	default:
+		return fmt.Errorf("unknown file format with header %q", header)
+	}
+	for {
+		r, err := p.reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := parseLine(r); err != nil {
+			return err
+		}
+	}
+	for _, o := range p.orders {
+		p.addOrder(o)
+	}
+	return nil
+}
+
+// has returns whether the header contains all given columns.
+func (p *parser) has(columns ...string) bool {
+	for _, c := range columns {
+		if _, ok := p.columns[c]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// get returns the value of the given column, or "" if it does not exist.
+func (p *parser) get(r []string, column string) string {
+	i, ok := p.columns[column]
+	if !ok || i >= len(r) {
+		return ""
+	}
+	return strings.TrimSpace(r[i])
+}
+
+func (p *parser) parseDate(r []string) (time.Time, error) {
+	d, err := time.Parse("2006-01-02 15:04:05", p.get(r, "date(utc)"))
+	if err != nil {
+		return d, err
+	}
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+func (p *parser) parseFill(r []string) error {
+	var (
+		date                 time.Time
+		qty, total, fee      decimal.Decimal
+		base, quote, feeCoin *journal.Commodity
+		side                 = strings.ToUpper(p.get(r, "side"))
+		err                  error
+	)
+	if side != "BUY" && side != "SELL" {
+		return fmt.Errorf("invalid side %q in %v", side, r)
+	}
+	if date, err = p.parseDate(r); err != nil {
+		return err
+	}
+	if qty, base, err = p.parseAmount(p.get(r, "executed")); err != nil {
+		return err
+	}
+	if total, quote, err = p.parseAmount(p.get(r, "amount")); err != nil {
+		return err
+	}
+	if fee, feeCoin, err = p.parseAmount(p.get(r, "fee")); err != nil {
+		return err
+	}
+	// partial fills of an order share the order number if it is exported,
+	// otherwise the pair, side and price on the same day
+	key := p.get(r, "order no")
+	if key == "" {
+		key = strings.Join([]string{date.Format("2006-01-02"), p.get(r, "pair"), side, p.get(r, "price")}, "|")
+	}
+	for _, o := range p.orders {
+		if o.key == key {
+			o.qty = o.qty.Add(qty)
+			o.total = o.total.Add(total)
+			o.addFee(feeCoin, fee)
+			return nil
+		}
+	}
+	o := &order{
+		key:   key,
+		date:  date,
+		buy:   side == "BUY",
+		base:  base,
+		quote: quote,
+		qty:   qty,
+		total: total,
+		fees:  make(map[*journal.Commodity]decimal.Decimal),
+	}
+	o.addFee(feeCoin, fee)
+	p.orders = append(p.orders, o)
+	return nil
+}
+
+func (p *parser) addOrder(o *order) {
+	var (
+		price = o.total.Div(o.qty).Truncate(8)
+		qty   = o.qty
+		total = o.total.Neg()
+		desc  = fmt.Sprintf("Buy %s %s @ %s %s", o.qty, o.base.Name(), price, o.quote.Name())
+	)
+	if !o.buy {
+		qty, total = qty.Neg(), total.Neg()
+		desc = fmt.Sprintf("Sell %s %s @ %s %s", o.qty, o.base.Name(), price, o.quote.Name())
+	}
+	pbs := journal.PostingBuilders{
+		{
+			Credit:    p.trading,
+			Debit:     p.account,
+			Commodity: o.base,
+			Amount:    qty,
+			Targets:   []*journal.Commodity{o.base, o.quote},
+		},
+		{
+			Credit:    p.trading,
+			Debit:     p.account,
+			Commodity: o.quote,
+			Amount:    total,
+			Targets:   []*journal.Commodity{o.base, o.quote},
+		},
+	}
+	for _, coin := range o.feeCoins {
+		pbs = append(pbs, journal.PostingBuilder{
+			Credit:    p.account,
+			Debit:     p.fee,
+			Commodity: coin,
+			Amount:    o.fees[coin],
+			Targets:   []*journal.Commodity{o.base, o.quote},
+		})
+	}
+	p.builder.AddTransaction(journal.TransactionBuilder{
+		Date:        o.date,
+		Description: desc,
+		Postings:    pbs.Build(),
+	}.Build())
+	p.builder.AddPrice(&journal.Price{
+		Date:      o.date,
+		Commodity: o.base,
+		Target:    o.quote,
+		Price:     price,
+	})
+}
+
+func (p *parser) parseTransfer(r []string) error {
+	if status := p.get(r, "status"); status != "" && !strings.EqualFold(status, "Completed") {
+		return nil
+	}
+	var (
+		date        time.Time
+		coin        *journal.Commodity
+		amount, fee decimal.Decimal
+		err         error
+	)
+	if date, err = p.parseDate(r); err != nil {
+		return err
+	}
+	if coin, err = p.builder.Context.GetCommodity(p.get(r, "coin")); err != nil {
+		return err
+	}
+	if amount, err = csvkit.English.ParseDecimal(p.get(r, "amount")); err != nil {
+		return err
+	}
+	if s := p.get(r, "transactionfee"); s != "" {
+		if fee, err = csvkit.English.ParseDecimal(s); err != nil {
+			return err
+		}
+	}
+	if !p.withdrawal {
+		p.builder.AddTransaction(journal.TransactionBuilder{
+			Date:        date,
+			Description: fmt.Sprintf("Deposit %s %s", amount, coin.Name()),
+			Postings: journal.PostingBuilder{
+				Credit:    p.builder.Context.TBDAccount(),
+				Debit:     p.account,
+				Commodity: coin,
+				Amount:    amount,
+			}.Build(),
+		}.Build())
+		return nil
+	}
+	postings := journal.PostingBuilders{
+		{
+			Credit:    p.account,
+			Debit:     p.builder.Context.TBDAccount(),
+			Commodity: coin,
+			Amount:    amount,
+		},
+	}
+	if !fee.IsZero() {
+		postings = append(postings, journal.PostingBuilder{
+			Credit:    p.account,
+			Debit:     p.fee,
+			Commodity: coin,
+			Amount:    fee,
+		})
+	}
+	p.builder.AddTransaction(journal.TransactionBuilder{
+		Date:        date,
+		Description: fmt.Sprintf("Withdraw %s %s", amount, coin.Name()),
+		Postings:    postings.Build(),
+	}.Build())
+	return nil
+}
+
+var amountRegex = regexp.MustCompile(`^([0-9.,]+)([A-Z0-9]+)$`)
+
+// parseAmount parses an amount with a commodity suffix, e.g. "0.0012BTC".
+func (p *parser) parseAmount(s string) (decimal.Decimal, *journal.Commodity, error) {
+	m := amountRegex.FindStringSubmatch(s)
+	if m == nil {
+		return decimal.Zero, nil, fmt.Errorf("invalid amount %q", s)
+	}
+	amount, err := csvkit.English.ParseDecimal(m[1])
+	if err != nil {
+		return decimal.Zero, nil, err
+	}
+	c, err := p.builder.Context.GetCommodity(m[2])
+	if err != nil {
+		return decimal.Zero, nil, err
+	}
+	return amount, c, nil
+}
@@ -0,0 +1,271 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package camt
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// CreateCmd creates the cobra command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	cmd := &cobra.Command{
+		Use:   "camt",
+		Short: "Import ISO 20022 camt.053 account statements",
+		Long: `Import the booked entries of the account statements in a camt.053 XML file, as offered
+for download by most European banks.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		RunE: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+func init() {
+	importer.Register(CreateCmd)
+}
+
+type runner struct {
+	accountFlag    flags.AccountFlag
+	closingBalance bool
+}
+
+func (r *runner) setupFlags(cmd *cobra.Command) {
+	cmd.Flags().VarP(&r.accountFlag, "account", "a", "account name")
+	cmd.Flags().BoolVar(&r.closingBalance, "closing-balance", false, "add a balance assertion for the closing balance of each statement")
+	cmd.MarkFlagRequired("account")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) error {
+	var (
+		reader *bufio.Reader
+		ctx    = journal.NewContext()
+		doc    document
+		err    error
+	)
+	if reader, err = flags.OpenFile(args[0]); err != nil {
+		return err
+	}
+	if err = xml.NewDecoder(reader).Decode(&doc); err != nil {
+		return err
+	}
+	p := parser{
+		journal:        journal.New(ctx),
+		closingBalance: r.closingBalance,
+	}
+	if p.account, err = r.accountFlag.Value(ctx); err != nil {
+		return err
+	}
+	for _, s := range doc.Statements {
+		if err := p.parseStatement(s); err != nil {
+			return err
+		}
+	}
+	return importer.Print(cmd, p.journal.ToLedger())
+}
+
+// document is the subset of a camt.053 document which is imported. The
+// elements are matched by their local names, so that all versions of the
+// schema are supported.
+type document struct {
+	Statements []statement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type statement struct {
+	ID       string    `xml:"Id"`
+	Balances []balance `xml:"Bal"`
+	Entries  []entry   `xml:"Ntry"`
+}
+
+type balance struct {
+	Type   string `xml:"Tp>CdOrPrtry>Cd"`
+	Amount amount `xml:"Amt"`
+	Sign   string `xml:"CdtDbtInd"`
+	Date   date   `xml:"Dt"`
+}
+
+type entry struct {
+	Amount      amount    `xml:"Amt"`
+	Sign        string    `xml:"CdtDbtInd"`
+	Status      status    `xml:"Sts"`
+	BookingDate date      `xml:"BookgDt"`
+	Info        string    `xml:"AddtlNtryInf"`
+	Details     []details `xml:"NtryDtls>TxDtls"`
+}
+
+type details struct {
+	Creditor     string   `xml:"RltdPties>Cdtr>Nm"`
+	Debtor       string   `xml:"RltdPties>Dbtr>Nm"`
+	Unstructured []string `xml:"RmtInf>Ustrd"`
+}
+
+type amount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+// status is given as text up to version 6 of the schema, and as a code
+// element from version 7 on.
+type status struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+func (s status) String() string {
+	return strings.TrimSpace(s.Text + s.Code)
+}
+
+type date struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+func (d date) parse() (time.Time, error) {
+	if len(d.DateTime) >= 10 {
+		return time.Parse("2006-01-02", d.DateTime[:10])
+	}
+	return time.Parse("2006-01-02", d.Date)
+}
+
+type parser struct {
+	account        *journal.Account
+	journal        *journal.Journal
+	closingBalance bool
+}
+
+func (p *parser) parseStatement(s statement) error {
+	for _, e := range s.Entries {
+		if e.Status.String() != "BOOK" {
+			continue
+		}
+		if err := p.parseEntry(e); err != nil {
+			return fmt.Errorf("statement %s: %w", s.ID, err)
+		}
+	}
+	if !p.closingBalance {
+		return nil
+	}
+	for _, b := range s.Balances {
+		if b.Type != "CLBD" {
+			continue
+		}
+		if err := p.parseClosingBalance(b); err != nil {
+			return fmt.Errorf("statement %s: %w", s.ID, err)
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseEntry(e entry) error {
+	var (
+		d         time.Time
+		amount    decimal.Decimal
+		commodity *journal.Commodity
+		err       error
+	)
+	if d, err = e.BookingDate.parse(); err != nil {
+		return err
+	}
+	if amount, err = parseAmount(e.Amount.Value, e.Sign); err != nil {
+		return err
+	}
+	if commodity, err = p.journal.Context.GetCommodity(e.Amount.Currency); err != nil {
+		return err
+	}
+	p.journal.AddTransaction(journal.TransactionBuilder{
+		Date:        d,
+		Description: description(e),
+		Postings: journal.PostingBuilder{
+			Credit:    p.journal.Context.TBDAccount(),
+			Debit:     p.account,
+			Commodity: commodity,
+			Amount:    amount,
+		}.Build(),
+	}.Build())
+	return nil
+}
+
+// parseClosingBalance adds a balance assertion for the closing balance,
+// dated the day the statement ends.
+func (p *parser) parseClosingBalance(b balance) error {
+	var (
+		d         time.Time
+		amount    decimal.Decimal
+		commodity *journal.Commodity
+		err       error
+	)
+	if d, err = b.Date.parse(); err != nil {
+		return err
+	}
+	if amount, err = parseAmount(b.Amount.Value, b.Sign); err != nil {
+		return err
+	}
+	if commodity, err = p.journal.Context.GetCommodity(b.Amount.Currency); err != nil {
+		return err
+	}
+	p.journal.AddAssertion(&journal.Assertion{
+		Date:      d,
+		Account:   p.account,
+		Amount:    amount,
+		Commodity: commodity,
+	})
+	return nil
+}
+
+// parseAmount parses an amount, which is negative if it is debited.
+func parseAmount(value, sign string) (decimal.Decimal, error) {
+	amount, err := decimal.NewFromString(strings.TrimSpace(value))
+	if err != nil {
+		return amount, err
+	}
+	switch sign {
+	case "CRDT":
+		return amount, nil
+	case "DBIT":
+		return amount.Neg(), nil
+	default:
+		return amount, fmt.Errorf("invalid credit/debit indicator %q", sign)
+	}
+}
+
+// description returns the additional information of the entry, or else
+// the counterparties and remittance information of its transactions.
+func description(e entry) string {
+	if info := strings.TrimSpace(e.Info); len(info) > 0 {
+		return info
+	}
+	var fields []string
+	for _, d := range e.Details {
+		for _, f := range append([]string{d.Creditor, d.Debtor}, d.Unstructured...) {
+			if f = strings.TrimSpace(f); len(f) > 0 {
+				fields = append(fields, f)
+			}
+		}
+	}
+	return strings.Join(fields, " ")
+}
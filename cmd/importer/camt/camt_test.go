@@ -0,0 +1,48 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package camt
+
+import (
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/sebdah/goldie/v2"
+
+	"github.com/sboehler/knut/cmd/cmdtest"
+)
+
+func TestGolden(t *testing.T) {
+	tests := []struct {
+		name, input string
+		flags       []string
+	}{
+		{name: "example1", input: "example1"},
+		{name: "example1_closing", input: "example1", flags: []string{"--closing-balance"}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			args := append([]string{
+				"--account",
+				"Assets:Bank",
+				path.Join("testdata", fmt.Sprintf("%s.input", test.input)),
+			}, test.flags...)
+			got := cmdtest.Run(t, CreateCmd(), args)
+			goldie.New(t).Assert(t, test.name, got)
+		})
+	}
+}
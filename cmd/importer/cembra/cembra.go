@@ -0,0 +1,249 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cembra
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/common/csvkit"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	cmd := &cobra.Command{
+		Use:   "ch.cembra",
+		Short: "Import Cembra Money Bank credit card statements",
+		Long: `Export the transactions as CSV from the Cembra app or eService portal. Purchases
+in a foreign currency are booked in CHF, the original amount is added to the description.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		RunE: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+func init() {
+	importer.Register(CreateCmd)
+}
+
+type runner struct {
+	account     flags.AccountFlag
+	postingDate bool
+}
+
+func (r *runner) setupFlags(cmd *cobra.Command) {
+	cmd.Flags().VarP(&r.account, "account", "a", "account name")
+	cmd.MarkFlagRequired("account")
+	cmd.Flags().BoolVar(&r.postingDate, "posting-date", false, "use the posting date instead of the transaction date")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) error {
+	var (
+		ctx = journal.NewContext()
+		f   *bufio.Reader
+		err error
+	)
+	if f, err = flags.OpenFile(args[0]); err != nil {
+		return err
+	}
+	p := parser{
+		builder:     journal.New(ctx),
+		postingDate: r.postingDate,
+	}
+	if p.reader, err = csvkit.NewReader(f); err != nil {
+		return err
+	}
+	if p.account, err = r.account.Value(ctx); err != nil {
+		return err
+	}
+	if err = p.parse(); err != nil {
+		return err
+	}
+	return importer.Print(cmd, p.builder.ToLedger())
+}
+
+type parser struct {
+	reader      *csv.Reader
+	account     *journal.Account
+	builder     *journal.Journal
+	postingDate bool
+
+	// columns maps the fields to their column index.
+	columns map[field]int
+}
+
+type field int
+
+const (
+	fieldTransaktionsdatum field = iota
+	fieldBuchungsdatum
+	fieldBeschreibung
+	fieldBetrag
+	fieldWährung
+	fieldBelastung
+	fieldGutschrift
+)
+
+// headers are the column names of the fields, in the order of the fields.
+var headers = []string{
+	"transaktionsdatum",
+	"buchungsdatum",
+	"beschreibung",
+	"betrag in fremdwährung",
+	"fremdwährung",
+	"belastung chf",
+	"gutschrift chf",
+}
+
+// optional reports whether the column may be missing. Older exports do
+// not contain the foreign currency columns.
+func (f field) optional() bool {
+	return f == fieldBetrag || f == fieldWährung
+}
+
+func (p *parser) parse() error {
+	p.reader.TrimLeadingSpace = true
+	p.reader.FieldsPerRecord = -1
+	if err := p.parseHeader(); err != nil {
+		return err
+	}
+	for {
+		err := p.readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (p *parser) parseHeader() error {
+	r, err := p.reader.Read()
+	if err != nil {
+		return err
+	}
+	p.columns = make(map[field]int)
+	for i, h := range r {
+		for f, name := range headers {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				p.columns[field(f)] = i
+			}
+		}
+	}
+	for f, name := range headers {
+		if _, ok := p.columns[field(f)]; !ok && !field(f).optional() {
+			return fmt.Errorf("missing column %q in header %v", name, r)
+		}
+	}
+	return nil
+}
+
+func (p *parser) readLine() error {
+	r, err := p.reader.Read()
+	if err != nil {
+		return err
+	}
+	if _, err := time.Parse("02.01.2006", p.get(r, fieldTransaktionsdatum)); err != nil {
+		// skip empty lines and totals
+		return nil
+	}
+	return p.parseBooking(r)
+}
+
+func (p *parser) parseBooking(r []string) error {
+	var (
+		desc   = p.parseDescription(r)
+		chf    *journal.Commodity
+		amount decimal.Decimal
+		date   time.Time
+		err    error
+	)
+	if date, err = p.parseDate(r); err != nil {
+		return err
+	}
+	if amount, err = p.parseAmount(r); err != nil {
+		return err
+	}
+	if chf, err = p.builder.Context.GetCommodity("CHF"); err != nil {
+		return err
+	}
+	p.builder.AddTransaction(journal.TransactionBuilder{
+		Date:        date,
+		Description: desc,
+		Postings: journal.PostingBuilder{
+			Credit:    p.account,
+			Debit:     p.builder.Context.TBDAccount(),
+			Commodity: chf,
+			Amount:    amount,
+		}.Build(),
+	}.Build())
+	return nil
+}
+
+// get returns the value of the given field, or "" if the column
+// does not exist.
+func (p *parser) get(r []string, f field) string {
+	i, ok := p.columns[f]
+	if !ok || i >= len(r) {
+		return ""
+	}
+	return strings.TrimSpace(r[i])
+}
+
+func (p *parser) parseDate(r []string) (time.Time, error) {
+	if p.postingDate {
+		return time.Parse("02.01.2006", p.get(r, fieldBuchungsdatum))
+	}
+	return time.Parse("02.01.2006", p.get(r, fieldTransaktionsdatum))
+}
+
+func (p *parser) parseDescription(r []string) string {
+	desc := p.get(r, fieldBeschreibung)
+	if cur := p.get(r, fieldWährung); len(cur) > 0 && cur != "CHF" {
+		desc = fmt.Sprintf("%s %s %s", desc, cur, p.get(r, fieldBetrag))
+	}
+	return desc
+}
+
+func (p *parser) parseAmount(r []string) (decimal.Decimal, error) {
+	var (
+		debit  = p.get(r, fieldBelastung)
+		credit = p.get(r, fieldGutschrift)
+	)
+	switch {
+	case len(debit) > 0 && len(credit) == 0:
+		return csvkit.Swiss.ParseDecimal(debit)
+	case len(debit) == 0 && len(credit) > 0:
+		amount, err := csvkit.Swiss.ParseDecimal(credit)
+		return amount.Neg(), err
+	default:
+		return decimal.Zero, fmt.Errorf("row has invalid amounts: %q %q", debit, credit)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -28,6 +29,9 @@ import (
 
 	"github.com/sboehler/knut/cmd/flags"
 	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/common/csvkit"
+	"github.com/sboehler/knut/lib/common/set"
+	"github.com/sboehler/knut/lib/importer/pdftable"
 	"github.com/sboehler/knut/lib/journal"
 )
 
@@ -37,8 +41,10 @@ func CreateCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "ch.cumulus",
 		Short: "Import Cumulus credit card statements",
-		Long: `Download a PDF account statement and run it through tabula (https://tabula.technology/),
-using the default options and saving it to CSV. This importer will parse the unaltered CSV.`,
+		Long: `Download a PDF account statement and pass it to this importer, which extracts the
+bookings using pdftotext (from poppler-utils). Alternatively, run the PDF through tabula
+(https://tabula.technology/), using the default options and saving it to CSV. This importer
+will parse the unaltered CSV.`,
 
 		Args: cobra.ExactValidArgs(1),
 
@@ -54,11 +60,13 @@ func init() {
 }
 
 type runner struct {
-	account flags.AccountFlag
+	account        flags.AccountFlag
+	closingBalance bool
 }
 
 func (r *runner) setupFlags(c *cobra.Command) {
 	c.Flags().Var(&r.account, "account", "the target account")
+	c.Flags().BoolVar(&r.closingBalance, "closing-balance", false, "add a balance assertion for the closing balance of the statement")
 }
 
 func (r *runner) run(cmd *cobra.Command, args []string) error {
@@ -71,7 +79,13 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 	if account, err = r.account.Value(ctx); err != nil {
 		return err
 	}
-	if reader, err = flags.OpenFile(args[0]); err != nil {
+	if strings.EqualFold(filepath.Ext(args[0]), ".pdf") {
+		var rows [][]string
+		if rows, err = pdftable.ReadFile(cmd.Context(), args[0], tables...); err != nil {
+			return err
+		}
+		reader = bufio.NewReader(pdftable.CSV(rows))
+	} else if reader, err = flags.OpenFile(args[0]); err != nil {
 		return err
 	}
 	p := parser{
@@ -86,10 +100,17 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 	for _, trx := range trx {
 		j.AddTransaction(trx)
 	}
-	out := bufio.NewWriter(cmd.OutOrStdout())
-	defer out.Flush()
-	_, err = journal.NewPrinter().PrintLedger(out, j.ToLedger())
-	return err
+	if r.closingBalance && p.closing != nil {
+		j.AddAssertion(p.closing)
+	}
+	return importer.Print(cmd, j.ToLedger())
+}
+
+// tables describes the tables of the PDF statement, matching the layout of
+// the CSV produced by tabula.
+var tables = []pdftable.Spec{
+	{Columns: []string{"Einkaufs-Datum", "Verbucht am", "Beschreibung", "Gutschrift CHF", "Belastung CHF"}},
+	{Columns: []string{"Verbucht am", "Beschreibung", "Gutschrift CHF", "Belastung CHF"}},
 }
 
 type parser struct {
@@ -99,10 +120,18 @@ type parser struct {
 	// internal variables
 	reader       *csv.Reader
 	transactions []journal.TransactionBuilder
+
+	// the latest booking date, which ends the statement, and the
+	// balance at the end of the statement
+	last    time.Time
+	closing *journal.Assertion
 }
 
 func (p *parser) parse(r io.Reader) ([]*journal.Transaction, error) {
-	p.reader = csv.NewReader(r)
+	var err error
+	if p.reader, err = csvkit.NewReader(r); err != nil {
+		return nil, err
+	}
 	p.reader.FieldsPerRecord = -1
 	p.reader.LazyQuotes = true
 	for {
@@ -118,6 +147,9 @@ func (p *parser) parse(r io.Reader) ([]*journal.Transaction, error) {
 	for _, b := range p.transactions {
 		res = append(res, b.Build())
 	}
+	if p.closing != nil {
+		p.closing.Date = p.last
+	}
 	return res, nil
 }
 
@@ -129,6 +161,9 @@ func (p *parser) readLine() error {
 	if ok, err := p.parseRounding(r); ok || err != nil {
 		return err
 	}
+	if ok, err := p.parseClosing(r); ok || err != nil {
+		return err
+	}
 	if ok, err := p.parseFXComment(r); ok || err != nil {
 		return err
 	}
@@ -168,6 +203,9 @@ func (p *parser) parseBooking(r []string) (bool, error) {
 	if date, err = time.Parse("02.01.2006", r[bfEinkaufsDatum]); err != nil {
 		return false, err
 	}
+	if err = p.parseBookingDate(r[bfVerbuchtAm]); err != nil {
+		return false, err
+	}
 	if amount, err = parseAmount(r[bfBelastungCHF], r[bfGutschriftCHF]); err != nil {
 		return false, err
 	}
@@ -203,7 +241,7 @@ func parseAmount(creditField, debitField string) (decimal.Decimal, error) {
 	default:
 		return amount, fmt.Errorf("row has invalid amounts: %v %v", creditField, debitField)
 	}
-	if amount, err = parseDecimal(field); err != nil {
+	if amount, err = csvkit.Swiss.ParseDecimal(field); err != nil {
 		return amount, err
 	}
 	return amount.Mul(sign), nil
@@ -256,6 +294,9 @@ func (p *parser) parseRounding(r []string) (bool, error) {
 	if date, err = time.Parse("02.01.2006", r[rfEinkaufsDatum]); err != nil {
 		return false, err
 	}
+	if err = p.parseBookingDate(r[rfEinkaufsDatum]); err != nil {
+		return false, err
+	}
 	if amount, err = parseAmount(r[rfBelastungCHF], r[rfGutschriftCHF]); err != nil {
 		return false, err
 	}
@@ -275,6 +316,43 @@ func (p *parser) parseRounding(r []string) (bool, error) {
 	return true, nil
 }
 
-func parseDecimal(s string) (decimal.Decimal, error) {
-	return decimal.NewFromString(strings.ReplaceAll(s, "'", ""))
+// parseBookingDate records the latest booking date.
+func (p *parser) parseBookingDate(field string) error {
+	date, err := time.Parse("02.01.2006", field)
+	if err != nil {
+		return err
+	}
+	if date.After(p.last) {
+		p.last = date
+	}
+	return nil
+}
+
+// closingDescriptions are the descriptions of the line with the balance at
+// the end of the statement.
+var closingDescriptions = set.Of("Saldo zu unseren Gunsten", "Saldo zu Ihren Gunsten")
+
+// parseClosing parses the closing balance, which is listed like the balance
+// carried forward from the last statement, without a date.
+func (p *parser) parseClosing(r []string) (bool, error) {
+	if !(len(r) == 4 && len(r[rfEinkaufsDatum]) == 0 && closingDescriptions.Has(r[rfBeschreibung])) {
+		return false, nil
+	}
+	var (
+		err    error
+		amount decimal.Decimal
+		chf    *journal.Commodity
+	)
+	if amount, err = parseAmount(r[rfBelastungCHF], r[rfGutschriftCHF]); err != nil {
+		return false, err
+	}
+	if chf, err = p.context.GetCommodity("CHF"); err != nil {
+		return false, err
+	}
+	p.closing = &journal.Assertion{
+		Account:   p.account,
+		Amount:    amount,
+		Commodity: chf,
+	}
+	return true, nil
 }
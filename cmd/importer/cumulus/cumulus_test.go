@@ -15,33 +15,67 @@
 package cumulus
 
 import (
+	"encoding/csv"
 	"fmt"
+	"os"
 	"path"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/sboehler/knut/cmd/cmdtest"
+	"github.com/sboehler/knut/lib/importer/pdftable"
 
 	"github.com/sebdah/goldie/v2"
 )
 
 func TestGolden(t *testing.T) {
-	tests := []string{
-		"example1",
+	tests := []struct {
+		name, input string
+		flags       []string
+	}{
+		{name: "example1", input: "example1"},
+		{name: "example1_closing", input: "example1", flags: []string{"--closing-balance"}},
 	}
 	for _, test := range tests {
 		test := test
-		t.Run(test, func(t *testing.T) {
+		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 			var (
 				g    = goldie.New(t)
-				args = []string{
+				args = append([]string{
 					"--account",
 					"Liabilities:Cumulus",
-					path.Join("testdata", fmt.Sprintf("%s.input", test)),
-				}
+					path.Join("testdata", fmt.Sprintf("%s.input", test.input)),
+				}, test.flags...)
 				got = cmdtest.Run(t, CreateCmd(), args)
 			)
-			g.Assert(t, test, got)
+			g.Assert(t, test.name, got)
 		})
 	}
 }
+
+// TestTables checks that the tables extracted from the text of a PDF
+// statement match the CSV produced by tabula.
+func TestTables(t *testing.T) {
+	text, err := os.ReadFile(path.Join("testdata", "example1.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path.Join("testdata", "example1.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	want, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := pdftable.Rows(string(text), tables...)
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("pdftable.Rows() returned unexpected diff (-want/+got):\n%s", diff)
+	}
+}
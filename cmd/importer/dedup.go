@@ -0,0 +1,90 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sboehler/knut/lib/common/cpr"
+	"github.com/sboehler/knut/lib/common/set"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// Deduplicate removes all transactions from the ledger which already exist in
+// the journal at the given path, and returns the removed transactions.
+// Transactions are considered equal if they have the same date, the same
+// amounts and the same description, ignoring case and whitespace.
+// Accounts are not compared, as they are usually edited after an import.
+// Transactions with an import-id metadata entry are considered equal to
+// existing transactions with the same import id.
+func Deduplicate(ctx context.Context, path string, l *journal.Ledger) ([]*journal.Transaction, error) {
+	existing := make(map[string]int)
+	ids := set.New[string]()
+	p := journal.RecursiveParser{Context: journal.NewContext(), File: path}
+	err := cpr.Consume(ctx, p.Parse(ctx), func(d any) error {
+		switch t := d.(type) {
+		case error:
+			return t
+		case *journal.Transaction:
+			existing[fingerprint(t)]++
+			if id, ok := t.Metadata.Get(ImportID); ok {
+				ids.Add(id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var skipped []*journal.Transaction
+	for _, day := range l.Days {
+		var trx []*journal.Transaction
+		for _, t := range day.Transactions {
+			if id, ok := t.Metadata.Get(ImportID); ok && ids.Has(id) {
+				skipped = append(skipped, t)
+				continue
+			}
+			if k := fingerprint(t); existing[k] > 0 {
+				existing[k]--
+				skipped = append(skipped, t)
+				continue
+			}
+			trx = append(trx, t)
+		}
+		day.Transactions = trx
+	}
+	return skipped, nil
+}
+
+// ImportID is the metadata key of the id of an imported transaction at its
+// source, which importers set if the source provides one.
+const ImportID = "import-id"
+
+func fingerprint(t *journal.Transaction) string {
+	var amounts []string
+	for _, p := range t.Postings {
+		if p.Amount.IsPositive() {
+			amounts = append(amounts, fmt.Sprintf("%s %s", p.Amount, p.Commodity.Name()))
+		}
+	}
+	sort.Strings(amounts)
+	return fmt.Sprintf("%s|%s|%s",
+		t.Date.Format("2006-01-02"),
+		strings.ToLower(strings.Join(strings.Fields(t.Description), " ")),
+		strings.Join(amounts, ","))
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestDeduplicate(t *testing.T) {
+	var (
+		jctx  = journal.NewContext()
+		monzo = jctx.Account("Assets:Monzo")
+		tbd   = jctx.TBDAccount()
+		gbp   = jctx.Commodity("GBP")
+		j     = journal.New(jctx)
+	)
+	for _, trx := range []struct {
+		desc          string
+		credit, debit *journal.Account
+		amount        int64
+	}{
+		{"acme ltd", tbd, monzo, 2500},
+		{"Pret A Manger", monzo, tbd, 5},
+		{"Pret A Manger", monzo, tbd, 5},
+	} {
+		j.AddTransaction(journal.TransactionBuilder{
+			Date:        date.Date(2023, 3, 1),
+			Description: trx.desc,
+			Postings: journal.PostingBuilder{
+				Credit:    trx.credit,
+				Debit:     trx.debit,
+				Commodity: gbp,
+				Amount:    decimal.NewFromInt(trx.amount),
+			}.Build(),
+		}.Build())
+	}
+	l := j.ToLedger()
+
+	skipped, err := Deduplicate(context.Background(), "testdata/existing.knut", l)
+
+	if err != nil {
+		t.Fatalf("Deduplicate() returned unexpected error: %v", err)
+	}
+	if len(skipped) != 1 || skipped[0].Description != "acme ltd" {
+		t.Errorf("Deduplicate() skipped %v, want the transaction \"acme ltd\"", skipped)
+	}
+	if got := len(l.Days[0].Transactions); got != 2 {
+		t.Fatalf("got %d remaining transactions, want 2", got)
+	}
+	for _, trx := range l.Days[0].Transactions {
+		if trx.Description != "Pret A Manger" || !trx.Postings[1].Amount.Equal(decimal.NewFromInt(5)) {
+			t.Errorf("unexpected remaining transaction: %s %v", trx.Description, trx.Postings[1].Amount)
+		}
+	}
+}
+
+func TestDeduplicateImportID(t *testing.T) {
+	var (
+		jctx  = journal.NewContext()
+		monzo = jctx.Account("Assets:Monzo")
+		tbd   = jctx.TBDAccount()
+		gbp   = jctx.Commodity("GBP")
+		j     = journal.New(jctx)
+	)
+	for _, id := range []string{"T1", "T2"} {
+		j.AddTransaction(journal.TransactionBuilder{
+			Date:        date.Date(2023, 3, 3),
+			Description: "CARD PAYMENT TO TESCO",
+			Metadata:    journal.Metadata{{Key: ImportID, Value: id}},
+			Postings: journal.PostingBuilder{
+				Credit:    monzo,
+				Debit:     tbd,
+				Commodity: gbp,
+				Amount:    decimal.NewFromInt(12),
+			}.Build(),
+		}.Build())
+	}
+	l := j.ToLedger()
+
+	skipped, err := Deduplicate(context.Background(), "testdata/existing.knut", l)
+
+	if err != nil {
+		t.Fatalf("Deduplicate() returned unexpected error: %v", err)
+	}
+	if len(skipped) != 1 {
+		t.Fatalf("Deduplicate() skipped %d transactions, want 1", len(skipped))
+	}
+	if id, _ := skipped[0].Metadata.Get(ImportID); id != "T1" {
+		t.Errorf("Deduplicate() skipped the transaction with import id %q, want T1", id)
+	}
+}
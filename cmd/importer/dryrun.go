@@ -0,0 +1,68 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"github.com/sboehler/knut/lib/common/diff"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+const diffContext = 2
+
+var (
+	headerColor  = color.New(color.Bold)
+	hunkColor    = color.New(color.FgCyan)
+	addedColor   = color.New(color.FgGreen)
+	skippedColor = color.New(color.FgYellow)
+)
+
+// writeDryRun writes a unified diff of the changes to the file at path,
+// followed by the transactions which were skipped as duplicates.
+func writeDryRun(w io.Writer, path string, old, new []byte, skipped []*journal.Transaction) error {
+	for _, line := range strings.SplitAfter(diff.Unified(path, path, old, new, diffContext), "\n") {
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+			headerColor.Fprint(w, line)
+		case strings.HasPrefix(line, "@@"):
+			hunkColor.Fprint(w, line)
+		case strings.HasPrefix(line, "+"):
+			addedColor.Fprint(w, line)
+		default:
+			fmt.Fprint(w, line)
+		}
+	}
+	if len(skipped) == 0 {
+		return nil
+	}
+	skippedColor.Fprintf(w, "\nskipped %d duplicate transaction(s):\n", len(skipped))
+	p := journal.NewPrinter()
+	for _, t := range skipped {
+		p.Initialize([]journal.Directive{t})
+	}
+	for _, t := range skipped {
+		var b strings.Builder
+		if _, err := p.PrintDirective(&b, t); err != nil {
+			return err
+		}
+		skippedColor.Fprintln(w, b.String())
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteDryRun(t *testing.T) {
+	color.NoColor = true
+	var (
+		old = "a\nb\nc\nd\ne\nf\ng\nh\n"
+		new = "x\na\nb\nc\nd\ne\nf\ny\ng\nh\n"
+		got strings.Builder
+	)
+
+	if err := writeDryRun(&got, "journal.knut", []byte(old), []byte(new), nil); err != nil {
+		t.Fatalf("writeDryRun() returned unexpected error: %v", err)
+	}
+
+	want := `--- journal.knut
++++ journal.knut
+@@ -1,2 +1,3 @@
++x
+ a
+ b
+@@ -5,4 +6,5 @@
+ e
+ f
++y
+ g
+ h
+`
+	if diff := cmp.Diff(want, got.String()); diff != "" {
+		t.Errorf("writeDryRun() returned unexpected diff (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fidelity
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/common/csvkit"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	cmd := &cobra.Command{
+		Use:   "us.fidelity",
+		Short: "Import Fidelity account activity",
+		Long: `Download the account history as CSV from Activity & Orders. Buys, sells and reinvestments
+are booked against the trading account, dividends and capital gain distributions against the
+dividend account. All other activity is booked against Expenses:TBD.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		RunE: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+func init() {
+	importer.Register(CreateCmd)
+}
+
+type runner struct {
+	accountFlag, dividendFlag, feeFlag, tradingFlag flags.AccountFlag
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	c.Flags().VarP(&r.accountFlag, "account", "a", "account name")
+	c.Flags().VarP(&r.dividendFlag, "dividend", "d", "account name of the dividend account")
+	c.Flags().VarP(&r.feeFlag, "fee", "f", "account name of the fee account")
+	c.Flags().VarP(&r.tradingFlag, "trading", "t", "account name of the trading gain / loss account")
+	c.MarkFlagRequired("account")
+	c.MarkFlagRequired("dividend")
+	c.MarkFlagRequired("fee")
+	c.MarkFlagRequired("trading")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) error {
+	var (
+		ctx = journal.NewContext()
+		f   *bufio.Reader
+		err error
+	)
+	if f, err = flags.OpenFile(args[0]); err != nil {
+		return err
+	}
+	p := parser{
+		builder: journal.New(ctx),
+	}
+	if p.reader, err = csvkit.NewReader(f); err != nil {
+		return err
+	}
+	if p.account, err = r.accountFlag.Value(ctx); err != nil {
+		return err
+	}
+	if p.dividend, err = r.dividendFlag.Value(ctx); err != nil {
+		return err
+	}
+	if p.fee, err = r.feeFlag.Value(ctx); err != nil {
+		return err
+	}
+	if p.trading, err = r.tradingFlag.Value(ctx); err != nil {
+		return err
+	}
+	if err = p.parse(); err != nil {
+		return err
+	}
+	return importer.Print(cmd, p.builder.ToLedger())
+}
+
+type parser struct {
+	reader  *csv.Reader
+	builder *journal.Journal
+
+	account, dividend, fee, trading *journal.Account
+}
+
+func (p *parser) parse() error {
+	p.reader.FieldsPerRecord = -1
+	p.reader.TrimLeadingSpace = true
+	p.reader.LazyQuotes = true
+	for {
+		r, err := p.reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.parseActivity(r); err != nil {
+			return err
+		}
+	}
+}
+
+type field int
+
+const (
+	fRunDate field = iota
+	fAction
+	fSymbol
+	fSecurityDescription
+	fSecurityType
+	fQuantity
+	fPrice
+	fCommission
+	fFees
+	fAccruedInterest
+	fAmount
+	fSettlementDate
+)
+
+type activity struct {
+	date                  time.Time
+	action, symbol        string
+	quantity, fees, total decimal.Decimal
+}
+
+func (p *parser) parseActivity(r []string) error {
+	if len(r) <= int(fAmount) {
+		return nil
+	}
+	date, err := time.Parse("01/02/2006", strings.TrimSpace(r[fRunDate]))
+	if err != nil {
+		// skip header, disclaimers and empty lines
+		return nil
+	}
+	a := activity{
+		date:   date,
+		action: strings.TrimSpace(r[fAction]),
+		symbol: strings.TrimSpace(r[fSymbol]),
+	}
+	for _, f := range []struct {
+		field field
+		dest  *decimal.Decimal
+	}{
+		{fQuantity, &a.quantity},
+		{fAmount, &a.total},
+	} {
+		if *f.dest, err = parseDecimal(r[f.field]); err != nil {
+			return err
+		}
+	}
+	for _, f := range []field{fCommission, fFees} {
+		fee, err := parseDecimal(r[f])
+		if err != nil {
+			return err
+		}
+		a.fees = a.fees.Add(fee)
+	}
+	action := strings.ToUpper(a.action)
+	switch {
+	case strings.HasPrefix(action, "YOU BOUGHT"), strings.HasPrefix(action, "YOU SOLD"), strings.HasPrefix(action, "REINVESTMENT"):
+		return p.addTrade(a)
+	case strings.HasPrefix(action, "DIVIDEND RECEIVED"), strings.Contains(action, "CAP GAIN"):
+		return p.addDistribution(a)
+	default:
+		return p.addOther(a)
+	}
+}
+
+func parseDecimal(s string) (decimal.Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return decimal.Zero, nil
+	}
+	return csvkit.English.ParseDecimal(strings.TrimPrefix(s, "$"))
+}
+
+func (p *parser) addTrade(a activity) error {
+	var (
+		usd, security *journal.Commodity
+		err           error
+	)
+	if usd, err = p.builder.Context.GetCommodity("USD"); err != nil {
+		return err
+	}
+	if security, err = p.builder.Context.GetCommodity(a.symbol); err != nil {
+		return err
+	}
+	// the amount is net of fees
+	proceeds := a.total.Add(a.fees)
+	postings := journal.PostingBuilders{
+		{
+			Credit:    p.trading,
+			Debit:     p.account,
+			Commodity: security,
+			Amount:    a.quantity,
+			Targets:   []*journal.Commodity{security, usd},
+		},
+		{
+			Credit:    p.trading,
+			Debit:     p.account,
+			Commodity: usd,
+			Amount:    proceeds,
+			Targets:   []*journal.Commodity{security, usd},
+		},
+	}
+	if !a.fees.IsZero() {
+		postings = append(postings, journal.PostingBuilder{
+			Credit:    p.account,
+			Debit:     p.fee,
+			Commodity: usd,
+			Amount:    a.fees,
+			Targets:   []*journal.Commodity{security, usd},
+		})
+	}
+	p.builder.AddTransaction(journal.TransactionBuilder{
+		Date:        a.date,
+		Description: a.action,
+		Postings:    postings.Build(),
+	}.Build())
+	return nil
+}
+
+func (p *parser) addDistribution(a activity) error {
+	var (
+		usd, security *journal.Commodity
+		err           error
+	)
+	if usd, err = p.builder.Context.GetCommodity("USD"); err != nil {
+		return err
+	}
+	if security, err = p.builder.Context.GetCommodity(a.symbol); err != nil {
+		return err
+	}
+	p.builder.AddTransaction(journal.TransactionBuilder{
+		Date:        a.date,
+		Description: a.action,
+		Postings: journal.PostingBuilder{
+			Credit:    p.dividend,
+			Debit:     p.account,
+			Commodity: usd,
+			Amount:    a.total,
+			Targets:   []*journal.Commodity{security},
+		}.Build(),
+	}.Build())
+	return nil
+}
+
+func (p *parser) addOther(a activity) error {
+	if a.total.IsZero() {
+		return nil
+	}
+	usd, err := p.builder.Context.GetCommodity("USD")
+	if err != nil {
+		return err
+	}
+	p.builder.AddTransaction(journal.TransactionBuilder{
+		Date:        a.date,
+		Description: a.action,
+		Postings: journal.PostingBuilder{
+			Credit:    p.builder.Context.TBDAccount(),
+			Debit:     p.account,
+			Commodity: usd,
+			Amount:    a.total,
+		}.Build(),
+	}.Build())
+	return nil
+}
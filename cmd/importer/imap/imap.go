@@ -0,0 +1,230 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imap
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+
+	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/bankdata/imap"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	cmd := &cobra.Command{
+		Use:   "imap",
+		Short: "Import statements attached to messages in an IMAP mailbox",
+		Long: `Fetch the unread messages from an IMAP mailbox and run the matching importer on each
+attachment, according to the rules in the given configuration file in yaml format. See
+doc/imap.yaml for an example. The password is read from the KNUT_IMAP_PASSWORD environment
+variable unless given in the configuration file. Messages are marked as read once all their
+attachments have been imported.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		RunE: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+func init() {
+	importer.Register(CreateCmd)
+}
+
+type runner struct {
+	all, keepUnseen bool
+}
+
+func (r *runner) setupFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&r.all, "all", false, "process all messages in the mailbox, not only unread ones")
+	cmd.Flags().BoolVar(&r.keepUnseen, "keep-unseen", false, "do not mark processed messages as read")
+}
+
+type config struct {
+	Server   string `yaml:"server"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Mailbox  string `yaml:"mailbox"`
+	Rules    []rule `yaml:"rules"`
+}
+
+// rule selects the importer for an attachment.
+type rule struct {
+	// Filename is a glob pattern matched against the attachment's file name,
+	// ignoring case.
+	Filename string `yaml:"filename"`
+
+	// From and Subject must be contained in the message's sender and subject,
+	// ignoring case.
+	From    string `yaml:"from"`
+	Subject string `yaml:"subject"`
+
+	// Importer is the name of the importer, e.g. ch.postfinance.
+	Importer string `yaml:"importer"`
+
+	// Args are passed to the importer, before the file name.
+	Args []string `yaml:"args"`
+}
+
+func (r rule) matches(m *imap.Message, a imap.Attachment) bool {
+	if len(r.Filename) > 0 {
+		if ok, _ := path.Match(strings.ToLower(r.Filename), strings.ToLower(a.Filename)); !ok {
+			return false
+		}
+	}
+	return containsFold(m.From, r.From) && containsFold(m.Subject, r.Subject)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func readConfig(path string) (*config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.SetStrict(true)
+	var c config
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	if len(c.Server) == 0 {
+		return nil, fmt.Errorf("%s: no server given", path)
+	}
+	if len(c.Mailbox) == 0 {
+		c.Mailbox = "INBOX"
+	}
+	if len(c.Password) == 0 {
+		c.Password = os.Getenv("KNUT_IMAP_PASSWORD")
+	}
+	for i, r := range c.Rules {
+		if len(r.Importer) == 0 {
+			return nil, fmt.Errorf("%s: rule %d has no importer", path, i+1)
+		}
+	}
+	return &c, nil
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) error {
+	cfg, err := readConfig(args[0])
+	if err != nil {
+		return err
+	}
+	c, err := imap.Dial(cfg.Server)
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+	if err := c.Login(cfg.Username, cfg.Password); err != nil {
+		return err
+	}
+	if err := c.Select(cfg.Mailbox); err != nil {
+		return err
+	}
+	criteria := "UNSEEN"
+	if r.all {
+		criteria = "ALL"
+	}
+	uids, err := c.Search(criteria)
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		raw, err := c.Fetch(uid)
+		if err != nil {
+			return err
+		}
+		m, err := imap.ParseMessage(raw)
+		if err != nil {
+			return fmt.Errorf("message %d: %w", uid, err)
+		}
+		if err := importMessage(cmd, cfg.Rules, m); err != nil {
+			return fmt.Errorf("message %q: %w", m.Subject, err)
+		}
+		if !r.keepUnseen && !dryRun(cmd) {
+			if err := c.MarkSeen(uid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// importMessage runs the importer of the first matching rule on each
+// attachment of the message. Attachments without a matching rule are
+// ignored.
+func importMessage(cmd *cobra.Command, rules []rule, m *imap.Message) error {
+	for _, a := range m.Attachments {
+		for _, r := range rules {
+			if !r.matches(m, a) {
+				continue
+			}
+			if err := runImporter(cmd, r, a); err != nil {
+				return fmt.Errorf("%s: %w", a.Filename, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// runImporter stores the attachment in a temporary file and runs the
+// importer on it, forwarding the flags of the import command.
+func runImporter(cmd *cobra.Command, r rule, a imap.Attachment) error {
+	f, err := os.CreateTemp("", "knut-*"+filepath.Ext(a.Filename))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(a.Data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	args := []string{r.Importer}
+	cmd.InheritedFlags().Visit(func(f *pflag.Flag) {
+		args = append(args, fmt.Sprintf("--%s=%s", f.Name, f.Value))
+	})
+	args = append(args, r.Args...)
+	args = append(args, f.Name())
+
+	c := importer.CreateCmd()
+	c.SetArgs(args)
+	c.SetOut(cmd.OutOrStdout())
+	c.SetErr(cmd.ErrOrStderr())
+	c.SilenceUsage = true
+	c.SilenceErrors = true
+	return c.ExecuteContext(cmd.Context())
+}
+
+func dryRun(cmd *cobra.Command) bool {
+	f := cmd.Flags().Lookup("dry-run")
+	return f != nil && f.Value.String() == "true"
+}
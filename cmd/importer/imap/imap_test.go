@@ -0,0 +1,63 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imap
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sboehler/knut/lib/bankdata/imap"
+
+	_ "github.com/sboehler/knut/cmd/importer/postfinance"
+)
+
+func TestImportMessage(t *testing.T) {
+	input, err := os.ReadFile("../postfinance/testdata/example1.input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("../postfinance/testdata/example1.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		rules = []rule{
+			{Filename: "*.pdf", Importer: "ch.cumulus"},
+			{Filename: "*.CSV", From: "postfinance", Importer: "ch.postfinance", Args: []string{"--account", "Assets:Postfinance"}},
+		}
+		m = &imap.Message{
+			From:    "PostFinance <noreply@postfinance.ch>",
+			Subject: "Kontoauszug",
+			Attachments: []imap.Attachment{
+				{Filename: "logo.png", Data: []byte("png")},
+				{Filename: "export.csv", Data: input},
+			},
+		}
+		cmd = CreateCmd()
+		out bytes.Buffer
+	)
+	cmd.SetOut(&out)
+
+	if err := importMessage(cmd, rules, m); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(string(want), out.String()); diff != "" {
+		t.Fatalf("importMessage() returned unexpected diff (-want/+got):\n%s", diff)
+	}
+}
@@ -23,7 +23,20 @@ func CreateCmd() *cobra.Command {
 	cmd := cobra.Command{
 		Use:   "import",
 		Short: "Import financial account statements",
+		Long: `Import financial account statements using one of the built-in importers.
+
+Executables named knut-importer-<name> on the PATH are available as importer <name>. They
+receive a JSON request {"version": 1, "args": [...]} on standard input, with the arguments
+also passed on the command line, and write the imported transactions, prices and balance
+assertions as JSON to standard output. See doc/importer-plugin.md for the format.`,
+
+		// Flags are parsed by the importers, which are only discovered
+		// when none of the built-in importers matches.
+		DisableFlagParsing: true,
+
+		RunE: runPluginCmd,
 	}
+	SetupFlags(&cmd)
 	for _, constructor := range importers {
 		cmd.AddCommand(constructor())
 	}
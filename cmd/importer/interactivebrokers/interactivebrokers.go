@@ -15,7 +15,6 @@
 package interactivebrokers
 
 import (
-	"bufio"
 	"encoding/csv"
 	"fmt"
 	"io"
@@ -28,6 +27,7 @@ import (
 
 	"github.com/sboehler/knut/cmd/flags"
 	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/common/csvkit"
 	"github.com/sboehler/knut/lib/journal"
 )
 
@@ -104,10 +104,7 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 	if err = p.parse(); err != nil {
 		return err
 	}
-	out := bufio.NewWriter(cmd.OutOrStdout())
-	defer out.Flush()
-	_, err = journal.NewPrinter().PrintLedger(out, p.builder.ToLedger())
-	return err
+	return importer.Print(cmd, p.builder.ToLedger())
 }
 
 type parser struct {
@@ -273,7 +270,7 @@ func (p *parser) parseTrade(r []string) (bool, error) {
 	if qty, err = parseRoundedDecimal(r[tfQuantity]); err != nil {
 		return false, err
 	}
-	if price, err = parseDecimal(r[tfTPrice]); err != nil {
+	if price, err = csvkit.English.ParseDecimal(r[tfTPrice]); err != nil {
 		return false, err
 	}
 	if proceeds, err = parseRoundedDecimal(r[tfProceeds]); err != nil {
@@ -346,7 +343,7 @@ func (p *parser) parseForex(r []string) (bool, error) {
 	if qty, err = parseRoundedDecimal(r[tfQuantity]); err != nil {
 		return false, err
 	}
-	if price, err = parseDecimal(r[tfTPrice]); err != nil {
+	if price, err = csvkit.English.ParseDecimal(r[tfTPrice]); err != nil {
 		return false, err
 	}
 	if proceeds, err = parseRoundedDecimal(r[tfProceeds]); err != nil {
@@ -477,7 +474,7 @@ func (p *parser) parseDividend(r []string) (bool, error) {
 	if date, err = parseDate(r[dfDate]); err != nil {
 		return false, err
 	}
-	if amount, err = parseDecimal(r[dfAmount]); err != nil {
+	if amount, err = csvkit.English.ParseDecimal(r[dfAmount]); err != nil {
 		return false, err
 	}
 	if symbol, err = parseDividendSymbol(r[dfDescription]); err != nil {
@@ -542,7 +539,7 @@ func (p *parser) parseWithholdingTax(r []string) (bool, error) {
 	if date, err = parseDate(r[wtfDate]); err != nil {
 		return false, err
 	}
-	if amount, err = parseDecimal(r[wtfAmount]); err != nil {
+	if amount, err = csvkit.English.ParseDecimal(r[wtfAmount]); err != nil {
 		return false, err
 	}
 	if symbol, err = parseDividendSymbol(r[wtfDescription]); err != nil {
@@ -583,7 +580,7 @@ func (p *parser) parseInterest(r []string) (bool, error) {
 	if date, err = parseDate(r[dfDate]); err != nil {
 		return false, err
 	}
-	if amount, err = parseDecimal(r[dfAmount]); err != nil {
+	if amount, err = csvkit.English.ParseDecimal(r[dfAmount]); err != nil {
 		return false, err
 	}
 	p.builder.AddTransaction(journal.TransactionBuilder{
@@ -696,17 +693,13 @@ func (p *parser) createCurrencyAssertions(r []string) (bool, error) {
 }
 
 func parseRoundedDecimal(s string) (decimal.Decimal, error) {
-	amount, err := parseDecimal(s)
+	amount, err := csvkit.English.ParseDecimal(s)
 	if err != nil {
 		return amount, err
 	}
 	return amount.Round(2), nil
 }
 
-func parseDecimal(s string) (decimal.Decimal, error) {
-	return decimal.NewFromString(strings.ReplaceAll(s, ",", ""))
-}
-
 func parseDateFromDateTime(s string) (time.Time, error) {
 	return parseDate(s[:10])
 }
@@ -0,0 +1,211 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrosbank
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/common/csvkit"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// CreateCmd creates the cobra command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	cmd := &cobra.Command{
+		Use:   "ch.migrosbank",
+		Short: "Import Migros Bank CSV account statements",
+		Long:  `Download the CSV export of the account transactions from the e-banking.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		RunE: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+func init() {
+	importer.Register(CreateCmd)
+}
+
+type runner struct {
+	account flags.AccountFlag
+}
+
+func (r *runner) setupFlags(cmd *cobra.Command) {
+	cmd.Flags().VarP(&r.account, "account", "a", "account name")
+	cmd.MarkFlagRequired("account")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) error {
+	var (
+		ctx = journal.NewContext()
+		f   *bufio.Reader
+		err error
+	)
+	if f, err = flags.OpenFile(args[0]); err != nil {
+		return err
+	}
+	p := parser{
+		journal: journal.New(ctx),
+	}
+	if p.reader, err = csvkit.NewReader(f); err != nil {
+		return err
+	}
+	if p.account, err = r.account.Value(ctx); err != nil {
+		return err
+	}
+	if err = p.parse(); err != nil {
+		return err
+	}
+	return importer.Print(cmd, p.journal.ToLedger())
+}
+
+type parser struct {
+	reader  *csv.Reader
+	account *journal.Account
+	journal *journal.Journal
+
+	currency *journal.Commodity
+}
+
+func (p *parser) parse() error {
+	p.reader.FieldsPerRecord = -1
+	p.reader.LazyQuotes = true
+	p.reader.TrimLeadingSpace = true
+	p.reader.Comma = ';'
+	if err := p.parseMetadata(); err != nil {
+		return err
+	}
+	if p.currency == nil {
+		return fmt.Errorf("no currency found in the metadata header")
+	}
+	for {
+		err := p.readLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// balanceRegex matches the balance in the metadata header, e.g.
+// "Saldo: CHF 1'234.56".
+var balanceRegex = regexp.MustCompile(`^Saldo:\s*([A-Z]{3})\b`)
+
+// parseMetadata reads the metadata lines up to and including the
+// header of the records.
+func (p *parser) parseMetadata() error {
+	for {
+		l, err := p.reader.Read()
+		if err == io.EOF {
+			return fmt.Errorf("missing header line")
+		}
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(l[bfDatum]) == "Datum" {
+			return p.checkHeader(l)
+		}
+		if m := balanceRegex.FindStringSubmatch(strings.TrimSpace(l[0])); m != nil {
+			if p.currency, err = p.journal.Context.GetCommodity(m[1]); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *parser) checkHeader(l []string) error {
+	if len(l) <= int(bfBetrag) || strings.TrimSpace(l[bfBuchungstext]) != "Buchungstext" || strings.TrimSpace(l[bfBetrag]) != "Betrag" {
+		return fmt.Errorf("unexpected header line %q", l)
+	}
+	return nil
+}
+
+type bookingField int
+
+const (
+	bfDatum bookingField = iota
+	bfBuchungstext
+	bfMitteilung
+	bfReferenznummer
+	bfBetrag
+	bfValuta
+)
+
+func (p *parser) readLine() error {
+	l, err := p.reader.Read()
+	if err != nil {
+		return err
+	}
+	if len(l) <= int(bfBetrag) || len(strings.TrimSpace(l[bfDatum])) == 0 {
+		return nil
+	}
+	var (
+		date   time.Time
+		amount decimal.Decimal
+	)
+	if date, err = parseDate(l[bfDatum]); err != nil {
+		return err
+	}
+	if amount, err = csvkit.Swiss.ParseDecimal(strings.TrimSpace(l[bfBetrag])); err != nil {
+		return err
+	}
+	p.journal.AddTransaction(journal.TransactionBuilder{
+		Date:        date,
+		Description: parseDescription(l),
+		Postings: journal.PostingBuilder{
+			Credit:    p.journal.Context.TBDAccount(),
+			Debit:     p.account,
+			Commodity: p.currency,
+			Amount:    amount,
+		}.Build(),
+	}.Build())
+	return nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == len("02.01.06") {
+		return time.Parse("02.01.06", s)
+	}
+	return time.Parse("02.01.2006", s)
+}
+
+var space = regexp.MustCompile(`\s+`)
+
+func parseDescription(l []string) string {
+	var words []string
+	for _, f := range []bookingField{bfBuchungstext, bfMitteilung} {
+		if s := strings.TrimSpace(l[f]); len(s) > 0 {
+			words = append(words, s)
+		}
+	}
+	return space.ReplaceAllString(strings.Join(words, " "), " ")
+}
@@ -0,0 +1,220 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monzo
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	cmd := &cobra.Command{
+		Use:   "uk.monzo",
+		Short: "Import Monzo CSV account statements",
+		Long: `Export the transactions as CSV from the Monzo app or web interface. Transfers to and from pots
+are booked against a sub-account of the target account named after the pot, unless a different
+account is given with --pot.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		RunE: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+func init() {
+	importer.Register(CreateCmd)
+}
+
+type runner struct {
+	account flags.AccountFlag
+	pots    map[string]string
+}
+
+func (r *runner) setupFlags(cmd *cobra.Command) {
+	cmd.Flags().VarP(&r.account, "account", "a", "account name")
+	cmd.Flags().StringToStringVarP(&r.pots, "pot", "p", nil, "<pot name>=<account> mapping for pot transfers")
+	cmd.MarkFlagRequired("account")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) error {
+	var (
+		ctx = journal.NewContext()
+		f   *bufio.Reader
+		err error
+	)
+	if f, err = flags.OpenFile(args[0]); err != nil {
+		return err
+	}
+	p := parser{
+		reader:  csv.NewReader(f),
+		journal: journal.New(ctx),
+		pots:    make(map[string]*journal.Account),
+	}
+	if p.account, err = r.account.Value(ctx); err != nil {
+		return err
+	}
+	for name, account := range r.pots {
+		if p.pots[name], err = ctx.GetAccount(account); err != nil {
+			return err
+		}
+	}
+	if err = p.parse(); err != nil {
+		return err
+	}
+	return importer.Print(cmd, p.journal.ToLedger())
+}
+
+type parser struct {
+	reader  *csv.Reader
+	account *journal.Account
+	pots    map[string]*journal.Account
+	journal *journal.Journal
+}
+
+func (p *parser) parse() error {
+	p.reader.TrimLeadingSpace = true
+	p.reader.FieldsPerRecord = len(header)
+	if err := p.parseHeader(); err != nil {
+		return err
+	}
+	for {
+		err := p.parseBooking()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type bookingField int
+
+const (
+	bfTransactionID bookingField = iota
+	bfDate
+	bfTime
+	bfType
+	bfName
+	bfEmoji
+	bfCategory
+	bfAmount
+	bfCurrency
+	bfLocalAmount
+	bfLocalCurrency
+	bfNotesAndTags
+	bfAddress
+	bfReceipt
+	bfDescription
+	bfCategorySplit
+	bfMoneyOut
+	bfMoneyIn
+)
+
+var header = []string{
+	"Transaction ID", "Date", "Time", "Type", "Name", "Emoji", "Category", "Amount", "Currency",
+	"Local amount", "Local currency", "Notes and #tags", "Address", "Receipt", "Description",
+	"Category split", "Money Out", "Money In",
+}
+
+func (p *parser) parseHeader() error {
+	r, err := p.reader.Read()
+	if err != nil {
+		return err
+	}
+	for i := range r {
+		if r[i] != header[i] {
+			return fmt.Errorf("invalid header: %v", r)
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseBooking() error {
+	r, err := p.reader.Read()
+	if err != nil {
+		return err
+	}
+	var (
+		d      time.Time
+		amt    decimal.Decimal
+		c      *journal.Commodity
+		credit = p.journal.Context.TBDAccount()
+		desc   = strings.TrimSpace(r[bfName])
+	)
+	if d, err = time.Parse("02/01/2006", r[bfDate]); err != nil {
+		return fmt.Errorf("invalid date in row %v: %w", r, err)
+	}
+	if amt, err = decimal.NewFromString(r[bfAmount]); err != nil {
+		return fmt.Errorf("invalid amount in row %v: %w", r, err)
+	}
+	if c, err = p.journal.Context.GetCommodity(r[bfCurrency]); err != nil {
+		return fmt.Errorf("invalid commodity in row %v: %w", r, err)
+	}
+	if len(desc) == 0 {
+		desc = strings.TrimSpace(r[bfDescription])
+	}
+	if r[bfType] == "Pot transfer" {
+		if credit, err = p.potAccount(desc); err != nil {
+			return err
+		}
+		desc = fmt.Sprintf("Pot transfer %s", desc)
+	}
+	if lc := r[bfLocalCurrency]; len(lc) > 0 && lc != r[bfCurrency] {
+		desc = fmt.Sprintf("%s %s %s", desc, r[bfLocalAmount], lc)
+	}
+	p.journal.AddTransaction(journal.TransactionBuilder{
+		Date:        d,
+		Description: desc,
+		Postings: journal.PostingBuilder{
+			Credit:    credit,
+			Debit:     p.account,
+			Commodity: c,
+			Amount:    amt,
+		}.Build(),
+	}.Build())
+	return nil
+}
+
+// potAccount returns the account configured for the given pot, or a
+// sub-account of the target account named after the pot.
+func (p *parser) potAccount(name string) (*journal.Account, error) {
+	if a, ok := p.pots[name]; ok {
+		return a, nil
+	}
+	segment := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+	return p.journal.Context.GetAccount(fmt.Sprintf("%s:%s", p.account.Name(), segment))
+}
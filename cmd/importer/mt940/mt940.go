@@ -0,0 +1,297 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mt940
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// CreateCmd creates the cobra command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	cmd := &cobra.Command{
+		Use:   "mt940",
+		Short: "Import SWIFT MT940 account statements",
+		Long: `Import the bookings of the account statements in an MT940 file, as offered for download
+by many banks. The description of a booking is taken from its information to account owner
+(field 86).`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		RunE: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+func init() {
+	importer.Register(CreateCmd)
+}
+
+type runner struct {
+	accountFlag    flags.AccountFlag
+	closingBalance bool
+}
+
+func (r *runner) setupFlags(cmd *cobra.Command) {
+	cmd.Flags().VarP(&r.accountFlag, "account", "a", "account name")
+	cmd.Flags().BoolVar(&r.closingBalance, "closing-balance", false, "add a balance assertion for the closing balance of each statement")
+	cmd.MarkFlagRequired("account")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) error {
+	var (
+		reader *bufio.Reader
+		ctx    = journal.NewContext()
+		err    error
+	)
+	if reader, err = flags.OpenFile(args[0]); err != nil {
+		return err
+	}
+	p := parser{
+		journal:        journal.New(ctx),
+		closingBalance: r.closingBalance,
+	}
+	if p.account, err = r.accountFlag.Value(ctx); err != nil {
+		return err
+	}
+	if err = p.parse(reader); err != nil {
+		return err
+	}
+	return importer.Print(cmd, p.journal.ToLedger())
+}
+
+type parser struct {
+	account        *journal.Account
+	journal        *journal.Journal
+	closingBalance bool
+
+	// the currency of the statement, given by its opening balance
+	currency *journal.Commodity
+
+	// the booking whose description is given by the next field 86
+	pending *journal.TransactionBuilder
+}
+
+// field is a tagged field of a statement, such as ":61:".
+type field struct {
+	tag, value string
+}
+
+func (p *parser) parse(r io.Reader) error {
+	fields, err := readFields(r)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if err := p.parseField(f); err != nil {
+			return fmt.Errorf(":%s:%s: %w", f.tag, f.value, err)
+		}
+	}
+	p.flush()
+	return nil
+}
+
+// readFields splits the input into fields. A field continues on the
+// following lines until the next tag or the end of the statement ("-").
+func readFields(r io.Reader) ([]field, error) {
+	var (
+		res []field
+		s   = bufio.NewScanner(r)
+	)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r ")
+		switch {
+		case line == "-" || line == "":
+		case strings.HasPrefix(line, ":"):
+			tag, value, ok := strings.Cut(line[1:], ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid field %q", line)
+			}
+			res = append(res, field{tag, value})
+		case len(res) > 0:
+			res[len(res)-1].value += "\n" + line
+		}
+	}
+	return res, s.Err()
+}
+
+func (p *parser) parseField(f field) error {
+	switch f.tag {
+	case "61":
+		p.flush()
+		return p.parseBooking(f.value)
+	case "86":
+		if p.pending != nil {
+			p.pending.Description = description(f.value)
+		}
+		return nil
+	case "60F", "60M":
+		p.flush()
+		return p.parseOpeningBalance(f.value)
+	case "62F":
+		p.flush()
+		if p.closingBalance {
+			return p.parseClosingBalance(f.value)
+		}
+		return nil
+	default:
+		p.flush()
+		return nil
+	}
+}
+
+// flush adds the pending booking to the journal.
+func (p *parser) flush() {
+	if p.pending == nil {
+		return
+	}
+	p.journal.AddTransaction(p.pending.Build())
+	p.pending = nil
+}
+
+// bookingRegex matches the value date, the optional entry date, the
+// credit/debit mark, the optional funds code and the amount of field 61.
+var bookingRegex = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)[A-Z]?(\d+,\d*)`)
+
+func (p *parser) parseBooking(value string) error {
+	m := bookingRegex.FindStringSubmatch(value)
+	if m == nil {
+		return fmt.Errorf("invalid booking")
+	}
+	if p.currency == nil {
+		return fmt.Errorf("booking before the opening balance")
+	}
+	var (
+		d      time.Time
+		amount decimal.Decimal
+		err    error
+	)
+	if d, err = time.Parse("060102", m[1]); err != nil {
+		return err
+	}
+	if amount, err = parseAmount(m[4], m[3]); err != nil {
+		return err
+	}
+	p.pending = &journal.TransactionBuilder{
+		Date: d,
+		Postings: journal.PostingBuilder{
+			Credit:    p.journal.Context.TBDAccount(),
+			Debit:     p.account,
+			Commodity: p.currency,
+			Amount:    amount,
+		}.Build(),
+	}
+	return nil
+}
+
+// balanceRegex matches the credit/debit mark, the date, the currency and
+// the amount of a balance.
+var balanceRegex = regexp.MustCompile(`^(C|D)(\d{6})([A-Z]{3})(\d+,\d*)$`)
+
+// parseOpeningBalance sets the currency of the statement.
+func (p *parser) parseOpeningBalance(value string) error {
+	m := balanceRegex.FindStringSubmatch(value)
+	if m == nil {
+		return fmt.Errorf("invalid balance")
+	}
+	var err error
+	p.currency, err = p.journal.Context.GetCommodity(m[3])
+	return err
+}
+
+// parseClosingBalance adds a balance assertion for the closing balance,
+// dated the day the statement ends.
+func (p *parser) parseClosingBalance(value string) error {
+	m := balanceRegex.FindStringSubmatch(value)
+	if m == nil {
+		return fmt.Errorf("invalid balance")
+	}
+	var (
+		d         time.Time
+		amount    decimal.Decimal
+		commodity *journal.Commodity
+		err       error
+	)
+	if d, err = time.Parse("060102", m[2]); err != nil {
+		return err
+	}
+	if commodity, err = p.journal.Context.GetCommodity(m[3]); err != nil {
+		return err
+	}
+	if amount, err = parseAmount(m[4], m[1]); err != nil {
+		return err
+	}
+	p.journal.AddAssertion(&journal.Assertion{
+		Date:      d,
+		Account:   p.account,
+		Amount:    amount,
+		Commodity: commodity,
+	})
+	return nil
+}
+
+// parseAmount parses an amount with a decimal comma, which is negative if
+// it is debited. A reversal of a credit is a debit and vice versa.
+func parseAmount(value, mark string) (decimal.Decimal, error) {
+	amount, err := decimal.NewFromString(strings.Replace(value, ",", ".", 1))
+	if err != nil {
+		return amount, err
+	}
+	switch mark {
+	case "C", "RD":
+		return amount, nil
+	case "D", "RC":
+		return amount.Neg(), nil
+	default:
+		return amount, fmt.Errorf("invalid credit/debit mark %q", mark)
+	}
+}
+
+// structuredRegex matches a structured field 86, which starts with a
+// transaction code followed by subfields such as "?20".
+var structuredRegex = regexp.MustCompile(`^\d{3}\?`)
+
+// subfieldRegex matches a subfield of a structured field 86.
+var subfieldRegex = regexp.MustCompile(`\?(\d\d)([^?]*)`)
+
+// description returns the text of field 86. Of a structured field, the
+// purpose (subfields 20 to 29) and the name of the counterparty (subfields
+// 32 and 33) are returned.
+func description(value string) string {
+	value = strings.ReplaceAll(value, "\n", "")
+	if !structuredRegex.MatchString(value) {
+		return strings.Join(strings.Fields(value), " ")
+	}
+	var fields []string
+	for _, m := range subfieldRegex.FindAllStringSubmatch(value, -1) {
+		if (m[1] >= "20" && m[1] <= "29") || m[1] == "32" || m[1] == "33" {
+			fields = append(fields, strings.Fields(m[2])...)
+		}
+	}
+	return strings.Join(fields, " ")
+}
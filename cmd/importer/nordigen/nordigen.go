@@ -0,0 +1,156 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nordigen
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/bankdata/nordigen"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/set"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	cmd := &cobra.Command{
+		Use:   "nordigen",
+		Short: "Import transactions from the GoCardless (Nordigen) Bank Account Data API",
+		Long: `Fetch the booked transactions of the bank accounts linked to the given requisition directly from the
+GoCardless Bank Account Data API. The access token is read from the NORDIGEN_TOKEN environment variable
+unless given with --token.`,
+
+		Args: cobra.NoArgs,
+
+		RunE: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+func init() {
+	importer.Register(CreateCmd)
+}
+
+type runner struct {
+	account      flags.AccountFlag
+	requisition  string
+	token        string
+	bankAccounts []string
+	period       flags.PeriodFlag
+}
+
+func (r *runner) setupFlags(cmd *cobra.Command) {
+	cmd.Flags().VarP(&r.account, "account", "a", "account name")
+	cmd.Flags().StringVar(&r.requisition, "requisition", "", "requisition ID")
+	cmd.Flags().StringVar(&r.token, "token", "", "access token")
+	cmd.Flags().StringSliceVar(&r.bankAccounts, "bank-account", nil, "only import the bank accounts with the given IDs")
+	r.period.Setup(cmd, date.Period{})
+	cmd.MarkFlagRequired("account")
+	cmd.MarkFlagRequired("requisition")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) error {
+	token := r.token
+	if len(token) == 0 {
+		token = os.Getenv("NORDIGEN_TOKEN")
+	}
+	if len(token) == 0 {
+		return fmt.Errorf("no access token given")
+	}
+	var (
+		ctx     = journal.NewContext()
+		client  = nordigen.New(token)
+		account *journal.Account
+		req     *nordigen.Requisition
+		err     error
+	)
+	if account, err = r.account.Value(ctx); err != nil {
+		return err
+	}
+	if req, err = client.Requisition(r.requisition); err != nil {
+		return err
+	}
+	var (
+		j        = journal.New(ctx)
+		selected = set.Of(r.bankAccounts...)
+		period   = r.period.Value()
+	)
+	for _, id := range req.Accounts {
+		if len(selected) > 0 && !selected.Has(id) {
+			continue
+		}
+		trx, err := client.Transactions(id, period.Start, period.End)
+		if err != nil {
+			return err
+		}
+		for _, t := range trx.Booked {
+			res, err := createTransaction(ctx, account, t)
+			if err != nil {
+				return err
+			}
+			j.AddTransaction(res)
+		}
+	}
+	return importer.Print(cmd, j.ToLedger())
+}
+
+func createTransaction(ctx journal.Context, account *journal.Account, t nordigen.Transaction) (*journal.Transaction, error) {
+	var (
+		d   time.Time
+		amt decimal.Decimal
+		c   *journal.Commodity
+		err error
+	)
+	if d, err = time.Parse("2006-01-02", t.BookingDate); err != nil {
+		return nil, fmt.Errorf("invalid booking date in transaction %s: %w", t.TransactionID, err)
+	}
+	if amt, err = decimal.NewFromString(t.TransactionAmount.Amount); err != nil {
+		return nil, fmt.Errorf("invalid amount in transaction %s: %w", t.TransactionID, err)
+	}
+	if c, err = ctx.GetCommodity(t.TransactionAmount.Currency); err != nil {
+		return nil, fmt.Errorf("invalid currency in transaction %s: %w", t.TransactionID, err)
+	}
+	var words []string
+	for _, s := range []string{t.CreditorName, t.DebtorName, t.RemittanceInformationUnstructured} {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			words = append(words, s)
+		}
+	}
+	var metadata journal.Metadata
+	if t.TransactionID != "" {
+		metadata = journal.Metadata{{Key: importer.ImportID, Value: t.TransactionID}}
+	}
+	return journal.TransactionBuilder{
+		Date:        d,
+		Description: strings.Join(words, " "),
+		Metadata:    metadata,
+		Postings: journal.PostingBuilder{
+			Credit:    ctx.TBDAccount(),
+			Debit:     account,
+			Commodity: c,
+			Amount:    amt,
+		}.Build(),
+	}.Build(), nil
+}
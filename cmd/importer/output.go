@@ -0,0 +1,167 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/natefinch/atomic"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/bayes"
+	"github.com/sboehler/knut/lib/journal/format"
+)
+
+const (
+	journalFlag      = "journal"
+	trainingFileFlag = "training-file"
+	appendToFlag     = "append-to"
+	dryRunFlag       = "dry-run"
+)
+
+// SetupFlags adds the options which are common to all importers to the
+// command. Subcommands of the import command inherit them.
+func SetupFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String(journalFlag, "", "skip transactions which already exist in the given journal")
+	cmd.PersistentFlags().String(trainingFileFlag, "", "infer accounts of imported transactions from the given journal")
+	cmd.PersistentFlags().String(appendToFlag, "", "insert the imported directives into the given journal file, ordered by date")
+	cmd.PersistentFlags().Bool(dryRunFlag, false, "show the changes to the file given by --append-to without writing it")
+}
+
+// DryRun returns whether the changes of an import are only shown, in
+// which case importers must not persist any state.
+func DryRun(cmd *cobra.Command) bool {
+	return stringFlag(cmd, dryRunFlag) == "true"
+}
+
+// Print prints the ledger produced by an importer to the command's output,
+// applying the options which are common to all importers.
+func Print(cmd *cobra.Command, l *journal.Ledger) error {
+	var (
+		appendTo = stringFlag(cmd, appendToFlag)
+		dryRun   = DryRun(cmd)
+		skipped  []*journal.Transaction
+	)
+	if dryRun && len(appendTo) == 0 {
+		return fmt.Errorf("--%s requires --%s", dryRunFlag, appendToFlag)
+	}
+	if path := stringFlag(cmd, journalFlag); len(path) > 0 {
+		var err error
+		if skipped, err = Deduplicate(cmd.Context(), path, l); err != nil {
+			return err
+		}
+		if len(skipped) > 0 && !dryRun {
+			fmt.Fprintf(cmd.ErrOrStderr(), "skipped %d transaction(s) already present in %s\n", len(skipped), path)
+		}
+	}
+	if path := stringFlag(cmd, trainingFileFlag); len(path) > 0 {
+		if err := infer(cmd.Context(), path, l); err != nil {
+			return err
+		}
+	}
+	if len(appendTo) > 0 {
+		old, new, err := insert(appendTo, l)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			w := bufio.NewWriter(cmd.OutOrStdout())
+			defer w.Flush()
+			return writeDryRun(w, appendTo, old, new, skipped)
+		}
+		return atomic.WriteFile(appendTo, bytes.NewReader(new))
+	}
+	w := bufio.NewWriter(cmd.OutOrStdout())
+	defer w.Flush()
+	_, err := journal.NewPrinter().PrintLedger(w, l)
+	return err
+}
+
+// insert returns the contents of the given file before and after inserting
+// the directives of the ledger.
+func insert(path string, l *journal.Ledger) ([]byte, []byte, error) {
+	old, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, cls, err := journal.ParserFromPath(journal.NewContext(), path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cls()
+	var directives []journal.Directive
+	for {
+		d, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		directives = append(directives, d)
+	}
+	var insert []journal.Directive
+	for _, day := range l.Days {
+		insert = appendAll(insert, day.Prices)
+		insert = appendAll(insert, day.Openings)
+		insert = appendAll(insert, day.Transactions)
+		insert = appendAll(insert, day.Values)
+		insert = appendAll(insert, day.Assertions)
+		insert = appendAll(insert, day.Closings)
+	}
+	var buf bytes.Buffer
+	if err := format.Insert(directives, insert, bytes.NewReader(old), &buf); err != nil {
+		return nil, nil, err
+	}
+	return old, buf.Bytes(), nil
+}
+
+func appendAll[T journal.Directive](ds []journal.Directive, ts []T) []journal.Directive {
+	for _, t := range ts {
+		ds = append(ds, t)
+	}
+	return ds
+}
+
+// infer replaces the TBD account in the ledger's transactions with accounts
+// inferred from the given training file.
+func infer(ctx context.Context, path string, l *journal.Ledger) error {
+	tbd := l.Context.TBDAccount()
+	model, err := bayes.Train(ctx, l.Context, path, tbd)
+	if err != nil {
+		return err
+	}
+	for _, day := range l.Days {
+		for _, t := range day.Transactions {
+			model.Infer(t, tbd, 0)
+		}
+	}
+	return nil
+}
+
+// stringFlag returns the value of the given flag, or the empty string if the
+// command has no such flag, e.g. when it is run outside of the import command.
+func stringFlag(cmd *cobra.Command, name string) string {
+	if f := cmd.Flags().Lookup(name); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestInfer(t *testing.T) {
+	var (
+		jctx  = journal.NewContext()
+		monzo = jctx.Account("Assets:Monzo")
+		j     = journal.New(jctx)
+	)
+	j.AddTransaction(journal.TransactionBuilder{
+		Date:        date.Date(2023, 4, 1),
+		Description: "Pret A Manger",
+		Postings: journal.PostingBuilder{
+			Credit:    monzo,
+			Debit:     jctx.TBDAccount(),
+			Commodity: jctx.Commodity("GBP"),
+			Amount:    decimal.RequireFromString("3.9"),
+		}.Build(),
+	}.Build())
+	l := j.ToLedger()
+
+	if err := infer(context.Background(), "testdata/existing.knut", l); err != nil {
+		t.Fatalf("infer() returned unexpected error: %v", err)
+	}
+
+	for _, p := range l.Days[0].Transactions[0].Postings {
+		if p.Account != monzo && p.Account.Name() != "Expenses:Food" {
+			t.Errorf("got account %s, want Expenses:Food", p.Account.Name())
+		}
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// pluginPrefix is the prefix of the names of external importers.
+const pluginPrefix = "knut-importer-"
+
+// pluginVersion is the version of the protocol between knut and external
+// importers.
+const pluginVersion = 1
+
+// pluginRequest is written to the standard input of an external importer.
+type pluginRequest struct {
+	Version int      `json:"version"`
+	Args    []string `json:"args"`
+}
+
+// pluginResponse is read from the standard output of an external importer.
+type pluginResponse struct {
+	Transactions []pluginTransaction `json:"transactions"`
+	Prices       []pluginPrice       `json:"prices"`
+	Assertions   []pluginAssertion   `json:"assertions"`
+}
+
+type pluginTransaction struct {
+	Date        string          `json:"date"`
+	Description string          `json:"description"`
+	Postings    []pluginPosting `json:"postings"`
+}
+
+type pluginPosting struct {
+	Credit    string          `json:"credit"`
+	Debit     string          `json:"debit"`
+	Amount    decimal.Decimal `json:"amount"`
+	Commodity string          `json:"commodity"`
+}
+
+type pluginPrice struct {
+	Date      string          `json:"date"`
+	Commodity string          `json:"commodity"`
+	Target    string          `json:"target"`
+	Price     decimal.Decimal `json:"price"`
+}
+
+type pluginAssertion struct {
+	Date      string          `json:"date"`
+	Account   string          `json:"account"`
+	Amount    decimal.Decimal `json:"amount"`
+	Commodity string          `json:"commodity"`
+}
+
+// discoverPlugins returns the paths of the external importers on the PATH,
+// keyed by importer name. Earlier directories take precedence.
+func discoverPlugins() map[string]string {
+	windows := runtime.GOOS == "windows"
+	pathext := os.Getenv("PATHEXT")
+	res := make(map[string]string)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if windows {
+				var ok bool
+				if name, ok = trimExecutableExt(name, pathext); !ok {
+					continue
+				}
+			}
+			if !strings.HasPrefix(name, pluginPrefix) || len(name) == len(pluginPrefix) {
+				continue
+			}
+			name = strings.TrimPrefix(name, pluginPrefix)
+			if _, ok := res[name]; ok {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			info, err := os.Stat(path)
+			if err != nil || info.IsDir() || !windows && info.Mode()&0111 == 0 {
+				continue
+			}
+			res[name] = path
+		}
+	}
+	return res
+}
+
+// trimExecutableExt removes the extension from the file name and reports
+// whether it is one of the executable extensions in pathext, which is
+// formatted like PATHEXT. Windows has no executable bit, so executables are
+// recognized by their extension.
+func trimExecutableExt(name, pathext string) (string, bool) {
+	if pathext == "" {
+		pathext = ".com;.exe;.bat;.cmd"
+	}
+	ext := filepath.Ext(name)
+	if ext == "" {
+		return name, false
+	}
+	for _, e := range strings.Split(pathext, ";") {
+		if strings.EqualFold(e, ext) {
+			return strings.TrimSuffix(name, ext), true
+		}
+	}
+	return name, false
+}
+
+// addPlugins adds a command for each external importer which does not
+// clash with an existing command.
+func addPlugins(cmd *cobra.Command) {
+	plugins := discoverPlugins()
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	existing := make(map[string]bool)
+	for _, c := range cmd.Commands() {
+		existing[c.Name()] = true
+	}
+	for _, name := range names {
+		if existing[name] {
+			continue
+		}
+		cmd.AddCommand(createPluginCmd(name, plugins[name]))
+	}
+}
+
+// runPluginCmd is run by the import command if no built-in importer matches
+// the arguments. Only then are the external importers discovered, such that
+// other commands do not scan the PATH.
+func runPluginCmd(cmd *cobra.Command, args []string) error {
+	addPlugins(cmd)
+	c, rest, err := cmd.Find(args)
+	if err != nil {
+		return err
+	}
+	if c == cmd {
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "-") {
+				return fmt.Errorf("unknown importer %q for %q", arg, cmd.CommandPath())
+			}
+		}
+		return cmd.Help()
+	}
+	c.SetContext(cmd.Context())
+	return c.RunE(c, rest)
+}
+
+func createPluginCmd(name, path string) *cobra.Command {
+	return &cobra.Command{
+		Use:   name,
+		Short: fmt.Sprintf("Import using the external importer %s", filepath.Base(path)),
+		Long: fmt.Sprintf(`Run the external importer %s with the given arguments. The importer
+receives a JSON request with the arguments on standard input and writes the imported
+directives as JSON to standard output.`, path),
+
+		DisableFlagParsing: true,
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			args, err := parseInheritedFlags(cmd, args)
+			if err != nil {
+				return err
+			}
+			l, err := runPlugin(cmd, path, args)
+			if err != nil {
+				return err
+			}
+			return Print(cmd, l)
+		},
+	}
+}
+
+// parseInheritedFlags sets the flags of the import command, which cobra
+// does not parse as flag parsing is disabled for external importers, and
+// returns the remaining arguments. Arguments after "--" are not parsed.
+func parseInheritedFlags(cmd *cobra.Command, args []string) ([]string, error) {
+	var res []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(res, args[i+1:]...), nil
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		f := cmd.InheritedFlags().Lookup(name)
+		if !strings.HasPrefix(arg, "--") || f == nil {
+			res = append(res, arg)
+			continue
+		}
+		if !hasValue {
+			if f.NoOptDefVal != "" {
+				value = f.NoOptDefVal
+			} else if i+1 < len(args) {
+				i++
+				value = args[i]
+			} else {
+				return nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+		}
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// runPlugin runs the external importer at path and converts its response
+// into a ledger.
+func runPlugin(cmd *cobra.Command, path string, args []string) (*journal.Ledger, error) {
+	req, err := json.Marshal(pluginRequest{Version: pluginVersion, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	var stdout bytes.Buffer
+	c := exec.CommandContext(cmd.Context(), path, args...)
+	c.Stdin = bytes.NewReader(req)
+	c.Stdout = &stdout
+	c.Stderr = cmd.ErrOrStderr()
+	if err := c.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	var res pluginResponse
+	dec := json.NewDecoder(&stdout)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&res); err != nil {
+		return nil, fmt.Errorf("%s: invalid response: %w", filepath.Base(path), err)
+	}
+	j, err := res.toJournal(journal.NewContext())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return j.ToLedger(), nil
+}
+
+func (r *pluginResponse) toJournal(jctx journal.Context) (*journal.Journal, error) {
+	j := journal.New(jctx)
+	for i, t := range r.Transactions {
+		d, err := time.Parse("2006-01-02", t.Date)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i+1, err)
+		}
+		var pbs journal.PostingBuilders
+		for _, p := range t.Postings {
+			pb := journal.PostingBuilder{Amount: p.Amount}
+			if pb.Credit, err = jctx.GetAccount(p.Credit); err != nil {
+				return nil, fmt.Errorf("transaction %d: %w", i+1, err)
+			}
+			if pb.Debit, err = jctx.GetAccount(p.Debit); err != nil {
+				return nil, fmt.Errorf("transaction %d: %w", i+1, err)
+			}
+			if pb.Commodity, err = jctx.GetCommodity(p.Commodity); err != nil {
+				return nil, fmt.Errorf("transaction %d: %w", i+1, err)
+			}
+			pbs = append(pbs, pb)
+		}
+		if len(pbs) == 0 {
+			return nil, fmt.Errorf("transaction %d has no postings", i+1)
+		}
+		j.AddTransaction(journal.TransactionBuilder{
+			Date:        d,
+			Description: t.Description,
+			Postings:    pbs.Build(),
+		}.Build())
+	}
+	for i, p := range r.Prices {
+		d, err := time.Parse("2006-01-02", p.Date)
+		if err != nil {
+			return nil, fmt.Errorf("price %d: %w", i+1, err)
+		}
+		res := &journal.Price{Date: d, Price: p.Price}
+		if res.Commodity, err = jctx.GetCommodity(p.Commodity); err != nil {
+			return nil, fmt.Errorf("price %d: %w", i+1, err)
+		}
+		if res.Target, err = jctx.GetCommodity(p.Target); err != nil {
+			return nil, fmt.Errorf("price %d: %w", i+1, err)
+		}
+		j.AddPrice(res)
+	}
+	for i, a := range r.Assertions {
+		d, err := time.Parse("2006-01-02", a.Date)
+		if err != nil {
+			return nil, fmt.Errorf("assertion %d: %w", i+1, err)
+		}
+		res := &journal.Assertion{Date: d, Amount: a.Amount}
+		if res.Account, err = jctx.GetAccount(a.Account); err != nil {
+			return nil, fmt.Errorf("assertion %d: %w", i+1, err)
+		}
+		if res.Commodity, err = jctx.GetCommodity(a.Commodity); err != nil {
+			return nil, fmt.Errorf("assertion %d: %w", i+1, err)
+		}
+		j.AddAssertion(res)
+	}
+	return j, nil
+}
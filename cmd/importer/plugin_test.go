@@ -0,0 +1,120 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const pluginScript = `#!/bin/sh
+# echoes the request on stderr and returns a fixed response
+cat >&2
+cat <<'END'
+{
+  "transactions": [
+    {
+      "date": "2024-02-01",
+      "description": "Coffee $1",
+      "postings": [
+        {"credit": "Assets:Wallet", "debit": "Expenses:TBD", "amount": "4.50", "commodity": "CHF"}
+      ]
+    }
+  ],
+  "assertions": [
+    {"date": "2024-02-02", "account": "Assets:Wallet", "amount": "95.50", "commodity": "CHF"}
+  ]
+}
+END
+`
+
+func TestPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "knut-importer-test"), []byte(pluginScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// not executable
+	if err := os.WriteFile(filepath.Join(dir, "knut-importer-other"), []byte(pluginScript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	var (
+		cmd            = CreateCmd()
+		stdout, stderr bytes.Buffer
+	)
+	if c, _, err := cmd.Find([]string{"test"}); err == nil && c.Name() == "test" {
+		t.Errorf("discovered plugins when creating the command")
+	}
+	cmd.SetArgs([]string{"test", "--journal", "nonexistent.knut", "--account", "Assets:Wallet", "--", "--journal"})
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+
+	err := cmd.Execute()
+
+	if err == nil {
+		t.Fatal("expected an error for the nonexistent journal, got nil")
+	}
+	cmd = CreateCmd()
+	cmd.SetArgs([]string{"test", "--account", "Assets:Wallet", "--", "--journal"})
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+	stdout.Reset()
+	stderr.Reset()
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	want := `2024-02-01 "Coffee $1"
+Assets:Wallet Expenses:TBD         4.5 CHF
+
+2024-02-02 balance Assets:Wallet 95.5 CHF
+
+`
+	if diff := cmp.Diff(want, stdout.String()); diff != "" {
+		t.Errorf("unexpected output (-want/+got):\n%s", diff)
+	}
+	if diff := cmp.Diff(`{"version":1,"args":["--account","Assets:Wallet","--journal"]}`, stderr.String()); diff != "" {
+		t.Errorf("unexpected request (-want/+got):\n%s", diff)
+	}
+	if c, _, err := cmd.Find([]string{"other"}); err == nil && c.Name() == "other" {
+		t.Errorf("found non-executable plugin")
+	}
+}
+
+func TestTrimExecutableExt(t *testing.T) {
+	for _, test := range []struct {
+		name, pathext string
+		want          string
+		wantOK        bool
+	}{
+		{"knut-importer-test.exe", "", "knut-importer-test", true},
+		{"knut-importer-test.EXE", ".COM;.EXE", "knut-importer-test", true},
+		{"knut-importer-test.ps1", ".COM;.EXE;.PS1", "knut-importer-test", true},
+		{"knut-importer-test.txt", "", "knut-importer-test.txt", false},
+		{"knut-importer-test", "", "knut-importer-test", false},
+	} {
+		got, ok := trimExecutableExt(test.name, test.pathext)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("trimExecutableExt(%q, %q) = %q, %t, want %q, %t", test.name, test.pathext, got, ok, test.want, test.wantOK)
+		}
+	}
+}
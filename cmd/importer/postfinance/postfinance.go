@@ -49,11 +49,13 @@ func CreateCmd() *cobra.Command {
 }
 
 type runner struct {
-	accountFlag flags.AccountFlag
+	accountFlag    flags.AccountFlag
+	closingBalance bool
 }
 
 func (r *runner) setupFlags(cmd *cobra.Command) {
 	cmd.Flags().VarP(&r.accountFlag, "account", "a", "account name")
+	cmd.Flags().BoolVar(&r.closingBalance, "closing-balance", false, "add a balance assertion for the closing balance of the statement")
 	cmd.MarkFlagRequired("account")
 }
 
@@ -76,10 +78,10 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 	if err = p.parse(); err != nil {
 		return err
 	}
-	out := bufio.NewWriter(cmd.OutOrStdout())
-	defer out.Flush()
-	_, err = journal.NewPrinter().PrintLedger(out, p.journal.ToLedger())
-	return err
+	if r.closingBalance {
+		p.addClosingBalance()
+	}
+	return importer.Print(cmd, p.journal.ToLedger())
 }
 
 func init() {
@@ -93,6 +95,11 @@ type Parser struct {
 	journal *journal.Journal
 
 	currency *journal.Commodity
+
+	// the date of the latest booking and the first balance
+	// reported on or before it
+	last    time.Time
+	closing *decimal.Decimal
 }
 
 func (p *Parser) parse() error {
@@ -174,6 +181,9 @@ func (p *Parser) readBookingLine(l []string) error {
 	if amount, err = parseAmount(l); err != nil {
 		return err
 	}
+	if err = p.parseBalance(date, l); err != nil {
+		return err
+	}
 	p.journal.AddTransaction(journal.TransactionBuilder{
 		Date:        date,
 		Description: strings.TrimSpace(l[bfAvisierungstext]),
@@ -187,6 +197,38 @@ func (p *Parser) readBookingLine(l []string) error {
 	return nil
 }
 
+// parseBalance records the balance of the latest booking line which
+// has one. Bookings are listed in reverse chronological order, and only
+// the last booking of a day carries the balance.
+func (p *Parser) parseBalance(date time.Time, l []string) error {
+	if date.After(p.last) {
+		p.last = date
+	}
+	if p.closing != nil || len(l[bfSaldoInCHF]) == 0 {
+		return nil
+	}
+	saldo, err := decimal.NewFromString(l[bfSaldoInCHF])
+	if err != nil {
+		return err
+	}
+	p.closing = &saldo
+	return nil
+}
+
+// addClosingBalance adds a balance assertion for the closing balance,
+// dated the day of the latest booking, which is the end of the statement.
+func (p *Parser) addClosingBalance() {
+	if p.closing == nil {
+		return
+	}
+	p.journal.AddAssertion(&journal.Assertion{
+		Date:      p.last,
+		Account:   p.account,
+		Amount:    *p.closing,
+		Commodity: p.currency,
+	})
+}
+
 func parseAmount(l []string) (decimal.Decimal, error) {
 	var (
 		amount decimal.Decimal
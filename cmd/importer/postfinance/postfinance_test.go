@@ -25,20 +25,24 @@ import (
 )
 
 func TestGolden(t *testing.T) {
-	tests := []string{
-		"example1",
+	tests := []struct {
+		name, input string
+		flags       []string
+	}{
+		{name: "example1", input: "example1"},
+		{name: "example1_closing", input: "example1", flags: []string{"--closing-balance"}},
 	}
 	for _, test := range tests {
 		test := test
-		t.Run(test, func(t *testing.T) {
+		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
-			args := []string{
+			args := append([]string{
 				"--account",
 				"Assets:Postfinance",
-				path.Join("testdata", fmt.Sprintf("%s.input", test)),
-			}
+				path.Join("testdata", fmt.Sprintf("%s.input", test.input)),
+			}, test.flags...)
 			got := cmdtest.Run(t, CreateCmd(), args)
-			goldie.New(t).Assert(t, test, got)
+			goldie.New(t).Assert(t, test.name, got)
 		})
 	}
 }
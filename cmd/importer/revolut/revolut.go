@@ -28,6 +28,7 @@ import (
 
 	"github.com/sboehler/knut/cmd/flags"
 	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/common/csvkit"
 	"github.com/sboehler/knut/lib/journal"
 )
 
@@ -79,10 +80,7 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 	if err = p.parse(); err != nil {
 		return err
 	}
-	out := bufio.NewWriter(cmd.OutOrStdout())
-	defer out.Flush()
-	_, err = journal.NewPrinter().PrintLedger(out, p.journal.ToLedger())
-	return err
+	return importer.Print(cmd, p.journal.ToLedger())
 }
 
 type parser struct {
@@ -165,7 +163,7 @@ func (p *parser) parseBooking(r []string) error {
 		return err
 	}
 	if date != p.date {
-		balance, err := parseDecimal(r[6])
+		balance, err := csvkit.Swiss.ParseDecimal(r[6])
 		if err != nil {
 			return err
 		}
@@ -198,7 +196,7 @@ func (p *parser) parseBooking(r []string) error {
 	default:
 		return fmt.Errorf("invalid record with two amounts: %v", r)
 	}
-	if amount, err = parseDecimal(r[field]); err != nil {
+	if amount, err = csvkit.Swiss.ParseDecimal(r[field]); err != nil {
 		return err
 	}
 	amount = amount.Mul(sign)
@@ -271,13 +269,8 @@ func (p *parser) parseCombiField(f string) (*journal.Commodity, decimal.Decimal,
 	if otherCommodity, err = p.journal.Context.GetCommodity(fs[0]); err != nil {
 		return nil, decimal.Decimal{}, err
 	}
-	if otherAmount, err = parseDecimal(fs[1]); err != nil {
+	if otherAmount, err = csvkit.Swiss.ParseDecimal(fs[1]); err != nil {
 		return nil, decimal.Decimal{}, err
 	}
 	return otherCommodity, otherAmount, nil
 }
-
-func parseDecimal(s string) (decimal.Decimal, error) {
-	s = strings.ReplaceAll(s, "'", "")
-	return decimal.NewFromString(s)
-}
@@ -83,10 +83,7 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 			return err
 		}
 	}
-	out := bufio.NewWriter(cmd.OutOrStdout())
-	defer out.Flush()
-	_, err = journal.NewPrinter().PrintLedger(out, a.ToLedger())
-	return err
+	return importer.Print(cmd, a.ToLedger())
 }
 
 type parser struct {
@@ -0,0 +1,226 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package starling
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	cmd := &cobra.Command{
+		Use:   "uk.starling",
+		Short: "Import Starling CSV account statements",
+		Long: `Download the statement as CSV from the Starling app or web interface. Transfers to and from spaces
+are booked against a sub-account of the target account named after the space, unless a different
+account is given with --space.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		RunE: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+func init() {
+	importer.Register(CreateCmd)
+}
+
+type runner struct {
+	account flags.AccountFlag
+	spaces  map[string]string
+}
+
+func (r *runner) setupFlags(cmd *cobra.Command) {
+	cmd.Flags().VarP(&r.account, "account", "a", "account name")
+	cmd.Flags().StringToStringVarP(&r.spaces, "space", "s", nil, "<space name>=<account> mapping for space transfers")
+	cmd.MarkFlagRequired("account")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) error {
+	var (
+		ctx = journal.NewContext()
+		f   *bufio.Reader
+		err error
+	)
+	if f, err = flags.OpenFile(args[0]); err != nil {
+		return err
+	}
+	p := parser{
+		reader:  csv.NewReader(f),
+		journal: journal.New(ctx),
+		spaces:  make(map[string]*journal.Account),
+	}
+	if p.account, err = r.account.Value(ctx); err != nil {
+		return err
+	}
+	for name, account := range r.spaces {
+		if p.spaces[name], err = ctx.GetAccount(account); err != nil {
+			return err
+		}
+	}
+	if err = p.parse(); err != nil {
+		return err
+	}
+	return importer.Print(cmd, p.journal.ToLedger())
+}
+
+type parser struct {
+	reader   *csv.Reader
+	account  *journal.Account
+	spaces   map[string]*journal.Account
+	journal  *journal.Journal
+	currency *journal.Commodity
+	balance  journal.Amounts
+}
+
+func (p *parser) parse() error {
+	p.reader.TrimLeadingSpace = true
+	p.reader.FieldsPerRecord = 8
+	p.balance = make(journal.Amounts)
+	if err := p.parseHeader(); err != nil {
+		return err
+	}
+	for {
+		err := p.parseBooking()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	p.addBalances()
+	return nil
+}
+
+type bookingField int
+
+const (
+	bfDate bookingField = iota
+	bfCounterParty
+	bfReference
+	bfType
+	bfAmount
+	bfBalance
+	bfSpendingCategory
+	bfNotes
+)
+
+var amountHeader = regexp.MustCompile(`^Amount \((\w+)\)$`)
+
+func (p *parser) parseHeader() error {
+	r, err := p.reader.Read()
+	if err != nil {
+		return err
+	}
+	if r[bfDate] != "Date" || r[bfCounterParty] != "Counter Party" || r[bfType] != "Type" {
+		return fmt.Errorf("invalid header: %v", r)
+	}
+	m := amountHeader.FindStringSubmatch(r[bfAmount])
+	if m == nil {
+		return fmt.Errorf("invalid amount header: %q", r[bfAmount])
+	}
+	p.currency, err = p.journal.Context.GetCommodity(m[1])
+	return err
+}
+
+func (p *parser) parseBooking() error {
+	r, err := p.reader.Read()
+	if err != nil {
+		return err
+	}
+	var (
+		d      time.Time
+		amt    decimal.Decimal
+		bal    decimal.Decimal
+		credit = p.journal.Context.TBDAccount()
+		desc   = strings.TrimSpace(r[bfCounterParty])
+	)
+	if d, err = time.Parse("02/01/2006", r[bfDate]); err != nil {
+		return fmt.Errorf("invalid date in row %v: %w", r, err)
+	}
+	if amt, err = decimal.NewFromString(r[bfAmount]); err != nil {
+		return fmt.Errorf("invalid amount in row %v: %w", r, err)
+	}
+	if bal, err = decimal.NewFromString(r[bfBalance]); err != nil {
+		return fmt.Errorf("invalid balance in row %v: %w", r, err)
+	}
+	if r[bfType] == "INTERNAL TRANSFER" {
+		if credit, err = p.spaceAccount(desc); err != nil {
+			return err
+		}
+		desc = fmt.Sprintf("Space transfer %s", desc)
+	} else if ref := strings.TrimSpace(r[bfReference]); len(ref) > 0 {
+		desc = fmt.Sprintf("%s %s", desc, ref)
+	}
+	p.journal.AddTransaction(journal.TransactionBuilder{
+		Date:        d,
+		Description: desc,
+		Postings: journal.PostingBuilder{
+			Credit:    credit,
+			Debit:     p.account,
+			Commodity: p.currency,
+			Amount:    amt,
+		}.Build(),
+	}.Build())
+	p.balance[journal.DateKey(d)] = bal
+	return nil
+}
+
+// spaceAccount returns the account configured for the given space, or a
+// sub-account of the target account named after the space.
+func (p *parser) spaceAccount(name string) (*journal.Account, error) {
+	if a, ok := p.spaces[name]; ok {
+		return a, nil
+	}
+	segment := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+	return p.journal.Context.GetAccount(fmt.Sprintf("%s:%s", p.account.Name(), segment))
+}
+
+// addBalances adds a balance assertion for each day. Starling lists the
+// transactions in chronological order, so the last balance seen for a day
+// is the closing balance.
+func (p *parser) addBalances() {
+	for k, bal := range p.balance {
+		p.journal.AddAssertion(&journal.Assertion{
+			Date:      k.Date,
+			Commodity: p.currency,
+			Amount:    bal,
+			Account:   p.account,
+		})
+	}
+}
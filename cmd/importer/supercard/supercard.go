@@ -25,10 +25,10 @@ import (
 
 	"github.com/shopspring/decimal"
 	"github.com/spf13/cobra"
-	"golang.org/x/text/encoding/charmap"
 
 	"github.com/sboehler/knut/cmd/flags"
 	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/common/csvkit"
 	"github.com/sboehler/knut/lib/journal"
 )
 
@@ -71,9 +71,11 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	p := parser{
-		reader:  csv.NewReader(charmap.ISO8859_1.NewDecoder().Reader(f)),
 		builder: journal.New(ctx),
 	}
+	if p.reader, err = csvkit.NewReader(f); err != nil {
+		return err
+	}
 
 	if p.account, err = r.account.Value(ctx); err != nil {
 		return err
@@ -81,10 +83,7 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 	if err = p.parse(); err != nil {
 		return err
 	}
-	out := bufio.NewWriter(cmd.OutOrStdout())
-	defer out.Flush()
-	_, err = journal.NewPrinter().PrintLedger(out, p.builder.ToLedger())
-	return err
+	return importer.Print(cmd, p.builder.ToLedger())
 }
 
 type parser struct {
@@ -28,6 +28,7 @@ import (
 
 	"github.com/sboehler/knut/cmd/flags"
 	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/common/csvkit"
 	"github.com/sboehler/knut/lib/journal"
 )
 
@@ -37,7 +38,8 @@ func CreateCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "ch.swisscard",
 		Short: "Import Swisscard credit card statements",
-		Long:  `Download the CSV file from their account management tool.`,
+		Long: `Download the CSV file from their account management tool. Both the legacy export and the
+current export, which contains the amounts in foreign currency, are supported.`,
 
 		Args: cobra.ExactValidArgs(1),
 
@@ -52,13 +54,14 @@ func init() {
 }
 
 type runner struct {
-	account flags.AccountFlag
+	account     flags.AccountFlag
+	postingDate bool
 }
 
 func (r *runner) setupFlags(cmd *cobra.Command) {
 	cmd.Flags().VarP(&r.account, "account", "a", "account name")
 	cmd.MarkFlagRequired("account")
-
+	cmd.Flags().BoolVar(&r.postingDate, "posting-date", false, "use the posting date instead of the transaction date")
 }
 
 func (r *runner) run(cmd *cobra.Command, args []string) error {
@@ -71,8 +74,9 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	p := parser{
-		reader:  csv.NewReader(f),
-		builder: journal.New(ctx),
+		reader:      csv.NewReader(f),
+		builder:     journal.New(ctx),
+		postingDate: r.postingDate,
 	}
 	if p.account, err = r.account.Value(ctx); err != nil {
 		return err
@@ -80,16 +84,18 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 	if err = p.parse(); err != nil {
 		return err
 	}
-	w := bufio.NewWriter(cmd.OutOrStdout())
-	defer w.Flush()
-	_, err = journal.NewPrinter().PrintLedger(w, p.builder.ToLedger())
-	return err
+	return importer.Print(cmd, p.builder.ToLedger())
 }
 
 type parser struct {
-	reader  *csv.Reader
-	account *journal.Account
-	builder *journal.Journal
+	reader      *csv.Reader
+	account     *journal.Account
+	builder     *journal.Journal
+	postingDate bool
+
+	// columns maps the fields of the current export to their column
+	// index. It is nil for the legacy export.
+	columns map[field]int
 }
 
 func (p *parser) parse() error {
@@ -110,6 +116,12 @@ func (p *parser) readLine() error {
 	if err != nil {
 		return err
 	}
+	if ok, err := p.parseHeader(r); ok || err != nil {
+		return err
+	}
+	if p.columns != nil {
+		return p.parseExportBooking(r)
+	}
 	if ok, err := p.parseBooking(r); ok || err != nil {
 		return err
 	}
@@ -118,8 +130,6 @@ func (p *parser) readLine() error {
 
 var dateRegex = regexp.MustCompile(`\d\d.\d\d.\d\d\d\d`)
 
-var replacer = strings.NewReplacer("CHF", "", "'", "")
-
 func (p *parser) parseBooking(r []string) (bool, error) {
 	if !dateRegex.MatchString(r[0]) || !dateRegex.MatchString(r[1]) {
 		return false, nil
@@ -141,10 +151,10 @@ func (p *parser) parseBooking(r []string) (bool, error) {
 		amt  decimal.Decimal
 		d    time.Time
 	)
-	if d, err = time.Parse("02.01.2006", r[0]); err != nil {
+	if d, err = p.parseDate(r); err != nil {
 		return false, err
 	}
-	if amt, err = decimal.NewFromString(replacer.Replace(r[3])); err != nil {
+	if amt, err = csvkit.Swiss.ParseDecimal(strings.ReplaceAll(r[3], "CHF", "")); err != nil {
 		return false, err
 	}
 	if chf, err = p.builder.Context.GetCommodity("CHF"); err != nil {
@@ -162,3 +172,121 @@ func (p *parser) parseBooking(r []string) (bool, error) {
 	}.Build())
 	return true, nil
 }
+
+func (p *parser) parseDate(r []string) (time.Time, error) {
+	if p.postingDate {
+		return time.Parse("02.01.2006", r[1])
+	}
+	return time.Parse("02.01.2006", r[0])
+}
+
+type field int
+
+const (
+	fieldTransactionDate field = iota
+	fieldDescription
+	fieldMerchant
+	fieldCurrency
+	fieldAmount
+	fieldForeignCurrency
+	fieldForeignAmount
+	fieldDebitCredit
+	fieldStatus
+)
+
+// headers are the column names of the fields of the current export, in the
+// order of the fields.
+var headers = []string{
+	"transaction date",
+	"description",
+	"merchant",
+	"currency",
+	"amount",
+	"foreign currency",
+	"amount in foreign currency",
+	"debit/credit",
+	"status",
+}
+
+// parseHeader parses the header of the current export, which is told apart
+// from the legacy export by its foreign currency column.
+func (p *parser) parseHeader(r []string) (bool, error) {
+	columns := make(map[field]int)
+	for i, h := range r {
+		for f, name := range headers {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				columns[field(f)] = i
+			}
+		}
+	}
+	if _, ok := columns[fieldForeignCurrency]; !ok {
+		return false, nil
+	}
+	for f, name := range headers {
+		if _, ok := columns[field(f)]; !ok {
+			return false, fmt.Errorf("missing column %q in header %v", name, r)
+		}
+	}
+	if p.postingDate {
+		return false, fmt.Errorf("the export does not contain the posting date")
+	}
+	p.columns = columns
+	return true, nil
+}
+
+// get returns the value of the given field.
+func (p *parser) get(r []string, f field) string {
+	if i := p.columns[f]; i < len(r) {
+		return strings.TrimSpace(r[i])
+	}
+	return ""
+}
+
+func (p *parser) parseExportBooking(r []string) error {
+	if len(r) == 1 && len(strings.TrimSpace(r[0])) == 0 {
+		return nil
+	}
+	if strings.EqualFold(p.get(r, fieldStatus), "pending") {
+		return nil
+	}
+	var (
+		desc      = p.get(r, fieldDescription)
+		commodity *journal.Commodity
+		amount    decimal.Decimal
+		date      time.Time
+		err       error
+	)
+	if merchant := p.get(r, fieldMerchant); len(merchant) > 0 && !strings.Contains(desc, merchant) {
+		desc = fmt.Sprintf("%s %s", desc, merchant)
+	}
+	if cur := p.get(r, fieldForeignCurrency); len(cur) > 0 && cur != p.get(r, fieldCurrency) {
+		desc = fmt.Sprintf("%s %s %s", desc, cur, p.get(r, fieldForeignAmount))
+	}
+	if date, err = time.Parse("02.01.2006", p.get(r, fieldTransactionDate)); err != nil {
+		return err
+	}
+	if amount, err = csvkit.Swiss.ParseDecimal(p.get(r, fieldAmount)); err != nil {
+		return err
+	}
+	switch dc := p.get(r, fieldDebitCredit); {
+	case strings.EqualFold(dc, "debit"):
+	case strings.EqualFold(dc, "credit"):
+		amount = amount.Neg()
+	default:
+		return fmt.Errorf("invalid debit/credit flag %q in row %v", dc, r)
+	}
+	if commodity, err = p.builder.Context.GetCommodity(p.get(r, fieldCurrency)); err != nil {
+		return err
+	}
+	p.builder.AddTransaction(journal.TransactionBuilder{
+		Date:        date,
+		Description: desc,
+		Postings: journal.PostingBuilder{
+			Credit:    p.account,
+			Debit:     p.builder.Context.TBDAccount(),
+			Commodity: commodity,
+			Amount:    amount,
+		}.Build(),
+	}.Build())
+	return nil
+}
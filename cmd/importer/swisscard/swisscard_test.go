@@ -25,22 +25,27 @@ import (
 )
 
 func TestGolden(t *testing.T) {
-	tests := []string{
-		"example1",
+	tests := []struct {
+		name, input string
+		flags       []string
+	}{
+		{name: "example1", input: "example1"},
+		{name: "example1_posting_date", input: "example1", flags: []string{"--posting-date"}},
+		{name: "example2", input: "example2"},
 	}
 	for _, test := range tests {
 		test := test
-		t.Run(test, func(t *testing.T) {
+		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
-			args := []string{
+			args := append([]string{
 				"--account",
 				"Liabilities:CreditCard",
-				path.Join("testdata", fmt.Sprintf("%s.input", test)),
-			}
+				path.Join("testdata", fmt.Sprintf("%s.input", test.input)),
+			}, test.flags...)
 
 			got := cmdtest.Run(t, CreateCmd(), args)
 
-			goldie.New(t).Assert(t, test, got)
+			goldie.New(t).Assert(t, test.name, got)
 		})
 	}
 }
@@ -19,7 +19,6 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
-	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -27,6 +26,7 @@ import (
 
 	"github.com/sboehler/knut/cmd/flags"
 	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/common/csvkit"
 	"github.com/sboehler/knut/lib/common/set"
 	"github.com/sboehler/knut/lib/journal"
 )
@@ -103,10 +103,7 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 	if err = p.parse(); err != nil {
 		return err
 	}
-	out := bufio.NewWriter(cmd.OutOrStdout())
-	defer out.Flush()
-	_, err = journal.NewPrinter().PrintLedger(out, p.builder.ToLedger())
-	return err
+	return importer.Print(cmd, p.builder.ToLedger())
 }
 
 type parser struct {
@@ -205,22 +202,22 @@ func (p *parser) lineToRecord(l []string) (*record, error) {
 			return nil, err
 		}
 	}
-	if r.quantity, err = parseDecimal(l[fAnzahl]); err != nil {
+	if r.quantity, err = csvkit.Swiss.ParseDecimal(l[fAnzahl]); err != nil {
 		return nil, err
 	}
-	if r.price, err = parseDecimal(l[fStückpreis]); err != nil {
+	if r.price, err = csvkit.Swiss.ParseDecimal(l[fStückpreis]); err != nil {
 		return nil, err
 	}
-	if r.fee, err = parseDecimal(l[fKosten]); err != nil {
+	if r.fee, err = csvkit.Swiss.ParseDecimal(l[fKosten]); err != nil {
 		return nil, err
 	}
-	if r.interest, err = parseDecimal(l[fAufgelaufeneZinsen]); err != nil {
+	if r.interest, err = csvkit.Swiss.ParseDecimal(l[fAufgelaufeneZinsen]); err != nil {
 		return nil, err
 	}
-	if r.netAmount, err = parseDecimal(l[fNettobetrag]); err != nil {
+	if r.netAmount, err = csvkit.Swiss.ParseDecimal(l[fNettobetrag]); err != nil {
 		return nil, err
 	}
-	if r.balance, err = parseDecimal(l[fSaldo]); err != nil {
+	if r.balance, err = csvkit.Swiss.ParseDecimal(l[fSaldo]); err != nil {
 		return nil, err
 	}
 	if r.currency, err = p.builder.Context.GetCommodity(l[fWährung]); err != nil {
@@ -229,10 +226,6 @@ func (p *parser) lineToRecord(l []string) (*record, error) {
 	return &r, nil
 }
 
-func parseDecimal(s string) (decimal.Decimal, error) {
-	return decimal.NewFromString(strings.ReplaceAll(s, "'", ""))
-}
-
 func parseDateFromDateTime(s string) (time.Time, error) {
 	return time.Parse("02-01-2006", s[:10])
 }
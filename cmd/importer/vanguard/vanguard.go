@@ -0,0 +1,312 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vanguard
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/common/csvkit"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	cmd := &cobra.Command{
+		Use:   "us.vanguard",
+		Short: "Import Vanguard brokerage account activity",
+		Long: `Download the transaction history as CSV. Buys, sells and reinvestments are booked against
+the trading account, dividends and capital gain distributions against the dividend account.
+Sweeps into and out of the settlement fund are ignored, all other activity is booked against
+Expenses:TBD.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		RunE: r.run,
+	}
+	r.setupFlags(cmd)
+	return cmd
+}
+
+func init() {
+	importer.Register(CreateCmd)
+}
+
+type runner struct {
+	accountFlag, dividendFlag, feeFlag, tradingFlag flags.AccountFlag
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	c.Flags().VarP(&r.accountFlag, "account", "a", "account name")
+	c.Flags().VarP(&r.dividendFlag, "dividend", "d", "account name of the dividend account")
+	c.Flags().VarP(&r.feeFlag, "fee", "f", "account name of the fee account")
+	c.Flags().VarP(&r.tradingFlag, "trading", "t", "account name of the trading gain / loss account")
+	c.MarkFlagRequired("account")
+	c.MarkFlagRequired("dividend")
+	c.MarkFlagRequired("fee")
+	c.MarkFlagRequired("trading")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) error {
+	var (
+		ctx = journal.NewContext()
+		f   *bufio.Reader
+		err error
+	)
+	if f, err = flags.OpenFile(args[0]); err != nil {
+		return err
+	}
+	p := parser{
+		builder: journal.New(ctx),
+	}
+	if p.reader, err = csvkit.NewReader(f); err != nil {
+		return err
+	}
+	if p.account, err = r.accountFlag.Value(ctx); err != nil {
+		return err
+	}
+	if p.dividend, err = r.dividendFlag.Value(ctx); err != nil {
+		return err
+	}
+	if p.fee, err = r.feeFlag.Value(ctx); err != nil {
+		return err
+	}
+	if p.trading, err = r.tradingFlag.Value(ctx); err != nil {
+		return err
+	}
+	if err = p.parse(); err != nil {
+		return err
+	}
+	return importer.Print(cmd, p.builder.ToLedger())
+}
+
+type parser struct {
+	reader  *csv.Reader
+	builder *journal.Journal
+
+	account, dividend, fee, trading *journal.Account
+
+	// columns maps the header names of the transactions section to
+	// their column index.
+	columns map[string]int
+}
+
+func (p *parser) parse() error {
+	p.reader.FieldsPerRecord = -1
+	p.reader.TrimLeadingSpace = true
+	for {
+		r, err := p.reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if p.columns == nil {
+			// skip the holdings section
+			p.parseHeader(r)
+			continue
+		}
+		if err := p.parseTransaction(r); err != nil {
+			return err
+		}
+	}
+	if p.columns == nil {
+		return fmt.Errorf("no transactions found")
+	}
+	return nil
+}
+
+func (p *parser) parseHeader(r []string) {
+	columns := make(map[string]int)
+	for i, h := range r {
+		columns[strings.TrimSpace(h)] = i
+	}
+	for _, c := range []string{"Trade Date", "Transaction Type", "Symbol", "Shares", "Principal Amount", "Commissions and Fees", "Net Amount"} {
+		if _, ok := columns[c]; !ok {
+			return
+		}
+	}
+	p.columns = columns
+}
+
+// get returns the value of the given column, or "" if it does not exist.
+func (p *parser) get(r []string, column string) string {
+	i, ok := p.columns[column]
+	if !ok || i >= len(r) {
+		return ""
+	}
+	return strings.TrimSpace(r[i])
+}
+
+type transaction struct {
+	date                               time.Time
+	kind, description, symbol          string
+	shares, principal, fees, netAmount decimal.Decimal
+}
+
+func (p *parser) parseTransaction(r []string) error {
+	date, err := time.Parse("2006-01-02", p.get(r, "Trade Date"))
+	if err != nil {
+		// skip empty lines
+		return nil
+	}
+	t := transaction{
+		date:        date,
+		kind:        p.get(r, "Transaction Type"),
+		description: p.get(r, "Transaction Description"),
+		symbol:      p.get(r, "Symbol"),
+	}
+	for _, f := range []struct {
+		column string
+		dest   *decimal.Decimal
+	}{
+		{"Shares", &t.shares},
+		{"Principal Amount", &t.principal},
+		{"Commissions and Fees", &t.fees},
+		{"Net Amount", &t.netAmount},
+	} {
+		if *f.dest, err = parseDecimal(p.get(r, f.column)); err != nil {
+			return err
+		}
+	}
+	if t.description == "" {
+		t.description = t.kind
+	}
+	if t.symbol != "" {
+		t.description = fmt.Sprintf("%s %s", t.description, t.symbol)
+	}
+	switch strings.ToLower(t.kind) {
+	case "buy", "reinvestment":
+		t.shares = t.shares.Abs()
+		return p.addTrade(t)
+	case "sell":
+		t.shares = t.shares.Abs().Neg()
+		return p.addTrade(t)
+	case "dividend", "capital gain (lt)", "capital gain (st)":
+		return p.addDistribution(t)
+	case "sweep in", "sweep out":
+		return nil
+	default:
+		return p.addOther(t)
+	}
+}
+
+func parseDecimal(s string) (decimal.Decimal, error) {
+	if s == "" {
+		return decimal.Zero, nil
+	}
+	return csvkit.English.ParseDecimal(strings.TrimPrefix(s, "$"))
+}
+
+func (p *parser) addTrade(t transaction) error {
+	var (
+		usd, security *journal.Commodity
+		err           error
+	)
+	if usd, err = p.builder.Context.GetCommodity("USD"); err != nil {
+		return err
+	}
+	if security, err = p.builder.Context.GetCommodity(t.symbol); err != nil {
+		return err
+	}
+	postings := journal.PostingBuilders{
+		{
+			Credit:    p.trading,
+			Debit:     p.account,
+			Commodity: security,
+			Amount:    t.shares,
+			Targets:   []*journal.Commodity{security, usd},
+		},
+		{
+			Credit:    p.trading,
+			Debit:     p.account,
+			Commodity: usd,
+			Amount:    t.principal,
+			Targets:   []*journal.Commodity{security, usd},
+		},
+	}
+	if !t.fees.IsZero() {
+		postings = append(postings, journal.PostingBuilder{
+			Credit:    p.account,
+			Debit:     p.fee,
+			Commodity: usd,
+			Amount:    t.fees,
+			Targets:   []*journal.Commodity{security, usd},
+		})
+	}
+	p.builder.AddTransaction(journal.TransactionBuilder{
+		Date:        t.date,
+		Description: t.description,
+		Postings:    postings.Build(),
+	}.Build())
+	return nil
+}
+
+func (p *parser) addDistribution(t transaction) error {
+	var (
+		usd, security *journal.Commodity
+		err           error
+	)
+	if usd, err = p.builder.Context.GetCommodity("USD"); err != nil {
+		return err
+	}
+	if security, err = p.builder.Context.GetCommodity(t.symbol); err != nil {
+		return err
+	}
+	p.builder.AddTransaction(journal.TransactionBuilder{
+		Date:        t.date,
+		Description: t.description,
+		Postings: journal.PostingBuilder{
+			Credit:    p.dividend,
+			Debit:     p.account,
+			Commodity: usd,
+			Amount:    t.netAmount,
+			Targets:   []*journal.Commodity{security},
+		}.Build(),
+	}.Build())
+	return nil
+}
+
+func (p *parser) addOther(t transaction) error {
+	if t.netAmount.IsZero() {
+		return nil
+	}
+	usd, err := p.builder.Context.GetCommodity("USD")
+	if err != nil {
+		return err
+	}
+	p.builder.AddTransaction(journal.TransactionBuilder{
+		Date:        t.date,
+		Description: t.description,
+		Postings: journal.PostingBuilder{
+			Credit:    p.builder.Context.TBDAccount(),
+			Debit:     p.account,
+			Commodity: usd,
+			Amount:    t.netAmount,
+		}.Build(),
+	}.Build())
+	return nil
+}
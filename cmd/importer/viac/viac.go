@@ -104,10 +104,7 @@ func (r *runner) run(cmd *cobra.Command, args []string) error {
 		})
 	}
 
-	out := bufio.NewWriter(cmd.OutOrStdout())
-	defer out.Flush()
-	_, err = journal.NewPrinter().PrintLedger(out, builder.ToLedger())
-	return err
+	return importer.Print(cmd, builder.ToLedger())
 }
 
 type response struct {
@@ -16,20 +16,19 @@ package infer
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
-	"github.com/natefinch/atomic"
 	"github.com/spf13/cobra"
 
 	"github.com/sboehler/knut/cmd/flags"
-	"github.com/sboehler/knut/lib/common/cpr"
 	"github.com/sboehler/knut/lib/journal"
 	"github.com/sboehler/knut/lib/journal/bayes"
 	"github.com/sboehler/knut/lib/journal/format"
+	"github.com/sboehler/knut/lib/journal/infer/rules"
 )
 
 // CreateCmd creates the command.
@@ -39,7 +38,23 @@ func CreateCmd() *cobra.Command {
 		Use:   "infer",
 		Short: "Auto-assign accounts in a journal",
 		Long: `Build a Bayes model using the supplied training file and apply it to replace
-		the indicated account in the target file. Training file and target file may be the same.`,
+		the indicated account in the target file. Training file and target file may be the same.
+
+		With --rules, the rules in the given file, one "<regex> -> <account>" per line, are
+		applied first. The account of the first rule whose regex matches the description of a
+		transaction replaces the indicated account. The Bayes model, if a training file is
+		given, only infers the accounts of the remaining transactions.
+
+		With --min-confidence, transactions are only changed if the probability of the inferred
+		account is at least the given value, and stay on the indicated account otherwise. With
+		--annotate, the postings of such transactions are annotated with a comment listing the
+		three most probable accounts.
+
+		With --interactive, each transaction which is left on the indicated account after the
+		rules is shown together with the most probable accounts, and the account can be
+		confirmed or entered manually. Transactions with a confidence of at least
+		--min-confidence, if given, are inferred without asking. The results are written to the
+		target file in-place.`,
 		Args: cobra.ExactValidArgs(1),
 		Run:  r.run,
 	}
@@ -48,16 +63,23 @@ func CreateCmd() *cobra.Command {
 }
 
 type runner struct {
-	account      flags.AccountFlag
-	trainingFile string
-	inplace      bool
+	account       flags.AccountFlag
+	trainingFile  string
+	rulesFile     string
+	inplace       bool
+	minConfidence float64
+	annotate      bool
+	interactive   bool
 }
 
 func (r *runner) setupFlags(cmd *cobra.Command) {
 	cmd.Flags().VarP(&r.account, "account", "a", "account name")
 	cmd.Flags().BoolVarP(&r.inplace, "inplace", "i", false, "infer the accounts inplace")
 	cmd.Flags().StringVarP(&r.trainingFile, "training-file", "t", "", "the journal file with existing data")
-	cmd.MarkFlagRequired("training-file")
+	cmd.Flags().StringVar(&r.rulesFile, "rules", "", "a file with rules of the form <regex> -> <account>, applied before the model")
+	cmd.Flags().Float64Var(&r.minConfidence, "min-confidence", 0, "the minimum probability of an inferred account, between 0 and 1")
+	cmd.Flags().BoolVar(&r.annotate, "annotate", false, "annotate postings which are left unchanged with the most probable accounts")
+	cmd.Flags().BoolVar(&r.interactive, "interactive", false, "review the inferred accounts interactively and write the results in-place")
 }
 
 func (r *runner) run(cmd *cobra.Command, args []string) {
@@ -74,23 +96,41 @@ func (r *runner) execute(cmd *cobra.Command, args []string) (errors error) {
 		account    *journal.Account
 		err        error
 	)
+	if r.trainingFile == "" && r.rulesFile == "" {
+		return fmt.Errorf("either --training-file or --rules is required")
+	}
+	if r.minConfidence < 0 || r.minConfidence > 1 {
+		return fmt.Errorf("invalid minimum confidence %g, expected a value between 0 and 1", r.minConfidence)
+	}
 	if account, err = r.account.ValueWithDefault(jctx, jctx.Account("Expenses:TBD")); err != nil {
 		return err
 	}
-	model, err := train(cmd.Context(), jctx, r.trainingFile, account)
-	if err != nil {
-		return err
+	var (
+		rs    rules.Rules
+		model *bayes.Model
+	)
+	if r.rulesFile != "" {
+		if rs, err = rules.ParseFile(jctx, r.rulesFile); err != nil {
+			return err
+		}
+	}
+	if r.trainingFile != "" {
+		if model, err = bayes.Train(cmd.Context(), jctx, r.trainingFile, account); err != nil {
+			return err
+		}
 	}
-	directives, err := r.parseAndInfer(cmd.Context(), jctx, model, targetFile, account)
+	var rv *reviewer
+	if r.interactive {
+		rv = newReviewer(jctx, model, cmd.InOrStdin(), cmd.OutOrStdout())
+	}
+	directives, err := r.parseAndInfer(cmd.Context(), jctx, rs, model, rv, targetFile, account)
 	if err != nil {
 		return err
 	}
-	if r.inplace {
-		var buf bytes.Buffer
-		if err := r.writeTo(directives, targetFile, &buf); err != nil {
-			return err
-		}
-		return atomic.WriteFile(targetFile, &buf)
+	if r.inplace || r.interactive {
+		return journal.FileSystem{}.Write(targetFile, func(w io.Writer) error {
+			return r.writeTo(directives, targetFile, w)
+		})
 	} else {
 		out := bufio.NewWriter(cmd.OutOrStdout())
 		if err := r.writeTo(directives, targetFile, out); err != nil {
@@ -100,24 +140,7 @@ func (r *runner) execute(cmd *cobra.Command, args []string) (errors error) {
 	}
 }
 
-func train(ctx context.Context, jctx journal.Context, file string, exclude *journal.Account) (*bayes.Model, error) {
-	var (
-		j = journal.RecursiveParser{Context: jctx, File: file}
-		m = bayes.NewModel(exclude)
-	)
-	err := cpr.Consume(ctx, j.Parse(ctx), func(d any) error {
-		switch t := d.(type) {
-		case error:
-			return t
-		case *journal.Transaction:
-			m.Update(t)
-		}
-		return nil
-	})
-	return m, err
-}
-
-func (r *runner) parseAndInfer(ctx context.Context, jctx journal.Context, model *bayes.Model, targetFile string, account *journal.Account) ([]journal.Directive, error) {
+func (r *runner) parseAndInfer(ctx context.Context, jctx journal.Context, rs rules.Rules, model *bayes.Model, rv *reviewer, targetFile string, account *journal.Account) ([]journal.Directive, error) {
 	p, cls, err := journal.ParserFromPath(jctx, targetFile)
 	if err != nil {
 		return nil, err
@@ -134,7 +157,20 @@ func (r *runner) parseAndInfer(ctx context.Context, jctx journal.Context, model
 		}
 		switch t := d.(type) {
 		case *journal.Transaction:
-			model.Infer(t, account)
+			rs.Infer(t, account)
+			// in interactive mode, only confident accounts are inferred
+			// without asking
+			if model != nil && (rv == nil || r.minConfidence > 0) {
+				model.Infer(t, account, r.minConfidence)
+			}
+			if rv != nil {
+				if err := rv.review(t, account); err != nil {
+					return nil, err
+				}
+			}
+			if model != nil && r.annotate {
+				annotate(model, t, account)
+			}
 			directives = append(directives, t)
 		default:
 			directives = append(directives, d)
@@ -142,6 +178,43 @@ func (r *runner) parseAndInfer(ctx context.Context, jctx journal.Context, model
 	}
 }
 
+// candidatesPrefix starts the comments added by annotate.
+const candidatesPrefix = "candidates:"
+
+// maxCandidates is the number of accounts suggested for a posting.
+const maxCandidates = 3
+
+// annotate adds a comment listing the most probable accounts to the
+// postings of the transaction with the given account. Existing comments
+// are kept, except for the candidates added by earlier runs.
+func annotate(model *bayes.Model, t *journal.Transaction, account *journal.Account) {
+	for i, posting := range t.Postings {
+		if posting.Account != account {
+			continue
+		}
+		cs := model.Candidates(t, posting, account)
+		if len(cs) == 0 {
+			continue
+		}
+		if len(cs) > maxCandidates {
+			cs = cs[:maxCandidates]
+		}
+		var ss []string
+		for _, c := range cs {
+			ss = append(ss, fmt.Sprintf("%s (%.0f%%)", c.Account, 100*c.Probability))
+		}
+		comment := candidatesPrefix + " " + strings.Join(ss, ", ")
+		if prev, _, _ := strings.Cut(posting.Comment, candidatesPrefix); strings.TrimRight(prev, "; ") != "" {
+			comment = strings.TrimRight(prev, "; ") + "; " + comment
+		}
+		other := i + 1
+		if i%2 == 1 {
+			other = i - 1
+		}
+		posting.Comment, t.Postings[other].Comment = comment, comment
+	}
+}
+
 func (r *runner) writeTo(directives []journal.Directive, targetFile string, out io.Writer) error {
 	srcFile, err := os.Open(targetFile)
 	if err != nil {
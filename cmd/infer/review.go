@@ -0,0 +1,152 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package infer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/bayes"
+)
+
+// reviewer asks the user to confirm the suggested account of each posting
+// with the account to be inferred, or to enter another account.
+type reviewer struct {
+	jctx  journal.Context
+	model *bayes.Model
+	in    *bufio.Reader
+	out   io.Writer
+
+	// done is set once the user quits, after which the remaining
+	// postings are left unchanged.
+	done bool
+}
+
+func newReviewer(jctx journal.Context, model *bayes.Model, in io.Reader, out io.Writer) *reviewer {
+	return &reviewer{
+		jctx:  jctx,
+		model: model,
+		in:    bufio.NewReader(in),
+		out:   out,
+	}
+}
+
+// review asks for the accounts of the postings of the transaction which
+// are booked to the given account.
+func (rv *reviewer) review(t *journal.Transaction, tbd *journal.Account) error {
+	for i, posting := range t.Postings {
+		if rv.done {
+			return nil
+		}
+		if posting.Account != tbd {
+			continue
+		}
+		if _, err := fmt.Fprintln(rv.out); err != nil {
+			return err
+		}
+		if _, err := journal.NewPrinter().PrintDirective(rv.out, t); err != nil {
+			return err
+		}
+		var cs []bayes.Candidate
+		if rv.model != nil {
+			cs = rv.model.Candidates(t, posting, tbd)
+		}
+		if len(cs) > maxCandidates {
+			cs = cs[:maxCandidates]
+		}
+		for j, c := range cs {
+			if _, err := fmt.Fprintf(rv.out, "  %d) %s (%.0f%%)\n", j+1, c.Account, 100*c.Probability); err != nil {
+				return err
+			}
+		}
+		account, err := rv.ask(cs)
+		if err != nil {
+			return err
+		}
+		if account != nil {
+			setAccount(t, i, account)
+		}
+	}
+	return nil
+}
+
+// ask reads the choice of the user until it is valid: the number of a
+// candidate, which defaults to the first one, or the name of an account.
+// It returns nil if the user skips the posting or quits.
+func (rv *reviewer) ask(cs []bayes.Candidate) (*journal.Account, error) {
+	for {
+		prompt := "Account name, (s)kip or (q)uit: "
+		if len(cs) > 0 {
+			prompt = fmt.Sprintf("Account [1-%d, default 1], account name, (s)kip or (q)uit: ", len(cs))
+		}
+		if _, err := io.WriteString(rv.out, prompt); err != nil {
+			return nil, err
+		}
+		line, err := rv.in.ReadString('\n')
+		if err == io.EOF && line == "" {
+			rv.done = true
+			_, err := fmt.Fprintln(rv.out)
+			return nil, err
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		switch line {
+		case "s":
+			return nil, nil
+		case "q":
+			rv.done = true
+			return nil, nil
+		case "":
+			if len(cs) > 0 {
+				return cs[0].Account, nil
+			}
+			continue
+		}
+		if n, err := strconv.Atoi(line); err == nil {
+			if n >= 1 && n <= len(cs) {
+				return cs[n-1].Account, nil
+			}
+			if _, err := fmt.Fprintf(rv.out, "invalid choice %d\n", n); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		account, err := rv.jctx.GetAccount(line)
+		if err != nil {
+			if _, err := fmt.Fprintln(rv.out, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return account, nil
+	}
+}
+
+// setAccount books the posting at index i and its counterpart to the
+// given account.
+func setAccount(t *journal.Transaction, i int, account *journal.Account) {
+	t.Postings[i].Account = account
+	if i%2 == 0 {
+		t.Postings[i+1].Other = account
+	} else {
+		t.Postings[i-1].Other = account
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sboehler/knut/lib/lsp"
+	"github.com/spf13/cobra"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "lsp [journal]",
+		Short: "run a language server",
+		Long: `Run a language server for knut journals, which speaks the Language Server Protocol over stdio.
+
+The server publishes the errors of parsing and balancing the journal as diagnostics, completes
+account and commodity names, jumps to the files of include directives and formats documents.
+If a journal is given, all documents are checked as part of it, including unsaved changes of
+open documents. Otherwise, each document is checked as a journal of its own.`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  run,
+	}
+}
+
+func run(cmd *cobra.Command, args []string) {
+	if err := execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func execute(cmd *cobra.Command, args []string) error {
+	var root string
+	if len(args) > 0 {
+		var err error
+		if root, err = filepath.Abs(args[0]); err != nil {
+			return err
+		}
+	}
+	return lsp.New(root).Serve(cmd.Context(), cmd.InOrStdin(), cmd.OutOrStdout())
+}
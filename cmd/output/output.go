@@ -0,0 +1,73 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package output defines the JSON output shared by all commands.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Version is the version of the JSON output. It is incremented whenever
+// the structure of the data of any command changes incompatibly.
+const Version = 1
+
+// Envelope wraps the JSON output of a command.
+type Envelope struct {
+	Version    int               `json:"version"`
+	Command    string            `json:"command"`
+	Parameters map[string]string `json:"parameters"`
+	Args       []string          `json:"args"`
+	Data       any               `json:"data"`
+}
+
+// NewEnvelope creates an envelope for the output of cmd. The parameters
+// are the flags set on the command line.
+func NewEnvelope(cmd *cobra.Command, args []string, data any) Envelope {
+	params := make(map[string]string)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		params[f.Name] = f.Value.String()
+	})
+	if args == nil {
+		args = []string{}
+	}
+	return Envelope{
+		Version:    Version,
+		Command:    strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" "),
+		Parameters: params,
+		Args:       args,
+		Data:       data,
+	}
+}
+
+// WriteJSON writes data wrapped in an envelope as indented JSON.
+func WriteJSON(w io.Writer, cmd *cobra.Command, args []string, data any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(NewEnvelope(cmd, args, data))
+}
+
+// ValidateFormat returns an error if format is neither "text" nor "json".
+func ValidateFormat(format string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("invalid format %q, expected text or json", format)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package payees
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/mapper"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/payees"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	c := &cobra.Command{
+		Use:   "payees",
+		Short: "aggregate expenses by payee",
+		Long: `Aggregate the postings on expense accounts by payee, commodity and period. The payee of a
+transaction is its description, unless it matches one of the --payee rules, which map descriptions
+to payees with a regex, e.g. --payee '(?i)migros -> Migros'. The first matching rule wins.`,
+		Args: cobra.ExactValidArgs(1),
+		Run:  r.run,
+	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	period    flags.PeriodFlag
+	interval  flags.IntervalFlags
+	last      int
+	valuation flags.CommodityFlag
+	accounts  flags.RegexFlag
+	payees    flags.PayeeFlag
+	digits    int32
+	thousands bool
+	color     bool
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	r.period.Setup(c, date.Period{End: date.Today()})
+	r.interval.Setup(c, date.Yearly)
+	c.Flags().IntVar(&r.last, "last", 0, "last n periods")
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity")
+	c.Flags().Var(&r.accounts, "account", "filter accounts with a regex")
+	c.Flags().Var(&r.payees, "payee", "<regex> -> <payee>")
+	c.Flags().Var(r.payees.File(), "payee-file", "read --payee rules from the given file, one per line")
+	c.Flags().Int32Var(&r.digits, "digits", 0, "round to number of digits")
+	c.Flags().BoolVarP(&r.thousands, "thousands", "k", false, "show numbers in units of 1000")
+	c.Flags().BoolVar(&r.color, "color", true, "print output in color")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *runner) execute(cmd *cobra.Command, args []string) (errors error) {
+	jctx := journal.NewContext()
+	valuation, err := r.valuation.Value(jctx)
+	if err != nil {
+		return err
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	period := r.period.Value().Clip(j.Period())
+	dates := r.interval.Dates(period, r.last)
+	start := r.interval.Start(period, dates)
+	rep := payees.New(start, dates)
+	m := journal.KeyMapper{
+		Date:        mapper.Identity[time.Time],
+		Account:     mapper.Identity[*journal.Account],
+		Commodity:   mapper.Identity[*journal.Commodity],
+		Valuation:   mapper.Identity[*journal.Commodity],
+		Description: r.payees.Value().Mapper(),
+	}.Build()
+	if _, err := j.Process(
+		journal.ComputePrices(valuation),
+		journal.Balance(jctx, valuation),
+		journal.Query(journal.FilterAccount(r.accounts.Regex()), m, valuation, rep),
+	); err != nil {
+		return err
+	}
+	out := bufio.NewWriter(cmd.OutOrStdout())
+	defer func() { errors = multierr.Append(errors, out.Flush()) }()
+	tr := table.TextRenderer{
+		Color:     r.color,
+		Thousands: r.thousands,
+		Round:     r.digits,
+	}
+	return tr.Render(payees.Render(dates, rep.Rows()), out)
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plaid
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/natefinch/atomic"
+	"github.com/spf13/cobra"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/cmd/importer"
+	"github.com/sboehler/knut/lib/bankdata/plaid"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	cmd := &cobra.Command{
+		Use:   "plaid <journal>",
+		Short: "Fetch new transactions from Plaid",
+		Long: `Fetch the transactions added since the last run from Plaid and print them as journal entries.
+The sync cursor is stored in .plaid-cursors.json in the directory of the given journal, so that
+subsequent runs only return new transactions. With --dry-run, the cursor is not stored.
+Credentials are read from the PLAID_CLIENT_ID, PLAID_SECRET and PLAID_ACCESS_TOKEN environment
+variables unless given as flags.`,
+
+		Args: cobra.ExactValidArgs(1),
+
+		RunE: r.run,
+	}
+	importer.SetupFlags(cmd)
+	r.setupFlags(cmd)
+	return cmd
+}
+
+type runner struct {
+	account                       flags.AccountFlag
+	environment                   string
+	clientID, secret, accessToken string
+}
+
+func (r *runner) setupFlags(cmd *cobra.Command) {
+	cmd.Flags().VarP(&r.account, "account", "a", "account name")
+	cmd.Flags().StringVar(&r.environment, "environment", "production", "Plaid environment (sandbox, development or production)")
+	cmd.Flags().StringVar(&r.clientID, "client-id", "", "Plaid client ID")
+	cmd.Flags().StringVar(&r.secret, "secret", "", "Plaid secret")
+	cmd.Flags().StringVar(&r.accessToken, "access-token", "", "Plaid access token of the item")
+	cmd.MarkFlagRequired("account")
+}
+
+const cursorFile = ".plaid-cursors.json"
+
+func (r *runner) run(cmd *cobra.Command, args []string) error {
+	var (
+		ctx         = journal.NewContext()
+		clientID    = valueOrEnv(r.clientID, "PLAID_CLIENT_ID")
+		secret      = valueOrEnv(r.secret, "PLAID_SECRET")
+		accessToken = valueOrEnv(r.accessToken, "PLAID_ACCESS_TOKEN")
+		statePath   = filepath.Join(filepath.Dir(args[0]), cursorFile)
+		account     *journal.Account
+		err         error
+	)
+	if len(clientID) == 0 || len(secret) == 0 || len(accessToken) == 0 {
+		return fmt.Errorf("client ID, secret and access token are required")
+	}
+	if account, err = r.account.Value(ctx); err != nil {
+		return err
+	}
+	cursors, err := readCursors(statePath)
+	if err != nil {
+		return err
+	}
+	client := plaid.New(plaid.URL(r.environment), clientID, secret)
+	res, err := client.Sync(accessToken, cursors[account.Name()])
+	if err != nil {
+		return err
+	}
+	j := journal.New(ctx)
+	for _, t := range res.Added {
+		if t.Pending {
+			continue
+		}
+		trx, err := createTransaction(ctx, account, t)
+		if err != nil {
+			return err
+		}
+		j.AddTransaction(trx)
+	}
+	for _, t := range res.Modified {
+		fmt.Fprintf(cmd.ErrOrStderr(), "transaction %s (%s %q) has been modified, please review manually\n", t.TransactionID, t.Date, t.Name)
+	}
+	for _, t := range res.Removed {
+		fmt.Fprintf(cmd.ErrOrStderr(), "transaction %s has been removed, please review manually\n", t.TransactionID)
+	}
+	if err := importer.Print(cmd, j.ToLedger()); err != nil {
+		return err
+	}
+	if importer.DryRun(cmd) {
+		return nil
+	}
+	cursors[account.Name()] = res.NextCursor
+	return writeCursors(statePath, cursors)
+}
+
+func createTransaction(ctx journal.Context, account *journal.Account, t plaid.Transaction) (*journal.Transaction, error) {
+	var (
+		d   time.Time
+		c   *journal.Commodity
+		err error
+	)
+	if d, err = time.Parse("2006-01-02", t.Date); err != nil {
+		return nil, fmt.Errorf("invalid date in transaction %s: %w", t.TransactionID, err)
+	}
+	if c, err = ctx.GetCommodity(t.ISOCurrencyCode); err != nil {
+		return nil, fmt.Errorf("invalid currency in transaction %s: %w", t.TransactionID, err)
+	}
+	desc := t.Name
+	if len(t.MerchantName) > 0 && !strings.Contains(t.Name, t.MerchantName) {
+		desc = fmt.Sprintf("%s %s", t.MerchantName, t.Name)
+	}
+	return journal.TransactionBuilder{
+		Date:        d,
+		Description: desc,
+		Postings: journal.PostingBuilder{
+			Credit:    account,
+			Debit:     ctx.TBDAccount(),
+			Commodity: c,
+			Amount:    t.Amount,
+		}.Build(),
+	}.Build(), nil
+}
+
+func valueOrEnv(v, env string) string {
+	if len(v) > 0 {
+		return v
+	}
+	return os.Getenv(env)
+}
+
+func readCursors(path string) (map[string]string, error) {
+	res := make(map[string]string)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return res, nil
+}
+
+func writeCursors(path string, cursors map[string]string) error {
+	b, err := json.MarshalIndent(cursors, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomic.WriteFile(path, bytes.NewReader(b))
+}
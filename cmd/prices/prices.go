@@ -22,6 +22,9 @@ import (
 	"time"
 
 	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/quotes/cache"
+	"github.com/sboehler/knut/lib/quotes/coingecko"
+	"github.com/sboehler/knut/lib/quotes/ecb"
 	"github.com/sboehler/knut/lib/quotes/yahoo"
 	"github.com/shopspring/decimal"
 	"go.uber.org/multierr"
@@ -34,19 +37,40 @@ import (
 
 // CreateCmd creates the command.
 func CreateCmd() *cobra.Command {
-	return &cobra.Command{
+	var r runner
+	c := &cobra.Command{
 		Use:   "fetch",
-		Short: "Fetch quotes from Yahoo! Finance",
-		Long:  `Fetch quotes from Yahoo! Finance based on the supplied configuration in yaml format. See doc/prices.yaml for an example.`,
+		Short: "Fetch quotes from Yahoo! Finance, the ECB and CoinGecko",
+		Long: `Fetch quotes from Yahoo! Finance, the reference rates of the European Central Bank or crypto
+currency prices from CoinGecko based on the supplied configuration in yaml format, and add the
+missing prices to the configured files. See doc/prices.yaml for an example.
+
+Fetched quotes are kept in a cache, by default in the user's cache directory. Quotes which have
+been fetched less than --max-age ago are taken from the cache, and if fetching fails, the cached
+quotes are used instead.`,
 
 		Args: cobra.ExactValidArgs(1),
 
-		Run: run,
+		Run: r.run,
 	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	cacheDir string
+	maxAge   time.Duration
+	noCache  bool
 }
 
-func run(cmd *cobra.Command, args []string) {
-	if err := execute(cmd, args); err != nil {
+func (r *runner) setupFlags(c *cobra.Command) {
+	c.Flags().StringVar(&r.cacheDir, "cache-dir", "", "directory of the quotes cache (default knut/quotes in the user's cache directory)")
+	c.Flags().DurationVar(&r.maxAge, "max-age", 12*time.Hour, "refetch cached quotes older than the given duration")
+	c.Flags().BoolVar(&r.noCache, "no-cache", false, "do not use the quotes cache")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
 		fmt.Fprintln(cmd.ErrOrStderr(), err)
 		os.Exit(1)
 	}
@@ -54,12 +78,21 @@ func run(cmd *cobra.Command, args []string) {
 
 const concurrency = 5
 
-func execute(cmd *cobra.Command, args []string) error {
+func (r *runner) execute(cmd *cobra.Command, args []string) error {
 	ctx := journal.NewContext()
 	configs, err := readConfig(args[0])
 	if err != nil {
 		return err
 	}
+	var c *cache.Cache
+	if !r.noCache {
+		if r.cacheDir == "" {
+			if r.cacheDir, err = cache.DefaultDir(); err != nil {
+				return err
+			}
+		}
+		c = cache.New(r.cacheDir)
+	}
 	errCh := make(chan error)
 	go func() {
 		defer close(errCh)
@@ -72,8 +105,8 @@ func execute(cmd *cobra.Command, args []string) error {
 
 		for _, cfg := range configs {
 			sema <- true
-			go func(c config) {
-				if err := fetch(ctx, args[0], c); err != nil {
+			go func(cfg config) {
+				if err := fetch(ctx, c, r.maxAge, args[0], cfg); err != nil {
 					errCh <- err
 				}
 				bar.Increment()
@@ -91,13 +124,13 @@ func execute(cmd *cobra.Command, args []string) error {
 	return errors
 }
 
-func fetch(jctx journal.Context, f string, cfg config) error {
+func fetch(jctx journal.Context, c *cache.Cache, maxAge time.Duration, f string, cfg config) error {
 	absPath := filepath.Join(filepath.Dir(f), cfg.File)
 	l, err := readFile(jctx, absPath)
 	if err != nil {
 		return err
 	}
-	if err := fetchPrices(jctx, cfg, time.Now().AddDate(-1, 0, 0), time.Now(), l); err != nil {
+	if err := fetchPrices(jctx, c, maxAge, cfg, time.Now().AddDate(-1, 0, 0), time.Now(), l); err != nil {
 		return err
 	}
 	if err := writeFile(jctx, l, absPath); err != nil {
@@ -118,6 +151,11 @@ func readConfig(path string) ([]config, error) {
 	if err := dec.Decode(&t); err != nil {
 		return nil, err
 	}
+	for _, cfg := range t {
+		if err := cfg.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
 	return t, nil
 }
 
@@ -144,14 +182,23 @@ func readFile(ctx journal.Context, filepath string) (res map[time.Time]*journal.
 	}
 }
 
-func fetchPrices(ctx journal.Context, cfg config, t0, t1 time.Time, results map[time.Time]*journal.Price) error {
+// fetchPrices adds the prices which are missing in results. If c is not
+// nil, the quotes are fetched through the cache.
+func fetchPrices(ctx journal.Context, c *cache.Cache, maxAge time.Duration, cfg config, t0, t1 time.Time, results map[time.Time]*journal.Price) error {
 	var (
-		c                 = yahoo.New()
-		quotes            []yahoo.Quote
+		quotes            map[time.Time]decimal.Decimal
 		commodity, target *journal.Commodity
 		err               error
 	)
-	if quotes, err = c.Fetch(cfg.Symbol, t0, t1); err != nil {
+	fetch := func() (map[time.Time]decimal.Decimal, error) {
+		return fetchQuotes(cfg, t0, t1)
+	}
+	if c == nil {
+		quotes, err = fetch()
+	} else {
+		quotes, err = c.Fetch(cfg.key(), maxAge, fetch)
+	}
+	if err != nil {
 		return err
 	}
 	if commodity, err = ctx.GetCommodity(cfg.Commodity); err != nil {
@@ -160,17 +207,60 @@ func fetchPrices(ctx journal.Context, cfg config, t0, t1 time.Time, results map[
 	if target, err = ctx.GetCommodity(cfg.TargetCommodity); err != nil {
 		return err
 	}
-	for _, i := range quotes {
-		results[i.Date] = &journal.Price{
-			Date:      i.Date,
+	for d, price := range quotes {
+		if _, ok := results[d]; ok {
+			continue
+		}
+		results[d] = &journal.Price{
+			Date:      d,
 			Commodity: commodity,
 			Target:    target,
-			Price:     decimal.NewFromFloat(i.Close),
+			Price:     price,
 		}
 	}
 	return nil
 }
 
+// fetchQuotes fetches the prices of the commodity in the target commodity
+// from the source of the configuration.
+func fetchQuotes(cfg config, t0, t1 time.Time) (map[time.Time]decimal.Decimal, error) {
+	res := make(map[time.Time]decimal.Decimal)
+	switch cfg.Source {
+	case sourceYahoo, "":
+		c := yahoo.New()
+		quotes, err := c.Fetch(cfg.Symbol, t0, t1)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range quotes {
+			res[q.Date] = decimal.NewFromFloat(q.Close)
+		}
+	case sourceECB:
+		c := ecb.New()
+		quotes, err := c.Fetch(cfg.currency(), t0, t1)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range quotes {
+			if cfg.Commodity == euro {
+				res[q.Date] = q.Rate
+			} else {
+				res[q.Date] = decimal.NewFromInt(1).DivRound(q.Rate, ecbDigits)
+			}
+		}
+	case sourceCoinGecko:
+		c := coingecko.New()
+		quotes, err := c.Fetch(cfg.Symbol, cfg.TargetCommodity, t0, t1)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range quotes {
+			res[q.Date] = q.Price
+		}
+	}
+	return res, nil
+}
+
 func writeFile(ctx journal.Context, prices map[time.Time]*journal.Price, filepath string) error {
 	b := journal.New(ctx)
 	for _, price := range prices {
@@ -187,9 +277,60 @@ func writeFile(ctx journal.Context, prices map[time.Time]*journal.Price, filepat
 	return atomic.WriteFile(filepath, r)
 }
 
+const (
+	sourceYahoo     = "yahoo"
+	sourceECB       = "ecb"
+	sourceCoinGecko = "coingecko"
+
+	// euro is the currency of the ECB reference rates.
+	euro = "EUR"
+
+	// ecbDigits is the number of digits of inverted ECB rates.
+	ecbDigits = 6
+)
+
 type config struct {
+	Source          string `yaml:"source"`
 	Symbol          string `yaml:"symbol"`
 	File            string `yaml:"file"`
 	Commodity       string `yaml:"commodity"`
 	TargetCommodity string `yaml:"target_commodity"`
 }
+
+func (cfg config) validate() error {
+	switch cfg.Source {
+	case sourceYahoo, sourceCoinGecko, "":
+		if cfg.Symbol == "" {
+			return fmt.Errorf("%s: missing symbol", cfg.File)
+		}
+	case sourceECB:
+		if cfg.Commodity != euro && cfg.TargetCommodity != euro {
+			return fmt.Errorf("%s: ECB rates require %s as commodity or target commodity", cfg.File, euro)
+		}
+	default:
+		return fmt.Errorf("%s: invalid source %q, expected %s, %s or %s", cfg.File, cfg.Source, sourceYahoo, sourceECB, sourceCoinGecko)
+	}
+	return nil
+}
+
+// key returns the cache key of the quotes of the configuration.
+func (cfg config) key() cache.Key {
+	source := cfg.Source
+	if source == "" {
+		source = sourceYahoo
+	}
+	return cache.Key{Source: source, Symbol: cfg.Symbol, Commodity: cfg.Commodity, Target: cfg.TargetCommodity}
+}
+
+// currency returns the currency of the ECB reference rate, which is the
+// symbol or, by default, the commodity which is not the euro.
+func (cfg config) currency() string {
+	switch {
+	case cfg.Symbol != "":
+		return cfg.Symbol
+	case cfg.Commodity == euro:
+		return cfg.TargetCommodity
+	default:
+		return cfg.Commodity
+	}
+}
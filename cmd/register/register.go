@@ -61,10 +61,16 @@ type runner struct {
 	showCommodities               bool
 	showSource                    bool
 	showDescriptions              bool
+	collapseSplits                bool
 	mapping                       flags.MappingFlag
 	remap                         flags.RegexFlag
 	valuation                     flags.CommodityFlag
 	accounts, others, commodities flags.RegexFlag
+	metadata, links               flags.RegexFlag
+	tags                          []string
+	pending, cleared              bool
+	hideGains, separateGains      flags.RegexFlag
+	gainsAccount                  flags.AccountFlag
 
 	// formatting
 	thousands, color   bool
@@ -97,12 +103,23 @@ func (r *runner) setupFlags(c *cobra.Command) {
 	c.Flags().BoolVarP(&r.showCommodities, "show-commodities", "c", false, "Show commodities")
 	c.Flags().BoolVarP(&r.showDescriptions, "show-descriptions", "d", false, "Show descriptions")
 	c.Flags().BoolVarP(&r.showSource, "show-source", "a", false, "Show the source accounts")
+	c.Flags().BoolVar(&r.collapseSplits, "collapse-splits", false, "Show the postings of a transaction with several dest accounts on one (split) row")
 	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity")
-	c.Flags().VarP(&r.mapping, "map", "m", "<level>,<regex>")
+	c.Flags().VarP(&r.mapping, "map", "m", "<level>,<regex>, <glob> -> <account> or <account>:<depth>,...")
+	c.Flags().Var(r.mapping.File(), "map-file", "read --map rules from the given file, one per line")
 	c.Flags().VarP(&r.remap, "remap", "r", "<regex>")
 	c.Flags().Var(&r.accounts, "source", "filter source accounts with a regex")
 	c.Flags().Var(&r.others, "dest", "filter dest accounts with a regex")
 	c.Flags().Var(&r.commodities, "commodity", "filter commodities with a regex")
+	c.Flags().Var(&r.metadata, "meta", "filter postings with metadata matching a regex, as key=value")
+	c.Flags().Var(&r.links, "link", "filter transactions with a link matching a regex")
+	c.Flags().StringArrayVar(&r.tags, "tag", nil, "filter postings with a tag, given as key or key=value")
+	c.Flags().BoolVar(&r.pending, "pending", false, "only include pending transactions (flagged with !)")
+	c.Flags().BoolVar(&r.cleared, "cleared", false, "only include cleared transactions (flagged with *)")
+	c.MarkFlagsMutuallyExclusive("pending", "cleared")
+	c.Flags().Var(&r.hideGains, "hide-gains", "hide the valuation gains of commodities matching a regex")
+	c.Flags().Var(&r.separateGains, "separate-gains", "book the valuation gains of commodities matching a regex to --gains-account")
+	c.Flags().Var(&r.gainsAccount, "gains-account", "account for separated valuation gains (default Equity:Revaluation)")
 	c.Flags().Int32Var(&r.digits, "digits", 0, "round to number of digits")
 	c.Flags().BoolVarP(&r.thousands, "thousands", "k", false, "show numbers in units of 1000")
 	c.Flags().BoolVar(&r.color, "color", true, "print output in color")
@@ -118,6 +135,10 @@ func (r runner) execute(cmd *cobra.Command, args []string) error {
 	if valuation, err = r.valuation.Value(jctx); err != nil {
 		return err
 	}
+	gainsAccount, err := r.gainsAccount.ValueWithDefault(jctx, jctx.Account("Equity:Revaluation"))
+	if err != nil {
+		return err
+	}
 	r.showCommodities = r.showCommodities || valuation == nil
 
 	j, err := journal.FromPath(ctx, jctx, args[0])
@@ -130,14 +151,19 @@ func (r runner) execute(cmd *cobra.Command, args []string) error {
 	}
 	period := r.period.Value().Clip(j.Period())
 	var (
-		dates = period.Dates(r.interval.Value(), r.last)
+		dates = r.interval.Dates(period, r.last)
 		f     = filter.And(
 			journal.FilterDates(period.Contains),
 			journal.FilterAccount(r.accounts.Regex()),
 			journal.FilterOther(r.others.Regex()),
 			journal.FilterCommodity(r.commodities.Regex()),
+			journal.FilterMetadata(r.metadata.Regex()),
+			journal.FilterLink(r.links.Regex()),
+			journal.FilterTagValues(r.tags),
+			journal.FilterFlags(r.flags()...),
+			journal.FilterValuationGains(jctx, r.hideGains.Regex()),
 		)
-		m = journal.KeyMapper{
+		m = mapper.Combine(journal.MapValuationGains(jctx, r.separateGains.Regex(), gainsAccount), journal.KeyMapper{
 			Date:    date.Align(dates),
 			Account: am,
 			Other: mapper.Combine(
@@ -147,7 +173,8 @@ func (r runner) execute(cmd *cobra.Command, args []string) error {
 			Commodity:   journal.MapCommodity(r.showCommodities),
 			Valuation:   journal.MapCommodity(valuation != nil),
 			Description: mapper.If[string](r.showDescriptions),
-		}.Build()
+			Transaction: mapper.If[*journal.Transaction](r.collapseSplits),
+		}.Build())
 		rep        = register.NewReport(jctx)
 		processors = []journal.DayFn{
 			journal.ComputePrices(valuation),
@@ -163,6 +190,7 @@ func (r runner) execute(cmd *cobra.Command, args []string) error {
 			ShowCommodities:    r.showCommodities,
 			ShowDescriptions:   r.showDescriptions,
 			ShowSource:         r.showSource,
+			CollapseSplits:     r.collapseSplits,
 			SortAlphabetically: r.sortAlphabetically,
 		}
 		tableRenderer = table.TextRenderer{
@@ -175,3 +203,14 @@ func (r runner) execute(cmd *cobra.Command, args []string) error {
 	defer out.Flush()
 	return tableRenderer.Render(reportRenderer.Render(rep), out)
 }
+
+// flags returns the transaction flags to filter by.
+func (r runner) flags() []journal.Flag {
+	switch {
+	case r.pending:
+		return []journal.Flag{journal.Pending}
+	case r.cleared:
+		return []journal.Flag{journal.Cleared}
+	}
+	return nil
+}
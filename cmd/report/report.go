@@ -0,0 +1,235 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/sboehler/knut/cmd/balance"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	c := &cobra.Command{
+		Use:   "report",
+		Short: "run a report declared in a definition file",
+		Long: `Run the balance report declared in the YAML file given by --def. The definition holds the
+journal, the period, filters, mappings, valuation and layout of the report, such that recurring
+reports don't need long command lines. A journal given as argument takes precedence over the
+journal of the definition. See doc/report.yaml for an example.`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  r.run,
+	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	def string
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	c.Flags().StringVar(&r.def, "def", "", "the report definition file (required)")
+	c.MarkFlagRequired("def")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *runner) execute(cmd *cobra.Command, args []string) error {
+	def, err := readDefinition(r.def)
+	if err != nil {
+		return err
+	}
+	path := def.Journal
+	if len(args) > 0 {
+		path = args[0]
+	} else if path == "" {
+		return fmt.Errorf("%s: no journal given", r.def)
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(r.def), path)
+	}
+	fs, err := def.flags()
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.def, err)
+	}
+	c := balance.CreateCmd()
+	c.SetContext(cmd.Context())
+	c.SetOut(cmd.OutOrStdout())
+	c.SetErr(cmd.ErrOrStderr())
+	for _, f := range fs {
+		if err := c.Flags().Set(f.name, f.value); err != nil {
+			return fmt.Errorf("%s: invalid %s %q: %w", r.def, f.name, f.value, err)
+		}
+	}
+	c.Run(c, []string{path})
+	return nil
+}
+
+// definition is a report definition.
+type definition struct {
+	Journal string `yaml:"journal"`
+
+	// period
+	From     string `yaml:"from"`
+	To       string `yaml:"to"`
+	Last     int    `yaml:"last"`
+	Interval string `yaml:"interval"`
+	Every    int    `yaml:"every"`
+
+	FiscalYearStart string `yaml:"fiscal_year_start"`
+
+	// filters, mappings and valuation
+	Valuation     string   `yaml:"valuation"`
+	ValMode       string   `yaml:"val_mode"`
+	Accounts      []string `yaml:"accounts"`
+	Commodities   []string `yaml:"commodities"`
+	Tags          []string `yaml:"tags"`
+	Map           []string `yaml:"map"`
+	Remap         []string `yaml:"remap"`
+	HideGains     []string `yaml:"hide_gains"`
+	SeparateGains []string `yaml:"separate_gains"`
+	GainsAccount  string   `yaml:"gains_account"`
+
+	Layout layout `yaml:"layout"`
+}
+
+// layout is the layout of a report.
+type layout struct {
+	Diff            bool     `yaml:"diff"`
+	Sort            bool     `yaml:"sort"`
+	ShowCommodities bool     `yaml:"show_commodities"`
+	Totals          bool     `yaml:"totals"`
+	PercentOfTotal  bool     `yaml:"percent_of_total"`
+	PercentChange   bool     `yaml:"percent_change"`
+	Rolling         int      `yaml:"rolling"`
+	ISOWeeks        bool     `yaml:"iso_weeks"`
+	Chart           bool     `yaml:"chart"`
+	Pivot           string   `yaml:"pivot"`
+	PivotTags       []string `yaml:"pivot_tags"`
+	GroupBy         string   `yaml:"group_by"`
+	Digits          int32    `yaml:"digits"`
+	Thousands       bool     `yaml:"thousands"`
+	Color           *bool    `yaml:"color"`
+}
+
+func readDefinition(path string) (*definition, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.SetStrict(true)
+	var def definition
+	if err := dec.Decode(&def); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &def, nil
+}
+
+// flag is a flag of the balance command.
+type flag struct {
+	name, value string
+}
+
+var intervals = map[string]string{
+	"daily":     "days",
+	"weekly":    "weeks",
+	"monthly":   "months",
+	"quarterly": "quarters",
+	"yearly":    "years",
+}
+
+// flags returns the flags of the balance command which run the report.
+func (def *definition) flags() ([]flag, error) {
+	var res []flag
+	add := func(name, value string) {
+		if value != "" {
+			res = append(res, flag{name, value})
+		}
+	}
+	addAll := func(name string, values []string) {
+		for _, v := range values {
+			add(name, v)
+		}
+	}
+	addBool := func(name string, value bool) {
+		if value {
+			add(name, "true")
+		}
+	}
+	add("from", def.From)
+	add("to", def.To)
+	if def.Last != 0 {
+		add("last", strconv.Itoa(def.Last))
+	}
+	if def.Interval != "" {
+		name, ok := intervals[def.Interval]
+		if !ok {
+			return nil, fmt.Errorf("invalid interval %q, expected daily, weekly, monthly, quarterly or yearly", def.Interval)
+		}
+		addBool(name, true)
+	}
+	if def.Every != 0 {
+		add("every", strconv.Itoa(def.Every))
+	}
+	add("fiscal-year-start", def.FiscalYearStart)
+	add("val", def.Valuation)
+	add("val-mode", def.ValMode)
+	addAll("account", def.Accounts)
+	addAll("commodity", def.Commodities)
+	addAll("tag", def.Tags)
+	addAll("map", def.Map)
+	addAll("remap", def.Remap)
+	addAll("hide-gains", def.HideGains)
+	addAll("separate-gains", def.SeparateGains)
+	add("gains-account", def.GainsAccount)
+
+	l := def.Layout
+	addBool("diff", l.Diff)
+	addBool("sort", l.Sort)
+	addBool("show-commodities", l.ShowCommodities)
+	addBool("totals", l.Totals)
+	addBool("percent-of-total", l.PercentOfTotal)
+	addBool("percent-change", l.PercentChange)
+	if l.Rolling != 0 {
+		add("rolling", strconv.Itoa(l.Rolling))
+	}
+	addBool("iso-weeks", l.ISOWeeks)
+	addBool("chart", l.Chart)
+	add("pivot", l.Pivot)
+	addAll("pivot-tag", l.PivotTags)
+	add("group-by", l.GroupBy)
+	if l.Digits != 0 {
+		add("digits", strconv.Itoa(int(l.Digits)))
+	}
+	addBool("thousands", l.Thousands)
+	if l.Color != nil {
+		add("color", strconv.FormatBool(*l.Color))
+	}
+	return res, nil
+}
@@ -18,17 +18,38 @@ package cmd
 import (
 	"github.com/sboehler/knut/cmd/balance"
 	"github.com/sboehler/knut/cmd/benchmark"
+	"github.com/sboehler/knut/cmd/budget"
+	"github.com/sboehler/knut/cmd/check"
 	"github.com/sboehler/knut/cmd/completion"
+	"github.com/sboehler/knut/cmd/convert"
+	"github.com/sboehler/knut/cmd/disposals"
+	"github.com/sboehler/knut/cmd/equity"
+	"github.com/sboehler/knut/cmd/export"
+	"github.com/sboehler/knut/cmd/forecast"
 	"github.com/sboehler/knut/cmd/format"
+	"github.com/sboehler/knut/cmd/gains"
+	"github.com/sboehler/knut/cmd/holdings"
 	"github.com/sboehler/knut/cmd/importer"
 	"github.com/sboehler/knut/cmd/infer"
+	"github.com/sboehler/knut/cmd/links"
+	"github.com/sboehler/knut/cmd/lsp"
+	"github.com/sboehler/knut/cmd/payees"
+	"github.com/sboehler/knut/cmd/plaid"
 	"github.com/sboehler/knut/cmd/portfolio"
 	"github.com/sboehler/knut/cmd/prices"
 	"github.com/sboehler/knut/cmd/register"
+	"github.com/sboehler/knut/cmd/report"
+	"github.com/sboehler/knut/cmd/settle"
 	"github.com/sboehler/knut/cmd/sort"
+	"github.com/sboehler/knut/cmd/statement"
+	"github.com/sboehler/knut/cmd/tax"
+	"github.com/sboehler/knut/cmd/top"
 	"github.com/sboehler/knut/cmd/transcode"
 	"github.com/sboehler/knut/cmd/web"
 
+	// read ledger and hledger journals
+	_ "github.com/sboehler/knut/lib/journal/ledger"
+
 	"github.com/spf13/cobra"
 )
 
@@ -42,14 +63,33 @@ func CreateCmd(version string) *cobra.Command {
 	}
 	c.AddCommand(balance.CreateCmd())
 	c.AddCommand(register.CreateCmd())
+	c.AddCommand(check.CreateCmd())
 	c.AddCommand(portfolio.CreateCmd())
+	c.AddCommand(settle.CreateCmd())
+	c.AddCommand(budget.CreateCmd())
+	c.AddCommand(equity.CreateCmd())
+	c.AddCommand(statement.CreateCmd())
+	c.AddCommand(holdings.CreateCmd())
+	c.AddCommand(gains.CreateCmd())
+	c.AddCommand(tax.CreateCmd())
+	c.AddCommand(payees.CreateCmd())
+	c.AddCommand(top.CreateCmd())
+	c.AddCommand(forecast.CreateCmd())
+	c.AddCommand(report.CreateCmd())
+	c.AddCommand(disposals.CreateCmd())
+	c.AddCommand(convert.CreateCmd())
+	c.AddCommand(links.CreateCmd())
 	c.AddCommand(web.CreateCmd())
 	c.AddCommand(sort.CreateCmd())
 	c.AddCommand(importer.CreateCmd())
-	c.AddCommand(prices.CreateCmd())
+	fetch := prices.CreateCmd()
+	fetch.AddCommand(plaid.CreateCmd())
+	c.AddCommand(fetch)
 	c.AddCommand(format.CreateCmd())
+	c.AddCommand(lsp.CreateCmd())
 	c.AddCommand(infer.CreateCmd())
 	c.AddCommand(transcode.CreateCmd())
+	c.AddCommand(export.CreateCmd())
 	c.AddCommand(benchmark.CreateCmd())
 	c.AddCommand(completion.CreateCmd(c))
 
@@ -0,0 +1,115 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settle
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/settlement"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	c := &cobra.Command{
+		Use:   "settle",
+		Short: "compute who owes whom in a household",
+		Long: `Compute what the members of a household, who keep a single journal, owe each other.
+
+Expenses of transactions tagged with #member:<name> are consumed by that member, all other
+expenses are shared equally among the members. An expense is paid by the member who owns the
+account it is paid from, as given by --owner <member>=<regex>. Expenses paid from accounts
+without an owner, such as a joint account, are paid by all members equally. The report shows
+what each member paid and consumed, and the transfers which settle the balances.`,
+		Args: cobra.ExactValidArgs(1),
+		Run:  r.run,
+	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	period    flags.PeriodFlag
+	valuation flags.CommodityFlag
+	owners    []string
+	digits    int32
+	thousands bool
+	color     bool
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	r.period.Setup(c, date.Period{End: date.Today()})
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity (required)")
+	c.Flags().StringArrayVar(&r.owners, "owner", nil, "<member>=<regex>: the member owns the accounts matching the regex")
+	c.Flags().Int32Var(&r.digits, "digits", 2, "round to number of digits")
+	c.Flags().BoolVarP(&r.thousands, "thousands", "k", false, "show numbers in units of 1000")
+	c.Flags().BoolVar(&r.color, "color", true, "print output in color")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *runner) execute(cmd *cobra.Command, args []string) (errors error) {
+	jctx := journal.NewContext()
+	valuation, err := r.valuation.Value(jctx)
+	if err != nil {
+		return err
+	}
+	if valuation == nil {
+		return fmt.Errorf("settle requires a valuation commodity")
+	}
+	var owners []settlement.Owner
+	for _, s := range r.owners {
+		o, err := settlement.ParseOwner(s)
+		if err != nil {
+			return err
+		}
+		owners = append(owners, o)
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	period := r.period.Value().Clip(j.Period())
+	s := settlement.New(owners)
+	if _, err := j.Process(
+		journal.ComputePrices(valuation),
+		journal.Balance(jctx, valuation),
+		journal.Query(journal.FilterDates(period.Contains), nil, valuation, s),
+	); err != nil {
+		return err
+	}
+	out := bufio.NewWriter(cmd.OutOrStdout())
+	defer func() { errors = multierr.Append(errors, out.Flush()) }()
+	tr := table.TextRenderer{
+		Color:     r.color,
+		Thousands: r.thousands,
+		Round:     r.digits,
+	}
+	return tr.Render(settlement.Render(s.Balances(r.digits)), out)
+}
@@ -20,11 +20,11 @@ import (
 	"io"
 	"os"
 
-	"github.com/natefinch/atomic"
 	"github.com/spf13/cobra"
 	"go.uber.org/multierr"
 
 	"github.com/sboehler/knut/lib/common/cpr"
+	"github.com/sboehler/knut/lib/common/staging"
 	"github.com/sboehler/knut/lib/journal"
 )
 
@@ -33,7 +33,8 @@ func CreateCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "sort",
 		Short: "sort the given files",
-		Long:  `Sort the given journal in-place. No white space and comments between directives is preserved.`,
+		Long: `Sort the given journal in-place. No white space and comments between directives is preserved.
+The files are only replaced once all of them have been sorted successfully.`,
 
 		Run: run,
 	}
@@ -52,6 +53,7 @@ func execute(cmd *cobra.Command, args []string) error {
 	var (
 		ctx   = cmd.Context()
 		errCh = make(chan error)
+		stage staging.Stage
 	)
 	go func() {
 		defer close(errCh)
@@ -61,7 +63,7 @@ func execute(cmd *cobra.Command, args []string) error {
 			sema <- true
 			go func(arg string) {
 				defer func() { <-sema }()
-				if err := sortFile(arg); err != nil {
+				if err := sortFile(&stage, arg); err != nil {
 					if cpr.Push(ctx, errCh, err) != nil {
 						return
 					}
@@ -77,10 +79,14 @@ func execute(cmd *cobra.Command, args []string) error {
 	for err := range errCh {
 		errors = multierr.Append(errors, err)
 	}
-	return errors
+	if errors != nil {
+		return multierr.Append(errors, stage.Abort())
+	}
+	return stage.Commit()
 }
 
-func sortFile(target string) error {
+// sortFile sorts the target and stages the result.
+func sortFile(stage *staging.Stage, target string) error {
 	jctx := journal.NewContext()
 	j, err := readDirectives(jctx, target)
 	if err != nil {
@@ -91,7 +97,10 @@ func sortFile(target string) error {
 	if err != nil {
 		return err
 	}
-	return atomic.WriteFile(target, &buf)
+	return stage.Write(target, func(w io.Writer) error {
+		_, err := buf.WriteTo(w)
+		return err
+	})
 }
 
 func readDirectives(jctx journal.Context, target string) (*journal.Journal, error) {
@@ -128,6 +137,15 @@ func readDirectives(jctx journal.Context, target string) (*journal.Journal, erro
 		case *journal.Value:
 			res.AddValue(t)
 
+		case *journal.Rename:
+			res.AddRename(t)
+
+		case *journal.Split:
+			res.AddSplit(t)
+
+		case *journal.Budget:
+			res.AddBudget(t)
+
 		case *journal.Close:
 			res.AddClose(t)
 
@@ -0,0 +1,120 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/sboehler/knut/cmd/flags"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/top"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/multierr"
+)
+
+// CreateCmd creates the command.
+func CreateCmd() *cobra.Command {
+	var r runner
+	c := &cobra.Command{
+		Use:   "top",
+		Short: "print the largest expenses",
+		Long: `Print the largest expenses of the period, i.e. the amounts which individual transactions book
+on expense accounts, ordered by decreasing amount. Combine --last with an interval to select
+recent periods, e.g. --months --last 1 for the last month. Use --group-by account to print the
+largest expenses per account. Without --val, the expenses are ranked per commodity.`,
+		Args: cobra.ExactValidArgs(1),
+		Run:  r.run,
+	}
+	r.setupFlags(c)
+	return c
+}
+
+type runner struct {
+	period    flags.PeriodFlag
+	interval  flags.IntervalFlags
+	last      int
+	n         int
+	groupBy   string
+	valuation flags.CommodityFlag
+	accounts  flags.RegexFlag
+	digits    int32
+	thousands bool
+	color     bool
+}
+
+func (r *runner) setupFlags(c *cobra.Command) {
+	r.period.Setup(c, date.Period{End: date.Today()})
+	r.interval.Setup(c, date.Once)
+	c.Flags().IntVar(&r.last, "last", 0, "last n periods")
+	c.Flags().IntVar(&r.n, "n", 10, "number of expenses to print")
+	c.Flags().StringVar(&r.groupBy, "group-by", "", "print the largest expenses per account (account)")
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity")
+	c.Flags().Var(&r.accounts, "account", "filter accounts with a regex")
+	c.Flags().Int32Var(&r.digits, "digits", 0, "round to number of digits")
+	c.Flags().BoolVarP(&r.thousands, "thousands", "k", false, "show numbers in units of 1000")
+	c.Flags().BoolVar(&r.color, "color", true, "print output in color")
+}
+
+func (r *runner) run(cmd *cobra.Command, args []string) {
+	if err := r.execute(cmd, args); err != nil {
+		fmt.Fprintln(cmd.ErrOrStderr(), err)
+		os.Exit(1)
+	}
+}
+
+func (r *runner) execute(cmd *cobra.Command, args []string) (errors error) {
+	if r.groupBy != "" && r.groupBy != "account" {
+		return fmt.Errorf("invalid --group-by %q, expected account", r.groupBy)
+	}
+	if r.n <= 0 {
+		return fmt.Errorf("invalid --n %d, expected a positive number", r.n)
+	}
+	jctx := journal.NewContext()
+	valuation, err := r.valuation.Value(jctx)
+	if err != nil {
+		return err
+	}
+	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
+	if err != nil {
+		return err
+	}
+	period := r.period.Value().Clip(j.Period())
+	// with --last, the period covers the last n periods of the interval
+	if dates := r.interval.Dates(period, r.last); len(dates) > 0 && r.interval.Value() != date.Once {
+		period.Start = r.interval.Start(period, dates)
+		period.End = dates[len(dates)-1]
+	}
+	rep := top.New(period, valuation, journal.FilterAccount(r.accounts.Regex()))
+	if _, err := j.Process(
+		journal.ComputePrices(valuation),
+		journal.Balance(jctx, valuation),
+		rep.Process,
+	); err != nil {
+		return err
+	}
+	out := bufio.NewWriter(cmd.OutOrStdout())
+	defer func() { errors = multierr.Append(errors, out.Flush()) }()
+	tr := table.TextRenderer{
+		Color:     r.color,
+		Thousands: r.thousands,
+		Round:     r.digits,
+	}
+	return tr.Render(top.Render(rep.Top(r.n, r.groupBy == "account")), out)
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/sboehler/knut/cmd/flags"
 	"github.com/sboehler/knut/lib/journal"
 	"github.com/sboehler/knut/lib/journal/beancount"
+	"github.com/sboehler/knut/lib/journal/ledger"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/multierr"
@@ -34,9 +35,10 @@ func CreateCmd() *cobra.Command {
 	// Cmd is the balance command.
 	cmd := &cobra.Command{
 		Use:   "transcode",
-		Short: "transcode to beancount",
-		Long: `Transcode the given journal to beancount, to leverage their amazing tooling. This command requires a valuation commodity, so` +
-			` that all currency conversions can be done by knut.`,
+		Short: "transcode to beancount, ledger or hledger",
+		Long: `Transcode the given journal to beancount, ledger or hledger, to leverage their amazing tooling. For beancount,` +
+			` this command requires a valuation commodity, so that all currency conversions can be done by knut. For ledger` +
+			` and hledger, amounts are kept in their commodities and prices and balance assertions are transcoded as well.`,
 
 		Args: cobra.ExactValidArgs(1),
 
@@ -48,10 +50,12 @@ func CreateCmd() *cobra.Command {
 
 type runner struct {
 	valuation flags.CommodityFlag
+	format    string
 }
 
 func (r *runner) setupFlags(c *cobra.Command) {
-	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity")
+	c.Flags().VarP(&r.valuation, "val", "v", "valuate in the given commodity (beancount only)")
+	c.Flags().StringVar(&r.format, "format", "beancount", "output format (beancount, ledger or hledger)")
 }
 
 func (r *runner) run(cmd *cobra.Command, args []string) {
@@ -70,6 +74,18 @@ func (r *runner) execute(cmd *cobra.Command, args []string) (errors error) {
 	if valuation, err = r.valuation.Value(jctx); err != nil {
 		return err
 	}
+	switch r.format {
+	case "beancount":
+		if valuation == nil {
+			return fmt.Errorf("format beancount requires a valuation commodity")
+		}
+	case "ledger", "hledger":
+		if valuation != nil {
+			return fmt.Errorf("format %s does not support a valuation commodity", r.format)
+		}
+	default:
+		return fmt.Errorf("invalid format %q, expected beancount, ledger or hledger", r.format)
+	}
 	j, err := journal.FromPath(cmd.Context(), jctx, args[0])
 	if err != nil {
 		return err
@@ -78,9 +94,18 @@ func (r *runner) execute(cmd *cobra.Command, args []string) (errors error) {
 		journal.ComputePrices(valuation),
 		journal.Balance(jctx, valuation),
 	)
+	if err != nil {
+		return err
+	}
 	w := bufio.NewWriter(cmd.OutOrStdout())
-	defer func() { err = multierr.Append(err, w.Flush()) }()
+	defer func() { errors = multierr.Append(errors, w.Flush()) }()
 
-	// transcode the ledger here
-	return beancount.Transcode(w, l.Days, valuation)
+	switch r.format {
+	case "ledger":
+		return ledger.Transcode(w, l.Days, ledger.Ledger)
+	case "hledger":
+		return ledger.Transcode(w, l.Days, ledger.HLedger)
+	default:
+		return beancount.Transcode(w, l.Days, valuation)
+	}
 }
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/sboehler/knut/lib/journal"
 	"github.com/sboehler/knut/server"
 	"github.com/spf13/cobra"
 )
@@ -29,9 +30,13 @@ func CreateCmd() *cobra.Command {
 
 	// Cmd is the balance command.
 	c := &cobra.Command{
-		Use:    "web",
-		Short:  "start the web application",
-		Long:   `Start the knut web application.`,
+		Use:   "web",
+		Short: "start the web application",
+		Long: `Start the knut web application. If a journal is given, the processed journal is served
+as JSON at /days?from=YYYY-MM-DD&to=YYYY-MM-DD&val=<commodity>, and its errors at
+/check?val=<commodity>&date=YYYY-MM-DD&strict=true, see doc/output.md. With --revision, the journal is read from the given revision of the git repository in the current
+directory.`,
+		Args:   cobra.MaximumNArgs(1),
 		Run:    r.run,
 		Hidden: true,
 	}
@@ -40,16 +45,25 @@ func CreateCmd() *cobra.Command {
 }
 
 type runner struct {
-	address string
+	address  string
+	revision string
 }
 
 func (r *runner) setupFlags(c *cobra.Command) {
 	c.Flags().StringVar(&r.address, "listen", "localhost:7777", "<host>[:<port>]")
-
+	c.Flags().StringVar(&r.revision, "revision", "", "read the journal from the given git revision")
 }
 
 func (r *runner) run(cmd *cobra.Command, args []string) {
-	if err := server.NewServer(r.address); err != nil {
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	}
+	var src journal.Source = journal.FileSystem{}
+	if r.revision != "" {
+		src = journal.Git{Dir: ".", Revision: r.revision}
+	}
+	if err := server.NewServer(r.address, src, path); err != nil {
 		fmt.Fprintf(cmd.ErrOrStderr(), "%+v\n", err)
 		os.Exit(1)
 	}
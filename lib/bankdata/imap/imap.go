@@ -0,0 +1,206 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package imap is a minimal IMAP4rev1 client, which supports just enough of
+// the protocol to fetch messages with statements from a mailbox.
+package imap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Client is a connection to an IMAP server.
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+}
+
+// Dial connects to the IMAP server at the given address using TLS.
+func Dial(addr string) (*Client, error) {
+	conn, err := tls.Dial("tcp", addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn)
+}
+
+// NewClient creates a client on an established connection and reads the
+// server greeting.
+func NewClient(conn net.Conn) (*Client, error) {
+	c := &Client{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected greeting: %s", greeting)
+	}
+	return c, nil
+}
+
+// Login authenticates with username and password.
+func (c *Client) Login(username, password string) error {
+	_, err := c.execute(fmt.Sprintf("LOGIN %s %s", quote(username), quote(password)))
+	return err
+}
+
+// Select selects the given mailbox.
+func (c *Client) Select(mailbox string) error {
+	_, err := c.execute(fmt.Sprintf("SELECT %s", quote(mailbox)))
+	return err
+}
+
+// Search returns the UIDs of the messages in the selected mailbox which
+// match the given search criteria, such as "UNSEEN".
+func (c *Client) Search(criteria string) ([]uint32, error) {
+	rs, err := c.execute("UID SEARCH " + criteria)
+	if err != nil {
+		return nil, err
+	}
+	var res []uint32
+	for _, r := range rs {
+		fields := strings.Fields(r.text)
+		if len(fields) == 0 || !strings.EqualFold(fields[0], "SEARCH") {
+			continue
+		}
+		for _, f := range fields[1:] {
+			uid, err := strconv.ParseUint(f, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UID %q in search response", f)
+			}
+			res = append(res, uint32(uid))
+		}
+	}
+	return res, nil
+}
+
+// Fetch returns the raw message with the given UID, without setting the
+// \Seen flag.
+func (c *Client) Fetch(uid uint32) ([]byte, error) {
+	rs, err := c.execute(fmt.Sprintf("UID FETCH %d BODY.PEEK[]", uid))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rs {
+		if strings.Contains(strings.ToUpper(r.text), "FETCH") && len(r.literals) > 0 {
+			return r.literals[0], nil
+		}
+	}
+	return nil, fmt.Errorf("message with UID %d not found", uid)
+}
+
+// MarkSeen sets the \Seen flag on the message with the given UID.
+func (c *Client) MarkSeen(uid uint32) error {
+	_, err := c.execute(fmt.Sprintf(`UID STORE %d +FLAGS.SILENT (\Seen)`, uid))
+	return err
+}
+
+// Logout logs out and closes the connection.
+func (c *Client) Logout() error {
+	_, err := c.execute("LOGOUT")
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// response is an untagged server response. The literals it contains are
+// removed from the text.
+type response struct {
+	text     string
+	literals [][]byte
+}
+
+// execute sends a command and returns the untagged responses, or an error
+// if the command did not complete successfully.
+func (c *Client) execute(command string) ([]response, error) {
+	c.tag++
+	tag := fmt.Sprintf("a%d", c.tag)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, command); err != nil {
+		return nil, err
+	}
+	var res []response
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(line, "* "):
+			r, err := c.readResponse(line[2:])
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, r)
+		case strings.HasPrefix(line, tag+" "):
+			status := line[len(tag)+1:]
+			if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+				return nil, fmt.Errorf("%s: %s", strings.Fields(command)[0], status)
+			}
+			return res, nil
+		}
+	}
+}
+
+var literal = regexp.MustCompile(`\{(\d+)\}$`)
+
+// readResponse reads the literals which follow the given line.
+func (c *Client) readResponse(line string) (response, error) {
+	var r response
+	for {
+		m := literal.FindStringSubmatchIndex(line)
+		if m == nil {
+			r.text += line
+			return r, nil
+		}
+		n, err := strconv.Atoi(line[m[2]:m[3]])
+		if err != nil {
+			return r, err
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return r, err
+		}
+		r.text += line[:m[0]]
+		r.literals = append(r.literals, buf)
+		if line, err = c.readLine(); err != nil {
+			return r, err
+		}
+	}
+}
+
+func (c *Client) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imap
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const message = "From: =?utf-8?q?Bank_Z=C3=BCrich?= <noreply@bank.example>\r\n" +
+	"Subject: Statement\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Your statement is attached.\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/csv; name=\"statement.csv\"\r\n" +
+	"Content-Disposition: attachment; filename=\"statement.csv\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"RGF0dW07QmV0cmFnCjAxLjAyLjIwMjM7\r\n" +
+	"LTEyLjMwCg==\r\n" +
+	"--b1--\r\n"
+
+// serve runs a fake IMAP server on conn, which expects the given commands
+// (without tags) and sends the corresponding responses.
+func serve(t *testing.T, conn net.Conn, script [][2]string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "* OK IMAP4rev1 ready\r\n")
+	for _, step := range script {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Errorf("reading command: %v", err)
+			return
+		}
+		tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		if cmd != step[0] {
+			t.Errorf("got command %q, want %q", cmd, step[0])
+		}
+		fmt.Fprintf(conn, "%s%s OK done\r\n", step[1], tag)
+	}
+}
+
+func TestClient(t *testing.T) {
+	client, server := net.Pipe()
+	go serve(t, server, [][2]string{
+		{`LOGIN "user" "pa\"ss"`, ""},
+		{`SELECT "Statements"`, "* 2 EXISTS\r\n"},
+		{`UID SEARCH UNSEEN`, "* SEARCH 7 9\r\n"},
+		{`UID FETCH 7 BODY.PEEK[]`, fmt.Sprintf("* 1 FETCH (UID 7 BODY[] {%d}\r\n%s)\r\n", len(message), message)},
+		{`UID STORE 7 +FLAGS.SILENT (\Seen)`, ""},
+		{`LOGOUT`, "* BYE\r\n"},
+	})
+
+	c, err := NewClient(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Login("user", `pa"ss`); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Select("Statements"); err != nil {
+		t.Fatal(err)
+	}
+	uids, err := c.Search("UNSEEN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]uint32{7, 9}, uids); diff != "" {
+		t.Fatalf("Search() returned unexpected diff (-want/+got):\n%s", diff)
+	}
+	raw, err := c.Fetch(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(message, string(raw)); diff != "" {
+		t.Fatalf("Fetch() returned unexpected diff (-want/+got):\n%s", diff)
+	}
+	if err := c.MarkSeen(7); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Logout(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		r := bufio.NewReader(server)
+		fmt.Fprint(server, "* OK ready\r\n")
+		line, _ := r.ReadString('\n')
+		tag, _, _ := strings.Cut(line, " ")
+		fmt.Fprintf(server, "%s NO [AUTHENTICATIONFAILED] invalid credentials\r\n", tag)
+	}()
+	c, err := NewClient(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Login("user", "wrong")
+
+	if err == nil || !strings.Contains(err.Error(), "invalid credentials") {
+		t.Fatalf("Login() returned %v, want an error", err)
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	got, err := ParseMessage([]byte(message))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Message{
+		From:    "Bank Zürich <noreply@bank.example>",
+		Subject: "Statement",
+		Attachments: []Attachment{
+			{
+				Filename:    "statement.csv",
+				ContentType: "text/csv",
+				Data:        []byte("Datum;Betrag\n01.02.2023;-12.30\n"),
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("ParseMessage() returned unexpected diff (-want/+got):\n%s", diff)
+	}
+}
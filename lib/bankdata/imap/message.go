@@ -0,0 +1,113 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// Message is an email message.
+type Message struct {
+	From, Subject string
+	Attachments   []Attachment
+}
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// ParseMessage parses a raw RFC 5322 message.
+func ParseMessage(raw []byte) (*Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	var dec mime.WordDecoder
+	res := &Message{
+		From:    m.Header.Get("From"),
+		Subject: m.Header.Get("Subject"),
+	}
+	if s, err := dec.DecodeHeader(res.Subject); err == nil {
+		res.Subject = s
+	}
+	if s, err := dec.DecodeHeader(res.From); err == nil {
+		res.From = s
+	}
+	if err := res.parsePart(textproto.MIMEHeader(m.Header), m.Body); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (m *Message) parsePart(header textproto.MIMEHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := r.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := m.parsePart(p.Header, p); err != nil {
+				return err
+			}
+		}
+	}
+	filename := params["name"]
+	if _, dparams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && len(dparams["filename"]) > 0 {
+		filename = dparams["filename"]
+	}
+	if len(filename) == 0 {
+		return nil
+	}
+	var dec mime.WordDecoder
+	if s, err := dec.DecodeHeader(filename); err == nil {
+		filename = s
+	}
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("attachment %s: %w", filename, err)
+	}
+	m.Attachments = append(m.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: mediaType,
+		Data:        data,
+	})
+	return nil
+}
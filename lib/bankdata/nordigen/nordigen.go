@@ -0,0 +1,122 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nordigen is a client for the GoCardless (formerly Nordigen)
+// Bank Account Data API.
+package nordigen
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+const nordigenURL = "https://bankaccountdata.gocardless.com/api/v2"
+
+// Client is a client for the Bank Account Data API.
+type Client struct {
+	url   string
+	token string
+}
+
+// New creates a new client with the default URL, authenticating with
+// the given access token.
+func New(token string) Client {
+	return Client{url: nordigenURL, token: token}
+}
+
+// Requisition is a requisition, which links a set of bank accounts.
+type Requisition struct {
+	ID       string   `json:"id"`
+	Status   string   `json:"status"`
+	Accounts []string `json:"accounts"`
+}
+
+// Amount is a monetary amount.
+type Amount struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// Transaction is a transaction on a bank account.
+type Transaction struct {
+	TransactionID                     string `json:"transactionId"`
+	BookingDate                       string `json:"bookingDate"`
+	ValueDate                         string `json:"valueDate"`
+	TransactionAmount                 Amount `json:"transactionAmount"`
+	CreditorName                      string `json:"creditorName"`
+	DebtorName                        string `json:"debtorName"`
+	RemittanceInformationUnstructured string `json:"remittanceInformationUnstructured"`
+}
+
+// Transactions contains the booked and pending transactions of an account.
+type Transactions struct {
+	Booked  []Transaction `json:"booked"`
+	Pending []Transaction `json:"pending"`
+}
+
+// Requisition fetches the requisition with the given ID.
+func (c *Client) Requisition(id string) (*Requisition, error) {
+	var res Requisition
+	if err := c.get(path.Join("requisitions", id), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Transactions fetches the transactions of the given account in the given
+// date range. Zero dates are omitted from the request.
+func (c *Client) Transactions(account string, t0, t1 time.Time) (*Transactions, error) {
+	q := make(url.Values)
+	if !t0.IsZero() {
+		q.Set("date_from", t0.Format("2006-01-02"))
+	}
+	if !t1.IsZero() {
+		q.Set("date_to", t1.Format("2006-01-02"))
+	}
+	var res struct {
+		Transactions Transactions `json:"transactions"`
+	}
+	if err := c.get(path.Join("accounts", account, "transactions"), q, &res); err != nil {
+		return nil, err
+	}
+	return &res.Transactions, nil
+}
+
+func (c *Client) get(p string, q url.Values, res any) error {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return err
+	}
+	u.Path = path.Join(u.Path, p) + "/"
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
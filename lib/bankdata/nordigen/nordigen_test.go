@@ -0,0 +1,82 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nordigen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTransactions(t *testing.T) {
+	var (
+		gotPath, gotAuth string
+		gotQuery         map[string][]string
+		response         = `{"transactions": {"booked": [{
+			"transactionId": "T1",
+			"bookingDate": "2023-03-01",
+			"valueDate": "2023-03-02",
+			"transactionAmount": {"amount": "-12.30", "currency": "EUR"},
+			"creditorName": "Bakery",
+			"remittanceInformationUnstructured": "Card payment"
+		}], "pending": []}}`
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotPath, gotAuth, gotQuery = r.URL.Path, r.Header.Get("Authorization"), r.URL.Query()
+			w.Write([]byte(response))
+		}))
+	)
+	defer srv.Close()
+	var (
+		want = &Transactions{
+			Booked: []Transaction{
+				{
+					TransactionID:                     "T1",
+					BookingDate:                       "2023-03-01",
+					ValueDate:                         "2023-03-02",
+					TransactionAmount:                 Amount{Amount: "-12.30", Currency: "EUR"},
+					CreditorName:                      "Bakery",
+					RemittanceInformationUnstructured: "Card payment",
+				},
+			},
+			Pending: []Transaction{},
+		}
+		wantQuery = map[string][]string{
+			"date_from": {"2023-03-01"},
+			"date_to":   {"2023-03-31"},
+		}
+		client = Client{url: srv.URL + "/api/v2", token: "secret"}
+	)
+
+	got, err := client.Transactions("acc1", time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 3, 31, 0, 0, 0, 0, time.UTC))
+
+	if err != nil {
+		t.Fatalf("client.Transactions(): returned unexpected error %v", err)
+	}
+	if gotPath != "/api/v2/accounts/acc1/transactions/" {
+		t.Errorf("client.Transactions(): unexpected path %q", gotPath)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("client.Transactions(): unexpected authorization header %q", gotAuth)
+	}
+	if diff := cmp.Diff(wantQuery, gotQuery); diff != "" {
+		t.Errorf("client.Transactions(): unexpected diff in query parameters (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("client.Transactions() returned difference (-want, +got):\n%s", diff)
+	}
+}
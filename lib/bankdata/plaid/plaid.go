@@ -0,0 +1,124 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plaid is a client for the Plaid transactions API.
+package plaid
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/shopspring/decimal"
+)
+
+// URL returns the API URL for the given Plaid environment (sandbox,
+// development or production).
+func URL(env string) string {
+	return fmt.Sprintf("https://%s.plaid.com", env)
+}
+
+// Client is a client for the Plaid API.
+type Client struct {
+	url              string
+	clientID, secret string
+}
+
+// New creates a new client.
+func New(url, clientID, secret string) Client {
+	return Client{url: url, clientID: clientID, secret: secret}
+}
+
+// Transaction is a Plaid transaction. Positive amounts represent money
+// moving out of the account.
+type Transaction struct {
+	TransactionID   string          `json:"transaction_id"`
+	AccountID       string          `json:"account_id"`
+	Amount          decimal.Decimal `json:"amount"`
+	ISOCurrencyCode string          `json:"iso_currency_code"`
+	Date            string          `json:"date"`
+	Name            string          `json:"name"`
+	MerchantName    string          `json:"merchant_name"`
+	Pending         bool            `json:"pending"`
+}
+
+// RemovedTransaction identifies a removed transaction.
+type RemovedTransaction struct {
+	TransactionID string `json:"transaction_id"`
+}
+
+// SyncResult is the accumulated result of a transaction sync.
+type SyncResult struct {
+	Added, Modified []Transaction
+	Removed         []RemovedTransaction
+	NextCursor      string
+}
+
+type syncRequest struct {
+	ClientID    string `json:"client_id"`
+	Secret      string `json:"secret"`
+	AccessToken string `json:"access_token"`
+	Cursor      string `json:"cursor,omitempty"`
+}
+
+type syncResponse struct {
+	Added      []Transaction        `json:"added"`
+	Modified   []Transaction        `json:"modified"`
+	Removed    []RemovedTransaction `json:"removed"`
+	NextCursor string               `json:"next_cursor"`
+	HasMore    bool                 `json:"has_more"`
+}
+
+// Sync fetches all changes to the transactions of the item with the given
+// access token since the given cursor. An empty cursor fetches the full
+// history.
+func (c *Client) Sync(accessToken, cursor string) (*SyncResult, error) {
+	res := &SyncResult{NextCursor: cursor}
+	for {
+		var resp syncResponse
+		err := c.post("/transactions/sync", syncRequest{
+			ClientID:    c.clientID,
+			Secret:      c.secret,
+			AccessToken: accessToken,
+			Cursor:      res.NextCursor,
+		}, &resp)
+		if err != nil {
+			return nil, err
+		}
+		res.Added = append(res.Added, resp.Added...)
+		res.Modified = append(res.Modified, resp.Modified...)
+		res.Removed = append(res.Removed, resp.Removed...)
+		res.NextCursor = resp.NextCursor
+		if !resp.HasMore {
+			return res, nil
+		}
+	}
+}
+
+func (c *Client) post(p string, req, res any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(c.url+p, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("POST %s: unexpected status %s", p, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
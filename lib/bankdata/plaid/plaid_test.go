@@ -0,0 +1,69 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plaid
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+)
+
+func TestSync(t *testing.T) {
+	var (
+		gotCursors []string
+		responses  = map[string]string{
+			"c0": `{"added": [{"transaction_id": "t1", "amount": 1234567890123456.78, "iso_currency_code": "USD", "date": "2023-03-01", "name": "Coffee"}],
+				"modified": [], "removed": [], "next_cursor": "c1", "has_more": true}`,
+			"c1": `{"added": [], "modified": [], "removed": [{"transaction_id": "t0"}], "next_cursor": "c2", "has_more": false}`,
+		}
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req syncRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("invalid request: %v", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			gotCursors = append(gotCursors, req.Cursor)
+			w.Write([]byte(responses[req.Cursor]))
+		}))
+	)
+	defer srv.Close()
+	var (
+		client = New(srv.URL, "id", "secret")
+		want   = &SyncResult{
+			Added: []Transaction{
+				{TransactionID: "t1", Amount: decimal.RequireFromString("1234567890123456.78"), ISOCurrencyCode: "USD", Date: "2023-03-01", Name: "Coffee"},
+			},
+			Removed:    []RemovedTransaction{{TransactionID: "t0"}},
+			NextCursor: "c2",
+		}
+	)
+
+	got, err := client.Sync("token", "c0")
+
+	if err != nil {
+		t.Fatalf("client.Sync(): returned unexpected error %v", err)
+	}
+	if diff := cmp.Diff([]string{"c0", "c1"}, gotCursors); diff != "" {
+		t.Errorf("client.Sync(): unexpected cursors (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("client.Sync() returned difference (-want, +got):\n%s", diff)
+	}
+}
@@ -69,8 +69,9 @@ func Combine[T any](cmp ...Compare[T]) Compare[T] {
 	}
 }
 
+// Sort sorts ts with the given comparison. The sort is stable.
 func Sort[T any](ts []T, cmp func(T, T) Order) {
-	sort.Slice(ts, func(i, j int) bool {
+	sort.SliceStable(ts, func(i, j int) bool {
 		return cmp(ts[i], ts[j]) == Smaller
 	})
 }
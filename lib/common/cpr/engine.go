@@ -2,6 +2,7 @@ package cpr
 
 import (
 	"context"
+	"errors"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -23,6 +24,89 @@ type Sink[T any] interface {
 
 const bufSize = 100
 
+// Policy determines what happens to the elements produced by a stage
+// while the channel to the next stage is full.
+type Policy int
+
+const (
+	// Block blocks the producing stage until the next stage is ready.
+	Block Policy = iota
+	// Drop drops the elements which do not fit into the channel.
+	Drop
+)
+
+// Options configure the channel between two stages.
+type Options struct {
+	// BufferSize is the capacity of the channel. If zero, a default
+	// capacity is used.
+	BufferSize int
+	Policy     Policy
+}
+
+// DefaultOptions are the options used by Compose and Connect.
+var DefaultOptions = Options{BufferSize: bufSize, Policy: Block}
+
+func (o Options) bufferSize() int {
+	if o.BufferSize <= 0 {
+		return bufSize
+	}
+	return o.BufferSize
+}
+
+// connect runs produce and consume, connected by a channel configured
+// by opts. The producer runs with its own context, which is canceled as
+// soon as the consumer returns. Hence the producer never stays blocked on
+// a full channel which is no longer read, even if the consumer returns
+// early without an error.
+func connect[T any](ctx context.Context, opts Options, produce func(context.Context, chan<- T) error, consume func(context.Context, <-chan T) error) error {
+	g, ctx := errgroup.WithContext(ctx)
+	prodCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := make(chan T, opts.bufferSize())
+	g.Go(func() error {
+		defer close(ch)
+		var err error
+		if opts.Policy == Drop {
+			err = produceDropping(prodCtx, ch, produce)
+		} else {
+			err = produce(prodCtx, ch)
+		}
+		if errors.Is(err, context.Canceled) && prodCtx.Err() != nil {
+			// the consumer has returned, and its error (if
+			// any) is reported by the group
+			return nil
+		}
+		return err
+	})
+	g.Go(func() error {
+		defer cancel()
+		return consume(ctx, ch)
+	})
+	return g.Wait()
+}
+
+// produceDropping runs produce and forwards its elements to ch, dropping
+// them if ch is full.
+func produceDropping[T any](ctx context.Context, ch chan<- T, produce func(context.Context, chan<- T) error) error {
+	var (
+		in   = make(chan T)
+		done = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for t := range in {
+			select {
+			case ch <- t:
+			default:
+			}
+		}
+	}()
+	err := produce(ctx, in)
+	close(in)
+	<-done
+	return err
+}
+
 // Collector collects channel result into an array.
 type Collector[T any] struct {
 	Result []T
@@ -69,46 +153,44 @@ type Pipeline interface {
 type source[T any] struct {
 	source Source[T]
 	proc   Processor[T]
+	opts   Options
 }
 
 func (c source[T]) Source(ctx context.Context, oCh chan<- T) error {
-	g, ctx := errgroup.WithContext(ctx)
-	ch := make(chan T, bufSize)
-	g.Go(func() error {
-		defer close(ch)
-		return c.source.Source(ctx, ch)
-	})
-	g.Go(func() error {
+	return connect(ctx, c.opts, c.source.Source, func(ctx context.Context, ch <-chan T) error {
 		return c.proc.Process(ctx, ch, oCh)
 	})
-	return g.Wait()
 }
 
 type pipeline[T any] struct {
 	source Source[T]
 	sink   Sink[T]
+	opts   Options
 }
 
 // Process processes the pipeline.
 func (c pipeline[T]) Process(ctx context.Context) error {
-	g, ctx := errgroup.WithContext(ctx)
-	ch := make(chan T, bufSize)
-	g.Go(func() error {
-		defer close(ch)
-		return c.source.Source(ctx, ch)
-	})
-	g.Go(func() error {
-		return c.sink.Sink(ctx, ch)
-	})
-	return g.Wait()
+	return connect(ctx, c.opts, c.source.Source, c.sink.Sink)
 }
 
 // Compose composes a source and a processor.
 func Compose[T any](s Source[T], p Processor[T]) Source[T] {
-	return source[T]{s, p}
+	return ComposeWith(s, p, DefaultOptions)
+}
+
+// ComposeWith composes a source and a processor, connected by a channel
+// with the given options.
+func ComposeWith[T any](s Source[T], p Processor[T], opts Options) Source[T] {
+	return source[T]{s, p, opts}
 }
 
 // Connect connects a source and a sink.
 func Connect[T any](src Source[T], snk Sink[T]) Pipeline {
-	return pipeline[T]{src, snk}
+	return ConnectWith(src, snk, DefaultOptions)
+}
+
+// ConnectWith connects a source and a sink by a channel with the given
+// options.
+func ConnectWith[T any](src Source[T], snk Sink[T], opts Options) Pipeline {
+	return pipeline[T]{src, snk, opts}
 }
@@ -0,0 +1,140 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cpr
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// counter produces the numbers 0..n-1.
+type counter int
+
+func (c counter) Source(ctx context.Context, ch chan<- int) error {
+	for i := 0; i < int(c); i++ {
+		if err := Push(ctx, ch, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// take consumes n elements and returns.
+type take struct {
+	n   int
+	err error
+	got []int
+}
+
+func (t *take) Sink(ctx context.Context, ch <-chan int) error {
+	for len(t.got) < t.n {
+		i, ok, err := Pop(ctx, ch)
+		if err != nil || !ok {
+			return err
+		}
+		t.got = append(t.got, i)
+	}
+	return t.err
+}
+
+func runWithTimeout(t *testing.T, p Pipeline) error {
+	t.Helper()
+	errCh := make(chan error, 1)
+	go func() { errCh <- p.Process(context.Background()) }()
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline is blocked")
+		return nil
+	}
+}
+
+func TestConnectSinkReturnsEarly(t *testing.T) {
+	sink := &take{n: 3}
+
+	err := runWithTimeout(t, ConnectWith[int](counter(1000), sink, Options{BufferSize: 1}))
+
+	if err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	if len(sink.got) != 3 {
+		t.Errorf("got %v, want 3 elements", sink.got)
+	}
+}
+
+func TestConnectSinkFails(t *testing.T) {
+	want := errors.New("failed")
+
+	err := runWithTimeout(t, ConnectWith[int](counter(1000), &take{n: 3, err: want}, Options{BufferSize: 1}))
+
+	if !errors.Is(err, want) {
+		t.Fatalf("Process() returned %v, want %v", err, want)
+	}
+}
+
+func TestConnectDrop(t *testing.T) {
+	var (
+		src  = &notifyingCounter{n: 100, done: make(chan struct{})}
+		sink = &blockingSink{release: src.done}
+	)
+
+	// the source must finish although the sink does not read
+	err := runWithTimeout(t, ConnectWith[int](src, sink, Options{BufferSize: 10, Policy: Drop}))
+
+	if err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	// the buffer holds the first elements, and the last element may
+	// still be forwarded once the sink reads
+	if len(sink.got) < 10 || len(sink.got) > 11 {
+		t.Fatalf("got %v, want 10 or 11 elements", sink.got)
+	}
+	if diff := cmp.Diff([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, sink.got[:10]); diff != "" {
+		t.Errorf("got unexpected elements (-want/+got):\n%s", diff)
+	}
+	if len(sink.got) == 11 && sink.got[10] != 99 {
+		t.Errorf("got %d after the buffered elements, want 99", sink.got[10])
+	}
+}
+
+// notifyingCounter produces the numbers 0..n-1 and closes done when it
+// has produced all of them.
+type notifyingCounter struct {
+	n    int
+	done chan struct{}
+}
+
+func (c *notifyingCounter) Source(ctx context.Context, ch chan<- int) error {
+	defer close(c.done)
+	return counter(c.n).Source(ctx, ch)
+}
+
+type blockingSink struct {
+	release chan struct{}
+	got     []int
+}
+
+func (s *blockingSink) Sink(ctx context.Context, ch <-chan int) error {
+	<-s.release
+	return Consume(ctx, ch, func(i int) error {
+		s.got = append(s.got, i)
+		return nil
+	})
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package csvkit provides helpers to read the CSV files produced by banks and
+// brokers, which come in various encodings, delimiters and number formats.
+package csvkit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/encoding/charmap"
+)
+
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+// Decode reads the entire input and returns it as UTF-8. A UTF-8 byte order
+// mark is removed. Input which is not valid UTF-8 is decoded as Windows-1252,
+// which is a superset of the printable characters of ISO-8859-1.
+func Decode(r io.Reader) ([]byte, error) {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	bs = bytes.TrimPrefix(bs, bom)
+	if utf8.Valid(bs) {
+		return bs, nil
+	}
+	return charmap.Windows1252.NewDecoder().Bytes(bs)
+}
+
+// delimiters are the candidates considered by Sniff, in order of preference.
+var delimiters = []rune{',', ';', '\t', '|'}
+
+// Sniff guesses the delimiter of the CSV data. It picks the candidate which
+// occurs the same, non-zero number of times on most of the first lines,
+// ignoring delimiters in quoted fields. It returns ',' if no candidate
+// qualifies.
+func Sniff(data []byte) rune {
+	lines := strings.Split(string(data), "\n")
+	if len(lines) > 20 {
+		lines = lines[:20]
+	}
+	var (
+		best      = ','
+		bestScore int
+	)
+	for _, d := range delimiters {
+		freq := make(map[int]int)
+		for _, l := range lines {
+			if n := count(l, d); n > 0 {
+				freq[n]++
+			}
+		}
+		var score int
+		for _, f := range freq {
+			if f > score {
+				score = f
+			}
+		}
+		if score > bestScore {
+			best, bestScore = d, score
+		}
+	}
+	return best
+}
+
+func count(line string, d rune) int {
+	var (
+		n      int
+		quoted bool
+	)
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == d && !quoted:
+			n++
+		}
+	}
+	return n
+}
+
+// NewReader decodes the input and returns a CSV reader with the sniffed
+// delimiter. Callers can still override the settings of the returned reader.
+func NewReader(r io.Reader) (*csv.Reader, error) {
+	bs, err := Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	res := csv.NewReader(bytes.NewReader(bs))
+	res.Comma = Sniff(bs)
+	return res, nil
+}
+
+// Locale describes how numbers are formatted.
+type Locale struct {
+	// Decimal is the decimal separator.
+	Decimal rune
+	// Grouping contains the characters used to group digits.
+	Grouping string
+}
+
+// Common locales.
+var (
+	Swiss   = Locale{Decimal: '.', Grouping: "'’ "}
+	German  = Locale{Decimal: ',', Grouping: ". "}
+	English = Locale{Decimal: '.', Grouping: ", "}
+)
+
+// ParseDecimal parses a number formatted according to the locale. Leading and
+// trailing whitespace is ignored, as is a leading plus sign.
+func (l Locale) ParseDecimal(s string) (decimal.Decimal, error) {
+	var b strings.Builder
+	for _, r := range strings.TrimPrefix(strings.TrimSpace(s), "+") {
+		switch {
+		case r == l.Decimal:
+			b.WriteRune('.')
+		case strings.ContainsRune(l.Grouping, r):
+		default:
+			b.WriteRune(r)
+		}
+	}
+	d, err := decimal.NewFromString(b.String())
+	if err != nil {
+		return d, fmt.Errorf("invalid number %q: %w", s, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csvkit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+)
+
+func TestDecode(t *testing.T) {
+	for _, test := range []struct {
+		desc  string
+		input []byte
+		want  string
+	}{
+		{"utf-8", []byte("Zürich"), "Zürich"},
+		{"utf-8 with bom", []byte("\xEF\xBB\xBFZürich"), "Zürich"},
+		{"latin-1", []byte("Z\xFCrich"), "Zürich"},
+		{"windows-1252", []byte("\x80 5"), "€ 5"},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := Decode(strings.NewReader(string(test.input)))
+			if err != nil {
+				t.Fatalf("Decode() returned unexpected error: %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("Decode() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSniff(t *testing.T) {
+	for _, test := range []struct {
+		desc  string
+		input string
+		want  rune
+	}{
+		{"comma", "a,b,c\n1,2,3\n", ','},
+		{"semicolon with decimal commas", "a;b;c\n1,5;2,5;3\n4;5,5;6\n", ';'},
+		{"quoted delimiters", "\"a;b\",c\n\"d;e\",f\n", ','},
+		{"tab", "a\tb\n1\t2\n", '\t'},
+		{"single column", "a\nb\n", ','},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := Sniff([]byte(test.input)); got != test.want {
+				t.Errorf("Sniff() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	r, err := NewReader(strings.NewReader("\xEF\xBB\xBFDatum;Betrag\n01.02.2020;1'234.50\n"))
+	if err != nil {
+		t.Fatalf("NewReader() returned unexpected error: %v", err)
+	}
+	got, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll() returned unexpected error: %v", err)
+	}
+	want := [][]string{{"Datum", "Betrag"}, {"01.02.2020", "1'234.50"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for _, test := range []struct {
+		locale Locale
+		input  string
+		want   string
+	}{
+		{Swiss, "1'234.56", "1234.56"},
+		{Swiss, "-1’234.5", "-1234.5"},
+		{German, "1.234,56", "1234.56"},
+		{German, " +12,5 ", "12.5"},
+		{English, "1,234,567.8", "1234567.8"},
+		{English, "12", "12"},
+	} {
+		t.Run(test.input, func(t *testing.T) {
+			got, err := test.locale.ParseDecimal(test.input)
+			if err != nil {
+				t.Fatalf("ParseDecimal() returned unexpected error: %v", err)
+			}
+			if !got.Equal(decimal.RequireFromString(test.want)) {
+				t.Errorf("ParseDecimal() = %s, want %s", got, test.want)
+			}
+		})
+	}
+	if _, err := German.ParseDecimal("1,2,3"); err == nil {
+		t.Errorf("ParseDecimal(%q) returned no error", "1,2,3")
+	}
+}
@@ -15,6 +15,7 @@
 package date
 
 import (
+	"fmt"
 	"sort"
 	"time"
 
@@ -65,6 +66,35 @@ func Date(year int, month time.Month, day int) time.Time {
 // StartOf returns the first date in the given period which
 // contains the receiver.
 func StartOf(d time.Time, p Interval) time.Time {
+	return Calendar{}.StartOf(d, p)
+}
+
+// EndOf returns the last date in the given period that contains
+// the receiver.
+func EndOf(d time.Time, p Interval) time.Time {
+	return Calendar{}.EndOf(d, p)
+}
+
+// Calendar determines the periods of the intervals. Years and quarters
+// start in YearStart, which supports fiscal years other than the calendar
+// year. The zero value is the calendar year starting in January.
+type Calendar struct {
+	YearStart time.Month
+}
+
+// monthsIntoYear returns the number of months between the start of the
+// year and the month of d.
+func (c Calendar) monthsIntoYear(d time.Time) int {
+	start := c.YearStart
+	if start == 0 {
+		start = time.January
+	}
+	return (int(d.Month()) - int(start) + 12) % 12
+}
+
+// StartOf returns the first date in the given period which
+// contains the receiver.
+func (c Calendar) StartOf(d time.Time, p Interval) time.Time {
 	switch p {
 	case Once:
 		return d
@@ -76,16 +106,16 @@ func StartOf(d time.Time, p Interval) time.Time {
 	case Monthly:
 		return Date(d.Year(), d.Month(), 1)
 	case Quarterly:
-		return Date(d.Year(), ((d.Month()-1)/3*3)+1, 1)
+		return Date(d.Year(), d.Month()-time.Month(c.monthsIntoYear(d)%3), 1)
 	case Yearly:
-		return Date(d.Year(), 1, 1)
+		return Date(d.Year(), d.Month()-time.Month(c.monthsIntoYear(d)), 1)
 	}
 	return d
 }
 
 // EndOf returns the last date in the given period that contains
 // the receiver.
-func EndOf(d time.Time, p Interval) time.Time {
+func (c Calendar) EndOf(d time.Time, p Interval) time.Time {
 	switch p {
 	case Once:
 		return d
@@ -95,16 +125,70 @@ func EndOf(d time.Time, p Interval) time.Time {
 		x := (7 - int(d.Weekday())) % 7
 		return d.AddDate(0, 0, x)
 	case Monthly:
-		return StartOf(d, Monthly).AddDate(0, 1, -1)
+		return c.StartOf(d, Monthly).AddDate(0, 1, -1)
 	case Quarterly:
-		return StartOf(d, Quarterly).AddDate(0, 3, 0).AddDate(0, 0, -1)
+		return c.StartOf(d, Quarterly).AddDate(0, 3, -1)
 	case Yearly:
-		return Date(d.Year(), 12, 31)
+		return c.StartOf(d, Yearly).AddDate(1, 0, -1)
 	}
+	return d
+}
+
+// Dates returns the ends of the periods of the given interval within
+// period, or only the last n of them if n is positive. The last date is
+// clipped to the end of the period.
+func (c Calendar) Dates(period Period, p Interval, n int) []time.Time {
+	return c.Every(period, p, 1, n)
+}
 
+// Every is like Dates, but each period spans step intervals, such as two
+// weeks for bi-weekly periods. The periods are counted from the start of
+// the interval containing the start of period.
+func (c Calendar) Every(period Period, p Interval, step, n int) []time.Time {
+	if p == Once {
+		return []time.Time{period.End}
+	}
+	if step < 1 {
+		step = 1
+	}
+	var res []time.Time
+	for t := c.StartOf(period.Start, p); !t.After(period.End); t = Add(t, p, step) {
+		ed := c.EndOf(Add(t, p, step-1), p)
+		if ed.After(period.End) {
+			ed = period.End
+		}
+		res = append(res, ed)
+	}
+	if n > 0 && len(res) > n {
+		res = res[len(res)-n:]
+	}
+	return res
+}
+
+// Add adds n intervals to d. The day of month of d should not exceed 28
+// for monthly, quarterly and yearly intervals.
+func Add(d time.Time, p Interval, n int) time.Time {
+	switch p {
+	case Daily:
+		return d.AddDate(0, 0, n)
+	case Weekly:
+		return d.AddDate(0, 0, 7*n)
+	case Monthly:
+		return d.AddDate(0, n, 0)
+	case Quarterly:
+		return d.AddDate(0, 3*n, 0)
+	case Yearly:
+		return d.AddDate(n, 0, 0)
+	}
 	return d
 }
 
+// ISOWeek formats d as its ISO 8601 week, such as 2020-W05.
+func ISOWeek(d time.Time) string {
+	year, week := d.ISOWeek()
+	return fmt.Sprintf("%04d-W%02d", year, week)
+}
+
 // Today returns today's
 func Today() time.Time {
 	now := time.Now().Local()
@@ -126,21 +210,7 @@ func (p Period) Clip(p2 Period) Period {
 }
 
 func (period Period) Dates(p Interval, n int) []time.Time {
-	if p == Once {
-		return []time.Time{period.End}
-	}
-	var res []time.Time
-	for t := period.Start; !t.After(period.End); t = EndOf(t, p).AddDate(0, 0, 1) {
-		ed := EndOf(t, p)
-		if ed.After(period.End) {
-			ed = period.End
-		}
-		res = append(res, ed)
-	}
-	if n > 0 && len(res) > n {
-		res = res[len(res)-n:]
-	}
-	return res
+	return Calendar{}.Dates(period, p, n)
 }
 
 func (p Period) Contains(t time.Time) bool {
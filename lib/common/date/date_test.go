@@ -193,3 +193,93 @@ func TestPeriodDates(t *testing.T) {
 		})
 	}
 }
+
+func TestCalendarFiscalYear(t *testing.T) {
+	cal := Calendar{YearStart: time.April}
+	tests := []struct {
+		date               time.Time
+		interval           Interval
+		wantStart, wantEnd time.Time
+	}{
+		{date: Date(2020, 4, 1), interval: Yearly, wantStart: Date(2020, 4, 1), wantEnd: Date(2021, 3, 31)},
+		{date: Date(2021, 2, 15), interval: Yearly, wantStart: Date(2020, 4, 1), wantEnd: Date(2021, 3, 31)},
+		{date: Date(2021, 2, 15), interval: Quarterly, wantStart: Date(2021, 1, 1), wantEnd: Date(2021, 3, 31)},
+		{date: Date(2020, 6, 30), interval: Quarterly, wantStart: Date(2020, 4, 1), wantEnd: Date(2020, 6, 30)},
+		{date: Date(2020, 6, 30), interval: Monthly, wantStart: Date(2020, 6, 1), wantEnd: Date(2020, 6, 30)},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v %v", test.interval, test.date.Format("2006-01-02")), func(t *testing.T) {
+			if got := cal.StartOf(test.date, test.interval); got != test.wantStart {
+				t.Errorf("StartOf() = %v, want %v", got, test.wantStart)
+			}
+			if got := cal.EndOf(test.date, test.interval); got != test.wantEnd {
+				t.Errorf("EndOf() = %v, want %v", got, test.wantEnd)
+			}
+		})
+	}
+
+	got := cal.Dates(Period{Start: Date(2019, 1, 1), End: Date(2020, 12, 31)}, Yearly, 0)
+
+	want := []time.Time{Date(2019, 3, 31), Date(2020, 3, 31), Date(2020, 12, 31)}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Dates(): unexpected diff (+got/-want):\n%s", diff)
+	}
+}
+
+func TestCalendarEvery(t *testing.T) {
+	tests := []struct {
+		desc     string
+		period   Period
+		interval Interval
+		step, n  int
+		want     []time.Time
+	}{
+		{
+			desc:     "bi-weekly",
+			period:   Period{Start: Date(2020, 1, 8), End: Date(2020, 2, 10)},
+			interval: Weekly,
+			step:     2,
+			want:     []time.Time{Date(2020, 1, 19), Date(2020, 2, 2), Date(2020, 2, 10)},
+		},
+		{
+			desc:     "ten days, last two",
+			period:   Period{Start: Date(2020, 1, 1), End: Date(2020, 1, 31)},
+			interval: Daily,
+			step:     10,
+			n:        2,
+			want:     []time.Time{Date(2020, 1, 30), Date(2020, 1, 31)},
+		},
+		{
+			desc:     "two months",
+			period:   Period{Start: Date(2020, 1, 15), End: Date(2020, 6, 30)},
+			interval: Monthly,
+			step:     2,
+			want:     []time.Time{Date(2020, 2, 29), Date(2020, 4, 30), Date(2020, 6, 30)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got := Calendar{}.Every(test.period, test.interval, test.step, test.n)
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("Every(): unexpected diff (+got/-want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestISOWeek(t *testing.T) {
+	tests := []struct {
+		date time.Time
+		want string
+	}{
+		{Date(2020, 1, 29), "2020-W05"},
+		{Date(2021, 1, 3), "2020-W53"},
+		{Date(2024, 12, 30), "2025-W01"},
+	}
+	for _, test := range tests {
+		if got := ISOWeek(test.date); got != test.want {
+			t.Errorf("ISOWeek(%s) = %q, want %q", test.date.Format("2006-01-02"), got, test.want)
+		}
+	}
+}
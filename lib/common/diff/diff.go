@@ -0,0 +1,238 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diff computes line-based differences between texts.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxEdits bounds the effort of the diff. Beyond it, the differing lines
+// are reported as a single replacement.
+const maxEdits = 2000
+
+type opKind byte
+
+const (
+	opEqual  opKind = ' '
+	opDelete opKind = '-'
+	opInsert opKind = '+'
+)
+
+type op struct {
+	kind opKind
+	text string
+}
+
+// Unified returns a unified diff of old and new with the given number of
+// lines of context, or the empty string if they are equal.
+func Unified(oldName, newName string, old, new []byte, context int) string {
+	ops := edits(lines(old), lines(new))
+	var (
+		b          strings.Builder
+		oldN, newN int
+		header     bool
+	)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			oldN++
+			newN++
+			i++
+			continue
+		}
+		// the hunk starts with the context before the change at i, and
+		// extends over changes separated by at most 2*context lines
+		start := i
+		for start > 0 && i-start < context && ops[start-1].kind == opEqual {
+			start--
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			j := end
+			for j < len(ops) && ops[j].kind == opEqual {
+				j++
+			}
+			if j == len(ops) || j-end > 2*context {
+				end += min(j-end, context)
+				break
+			}
+			end = j
+		}
+		oldStart, newStart := oldN-(i-start), newN-(i-start)
+		var oldLines, newLines int
+		for _, o := range ops[start:end] {
+			if o.kind != opInsert {
+				oldLines++
+			}
+			if o.kind != opDelete {
+				newLines++
+			}
+		}
+		if !header {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+			header = true
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldLines), hunkRange(newStart, newLines))
+		for _, o := range ops[start:end] {
+			b.WriteByte(byte(o.kind))
+			b.WriteString(o.text)
+			if !strings.HasSuffix(o.text, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		oldN += oldLines - (i - start)
+		newN += newLines - (i - start)
+		i = end
+	}
+	return b.String()
+}
+
+// hunkRange formats the range of a hunk, whose start is 1-based unless the
+// range is empty.
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// lines splits the text into lines, including their newlines.
+func lines(bs []byte) []string {
+	res := strings.SplitAfter(string(bs), "\n")
+	if res[len(res)-1] == "" {
+		res = res[:len(res)-1]
+	}
+	return res
+}
+
+// edits returns a shortest sequence of operations which transforms a into
+// b, using the algorithm of Myers.
+func edits(a, b []string) []op {
+	var prefix, suffix []op
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, op{opEqual, a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append(suffix, op{opEqual, a[len(a)-1]})
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	res := append(prefix, myers(a, b)...)
+	for i := len(suffix) - 1; i >= 0; i-- {
+		res = append(res, suffix[i])
+	}
+	return res
+}
+
+func myers(a, b []string) []op {
+	var (
+		n, m   = len(a), len(b)
+		offset = n + m + 1
+		v      = make([]int, 2*offset+1)
+		trace  [][]int
+	)
+	for d := 0; d <= n+m; d++ {
+		if d > maxEdits {
+			return replace(a, b)
+		}
+		// trace[d] holds v[-d..d] before step d
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, d)
+			}
+		}
+	}
+	return replace(a, b)
+}
+
+func backtrack(a, b []string, trace [][]int, d int) []op {
+	var (
+		res  []op
+		x, y = len(a), len(b)
+	)
+	for ; d > 0; d-- {
+		var (
+			prev  = trace[d]
+			k     = x - y
+			prevK int
+		)
+		at := func(k int) int { return prev[k+d] }
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			res = append(res, op{opEqual, a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			res = append(res, op{opInsert, b[y-1]})
+			y--
+		} else {
+			res = append(res, op{opDelete, a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		res = append(res, op{opEqual, a[x-1]})
+		x--
+		y--
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+// replace returns the operations which delete a and insert b.
+func replace(a, b []string) []op {
+	res := make([]op, 0, len(a)+len(b))
+	for _, l := range a {
+		res = append(res, op{opDelete, l})
+	}
+	for _, l := range b {
+		res = append(res, op{opInsert, l})
+	}
+	return res
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package staging replaces several files together.
+package staging
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/natefinch/atomic"
+	"go.uber.org/multierr"
+)
+
+// Stage holds the new contents of files in temporary files next to them,
+// until they are all replaced at once. It is safe for concurrent use.
+type Stage struct {
+	mu    sync.Mutex
+	files []file
+}
+
+type file struct {
+	target, temp string
+}
+
+// Write writes the new contents of target to a temporary file in the same
+// directory, which has the permissions of target.
+func (s *Stage) Write(target string, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".staged-")
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(target); err == nil {
+		if err := f.Chmod(info.Mode().Perm()); err != nil {
+			return multierr.Combine(err, f.Close(), os.Remove(f.Name()))
+		}
+	}
+	w := bufio.NewWriter(f)
+	if err := multierr.Combine(write(w), w.Flush(), f.Close()); err != nil {
+		return multierr.Append(err, os.Remove(f.Name()))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files = append(s.files, file{target: target, temp: f.Name()})
+	return nil
+}
+
+// Abort removes the temporary files.
+func (s *Stage) Abort() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.files = nil }()
+	return removeTemps(s.files)
+}
+
+// Commit replaces the files with their new contents. The original files
+// are backed up first, and if any file cannot be replaced, the files
+// replaced so far are restored. If the process dies while committing, the
+// backups remain next to the files.
+func (s *Stage) Commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() { s.files = nil }()
+	var backups []string
+	for _, f := range s.files {
+		b, err := backup(f.target)
+		if err != nil {
+			return multierr.Combine(err, removeAll(backups), removeTemps(s.files))
+		}
+		backups = append(backups, b)
+	}
+	for i, f := range s.files {
+		if err := atomic.ReplaceFile(f.temp, f.target); err != nil {
+			err = fmt.Errorf("replacing %s: %w", f.target, err)
+			for j := 0; j < i; j++ {
+				err = multierr.Append(err, atomic.ReplaceFile(backups[j], s.files[j].target))
+			}
+			return multierr.Combine(err, removeAll(backups[i:]), removeTemps(s.files[i:]))
+		}
+	}
+	return removeAll(backups)
+}
+
+// backup copies the file to a temporary file in the same directory.
+func backup(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dest, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".backup-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dest, src); err != nil {
+		return "", multierr.Combine(err, dest.Close(), os.Remove(dest.Name()))
+	}
+	if err := dest.Close(); err != nil {
+		return "", multierr.Append(err, os.Remove(dest.Name()))
+	}
+	return dest.Name(), nil
+}
+
+func removeAll(paths []string) error {
+	var err error
+	for _, p := range paths {
+		err = multierr.Append(err, os.Remove(p))
+	}
+	return err
+}
+
+func removeTemps(files []file) error {
+	var err error
+	for _, f := range files {
+		err = multierr.Append(err, os.Remove(f.temp))
+	}
+	return err
+}
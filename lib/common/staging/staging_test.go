@@ -0,0 +1,114 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package staging
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommit(t *testing.T) {
+	dir := t.TempDir()
+	a, b := write(t, dir, "a", "old a"), write(t, dir, "b", "old b")
+	var s Stage
+	stage(t, &s, a, "new a")
+	stage(t, &s, b, "new b")
+
+	if err := s.Commit(); err != nil {
+		t.Fatalf("Commit() returned unexpected error: %v", err)
+	}
+
+	assertContents(t, a, "new a")
+	assertContents(t, b, "new b")
+	assertFiles(t, dir, 2)
+}
+
+func TestAbort(t *testing.T) {
+	dir := t.TempDir()
+	a := write(t, dir, "a", "old a")
+	var s Stage
+	stage(t, &s, a, "new a")
+
+	if err := s.Abort(); err != nil {
+		t.Fatalf("Abort() returned unexpected error: %v", err)
+	}
+
+	assertContents(t, a, "old a")
+	assertFiles(t, dir, 1)
+}
+
+func TestCommitFailure(t *testing.T) {
+	dir := t.TempDir()
+	a, b := write(t, dir, "a", "old a"), write(t, dir, "b", "old b")
+	var s Stage
+	stage(t, &s, a, "new a")
+	stage(t, &s, b, "new b")
+	// replacing b fails after a has been replaced
+	if err := os.Remove(s.files[1].temp); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Commit(); err == nil {
+		t.Fatal("Commit() returned no error")
+	}
+
+	assertContents(t, a, "old a")
+	assertContents(t, b, "old b")
+	assertFiles(t, dir, 2)
+}
+
+func write(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func stage(t *testing.T, s *Stage, target, contents string) {
+	t.Helper()
+	err := s.Write(target, func(w io.Writer) error {
+		_, err := io.WriteString(w, contents)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Write(%s) returned unexpected error: %v", target, err)
+	}
+}
+
+func assertContents(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("%s contains %q, want %q", path, got, want)
+	}
+}
+
+func assertFiles(t *testing.T, dir string, want int) {
+	t.Helper()
+	es, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != want {
+		t.Errorf("%s contains %d files, want %d", dir, len(es), want)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table
+
+import (
+	"io"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Renderer renders a table.
+type Renderer interface {
+	Render(t *Table, w io.Writer) error
+}
+
+var (
+	_ Renderer = (*TextRenderer)(nil)
+	_ Renderer = (*SparklineRenderer)(nil)
+)
+
+// SparklineRenderer renders a table as text, replacing the numeric columns
+// by a sparkline chart of each row, followed by the value in the last
+// column. The leading columns without numbers are kept as labels.
+type SparklineRenderer struct {
+	Color     bool
+	Thousands bool
+	Round     int32
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Render renders the table.
+func (r *SparklineRenderer) Render(t *Table, w io.Writer) error {
+	tr := TextRenderer{
+		Color:     r.Color,
+		Thousands: r.Thousands,
+		Round:     r.Round,
+	}
+	return tr.Render(chart(t), w)
+}
+
+// chart converts the table into a table with the label columns, a column
+// with the sparklines and a column with the last values.
+func chart(t *Table) *Table {
+	labels := t.Width()
+	for _, row := range t.rows {
+		for i, c := range row.cells {
+			if _, ok := c.(numberCell); ok && i < labels {
+				labels = i
+			}
+		}
+	}
+	if labels == t.Width() {
+		return t
+	}
+	groups := make([]int, labels+2)
+	for i := range groups {
+		groups[i] = 1
+	}
+	res := New(groups...)
+	for _, row := range t.rows {
+		if row.cells[0].isSep() {
+			res.AddSeparatorRow()
+			continue
+		}
+		var (
+			rr     = &Row{header: row.header}
+			values []decimal.Decimal
+			texts  []string
+			number bool
+		)
+		res.rows = append(res.rows, rr)
+		for i, c := range row.cells {
+			if i < labels {
+				rr.addCell(c)
+				continue
+			}
+			switch c := c.(type) {
+			case numberCell:
+				values, number = append(values, c.n), true
+			case textCell:
+				texts = append(texts, c.Content)
+			default:
+				values = append(values, decimal.Zero)
+			}
+		}
+		switch {
+		case number:
+			rr.AddText(sparkline(values), Left)
+			if last := values[len(values)-1]; last.IsZero() {
+				rr.AddEmpty()
+			} else {
+				rr.AddNumber(last)
+			}
+		case len(texts) > 1:
+			rr.AddText(texts[0]+" - "+texts[len(texts)-1], Center).AddText(texts[len(texts)-1], Center)
+		case len(texts) == 1:
+			rr.AddText(texts[0], Center).AddText(texts[0], Center)
+		default:
+			rr.AddEmpty().AddEmpty()
+		}
+	}
+	return res
+}
+
+// sparkline renders the values as a sparkline, scaled between the minimum
+// and the maximum of the values.
+func sparkline(values []decimal.Decimal) string {
+	if len(values) == 0 {
+		return ""
+	}
+	min, max := values[0], values[0]
+	for _, v := range values[1:] {
+		if v.LessThan(min) {
+			min = v
+		}
+		if v.GreaterThan(max) {
+			max = v
+		}
+	}
+	var (
+		b     strings.Builder
+		span  = max.Sub(min)
+		steps = decimal.NewFromInt(int64(len(sparks) - 1))
+	)
+	for _, v := range values {
+		i := len(sparks) / 2
+		if !span.IsZero() {
+			i = int(v.Sub(min).Mul(steps).Div(span).Round(0).IntPart())
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		desc   string
+		values []int64
+		want   string
+	}{
+		{"empty", nil, ""},
+		{"constant", []int64{5, 5, 5}, "▅▅▅"},
+		{"increasing", []int64{0, 1, 2, 3, 4, 5, 6, 7}, "▁▂▃▄▅▆▇█"},
+		{"negative", []int64{-10, 0, -5}, "▁█▅"},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			var values []decimal.Decimal
+			for _, v := range test.values {
+				values = append(values, decimal.NewFromInt(v))
+			}
+
+			got := sparkline(values)
+
+			if got != test.want {
+				t.Errorf("sparkline(%v) = %q, want %q", test.values, got, test.want)
+			}
+		})
+	}
+}
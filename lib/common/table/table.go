@@ -47,12 +47,20 @@ func (t *Table) Width() int {
 func (t *Table) AddRow() *Row {
 	var (
 		cells = make([]cell, 0, t.Width())
-		row   = &Row{cells}
+		row   = &Row{cells: cells}
 	)
 	t.rows = append(t.rows, row)
 	return row
 }
 
+// AddHeaderRow adds a header row. Renderers which support it keep header
+// rows visible when scrolling.
+func (t *Table) AddHeaderRow() *Row {
+	row := t.AddRow()
+	row.header = true
+	return row
+}
+
 // AddSeparatorRow adds a separator row.
 func (t *Table) AddSeparatorRow() {
 	r := t.AddRow()
@@ -71,7 +79,8 @@ func (t *Table) AddEmptyRow() {
 
 // Row is a table row.
 type Row struct {
-	cells []cell
+	cells  []cell
+	header bool
 }
 
 func (r *Row) addCell(c cell) {
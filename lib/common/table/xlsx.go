@@ -0,0 +1,295 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Sheet is a named table in a workbook.
+type Sheet struct {
+	Name  string
+	Table *Table
+}
+
+// XLSXRenderer renders tables to an Excel workbook. Numbers are stored
+// unrounded and formatted with thousands separators and the given number of
+// digits. Header rows are bold and frozen, separator rows are omitted.
+type XLSXRenderer struct {
+	Thousands bool
+	Round     int32
+}
+
+// Render renders the table to a workbook with a single sheet.
+func (r *XLSXRenderer) Render(t *Table, w io.Writer) error {
+	return r.RenderSheets(w, Sheet{Name: "Report", Table: t})
+}
+
+// RenderSheets renders the tables to a workbook with one sheet per table.
+func (r *XLSXRenderer) RenderSheets(w io.Writer, sheets ...Sheet) error {
+	z := zip.NewWriter(w)
+	names := make([]string, len(sheets))
+	for i, s := range sheets {
+		names[i] = sheetName(s.Name, i)
+	}
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"[Content_Types].xml", func(w io.Writer) error { return writeContentTypes(w, len(sheets)) }},
+		{"_rels/.rels", func(w io.Writer) error { return writeXML(w, rootRels) }},
+		{"xl/workbook.xml", func(w io.Writer) error { return writeWorkbook(w, names) }},
+		{"xl/_rels/workbook.xml.rels", func(w io.Writer) error { return writeWorkbookRels(w, len(sheets)) }},
+		{"xl/styles.xml", func(w io.Writer) error { return writeXML(w, fmt.Sprintf(styles, numberFormat(r.Round))) }},
+	}
+	for i, s := range sheets {
+		t := s.Table
+		files = append(files, struct {
+			name  string
+			write func(io.Writer) error
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), func(w io.Writer) error { return r.writeSheet(w, t) }})
+	}
+	for _, f := range files {
+		fw, err := z.Create(f.name)
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(fw)
+		if err := f.write(bw); err != nil {
+			return err
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// cell styles, indexes into cellXfs in styles.xml
+const (
+	styleDefault = iota
+	styleNumber
+	styleRight
+	styleCenter
+	styleHeader
+	styleHeaderNumber
+)
+
+const styles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="%s"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="6">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0" applyAlignment="1"><alignment horizontal="right"/></xf>
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0" applyAlignment="1"><alignment horizontal="center"/></xf>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyAlignment="1"><alignment horizontal="center"/></xf>
+<xf numFmtId="164" fontId="1" fillId="0" borderId="0" xfId="0" applyNumberFormat="1" applyFont="1"/>
+</cellXfs>
+</styleSheet>`
+
+const rootRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+// numberFormat returns the number format with thousands separators and the
+// given number of digits. Negative numbers are red.
+func numberFormat(digits int32) string {
+	f := "#,##0"
+	if digits > 0 {
+		f += "." + strings.Repeat("0", int(digits))
+	}
+	return f + ";[Red]-" + f
+}
+
+func writeXML(w io.Writer, content string) error {
+	_, err := io.WriteString(w, xml.Header+content)
+	return err
+}
+
+func writeContentTypes(w io.Writer, n int) error {
+	var b strings.Builder
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+`)
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", i)
+	}
+	b.WriteString(`</Types>`)
+	return writeXML(w, b.String())
+}
+
+func writeWorkbook(w io.Writer, names []string) error {
+	var b strings.Builder
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets>
+`)
+	for i, name := range names {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`+"\n", escape(name), i+1, i+1)
+	}
+	b.WriteString(`</sheets>
+</workbook>`)
+	return writeXML(w, b.String())
+}
+
+func writeWorkbookRels(w io.Writer, n int) error {
+	var b strings.Builder
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+`)
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", i, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`+"\n", n+1)
+	b.WriteString(`</Relationships>`)
+	return writeXML(w, b.String())
+}
+
+func (r *XLSXRenderer) writeSheet(w io.Writer, t *Table) error {
+	var rows []*Row
+	for _, row := range t.rows {
+		if len(row.cells) == 0 || !row.cells[0].isSep() {
+			rows = append(rows, row)
+		}
+	}
+	var frozen int
+	for i, row := range rows {
+		if row.header {
+			frozen = i + 1
+		}
+	}
+	widths := make([]int, t.Width())
+	for _, row := range rows {
+		for i, c := range row.cells {
+			if l := r.width(c); widths[i] < l {
+				widths[i] = l
+			}
+		}
+	}
+	var b strings.Builder
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+`)
+	if frozen > 0 {
+		fmt.Fprintf(&b, `<sheetViews><sheetView workbookViewId="0"><pane ySplit="%d" topLeftCell="A%d" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`+"\n", frozen, frozen+1)
+	}
+	if len(widths) > 0 {
+		b.WriteString("<cols>")
+		for i, w := range widths {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, w+2)
+		}
+		b.WriteString("</cols>\n")
+	}
+	b.WriteString("<sheetData>\n")
+	for i, row := range rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, c := range row.cells {
+			r.writeCell(&b, fmt.Sprintf("%s%d", columnName(j), i+1), c, row.header)
+		}
+		b.WriteString("</row>\n")
+	}
+	b.WriteString(`</sheetData>
+</worksheet>`)
+	return writeXML(w, b.String())
+}
+
+func (r *XLSXRenderer) writeCell(b *strings.Builder, ref string, c cell, header bool) {
+	switch t := c.(type) {
+	case textCell:
+		style := styleDefault
+		switch {
+		case header:
+			style = styleHeader
+		case t.Align == Right:
+			style = styleRight
+		case t.Align == Center:
+			style = styleCenter
+		}
+		content := t.Content
+		if t.Align == Left {
+			content = strings.Repeat(" ", t.Indent) + content
+		}
+		fmt.Fprintf(b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, escape(content))
+	case numberCell:
+		style := styleNumber
+		if header {
+			style = styleHeaderNumber
+		}
+		n := t.n
+		if r.Thousands {
+			n = n.Div(k)
+		}
+		fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, n.String())
+	}
+}
+
+// width returns the width of the cell in characters.
+func (r *XLSXRenderer) width(c cell) int {
+	switch t := c.(type) {
+	case textCell:
+		return t.Indent + utf8.RuneCountInString(t.Content)
+	case numberCell:
+		n := t.n
+		if r.Thousands {
+			n = n.Div(k)
+		}
+		return utf8.RuneCountInString(addThousandsSep(n.StringFixed(r.Round)))
+	}
+	return 0
+}
+
+// columnName returns the name of the column with the given zero-based
+// index, e.g. A, Z, AA.
+func columnName(i int) string {
+	var res []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		res = append([]byte{byte('A' + (i-1)%26)}, res...)
+	}
+	return string(res)
+}
+
+// sheetName returns a valid sheet name: sheet names must not be empty,
+// have at most 31 characters and must not contain any of []:*?/\.
+func sheetName(name string, i int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		return fmt.Sprintf("Sheet%d", i+1)
+	}
+	if rs := []rune(name); len(rs) > 31 {
+		name = string(rs[:31])
+	}
+	return name
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,89 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func readZipFile(t *testing.T, bs []byte, name string) string {
+	t.Helper()
+	z, err := zip.NewReader(bytes.NewReader(bs), int64(len(bs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := z.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestXLSXRenderer(t *testing.T) {
+	tbl := New(1, 1)
+	tbl.AddSeparatorRow()
+	tbl.AddHeaderRow().AddText("Account", Center).AddText("2020-01-31", Center)
+	tbl.AddSeparatorRow()
+	tbl.AddRow().AddIndented("Assets", 0).AddEmpty()
+	tbl.AddRow().AddIndented("Bank & Co", 2).AddNumber(decimal.RequireFromString("-1234.5678"))
+	tbl.AddEmptyRow()
+	var buf bytes.Buffer
+	r := XLSXRenderer{Round: 2, Thousands: true}
+
+	if err := r.RenderSheets(&buf, Sheet{Name: "Alice", Table: tbl}, Sheet{Name: "a/b", Table: tbl}); err != nil {
+		t.Fatalf("RenderSheets() returned unexpected error: %v", err)
+	}
+
+	sheet := readZipFile(t, buf.Bytes(), "xl/worksheets/sheet1.xml")
+	for _, want := range []string{
+		`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`,
+		`<row r="1"><c r="A1" s="4" t="inlineStr"><is><t xml:space="preserve">Account</t></is></c>`,
+		`<c r="A3" s="0" t="inlineStr"><is><t xml:space="preserve">  Bank &amp; Co</t></is></c><c r="B3" s="1"><v>-1.2345678</v></c>`,
+		`<row r="4"></row>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet does not contain %s:\n%s", want, sheet)
+		}
+	}
+	styles := readZipFile(t, buf.Bytes(), "xl/styles.xml")
+	if want := `formatCode="#,##0.00;[Red]-#,##0.00"`; !strings.Contains(styles, want) {
+		t.Errorf("styles do not contain %s:\n%s", want, styles)
+	}
+	workbook := readZipFile(t, buf.Bytes(), "xl/workbook.xml")
+	for _, want := range []string{`<sheet name="Alice" sheetId="1" r:id="rId1"/>`, `<sheet name="a_b" sheetId="2" r:id="rId2"/>`} {
+		if !strings.Contains(workbook, want) {
+			t.Errorf("workbook does not contain %s:\n%s", want, workbook)
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pdftable extracts tables from PDF statements. The PDF is converted
+// to text with pdftotext (part of poppler), which preserves the physical
+// layout of the page. Tables are located by their header line and their rows
+// are split into columns based on the position of the column titles.
+package pdftable
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Spec describes a table.
+type Spec struct {
+	// Columns are the column titles, in the order in which they appear in the
+	// header line of the table.
+	Columns []string
+
+	// End optionally matches the first line after the table. Otherwise, the
+	// table extends until the header of another table is found.
+	End *regexp.Regexp
+}
+
+// Text converts the PDF file at path to text, preserving the layout.
+func Text(ctx context.Context, path string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "pdftotext", "-layout", path, "-")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return "", fmt.Errorf("pdftotext: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return "", fmt.Errorf("pdftotext: %w", err)
+	}
+	return stdout.String(), nil
+}
+
+// ReadFile extracts the tables described by specs from the PDF file at path.
+func ReadFile(ctx context.Context, path string, specs ...Spec) ([][]string, error) {
+	text, err := Text(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return Rows(text, specs...), nil
+}
+
+// Rows extracts the rows of the tables described by specs from text. The
+// header line of each table is returned as a row, too. Every row has as many
+// fields as its table has columns.
+func Rows(text string, specs ...Spec) [][]string {
+	var (
+		res   [][]string
+		table *table
+	)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r\f")
+		if t, ok := findHeader(line, specs); ok {
+			table = t
+			res = append(res, append([]string(nil), t.spec.Columns...))
+			continue
+		}
+		if table == nil || len(line) == 0 {
+			continue
+		}
+		if table.spec.End != nil && table.spec.End.MatchString(line) {
+			table = nil
+			continue
+		}
+		res = append(res, table.split(line))
+	}
+	return res
+}
+
+// CSV returns the rows encoded as CSV, to be consumed by the existing
+// CSV-based parsers.
+func CSV(rows [][]string) io.Reader {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	// Writing to a bytes.Buffer does not fail.
+	w.WriteAll(rows)
+	return &buf
+}
+
+type table struct {
+	spec    Spec
+	columns []span
+}
+
+// span is a range of character positions in a line.
+type span struct {
+	start, end int
+}
+
+func (s span) overlap(o span) int {
+	return min(s.end, o.end) - max(s.start, o.start)
+}
+
+func (s span) distance(o span) int {
+	if d := o.start - s.end; d > 0 {
+		return d
+	}
+	if d := s.start - o.end; d > 0 {
+		return d
+	}
+	return 0
+}
+
+func findHeader(line string, specs []Spec) (*table, bool) {
+	for _, spec := range specs {
+		var (
+			columns []span
+			pos     int
+		)
+		for _, title := range spec.Columns {
+			i := strings.Index(line[pos:], title)
+			if i < 0 {
+				break
+			}
+			start := utf8.RuneCountInString(line[:pos+i])
+			columns = append(columns, span{start, start + utf8.RuneCountInString(title)})
+			pos += i + len(title)
+		}
+		if len(columns) == len(spec.Columns) && len(columns) > 0 {
+			return &table{spec: spec, columns: columns}, true
+		}
+	}
+	return nil, false
+}
+
+// split splits the line into chunks separated by at least two spaces and
+// assigns each chunk to the column it overlaps most, or to the closest
+// column if it does not overlap any.
+func (t *table) split(line string) []string {
+	res := make([]string, len(t.columns))
+	for _, c := range chunks(line) {
+		best, bestOverlap, bestDistance := 0, 0, -1
+		for i, col := range t.columns {
+			if o := c.span.overlap(col); o > bestOverlap {
+				best, bestOverlap = i, o
+			} else if bestOverlap == 0 {
+				if d := c.span.distance(col); bestDistance < 0 || d < bestDistance {
+					best, bestDistance = i, d
+				}
+			}
+		}
+		if len(res[best]) > 0 {
+			res[best] += " "
+		}
+		res[best] += c.text
+	}
+	return res
+}
+
+type chunk struct {
+	span span
+	text string
+}
+
+var separator = regexp.MustCompile(`\S+(?: \S+)*`)
+
+func chunks(line string) []chunk {
+	var res []chunk
+	for _, loc := range separator.FindAllStringIndex(line, -1) {
+		start := utf8.RuneCountInString(line[:loc[0]])
+		text := line[loc[0]:loc[1]]
+		res = append(res, chunk{
+			span: span{start, start + utf8.RuneCountInString(text)},
+			text: text,
+		})
+	}
+	return res
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,81 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pdftable
+
+import (
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const statement = `
+                                                    Kartenabrechnung
+
+   Verbucht am     Beschreibung                              Gutschrift CHF      Belastung CHF
+                   Saldovortrag letzte Rechnung                                       1'234.56
+   04.09.2020      Ihre LSV-Zahlung - Besten Dank                 1'234.56
+
+   Einkaufs-Datum   Verbucht am   Beschreibung                   Gutschrift CHF    Belastung CHF
+   22.08.2020       24.08.2020    Migros Zürich                                            12.34
+   09.09.2020       10.09.2020    Amazon  Marketplace                                   1'233.45
+                                  USD 1'350.00 Kurs 0.9136
+   Total                                                                            1'245.79
+
+   Seite 1 von 2
+`
+
+func TestRows(t *testing.T) {
+	var (
+		short = Spec{Columns: []string{"Verbucht am", "Beschreibung", "Gutschrift CHF", "Belastung CHF"}}
+		long  = Spec{
+			Columns: []string{"Einkaufs-Datum", "Verbucht am", "Beschreibung", "Gutschrift CHF", "Belastung CHF"},
+			End:     regexp.MustCompile(`^\s*Total`),
+		}
+	)
+
+	got := Rows(statement, long, short)
+
+	want := [][]string{
+		{"Verbucht am", "Beschreibung", "Gutschrift CHF", "Belastung CHF"},
+		{"", "Saldovortrag letzte Rechnung", "", "1'234.56"},
+		{"04.09.2020", "Ihre LSV-Zahlung - Besten Dank", "1'234.56", ""},
+		{"Einkaufs-Datum", "Verbucht am", "Beschreibung", "Gutschrift CHF", "Belastung CHF"},
+		{"22.08.2020", "24.08.2020", "Migros Zürich", "", "12.34"},
+		{"09.09.2020", "10.09.2020", "Amazon Marketplace", "", "1'233.45"},
+		{"", "", "USD 1'350.00 Kurs 0.9136", "", ""},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Rows() returned unexpected diff (-want/+got):\n%s", diff)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	rows := [][]string{
+		{"Verbucht am", "Beschreibung"},
+		{"04.09.2020", `Zahlung "LSV", Besten Dank`},
+	}
+
+	b, err := io.ReadAll(CSV(rows))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Verbucht am,Beschreibung\n04.09.2020,\"Zahlung \"\"LSV\"\", Besten Dank\"\n"
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Fatalf("CSV() returned unexpected diff (-want/+got):\n%s", diff)
+	}
+}
@@ -17,6 +17,7 @@ package journal
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"unicode"
@@ -124,6 +125,11 @@ func (a Account) IsIE() bool {
 	return a.accountType == EXPENSES || a.accountType == INCOME
 }
 
+// Contains returns whether b is a or one of its descendants.
+func (a *Account) Contains(b *Account) bool {
+	return a == b || strings.HasPrefix(b.name, a.name+":")
+}
+
 func (a Account) String() string {
 	return a.name
 }
@@ -179,6 +185,8 @@ type Accounts struct {
 	children map[*Account]set.Set[*Account]
 	parents  map[*Account]*Account
 	swaps    map[*Account]*Account
+
+	valuation map[*Account]*Account
 }
 
 // NewAccounts creates a new thread-safe collection of accounts.
@@ -200,6 +208,8 @@ func NewAccounts() *Accounts {
 		parents:  make(map[*Account]*Account),
 		children: make(map[*Account]set.Set[*Account]),
 		swaps:    make(map[*Account]*Account),
+
+		valuation: make(map[*Account]*Account),
 	}
 }
 
@@ -283,6 +293,18 @@ func (as *Accounts) ancestors(a *Account) []*Account {
 	return append(res, a)
 }
 
+// All returns all accounts, sorted by type and name.
+func (as *Accounts) All() []*Account {
+	as.mutex.RLock()
+	res := make([]*Account, 0, len(as.index))
+	for _, a := range as.index {
+		res = append(res, a)
+	}
+	as.mutex.RUnlock()
+	compare.Sort(res, CompareAccounts)
+	return res
+}
+
 // Children returns the children of this account.
 func (as *Accounts) Children(a *Account) []*Account {
 	as.mutex.RLock()
@@ -343,13 +365,34 @@ func (as *Accounts) SwapType(a *Account) *Account {
 
 }
 
-// Rule is a rule to shorten accounts which match the given regex.
+// SetValuationAccount overrides the valuation account of a.
+func (as *Accounts) SetValuationAccount(a, v *Account) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	as.valuation[a] = v
+}
+
+// ValuationAccount returns the valuation account of a, if it has been
+// overridden.
+func (as *Accounts) ValuationAccount(a *Account) (*Account, bool) {
+	as.mutex.RLock()
+	defer as.mutex.RUnlock()
+	v, ok := as.valuation[a]
+	return v, ok
+}
+
+// Rule is a rule to shorten accounts which match the given regex, or,
+// if Glob is set, to map accounts matching the glob to its target.
 type Rule struct {
 	Level int
 	Regex *regexp.Regexp
+	Glob  *Glob
 }
 
 func (r Rule) String() string {
+	if r.Glob != nil {
+		return r.Glob.String()
+	}
 	return fmt.Sprintf("%d,%v", r.Level, r.Regex)
 }
 
@@ -364,26 +407,72 @@ func (m AccountMapping) String() string {
 	return strings.Join(s, ", ")
 }
 
-// level returns the level to which an account should be shortened.
-func (m AccountMapping) level(a *Account) int {
+// ParseDepths parses a comma-separated list of <account>:<depth> pairs,
+// such as Assets:2,Expenses:1, into rules which collapse the given
+// accounts and their subaccounts to the given depth.
+func ParseDepths(s string) (AccountMapping, error) {
+	var res AccountMapping
+	for _, d := range strings.Split(s, ",") {
+		d = strings.TrimSpace(d)
+		i := strings.LastIndex(d, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid depth %q, expected <account>:<depth>", d)
+		}
+		name := d[:i]
+		level, err := strconv.Atoi(d[i+1:])
+		if err != nil || level < 0 {
+			return nil, fmt.Errorf("invalid depth %q, expected a nonnegative integer after the account", d)
+		}
+		segments := strings.Split(name, ":")
+		if !isType(segments[0]) {
+			return nil, fmt.Errorf("invalid account %q in depth %q", name, d)
+		}
+		for _, seg := range segments {
+			if len(seg) == 0 {
+				return nil, fmt.Errorf("invalid account %q in depth %q", name, d)
+			}
+		}
+		res = append(res, Rule{
+			Level: level,
+			Regex: regexp.MustCompile("^" + regexp.QuoteMeta(name) + "(:|$)"),
+		})
+	}
+	return res, nil
+}
+
+// apply applies the first matching rule to the account.
+func (m AccountMapping) apply(jctx Context, a *Account) *Account {
 	for _, c := range m {
+		if c.Glob != nil {
+			if name, ok := c.Glob.Map(a.name); ok {
+				return jctx.Account(name)
+			}
+			continue
+		}
 		if c.Regex == nil || c.Regex.MatchString(a.name) {
-			return c.Level
+			if c.Level >= a.level {
+				return a
+			}
+			return jctx.Accounts().NthParent(a, a.level-c.Level)
 		}
 	}
-	return a.level
+	return a
 }
 
+// ShortenAccount maps accounts according to the first matching rule of
+// the mapping.
 func ShortenAccount(jctx Context, m AccountMapping) mapper.Mapper[*Account] {
 	if len(m) == 0 {
 		return mapper.Identity[*Account]
 	}
+	var (
+		mutex sync.Mutex
+		cache = make(map[*Account]*Account)
+	)
 	return func(a *Account) *Account {
-		level := m.level(a)
-		if level >= a.level {
-			return a
-		}
-		return jctx.Accounts().NthParent(a, a.level-level)
+		mutex.Lock()
+		defer mutex.Unlock()
+		return dict.GetDefault(cache, a, func() *Account { return m.apply(jctx, a) })
 	}
 }
 
@@ -2,12 +2,14 @@ package journal
 
 import (
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/sboehler/knut/lib/common/compare"
 	"github.com/sboehler/knut/lib/common/dict"
 	"github.com/sboehler/knut/lib/common/filter"
 	"github.com/sboehler/knut/lib/common/mapper"
+	"github.com/sboehler/knut/lib/common/regex"
 	"github.com/sboehler/knut/lib/common/set"
 	"github.com/shopspring/decimal"
 )
@@ -19,6 +21,22 @@ type Key struct {
 	Commodity      *Commodity
 	Valuation      *Commodity
 	Description    string
+	Member         string
+	Flag           Flag
+
+	// Tags holds the tags of the transaction, separated by spaces.
+	Tags string
+
+	// Links holds the links of the transaction, separated by spaces.
+	Links string
+
+	// Metadata holds the metadata of the transaction and the posting as
+	// key=value, separated by newlines.
+	Metadata string
+
+	// Transaction is the transaction of the posting, which tells apart
+	// the postings of different transactions.
+	Transaction *Transaction
 }
 
 func DateKey(d time.Time) Key {
@@ -152,7 +170,9 @@ type KeyMapper struct {
 	Date                 mapper.Mapper[time.Time]
 	Account, Other       mapper.Mapper[*Account]
 	Commodity, Valuation mapper.Mapper[*Commodity]
-	Description          mapper.Mapper[string]
+	Description, Member  mapper.Mapper[string]
+	Tags                 mapper.Mapper[string]
+	Transaction          mapper.Mapper[*Transaction]
 }
 
 func (km KeyMapper) Build() mapper.Mapper[Key] {
@@ -176,6 +196,15 @@ func (km KeyMapper) Build() mapper.Mapper[Key] {
 		if km.Description != nil {
 			res.Description = km.Description(k.Description)
 		}
+		if km.Member != nil {
+			res.Member = km.Member(k.Member)
+		}
+		if km.Tags != nil {
+			res.Tags = km.Tags(k.Tags)
+		}
+		if km.Transaction != nil {
+			res.Transaction = km.Transaction(k.Transaction)
+		}
 		return res
 	}
 }
@@ -213,3 +242,172 @@ func FilterOther(r []*regexp.Regexp) filter.Filter[Key] {
 		return f(k.Other)
 	}
 }
+
+// FilterTag accepts keys with a tag matching one of the regexes. The
+// regexes are matched against the tags without the leading '#'.
+func FilterTag(rx []*regexp.Regexp) filter.Filter[Key] {
+	if len(rx) == 0 {
+		return filter.AllowAll[Key]
+	}
+	rxs := regex.Regexes(rx)
+	return func(k Key) bool {
+		for _, tag := range k.TagList() {
+			if rxs.MatchString(strings.TrimPrefix(string(tag), "#")) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterTagValues accepts keys with one of the given tags, each given as
+// key or key=value. A tag given as key matches the tag with any value.
+func FilterTagValues(tags []string) filter.Filter[Key] {
+	if len(tags) == 0 {
+		return filter.AllowAll[Key]
+	}
+	return func(k Key) bool {
+		for _, tag := range k.TagList() {
+			for _, t := range tags {
+				key, value, hasValue := strings.Cut(t, "=")
+				if tag.Key() == key && (!hasValue || tag.Value() == value) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// FilterLink accepts keys with a link matching one of the regexes. The
+// regexes are matched against the links without the leading '^'.
+func FilterLink(rx []*regexp.Regexp) filter.Filter[Key] {
+	if len(rx) == 0 {
+		return filter.AllowAll[Key]
+	}
+	rxs := regex.Regexes(rx)
+	return func(k Key) bool {
+		for _, link := range strings.Fields(k.Links) {
+			if rxs.MatchString(strings.TrimPrefix(link, "^")) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterFlags accepts keys with one of the given transaction flags, or all
+// keys if there are no flags.
+func FilterFlags(flags ...Flag) filter.Filter[Key] {
+	if len(flags) == 0 {
+		return filter.AllowAll[Key]
+	}
+	return func(k Key) bool {
+		for _, f := range flags {
+			if k.Flag == f {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterMetadata accepts keys with metadata matching one of the regexes.
+// The regexes are matched against each entry as key=value.
+func FilterMetadata(rx []*regexp.Regexp) filter.Filter[Key] {
+	if len(rx) == 0 {
+		return filter.AllowAll[Key]
+	}
+	rxs := regex.Regexes(rx)
+	return func(k Key) bool {
+		for _, m := range strings.Split(k.Metadata, "\n") {
+			if m != "" && rxs.MatchString(m) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TagList returns the tags of the key.
+func (k Key) TagList() []Tag {
+	fields := strings.Fields(k.Tags)
+	res := make([]Tag, 0, len(fields))
+	for _, f := range fields {
+		res = append(res, Tag(f))
+	}
+	return res
+}
+
+// MapTags maps the tags of a key to the tags matching one of the regexes,
+// or leaves them unchanged if there are no regexes. The regexes are matched
+// against the tags without the leading '#'.
+func MapTags(rx []*regexp.Regexp) mapper.Mapper[string] {
+	if len(rx) == 0 {
+		return mapper.Identity[string]
+	}
+	rxs := regex.Regexes(rx)
+	return func(tags string) string {
+		var res []string
+		for _, tag := range strings.Fields(tags) {
+			if rxs.MatchString(strings.TrimPrefix(tag, "#")) {
+				res = append(res, tag)
+			}
+		}
+		return strings.Join(res, " ")
+	}
+}
+
+// MapTagKey maps the tags of a key to the tags with the given key, such
+// that a report pivoted by tags has a column per value of the tag.
+func MapTagKey(key string) mapper.Mapper[string] {
+	return func(tags string) string {
+		var res []string
+		for _, tag := range strings.Fields(tags) {
+			if Tag(tag).Key() == key {
+				res = append(res, tag)
+			}
+		}
+		return strings.Join(res, " ")
+	}
+}
+
+// FilterValuationGains rejects the valuation gains of commodities matching
+// one of the regexes, i.e. the postings on the valuation accounts of asset
+// and liability accounts. As the valuated positions are kept, the gains show
+// up in the delta of a report.
+func FilterValuationGains(jctx Context, rx []*regexp.Regexp) filter.Filter[Key] {
+	if len(rx) == 0 {
+		return filter.AllowAll[Key]
+	}
+	f := filter.ByName[*Commodity](rx)
+	return func(k Key) bool {
+		return !(f(k.Commodity) && isValuationAccountOf(jctx, k.Account, k.Other))
+	}
+}
+
+// MapValuationGains books the valuation gains of commodities matching one
+// of the regexes to the target account instead of the valuation account.
+func MapValuationGains(jctx Context, rx []*regexp.Regexp, target *Account) mapper.Mapper[Key] {
+	if len(rx) == 0 || target == nil {
+		return mapper.Identity[Key]
+	}
+	f := filter.ByName[*Commodity](rx)
+	return func(k Key) Key {
+		if !f(k.Commodity) {
+			return k
+		}
+		if isValuationAccountOf(jctx, k.Account, k.Other) {
+			k.Account = target
+		} else if isValuationAccountOf(jctx, k.Other, k.Account) {
+			k.Other = target
+		}
+		return k
+	}
+}
+
+// isValuationAccountOf returns whether v is the valuation account of the
+// asset or liability account a, taking valuation directives into account.
+func isValuationAccountOf(jctx Context, v, a *Account) bool {
+	return v != nil && a != nil && a.IsAL() && jctx.ValuationAccountFor(a) == v
+}
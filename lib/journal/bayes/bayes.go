@@ -15,9 +15,13 @@
 package bayes
 
 import (
+	"context"
 	"math"
+	"sort"
 	"strings"
 
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/cpr"
 	"github.com/sboehler/knut/lib/common/dict"
 	"github.com/sboehler/knut/lib/common/set"
 	"github.com/sboehler/knut/lib/journal"
@@ -41,6 +45,24 @@ func NewModel(exclude *journal.Account) *Model {
 	}
 }
 
+// Train creates a model from the transactions in the given journal file.
+func Train(ctx context.Context, jctx journal.Context, file string, exclude *journal.Account) (*Model, error) {
+	var (
+		j = journal.RecursiveParser{Context: jctx, File: file}
+		m = NewModel(exclude)
+	)
+	err := cpr.Consume(ctx, j.Parse(ctx), func(d any) error {
+		switch t := d.(type) {
+		case error:
+			return t
+		case *journal.Transaction:
+			m.Update(t)
+		}
+		return nil
+	})
+	return m, err
+}
+
 // Update updates the model with the given transaction.
 func (m *Model) Update(t *journal.Transaction) {
 	for _, p := range t.Postings {
@@ -61,46 +83,97 @@ func newCountByAccount() countByAccount {
 	return make(map[*journal.Account]int)
 }
 
-// Infer replaces the given account with an inferred account.
+// Candidate is an account with the probability that it is the account of
+// a posting.
+type Candidate struct {
+	Account     *journal.Account
+	Probability float64
+}
+
+// Candidates returns the accounts which may replace the account of the
+// posting, by decreasing probability. The given account and the other
+// account of the posting are no candidates.
 // P(A | T1 & T2 & ... & Tn) ~ P(A) * P(T1|A) * P(T2|A) * ... * P(Tn|A)
-func (m *Model) Infer(t *journal.Transaction, tbd *journal.Account) {
-	def := math.Log(1.0 / float64(m.count))
+func (m *Model) Candidates(t *journal.Transaction, posting *journal.Posting, tbd *journal.Account) []Candidate {
+	var (
+		def    = math.Log(1.0 / float64(m.count))
+		tokens = tokenize(t.Description, posting)
+		res    []Candidate
+		max    = math.Inf(-1)
+	)
+	for a, total := range m.countByAccount {
+		if a == tbd || a == posting.Other {
+			// ignore both TBD and the other account of this posting
+			continue
+		}
+		score := math.Log(float64(total) / float64(m.count))
+		for token := range tokens {
+			if countForToken, ok := m.countByTokenAndAccount[token][a]; ok {
+				score += math.Log(float64(countForToken) / float64(total))
+			} else {
+				// assign a low but positive default probability
+				score += def
+			}
+		}
+		if score > max {
+			max = score
+		}
+		res = append(res, Candidate{Account: a, Probability: score})
+	}
+	// normalize the scores, which are logarithms of unnormalized
+	// probabilities, relative to the maximum to avoid underflows
+	var sum float64
+	for i := range res {
+		res[i].Probability = math.Exp(res[i].Probability - max)
+		sum += res[i].Probability
+	}
+	for i := range res {
+		res[i].Probability /= sum
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Probability != res[j].Probability {
+			return res[i].Probability > res[j].Probability
+		}
+		return journal.CompareAccounts(res[i].Account, res[j].Account) == compare.Smaller
+	})
+	return res
+}
+
+// Infer replaces the given account with the most probable account, if
+// the confidence is at least minConfidence. The confidence is the lowest
+// probability of the accounts inferred for the postings of the
+// transaction, or 1 if there are no such postings. Postings without
+// candidates keep the given account. Infer returns the confidence.
+func (m *Model) Infer(t *journal.Transaction, tbd *journal.Account, minConfidence float64) float64 {
+	var (
+		confidence = 1.0
+		selected   = make(map[int]*journal.Account)
+	)
 	for i, posting := range t.Postings {
 		if posting.Account != tbd {
 			continue
 		}
-		scores := make(map[*journal.Account]float64)
-		tokens := tokenize(t.Description, posting)
-		for a, total := range m.countByAccount {
-			if a == tbd || a == posting.Other {
-				// ignore both TBD and the other account of this posting
-				continue
-			}
-			scores[a] = math.Log(float64(total) / float64(m.count))
-			for token := range tokens {
-				if countForToken, ok := m.countByTokenAndAccount[token][a]; ok {
-					scores[a] += math.Log(float64(countForToken) / float64(total))
-				} else {
-					// assign a low but positive default probability
-					scores[a] += def
-				}
-			}
+		cs := m.Candidates(t, posting, tbd)
+		if len(cs) == 0 {
+			continue
 		}
-		var selected *journal.Account
-		max := math.Inf(-1)
-		for a, score := range scores {
-			if score > max {
-				selected = a
-				max = score
-			}
+		if cs[0].Probability < confidence {
+			confidence = cs[0].Probability
 		}
-		posting.Account = selected
+		selected[i] = cs[0].Account
+	}
+	if confidence < minConfidence {
+		return confidence
+	}
+	for i, a := range selected {
+		t.Postings[i].Account = a
 		if i%2 == 0 {
-			t.Postings[i+1].Other = selected
+			t.Postings[i+1].Other = a
 		} else {
-			t.Postings[i-1].Other = selected
+			t.Postings[i-1].Other = a
 		}
 	}
+	return confidence
 }
 
 func tokenize(desc string, posting *journal.Posting) set.Set[string] {
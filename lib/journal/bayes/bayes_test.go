@@ -0,0 +1,166 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bayes
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestInferConfidence(t *testing.T) {
+	var (
+		jctx  = journal.NewContext()
+		bank  = jctx.Account("Assets:Bank")
+		food  = jctx.Account("Expenses:Food")
+		sport = jctx.Account("Expenses:Sport")
+		tbd   = jctx.Account("Expenses:TBD")
+		chf   = jctx.Commodity("CHF")
+		model = NewModel(tbd)
+	)
+	transaction := func(desc string, account *journal.Account, amount int64) *journal.Transaction {
+		return journal.TransactionBuilder{
+			Description: desc,
+			Postings: journal.PostingBuilder{
+				Credit:    bank,
+				Debit:     account,
+				Commodity: chf,
+				Amount:    decimal.NewFromInt(amount),
+			}.Build(),
+		}.Build()
+	}
+	model.Update(transaction("Migros Zurich", food, 80))
+	model.Update(transaction("Migros Basel", food, 50))
+	model.Update(transaction("Fitness club", sport, 60))
+
+	for _, test := range []struct {
+		desc          string
+		minConfidence float64
+		want          *journal.Account
+	}{
+		{"Migros Zurich", 0.8, food},
+		{"Something else", 0.8, tbd},
+		{"Something else", 0, food},
+	} {
+		trx := transaction(test.desc, tbd, 70)
+
+		confidence := model.Infer(trx, tbd, test.minConfidence)
+
+		if confidence <= 0 || confidence > 1 || math.IsNaN(confidence) {
+			t.Errorf("Infer(%q) returned invalid confidence %g", test.desc, confidence)
+		}
+		if got := trx.Postings[1].Account; got != test.want || trx.Postings[0].Other != test.want {
+			t.Errorf("Infer(%q, %g) booked the posting to %s, want %s", test.desc, test.minConfidence, got, test.want)
+		}
+	}
+}
+
+func TestInferMultiplePostings(t *testing.T) {
+	var (
+		jctx  = journal.NewContext()
+		bank  = jctx.Account("Assets:Bank")
+		food  = jctx.Account("Expenses:Food")
+		tbd   = jctx.Account("Expenses:TBD")
+		chf   = jctx.Commodity("CHF")
+		model = NewModel(tbd)
+	)
+	model.Update(journal.TransactionBuilder{
+		Description: "Migros",
+		Postings: journal.PostingBuilder{
+			Credit:    tbd,
+			Debit:     food,
+			Commodity: chf,
+			Amount:    decimal.NewFromInt(80),
+		}.Build(),
+	}.Build())
+	// food is the only candidate known to the model, so the posting
+	// against food has none
+	trx := journal.TransactionBuilder{
+		Description: "Migros",
+		Postings: journal.PostingBuilders{
+			{Credit: bank, Debit: tbd, Commodity: chf, Amount: decimal.NewFromInt(70)},
+			{Credit: food, Debit: tbd, Commodity: chf, Amount: decimal.NewFromInt(10)},
+		}.Build(),
+	}.Build()
+
+	confidence := model.Infer(trx, tbd, 0.5)
+
+	if confidence != 1 {
+		t.Errorf("Infer() returned confidence %g, want 1", confidence)
+	}
+	var got []string
+	for _, p := range trx.Postings {
+		got = append(got, p.Account.Name()+" "+p.Other.Name())
+	}
+	want := []string{
+		"Assets:Bank Expenses:Food",
+		"Expenses:Food Assets:Bank",
+		"Expenses:Food Expenses:TBD",
+		"Expenses:TBD Expenses:Food",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Infer() booked unexpected postings (-want/+got):\n%s", diff)
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	var (
+		jctx  = journal.NewContext()
+		bank  = jctx.Account("Assets:Bank")
+		tbd   = jctx.Account("Expenses:TBD")
+		chf   = jctx.Commodity("CHF")
+		model = NewModel(tbd)
+	)
+	for _, name := range []string{"Expenses:Food", "Expenses:Sport", "Expenses:Travel"} {
+		model.Update(journal.TransactionBuilder{
+			Description: name,
+			Postings: journal.PostingBuilder{
+				Credit:    bank,
+				Debit:     jctx.Account(name),
+				Commodity: chf,
+				Amount:    decimal.NewFromInt(10),
+			}.Build(),
+		}.Build())
+	}
+	trx := journal.TransactionBuilder{
+		Description: "Expenses:Sport",
+		Postings: journal.PostingBuilder{
+			Credit:    bank,
+			Debit:     tbd,
+			Commodity: chf,
+			Amount:    decimal.NewFromInt(10),
+		}.Build(),
+	}.Build()
+
+	cs := model.Candidates(trx, trx.Postings[1], tbd)
+
+	if len(cs) != 3 || cs[0].Account.Name() != "Expenses:Sport" {
+		t.Fatalf("Candidates() = %v, want Expenses:Sport first of 3", cs)
+	}
+	var sum float64
+	for i, c := range cs {
+		sum += c.Probability
+		if i > 0 && c.Probability > cs[i-1].Probability {
+			t.Errorf("Candidates() are not ordered by probability: %v", cs)
+		}
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("Candidates() have a total probability of %g, want 1", sum)
+	}
+}
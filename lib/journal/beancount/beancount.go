@@ -26,9 +26,21 @@ import (
 	"github.com/shopspring/decimal"
 )
 
-// Transcode transcodes the given ledger to beancount.
+// Transcode transcodes the given ledger to beancount. Postings keep their
+// amounts and commodities. Postings in other commodities than c carry their
+// value in c as total price, and postings with a lot carry it as cost.
+// Prices are transcoded as well, so that beancount can compute unrealized
+// gains itself, and knut's valuation adjustments are omitted.
 func Transcode(w io.Writer, l []*journal.Day, c *journal.Commodity) error {
-	if _, err := fmt.Fprintf(w, `option "operating_currency" "%s"`, c.Name()); err != nil {
+	if _, err := fmt.Fprintf(w, `option "operating_currency" "%s"`, stripNonAlphanum(c)); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return err
+	}
+	// Lots are reduced on both sides of a booking, e.g. in an equity
+	// account, so beancount must not match them against existing positions.
+	if _, err := io.WriteString(w, `option "booking_method" "NONE"`); err != nil {
 		return err
 	}
 	if _, err := io.WriteString(w, "\n\n"); err != nil {
@@ -38,16 +50,28 @@ func Transcode(w io.Writer, l []*journal.Day, c *journal.Commodity) error {
 	openValAccounts := set.New[*journal.Account]()
 	for _, day := range l {
 		for _, open := range day.Openings {
-			if _, err := p.PrintDirective(w, open); err != nil {
+			// postings are valuated, which breaks commodity constraints
+			if _, err := p.PrintDirective(w, &journal.Open{Date: open.Date, Account: open.Account}); err != nil {
 				return err
 			}
 			if _, err := io.WriteString(w, "\n\n"); err != nil {
 				return err
 			}
 		}
+		for _, price := range day.Prices {
+			if _, err := fmt.Fprintf(w, "%s price %s %s %s\n\n", price.Date.Format("2006-01-02"), stripNonAlphanum(price.Commodity), price.Price, stripNonAlphanum(price.Target)); err != nil {
+				return err
+			}
+		}
 		compare.Sort(day.Transactions, journal.CompareTransactions)
 
+		var trxs []*journal.Transaction
 		for _, trx := range day.Transactions {
+			if !isValuation(trx) {
+				trxs = append(trxs, trx)
+			}
+		}
+		for _, trx := range trxs {
 			for _, pst := range trx.Postings {
 				if strings.HasPrefix(pst.Account.Name(), "Equity:Valuation:") && !openValAccounts.Has(pst.Account) {
 					openValAccounts.Add(pst.Account)
@@ -60,13 +84,14 @@ func Transcode(w io.Writer, l []*journal.Day, c *journal.Commodity) error {
 				}
 			}
 		}
-		for _, trx := range day.Transactions {
+		for _, trx := range trxs {
 			if err := writeTrx(w, trx, c); err != nil {
 				return err
 			}
 		}
 		for _, close := range day.Closings {
-			if _, err := p.PrintDirective(w, close); err != nil {
+			// the residual positions have been booked by transactions
+			if _, err := p.PrintDirective(w, &journal.Close{Date: close.Date, Account: close.Account}); err != nil {
 				return err
 			}
 			if _, err := io.WriteString(w, "\n\n"); err != nil {
@@ -78,17 +103,30 @@ func Transcode(w io.Writer, l []*journal.Day, c *journal.Commodity) error {
 }
 
 func writeTrx(w io.Writer, t *journal.Transaction, c *journal.Commodity) error {
-	if _, err := fmt.Fprintf(w, `%s * "%s"`, t.Date.Format("2006-01-02"), t.Description); err != nil {
+	flag := journal.Cleared
+	if t.Flag == journal.Pending {
+		flag = journal.Pending
+	}
+	if _, err := fmt.Fprintf(w, `%s %c "%s"`, t.Date.Format("2006-01-02"), flag, t.Description); err != nil {
 		return err
 	}
 	for _, tag := range t.Tags {
-		if _, err := fmt.Fprintf(w, " %s", tag); err != nil {
+		// beancount tags cannot contain colons
+		if _, err := fmt.Fprintf(w, " %s", strings.ReplaceAll(string(tag), ":", "-")); err != nil {
+			return err
+		}
+	}
+	for _, link := range t.Links {
+		if _, err := fmt.Fprintf(w, " %s", link); err != nil {
 			return err
 		}
 	}
 	if _, err := io.WriteString(w, "\n"); err != nil {
 		return err
 	}
+	if err := writeMetadata(w, t.Metadata, "  "); err != nil {
+		return err
+	}
 	for _, p := range t.Postings {
 		if err := writePosting(w, p, c); err != nil {
 			return err
@@ -98,20 +136,57 @@ func writeTrx(w io.Writer, t *journal.Transaction, c *journal.Commodity) error {
 	return err
 }
 
-// WriteTo pretty-prints a posting.
-func writePosting(w io.Writer, p *journal.Posting, c *journal.Commodity) error {
-	var amt decimal.Decimal
-	if c == nil {
-		amt = p.Amount
-	} else {
-		amt = p.Value
+// isValuation returns whether the transaction only adjusts values.
+func isValuation(t *journal.Transaction) bool {
+	for _, p := range t.Postings {
+		if !p.Amount.IsZero() {
+			return false
+		}
 	}
-	if _, err := fmt.Fprintf(w, "  %s %s %s", p.Account.Name(), amt, stripNonAlphanum(c)); err != nil {
+	return true
+}
+
+// writePosting pretty-prints a posting.
+func writePosting(w io.Writer, p *journal.Posting, c *journal.Commodity) error {
+	if _, err := fmt.Fprintf(w, "  %s %s %s", p.Account.Name(), p.Amount, stripNonAlphanum(p.Commodity)); err != nil {
 		return err
 	}
+	switch {
+	case p.Lot != nil:
+		if _, err := fmt.Fprintf(w, " {%s %s", decimal.NewFromFloat(p.Lot.Price), stripNonAlphanum(p.Lot.Commodity)); err != nil {
+			return err
+		}
+		if !p.Lot.Date.IsZero() {
+			if _, err := fmt.Fprintf(w, ", %s", p.Lot.Date.Format("2006-01-02")); err != nil {
+				return err
+			}
+		}
+		if len(p.Lot.Label) > 0 {
+			if _, err := fmt.Fprintf(w, `, "%s"`, p.Lot.Label); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "}"); err != nil {
+			return err
+		}
+	case p.Commodity != c && !p.Value.IsZero():
+		if _, err := fmt.Fprintf(w, " @@ %s %s", p.Value.Abs(), stripNonAlphanum(c)); err != nil {
+			return err
+		}
+	}
 	if _, err := io.WriteString(w, "\n"); err != nil {
 		return err
 	}
+	return writeMetadata(w, p.Metadata, "    ")
+}
+
+// writeMetadata writes the metadata with the given indentation.
+func writeMetadata(w io.Writer, md journal.Metadata, indent string) error {
+	for _, m := range md {
+		if _, err := fmt.Fprintf(w, "%s%s: \"%s\"\n", indent, m.Key, m.Value); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
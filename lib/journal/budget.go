@@ -0,0 +1,140 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/shopspring/decimal"
+)
+
+// BudgetMonitor compares the month-to-date spending of accounts with their
+// budgets.
+type BudgetMonitor struct {
+	context   Context
+	month     date.Period
+	valuation *Commodity
+
+	budgets map[*Account]*Budget
+
+	// spent holds the amounts and values booked in the month per account
+	// and commodity.
+	amounts, values Amounts
+}
+
+// NewBudgetMonitor creates a monitor for the month up to and including t.
+// If v is not nil, spending in other commodities is converted to v for
+// budgets in v.
+func NewBudgetMonitor(jctx Context, t time.Time, v *Commodity) *BudgetMonitor {
+	return &BudgetMonitor{
+		context:   jctx,
+		month:     date.Period{Start: date.StartOf(t, date.Monthly), End: t},
+		valuation: v,
+		budgets:   make(map[*Account]*Budget),
+		amounts:   make(Amounts),
+		values:    make(Amounts),
+	}
+}
+
+// Process processes a day. It must run after Balance.
+func (bm *BudgetMonitor) Process(d *Day) error {
+	if d.Date.After(bm.month.End) {
+		return nil
+	}
+	for _, b := range d.Budgets {
+		if b.Amount.IsZero() {
+			delete(bm.budgets, b.Account)
+		} else {
+			bm.budgets[b.Account] = b
+		}
+	}
+	if !bm.month.Contains(d.Date) {
+		return nil
+	}
+	for _, t := range d.Transactions {
+		for _, p := range t.Postings {
+			k := AccountCommodityKey(p.Account, p.Commodity)
+			bm.amounts.Add(k, p.Amount)
+			bm.values.Add(k, p.Value)
+		}
+	}
+	return nil
+}
+
+// Alerts returns an error for each budget whose spending has reached its
+// alert threshold or exceeds the budgeted amount. Spending on an account is
+// attributed to the budget of the account or its closest ancestor.
+func (bm *BudgetMonitor) Alerts() []Error {
+	spent := make(map[*Budget]decimal.Decimal)
+	for _, k := range bm.amounts.Index(compareAccountCommodity) {
+		b := bm.budgetFor(k.Account)
+		if b == nil {
+			continue
+		}
+		switch {
+		case k.Commodity == b.Commodity:
+			spent[b] = spent[b].Add(bm.amounts[k])
+		case bm.valuation != nil && b.Commodity == bm.valuation:
+			spent[b] = spent[b].Add(bm.values[k])
+		}
+	}
+	var res []Error
+	for _, b := range bm.sortedBudgets() {
+		s, ok := spent[b]
+		if !ok {
+			continue
+		}
+		var (
+			msg string
+			pct = s.Div(b.Amount).Shift(2).Round(0)
+		)
+		switch {
+		case s.GreaterThan(b.Amount):
+			msg = fmt.Sprintf("%s %s spent on %s in %s, exceeding the budget of %s %s (%s%%)",
+				s, b.Commodity.Name(), b.Account, bm.month.Start.Format("2006-01"), b.Amount, b.Commodity.Name(), pct)
+		case !b.Alert.IsZero() && s.GreaterThanOrEqual(b.Amount.Mul(b.Alert)):
+			msg = fmt.Sprintf("%s %s spent on %s in %s, %s%% of the budget of %s %s (alert at %s%%)",
+				s, b.Commodity.Name(), b.Account, bm.month.Start.Format("2006-01"), pct, b.Amount, b.Commodity.Name(), b.Alert.Shift(2))
+		default:
+			continue
+		}
+		res = append(res, Error{Code: WarnBudget, Directive: b, Message: msg})
+	}
+	return res
+}
+
+func (bm *BudgetMonitor) budgetFor(a *Account) *Budget {
+	as := bm.context.Accounts().Ancestors(a)
+	for i := len(as) - 1; i >= 0; i-- {
+		if b, ok := bm.budgets[as[i]]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+func (bm *BudgetMonitor) sortedBudgets() []*Budget {
+	res := make([]*Budget, 0, len(bm.budgets))
+	for _, b := range bm.budgets {
+		res = append(res, b)
+	}
+	compare.Sort(res, func(b1, b2 *Budget) compare.Order {
+		return CompareAccounts(b1.Account, b2.Account)
+	})
+	return res
+}
@@ -0,0 +1,228 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package budget compares the amounts budgeted for accounts with the actual
+// spending, period by period.
+package budget
+
+import (
+	"time"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+)
+
+// Report accumulates budgets and spending. Each column of the report covers
+// the period ending at one of the dates. As budgets
+// are monthly, the budget of a column is the sum of the budgets in effect at
+// the end of each of its months. Spending on an account is attributed to the
+// budget of the account or its closest ancestor.
+type Report struct {
+	context   journal.Context
+	dates     []time.Time
+	startOf   func(time.Time) time.Time
+	valuation *journal.Commodity
+
+	budgets []*journal.Budget
+
+	// amounts and values hold the amounts and values booked per month,
+	// account and commodity.
+	amounts, values map[time.Time]journal.Amounts
+}
+
+// New creates a new report with a column for each date. startOf returns
+// the start of the period ending at a date, which must be the start of a
+// month. If v is not nil, spending in other commodities is converted to v
+// for budgets in v.
+func New(jctx journal.Context, dates []time.Time, startOf func(time.Time) time.Time, v *journal.Commodity) *Report {
+	return &Report{
+		context:   jctx,
+		dates:     dates,
+		startOf:   startOf,
+		valuation: v,
+		amounts:   make(map[time.Time]journal.Amounts),
+		values:    make(map[time.Time]journal.Amounts),
+	}
+}
+
+// Process processes a day. It must run after Balance.
+func (r *Report) Process(d *journal.Day) error {
+	r.budgets = append(r.budgets, d.Budgets...)
+	if len(r.dates) == 0 || d.Date.Before(r.startOf(r.dates[0])) || d.Date.After(r.dates[len(r.dates)-1]) {
+		return nil
+	}
+	m := date.StartOf(d.Date, date.Monthly)
+	if _, ok := r.amounts[m]; !ok {
+		r.amounts[m], r.values[m] = make(journal.Amounts), make(journal.Amounts)
+	}
+	for _, t := range d.Transactions {
+		for _, p := range t.Postings {
+			k := journal.AccountCommodityKey(p.Account, p.Commodity)
+			r.amounts[m].Add(k, p.Amount)
+			r.values[m].Add(k, p.Value)
+		}
+	}
+	return nil
+}
+
+// Row holds the budgeted and the actual amounts of an account, one per
+// date.
+type Row struct {
+	Account        *journal.Account
+	Commodity      *journal.Commodity
+	Budget, Actual []decimal.Decimal
+}
+
+// Rows returns the rows of the report, sorted by account and commodity.
+func (r *Report) Rows() []*Row {
+	type key struct {
+		account   *journal.Account
+		commodity *journal.Commodity
+	}
+	rows := make(map[key]*Row)
+	row := func(b *journal.Budget) *Row {
+		k := key{b.Account, b.Commodity}
+		res, ok := rows[k]
+		if !ok {
+			res = &Row{
+				Account:   b.Account,
+				Commodity: b.Commodity,
+				Budget:    make([]decimal.Decimal, len(r.dates)),
+				Actual:    make([]decimal.Decimal, len(r.dates)),
+			}
+			rows[k] = res
+		}
+		return res
+	}
+	for i, d := range r.dates {
+		for m := r.startOf(d); !m.After(d); m = m.AddDate(0, 1, 0) {
+			end := date.EndOf(m, date.Monthly)
+			if end.After(d) {
+				end = d
+			}
+			budgets := r.budgetsAt(end)
+			for _, b := range budgets {
+				rw := row(b)
+				rw.Budget[i] = rw.Budget[i].Add(b.Amount)
+			}
+			for k, amount := range r.amounts[m] {
+				b := r.budgetFor(budgets, k.Account)
+				if b == nil {
+					continue
+				}
+				rw := row(b)
+				switch {
+				case k.Commodity == b.Commodity:
+					rw.Actual[i] = rw.Actual[i].Add(amount)
+				case r.valuation != nil && b.Commodity == r.valuation:
+					rw.Actual[i] = rw.Actual[i].Add(r.values[m][k])
+				}
+			}
+		}
+	}
+	res := make([]*Row, 0, len(rows))
+	for _, rw := range rows {
+		res = append(res, rw)
+	}
+	compare.Sort(res, func(r1, r2 *Row) compare.Order {
+		if o := journal.CompareAccounts(r1.Account, r2.Account); o != compare.Equal {
+			return o
+		}
+		return journal.CompareCommodities(r1.Commodity, r2.Commodity)
+	})
+	return res
+}
+
+// budgetsAt returns the budgets in effect at the given date, by account.
+func (r *Report) budgetsAt(t time.Time) map[*journal.Account]*journal.Budget {
+	res := make(map[*journal.Account]*journal.Budget)
+	for _, b := range r.budgets {
+		if b.Date.After(t) {
+			break
+		}
+		if b.Amount.IsZero() {
+			delete(res, b.Account)
+		} else {
+			res[b.Account] = b
+		}
+	}
+	return res
+}
+
+func (r *Report) budgetFor(budgets map[*journal.Account]*journal.Budget, a *journal.Account) *journal.Budget {
+	as := r.context.Accounts().Ancestors(a)
+	for i := len(as) - 1; i >= 0; i-- {
+		if b, ok := budgets[as[i]]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// Render renders the rows with the budgeted amount, the actual amount and
+// the variance for each date, followed by the totals per commodity. A
+// negative variance means that the budget is exceeded.
+func Render(dates []time.Time, rows []*Row) *table.Table {
+	tbl := table.New(1, 1, 3*len(dates))
+	tbl.AddSeparatorRow()
+	header := tbl.AddHeaderRow().AddEmpty().AddEmpty()
+	for _, d := range dates {
+		header.AddText(d.Format("2006-01-02"), table.Center).AddEmpty().AddEmpty()
+	}
+	header = tbl.AddHeaderRow().AddText("Account", table.Center).AddText("Comm", table.Center)
+	for range dates {
+		header.AddText("Budget", table.Center).AddText("Actual", table.Center).AddText("Variance", table.Center)
+	}
+	tbl.AddSeparatorRow()
+	var (
+		commodities []*journal.Commodity
+		totals      = make(map[*journal.Commodity]*Row)
+	)
+	for _, rw := range rows {
+		renderRow(tbl, rw.Account.Name(), rw)
+		total, ok := totals[rw.Commodity]
+		if !ok {
+			total = &Row{
+				Commodity: rw.Commodity,
+				Budget:    make([]decimal.Decimal, len(dates)),
+				Actual:    make([]decimal.Decimal, len(dates)),
+			}
+			totals[rw.Commodity] = total
+			commodities = append(commodities, rw.Commodity)
+		}
+		for i := range dates {
+			total.Budget[i] = total.Budget[i].Add(rw.Budget[i])
+			total.Actual[i] = total.Actual[i].Add(rw.Actual[i])
+		}
+	}
+	tbl.AddSeparatorRow()
+	compare.Sort(commodities, journal.CompareCommodities)
+	for _, c := range commodities {
+		renderRow(tbl, "Total", totals[c])
+	}
+	if len(commodities) > 0 {
+		tbl.AddSeparatorRow()
+	}
+	return tbl
+}
+
+func renderRow(tbl *table.Table, name string, rw *Row) {
+	row := tbl.AddRow().AddText(name, table.Left).AddText(rw.Commodity.Name(), table.Left)
+	for i := range rw.Budget {
+		row.AddNumber(rw.Budget[i]).AddNumber(rw.Actual[i]).AddNumber(rw.Budget[i].Sub(rw.Actual[i]))
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package budget
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestReport(t *testing.T) {
+	var (
+		jctx      = journal.NewContext()
+		bank      = jctx.Account("Assets:Bank")
+		groceries = jctx.Account("Expenses:Groceries")
+		fruit     = jctx.Account("Expenses:Groceries:Fruit")
+		rent      = jctx.Account("Expenses:Rent")
+		chf       = jctx.Commodity("CHF")
+		j         = journal.New(jctx)
+	)
+	for _, a := range []*journal.Account{bank, groceries, fruit, rent} {
+		j.AddOpen(&journal.Open{Date: date.Date(2024, 1, 1), Account: a})
+	}
+	spend := func(d time.Time, a *journal.Account, amt int64) {
+		j.AddTransaction(journal.TransactionBuilder{
+			Date:        d,
+			Description: "Spending",
+			Postings: journal.PostingBuilder{
+				Credit:    bank,
+				Debit:     a,
+				Commodity: chf,
+				Amount:    decimal.NewFromInt(amt),
+			}.Build(),
+		}.Build())
+	}
+	j.AddBudget(&journal.Budget{Date: date.Date(2024, 1, 1), Account: groceries, Amount: decimal.NewFromInt(500), Commodity: chf})
+	j.AddBudget(&journal.Budget{Date: date.Date(2024, 3, 15), Account: groceries, Amount: decimal.NewFromInt(600), Commodity: chf})
+	j.AddBudget(&journal.Budget{Date: date.Date(2024, 2, 1), Account: rent, Amount: decimal.NewFromInt(2000), Commodity: chf})
+	spend(date.Date(2024, 1, 2), groceries, 300)
+	spend(date.Date(2024, 2, 5), fruit, 120)
+	spend(date.Date(2024, 1, 1), rent, 2000)
+	spend(date.Date(2024, 4, 1), rent, 2000)
+	spend(date.Date(2024, 5, 3), groceries, 700)
+	dates := []time.Time{date.Date(2024, 3, 31), date.Date(2024, 5, 31)}
+	r := New(jctx, dates, func(t time.Time) time.Time { return date.StartOf(t, date.Quarterly) }, nil)
+
+	if _, err := j.Process(journal.Balance(jctx, nil), r.Process); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	got := r.Rows()
+
+	want := []*Row{
+		{
+			Account:   groceries,
+			Commodity: chf,
+			Budget:    []decimal.Decimal{decimal.NewFromInt(1600), decimal.NewFromInt(1200)},
+			Actual:    []decimal.Decimal{decimal.NewFromInt(420), decimal.NewFromInt(700)},
+		},
+		{
+			Account:   rent,
+			Commodity: chf,
+			// the rent paid in January is not budgeted
+			Budget: []decimal.Decimal{decimal.NewFromInt(4000), decimal.NewFromInt(4000)},
+			Actual: []decimal.Decimal{decimal.Zero, decimal.NewFromInt(2000)},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b *journal.Account) bool { return a == b }), cmp.Comparer(func(a, b *journal.Commodity) bool { return a == b })); diff != "" {
+		t.Errorf("Rows() returned unexpected rows (-want/+got):\n%s", diff)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/shopspring/decimal"
+)
+
+func TestBudgetMonitor(t *testing.T) {
+	var (
+		jctx      = NewContext()
+		bank      = jctx.Account("Assets:Bank")
+		groceries = jctx.Account("Expenses:Groceries")
+		fruit     = jctx.Account("Expenses:Groceries:Fruit")
+		rent      = jctx.Account("Expenses:Rent")
+		travel    = jctx.Account("Expenses:Travel")
+		chf       = jctx.Commodity("CHF")
+		j         = New(jctx)
+	)
+	for _, a := range []*Account{bank, groceries, fruit, rent, travel} {
+		j.AddOpen(&Open{Date: date.Date(2024, 1, 1), Account: a})
+	}
+	spend := func(d int, a *Account, amt int64) {
+		j.AddTransaction(TransactionBuilder{
+			Date:        date.Date(2024, 3, d),
+			Description: "Spending",
+			Postings: PostingBuilder{
+				Credit:    bank,
+				Debit:     a,
+				Commodity: chf,
+				Amount:    decimal.NewFromInt(amt),
+			}.Build(),
+		}.Build())
+	}
+	j.AddBudget(&Budget{Date: date.Date(2024, 1, 1), Account: groceries, Amount: decimal.NewFromInt(500), Commodity: chf, Alert: decimal.RequireFromString("0.8")})
+	j.AddBudget(&Budget{Date: date.Date(2024, 1, 1), Account: rent, Amount: decimal.NewFromInt(2000), Commodity: chf})
+	j.AddBudget(&Budget{Date: date.Date(2024, 1, 1), Account: travel, Amount: decimal.NewFromInt(100), Commodity: chf})
+	j.AddBudget(&Budget{Date: date.Date(2024, 3, 10), Account: travel, Amount: decimal.Zero, Commodity: chf})
+	spend(2, groceries, 300)
+	spend(5, fruit, 120)
+	spend(1, rent, 2000)
+	spend(3, travel, 400)
+	// outside of the month to date
+	spend(20, rent, 100)
+	bm := NewBudgetMonitor(jctx, date.Date(2024, 3, 15), nil)
+
+	if _, err := j.Process(Balance(jctx, nil), bm.Process); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+
+	alerts := bm.Alerts()
+	if len(alerts) != 1 {
+		t.Fatalf("expected one alert, got %v", alerts)
+	}
+	if want := "420 CHF spent on Expenses:Groceries in 2024-03, 84% of the budget of 500 CHF (alert at 80%)"; alerts[0].Message != want {
+		t.Errorf("got alert %q, want %q", alerts[0].Message, want)
+	}
+	if !strings.Contains(alerts[0].Error(), "2024-01-01 budget Expenses:Groceries 500 CHF alert 80%") {
+		t.Errorf("alert does not contain the budget directive:\n%s", alerts[0].Error())
+	}
+}
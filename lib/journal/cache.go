@@ -0,0 +1,764 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/natefinch/atomic"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal/scanner"
+	"github.com/shopspring/decimal"
+)
+
+// cacheVersion is the version of the cache format. It must be incremented
+// whenever the encoding of the directives changes, such that stale entries
+// are discarded.
+const cacheVersion = 2
+
+// ParseCache is a directory which holds the parsed directives of journal
+// files in a binary format, with an entry per file. An entry is only used
+// if the digest of the contents of the file is unchanged, such that files
+// need not be parsed again as long as they are not edited.
+type ParseCache struct {
+	dir string
+}
+
+// NewParseCache creates a cache in the given directory.
+func NewParseCache(dir string) *ParseCache {
+	return &ParseCache{dir}
+}
+
+// DefaultParseCache returns a cache in knut/parse in the user's cache
+// directory, e.g. $XDG_CACHE_HOME/knut/parse on Linux, if the environment
+// variable KNUT_PARSE_CACHE is set to true. Otherwise, or if there is no
+// such directory, it returns nil.
+func DefaultParseCache() *ParseCache {
+	if enabled, err := strconv.ParseBool(os.Getenv("KNUT_PARSE_CACHE")); err != nil || !enabled {
+		return nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil
+	}
+	return NewParseCache(filepath.Join(dir, "knut", "parse"))
+}
+
+// digest returns the digest of the contents of a file.
+func digest(bs []byte) string {
+	h := sha256.Sum256(bs)
+	return hex.EncodeToString(h[:])
+}
+
+// filename returns the name of the entry for the file at the given path.
+func (c *ParseCache) filename(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return filepath.Join(c.dir, digest([]byte(path)))
+}
+
+// load returns the cached directives of the file at the given path, if
+// the entry matches the digest of its contents. The accounts and
+// commodities of the directives are taken from the context.
+func (c *ParseCache) load(jctx Context, path, digest string) ([]Directive, bool) {
+	bs, err := os.ReadFile(c.filename(path))
+	if err != nil {
+		return nil, false
+	}
+	d := decoder{buf: bs, context: jctx}
+	if d.uvarint() != cacheVersion || d.string() != path || d.string() != digest {
+		return nil, false
+	}
+	ds := make([]Directive, d.length())
+	for i := range ds {
+		ds[i] = d.directive()
+	}
+	if d.err != nil || len(d.buf) > 0 {
+		return nil, false
+	}
+	return ds, true
+}
+
+// store stores the directives of the file at the given path.
+func (c *ParseCache) store(path, digest string, ds []Directive) error {
+	e := encoder{symbols: make(map[string]int)}
+	e.uvarint(cacheVersion)
+	e.string(path)
+	e.string(digest)
+	e.uvarint(uint64(len(ds)))
+	for _, d := range ds {
+		if err := e.directive(d); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	return atomic.WriteFile(c.filename(path), bytes.NewReader(e.buf))
+}
+
+// The kinds of directives in the cache.
+const (
+	kindOpen byte = iota + 1
+	kindClose
+	kindTransaction
+	kindPrice
+	kindInclude
+	kindRates
+	kindRename
+	kindSplit
+	kindAssertion
+	kindBudget
+	kindAuto
+	kindValuation
+	kindValue
+	kindCurrency
+	kindDeclaration
+	kindOption
+)
+
+// encoder encodes directives. Symbols, i.e. paths and the names of
+// accounts and commodities, are stored once and referred to by index.
+type encoder struct {
+	buf     []byte
+	symbols map[string]int
+}
+
+func (e *encoder) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func (e *encoder) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// symbol writes 0 for the empty string, or the index of the symbol plus
+// one, followed by the symbol itself on its first occurrence.
+func (e *encoder) symbol(s string) {
+	if s == "" {
+		e.uvarint(0)
+		return
+	}
+	if i, ok := e.symbols[s]; ok {
+		e.uvarint(uint64(i + 1))
+		return
+	}
+	i := len(e.symbols)
+	e.symbols[s] = i
+	e.uvarint(uint64(i + 1))
+	e.string(s)
+}
+
+func (e *encoder) time(t time.Time) {
+	e.varint(t.Unix())
+}
+
+func (e *encoder) decimal(d decimal.Decimal) {
+	e.varint(int64(d.Exponent()))
+	c := d.Coefficient()
+	if c.IsInt64() {
+		e.buf = append(e.buf, 0)
+		e.varint(c.Int64())
+		return
+	}
+	e.buf = append(e.buf, 1)
+	e.bool(c.Sign() < 0)
+	e.string(string(c.Bytes()))
+}
+
+func (e *encoder) decimals(ds []decimal.Decimal) {
+	e.uvarint(uint64(len(ds)))
+	for _, d := range ds {
+		e.decimal(d)
+	}
+}
+
+func (e *encoder) location(l scanner.Location) {
+	e.uvarint(uint64(l.BytePos))
+	e.uvarint(uint64(l.RunePos))
+	e.uvarint(uint64(l.Line))
+	e.uvarint(uint64(l.Column))
+}
+
+func (e *encoder) rng(r Range) {
+	e.symbol(r.Path)
+	e.location(r.Start)
+	e.location(r.End)
+}
+
+func (e *encoder) account(a *Account) {
+	if a == nil {
+		e.symbol("")
+		return
+	}
+	e.symbol(a.name)
+}
+
+func (e *encoder) commodity(c *Commodity) {
+	if c == nil {
+		e.symbol("")
+		return
+	}
+	e.symbol(c.name)
+}
+
+func (e *encoder) commodities(cs []*Commodity) {
+	e.uvarint(uint64(len(cs)))
+	for _, c := range cs {
+		e.commodity(c)
+	}
+}
+
+func (e *encoder) metadata(md Metadata) {
+	e.uvarint(uint64(len(md)))
+	for _, m := range md {
+		e.string(m.Key)
+		e.string(m.Value)
+	}
+}
+
+func (e *encoder) tags(tags []Tag) {
+	e.uvarint(uint64(len(tags)))
+	for _, t := range tags {
+		e.string(string(t))
+	}
+}
+
+func (e *encoder) posting(p *Posting) {
+	e.decimal(p.Amount)
+	e.decimal(p.Value)
+	e.account(p.Account)
+	e.account(p.Other)
+	e.commodity(p.Commodity)
+	e.commodities(p.Targets)
+	e.bool(p.Lot != nil)
+	if p.Lot != nil {
+		e.time(p.Lot.Date)
+		e.string(p.Lot.Label)
+		e.uvarint(math.Float64bits(p.Lot.Price))
+		e.commodity(p.Lot.Commodity)
+	}
+	e.bool(p.Conversion != nil)
+	if p.Conversion != nil {
+		e.decimal(p.Conversion.Price)
+		e.commodity(p.Conversion.Commodity)
+		e.bool(p.Conversion.Total)
+	}
+	e.tags(p.Tags)
+	e.metadata(p.Metadata)
+	e.string(p.Comment)
+	e.bool(p.Omitted)
+}
+
+func (e *encoder) accrual(a *Accrual) {
+	e.rng(a.Range)
+	e.varint(int64(a.Interval))
+	e.time(a.Period.Start)
+	e.time(a.Period.End)
+	e.account(a.Account)
+	e.bool(a.Reverse)
+	e.bool(a.Dates != nil)
+	e.uvarint(uint64(len(a.Dates)))
+	for _, d := range a.Dates {
+		e.time(d)
+	}
+	e.decimals(a.Weights)
+}
+
+func (e *encoder) directive(d Directive) error {
+	switch t := d.(type) {
+	case *Open:
+		e.buf = append(e.buf, kindOpen)
+		e.rng(t.Range)
+		e.time(t.Date)
+		e.account(t.Account)
+		e.commodities(t.Commodities)
+	case *Close:
+		e.buf = append(e.buf, kindClose)
+		e.rng(t.Range)
+		e.time(t.Date)
+		e.account(t.Account)
+		e.account(t.Residual)
+	case *Transaction:
+		e.buf = append(e.buf, kindTransaction)
+		e.rng(t.Range)
+		e.time(t.Date)
+		e.varint(int64(t.Flag))
+		e.string(t.Description)
+		e.tags(t.Tags)
+		e.uvarint(uint64(len(t.Links)))
+		for _, l := range t.Links {
+			e.string(string(l))
+		}
+		e.metadata(t.Metadata)
+		e.uvarint(uint64(len(t.Postings)))
+		for _, p := range t.Postings {
+			e.posting(p)
+		}
+		e.bool(t.Accrual != nil)
+		if t.Accrual != nil {
+			e.accrual(t.Accrual)
+		}
+	case *Price:
+		e.buf = append(e.buf, kindPrice)
+		e.rng(t.Range)
+		e.time(t.Date)
+		e.commodity(t.Commodity)
+		e.commodity(t.Target)
+		e.decimal(t.Price)
+	case *Include:
+		e.buf = append(e.buf, kindInclude)
+		e.rng(t.Range)
+		e.string(t.Path)
+	case *Rates:
+		e.buf = append(e.buf, kindRates)
+		e.rng(t.Range)
+		e.string(t.Path)
+		e.commodity(t.Commodity)
+		e.commodity(t.Target)
+	case *Rename:
+		e.buf = append(e.buf, kindRename)
+		e.rng(t.Range)
+		e.time(t.Date)
+		e.commodity(t.Commodity)
+		e.commodity(t.Target)
+		e.decimal(t.Ratio)
+	case *Split:
+		e.buf = append(e.buf, kindSplit)
+		e.rng(t.Range)
+		e.time(t.Date)
+		e.commodity(t.Commodity)
+		e.decimal(t.Numerator)
+		e.decimal(t.Denominator)
+	case *Assertion:
+		e.buf = append(e.buf, kindAssertion)
+		e.rng(t.Range)
+		e.time(t.Date)
+		e.account(t.Account)
+		e.decimal(t.Amount)
+		e.commodity(t.Commodity)
+		e.bool(t.Subtree)
+	case *Budget:
+		e.buf = append(e.buf, kindBudget)
+		e.rng(t.Range)
+		e.time(t.Date)
+		e.account(t.Account)
+		e.decimal(t.Amount)
+		e.commodity(t.Commodity)
+		e.decimal(t.Alert)
+	case *Auto:
+		e.buf = append(e.buf, kindAuto)
+		e.rng(t.Range)
+		e.time(t.Date)
+		e.string(t.Accounts.String())
+		e.account(t.Credit)
+		e.account(t.Debit)
+		e.decimal(t.Ratio)
+	case *Valuation:
+		e.buf = append(e.buf, kindValuation)
+		e.rng(t.Range)
+		e.time(t.Date)
+		e.account(t.Account)
+		e.account(t.Target)
+	case *Value:
+		e.buf = append(e.buf, kindValue)
+		e.rng(t.Range)
+		e.time(t.Date)
+		e.account(t.Account)
+		e.decimal(t.Amount)
+		e.commodity(t.Commodity)
+	case *Currency:
+		e.buf = append(e.buf, kindCurrency)
+		e.rng(t.Range)
+		e.time(t.Date)
+		e.commodity(t.Commodity)
+	case *Declaration:
+		e.buf = append(e.buf, kindDeclaration)
+		e.rng(t.Range)
+		e.commodity(t.Commodity)
+	case *Option:
+		e.buf = append(e.buf, kindOption)
+		e.rng(t.Range)
+		e.string(t.Name)
+	default:
+		return fmt.Errorf("unsupported directive: %#v", d)
+	}
+	return nil
+}
+
+var errCorrupt = errors.New("corrupt cache entry")
+
+// decoder decodes directives, taking the accounts and commodities from the
+// context. After the first error, all methods return zero values.
+type decoder struct {
+	buf     []byte
+	context Context
+	symbols []string
+	err     error
+
+	accounts    map[string]*Account
+	commodities map[string]*Commodity
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.buf) == 0 {
+		d.fail(errCorrupt)
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail(errCorrupt)
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail(errCorrupt)
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// length reads the length of a sequence, which cannot exceed the number
+// of remaining bytes.
+func (d *decoder) length() int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail(errCorrupt)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) bool() bool {
+	return d.byte() == 1
+}
+
+func (d *decoder) string() string {
+	n := d.length()
+	if d.err != nil {
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *decoder) symbol() string {
+	i := d.uvarint()
+	switch {
+	case d.err != nil || i == 0:
+		return ""
+	case i <= uint64(len(d.symbols)):
+		return d.symbols[i-1]
+	case i == uint64(len(d.symbols))+1:
+		s := d.string()
+		d.symbols = append(d.symbols, s)
+		return s
+	}
+	d.fail(errCorrupt)
+	return ""
+}
+
+func (d *decoder) time() time.Time {
+	return time.Unix(d.varint(), 0).UTC()
+}
+
+func (d *decoder) decimal() decimal.Decimal {
+	exp := int32(d.varint())
+	if d.byte() == 0 {
+		return decimal.New(d.varint(), exp)
+	}
+	neg := d.bool()
+	c := new(big.Int).SetBytes([]byte(d.string()))
+	if neg {
+		c.Neg(c)
+	}
+	return decimal.NewFromBigInt(c, exp)
+}
+
+func (d *decoder) decimals() []decimal.Decimal {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+	res := make([]decimal.Decimal, n)
+	for i := range res {
+		res[i] = d.decimal()
+	}
+	return res
+}
+
+func (d *decoder) location() scanner.Location {
+	return scanner.Location{
+		BytePos: int(d.uvarint()),
+		RunePos: int(d.uvarint()),
+		Line:    int(d.uvarint()),
+		Column:  int(d.uvarint()),
+	}
+}
+
+func (d *decoder) rng() Range {
+	return Range{Path: d.symbol(), Start: d.location(), End: d.location()}
+}
+
+func (d *decoder) account() *Account {
+	name := d.symbol()
+	if name == "" {
+		return nil
+	}
+	if a, ok := d.accounts[name]; ok {
+		return a
+	}
+	a, err := d.context.GetAccount(name)
+	if err != nil {
+		d.fail(err)
+		return nil
+	}
+	if d.accounts == nil {
+		d.accounts = make(map[string]*Account)
+	}
+	d.accounts[name] = a
+	return a
+}
+
+func (d *decoder) commodity() *Commodity {
+	name := d.symbol()
+	if name == "" {
+		return nil
+	}
+	if c, ok := d.commodities[name]; ok {
+		return c
+	}
+	c, err := d.context.GetCommodity(name)
+	if err != nil {
+		d.fail(err)
+		return nil
+	}
+	if d.commodities == nil {
+		d.commodities = make(map[string]*Commodity)
+	}
+	d.commodities[name] = c
+	return c
+}
+
+func (d *decoder) commoditiesList() []*Commodity {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+	res := make([]*Commodity, n)
+	for i := range res {
+		res[i] = d.commodity()
+	}
+	return res
+}
+
+func (d *decoder) metadata() Metadata {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+	res := make(Metadata, n)
+	for i := range res {
+		res[i] = Meta{Key: d.string(), Value: d.string()}
+	}
+	return res
+}
+
+func (d *decoder) tags() []Tag {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+	res := make([]Tag, n)
+	for i := range res {
+		res[i] = Tag(d.string())
+	}
+	return res
+}
+
+func (d *decoder) posting(p *Posting) {
+	p.Amount = d.decimal()
+	p.Value = d.decimal()
+	p.Account = d.account()
+	p.Other = d.account()
+	p.Commodity = d.commodity()
+	p.Targets = d.commoditiesList()
+	if d.bool() {
+		p.Lot = &Lot{
+			Date:      d.time(),
+			Label:     d.string(),
+			Price:     math.Float64frombits(d.uvarint()),
+			Commodity: d.commodity(),
+		}
+	}
+	if d.bool() {
+		p.Conversion = &Conversion{
+			Price:     d.decimal(),
+			Commodity: d.commodity(),
+			Total:     d.bool(),
+		}
+	}
+	p.Tags = d.tags()
+	p.Metadata = d.metadata()
+	p.Comment = d.string()
+	p.Omitted = d.bool()
+}
+
+func (d *decoder) accrual() *Accrual {
+	a := &Accrual{
+		Range:    d.rng(),
+		Interval: date.Interval(d.varint()),
+		Period:   date.Period{Start: d.time(), End: d.time()},
+		Account:  d.account(),
+		Reverse:  d.bool(),
+	}
+	hasDates := d.bool()
+	n := d.length()
+	if hasDates {
+		a.Dates = make([]time.Time, n)
+		for i := range a.Dates {
+			a.Dates[i] = d.time()
+		}
+	}
+	a.Weights = d.decimals()
+	return a
+}
+
+func (d *decoder) transaction() *Transaction {
+	t := &Transaction{
+		Range:       d.rng(),
+		Date:        d.time(),
+		Flag:        Flag(d.varint()),
+		Description: d.string(),
+		Tags:        d.tags(),
+	}
+	if n := d.length(); n > 0 {
+		t.Links = make([]Link, n)
+		for i := range t.Links {
+			t.Links[i] = Link(d.string())
+		}
+	}
+	t.Metadata = d.metadata()
+	n := d.length()
+	ps := make([]Posting, n)
+	t.Postings = make([]*Posting, n)
+	for i := range ps {
+		d.posting(&ps[i])
+		t.Postings[i] = &ps[i]
+	}
+	if d.bool() {
+		t.Accrual = d.accrual()
+	}
+	return t
+}
+
+func (d *decoder) directive() Directive {
+	switch d.byte() {
+	case kindOpen:
+		return &Open{Range: d.rng(), Date: d.time(), Account: d.account(), Commodities: d.commoditiesList()}
+	case kindClose:
+		return &Close{Range: d.rng(), Date: d.time(), Account: d.account(), Residual: d.account()}
+	case kindTransaction:
+		return d.transaction()
+	case kindPrice:
+		return &Price{Range: d.rng(), Date: d.time(), Commodity: d.commodity(), Target: d.commodity(), Price: d.decimal()}
+	case kindInclude:
+		return &Include{Range: d.rng(), Path: d.string()}
+	case kindRates:
+		return &Rates{Range: d.rng(), Path: d.string(), Commodity: d.commodity(), Target: d.commodity()}
+	case kindRename:
+		return &Rename{Range: d.rng(), Date: d.time(), Commodity: d.commodity(), Target: d.commodity(), Ratio: d.decimal()}
+	case kindSplit:
+		return &Split{Range: d.rng(), Date: d.time(), Commodity: d.commodity(), Numerator: d.decimal(), Denominator: d.decimal()}
+	case kindAssertion:
+		return &Assertion{Range: d.rng(), Date: d.time(), Account: d.account(), Amount: d.decimal(), Commodity: d.commodity(), Subtree: d.bool()}
+	case kindBudget:
+		return &Budget{Range: d.rng(), Date: d.time(), Account: d.account(), Amount: d.decimal(), Commodity: d.commodity(), Alert: d.decimal()}
+	case kindAuto:
+		a := &Auto{Range: d.rng(), Date: d.time()}
+		accounts, err := regexp.Compile(d.string())
+		if err != nil {
+			d.fail(err)
+		}
+		a.Accounts = accounts
+		a.Credit, a.Debit, a.Ratio = d.account(), d.account(), d.decimal()
+		return a
+	case kindValuation:
+		return &Valuation{Range: d.rng(), Date: d.time(), Account: d.account(), Target: d.account()}
+	case kindValue:
+		return &Value{Range: d.rng(), Date: d.time(), Account: d.account(), Amount: d.decimal(), Commodity: d.commodity()}
+	case kindCurrency:
+		return &Currency{Range: d.rng(), Date: d.time(), Commodity: d.commodity()}
+	case kindDeclaration:
+		return &Declaration{Range: d.rng(), Commodity: d.commodity()}
+	case kindOption:
+		return &Option{Range: d.rng(), Name: d.string()}
+	}
+	d.fail(errCorrupt)
+	return nil
+}
@@ -0,0 +1,330 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal/scanner"
+	"github.com/shopspring/decimal"
+)
+
+func TestParseCache(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		main    = filepath.Join(dir, "main.knut")
+		cache   = NewParseCache(filepath.Join(dir, "cache"))
+		journal = `option strict
+currency CHF
+commodity AAPL
+include "prices.knut"
+
+2020-01-01 open Equity:Equity
+2020-01-01 open Assets:Bank CHF,USD
+2020-01-01 open Assets:Portfolio
+2020-01-01 open Expenses:Insurance
+2020-01-01 auto "^Expenses:Insurance" Assets:Bank Assets:Portfolio 10%
+2020-01-01 valuation Assets:Portfolio Equity:Equity
+
+2020-01-02 "Deposit" #init ^deposit
+import-id: "42"
+Equity:Equity Assets:Bank 1000 CHF
+
+2020-01-02 "Buy"
+Assets:Bank Assets:Portfolio 10 AAPL @ 15 CHF
+
+@accrue monthly 2020-01-01 2020-03-31 Assets:Bank 3,2,1
+2020-01-03 "Insurance"
+Assets:Bank Expenses:Insurance 600 CHF
+
+2020-01-31 balance Assets:Bank 200 CHF
+2020-02-01 split AAPL 4:1
+2020-12-31 close Expenses:Insurance Equity:Equity
+`
+	)
+	if err := os.WriteFile(main, []byte(journal), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "prices.knut"), []byte("2020-01-01 price AAPL 15 CHF\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parse := func(jctx Context) ([]string, []any) {
+		t.Helper()
+		var (
+			p   = RecursiveParser{Context: jctx, File: main, Cache: cache}
+			pr  = NewPrinter()
+			res []string
+			ds  []any
+		)
+		for d := range p.Parse(context.Background()) {
+			if err, ok := d.(error); ok {
+				t.Fatalf("Parse() returned unexpected error: %v", err)
+			}
+			var b strings.Builder
+			pr.PrintDirective(&b, d.(Directive))
+			res = append(res, b.String())
+			ds = append(ds, d)
+		}
+		return res, ds
+	}
+
+	want, _ := parse(NewContext())
+	entries, err := filepath.Glob(filepath.Join(dir, "cache", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d cache entries, want 2", len(entries))
+	}
+	jctx := NewContext()
+	got, ds := parse(jctx)
+
+	if diff := cmp.Diff(sorted(want), sorted(got)); diff != "" {
+		t.Errorf("Parse() returned unexpected directives from the cache (-want/+got):\n%s", diff)
+	}
+	for _, d := range ds {
+		if o, ok := d.(*Open); ok && o.Account != jctx.Account(o.Account.Name()) {
+			t.Errorf("account %s of cached directive is not part of the context", o.Account.Name())
+		}
+	}
+
+	if err := os.WriteFile(main, []byte(strings.Replace(journal, "1000 CHF", "2000 CHF", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = parse(NewContext())
+
+	if !strings.Contains(strings.Join(got, ""), "2000 CHF") {
+		t.Errorf("Parse() returned stale directives after the file changed:\n%s", strings.Join(got, ""))
+	}
+}
+
+func TestDefaultParseCache(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("HOME", dir)
+
+	for _, test := range []struct {
+		env  string
+		want *ParseCache
+	}{
+		{env: ""},
+		{env: "false"},
+		{env: "invalid"},
+		{env: "true", want: NewParseCache(filepath.Join(dir, "knut", "parse"))},
+	} {
+		t.Run(test.env, func(t *testing.T) {
+			t.Setenv("KNUT_PARSE_CACHE", test.env)
+
+			got := DefaultParseCache()
+
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(ParseCache{})); diff != "" {
+				t.Fatalf("DefaultParseCache() returned unexpected cache (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func sorted(ss []string) []string {
+	res := append([]string(nil), ss...)
+	sort.Strings(res)
+	return res
+}
+
+// cacheFields holds the digests of the fields of the cached directives per
+// cache version. If TestCacheFields fails, encode the new fields in the
+// cache, populate them in TestCacheRoundTrip, increment cacheVersion and
+// add the new digest here.
+var cacheFields = map[int]string{
+	2: "275c2c773fb8ed21",
+}
+
+// cachedDirectives are the types of the directives stored in the cache.
+var cachedDirectives = []any{
+	Open{}, Close{}, Transaction{}, Price{}, Include{}, Rates{}, Rename{}, Split{},
+	Assertion{}, Budget{}, Auto{}, Valuation{}, Value{}, Currency{}, Declaration{}, Option{},
+}
+
+func TestCacheFields(t *testing.T) {
+	var (
+		b    strings.Builder
+		seen = make(map[reflect.Type]bool)
+	)
+	for _, d := range cachedDirectives {
+		describeFields(&b, seen, reflect.TypeOf(d))
+	}
+	h := sha256.Sum256([]byte(b.String()))
+	got := hex.EncodeToString(h[:8])
+
+	if want := cacheFields[cacheVersion]; got != want {
+		t.Fatalf("the fields of the cached directives have changed (digest %s, want %s for cache version %d), "+
+			"update the cache and increment cacheVersion:\n%s", got, want, cacheVersion, b.String())
+	}
+}
+
+// describeFields writes the fields of t and of the knut types it refers
+// to, except for accounts and commodities, which are cached by name.
+func describeFields(b *strings.Builder, seen map[reflect.Type]bool, t reflect.Type) {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] || !isCachedType(t) {
+		return
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fmt.Fprintf(b, "%s.%s %s\n", t, f.Name, f.Type)
+		describeFields(b, seen, f.Type)
+	}
+}
+
+func isCachedType(t reflect.Type) bool {
+	return strings.HasPrefix(t.PkgPath(), "github.com/sboehler/knut/") &&
+		t != reflect.TypeOf(Account{}) && t != reflect.TypeOf(Commodity{})
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	var (
+		jctx  = NewContext()
+		bank  = jctx.Account("Assets:Bank")
+		eq    = jctx.Account("Equity:Equity")
+		chf   = jctx.Commodity("CHF")
+		usd   = jctx.Commodity("USD")
+		day   = time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+		dec   = decimal.RequireFromString("12.5")
+		large = decimal.RequireFromString("-123456789012345678901234567890.12")
+		rng   = Range{
+			Path:  "journal.knut",
+			Start: scanner.Location{BytePos: 10, RunePos: 9, Line: 2, Column: 1},
+			End:   scanner.Location{BytePos: 20, RunePos: 19, Line: 3, Column: 5},
+		}
+		cache = NewParseCache(t.TempDir())
+	)
+	want := []Directive{
+		&Open{Range: rng, Date: day, Account: bank, Commodities: []*Commodity{chf}},
+		&Close{Range: rng, Date: day, Account: bank, Residual: eq},
+		&Transaction{
+			Range:       rng,
+			Date:        day,
+			Flag:        Pending,
+			Description: "Description",
+			Tags:        []Tag{"#tag"},
+			Links:       []Link{"^link"},
+			Metadata:    Metadata{{Key: "key", Value: "value"}},
+			Postings: []*Posting{{
+				Amount:     dec,
+				Value:      large,
+				Account:    bank,
+				Other:      eq,
+				Commodity:  usd,
+				Targets:    []*Commodity{chf},
+				Lot:        &Lot{Date: day, Label: "label", Price: 1.5, Commodity: chf},
+				Conversion: &Conversion{Price: dec, Commodity: chf, Total: true},
+				Tags:       []Tag{"#posting"},
+				Metadata:   Metadata{{Key: "posting", Value: "value"}},
+				Comment:    "comment",
+				Omitted:    true,
+			}},
+			Accrual: &Accrual{
+				Range:    rng,
+				Interval: date.Monthly,
+				Period:   date.Period{Start: day, End: day.AddDate(0, 2, 0)},
+				Account:  eq,
+				Reverse:  true,
+				Dates:    []time.Time{day},
+				Weights:  []decimal.Decimal{dec},
+			},
+		},
+		&Price{Range: rng, Date: day, Commodity: usd, Target: chf, Price: large},
+		&Include{Range: rng, Path: "include.knut"},
+		&Rates{Range: rng, Path: "rates.csv", Commodity: usd, Target: chf},
+		&Rename{Range: rng, Date: day, Commodity: usd, Target: chf, Ratio: dec},
+		&Split{Range: rng, Date: day, Commodity: usd, Numerator: dec, Denominator: large},
+		&Assertion{Range: rng, Date: day, Account: bank, Amount: dec, Commodity: chf, Subtree: true},
+		&Budget{Range: rng, Date: day, Account: bank, Amount: dec, Commodity: chf, Alert: dec},
+		&Auto{Range: rng, Date: day, Accounts: regexp.MustCompile("^Expenses"), Credit: bank, Debit: eq, Ratio: dec},
+		&Valuation{Range: rng, Date: day, Account: bank, Target: eq},
+		&Value{Range: rng, Date: day, Account: bank, Amount: dec, Commodity: chf},
+		&Currency{Range: rng, Date: day, Commodity: chf},
+		&Declaration{Range: rng, Commodity: usd},
+		&Option{Range: rng, Name: "strict"},
+	}
+	for _, d := range want {
+		checkPopulated(t, reflect.TypeOf(d).Elem().Name(), reflect.ValueOf(d))
+	}
+	if err := cache.store("journal.knut", "digest", want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := cache.load(jctx, "journal.knut", "digest")
+
+	if !ok {
+		t.Fatal("load() did not find the stored directives")
+	}
+	if diff := cmp.Diff(want, got,
+		cmp.Comparer(func(a, b *Account) bool { return a == b }),
+		cmp.Comparer(func(a, b *Commodity) bool { return a == b }),
+		cmp.Comparer(func(a, b *regexp.Regexp) bool { return a.String() == b.String() }),
+	); diff != "" {
+		t.Fatalf("load() returned unexpected directives (-want/+got):\n%s", diff)
+	}
+}
+
+// checkPopulated reports the fields of v which have a zero value, such
+// that the round trip covers every field of the cached directives.
+func checkPopulated(t *testing.T, path string, v reflect.Value) {
+	t.Helper()
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			t.Errorf("%s is nil", path)
+			return
+		}
+		checkPopulated(t, path, v.Elem())
+	case reflect.Slice:
+		if v.Len() == 0 {
+			t.Errorf("%s is empty", path)
+			return
+		}
+		checkPopulated(t, path+"[0]", v.Index(0))
+	case reflect.Struct:
+		if !isCachedType(v.Type()) {
+			if v.IsZero() {
+				t.Errorf("%s is zero", path)
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			checkPopulated(t, path+"."+v.Type().Field(i).Name, v.Field(i))
+		}
+	default:
+		if v.IsZero() {
+			t.Errorf("%s is zero", path)
+		}
+	}
+}
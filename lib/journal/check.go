@@ -0,0 +1,58 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"errors"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// Check processes the journal and returns its errors. If there are none,
+// the alerts of the budgets for the month up to t are returned instead.
+// With strict, the declarations are checked as if the journal contained
+// "option strict".
+func (j *Journal) Check(t time.Time, valuation *Commodity, strict bool) []Error {
+	if strict && !j.Strict {
+		if err := j.CheckDeclarations(); err != nil {
+			return Errors(err)
+		}
+	}
+	budgets := NewBudgetMonitor(j.Context, t, valuation)
+	if _, err := j.Process(
+		ComputePrices(valuation),
+		Balance(j.Context, valuation),
+		budgets.Process,
+	); err != nil {
+		return Errors(err)
+	}
+	return budgets.Alerts()
+}
+
+// Errors converts err into a list of journal errors. Errors which do not
+// carry a directive are classified as parse errors.
+func Errors(err error) []Error {
+	var res []Error
+	for _, e := range multierr.Errors(err) {
+		var je Error
+		if errors.As(e, &je) {
+			res = append(res, je)
+		} else {
+			res = append(res, Error{Code: ErrParse, Message: e.Error()})
+		}
+	}
+	return res
+}
@@ -0,0 +1,329 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/natefinch/atomic"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/common/set"
+)
+
+// Checkpoint is the state of a processed journal at the end of a day. It
+// allows to skip the processing of all days up to and including Date, as
+// long as none of their directives have changed.
+type Checkpoint struct {
+	Date      time.Time
+	Digest    string
+	Valuation string
+	Accounts  []string
+	Prices    []CheckpointPrice
+	Positions []CheckpointPosition
+}
+
+// CheckpointPrice is the latest price of a pair of commodities.
+type CheckpointPrice struct {
+	Commodity, Target string
+	Price             decimal.Decimal
+}
+
+// CheckpointPosition is the sum of all postings of an account in a commodity.
+type CheckpointPosition struct {
+	Account, Commodity string
+	Amount, Value      decimal.Decimal
+}
+
+// ReadCheckpoint reads a checkpoint from the given file. It returns
+// nil if the file does not exist.
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	bs, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(bs, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// WriteFile writes the checkpoint to the given file.
+func (cp *Checkpoint) WriteFile(path string) error {
+	bs, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomic.WriteFile(path, bytes.NewReader(bs))
+}
+
+// Digest computes a digest of all directives on or before t. The digest
+// does not depend on the order of the directives within a day.
+func (j *Journal) Digest(t time.Time) string {
+	var (
+		digest []byte
+		p      = NewPrinter()
+	)
+	if j.resumed != nil {
+		digest, _ = hex.DecodeString(j.resumed.Digest)
+	}
+	for _, d := range dict.SortedValues(j.Days, CompareDays) {
+		if d.Date.After(t) {
+			break
+		}
+		if j.resumed != nil && !d.Date.After(j.resumed.Date) {
+			continue
+		}
+		var ds []string
+		add := func(dir Directive) {
+			var b strings.Builder
+			p.PrintDirective(&b, dir)
+			ds = append(ds, b.String())
+		}
+		for _, dir := range d.Prices {
+			add(dir)
+		}
+		for _, dir := range d.Openings {
+			add(dir)
+		}
+		for _, dir := range d.Transactions {
+			add(dir)
+		}
+		for _, dir := range d.Values {
+			add(dir)
+		}
+		for _, dir := range d.Renames {
+			add(dir)
+		}
+		for _, dir := range d.Splits {
+			add(dir)
+		}
+		for _, dir := range d.Autos {
+			add(dir)
+		}
+		for _, dir := range d.Valuations {
+			add(dir)
+		}
+		for _, dir := range d.Assertions {
+			add(dir)
+		}
+		for _, dir := range d.Closings {
+			add(dir)
+		}
+		if len(ds) == 0 {
+			continue
+		}
+		sort.Strings(ds)
+		h := sha256.New()
+		h.Write(digest)
+		for _, s := range ds {
+			h.Write([]byte(s))
+			h.Write([]byte{0})
+		}
+		digest = h.Sum(nil)
+	}
+	return hex.EncodeToString(digest)
+}
+
+// Resume replaces all days up to and including the checkpoint date with
+// a single day holding the state of the checkpoint. It returns false and
+// leaves the journal unchanged if the checkpoint does not match the
+// journal or the valuation commodity.
+func (j *Journal) Resume(cp *Checkpoint, v *Commodity) (bool, error) {
+	if cp.Valuation != commodityName(v) || j.Digest(cp.Date) != cp.Digest || !j.max.After(cp.Date) {
+		return false, nil
+	}
+	d := &Day{Date: cp.Date, Restored: true}
+	for _, p := range cp.Prices {
+		commodity, err := j.Context.GetCommodity(p.Commodity)
+		if err != nil {
+			return false, err
+		}
+		target, err := j.Context.GetCommodity(p.Target)
+		if err != nil {
+			return false, err
+		}
+		d.Prices = append(d.Prices, &Price{Date: cp.Date, Commodity: commodity, Target: target, Price: p.Price})
+	}
+	var (
+		open    = set.New[*Account]()
+		opened  = set.New[*Account]()
+		restore = &Transaction{Date: cp.Date, Description: "Checkpoint"}
+		equity  = j.Context.Account("Equity:Equity")
+	)
+	for _, name := range cp.Accounts {
+		a, err := j.Context.GetAccount(name)
+		if err != nil {
+			return false, err
+		}
+		open.Add(a)
+	}
+	for _, pos := range cp.Positions {
+		a, err := j.Context.GetAccount(pos.Account)
+		if err != nil {
+			return false, err
+		}
+		c, err := j.Context.GetCommodity(pos.Commodity)
+		if err != nil {
+			return false, err
+		}
+		restore.Postings = append(restore.Postings, &Posting{
+			Account:   a,
+			Other:     equity,
+			Commodity: c,
+			Amount:    pos.Amount,
+			Value:     pos.Value,
+		})
+		if !opened.Has(a) {
+			// accounts which have been closed must be opened to restore
+			// their flows
+			opened.Add(a)
+			d.Openings = append(d.Openings, &Open{Date: cp.Date, Account: a})
+			if !open.Has(a) {
+				d.Closings = append(d.Closings, &Close{Date: cp.Date, Account: a})
+			}
+		}
+	}
+	for _, name := range cp.Accounts {
+		a := j.Context.Account(name)
+		if !opened.Has(a) {
+			d.Openings = append(d.Openings, &Open{Date: cp.Date, Account: a})
+		}
+	}
+	if len(restore.Postings) > 0 {
+		d.Transactions = append(d.Transactions, restore)
+	}
+	permitted := make(map[*Account][]*Commodity)
+	for _, day := range dict.SortedValues(j.Days, CompareDays) {
+		if day.Date.After(cp.Date) {
+			break
+		}
+		// auto rules apply beyond the checkpoint
+		d.Autos = append(d.Autos, day.Autos...)
+		d.Valuations = append(d.Valuations, day.Valuations...)
+		for _, o := range day.Openings {
+			permitted[o.Account] = o.Commodities
+		}
+		delete(j.Days, day.Date)
+	}
+	for _, o := range d.Openings {
+		if open.Has(o.Account) {
+			o.Commodities = permitted[o.Account]
+		}
+	}
+	j.Days[cp.Date] = d
+	j.resumed = cp
+	return true, nil
+}
+
+// Record records the state of the processed journal at the end of day t
+// in cp. It must run after Balance. The checkpoint is only written if the
+// journal has days after t.
+func Record(j *Journal, v *Commodity, t time.Time, cp *Checkpoint) DayFn {
+	type pair struct {
+		commodity, target *Commodity
+	}
+	var (
+		digest   = j.Digest(t)
+		accounts = set.New[*Account]()
+		prices   = make(map[pair]CheckpointPrice)
+		amounts  = make(Amounts)
+		values   = make(Amounts)
+		done     bool
+	)
+	return func(d *Day) error {
+		if !done && d.Date.After(t) {
+			done = true
+			*cp = Checkpoint{
+				Date:      t,
+				Digest:    digest,
+				Valuation: commodityName(v),
+			}
+			for a := range accounts {
+				cp.Accounts = append(cp.Accounts, a.Name())
+			}
+			sort.Strings(cp.Accounts)
+			for _, p := range prices {
+				cp.Prices = append(cp.Prices, p)
+			}
+			sort.Slice(cp.Prices, func(i, j int) bool {
+				return cp.Prices[i].Commodity+cp.Prices[i].Target < cp.Prices[j].Commodity+cp.Prices[j].Target
+			})
+			for _, k := range amounts.Index(compareAccountCommodity) {
+				if amounts[k].IsZero() && values[k].IsZero() {
+					continue
+				}
+				cp.Positions = append(cp.Positions, CheckpointPosition{
+					Account:   k.Account.Name(),
+					Commodity: k.Commodity.Name(),
+					Amount:    amounts[k],
+					Value:     values[k],
+				})
+			}
+		}
+		if done {
+			return nil
+		}
+		for _, o := range d.Openings {
+			accounts.Add(o.Account)
+		}
+		for _, p := range d.Prices {
+			// the latest price of a pair determines both directions
+			k := pair{p.Commodity, p.Target}
+			if p.Target.Name() < p.Commodity.Name() {
+				k = pair{p.Target, p.Commodity}
+			}
+			prices[k] = CheckpointPrice{Commodity: p.Commodity.Name(), Target: p.Target.Name(), Price: p.Price}
+		}
+		for _, t := range d.Transactions {
+			for _, p := range t.Postings {
+				k := AccountCommodityKey(p.Account, p.Commodity)
+				amounts.Add(k, p.Amount)
+				values.Add(k, p.Value)
+			}
+		}
+		for _, c := range d.Closings {
+			accounts.Remove(c.Account)
+		}
+		return nil
+	}
+}
+
+func compareAccountCommodity(k1, k2 Key) compare.Order {
+	if o := CompareAccounts(k1.Account, k2.Account); o != compare.Equal {
+		return o
+	}
+	return compare.Ordered(k1.Commodity.Name(), k2.Commodity.Name())
+}
+
+func commodityName(c *Commodity) string {
+	if c == nil {
+		return ""
+	}
+	return c.Name()
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/mapper"
+)
+
+type collection Amounts
+
+func (c collection) Insert(k Key, v decimal.Decimal) {
+	Amounts(c).Add(k, v)
+}
+
+func TestCheckpoint(t *testing.T) {
+	var (
+		jctx      = NewContext()
+		bank      = jctx.Account("Assets:Bank")
+		portfolio = jctx.Account("Assets:Portfolio")
+		salary    = jctx.Account("Income:Salary")
+		chf       = jctx.Commodity("CHF")
+		aapl      = jctx.Commodity("AAPL")
+		d1        = date.Date(2022, 1, 1)
+		d2        = date.Date(2022, 2, 1)
+		d3        = date.Date(2022, 3, 1)
+		dates     = []time.Time{d2, d3}
+	)
+	build := func(days ...time.Time) *Journal {
+		j := New(jctx)
+		j.AddOpen(&Open{Date: d1, Account: bank})
+		j.AddOpen(&Open{Date: d1, Account: portfolio})
+		j.AddOpen(&Open{Date: d1, Account: salary})
+		for i, d := range days {
+			j.AddPrice(&Price{Date: d, Commodity: aapl, Target: chf, Price: decimal.NewFromInt(int64(100 + 10*i))})
+			j.AddTransaction(TransactionBuilder{
+				Date:        d,
+				Description: "Salary",
+				Postings: PostingBuilder{
+					Credit:    salary,
+					Debit:     bank,
+					Commodity: chf,
+					Amount:    decimal.NewFromInt(1000),
+				}.Build(),
+			}.Build())
+			j.AddTransaction(TransactionBuilder{
+				Date:        d,
+				Description: "Buy",
+				Postings: PostingBuilder{
+					Credit:    salary,
+					Debit:     portfolio,
+					Commodity: aapl,
+					Amount:    decimal.NewFromInt(1),
+				}.Build(),
+			}.Build())
+		}
+		return j
+	}
+	run := func(j *Journal, cp *Checkpoint) collection {
+		res := make(collection)
+		_, err := j.Process(
+			ComputePrices(chf),
+			Balance(jctx, chf),
+			Record(j, chf, d2, cp),
+			CloseAccounts(j, dates),
+			Query(nil, KeyMapper{Date: date.Align(dates), Account: mapper.Identity[*Account], Commodity: mapper.Identity[*Commodity]}.Build(), chf, res),
+		)
+		if err != nil {
+			t.Fatalf("Process() returned unexpected error: %v", err)
+		}
+		return res
+	}
+	var cp Checkpoint
+	run(build(d1, d2.AddDate(0, 0, -10), d2), &cp)
+	if cp.Date != d2 {
+		t.Fatalf("checkpoint date = %v, want %v", cp.Date, d2)
+	}
+
+	var (
+		full    = run(build(d1, d2.AddDate(0, 0, -10), d2, d3), new(Checkpoint))
+		resumed = build(d1, d2.AddDate(0, 0, -10), d2, d3)
+	)
+	ok, err := resumed.Resume(&cp, chf)
+	if err != nil {
+		t.Fatalf("Resume() returned unexpected error: %v", err)
+	}
+	if !ok {
+		t.Fatal("Resume() = false, want true")
+	}
+	got := run(resumed, new(Checkpoint))
+
+	if diff := cmp.Diff(full, got); diff != "" {
+		t.Errorf("resumed run differs from full run (-full +resumed):\n%s", diff)
+	}
+}
+
+func TestCheckpointChanged(t *testing.T) {
+	var (
+		jctx = NewContext()
+		bank = jctx.Account("Assets:Bank")
+		d1   = date.Date(2022, 1, 1)
+		d2   = date.Date(2022, 2, 1)
+		j    = New(jctx)
+		cp   Checkpoint
+	)
+	j.AddOpen(&Open{Date: d1, Account: bank})
+	j.AddOpen(&Open{Date: d2.AddDate(0, 0, 1), Account: jctx.Account("Assets:Other")})
+	if _, err := j.Process(Balance(jctx, nil), Record(j, nil, d1, &cp)); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	j.AddAssertion(&Assertion{Date: d1, Account: bank, Commodity: jctx.Commodity("CHF")})
+
+	ok, err := j.Resume(&cp, nil)
+
+	if err != nil {
+		t.Fatalf("Resume() returned unexpected error: %v", err)
+	}
+	if ok {
+		t.Error("Resume() = true for a changed journal, want false")
+	}
+}
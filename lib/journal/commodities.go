@@ -69,6 +69,18 @@ func (cs *Commodities) Get(name string) (*Commodity, error) {
 	return res, nil
 }
 
+// All returns all commodities, sorted by name.
+func (cs *Commodities) All() []*Commodity {
+	cs.mutex.RLock()
+	res := make([]*Commodity, 0, len(cs.index))
+	for _, c := range cs.index {
+		res = append(res, c)
+	}
+	cs.mutex.RUnlock()
+	compare.Sort(res, CompareCommodities)
+	return res
+}
+
 func (cs *Commodities) insert(c *Commodity) {
 	cs.index[c.name] = c
 }
@@ -101,7 +113,7 @@ func MapCommodity(t bool) func(*Commodity) *Commodity {
 	if t {
 		return mapper.Identity[*Commodity]
 	}
-	return mapper.Nil[*Commodity]
+	return mapper.Nil[*Commodity, Commodity]
 }
 
 func CompareCommodities(c1, c2 *Commodity) compare.Order {
@@ -72,8 +72,12 @@ func (ctx Context) TBDAccount() *Account {
 }
 
 // ValuationAccountFor returns the valuation account which corresponds to
-// the given Asset or Liability account.
+// the given Asset or Liability account, unless it has been overridden by
+// a valuation directive.
 func (ctx Context) ValuationAccountFor(a *Account) *Account {
+	if v, ok := ctx.accounts.ValuationAccount(a); ok {
+		return v
+	}
 	suffix := a.Split()[1:]
 	segments := append(ctx.ValuationAccount().Split(), suffix...)
 	return ctx.Account(strings.Join(segments, ":"))
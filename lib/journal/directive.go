@@ -2,6 +2,8 @@ package journal
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/sboehler/knut/lib/common/compare"
@@ -28,12 +30,20 @@ type Directive interface {
 
 var (
 	_ Directive = (*Assertion)(nil)
+	_ Directive = (*Auto)(nil)
+	_ Directive = (*Budget)(nil)
 	_ Directive = (*Close)(nil)
 	_ Directive = (*Currency)(nil)
+	_ Directive = (*Declaration)(nil)
 	_ Directive = (*Include)(nil)
 	_ Directive = (*Open)(nil)
+	_ Directive = (*Option)(nil)
 	_ Directive = (*Price)(nil)
+	_ Directive = (*Rates)(nil)
+	_ Directive = (*Rename)(nil)
+	_ Directive = (*Split)(nil)
 	_ Directive = (*Transaction)(nil)
+	_ Directive = (*Valuation)(nil)
 	_ Directive = (*Value)(nil)
 )
 
@@ -42,6 +52,10 @@ type Open struct {
 	Range
 	Date    time.Time
 	Account *Account
+
+	// Commodities are the commodities permitted in the account. If empty,
+	// all commodities are permitted.
+	Commodities []*Commodity
 }
 
 // Close represents a close command.
@@ -49,6 +63,11 @@ type Close struct {
 	Range
 	Date    time.Time
 	Account *Account
+
+	// Residual is the account which receives the remaining positions of
+	// the closed account, if any. Without it, closing an account with a
+	// nonzero position is an error.
+	Residual *Account
 }
 
 // Posting represents a posting.
@@ -58,6 +77,16 @@ type Posting struct {
 	Commodity      *Commodity
 	Targets        []*Commodity
 	Lot            *Lot
+	Conversion     *Conversion
+	Tags           []Tag
+	Metadata       Metadata
+
+	// Comment is the trailing comment of the posting in the source.
+	Comment string
+
+	// Omitted marks a posting whose amount has been omitted in the source
+	// and computed such that one of the accounts of the booking balances.
+	Omitted bool
 }
 
 type PostingBuilder struct {
@@ -66,30 +95,46 @@ type PostingBuilder struct {
 	Commodity     *Commodity
 	Targets       []*Commodity
 	Lot           *Lot
+	Conversion    *Conversion
+	Tags          []Tag
+	Metadata      Metadata
+	Comment       string
+	Omitted       bool
 }
 
 func (pb PostingBuilder) Build() []*Posting {
-	if pb.Amount.IsNegative() || pb.Amount.IsZero() && pb.Value.IsNegative() {
+	// omitted postings keep their accounts in order to print them as given
+	if !pb.Omitted && (pb.Amount.IsNegative() || pb.Amount.IsZero() && pb.Value.IsNegative()) {
 		pb.Credit, pb.Debit, pb.Amount, pb.Value = pb.Debit, pb.Credit, pb.Amount.Neg(), pb.Value.Neg()
 	}
 	return []*Posting{
 		{
-			Account:   pb.Credit,
-			Other:     pb.Debit,
-			Commodity: pb.Commodity,
-			Amount:    pb.Amount.Neg(),
-			Value:     pb.Value.Neg(),
-			Targets:   pb.Targets,
-			Lot:       pb.Lot,
+			Account:    pb.Credit,
+			Other:      pb.Debit,
+			Commodity:  pb.Commodity,
+			Amount:     pb.Amount.Neg(),
+			Value:      pb.Value.Neg(),
+			Targets:    pb.Targets,
+			Lot:        pb.Lot,
+			Conversion: pb.Conversion,
+			Tags:       pb.Tags,
+			Metadata:   pb.Metadata,
+			Comment:    pb.Comment,
+			Omitted:    pb.Omitted,
 		},
 		{
-			Account:   pb.Debit,
-			Other:     pb.Credit,
-			Commodity: pb.Commodity,
-			Amount:    pb.Amount,
-			Value:     pb.Value,
-			Targets:   pb.Targets,
-			Lot:       pb.Lot,
+			Account:    pb.Debit,
+			Other:      pb.Credit,
+			Commodity:  pb.Commodity,
+			Amount:     pb.Amount,
+			Value:      pb.Value,
+			Targets:    pb.Targets,
+			Lot:        pb.Lot,
+			Conversion: pb.Conversion,
+			Tags:       pb.Tags,
+			Metadata:   pb.Metadata,
+			Comment:    pb.Comment,
+			Omitted:    pb.Omitted,
 		},
 	}
 }
@@ -132,15 +177,101 @@ type Lot struct {
 	Commodity *Commodity
 }
 
-// Tag represents a tag for a transaction or booking.
+// Conversion is the price at which the commodity of a posting has been
+// converted into another commodity, given per unit (@) or for the total
+// amount of the posting (@@).
+type Conversion struct {
+	Price     decimal.Decimal
+	Commodity *Commodity
+	Total     bool
+}
+
+// UnitPrice returns the price per unit of a posting with the given amount.
+func (c *Conversion) UnitPrice(amount decimal.Decimal) decimal.Decimal {
+	if !c.Total {
+		return c.Price
+	}
+	return c.Price.Div(amount.Abs())
+}
+
+// Tag represents a tag for a transaction or booking. A tag has the form
+// #key or #key:value.
 type Tag string
 
+// Link links a transaction to other transactions with the same link, e.g.
+// an invoice and its payment. A link has the form ^name.
+type Link string
+
+// MemberTag is the key of the tag which assigns a transaction to a member
+// of a household, e.g. #member:alice. Transactions without it are shared.
+const MemberTag = "member"
+
+// Key returns the key of the tag, without the leading '#'.
+func (t Tag) Key() string {
+	k, _, _ := strings.Cut(strings.TrimPrefix(string(t), "#"), ":")
+	return k
+}
+
+// Value returns the value of the tag, or the empty string if it has none.
+func (t Tag) Value() string {
+	_, v, _ := strings.Cut(string(t), ":")
+	return v
+}
+
+// Meta is a key-value pair of metadata, e.g. import-id: "1234".
+type Meta struct {
+	Key, Value string
+}
+
+// Metadata is the metadata of a transaction or a posting, in the order of
+// the journal.
+type Metadata []Meta
+
+// Get returns the value of the first entry with the given key.
+func (md Metadata) Get(key string) (string, bool) {
+	for _, m := range md {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return "", false
+}
+
+// joinMetadata joins the entries of the given metadata as key=value,
+// separated by newlines.
+func joinMetadata(mds ...Metadata) string {
+	var res []string
+	for _, md := range mds {
+		for _, m := range md {
+			res = append(res, m.Key+"="+m.Value)
+		}
+	}
+	return strings.Join(res, "\n")
+}
+
+// Flag is the status flag of a transaction.
+type Flag rune
+
+const (
+	// Unflagged transactions have no status.
+	Unflagged Flag = 0
+
+	// Cleared transactions have been reconciled, e.g. with a bank statement.
+	Cleared Flag = '*'
+
+	// Pending transactions have not been reconciled yet.
+	Pending Flag = '!'
+)
+
 // Transaction represents a transaction.
 type Transaction struct {
 	Range       Range
 	Date        time.Time
+	Flag        Flag
 	Description string
 	Tags        []Tag
+	Links       []Link
+	Metadata    Metadata
 	Postings    []*Posting
 	Accrual     *Accrual
 }
@@ -150,6 +281,75 @@ func (t Transaction) Position() Range {
 	return t.Range
 }
 
+// JoinedTags returns the tags of the transaction, separated by spaces.
+func (t Transaction) JoinedTags() string {
+	tags := make([]string, 0, len(t.Tags))
+	for _, tag := range t.Tags {
+		tags = append(tags, string(tag))
+	}
+	return strings.Join(tags, " ")
+}
+
+// PostingTags returns the tags of the transaction and of the given posting,
+// separated by spaces. Posting tags which are also on the transaction are
+// only listed once.
+func (t Transaction) PostingTags(p *Posting) string {
+	if len(p.Tags) == 0 {
+		return t.JoinedTags()
+	}
+	tags := make([]string, 0, len(t.Tags)+len(p.Tags))
+	seen := make(map[Tag]bool)
+	for _, ts := range [][]Tag{t.Tags, p.Tags} {
+		for _, tag := range ts {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, string(tag))
+			}
+		}
+	}
+	return strings.Join(tags, " ")
+}
+
+// ConversionPrices returns a price for every posting of the transaction
+// with a conversion.
+func (t Transaction) ConversionPrices() []*Price {
+	var res []*Price
+	for _, p := range t.Postings {
+		// both postings of a booking carry the conversion
+		if p.Conversion == nil || !p.Amount.IsPositive() {
+			continue
+		}
+		res = append(res, &Price{
+			Range:     t.Range,
+			Date:      t.Date,
+			Commodity: p.Commodity,
+			Target:    p.Conversion.Commodity,
+			Price:     p.Conversion.UnitPrice(p.Amount),
+		})
+	}
+	return res
+}
+
+// JoinedLinks returns the links of the transaction, separated by spaces.
+func (t Transaction) JoinedLinks() string {
+	links := make([]string, 0, len(t.Links))
+	for _, link := range t.Links {
+		links = append(links, string(link))
+	}
+	return strings.Join(links, " ")
+}
+
+// Member returns the household member the transaction is assigned to, or
+// the empty string for shared transactions.
+func (t Transaction) Member() string {
+	for _, tag := range t.Tags {
+		if tag.Key() == MemberTag {
+			return tag.Value()
+		}
+	}
+	return ""
+}
+
 // Less defines an order on transactions.
 func CompareTransactions(t *Transaction, t2 *Transaction) compare.Order {
 	if o := compare.Time(t.Date, t2.Date); o != compare.Equal {
@@ -170,8 +370,11 @@ func CompareTransactions(t *Transaction, t2 *Transaction) compare.Order {
 type TransactionBuilder struct {
 	Range       Range
 	Date        time.Time
+	Flag        Flag
 	Description string
 	Tags        []Tag
+	Links       []Link
+	Metadata    Metadata
 	Postings    []*Posting
 	Accrual     *Accrual
 }
@@ -181,8 +384,11 @@ func (tb TransactionBuilder) Build() *Transaction {
 	return &Transaction{
 		Range:       tb.Range,
 		Date:        tb.Date,
+		Flag:        tb.Flag,
 		Description: tb.Description,
 		Tags:        tb.Tags,
+		Links:       tb.Links,
+		Metadata:    tb.Metadata,
 		Postings:    tb.Postings,
 		Accrual:     tb.Accrual,
 	}
@@ -203,6 +409,43 @@ type Include struct {
 	Path string
 }
 
+// Rates represents a rates directive, which refers to a CSV file with
+// prices of a commodity in the target commodity.
+type Rates struct {
+	Range
+	Path      string
+	Commodity *Commodity
+	Target    *Commodity
+}
+
+// Rename represents a rename directive, which converts all positions in a
+// commodity into another commodity, for example after a ticker change or a
+// merger. Every unit of the old commodity becomes Ratio units of the target.
+type Rename struct {
+	Range
+	Date      time.Time
+	Commodity *Commodity
+	Target    *Commodity
+	Ratio     decimal.Decimal
+}
+
+// Split represents a split directive, which adjusts the quantity of all
+// positions in a commodity after a stock split. Every Denominator units
+// become Numerator units, without any impact on the value of the positions.
+type Split struct {
+	Range
+	Date                   time.Time
+	Commodity              *Commodity
+	Numerator, Denominator decimal.Decimal
+}
+
+// Apply returns the number of new units for the given number of old
+// units. It multiplies before dividing, such that the result is exact
+// whenever it is representable.
+func (s Split) Apply(amount decimal.Decimal) decimal.Decimal {
+	return amount.Mul(s.Numerator).Div(s.Denominator)
+}
+
 // Assertion represents a balance assertion.
 type Assertion struct {
 	Range
@@ -210,6 +453,49 @@ type Assertion struct {
 	Account   *Account
 	Amount    decimal.Decimal
 	Commodity *Commodity
+
+	// Subtree asserts the combined balance of the account and all its
+	// descendants.
+	Subtree bool
+}
+
+// Budget represents a budget directive, which assigns a monthly amount to an
+// account and its subaccounts. It applies from its date until the next budget
+// directive for the same account. A zero amount removes the budget.
+type Budget struct {
+	Range
+	Date      time.Time
+	Account   *Account
+	Amount    decimal.Decimal
+	Commodity *Commodity
+
+	// Alert is the fraction of the amount at which spending is reported,
+	// or zero if only spending in excess of the amount is reported.
+	Alert decimal.Decimal
+}
+
+// Auto represents an auto directive, which generates an additional booking
+// from Credit to Debit for every posting on or after its date in an account
+// matching Accounts, with the amount of the posting times Ratio. A later
+// auto directive with the same pattern and accounts replaces the rule, a
+// ratio of zero removes it.
+type Auto struct {
+	Range
+	Date          time.Time
+	Accounts      *regexp.Regexp
+	Credit, Debit *Account
+	Ratio         decimal.Decimal
+}
+
+// Valuation represents a valuation directive, which books the valuation
+// gains and losses of Account to Target instead of the default valuation
+// account. It applies to all valuation bookings of the account, also those
+// before its date.
+type Valuation struct {
+	Range
+	Date    time.Time
+	Account *Account
+	Target  *Account
 }
 
 // Value represents a value directive.
@@ -227,57 +513,170 @@ type Accrual struct {
 	Interval date.Interval
 	Period   date.Period
 	Account  *Account
+
+	// Reverse marks the accrual as the reversal of a previously
+	// accrued transaction, e.g. a refund after a cancellation. Only
+	// the periods on or after the transaction date are offset.
+	Reverse bool
+
+	// Dates is an explicit schedule, which replaces the dates given by
+	// Interval and Period.
+	Dates []time.Time
+
+	// Weights are the relative weights of the dates of the schedule. If
+	// empty, the amount is split equally.
+	Weights []decimal.Decimal
 }
 
-// Expand expands an accrual transaction.
+// Expand expands an accrual transaction. The postings of income and
+// expense accounts are spread over the schedule, with one transaction
+// per date holding the legs of all such postings. All other postings are
+// booked against the accrual account on the date of the transaction.
 func (a Accrual) Expand(t *Transaction) []*Transaction {
 	var (
-		result []*Transaction
+		dates, weights = a.schedule(t.Date)
+		legs           = make([]PostingBuilders, len(dates))
+		booked         PostingBuilders
 	)
 	for _, p := range t.Postings {
-		if p.Account.IsAL() {
-			result = append(result, TransactionBuilder{
-				Range:       t.Position(),
-				Date:        t.Date,
-				Tags:        t.Tags,
-				Description: t.Description,
-				Postings: PostingBuilder{
-					Credit:    t.Accrual.Account,
-					Debit:     p.Account,
-					Commodity: p.Commodity,
-					Amount:    p.Amount,
-				}.Build(),
-			}.Build())
+		if !p.Account.IsIE() {
+			booked = append(booked, PostingBuilder{
+				Credit:    t.Accrual.Account,
+				Debit:     p.Account,
+				Commodity: p.Commodity,
+				Amount:    p.Amount,
+				Tags:      p.Tags,
+				Metadata:  p.Metadata,
+			})
+			continue
 		}
-		if p.Account.IsIE() {
-			dates := a.Period.Dates(a.Interval, 0)
-			amount, rem := p.Amount.QuoRem(decimal.NewFromInt(int64(len(dates))), 1)
-			for i, dt := range dates {
-				a := amount
-				if i == 0 {
-					a = a.Add(rem)
-				}
-				result = append(result, TransactionBuilder{
-					Range:       t.Position(),
-					Date:        dt,
-					Tags:        t.Tags,
-					Description: fmt.Sprintf("%s (accrual %d/%d)", t.Description, i+1, len(dates)),
-					Postings: PostingBuilder{
-						Credit:    t.Accrual.Account,
-						Debit:     p.Account,
-						Commodity: p.Commodity,
-						Amount:    a,
-					}.Build(),
-				}.Build())
-			}
+		for i, amount := range split(p.Amount, weights) {
+			legs[i] = append(legs[i], PostingBuilder{
+				Credit:    t.Accrual.Account,
+				Debit:     p.Account,
+				Commodity: p.Commodity,
+				Amount:    amount,
+				Tags:      p.Tags,
+				Metadata:  p.Metadata,
+			})
+		}
+	}
+	var (
+		result []*Transaction
+		label  = a.label()
+	)
+	for i, dt := range dates {
+		if len(legs[i]) == 0 {
+			continue
 		}
+		result = append(result, TransactionBuilder{
+			Range:       t.Position(),
+			Date:        dt,
+			Flag:        t.Flag,
+			Tags:        t.Tags,
+			Links:       t.Links,
+			Metadata:    t.Metadata,
+			Description: fmt.Sprintf("%s (%s %d/%d)", t.Description, label, i+1, len(dates)),
+			Postings:    legs[i].Build(),
+		}.Build())
+	}
+	if len(booked) > 0 {
+		result = append(result, TransactionBuilder{
+			Range:       t.Position(),
+			Date:        t.Date,
+			Flag:        t.Flag,
+			Tags:        t.Tags,
+			Links:       t.Links,
+			Metadata:    t.Metadata,
+			Description: t.Description,
+			Postings:    booked.Build(),
+		}.Build())
 	}
 	return result
 }
 
+// scheduleDates returns the dates of the accrual schedule.
+func (a Accrual) scheduleDates() []time.Time {
+	if a.Dates != nil {
+		return a.Dates
+	}
+	return a.Period.Dates(a.Interval, 0)
+}
+
+// schedule returns the dates of the schedule with their weights. For
+// reversals, only the dates on or after t are returned.
+func (a Accrual) schedule(t time.Time) ([]time.Time, []decimal.Decimal) {
+	dates := a.scheduleDates()
+	weights := a.Weights
+	if len(weights) == 0 {
+		weights = make([]decimal.Decimal, len(dates))
+		for i := range weights {
+			weights[i] = decimal.NewFromInt(1)
+		}
+	}
+	if !a.Reverse {
+		return dates, weights
+	}
+	var (
+		res []time.Time
+		ws  []decimal.Decimal
+	)
+	for i, d := range dates {
+		if !d.Before(t) {
+			res = append(res, d)
+			ws = append(ws, weights[i])
+		}
+	}
+	if len(res) == 0 {
+		return []time.Time{t}, []decimal.Decimal{decimal.NewFromInt(1)}
+	}
+	return res, ws
+}
+
+// split splits amount according to the given weights. The remainder of
+// the division is added to the first part.
+func split(amount decimal.Decimal, weights []decimal.Decimal) []decimal.Decimal {
+	var total decimal.Decimal
+	for _, w := range weights {
+		total = total.Add(w)
+	}
+	res := make([]decimal.Decimal, len(weights))
+	rem := amount
+	for i, w := range weights {
+		res[i], _ = amount.Mul(w).QuoRem(total, 1)
+		rem = rem.Sub(res[i])
+	}
+	res[0] = res[0].Add(rem)
+	return res
+}
+
+func (a Accrual) label() string {
+	if a.Reverse {
+		return "accrual reversal"
+	}
+	return "accrual"
+}
+
 // Currency declares that a commodity is a currency.
 type Currency struct {
 	Range
 	Date time.Time
 	*Commodity
 }
+
+// Declaration declares a commodity, such as a security. In strict mode,
+// only commodities declared as a commodity or a currency can be used.
+type Declaration struct {
+	Range
+	Commodity *Commodity
+}
+
+// Option sets an option of the journal.
+type Option struct {
+	Range
+	Name string
+}
+
+// OptionStrict requires accounts to be opened and commodities to be
+// declared before they are used.
+const OptionStrict = "strict"
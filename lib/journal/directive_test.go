@@ -0,0 +1,319 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/shopspring/decimal"
+)
+
+func TestAccrualExpandReverse(t *testing.T) {
+	var (
+		jctx      = NewContext()
+		bank      = jctx.Account("Assets:Bank")
+		prepaid   = jctx.Account("Assets:Prepaid")
+		insurance = jctx.Account("Expenses:Insurance")
+		chf       = jctx.Commodity("CHF")
+		accrual   = &Accrual{
+			Interval: date.Monthly,
+			Period:   date.Period{Start: date.Date(2022, 1, 1), End: date.Date(2022, 12, 31)},
+			Account:  prepaid,
+			Reverse:  true,
+		}
+	)
+	trx := TransactionBuilder{
+		Date:        date.Date(2022, 10, 15),
+		Description: "Refund",
+		Postings: PostingBuilder{
+			Credit:    insurance,
+			Debit:     bank,
+			Commodity: chf,
+			Amount:    decimal.NewFromInt(300),
+		}.Build(),
+		Accrual: accrual,
+	}.Build()
+
+	got := accrual.Expand(trx)
+
+	type entry struct {
+		Date        string
+		Description string
+		Amount      string
+	}
+	var entries []entry
+	for _, t := range got {
+		for _, p := range t.Postings {
+			if p.Account == insurance || p.Account == bank {
+				entries = append(entries, entry{t.Date.Format("2006-01-02"), t.Description, p.Amount.String()})
+			}
+		}
+	}
+	want := []entry{
+		{"2022-10-31", "Refund (accrual reversal 1/3)", "-100"},
+		{"2022-11-30", "Refund (accrual reversal 2/3)", "-100"},
+		{"2022-12-31", "Refund (accrual reversal 3/3)", "-100"},
+		{"2022-10-15", "Refund", "300"},
+	}
+	if diff := cmp.Diff(want, entries); diff != "" {
+		t.Fatalf("unexpected diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestAccrualExpandSchedule(t *testing.T) {
+	var (
+		jctx      = NewContext()
+		bank      = jctx.Account("Assets:Bank")
+		prepaid   = jctx.Account("Assets:Prepaid")
+		insurance = jctx.Account("Expenses:Insurance")
+		chf       = jctx.Commodity("CHF")
+		weights   = []decimal.Decimal{decimal.NewFromInt(3), decimal.NewFromInt(2), decimal.NewFromInt(1)}
+	)
+	tests := []struct {
+		desc    string
+		accrual *Accrual
+		want    []string
+	}{
+		{
+			desc: "weighted",
+			accrual: &Accrual{
+				Interval: date.Monthly,
+				Period:   date.Period{Start: date.Date(2022, 1, 1), End: date.Date(2022, 3, 31)},
+				Weights:  weights,
+			},
+			want: []string{"2022-01-31 150", "2022-02-28 100", "2022-03-31 50"},
+		},
+		{
+			desc: "explicit dates",
+			accrual: &Accrual{
+				Dates: []time.Time{date.Date(2022, 1, 15), date.Date(2022, 6, 15)},
+			},
+			want: []string{"2022-01-15 150", "2022-06-15 150"},
+		},
+		{
+			desc: "explicit dates with weights",
+			accrual: &Accrual{
+				Dates:   []time.Time{date.Date(2022, 1, 15), date.Date(2022, 6, 15), date.Date(2022, 7, 1)},
+				Weights: weights,
+			},
+			want: []string{"2022-01-15 150", "2022-06-15 100", "2022-07-01 50"},
+		},
+		{
+			desc: "remainder",
+			accrual: &Accrual{
+				Dates:   []time.Time{date.Date(2022, 1, 15), date.Date(2022, 6, 15)},
+				Weights: []decimal.Decimal{decimal.NewFromInt(1), decimal.NewFromInt(6)},
+			},
+			want: []string{"2022-01-15 42.9", "2022-06-15 257.1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			test.accrual.Account = prepaid
+			trx := TransactionBuilder{
+				Date:        date.Date(2022, 1, 1),
+				Description: "Premium",
+				Postings: PostingBuilder{
+					Credit:    bank,
+					Debit:     insurance,
+					Commodity: chf,
+					Amount:    decimal.NewFromInt(300),
+				}.Build(),
+				Accrual: test.accrual,
+			}.Build()
+
+			var got []string
+			for _, t := range test.accrual.Expand(trx) {
+				for _, p := range t.Postings {
+					if p.Account == insurance {
+						got = append(got, fmt.Sprintf("%s %s", t.Date.Format("2006-01-02"), p.Amount))
+					}
+				}
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("unexpected diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAccrualExpandMultiplePostings(t *testing.T) {
+	var (
+		jctx      = NewContext()
+		bank      = jctx.Account("Assets:Bank")
+		prepaid   = jctx.Account("Assets:Prepaid")
+		equity    = jctx.Account("Equity:Equity")
+		insurance = jctx.Account("Expenses:Insurance")
+		tax       = jctx.Account("Expenses:Tax")
+		chf       = jctx.Commodity("CHF")
+		accrual   = &Accrual{
+			Interval: date.Monthly,
+			Period:   date.Period{Start: date.Date(2022, 1, 1), End: date.Date(2022, 3, 31)},
+			Account:  prepaid,
+		}
+	)
+	trx := TransactionBuilder{
+		Date:        date.Date(2022, 1, 1),
+		Description: "Premium",
+		Postings: PostingBuilders{
+			{Credit: bank, Debit: insurance, Commodity: chf, Amount: decimal.NewFromInt(300)},
+			{Credit: equity, Debit: tax, Commodity: chf, Amount: decimal.NewFromInt(100)},
+		}.Build(),
+		Accrual: accrual,
+	}.Build()
+
+	got := accrual.Expand(trx)
+
+	var entries []string
+	for _, trx := range got {
+		var total decimal.Decimal
+		for _, p := range trx.Postings {
+			total = total.Add(p.Amount)
+			if p.Account != prepaid {
+				entries = append(entries, fmt.Sprintf("%s %s %s %s", trx.Date.Format("2006-01-02"), trx.Description, p.Account, p.Amount))
+			}
+		}
+		if !total.IsZero() {
+			t.Errorf("transaction %q on %s is not balanced: %s", trx.Description, trx.Date.Format("2006-01-02"), total)
+		}
+	}
+	want := []string{
+		"2022-01-31 Premium (accrual 1/3) Expenses:Insurance 100",
+		"2022-01-31 Premium (accrual 1/3) Expenses:Tax 33.4",
+		"2022-02-28 Premium (accrual 2/3) Expenses:Insurance 100",
+		"2022-02-28 Premium (accrual 2/3) Expenses:Tax 33.3",
+		"2022-03-31 Premium (accrual 3/3) Expenses:Insurance 100",
+		"2022-03-31 Premium (accrual 3/3) Expenses:Tax 33.3",
+		"2022-01-01 Premium Assets:Bank -300",
+		"2022-01-01 Premium Equity:Equity -100",
+	}
+	if diff := cmp.Diff(want, entries); diff != "" {
+		t.Fatalf("unexpected diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestConversionPrices(t *testing.T) {
+	var (
+		jctx      = NewContext()
+		bank      = jctx.Account("Assets:Bank")
+		portfolio = jctx.Account("Assets:Portfolio")
+		aapl      = jctx.Commodity("AAPL")
+		usd       = jctx.Commodity("USD")
+	)
+	tests := []struct {
+		desc       string
+		amount     int64
+		conversion *Conversion
+		want       []string
+	}{
+		{desc: "none", amount: 10},
+		{
+			desc:       "unit price",
+			amount:     10,
+			conversion: &Conversion{Price: decimal.NewFromInt(150), Commodity: usd},
+			want:       []string{"2022-01-01 price AAPL 150 USD"},
+		},
+		{
+			desc:       "total price",
+			amount:     10,
+			conversion: &Conversion{Price: decimal.NewFromInt(1500), Commodity: usd, Total: true},
+			want:       []string{"2022-01-01 price AAPL 150 USD"},
+		},
+		{
+			desc:       "total price of negative amount",
+			amount:     -4,
+			conversion: &Conversion{Price: decimal.NewFromInt(600), Commodity: usd, Total: true},
+			want:       []string{"2022-01-01 price AAPL 150 USD"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			trx := TransactionBuilder{
+				Date:        date.Date(2022, 1, 1),
+				Description: "Buy",
+				Postings: PostingBuilder{
+					Credit:     bank,
+					Debit:      portfolio,
+					Commodity:  aapl,
+					Amount:     decimal.NewFromInt(test.amount),
+					Conversion: test.conversion,
+				}.Build(),
+			}.Build()
+
+			var got []string
+			for _, p := range trx.ConversionPrices() {
+				var b strings.Builder
+				if _, err := NewPrinter().PrintDirective(&b, p); err != nil {
+					t.Fatalf("PrintDirective() returned unexpected error: %v", err)
+				}
+				got = append(got, b.String())
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("ConversionPrices() returned unexpected prices (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTagKeyValue(t *testing.T) {
+	tests := []struct {
+		tag        Tag
+		key, value string
+	}{
+		{tag: "#food", key: "food"},
+		{tag: "#member:alice", key: "member", value: "alice"},
+	}
+	for _, test := range tests {
+		t.Run(string(test.tag), func(t *testing.T) {
+			if got := test.tag.Key(); got != test.key {
+				t.Errorf("Key() = %q, want %q", got, test.key)
+			}
+			if got := test.tag.Value(); got != test.value {
+				t.Errorf("Value() = %q, want %q", got, test.value)
+			}
+		})
+	}
+}
+
+func TestPostingTags(t *testing.T) {
+	tests := []struct {
+		desc        string
+		transaction []Tag
+		posting     []Tag
+		want        string
+	}{
+		{desc: "transaction tags", transaction: []Tag{"#vat"}, want: "#vat"},
+		{desc: "posting tags", transaction: []Tag{"#vat"}, posting: []Tag{"#project:alps"}, want: "#vat #project:alps"},
+		{desc: "duplicate tags", transaction: []Tag{"#vat"}, posting: []Tag{"#project:alps", "#vat"}, want: "#vat #project:alps"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			trx := Transaction{Tags: test.transaction}
+
+			got := trx.PostingTags(&Posting{Tags: test.posting})
+
+			if got != test.want {
+				t.Errorf("PostingTags() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package equity reconciles the changes in equity, i.e. in the net value of
+// the assets and liabilities, per period.
+package equity
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+)
+
+// Change is a category of changes in equity.
+type Change int
+
+const (
+	// Contributions are bookings between equity and asset or liability
+	// accounts, such as opening balances or capital withdrawn.
+	Contributions Change = iota
+	// RetainedEarnings are bookings between income or expense and asset or
+	// liability accounts, except for valuation gains.
+	RetainedEarnings
+	// ValuationGains are the adjustments of the values of assets and
+	// liabilities to market prices, booked to the valuation accounts.
+	ValuationGains
+
+	numChanges
+)
+
+func (c Change) String() string {
+	switch c {
+	case Contributions:
+		return "Contributions and withdrawals"
+	case RetainedEarnings:
+		return "Retained earnings"
+	case ValuationGains:
+		return "Valuation gains"
+	}
+	return ""
+}
+
+// Statement is a collection which accumulates the changes in equity per
+// period. Each period ends at one of the dates and starts the day after the
+// previous date; the first period starts at the given start date. Bookings
+// between assets and liabilities do not change equity and are ignored.
+type Statement struct {
+	context journal.Context
+	start   time.Time
+	dates   []time.Time
+
+	opening decimal.Decimal
+	changes [][numChanges]decimal.Decimal
+}
+
+// New creates a new statement.
+func New(jctx journal.Context, start time.Time, dates []time.Time) *Statement {
+	return &Statement{
+		context: jctx,
+		start:   start,
+		dates:   dates,
+		changes: make([][numChanges]decimal.Decimal, len(dates)),
+	}
+}
+
+// Insert inserts a posting. It expects valuated postings with their dates.
+func (s *Statement) Insert(k journal.Key, v decimal.Decimal) {
+	if k.Account == nil || !k.Account.IsAL() || k.Other == nil || k.Other.IsAL() {
+		return
+	}
+	if k.Date.Before(s.start) {
+		s.opening = s.opening.Add(v)
+		return
+	}
+	i := sort.Search(len(s.dates), func(i int) bool { return !s.dates[i].Before(k.Date) })
+	if i == len(s.dates) {
+		return
+	}
+	var c Change
+	switch {
+	case k.Other == s.context.ValuationAccountFor(k.Account):
+		c = ValuationGains
+	case k.Other.Type() == journal.EQUITY:
+		c = Contributions
+	default:
+		c = RetainedEarnings
+	}
+	s.changes[i][c] = s.changes[i][c].Add(v)
+}
+
+// Period holds the changes in equity of a period.
+type Period struct {
+	Date             time.Time
+	Opening, Closing decimal.Decimal
+	Changes          [numChanges]decimal.Decimal
+}
+
+// Periods returns the periods of the statement. The opening equity of a
+// period is the closing equity of the previous period.
+func (s *Statement) Periods() []Period {
+	res := make([]Period, 0, len(s.dates))
+	opening := s.opening
+	for i, d := range s.dates {
+		p := Period{Date: d, Opening: opening, Closing: opening, Changes: s.changes[i]}
+		for _, c := range p.Changes {
+			p.Closing = p.Closing.Add(c)
+		}
+		res = append(res, p)
+		opening = p.Closing
+	}
+	return res
+}
+
+// Render renders the periods.
+func Render(ps []Period) *table.Table {
+	tbl := table.New(1, len(ps))
+	tbl.AddSeparatorRow()
+	header := tbl.AddHeaderRow().AddEmpty()
+	for _, p := range ps {
+		header.AddText(p.Date.Format("2006-01-02"), table.Center)
+	}
+	tbl.AddSeparatorRow()
+	row := tbl.AddRow().AddText("Opening equity", table.Left)
+	for _, p := range ps {
+		row.AddNumber(p.Opening)
+	}
+	for c := Change(0); c < numChanges; c++ {
+		row := tbl.AddRow().AddText(c.String(), table.Left)
+		for _, p := range ps {
+			row.AddNumber(p.Changes[c])
+		}
+	}
+	tbl.AddSeparatorRow()
+	row = tbl.AddRow().AddText("Closing equity", table.Left)
+	for _, p := range ps {
+		row.AddNumber(p.Closing)
+	}
+	tbl.AddSeparatorRow()
+	return tbl
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package equity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestStatement(t *testing.T) {
+	var (
+		jctx      = journal.NewContext()
+		equity    = jctx.Account("Equity:Equity")
+		bank      = jctx.Account("Assets:Bank")
+		portfolio = jctx.Account("Assets:Portfolio")
+		salary    = jctx.Account("Income:Salary")
+		gains     = jctx.ValuationAccountFor(portfolio)
+		s         = New(jctx, date.Date(2020, 1, 1), []time.Time{date.Date(2020, 1, 31), date.Date(2020, 2, 29)})
+	)
+	insert := func(d time.Time, from, to *journal.Account, v int64) {
+		s.Insert(journal.Key{Date: d, Account: to, Other: from}, decimal.NewFromInt(v))
+		s.Insert(journal.Key{Date: d, Account: from, Other: to}, decimal.NewFromInt(-v))
+	}
+	insert(date.Date(2019, 12, 1), equity, bank, 1000)
+	insert(date.Date(2020, 1, 5), bank, portfolio, 400)
+	insert(date.Date(2020, 1, 25), salary, bank, 5000)
+	insert(date.Date(2020, 1, 31), gains, portfolio, 30)
+	insert(date.Date(2020, 2, 10), bank, equity, 500)
+	// after the last period
+	insert(date.Date(2020, 3, 1), salary, bank, 5000)
+
+	got := s.Periods()
+
+	want := []Period{
+		{
+			Date:    date.Date(2020, 1, 31),
+			Opening: decimal.NewFromInt(1000),
+			Closing: decimal.NewFromInt(6030),
+			Changes: [numChanges]decimal.Decimal{decimal.Zero, decimal.NewFromInt(5000), decimal.NewFromInt(30)},
+		},
+		{
+			Date:    date.Date(2020, 2, 29),
+			Opening: decimal.NewFromInt(6030),
+			Closing: decimal.NewFromInt(5530),
+			Changes: [numChanges]decimal.Decimal{decimal.NewFromInt(-500), decimal.Zero, decimal.Zero},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Periods() returned unexpected periods (-want/+got):\n%s", diff)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sboehler/knut/lib/journal/scanner"
+	"github.com/shopspring/decimal"
+)
+
+// ErrorCode is a machine-readable classification of an Error.
+type ErrorCode string
+
+// Error codes for journal errors.
+const (
+	ErrParse                ErrorCode = "ERR_PARSE"
+	ErrAccountNotOpen       ErrorCode = "ERR_ACCOUNT_NOT_OPEN"
+	ErrAccountAlreadyOpen   ErrorCode = "ERR_ACCOUNT_ALREADY_OPEN"
+	ErrAssertionFailed      ErrorCode = "ERR_ASSERTION_FAILED"
+	ErrNonzeroPosition      ErrorCode = "ERR_NONZERO_POSITION"
+	ErrNoPrice              ErrorCode = "ERR_NO_PRICE"
+	ErrCommodityNotAllowed  ErrorCode = "ERR_COMMODITY_NOT_ALLOWED"
+	ErrDuplicateValuation   ErrorCode = "ERR_DUPLICATE_VALUATION"
+	ErrCommodityNotDeclared ErrorCode = "ERR_COMMODITY_NOT_DECLARED"
+
+	// WarnBudget reports spending which has reached the alert threshold of
+	// a budget or exceeds it. It does not make the journal invalid.
+	WarnBudget ErrorCode = "WARN_BUDGET"
+)
+
+// Error is a processing error, with a reference to a directive with
+// a source location.
+type Error struct {
+	Code      ErrorCode
+	Directive Directive
+	Message   string
+	Fix       string
+
+	// Difference is the amount missing for a failed assertion to hold.
+	Difference decimal.Decimal
+
+	// Repair is a transaction which would fix the error, if any.
+	Repair *Transaction
+}
+
+// RepairAssertion returns a transaction which books the difference of a
+// failed assertion against the suspense account.
+func RepairAssertion(a *Assertion, diff decimal.Decimal, suspense *Account) *Transaction {
+	return TransactionBuilder{
+		Date:        a.Date,
+		Description: fmt.Sprintf("Reconcile %s", a.Account.Name()),
+		Postings: PostingBuilder{
+			Credit:    suspense,
+			Debit:     a.Account,
+			Commodity: a.Commodity,
+			Amount:    diff,
+		}.Build(),
+	}.Build()
+}
+
+func (be Error) Error() string {
+	var (
+		p Printer
+		b strings.Builder
+	)
+	if be.Directive != nil {
+		fmt.Fprintf(&b, "%s:\n", be.Directive.Position().Start)
+		p.PrintDirective(&b, be.Directive)
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%s\n", be.Message)
+	if len(be.Fix) > 0 {
+		fmt.Fprintf(&b, "suggested fix: %s\n", be.Fix)
+	}
+	return b.String()
+}
+
+type jsonLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type jsonPosition struct {
+	Path  string       `json:"path"`
+	Start jsonLocation `json:"start"`
+	End   jsonLocation `json:"end"`
+}
+
+type jsonError struct {
+	Code      ErrorCode     `json:"code"`
+	Message   string        `json:"message"`
+	Position  *jsonPosition `json:"position,omitempty"`
+	Directive string        `json:"directive,omitempty"`
+	Fix       string        `json:"fix,omitempty"`
+	Repair    string        `json:"repair,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (be Error) MarshalJSON() ([]byte, error) {
+	res := jsonError{
+		Code:    be.Code,
+		Message: be.Message,
+		Fix:     be.Fix,
+	}
+	if be.Directive != nil {
+		var (
+			p Printer
+			b strings.Builder
+			r = be.Directive.Position()
+		)
+		p.PrintDirective(&b, be.Directive)
+		res.Directive = b.String()
+		res.Position = &jsonPosition{
+			Path:  r.Path,
+			Start: newJSONLocation(r.Start),
+			End:   newJSONLocation(r.End),
+		}
+	}
+	if be.Repair != nil {
+		var (
+			p Printer
+			b strings.Builder
+		)
+		p.PrintDirective(&b, be.Repair)
+		res.Repair = b.String()
+	}
+	return json.Marshal(res)
+}
+
+func newJSONLocation(l scanner.Location) jsonLocation {
+	return jsonLocation{Line: l.Line, Column: l.Column}
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal/scanner"
+	"github.com/shopspring/decimal"
+)
+
+func TestErrorMarshalJSON(t *testing.T) {
+	jctx := NewContext()
+	err := Error{
+		Code: ErrAccountAlreadyOpen,
+		Directive: &Open{
+			Range: Range{
+				Path:  "journal.knut",
+				Start: scanner.Location{Line: 3, Column: 1},
+				End:   scanner.Location{Line: 3, Column: 28},
+			},
+			Date:    date.Date(2022, 1, 1),
+			Account: jctx.Account("Assets:Bank"),
+		},
+		Message: "account is already open",
+		Fix:     "remove the duplicate open directive",
+	}
+	want := `{"code":"ERR_ACCOUNT_ALREADY_OPEN","message":"account is already open",` +
+		`"position":{"path":"journal.knut","start":{"line":3,"column":1},"end":{"line":3,"column":28}},` +
+		`"directive":"2022-01-01 open Assets:Bank","fix":"remove the duplicate open directive"}`
+
+	got, e := json.Marshal(err)
+
+	if e != nil {
+		t.Fatalf("json.Marshal() returned unexpected error: %v", e)
+	}
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("json.Marshal() returned unexpected diff (-want/+got):\n%s", diff)
+	}
+}
+
+func TestRepairAssertion(t *testing.T) {
+	var (
+		jctx     = NewContext()
+		bank     = jctx.Account("Assets:Bank")
+		suspense = jctx.Account("Expenses:TBD")
+		chf      = jctx.Commodity("CHF")
+		a        = &Assertion{Date: date.Date(2022, 1, 31), Account: bank, Amount: decimal.NewFromInt(100), Commodity: chf}
+	)
+	for _, diff := range []int64{5, -5} {
+		got := RepairAssertion(a, decimal.NewFromInt(diff), suspense)
+
+		if got.Date != a.Date || got.Description != "Reconcile Assets:Bank" {
+			t.Errorf("RepairAssertion(%d) returned transaction %v %q", diff, got.Date, got.Description)
+		}
+		amounts := make(map[*Account]decimal.Decimal)
+		for _, p := range got.Postings {
+			if p.Commodity != chf {
+				t.Errorf("RepairAssertion(%d) returned posting in %s", diff, p.Commodity.Name())
+			}
+			amounts[p.Account] = amounts[p.Account].Add(p.Amount)
+		}
+		if !amounts[bank].Equal(decimal.NewFromInt(diff)) || !amounts[suspense].Equal(decimal.NewFromInt(-diff)) {
+			t.Errorf("RepairAssertion(%d) books %s to %s and %s to %s", diff, amounts[bank], bank, amounts[suspense], suspense)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package forecast projects the balances of asset and liability accounts
+// by extrapolating recurring income and expenses.
+package forecast
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+)
+
+// RecurringTag is the key of the tag which declares a transaction as
+// recurring, e.g. #recurring:monthly. Without a value, the transaction
+// recurs monthly.
+const RecurringTag = "recurring"
+
+// flow is a booking between an asset or liability account and an income
+// or expense account.
+type flow struct {
+	account, other *journal.Account
+	commodity      *journal.Commodity
+}
+
+// Forecast projects the balances of the asset and liability accounts from
+// a given date.
+//
+// Transactions tagged with RecurringTag are declared recurring: the last
+// transaction with a given description is repeated at the interval of the
+// tag. Other bookings between an asset or liability account and an income
+// or expense account are detected as recurring if they occur in each month
+// of the history before the date; they are projected with their monthly
+// average.
+type Forecast struct {
+	date    time.Time
+	history []time.Time
+
+	balances  journal.Amounts
+	flows     map[flow][]decimal.Decimal
+	recurring map[string]recurring
+}
+
+type recurring struct {
+	transaction *journal.Transaction
+	interval    date.Interval
+}
+
+// New creates a forecast from the given date, detecting recurring bookings
+// in the given number of months before it.
+func New(t time.Time, history int) *Forecast {
+	f := &Forecast{
+		date:      t,
+		balances:  make(journal.Amounts),
+		flows:     make(map[flow][]decimal.Decimal),
+		recurring: make(map[string]recurring),
+	}
+	for i := history; i > 0; i-- {
+		f.history = append(f.history, addMonths(t, -i))
+	}
+	return f
+}
+
+// Process processes a day. It must run after Balance.
+func (f *Forecast) Process(d *journal.Day) error {
+	if d.Date.After(f.date) {
+		return nil
+	}
+	for _, t := range d.Transactions {
+		for _, p := range t.Postings {
+			if p.Account.IsAL() {
+				f.balances.Add(journal.AccountCommodityKey(p.Account, p.Commodity), p.Amount)
+			}
+		}
+		interval, ok, err := recurringInterval(t)
+		if err != nil {
+			return err
+		}
+		if ok {
+			f.recurring[t.Description] = recurring{t, interval}
+			continue
+		}
+		i := f.month(d.Date)
+		if i < 0 {
+			continue
+		}
+		for _, p := range t.Postings {
+			if !p.Account.IsAL() || !p.Other.IsIE() {
+				continue
+			}
+			k := flow{p.Account, p.Other, p.Commodity}
+			amounts := dict.GetDefault(f.flows, k, func() []decimal.Decimal {
+				return make([]decimal.Decimal, len(f.history))
+			})
+			amounts[i] = amounts[i].Add(p.Amount)
+		}
+	}
+	return nil
+}
+
+// month returns the index of the month of the history which contains t,
+// or -1 if t is not in the history.
+func (f *Forecast) month(t time.Time) int {
+	if len(f.history) == 0 || !t.After(f.history[0]) {
+		return -1
+	}
+	for i := len(f.history) - 1; i >= 0; i-- {
+		if t.After(f.history[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+func recurringInterval(t *journal.Transaction) (date.Interval, bool, error) {
+	for _, tag := range t.Tags {
+		if tag.Key() != RecurringTag {
+			continue
+		}
+		switch tag.Value() {
+		case "", "monthly":
+			return date.Monthly, true, nil
+		case "daily":
+			return date.Daily, true, nil
+		case "weekly":
+			return date.Weekly, true, nil
+		case "quarterly":
+			return date.Quarterly, true, nil
+		case "yearly":
+			return date.Yearly, true, nil
+		}
+		return 0, false, fmt.Errorf("%s %q: invalid interval %q in tag %s, expected daily, weekly, monthly, quarterly or yearly", t.Date.Format("2006-01-02"), t.Description, tag.Value(), tag)
+	}
+	return 0, false, nil
+}
+
+// Dates returns the date of the forecast, followed by the dates of the
+// given number of months after it.
+func (f *Forecast) Dates(months int) []time.Time {
+	res := []time.Time{f.date}
+	for i := 1; i <= months; i++ {
+		res = append(res, addMonths(f.date, i))
+	}
+	return res
+}
+
+// Row holds the balance of an account in a commodity at each date.
+type Row struct {
+	Account   *journal.Account
+	Commodity *journal.Commodity
+	Balances  []decimal.Decimal
+}
+
+// Rows returns the current and the projected balances at the given dates,
+// which must start with the date of the forecast. The rows are sorted by
+// account and commodity, and rows with zero balances are omitted.
+func (f *Forecast) Rows(dates []time.Time) []*Row {
+	deltas := make(map[journal.Key][]decimal.Decimal)
+	add := func(k journal.Key, i int, amount decimal.Decimal) {
+		ds := dict.GetDefault(deltas, k, func() []decimal.Decimal { return make([]decimal.Decimal, len(dates)) })
+		for ; i < len(dates); i++ {
+			ds[i] = ds[i].Add(amount)
+		}
+	}
+	for k, amounts := range f.flows {
+		var total decimal.Decimal
+		for _, a := range amounts {
+			if a.IsZero() {
+				total = decimal.Zero
+				break
+			}
+			total = total.Add(a)
+		}
+		if total.IsZero() {
+			continue
+		}
+		monthly := total.Div(decimal.NewFromInt(int64(len(amounts))))
+		for i := 1; i < len(dates); i++ {
+			add(journal.AccountCommodityKey(k.account, k.commodity), i, monthly)
+		}
+	}
+	for _, r := range f.recurring {
+		for t := next(r.transaction.Date, r.interval, 1); !t.After(dates[len(dates)-1]); t = next(t, r.interval, 1) {
+			if !t.After(f.date) {
+				continue
+			}
+			i := 1
+			for dates[i].Before(t) {
+				i++
+			}
+			for _, p := range r.transaction.Postings {
+				if p.Account.IsAL() {
+					add(journal.AccountCommodityKey(p.Account, p.Commodity), i, p.Amount)
+				}
+			}
+		}
+	}
+	keys := make(map[journal.Key]bool)
+	for k := range f.balances {
+		keys[k] = true
+	}
+	for k := range deltas {
+		keys[k] = true
+	}
+	var res []*Row
+	for k := range keys {
+		rw := &Row{Account: k.Account, Commodity: k.Commodity, Balances: make([]decimal.Decimal, len(dates))}
+		var nonzero bool
+		for i := range dates {
+			rw.Balances[i] = f.balances[k]
+			if ds, ok := deltas[k]; ok {
+				rw.Balances[i] = rw.Balances[i].Add(ds[i])
+			}
+			nonzero = nonzero || !rw.Balances[i].IsZero()
+		}
+		if nonzero {
+			res = append(res, rw)
+		}
+	}
+	compare.Sort(res, func(r1, r2 *Row) compare.Order {
+		if o := journal.CompareAccounts(r1.Account, r2.Account); o != compare.Equal {
+			return o
+		}
+		return journal.CompareCommodities(r1.Commodity, r2.Commodity)
+	})
+	return res
+}
+
+// next returns the date n intervals after t.
+func next(t time.Time, interval date.Interval, n int) time.Time {
+	switch interval {
+	case date.Daily:
+		return t.AddDate(0, 0, n)
+	case date.Weekly:
+		return t.AddDate(0, 0, 7*n)
+	case date.Quarterly:
+		return addMonths(t, 3*n)
+	case date.Yearly:
+		return addMonths(t, 12*n)
+	}
+	return addMonths(t, n)
+}
+
+// addMonths adds n months to t. The day is clipped to the end of the month,
+// and the end of a month is mapped to the end of the month.
+func addMonths(t time.Time, n int) time.Time {
+	first := date.StartOf(t, date.Monthly).AddDate(0, n, 0)
+	last := date.EndOf(first, date.Monthly)
+	if t.Equal(date.EndOf(t, date.Monthly)) || t.Day() > last.Day() {
+		return last
+	}
+	return date.Date(first.Year(), first.Month(), t.Day())
+}
+
+// Render renders the rows, followed by the totals per commodity. The first
+// column holds the current balances, the other columns the projected
+// balances.
+func Render(dates []time.Time, rows []*Row) *table.Table {
+	tbl := table.New(1, 1, len(dates))
+	tbl.AddSeparatorRow()
+	header := tbl.AddHeaderRow().AddText("Account", table.Center).AddText("Comm", table.Center)
+	for _, d := range dates {
+		header.AddText(d.Format("2006-01-02"), table.Center)
+	}
+	tbl.AddSeparatorRow()
+	var (
+		commodities []*journal.Commodity
+		totals      = make(map[*journal.Commodity][]decimal.Decimal)
+	)
+	for _, rw := range rows {
+		renderRow(tbl, rw.Account.Name(), rw.Commodity, rw.Balances)
+		total, ok := totals[rw.Commodity]
+		if !ok {
+			total = make([]decimal.Decimal, len(dates))
+			totals[rw.Commodity] = total
+			commodities = append(commodities, rw.Commodity)
+		}
+		for i := range total {
+			total[i] = total[i].Add(rw.Balances[i])
+		}
+	}
+	tbl.AddSeparatorRow()
+	compare.Sort(commodities, journal.CompareCommodities)
+	for _, c := range commodities {
+		renderRow(tbl, "Total", c, totals[c])
+	}
+	if len(commodities) > 0 {
+		tbl.AddSeparatorRow()
+	}
+	return tbl
+}
+
+func renderRow(tbl *table.Table, name string, c *journal.Commodity, amounts []decimal.Decimal) {
+	row := tbl.AddRow().AddText(name, table.Left).AddText(c.Name(), table.Left)
+	for _, a := range amounts {
+		row.AddNumber(a)
+	}
+}
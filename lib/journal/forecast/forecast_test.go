@@ -0,0 +1,100 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestAddMonths(t *testing.T) {
+	for _, test := range []struct {
+		t    time.Time
+		n    int
+		want time.Time
+	}{
+		{date.Date(2020, 1, 15), 1, date.Date(2020, 2, 15)},
+		{date.Date(2020, 1, 30), 1, date.Date(2020, 2, 29)},
+		{date.Date(2020, 2, 29), 1, date.Date(2020, 3, 31)},
+		{date.Date(2020, 3, 31), -1, date.Date(2020, 2, 29)},
+		{date.Date(2020, 11, 15), 3, date.Date(2021, 2, 15)},
+	} {
+		if got := addMonths(test.t, test.n); !got.Equal(test.want) {
+			t.Errorf("addMonths(%s, %d) = %s, want %s", test.t.Format("2006-01-02"), test.n, got.Format("2006-01-02"), test.want.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestForecast(t *testing.T) {
+	var (
+		jctx   = journal.NewContext()
+		equity = jctx.Account("Equity:Equity")
+		bank   = jctx.Account("Assets:Bank")
+		salary = jctx.Account("Income:Salary")
+		gifts  = jctx.Account("Income:Gifts")
+		rent   = jctx.Account("Expenses:Rent")
+		chf    = jctx.Commodity("CHF")
+		j      = journal.New(jctx)
+	)
+	for _, a := range []*journal.Account{equity, bank, salary, gifts, rent} {
+		j.AddOpen(&journal.Open{Date: date.Date(2020, 1, 1), Account: a})
+	}
+	book := func(d time.Time, credit, debit *journal.Account, amount int64, tags ...journal.Tag) {
+		j.AddTransaction(journal.TransactionBuilder{
+			Date:        d,
+			Description: credit.Name(),
+			Tags:        tags,
+			Postings: journal.PostingBuilder{
+				Credit:    credit,
+				Debit:     debit,
+				Commodity: chf,
+				Amount:    decimal.NewFromInt(amount),
+			}.Build(),
+		}.Build())
+	}
+	book(date.Date(2020, 1, 20), salary, bank, 1000)
+	book(date.Date(2020, 2, 20), salary, bank, 2000)
+	// not in each month of the history
+	book(date.Date(2020, 2, 25), gifts, bank, 500)
+	book(date.Date(2020, 2, 1), bank, rent, 300, "#recurring:weekly")
+	f := New(date.Date(2020, 2, 29), 2)
+
+	if _, err := j.Process(journal.Balance(jctx, nil), f.Process); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	dates := f.Dates(1)
+	got := f.Rows(dates)
+
+	if diff := cmp.Diff([]time.Time{date.Date(2020, 2, 29), date.Date(2020, 3, 31)}, dates); diff != "" {
+		t.Errorf("Dates() returned unexpected dates (-want/+got):\n%s", diff)
+	}
+	want := []*Row{
+		{
+			Account:   bank,
+			Commodity: chf,
+			// 1500 per month of salary, 4 weeks of rent in March
+			Balances: []decimal.Decimal{decimal.NewFromInt(3200), decimal.NewFromInt(3200 + 1500 - 4*300)},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b *journal.Account) bool { return a == b }), cmp.Comparer(func(a, b *journal.Commodity) bool { return a == b }), cmp.Comparer(func(a, b decimal.Decimal) bool { return a.Equal(b) })); diff != "" {
+		t.Errorf("Rows() returned unexpected rows (-want/+got):\n%s", diff)
+	}
+}
@@ -15,8 +15,15 @@
 package format
 
 import (
+	"bufio"
+	"bytes"
 	"io"
 	"io/ioutil"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+	"unicode"
 
 	"github.com/sboehler/knut/lib/journal"
 )
@@ -26,10 +33,72 @@ type reader interface {
 	io.Reader
 }
 
+// Options are optional transformations of the formatter. The zero value
+// formats the directives only.
+type Options struct {
+	// Wrap is the width beyond which the descriptions of transactions are
+	// continued on the following lines, or zero to not wrap them.
+	Wrap int
+
+	// NormalizeComments rewrites the comment lines starting with "#" or
+	// ";" to start with "#", followed by a space. Comments starting with
+	// "*", which are headings in Emacs' org mode, are left alone.
+	NormalizeComments bool
+}
+
 // Format formats the directives returned by p.
 func Format(directives []journal.Directive, src reader, dest io.Writer) error {
+	return Options{}.Format(directives, src, dest)
+}
+
+// Sort formats the directives and sorts them by date. See Options.Sort.
+func Sort(directives []journal.Directive, src io.Reader, dest io.Writer) error {
+	return Options{}.Sort(directives, src, dest)
+}
+
+func (o Options) printer() *journal.Printer {
+	p := journal.NewPrinter()
+	p.Wrap = o.Wrap
+	return p
+}
+
+// text returns the text between directives, with its comments normalized
+// if requested.
+func (o Options) text(bs []byte) []byte {
+	if !o.NormalizeComments {
+		return bs
+	}
+	var res []byte
+	for _, line := range bytes.SplitAfter(bs, []byte("\n")) {
+		res = append(res, normalizeComment(line)...)
+	}
+	return res
+}
+
+// normalizeComment normalizes a comment line starting with "#" or ";",
+// optionally preceded by white space. Other lines are returned unchanged.
+func normalizeComment(line []byte) []byte {
+	body := bytes.TrimLeft(line, " \t")
+	if len(body) == 0 || body[0] != '#' && body[0] != ';' {
+		return line
+	}
+	var eol []byte
+	if i := bytes.IndexAny(body, "\r\n"); i >= 0 {
+		body, eol = body[:i], body[i:]
+	}
+	body = bytes.TrimRight(body, " \t")
+	text := bytes.TrimLeft(body, "#;")
+	res := bytes.Repeat([]byte("#"), len(body)-len(text))
+	if len(text) > 0 && text[0] != ' ' && text[0] != '\t' {
+		res = append(res, ' ')
+	}
+	return append(append(res, text...), eol...)
+}
+
+// Format formats the directives returned by p, applying the options.
+func (o Options) Format(directives []journal.Directive, src reader, dest io.Writer) error {
 	var (
-		p          = journal.NewPrinter()
+		p          = o.printer()
 		srcBytePos int
 	)
 	p.Initialize(directives)
@@ -37,7 +106,7 @@ func Format(directives []journal.Directive, src reader, dest io.Writer) error {
 		p0, p1 := d.Position().Start.BytePos, d.Position().End.BytePos
 
 		// copy text before directive from src to dest
-		if _, err := io.CopyN(dest, src, int64(p0-srcBytePos)); err != nil {
+		if err := o.copyText(dest, src, p0-srcBytePos); err != nil {
 			return err
 		}
 
@@ -53,6 +122,313 @@ func Format(directives []journal.Directive, src reader, dest io.Writer) error {
 		// update srcPos
 		srcBytePos = p1
 	}
-	_, err := io.Copy(dest, src)
+	return o.copyText(dest, src, -1)
+}
+
+// copyText copies n bytes of text between directives from src to dest, or
+// the rest of src if n is negative.
+func (o Options) copyText(dest io.Writer, src io.Reader, n int) error {
+	if !o.NormalizeComments {
+		var err error
+		if n < 0 {
+			_, err = io.Copy(dest, src)
+		} else {
+			_, err = io.CopyN(dest, src, int64(n))
+		}
+		return err
+	}
+	if n >= 0 {
+		src = io.LimitReader(src, int64(n))
+	}
+	bs, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	if n >= 0 && len(bs) < n {
+		return io.EOF
+	}
+	_, err = dest.Write(o.text(bs))
+	return err
+}
+
+// Insert copies src to dest, inserting the given directives after the last
+// directive in src with the same or an earlier date. Text in src is copied
+// verbatim. The directives must be those parsed from src, in file order.
+func Insert(directives []journal.Directive, insert []journal.Directive, src io.Reader, dest io.Writer) error {
+	type insertion struct {
+		pos   int64
+		after bool
+		date  time.Time
+		text  []byte
+	}
+	var (
+		p   = journal.NewPrinter()
+		ins []insertion
+	)
+	p.Initialize(append(append([]journal.Directive{}, directives...), insert...))
+	for _, d := range insert {
+		var buf bytes.Buffer
+		if _, err := p.PrintDirective(&buf, d); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		// insert at the end of the file if there are no dated directives
+		in := insertion{pos: math.MaxInt64, after: true, text: buf.Bytes()}
+		in.date, _ = dateOf(d)
+		for _, d := range directives {
+			dt, ok := dateOf(d)
+			if !ok {
+				continue
+			}
+			if !dt.After(in.date) {
+				in.pos, in.after = int64(d.Position().End.BytePos), true
+			} else if in.pos == math.MaxInt64 {
+				in.pos, in.after = int64(d.Position().Start.BytePos), false
+			}
+		}
+		ins = append(ins, in)
+	}
+	sort.SliceStable(ins, func(i, j int) bool {
+		if ins[i].pos != ins[j].pos {
+			return ins[i].pos < ins[j].pos
+		}
+		return ins[i].date.Before(ins[j].date)
+	})
+	var (
+		srcBytePos int64
+		w          = &lastByteWriter{Writer: dest}
+	)
+	for _, in := range ins {
+		if in.pos == math.MaxInt64 {
+			if _, err := io.Copy(w, src); err != nil {
+				return err
+			}
+		} else {
+			if _, err := io.CopyN(w, src, in.pos-srcBytePos); err != nil {
+				return err
+			}
+			srcBytePos = in.pos
+		}
+		var text []byte
+		switch {
+		case !in.after:
+			text = append(in.text, '\n')
+		case w.last == 0:
+			text = in.text
+		case w.last == '\n':
+			text = append([]byte{'\n'}, in.text...)
+		case in.pos == math.MaxInt64:
+			text = append([]byte("\n\n"), in.text...)
+		default:
+			// the directive ends before the newline, which is copied from src
+			text = append([]byte("\n\n"), in.text[:len(in.text)-1]...)
+		}
+		if _, err := w.Write(text); err != nil {
+			return err
+		}
+	}
+	_, err := io.Copy(w, src)
+	return err
+}
+
+// Sort formats the directives and copies src to dest with the dated
+// directives in chronological order. Directives with the same date keep
+// their order. Comments and directives without a date, such as includes,
+// move along with the dated directive which follows them. Text before the
+// first and after the last dated directive stays in place. The directives
+// must be those parsed from src, in file order.
+func (o Options) Sort(directives []journal.Directive, src io.Reader, dest io.Writer) error {
+	bs, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	type unit struct {
+		d               journal.Directive
+		date            time.Time
+		index           int
+		start, end      int
+		blankBefore     bool
+		lead, directive []byte
+	}
+	var (
+		p      = o.printer()
+		units  []*unit
+		render = func(from, to int) ([]byte, error) {
+			var buf bytes.Buffer
+			for _, d := range directives {
+				p0, p1 := d.Position().Start.BytePos, d.Position().End.BytePos
+				if p0 < from || p1 > to {
+					continue
+				}
+				buf.Write(o.text(bs[from:p0]))
+				if _, err := p.PrintDirective(&buf, d); err != nil {
+					return nil, err
+				}
+				from = p1
+			}
+			buf.Write(o.text(bs[from:to]))
+			return buf.Bytes(), nil
+		}
+	)
+	p.Initialize(directives)
+	for _, d := range directives {
+		dt, ok := dateOf(d)
+		if !ok {
+			continue
+		}
+		u := &unit{d: d, date: dt, index: len(units), start: d.Position().Start.BytePos, end: lineEnd(bs, d.Position().End.BytePos)}
+		var buf bytes.Buffer
+		if _, err := p.PrintDirective(&buf, d); err != nil {
+			return err
+		}
+		u.directive = append(bytes.TrimRight(buf.Bytes(), "\n"), '\n')
+		units = append(units, u)
+	}
+	if len(units) == 0 {
+		return o.Format(directives, bufio.NewReader(bytes.NewReader(bs)), dest)
+	}
+	header := attachedLines(bs, units[0].start)
+	for i, u := range units {
+		leadStart := header
+		if i > 0 {
+			prev := units[i-1]
+			leadStart = firstTextLine(bs, prev.end, u.start)
+			u.blankBefore = bytes.Contains(bs[prev.end:leadStart], []byte("\n"))
+		}
+		if u.lead, err = render(leadStart, u.start); err != nil {
+			return err
+		}
+	}
+	sorted := append([]*unit(nil), units...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].date.Before(sorted[j].date)
+	})
+	text, err := render(0, header)
+	if err != nil {
+		return err
+	}
+	if _, err := dest.Write(text); err != nil {
+		return err
+	}
+	for i, u := range sorted {
+		var blank bool
+		switch {
+		case i == 0:
+		case u.index == sorted[i-1].index+1:
+			blank = u.blankBefore
+		default:
+			blank = !groups(sorted[i-1].d, sorted[i-1].directive, u.d, u.directive) || len(u.lead) > 0
+		}
+		if blank {
+			if _, err := io.WriteString(dest, "\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := dest.Write(append(u.lead, u.directive...)); err != nil {
+			return err
+		}
+	}
+	last := units[len(units)-1]
+	if text, err = render(last.end, len(bs)); err != nil {
+		return err
+	}
+	_, err = dest.Write(text)
 	return err
 }
+
+// lineEnd returns the position after the newline which ends the line of
+// pos, if there is nothing but white space between pos and the newline.
+func lineEnd(bs []byte, pos int) int {
+	if pos > 0 && bs[pos-1] == '\n' {
+		return pos
+	}
+	for i := pos; i < len(bs); i++ {
+		switch bs[i] {
+		case ' ', '\t', '\r':
+		case '\n':
+			return i + 1
+		default:
+			return pos
+		}
+	}
+	return len(bs)
+}
+
+// attachedLines returns the start of the lines without blank lines in
+// between which directly precede the line starting at pos.
+func attachedLines(bs []byte, pos int) int {
+	for pos > 0 {
+		start := bytes.LastIndexByte(bs[:pos-1], '\n') + 1
+		if len(bytes.TrimSpace(bs[start:pos])) == 0 {
+			break
+		}
+		pos = start
+	}
+	return pos
+}
+
+// firstTextLine returns the start of the first line between from and to
+// which is not blank, or to if there is no such line.
+func firstTextLine(bs []byte, from, to int) int {
+	i := from + bytes.IndexFunc(bs[from:to], func(r rune) bool { return !unicode.IsSpace(r) })
+	if i < from {
+		return to
+	}
+	if start := bytes.LastIndexByte(bs[:i], '\n') + 1; start > from {
+		return start
+	}
+	return from
+}
+
+// groups returns whether two directives are written on consecutive lines,
+// which is the case for directives of the same kind on a single line, such
+// as openings or prices.
+func groups(d1 journal.Directive, text1 []byte, d2 journal.Directive, text2 []byte) bool {
+	return reflect.TypeOf(d1) == reflect.TypeOf(d2) &&
+		bytes.Count(text1, []byte("\n")) == 1 &&
+		bytes.Count(text2, []byte("\n")) == 1
+}
+
+type lastByteWriter struct {
+	io.Writer
+	last byte
+}
+
+func (w *lastByteWriter) Write(bs []byte) (int, error) {
+	if len(bs) > 0 {
+		w.last = bs[len(bs)-1]
+	}
+	return w.Writer.Write(bs)
+}
+
+func dateOf(d journal.Directive) (time.Time, bool) {
+	switch t := d.(type) {
+	case *journal.Transaction:
+		return t.Date, true
+	case *journal.Open:
+		return t.Date, true
+	case *journal.Close:
+		return t.Date, true
+	case *journal.Price:
+		return t.Date, true
+	case *journal.Assertion:
+		return t.Date, true
+	case *journal.Value:
+		return t.Date, true
+	case *journal.Rename:
+		return t.Date, true
+	case *journal.Split:
+		return t.Date, true
+	case *journal.Budget:
+		return t.Date, true
+	case *journal.Currency:
+		return t.Date, true
+	case *journal.Auto:
+		return t.Date, true
+	case *journal.Valuation:
+		return t.Date, true
+	}
+	return time.Time{}, false
+}
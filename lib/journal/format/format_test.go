@@ -0,0 +1,144 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sebdah/goldie/v2"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestInsert(t *testing.T) {
+	var (
+		jctx       = journal.NewContext()
+		bank       = jctx.Account("Assets:Bank")
+		food       = jctx.Account("Expenses:Food")
+		chf        = jctx.Commodity("CHF")
+		path       = "testdata/insert.knut"
+		directives []journal.Directive
+		insert     []journal.Directive
+	)
+	p, cls, err := journal.ParserFromPath(jctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cls()
+	for {
+		d, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		directives = append(directives, d)
+	}
+	for _, d := range []struct {
+		date   int
+		amount int64
+	}{{20191231, 1}, {20200201, 2}, {20200301, 3}, {20200415, 4}} {
+		insert = append(insert, journal.TransactionBuilder{
+			Date:        date.Date(d.date/10000, time.Month(d.date/100%100), d.date%100),
+			Description: "Inserted",
+			Postings: journal.PostingBuilder{
+				Credit:    bank,
+				Debit:     food,
+				Commodity: chf,
+				Amount:    decimal.NewFromInt(d.amount),
+			}.Build(),
+		}.Build())
+	}
+	insert = append(insert, &journal.Assertion{Date: date.Date(2020, 2, 1), Account: bank, Commodity: chf, Amount: decimal.NewFromInt(-12)})
+	src, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	var got bytes.Buffer
+
+	if err := Insert(directives, insert, bufio.NewReader(src), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	goldie.New(t).Assert(t, "insert", got.Bytes())
+}
+
+func TestSort(t *testing.T) {
+	var (
+		path       = "testdata/sort.knut"
+		directives = readDirectives(t, path)
+	)
+	src, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	var got bytes.Buffer
+
+	if err := Sort(directives, src, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	goldie.New(t).Assert(t, "sort", got.Bytes())
+}
+
+func TestFormatOptions(t *testing.T) {
+	var (
+		path       = "testdata/options.knut"
+		directives = readDirectives(t, path)
+		options    = Options{Wrap: 60, NormalizeComments: true}
+	)
+	src, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	var got bytes.Buffer
+
+	if err := options.Format(directives, bufio.NewReader(src), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	goldie.New(t).Assert(t, "options", got.Bytes())
+}
+
+func readDirectives(t *testing.T, path string) []journal.Directive {
+	t.Helper()
+	p, cls, err := journal.ParserFromPath(journal.NewContext(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cls()
+	var directives []journal.Directive
+	for {
+		d, err := p.Next()
+		if err == io.EOF {
+			return directives
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		directives = append(directives, d)
+	}
+}
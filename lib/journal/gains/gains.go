@@ -0,0 +1,279 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gains splits the valuation gains into realized and unrealized
+// gains per commodity and period.
+package gains
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+)
+
+// position is a position of a commodity in an account with the valuation
+// gains accumulated since its acquisition.
+type position struct {
+	quantity, gains decimal.Decimal
+}
+
+// reduce reduces the position by the given amount and returns the share of
+// the accumulated gains which is removed with it.
+func (p *position) reduce(amount decimal.Decimal) decimal.Decimal {
+	quantity := p.quantity.Add(amount)
+	removed := p.gains
+	if !quantity.IsZero() && quantity.Sign() == p.quantity.Sign() {
+		removed = p.gains.Mul(amount).Div(p.quantity).Neg()
+	}
+	p.quantity, p.gains = quantity, p.gains.Sub(removed)
+	return removed
+}
+
+// Report accumulates the valuation gains per commodity and period. Each
+// period ends at one of the dates and starts the day after the previous
+// date; the first period starts at the given start date.
+//
+// The valuation gains are the adjustments to market prices booked by
+// Balance against the valuation accounts. They accumulate on the position
+// and are realized when the position is disposed of, in proportion to the
+// quantity disposed. Transfers between asset and liability accounts and
+// renames of commodities carry over the accumulated gains. The unrealized
+// gains of a period are the valuation gains which have not been realized.
+type Report struct {
+	jctx  journal.Context
+	start time.Time
+	dates []time.Time
+
+	positions map[journal.Key]*position
+	rows      map[*journal.Commodity]*Row
+}
+
+// New creates a new report.
+func New(jctx journal.Context, start time.Time, dates []time.Time) *Report {
+	return &Report{
+		jctx:      jctx,
+		start:     start,
+		dates:     dates,
+		positions: make(map[journal.Key]*position),
+		rows:      make(map[*journal.Commodity]*Row),
+	}
+}
+
+// transfer holds the accumulated gains moved with an amount.
+type transfer struct {
+	amount, gains decimal.Decimal
+}
+
+// Process processes a day. It must run after Balance.
+func (r *Report) Process(d *journal.Day) error {
+	i := r.index(d.Date)
+	// The gains are booked before the other transactions of the day, such
+	// that a disposal realizes the gains up to the day of the disposal.
+	for _, t := range d.Transactions {
+		if isGain(t) {
+			r.processGain(i, t)
+		}
+	}
+	for _, t := range d.Transactions {
+		if !isGain(t) {
+			r.processTransaction(i, t)
+		}
+	}
+	return nil
+}
+
+// isGain returns whether the transaction is an adjustment of the value
+// without a change in quantities.
+func isGain(t *journal.Transaction) bool {
+	for _, p := range t.Postings {
+		if !p.Amount.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) processGain(i int, t *journal.Transaction) {
+	for _, p := range t.Postings {
+		if !p.Account.IsAL() {
+			continue
+		}
+		pos := r.position(p.Account, p.Commodity)
+		pos.gains = pos.gains.Add(p.Value)
+		r.add(i, p.Commodity, p.Value, decimal.Zero)
+		if pos.quantity.IsZero() {
+			r.add(i, p.Commodity, decimal.Zero, pos.gains)
+			pos.gains = decimal.Zero
+		}
+	}
+}
+
+func (r *Report) processTransaction(i int, t *journal.Transaction) {
+	// Reductions are booked first, such that the gains removed from a
+	// position can be carried over to the receiving position.
+	var (
+		transfers = make(map[journal.Key]*transfer)
+		renames   = make(map[journal.Key]decimal.Decimal)
+		reduced   = make([]bool, len(t.Postings))
+	)
+	for j, p := range t.Postings {
+		if !p.Account.IsAL() {
+			continue
+		}
+		pos := r.position(p.Account, p.Commodity)
+		if pos.quantity.IsZero() || p.Amount.IsZero() || pos.quantity.Sign() == p.Amount.Sign() {
+			continue
+		}
+		reduced[j] = true
+		switch {
+		case p.Other == r.jctx.ValuationAccountFor(p.Account):
+			pos.quantity = pos.quantity.Add(p.Amount)
+			pos.gains = pos.gains.Add(p.Value)
+			r.add(i, p.Commodity, p.Value, decimal.Zero)
+			if pos.quantity.IsZero() {
+				k := journal.AccountCommodityKey(p.Account, p.Commodity)
+				renames[k] = renames[k].Add(pos.gains)
+				pos.gains = decimal.Zero
+			}
+		case p.Other.IsAL():
+			k := journal.Key{Account: p.Other, Other: p.Account, Commodity: p.Commodity}
+			tr := dict.GetDefault(transfers, k, func() *transfer { return new(transfer) })
+			tr.amount = tr.amount.Sub(p.Amount)
+			tr.gains = tr.gains.Add(pos.reduce(p.Amount))
+		default:
+			r.add(i, p.Commodity, decimal.Zero, pos.reduce(p.Amount))
+		}
+	}
+	for j, p := range t.Postings {
+		if !p.Account.IsAL() || reduced[j] {
+			continue
+		}
+		pos := r.position(p.Account, p.Commodity)
+		switch {
+		case p.Other == r.jctx.ValuationAccountFor(p.Account):
+			for k, gains := range renames {
+				if k.Account == p.Account && pos.quantity.IsZero() {
+					pos.gains = pos.gains.Add(gains)
+					delete(renames, k)
+				}
+			}
+			pos.gains = pos.gains.Add(p.Value)
+			r.add(i, p.Commodity, p.Value, decimal.Zero)
+		case p.Other.IsAL():
+			k := journal.Key{Account: p.Account, Other: p.Other, Commodity: p.Commodity}
+			if tr, ok := transfers[k]; ok && !tr.amount.IsZero() {
+				gains := tr.gains.Mul(p.Amount).Div(tr.amount)
+				tr.amount, tr.gains = tr.amount.Sub(p.Amount), tr.gains.Sub(gains)
+				pos.gains = pos.gains.Add(gains)
+			}
+		}
+		pos.quantity = pos.quantity.Add(p.Amount)
+	}
+	// The gains of positions which have been closed by a valuation, and
+	// not renamed, are realized.
+	for k, gains := range renames {
+		r.add(i, k.Commodity, decimal.Zero, gains)
+	}
+}
+
+// index returns the index of the period containing t, or -1 if t is outside
+// of all periods.
+func (r *Report) index(t time.Time) int {
+	if t.Before(r.start) {
+		return -1
+	}
+	i := sort.Search(len(r.dates), func(i int) bool { return !r.dates[i].Before(t) })
+	if i == len(r.dates) {
+		return -1
+	}
+	return i
+}
+
+func (r *Report) position(a *journal.Account, c *journal.Commodity) *position {
+	return dict.GetDefault(r.positions, journal.AccountCommodityKey(a, c), func() *position {
+		return new(position)
+	})
+}
+
+func (r *Report) add(i int, c *journal.Commodity, gains, realized decimal.Decimal) {
+	if i < 0 || gains.IsZero() && realized.IsZero() {
+		return
+	}
+	rw := dict.GetDefault(r.rows, c, func() *Row {
+		return &Row{
+			Commodity:  c,
+			Realized:   make([]decimal.Decimal, len(r.dates)),
+			Unrealized: make([]decimal.Decimal, len(r.dates)),
+		}
+	})
+	rw.Realized[i] = rw.Realized[i].Add(realized)
+	rw.Unrealized[i] = rw.Unrealized[i].Add(gains).Sub(realized)
+}
+
+// Row holds the realized and unrealized gains of a commodity per period.
+// The sum of both is the valuation gain of the period.
+type Row struct {
+	Commodity            *journal.Commodity
+	Realized, Unrealized []decimal.Decimal
+}
+
+// Rows returns the rows of the report, sorted by commodity.
+func (r *Report) Rows() []*Row {
+	return dict.SortedValues(r.rows, func(r1, r2 *Row) compare.Order {
+		return journal.CompareCommodities(r1.Commodity, r2.Commodity)
+	})
+}
+
+// Render renders the rows with the realized, unrealized and total gains
+// for each date, followed by the totals.
+func Render(dates []time.Time, rows []*Row) *table.Table {
+	tbl := table.New(1, 3*len(dates))
+	tbl.AddSeparatorRow()
+	header := tbl.AddHeaderRow().AddEmpty()
+	for _, d := range dates {
+		header.AddText(d.Format("2006-01-02"), table.Center).AddEmpty().AddEmpty()
+	}
+	header = tbl.AddHeaderRow().AddText("Comm", table.Center)
+	for range dates {
+		header.AddText("Realized", table.Center).AddText("Unrealized", table.Center).AddText("Total", table.Center)
+	}
+	tbl.AddSeparatorRow()
+	total := &Row{
+		Realized:   make([]decimal.Decimal, len(dates)),
+		Unrealized: make([]decimal.Decimal, len(dates)),
+	}
+	for _, rw := range rows {
+		renderRow(tbl, rw.Commodity.Name(), rw)
+		for i := range dates {
+			total.Realized[i] = total.Realized[i].Add(rw.Realized[i])
+			total.Unrealized[i] = total.Unrealized[i].Add(rw.Unrealized[i])
+		}
+	}
+	tbl.AddSeparatorRow()
+	renderRow(tbl, "Total", total)
+	tbl.AddSeparatorRow()
+	return tbl
+}
+
+func renderRow(tbl *table.Table, name string, rw *Row) {
+	row := tbl.AddRow().AddText(name, table.Left)
+	for i := range rw.Realized {
+		row.AddNumber(rw.Realized[i]).AddNumber(rw.Unrealized[i]).AddNumber(rw.Realized[i].Add(rw.Unrealized[i]))
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gains
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestReport(t *testing.T) {
+	var (
+		jctx      = journal.NewContext()
+		equity    = jctx.Account("Equity:Equity")
+		portfolio = jctx.Account("Assets:Portfolio")
+		chf       = jctx.Commodity("CHF")
+		abc       = jctx.Commodity("ABC")
+		j         = journal.New(jctx)
+	)
+	for _, a := range []*journal.Account{equity, portfolio} {
+		j.AddOpen(&journal.Open{Date: date.Date(2020, 1, 1), Account: a})
+	}
+	for _, p := range []struct {
+		date  time.Time
+		price int64
+	}{
+		{date.Date(2020, 1, 1), 10},
+		{date.Date(2020, 1, 15), 5},
+		{date.Date(2020, 1, 20), 6},
+		{date.Date(2020, 2, 10), 7},
+	} {
+		j.AddPrice(&journal.Price{Date: p.date, Commodity: abc, Target: chf, Price: decimal.NewFromInt(p.price)})
+	}
+	book := func(d time.Time, credit, debit *journal.Account, amount int64) {
+		j.AddTransaction(journal.TransactionBuilder{
+			Date:        d,
+			Description: "Trade",
+			Postings: journal.PostingBuilder{
+				Credit:    credit,
+				Debit:     debit,
+				Commodity: abc,
+				Amount:    decimal.NewFromInt(amount),
+			}.Build(),
+		}.Build())
+	}
+	book(date.Date(2020, 1, 2), equity, portfolio, 10)
+	// 2:1 split, which does not change the value
+	j.AddSplit(&journal.Split{Date: date.Date(2020, 1, 15), Commodity: abc, Numerator: decimal.NewFromInt(2), Denominator: decimal.NewFromInt(1)})
+	book(date.Date(2020, 1, 20), portfolio, equity, 5)
+	// sold on the day of the price change
+	book(date.Date(2020, 2, 10), portfolio, equity, 15)
+	rep := New(jctx, date.Date(2020, 1, 1), []time.Time{date.Date(2020, 1, 31), date.Date(2020, 2, 29)})
+
+	if _, err := j.Process(journal.ComputePrices(chf), journal.Balance(jctx, chf), rep.Process); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	got := rep.Rows()
+
+	want := []*Row{
+		{
+			Commodity:  abc,
+			Realized:   []decimal.Decimal{decimal.NewFromInt(5), decimal.NewFromInt(30)},
+			Unrealized: []decimal.Decimal{decimal.NewFromInt(15), decimal.NewFromInt(-15)},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b *journal.Commodity) bool { return a == b }), cmp.Comparer(func(a, b decimal.Decimal) bool { return a.Equal(b) })); diff != "" {
+		t.Errorf("Rows() returned unexpected rows (-want/+got):\n%s", diff)
+	}
+}
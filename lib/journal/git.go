@@ -0,0 +1,137 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Git is a read-only Source of the files committed to a git repository,
+// e.g. to process the journal as of a past revision. Paths are relative to
+// Dir. It requires the git executable.
+type Git struct {
+	// Dir is a directory within the repository.
+	Dir string
+
+	// Revision is the revision to read, such as a commit, a tag or a
+	// branch. It defaults to HEAD.
+	Revision string
+
+	// Interval is the interval at which Watch polls the revision. It
+	// defaults to one second.
+	Interval time.Duration
+}
+
+var _ Source = Git{}
+
+func (g Git) revision() string {
+	if g.Revision == "" {
+		return "HEAD"
+	}
+	return g.Revision
+}
+
+func (g Git) git(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", g.Dir}, args...)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (g Git) object(p string) (string, error) {
+	if path.IsAbs(p) {
+		return "", fmt.Errorf("%s: path must be relative to %s", p, g.Dir)
+	}
+	return g.revision() + ":./" + path.Clean(p), nil
+}
+
+// Open implements Source.
+func (g Git) Open(p string) (io.ReadCloser, error) {
+	obj, err := g.object(p)
+	if err != nil {
+		return nil, err
+	}
+	out, err := g.git("show", obj)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(out)), nil
+}
+
+// List implements Source.
+func (g Git) List(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	out, err := g.git("ls-tree", "-r", "--name-only", g.revision())
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, p := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if ok, _ := path.Match(path.Clean(pattern), p); ok {
+			res = append(res, p)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// Watch implements Source. A file changes when a commit changing it is
+// made to the revision, e.g. a branch.
+func (g Git) Watch(ctx context.Context, paths []string) (<-chan string, error) {
+	interval := g.Interval
+	if interval == 0 {
+		interval = time.Second
+	}
+	hash := func(p string) string {
+		obj, err := g.object(p)
+		if err != nil {
+			return ""
+		}
+		out, err := g.git("rev-parse", "--verify", "--quiet", obj)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+	hashes := make([]string, len(paths))
+	for i, p := range paths {
+		hashes[i] = hash(p)
+	}
+	return poll(ctx, interval, paths, func(i int) bool {
+		h := hash(paths[i])
+		changed := h != hashes[i]
+		hashes[i] = h
+		return changed
+	}), nil
+}
+
+// Write implements Source. Git sources are read-only.
+func (g Git) Write(p string, _ func(io.Writer) error) error {
+	return errReadOnly(g, p)
+}
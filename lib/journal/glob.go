@@ -0,0 +1,145 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Glob maps accounts matching a pattern to a target account. Patterns match
+// account names segment by segment: "*" matches a single segment, "**"
+// matches any number of segments, and other segments are matched with
+// path.Match, e.g. "Bank*". In the target, the n-th "*" segment is replaced
+// by the segment matched by the n-th wildcard segment of the pattern. A
+// target without an account type is relative to the type of the mapped
+// account, and mappings must not change the account type:
+//
+//	Expenses:Food:** -> Expenses:Food
+//	Assets:Bank*:** -> Cash
+//	Expenses:*:** -> Expenses:*
+type Glob struct {
+	pattern, target []string
+
+	// relative is true if the target has no account type.
+	relative bool
+}
+
+// ParseGlob parses a rule of the form "<pattern> -> <target>".
+func ParseGlob(s string) (*Glob, error) {
+	p, t, ok := strings.Cut(s, "->")
+	if !ok {
+		return nil, fmt.Errorf("invalid mapping %q, expected <pattern> -> <target>", s)
+	}
+	g := &Glob{
+		pattern: strings.Split(strings.TrimSpace(p), ":"),
+		target:  strings.Split(strings.TrimSpace(t), ":"),
+	}
+	var captures int
+	for _, seg := range g.pattern {
+		if _, err := path.Match(seg, ""); err != nil || len(seg) == 0 {
+			return nil, fmt.Errorf("invalid pattern %q", strings.TrimSpace(p))
+		}
+		if isWildcard(seg) {
+			captures++
+		}
+	}
+	segments := g.target
+	if isType(g.target[0]) {
+		if g.target[0] != g.pattern[0] {
+			return nil, fmt.Errorf("target %q must have the account type of pattern %q or none", strings.TrimSpace(t), strings.TrimSpace(p))
+		}
+		segments = g.target[1:]
+	} else {
+		g.relative = true
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid target %q", strings.TrimSpace(t))
+	}
+	for _, seg := range segments {
+		if seg == "*" {
+			if captures == 0 {
+				return nil, fmt.Errorf("target %q has more wildcards than pattern %q", strings.TrimSpace(t), strings.TrimSpace(p))
+			}
+			captures--
+			continue
+		}
+		if !isValidSegment(seg) {
+			return nil, fmt.Errorf("invalid target %q", strings.TrimSpace(t))
+		}
+	}
+	return g, nil
+}
+
+func (g Glob) String() string {
+	return fmt.Sprintf("%s -> %s", strings.Join(g.pattern, ":"), strings.Join(g.target, ":"))
+}
+
+// Map returns the name of the target account for the given account name,
+// or false if the pattern does not match.
+func (g Glob) Map(name string) (string, bool) {
+	segments := strings.Split(name, ":")
+	captures, ok := match(g.pattern, segments, nil)
+	if !ok {
+		return "", false
+	}
+	res := make([]string, 0, len(g.target)+1)
+	if g.relative {
+		res = append(res, segments[0])
+	}
+	for _, seg := range g.target {
+		if seg == "*" {
+			seg, captures = captures[0], captures[1:]
+		}
+		res = append(res, seg)
+	}
+	return strings.Join(res, ":"), true
+}
+
+// match matches the segments against the pattern and returns the segments
+// matched by wildcard segments other than "**".
+func match(pattern, segments []string, captures []string) ([]string, bool) {
+	if len(pattern) == 0 {
+		return captures, len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if res, ok := match(pattern[1:], segments[i:], captures); ok {
+				return res, true
+			}
+		}
+		return nil, false
+	}
+	if len(segments) == 0 {
+		return nil, false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return nil, false
+	}
+	if isWildcard(pattern[0]) {
+		captures = append(captures[:len(captures):len(captures)], segments[0])
+	}
+	return match(pattern[1:], segments[1:], captures)
+}
+
+func isWildcard(seg string) bool {
+	return seg != "**" && strings.ContainsAny(seg, `*?[\`)
+}
+
+func isType(s string) bool {
+	_, ok := accountTypes[s]
+	return ok
+}
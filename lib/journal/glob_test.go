@@ -0,0 +1,128 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"testing"
+)
+
+func TestGlobMap(t *testing.T) {
+	tests := []struct {
+		rule, account string
+		want          string
+		wantOK        bool
+	}{
+		{"Expenses:Food:* -> Expenses:Food", "Expenses:Food:Groceries", "Expenses:Food", true},
+		{"Expenses:Food:* -> Expenses:Food", "Expenses:Food", "", false},
+		{"Expenses:Food:* -> Expenses:Food", "Expenses:Food:Groceries:Fruit", "", false},
+		{"Assets:Bank:** -> Assets:Cash", "Assets:Bank", "Assets:Cash", true},
+		{"Assets:Bank:** -> Assets:Cash", "Assets:Bank:UBS:Savings", "Assets:Cash", true},
+		{"Assets:Bank:** -> Assets:Cash", "Assets:Banking", "", false},
+		{"Assets:Bank*:** -> Assets:Cash", "Assets:Banking:X", "Assets:Cash", true},
+		{"Expenses:*:** -> Expenses:*", "Expenses:Travel:Flights:Swiss", "Expenses:Travel", true},
+		{"**:Fees -> Expenses:*:Fees", "Assets:Portfolio:Fees", "", false},
+		{"Assets:*:*:Fees -> *:Fees", "Assets:Portfolio:UBS:Fees", "Assets:Portfolio:Fees", true},
+		{"Assets:Bank:** -> Cash", "Assets:Bank:UBS", "Assets:Cash", true},
+		{"Expenses:Food:* -> Food", "Expenses:Food:Groceries", "Expenses:Food", true},
+		{"**:Fees -> Fees", "Liabilities:Card:Fees", "Liabilities:Fees", true},
+		{"Income:**:Dividends -> Income:Dividends", "Income:Portfolio:UBS:Dividends", "Income:Dividends", true},
+	}
+	for _, test := range tests {
+		g, err := ParseGlob(test.rule)
+		if err != nil {
+			if test.wantOK {
+				t.Errorf("ParseGlob(%q) returned unexpected error: %v", test.rule, err)
+			}
+			continue
+		}
+		got, ok := g.Map(test.account)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("%s: Map(%q) = %q, %t, want %q, %t", test.rule, test.account, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestParseGlobErrors(t *testing.T) {
+	for _, rule := range []string{
+		"Expenses:Food",
+		"Expenses:Food:* -> Income:Food",
+		"*:*:Fees -> Expenses:*:Fees",
+		"**:Fees -> Expenses:Fees",
+		"Expenses:Food:* -> Expenses",
+		"Expenses:Food:* -> Expenses:*:*",
+		"Expenses:[ -> Expenses:Food",
+		"Expenses::Food -> Expenses:Food",
+		"Expenses:Food -> *:Food",
+	} {
+		if _, err := ParseGlob(rule); err == nil {
+			t.Errorf("ParseGlob(%q) returned no error", rule)
+		}
+	}
+}
+
+func TestShortenAccount(t *testing.T) {
+	var (
+		jctx = NewContext()
+		m    AccountMapping
+	)
+	for _, rule := range []string{"Assets:Bank:** -> Assets:Cash", "Expenses:*:** -> Expenses:*"} {
+		g, err := ParseGlob(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m = append(m, Rule{Glob: g})
+	}
+	m = append(m, Rule{Level: 1})
+	f := ShortenAccount(jctx, m)
+	for account, want := range map[string]string{
+		"Assets:Bank:UBS":              "Assets:Cash",
+		"Expenses:Travel:Flights":      "Expenses:Travel",
+		"Liabilities:CreditCards:Visa": "Liabilities",
+	} {
+		if got := f(jctx.Account(account)); got.Name() != want {
+			t.Errorf("ShortenAccount(%s) = %s, want %s", account, got.Name(), want)
+		}
+	}
+}
+
+func TestParseDepths(t *testing.T) {
+	jctx := NewContext()
+	m, err := ParseDepths("Assets:Portfolio:3,Assets:Bank:2,Assets:1,Expenses:1")
+	if err != nil {
+		t.Fatalf("ParseDepths() returned unexpected error: %v", err)
+	}
+	f := ShortenAccount(jctx, m)
+	for account, want := range map[string]string{
+		"Assets:Portfolio:UBS:AAPL": "Assets:Portfolio:UBS",
+		"Assets:Bank:UBS":           "Assets:Bank",
+		"Assets:Bank":               "Assets:Bank",
+		"Assets":                    "Assets",
+		"Expenses:Travel:Flights":   "Expenses",
+		"Assets:BankX:Foo":          "Assets",
+		"Income:Salary:Bonus":       "Income:Salary:Bonus",
+	} {
+		if got := f(jctx.Account(account)); got.Name() != want {
+			t.Errorf("ShortenAccount(%s) = %s, want %s", account, got.Name(), want)
+		}
+	}
+}
+
+func TestParseDepthsInvalid(t *testing.T) {
+	for _, s := range []string{"Assets", "Assets:x", "Assets:-1", "Foo:2", "Assets::2", "Assets:2,"} {
+		if _, err := ParseDepths(s); err == nil {
+			t.Errorf("ParseDepths(%q) returned no error", s)
+		}
+	}
+}
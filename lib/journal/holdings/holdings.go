@@ -0,0 +1,179 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package holdings computes the positions held in asset and liability
+// accounts with their cost basis and market value.
+package holdings
+
+import (
+	"time"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/lots"
+	"github.com/shopspring/decimal"
+)
+
+// Holding is a position of a commodity in an account.
+type Holding struct {
+	Account   *journal.Account
+	Commodity *journal.Commodity
+
+	// Quantity is the amount of the commodity held.
+	Quantity decimal.Decimal
+
+	// Cost is the cost basis of the position in the valuation commodity.
+	Cost decimal.Decimal
+
+	// Market is the market value of the position in the valuation
+	// commodity.
+	Market decimal.Decimal
+
+	// Lots are the lots of the position, sorted by date.
+	Lots []lots.Lot
+}
+
+// Gain returns the unrealized gain of the holding.
+func (h *Holding) Gain() decimal.Decimal {
+	return h.Market.Sub(h.Cost)
+}
+
+// Holdings tracks the holdings in all asset and liability accounts up to
+// a given date. The lots of the holdings and their cost basis are tracked
+// with a lots.Tracker.
+type Holdings struct {
+	date    time.Time
+	tracker *lots.Tracker
+
+	market map[journal.Key]decimal.Decimal
+}
+
+// New creates a new Holdings for the given date, valuated in v, which
+// reduces lots with the given method.
+func New(jctx journal.Context, t time.Time, v *journal.Commodity, m lots.Method) *Holdings {
+	return &Holdings{
+		date:    t,
+		tracker: lots.New(jctx, v, m),
+		market:  make(map[journal.Key]decimal.Decimal),
+	}
+}
+
+// Process processes a day. It must run after Balance.
+func (h *Holdings) Process(d *journal.Day) error {
+	if d.Date.After(h.date) {
+		return nil
+	}
+	if err := h.tracker.Process(d); err != nil {
+		return err
+	}
+	for _, t := range d.Transactions {
+		for _, p := range t.Postings {
+			if !p.Account.IsAL() {
+				continue
+			}
+			k := journal.AccountCommodityKey(p.Account, p.Commodity)
+			h.market[k] = h.market[k].Add(p.Value)
+		}
+	}
+	return nil
+}
+
+// Holdings returns the nonzero holdings, sorted by account and commodity.
+func (h *Holdings) Holdings() []*Holding {
+	var res []*Holding
+	for k, market := range h.market {
+		inv := h.tracker.Inventory(k.Account, k.Commodity)
+		hd := &Holding{
+			Account:   k.Account,
+			Commodity: k.Commodity,
+			Quantity:  inv.Quantity(),
+			Cost:      inv.Cost(),
+			Market:    market,
+			Lots:      inv.Lots,
+		}
+		if !hd.Quantity.IsZero() || !hd.Market.IsZero() {
+			res = append(res, hd)
+		}
+	}
+	compare.Sort(res, func(h1, h2 *Holding) compare.Order {
+		if o := journal.CompareAccounts(h1.Account, h2.Account); o != compare.Equal {
+			return o
+		}
+		return journal.CompareCommodities(h1.Commodity, h2.Commodity)
+	})
+	return res
+}
+
+// Render renders the holdings with their quantity, cost basis, market
+// value and unrealized gain, followed by the totals. If showLots is set,
+// each holding is followed by its lots, with their share of the market
+// value.
+func Render(holdings []*Holding, showLots bool) *table.Table {
+	tbl := table.New(1, 1, 1, 1, 1, 1)
+	tbl.AddSeparatorRow()
+	tbl.AddHeaderRow().
+		AddText("Account", table.Center).
+		AddText("Comm", table.Center).
+		AddText("Quantity", table.Center).
+		AddText("Cost", table.Center).
+		AddText("Market value", table.Center).
+		AddText("Gain", table.Center)
+	tbl.AddSeparatorRow()
+	var total Holding
+	for _, hd := range holdings {
+		tbl.AddRow().
+			AddText(hd.Account.Name(), table.Left).
+			AddText(hd.Commodity.Name(), table.Left).
+			AddNumber(hd.Quantity).
+			AddNumber(hd.Cost).
+			AddNumber(hd.Market).
+			AddNumber(hd.Gain())
+		if showLots {
+			renderLots(tbl, hd)
+		}
+		total.Cost = total.Cost.Add(hd.Cost)
+		total.Market = total.Market.Add(hd.Market)
+	}
+	tbl.AddSeparatorRow()
+	tbl.AddRow().
+		AddText("Total", table.Left).
+		AddEmpty().
+		AddEmpty().
+		AddNumber(total.Cost).
+		AddNumber(total.Market).
+		AddNumber(total.Gain())
+	tbl.AddSeparatorRow()
+	return tbl
+}
+
+func renderLots(tbl *table.Table, hd *Holding) {
+	for _, l := range hd.Lots {
+		name := l.Date.Format("2006-01-02")
+		if l.Label != "" {
+			name += " " + l.Label
+		}
+		var market decimal.Decimal
+		if !hd.Quantity.IsZero() {
+			market = hd.Market.Mul(l.Quantity).Div(hd.Quantity)
+		}
+		tbl.AddRow().
+			AddIndented(name, 2).
+			AddEmpty().
+			AddNumber(l.Quantity).
+			AddNumber(l.Cost).
+			AddNumber(market).
+			AddNumber(market.Sub(l.Cost))
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holdings
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/lots"
+)
+
+func TestHoldings(t *testing.T) {
+	var (
+		jctx      = journal.NewContext()
+		equity    = jctx.Account("Equity:Equity")
+		bank      = jctx.Account("Assets:Bank")
+		portfolio = jctx.Account("Assets:Portfolio")
+		chf       = jctx.Commodity("CHF")
+		usd       = jctx.Commodity("USD")
+		abc       = jctx.Commodity("ABC")
+		xyz       = jctx.Commodity("XYZ")
+		j         = journal.New(jctx)
+	)
+	for _, a := range []*journal.Account{equity, bank, portfolio} {
+		j.AddOpen(&journal.Open{Date: date.Date(2020, 1, 1), Account: a})
+	}
+	j.AddPrice(&journal.Price{Date: date.Date(2020, 1, 1), Commodity: usd, Target: chf, Price: decimal.NewFromInt(2)})
+	j.AddPrice(&journal.Price{Date: date.Date(2020, 1, 1), Commodity: abc, Target: chf, Price: decimal.NewFromInt(10)})
+	j.AddPrice(&journal.Price{Date: date.Date(2020, 3, 1), Commodity: xyz, Target: chf, Price: decimal.NewFromInt(7)})
+	j.AddTransaction(journal.TransactionBuilder{
+		Date:        date.Date(2020, 1, 2),
+		Description: "Buy",
+		Postings: journal.PostingBuilder{
+			Credit:    equity,
+			Debit:     bank,
+			Commodity: abc,
+			Amount:    decimal.NewFromInt(10),
+		}.Build(),
+	}.Build())
+	j.AddTransaction(journal.TransactionBuilder{
+		Date:        date.Date(2020, 1, 3),
+		Description: "Transfer",
+		Postings: journal.PostingBuilder{
+			Credit:    bank,
+			Debit:     portfolio,
+			Commodity: abc,
+			Amount:    decimal.NewFromInt(4),
+		}.Build(),
+	}.Build())
+	j.AddTransaction(journal.TransactionBuilder{
+		Date:        date.Date(2020, 1, 4),
+		Description: "Buy lot",
+		Postings: journal.PostingBuilder{
+			Credit:    equity,
+			Debit:     portfolio,
+			Commodity: abc,
+			Amount:    decimal.NewFromInt(4),
+			Lot:       &journal.Lot{Price: 3, Commodity: usd},
+		}.Build(),
+	}.Build())
+	j.AddRename(&journal.Rename{Date: date.Date(2020, 3, 1), Commodity: abc, Target: xyz, Ratio: decimal.NewFromInt(1)})
+	h := New(jctx, date.Date(2020, 3, 31), chf, lots.Average)
+
+	if _, err := j.Process(journal.ComputePrices(chf), journal.Balance(jctx, chf), h.Process); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	got := h.Holdings()
+
+	want := []*Holding{
+		{
+			Account:   bank,
+			Commodity: xyz,
+			Quantity:  decimal.NewFromInt(6),
+			Cost:      decimal.NewFromInt(60),
+			Market:    decimal.NewFromInt(42),
+			Lots: []lots.Lot{
+				{Date: date.Date(2020, 1, 2), Quantity: decimal.NewFromInt(6), Cost: decimal.NewFromInt(60)},
+			},
+		},
+		{
+			Account:   portfolio,
+			Commodity: xyz,
+			Quantity:  decimal.NewFromInt(8),
+			Cost:      decimal.NewFromInt(64),
+			Market:    decimal.NewFromInt(56),
+			Lots: []lots.Lot{
+				{Date: date.Date(2020, 1, 2), Quantity: decimal.NewFromInt(4), Cost: decimal.NewFromInt(40)},
+				{Date: date.Date(2020, 1, 4), Quantity: decimal.NewFromInt(4), Cost: decimal.NewFromInt(24)},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b *journal.Account) bool { return a == b }), cmp.Comparer(func(a, b *journal.Commodity) bool { return a == b }), cmp.Comparer(func(a, b decimal.Decimal) bool { return a.Equal(b) })); diff != "" {
+		t.Errorf("Holdings() returned unexpected holdings (-want/+got):\n%s", diff)
+	}
+}
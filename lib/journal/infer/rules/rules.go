@@ -0,0 +1,110 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rules assigns accounts to transactions with rules which match
+// their descriptions, e.g. to book the rent or the salary deterministically.
+package rules
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// Rule assigns transactions whose description matches a regex to an
+// account.
+type Rule struct {
+	Regex   *regexp.Regexp
+	Account *journal.Account
+}
+
+// ParseRule parses a rule of the form "<regex> -> <account>".
+func ParseRule(jctx journal.Context, s string) (Rule, error) {
+	r, a, ok := strings.Cut(s, "->")
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid rule %q, expected <regex> -> <account>", s)
+	}
+	rx, err := regexp.Compile(strings.TrimSpace(r))
+	if err != nil {
+		return Rule{}, err
+	}
+	account, err := jctx.GetAccount(strings.TrimSpace(a))
+	if err != nil {
+		return Rule{}, err
+	}
+	return Rule{Regex: rx, Account: account}, nil
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s -> %s", r.Regex, r.Account)
+}
+
+// Rules is a list of rules, of which the first matching one applies.
+type Rules []Rule
+
+// ParseFile parses the rules in the given file, one per line. Empty lines
+// and lines starting with # are ignored.
+func ParseFile(jctx journal.Context, path string) (Rules, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rs Rules
+	for i, line := range strings.Split(string(bs), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := ParseRule(jctx, line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+// Account returns the account of the first rule whose regex matches the
+// description, or nil if no rule matches.
+func (rs Rules) Account(desc string) *journal.Account {
+	for _, r := range rs {
+		if r.Regex.MatchString(desc) {
+			return r.Account
+		}
+	}
+	return nil
+}
+
+// Infer replaces the given account in the postings of the transaction with
+// the account of the first matching rule, if any.
+func (rs Rules) Infer(t *journal.Transaction, tbd *journal.Account) {
+	account := rs.Account(t.Description)
+	if account == nil {
+		return
+	}
+	for i, posting := range t.Postings {
+		if posting.Account != tbd {
+			continue
+		}
+		posting.Account = account
+		if i%2 == 0 {
+			t.Postings[i+1].Other = account
+		} else {
+			t.Postings[i-1].Other = account
+		}
+	}
+}
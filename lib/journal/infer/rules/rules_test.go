@@ -0,0 +1,109 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestParseFile(t *testing.T) {
+	var (
+		jctx = journal.NewContext()
+		path = filepath.Join(t.TempDir(), "rules")
+	)
+	content := `# rent and salary
+(?i)rent -> Expenses:Housing
+
+^ACME AG -> Income:Salary
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := ParseFile(jctx, path)
+
+	if err != nil {
+		t.Fatalf("ParseFile() returned unexpected error: %v", err)
+	}
+	for _, test := range []struct {
+		desc string
+		want *journal.Account
+	}{
+		{"Rent for January", jctx.Account("Expenses:Housing")},
+		{"RENT", jctx.Account("Expenses:Housing")},
+		{"ACME AG Salary", jctx.Account("Income:Salary")},
+		{"Salary ACME AG", nil},
+	} {
+		if got := rules.Account(test.desc); got != test.want {
+			t.Errorf("Account(%q) = %v, want %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestParseFileInvalid(t *testing.T) {
+	for _, test := range []struct {
+		content, err string
+	}{
+		{"rent Expenses:Housing", "rules:1: invalid rule"},
+		{"# comment\n( -> Expenses:Housing", "rules:2: error parsing regexp"},
+		{"rent -> Housing", "rules:1: invalid account"},
+	} {
+		path := filepath.Join(t.TempDir(), "rules")
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := ParseFile(journal.NewContext(), path)
+
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("ParseFile(%q) returned error %v, want %q", test.content, err, test.err)
+		}
+	}
+}
+
+func TestInfer(t *testing.T) {
+	var (
+		jctx    = journal.NewContext()
+		bank    = jctx.Account("Assets:Bank")
+		tbd     = jctx.Account("Expenses:TBD")
+		housing = jctx.Account("Expenses:Housing")
+	)
+	rule, err := ParseRule(jctx, "(?i)rent -> Expenses:Housing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trx := journal.TransactionBuilder{
+		Description: "Rent",
+		Postings: journal.PostingBuilder{
+			Credit:    bank,
+			Debit:     tbd,
+			Commodity: jctx.Commodity("CHF"),
+			Amount:    decimal.NewFromInt(1500),
+		}.Build(),
+	}.Build()
+
+	Rules{rule}.Infer(trx, tbd)
+
+	if trx.Postings[0].Other != housing || trx.Postings[1].Account != housing {
+		t.Errorf("Infer() did not book the posting to %s: %v", housing, trx.Postings)
+	}
+}
@@ -17,12 +17,15 @@ package journal
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"time"
 
 	"github.com/sboehler/knut/lib/common/compare"
 	"github.com/sboehler/knut/lib/common/cpr"
 	"github.com/sboehler/knut/lib/common/date"
 	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/common/set"
 	"github.com/sboehler/knut/lib/common/slice"
 	"go.uber.org/multierr"
 )
@@ -32,15 +35,26 @@ type Journal struct {
 	Context  Context
 	Days     map[time.Time]*Day
 	min, max time.Time
+
+	// resumed is the checkpoint the journal has been resumed from.
+	resumed *Checkpoint
+
+	// Strict is set by the strict option, see CheckDeclarations.
+	Strict bool
+
+	// declared holds the commodities declared as a commodity or a
+	// currency.
+	declared set.Set[*Commodity]
 }
 
 // New creates a new Journal.
 func New(ctx Context) *Journal {
 	return &Journal{
-		Context: ctx,
-		Days:    make(map[time.Time]*Day),
-		min:     date.Date(9999, 12, 31),
-		max:     time.Time{},
+		Context:  ctx,
+		Days:     make(map[time.Time]*Day),
+		declared: set.New[*Commodity](),
+		min:      date.Date(9999, 12, 31),
+		max:      time.Time{},
 	}
 }
 
@@ -90,12 +104,69 @@ func (j *Journal) AddValue(v *Value) {
 	d.Values = append(d.Values, v)
 }
 
+// AddRename adds a Rename directive.
+func (j *Journal) AddRename(r *Rename) {
+	d := j.Day(r.Date)
+	if j.max.Before(d.Date) {
+		j.max = d.Date
+	}
+	d.Renames = append(d.Renames, r)
+}
+
+// AddSplit adds a Split directive.
+func (j *Journal) AddSplit(s *Split) {
+	d := j.Day(s.Date)
+	if j.max.Before(d.Date) {
+		j.max = d.Date
+	}
+	d.Splits = append(d.Splits, s)
+}
+
+// AddBudget adds a Budget directive.
+func (j *Journal) AddBudget(b *Budget) {
+	d := j.Day(b.Date)
+	d.Budgets = append(d.Budgets, b)
+}
+
+// AddAuto adds an Auto directive.
+func (j *Journal) AddAuto(a *Auto) {
+	d := j.Day(a.Date)
+	d.Autos = append(d.Autos, a)
+}
+
+// AddValuation adds a Valuation directive and overrides the valuation
+// account of its account in the context.
+func (j *Journal) AddValuation(v *Valuation) {
+	d := j.Day(v.Date)
+	d.Valuations = append(d.Valuations, v)
+	j.Context.accounts.SetValuationAccount(v.Account, v.Target)
+}
+
 // AddAssertion adds an Assertion directive.
 func (j *Journal) AddAssertion(a *Assertion) {
 	d := j.Day(a.Date)
 	d.Assertions = append(d.Assertions, a)
 }
 
+// AddCurrency adds a Currency directive, which declares the commodity and
+// tags it as a currency.
+func (j *Journal) AddCurrency(c *Currency) {
+	j.declared.Add(c.Commodity)
+	j.Context.commodities.TagCurrency(c.Commodity.Name())
+}
+
+// AddDeclaration adds a Declaration directive.
+func (j *Journal) AddDeclaration(d *Declaration) {
+	j.declared.Add(d.Commodity)
+}
+
+// AddOption adds an Option directive.
+func (j *Journal) AddOption(o *Option) {
+	if o.Name == OptionStrict {
+		j.Strict = true
+	}
+}
+
 // AddClose adds an Close directive.
 func (j *Journal) AddClose(c *Close) {
 	d := j.Day(c.Date)
@@ -126,12 +197,47 @@ func (j *Journal) Process(fs ...func(*Day) error) (*Ledger, error) {
 	}, nil
 }
 
+// Stdin is the path which denotes the standard input.
+const Stdin = "-"
+
+// FromPath reads the journal at the given path on the local file system,
+// using the default parse cache. If the path is Stdin, the journal is read
+// from the standard input.
 func FromPath(ctx context.Context, jctx Context, path string) (*Journal, error) {
-	j := New(jctx)
-	p := RecursiveParser{
+	if path == Stdin {
+		return FromReader(ctx, jctx, os.Stdin, "<stdin>")
+	}
+	return parseJournal(ctx, jctx, &RecursiveParser{
 		Context: jctx,
 		File:    path,
-	}
+		Source:  FileSystem{},
+		Cache:   DefaultParseCache(),
+	})
+}
+
+// FromSource reads the journal at the given path in the source, including
+// the files it includes.
+func FromSource(ctx context.Context, jctx Context, src Source, path string) (*Journal, error) {
+	return parseJournal(ctx, jctx, &RecursiveParser{
+		Context: jctx,
+		File:    path,
+		Source:  src,
+	})
+}
+
+// FromReader reads the journal from r. The path names the input in error
+// messages, and the files it includes are resolved relative to the
+// directory of the path on the local file system.
+func FromReader(ctx context.Context, jctx Context, r io.Reader, path string) (*Journal, error) {
+	return parseJournal(ctx, jctx, &RecursiveParser{
+		Context: jctx,
+		File:    path,
+		Input:   r,
+	})
+}
+
+func parseJournal(ctx context.Context, jctx Context, p *RecursiveParser) (*Journal, error) {
+	j := New(jctx)
 	var errs error
 	err := cpr.Consume(ctx, p.Parse(ctx), func(d any) error {
 		switch t := d.(type) {
@@ -146,6 +252,9 @@ func FromPath(ctx context.Context, jctx Context, path string) (*Journal, error)
 			j.AddPrice(t)
 
 		case *Transaction:
+			for _, p := range t.ConversionPrices() {
+				j.AddPrice(p)
+			}
 			if t.Accrual != nil {
 				for _, ts := range t.Accrual.Expand(t) {
 					j.AddTransaction(ts)
@@ -160,9 +269,33 @@ func FromPath(ctx context.Context, jctx Context, path string) (*Journal, error)
 		case *Value:
 			j.AddValue(t)
 
+		case *Rename:
+			j.AddRename(t)
+
+		case *Split:
+			j.AddSplit(t)
+
+		case *Budget:
+			j.AddBudget(t)
+
+		case *Auto:
+			j.AddAuto(t)
+
+		case *Valuation:
+			j.AddValuation(t)
+
 		case *Close:
 			j.AddClose(t)
 
+		case *Currency:
+			j.AddCurrency(t)
+
+		case *Declaration:
+			j.AddDeclaration(t)
+
+		case *Option:
+			j.AddOption(t)
+
 		default:
 			errs = multierr.Append(errs, fmt.Errorf("unknown: %#v", t))
 		}
@@ -174,6 +307,11 @@ func FromPath(ctx context.Context, jctx Context, path string) (*Journal, error)
 	if errs != nil {
 		return nil, errs
 	}
+	if j.Strict {
+		if err := j.CheckDeclarations(); err != nil {
+			return nil, err
+		}
+	}
 	return j, nil
 }
 
@@ -189,13 +327,35 @@ type Day struct {
 	Prices       []*Price
 	Assertions   []*Assertion
 	Values       []*Value
+	Renames      []*Rename
+	Splits       []*Split
+	Budgets      []*Budget
+	Autos        []*Auto
+	Valuations   []*Valuation
 	Openings     []*Open
 	Transactions []*Transaction
 	Closings     []*Close
 
+	// Origins maps the transactions generated for renames and splits to
+	// the directive they implement.
+	Origins map[*Transaction]Directive
+
 	Normalized NormalizedPrices
 
 	Performance *Performance
+
+	// Restored marks a day which holds the state of a checkpoint. The
+	// values of its postings are given and must not be recomputed.
+	Restored bool
+}
+
+// generate adds a transaction generated for the given directive.
+func (d *Day) generate(origin Directive, t *Transaction) {
+	if d.Origins == nil {
+		d.Origins = make(map[*Transaction]Directive)
+	}
+	d.Origins[t] = origin
+	d.Transactions = append(d.Transactions, t)
 }
 
 // Less establishes an ordering on Day.
@@ -0,0 +1,61 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// BenchmarkJournal parses and balances a journal with many transactions.
+// It reports the number of garbage collections per operation in addition
+// to the allocations.
+func BenchmarkJournal(b *testing.B) {
+	var (
+		sb       strings.Builder
+		accounts = []string{"Expenses:Groceries", "Expenses:Rent", "Expenses:Travel", "Income:Salary"}
+		day      = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+	sb.WriteString("2000-01-01 open Assets:Bank\n")
+	for _, a := range accounts {
+		fmt.Fprintf(&sb, "2000-01-01 open %s\n", a)
+	}
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&sb, "\n%s \"Transaction %d\"\nAssets:Bank %s %d.%02d CHF\n",
+			day.AddDate(0, 0, i/10).Format("2006-01-02"), i, accounts[i%len(accounts)], i%1000, i%100)
+	}
+	src := sb.String()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for i := 0; i < b.N; i++ {
+		jctx := NewContext()
+		j, err := FromReader(context.Background(), jctx, strings.NewReader(src), "journal.knut")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := j.Process(Balance(jctx, nil)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(after.NumGC-before.NumGC)/float64(b.N), "gc/op")
+}
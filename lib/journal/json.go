@@ -0,0 +1,170 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"strings"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/shopspring/decimal"
+)
+
+// JSONJournal is the JSON representation of a processed journal, as
+// documented in doc/output.md.
+type JSONJournal struct {
+	Valuation string    `json:"valuation,omitempty"`
+	Days      []JSONDay `json:"days"`
+}
+
+// JSONDay is the JSON representation of a day.
+type JSONDay struct {
+	Date         string            `json:"date"`
+	Prices       []JSONPrice       `json:"prices,omitempty"`
+	Openings     []string          `json:"openings,omitempty"`
+	Transactions []JSONTransaction `json:"transactions,omitempty"`
+	Assertions   []JSONAssertion   `json:"assertions,omitempty"`
+	Closings     []string          `json:"closings,omitempty"`
+	Balances     []JSONBalance     `json:"balances,omitempty"`
+}
+
+// JSONPrice is the JSON representation of a price.
+type JSONPrice struct {
+	Commodity string `json:"commodity"`
+	Target    string `json:"target"`
+	Price     string `json:"price"`
+}
+
+// JSONTransaction is the JSON representation of a transaction.
+type JSONTransaction struct {
+	Description string        `json:"description"`
+	Tags        []string      `json:"tags,omitempty"`
+	Postings    []JSONPosting `json:"postings"`
+}
+
+// JSONPosting is the JSON representation of a posting.
+type JSONPosting struct {
+	Account   string `json:"account"`
+	Other     string `json:"other"`
+	Commodity string `json:"commodity"`
+	Amount    string `json:"amount"`
+	Value     string `json:"value,omitempty"`
+}
+
+// JSONAssertion is the JSON representation of a balance assertion.
+type JSONAssertion struct {
+	Account   string `json:"account"`
+	Commodity string `json:"commodity"`
+	Amount    string `json:"amount"`
+	Subtree   bool   `json:"subtree,omitempty"`
+}
+
+// JSONBalance is the balance of an account in a commodity at the end of a
+// day.
+type JSONBalance struct {
+	Account   string `json:"account"`
+	Commodity string `json:"commodity"`
+	Amount    string `json:"amount"`
+	Value     string `json:"value,omitempty"`
+}
+
+// NewJSONJournal creates the JSON representation of the given days, which
+// must have been processed. Days without directives are omitted. With
+// balances, every day carries the balances of the positions which changed
+// on that day.
+func NewJSONJournal(days []*Day, valuation *Commodity, balances bool) JSONJournal {
+	res := JSONJournal{Days: []JSONDay{}}
+	if valuation != nil {
+		res.Valuation = valuation.Name()
+	}
+	amounts, values := make(Amounts), make(Amounts)
+	for _, day := range days {
+		d := JSONDay{Date: day.Date.Format("2006-01-02")}
+		for _, p := range day.Prices {
+			d.Prices = append(d.Prices, JSONPrice{
+				Commodity: p.Commodity.Name(),
+				Target:    p.Target.Name(),
+				Price:     p.Price.String(),
+			})
+		}
+		for _, o := range day.Openings {
+			d.Openings = append(d.Openings, o.Account.Name())
+		}
+		compare.Sort(day.Transactions, CompareTransactions)
+		for _, t := range day.Transactions {
+			trx := JSONTransaction{Description: t.Description}
+			for _, tag := range t.Tags {
+				trx.Tags = append(trx.Tags, strings.TrimPrefix(string(tag), "#"))
+			}
+			for _, p := range t.Postings {
+				jp := JSONPosting{
+					Account:   p.Account.Name(),
+					Other:     p.Other.Name(),
+					Commodity: p.Commodity.Name(),
+					Amount:    p.Amount.String(),
+				}
+				if valuation != nil {
+					jp.Value = p.Value.String()
+				}
+				trx.Postings = append(trx.Postings, jp)
+			}
+			d.Transactions = append(d.Transactions, trx)
+		}
+		for _, a := range day.Assertions {
+			d.Assertions = append(d.Assertions, JSONAssertion{
+				Account:   a.Account.Name(),
+				Commodity: a.Commodity.Name(),
+				Amount:    a.Amount.String(),
+				Subtree:   a.Subtree,
+			})
+		}
+		for _, c := range day.Closings {
+			d.Closings = append(d.Closings, c.Account.Name())
+		}
+		if balances {
+			d.Balances = jsonBalances(day, amounts, values, valuation)
+		}
+		if len(d.Prices)+len(d.Openings)+len(d.Transactions)+len(d.Assertions)+len(d.Closings)+len(d.Balances) > 0 {
+			res.Days = append(res.Days, d)
+		}
+	}
+	return res
+}
+
+// jsonBalances adds the postings of the day to the running amounts and
+// values and returns the balances of the positions which changed.
+func jsonBalances(day *Day, amounts, values Amounts, valuation *Commodity) []JSONBalance {
+	changed := make(Amounts)
+	for _, t := range day.Transactions {
+		for _, p := range t.Postings {
+			k := AccountCommodityKey(p.Account, p.Commodity)
+			amounts.Add(k, p.Amount)
+			values.Add(k, p.Value)
+			changed[k] = decimal.Zero
+		}
+	}
+	var res []JSONBalance
+	for _, k := range changed.Index(compareAccountCommodity) {
+		b := JSONBalance{
+			Account:   k.Account.Name(),
+			Commodity: k.Commodity.Name(),
+			Amount:    amounts[k].String(),
+		}
+		if valuation != nil {
+			b.Value = values[k].String()
+		}
+		res = append(res, b)
+	}
+	return res
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ledger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/set"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// Dialect is a variant of the ledger file format.
+type Dialect int
+
+const (
+	// Ledger is the format of ledger-cli.
+	Ledger Dialect = iota
+	// HLedger is the format of hledger.
+	HLedger
+)
+
+// Transcode transcodes the given ledger to the ledger file format. Amounts
+// are written in their own commodities, prices as P directives and balance
+// assertions as transactions with a single posting of zero.
+func Transcode(w io.Writer, l []*journal.Day, d Dialect) error {
+	var (
+		b        = bufio.NewWriter(w)
+		accounts = set.New[*journal.Account]()
+	)
+	declare := func(a *journal.Account) {
+		if !accounts.Has(a) {
+			accounts.Add(a)
+			fmt.Fprintf(b, "account %s\n\n", a.Name())
+		}
+	}
+	for _, day := range l {
+		for _, open := range day.Openings {
+			declare(open.Account)
+		}
+		for _, p := range day.Prices {
+			fmt.Fprintf(b, "P %s %s %s %s\n\n", p.Date.Format("2006-01-02"), commodity(p.Commodity), p.Price, commodity(p.Target))
+		}
+		compare.Sort(day.Transactions, journal.CompareTransactions)
+		for _, trx := range day.Transactions {
+			for _, p := range trx.Postings {
+				declare(p.Account)
+			}
+		}
+		for _, trx := range day.Transactions {
+			writeTrx(b, trx, d)
+		}
+		for _, a := range day.Assertions {
+			op := "="
+			if a.Subtree {
+				if d != HLedger {
+					// ledger has no assertions including subaccounts
+					continue
+				}
+				op = "=*"
+			}
+			fmt.Fprintf(b, "%s * Balance assertion\n", a.Date.Format("2006-01-02"))
+			fmt.Fprintf(b, "    %s  0 %s %s %s %s\n\n", a.Account.Name(), commodity(a.Commodity), op, a.Amount, commodity(a.Commodity))
+		}
+	}
+	return b.Flush()
+}
+
+func writeTrx(w io.Writer, t *journal.Transaction, d Dialect) {
+	flag := journal.Cleared
+	if t.Flag == journal.Pending {
+		flag = journal.Pending
+	}
+	fmt.Fprintf(w, "%s %c %s", t.Date.Format("2006-01-02"), flag, t.Description)
+	var tags, values []string
+	for _, tag := range t.Tags {
+		switch {
+		case d == HLedger:
+			tags = append(tags, tag.Key()+":"+tag.Value())
+		case tag.Value() != "":
+			values = append(values, fmt.Sprintf("    ; %s: %s\n", tag.Key(), tag.Value()))
+		default:
+			tags = append(tags, tag.Key())
+		}
+	}
+	if len(tags) > 0 {
+		switch d {
+		case HLedger:
+			io.WriteString(w, "  ; "+strings.Join(tags, ", "))
+		default:
+			io.WriteString(w, "  ; :"+strings.Join(tags, ":")+":")
+		}
+	}
+	io.WriteString(w, "\n")
+	for _, v := range values {
+		io.WriteString(w, v)
+	}
+	for _, p := range t.Postings {
+		fmt.Fprintf(w, "    %s  %s %s\n", p.Account.Name(), p.Amount, commodity(p.Commodity))
+	}
+	io.WriteString(w, "\n")
+}
+
+// commodity returns the name of the commodity, quoted if it contains
+// characters other than letters.
+func commodity(c *journal.Commodity) string {
+	for _, r := range c.Name() {
+		if !unicode.IsLetter(r) {
+			return fmt.Sprintf("%q", c.Name())
+		}
+	}
+	return c.Name()
+}
@@ -0,0 +1,689 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ledger
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+	"go.uber.org/multierr"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/scanner"
+)
+
+func init() {
+	for _, ext := range []string{".ledger", ".journal", ".hledger"} {
+		journal.RegisterLoader(ext, Read)
+	}
+}
+
+// ConversionAccount is the account which balances postings with a price
+// against the postings in the commodity of the price.
+const ConversionAccount = "Equity:Conversions"
+
+// Read reads the ledger or hledger journal at path and the files it
+// includes. It supports transactions with elided amounts, prices (@ and @@)
+// and balance assertions (=), as well as P directives. Other directives,
+// such as account or commodity declarations, periodic and automated
+// transactions are ignored. As ledger does not require accounts to be
+// opened, each account is opened on the date of its first use.
+func Read(jctx journal.Context, src journal.Source, path string) ([]journal.Directive, error) {
+	r := reader{
+		context: jctx,
+		source:  src,
+		opened:  make(map[*journal.Account]time.Time),
+	}
+	if err := r.readFile(path); err != nil {
+		return nil, err
+	}
+	accounts := make([]*journal.Account, 0, len(r.opened))
+	for a := range r.opened {
+		accounts = append(accounts, a)
+	}
+	compare.Sort(accounts, journal.CompareAccounts)
+	res := make([]journal.Directive, 0, len(accounts)+len(r.directives))
+	for _, a := range accounts {
+		res = append(res, &journal.Open{Date: r.opened[a], Account: a})
+	}
+	return append(res, r.directives...), nil
+}
+
+type reader struct {
+	context    journal.Context
+	source     journal.Source
+	directives []journal.Directive
+	opened     map[*journal.Account]time.Time
+}
+
+// ignored are the directives which are skipped, along with their indented
+// sub-directives.
+var ignored = map[string]bool{
+	"account":   true,
+	"commodity": true,
+	"payee":     true,
+	"tag":       true,
+	"check":     true,
+	"assert":    true,
+}
+
+func (r *reader) readFile(path string) error {
+	f, err := r.source.Open(path)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	if err := multierr.Append(err, f.Close()); err != nil {
+		return err
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); {
+		j := i + 1
+		for j < len(lines) && isIndented(lines[j]) {
+			j++
+		}
+		switch keyword := firstField(lines[i]); keyword {
+		case "comment", "test":
+			for j = i + 1; j < len(lines) && strings.TrimSpace(lines[j]) != "end "+keyword; j++ {
+			}
+			j++
+		case "include", "!include":
+			if err := r.include(path, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), keyword))); err != nil {
+				return err
+			}
+		default:
+			if err := r.readBlock(path, i+1, lines[i:j]); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, i+1, err)
+			}
+		}
+		i = j
+	}
+	return nil
+}
+
+func (r *reader) include(path, pattern string) error {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(path), pattern)
+	}
+	paths, err := r.source.List(pattern)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("%s: no files match include %s", path, pattern)
+	}
+	for _, p := range paths {
+		if err := r.readFile(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBlock reads a top-level line and the indented lines following it.
+func (r *reader) readBlock(path string, line int, block []string) error {
+	head := block[0]
+	switch {
+	case len(strings.TrimSpace(head)) == 0:
+		return nil
+	case isIndented(head):
+		return fmt.Errorf("unexpected indented line")
+	case strings.ContainsRune(";#%|*", rune(head[0])):
+		return nil
+	case strings.ContainsRune("~=", rune(head[0])):
+		// periodic and automated transactions
+		return nil
+	case unicode.IsDigit(rune(head[0])):
+		return r.readTransaction(newRange(path, line, len(block)), block)
+	case head[0] == 'P' && len(head) > 1 && unicode.IsSpace(rune(head[1])):
+		return r.readPrice(newRange(path, line, 1), head[1:])
+	}
+	if keyword := firstField(head); !ignored[keyword] {
+		return fmt.Errorf("unsupported directive %q", keyword)
+	}
+	return nil
+}
+
+func newRange(path string, line, n int) journal.Range {
+	return journal.Range{
+		Path:  path,
+		Start: scanner.Location{Line: line, Column: 1},
+		End:   scanner.Location{Line: line + n - 1, Column: 1},
+	}
+}
+
+func (r *reader) readPrice(rng journal.Range, s string) error {
+	fields := strings.Fields(s)
+	if len(fields) > 1 && strings.Contains(fields[1], ":") {
+		// skip the time
+		fields = append(fields[:1], fields[2:]...)
+	}
+	if len(fields) < 3 {
+		return fmt.Errorf("invalid price directive")
+	}
+	d, err := parseDate(fields[0])
+	if err != nil {
+		return err
+	}
+	c, err := r.commodity(strings.Trim(fields[1], `"`))
+	if err != nil {
+		return err
+	}
+	p, err := r.parseAmount(strings.Join(fields[2:], " "))
+	if err != nil {
+		return err
+	}
+	r.directives = append(r.directives, &journal.Price{
+		Range:     rng,
+		Date:      d,
+		Commodity: c,
+		Target:    p.commodity,
+		Price:     p.quantity,
+	})
+	return nil
+}
+
+type amount struct {
+	quantity  decimal.Decimal
+	commodity *journal.Commodity
+}
+
+type posting struct {
+	account   *journal.Account
+	amount    *amount
+	cost      *amount
+	assertion *amount
+	subtree   bool
+}
+
+// leg is the change of the position of an account in a commodity.
+type leg struct {
+	account *journal.Account
+	amount
+}
+
+func (r *reader) readTransaction(rng journal.Range, block []string) error {
+	d, flag, desc, comment, err := parseHeader(block[0])
+	if err != nil {
+		return err
+	}
+	tags := parseTags(comment)
+	var postings []*posting
+	for _, line := range block[1:] {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			tags = append(tags, parseTags(line[1:])...)
+			continue
+		}
+		p, err := r.parsePosting(line)
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			postings = append(postings, p)
+		}
+	}
+	legs, err := r.legs(postings)
+	if err != nil {
+		return err
+	}
+	pbs := pair(legs)
+	for _, pb := range pbs {
+		r.use(pb.Credit, d)
+		r.use(pb.Debit, d)
+	}
+	if len(pbs) > 0 {
+		r.directives = append(r.directives, journal.TransactionBuilder{
+			Range:       rng,
+			Date:        d,
+			Flag:        flag,
+			Description: desc,
+			Tags:        dedupe(tags),
+			Postings:    pbs.Build(),
+		}.Build())
+	}
+	for _, p := range postings {
+		if p.assertion == nil {
+			continue
+		}
+		if !p.subtree {
+			r.use(p.account, d)
+		}
+		r.directives = append(r.directives, &journal.Assertion{
+			Range:     rng,
+			Date:      d,
+			Account:   p.account,
+			Amount:    p.assertion.quantity,
+			Commodity: p.assertion.commodity,
+			Subtree:   p.subtree,
+		})
+	}
+	return nil
+}
+
+// legs computes the changes of positions of the transaction. Postings with a
+// price are balanced through the conversion account, and the elided amount,
+// if any, is inferred.
+func (r *reader) legs(postings []*posting) ([]leg, error) {
+	var (
+		res    []leg
+		elided *posting
+	)
+	for _, p := range postings {
+		if p.amount == nil {
+			if elided != nil {
+				return nil, fmt.Errorf("more than one posting without amount")
+			}
+			elided = p
+			continue
+		}
+		res = append(res, leg{p.account, *p.amount})
+		if p.cost != nil {
+			conv, err := r.context.GetAccount(ConversionAccount)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res,
+				leg{conv, amount{p.amount.quantity.Neg(), p.amount.commodity}},
+				leg{conv, *p.cost},
+			)
+		}
+	}
+	commodities, sums := sumByCommodity(res)
+	for _, c := range commodities {
+		if sums[c].IsZero() {
+			continue
+		}
+		if elided == nil {
+			return nil, fmt.Errorf("transaction does not balance: %s %s", sums[c], c.Name())
+		}
+		res = append(res, leg{elided.account, amount{sums[c].Neg(), c}})
+	}
+	return res, nil
+}
+
+func sumByCommodity(legs []leg) ([]*journal.Commodity, map[*journal.Commodity]decimal.Decimal) {
+	var (
+		commodities []*journal.Commodity
+		sums        = make(map[*journal.Commodity]decimal.Decimal)
+	)
+	for _, l := range legs {
+		if _, ok := sums[l.commodity]; !ok {
+			commodities = append(commodities, l.commodity)
+		}
+		sums[l.commodity] = sums[l.commodity].Add(l.quantity)
+	}
+	return commodities, sums
+}
+
+// pair pairs the legs of each commodity into bookings from one account to
+// another.
+func pair(legs []leg) journal.PostingBuilders {
+	commodities, _ := sumByCommodity(legs)
+	var res journal.PostingBuilders
+	for _, c := range commodities {
+		var credits, debits []leg
+		for _, l := range legs {
+			switch {
+			case l.commodity != c:
+			case l.quantity.IsNegative():
+				credits = append(credits, leg{l.account, amount{l.quantity.Neg(), c}})
+			case l.quantity.IsPositive():
+				debits = append(debits, l)
+			}
+		}
+		for i, j := 0, 0; i < len(credits) && j < len(debits); {
+			q := decimal.Min(credits[i].quantity, debits[j].quantity)
+			if credits[i].account != debits[j].account {
+				res = append(res, journal.PostingBuilder{
+					Credit:    credits[i].account,
+					Debit:     debits[j].account,
+					Commodity: c,
+					Amount:    q,
+				})
+			}
+			credits[i].quantity = credits[i].quantity.Sub(q)
+			debits[j].quantity = debits[j].quantity.Sub(q)
+			if credits[i].quantity.IsZero() {
+				i++
+			}
+			if debits[j].quantity.IsZero() {
+				j++
+			}
+		}
+	}
+	return res
+}
+
+func (r *reader) use(a *journal.Account, d time.Time) {
+	if t, ok := r.opened[a]; !ok || d.Before(t) {
+		r.opened[a] = d
+	}
+}
+
+// parseHeader parses the first line of a transaction and returns its
+// date, flag, description and comment.
+func parseHeader(s string) (time.Time, journal.Flag, string, string, error) {
+	ds, rest := s, ""
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		ds, rest = s[:i], s[i:]
+	}
+	// ignore the auxiliary date
+	ds, _, _ = strings.Cut(ds, "=")
+	d, err := parseDate(ds)
+	if err != nil {
+		return time.Time{}, journal.Unflagged, "", "", err
+	}
+	desc, comment, _ := strings.Cut(rest, ";")
+	desc = strings.TrimSpace(desc)
+	var flag journal.Flag
+	if strings.HasPrefix(desc, "*") || strings.HasPrefix(desc, "!") {
+		flag = journal.Flag(desc[0])
+		desc = strings.TrimSpace(desc[1:])
+	}
+	if strings.HasPrefix(desc, "(") {
+		if i := strings.Index(desc, ")"); i >= 0 {
+			desc = strings.TrimSpace(desc[i+1:])
+		}
+	}
+	return d, flag, desc, comment, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	d, err := time.Parse("2006-1-2", strings.NewReplacer("/", "-", ".", "-").Replace(s))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	return d, nil
+}
+
+var (
+	lotRegex        = regexp.MustCompile(`\{\{([^}]*)\}\}|\{([^}]*)\}`)
+	annotationRegex = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)`)
+)
+
+// parsePosting parses a posting. It returns nil for virtual postings which
+// need not balance.
+func (r *reader) parsePosting(s string) (*posting, error) {
+	s, _, _ = strings.Cut(s, ";")
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "*") || strings.HasPrefix(s, "!") {
+		s = strings.TrimSpace(s[1:])
+	}
+	name, rest := s, ""
+	if i := strings.Index(s, "  "); i >= 0 {
+		name, rest = s[:i], s[i:]
+	}
+	if i := strings.Index(name, "\t"); i >= 0 {
+		name, rest = name[:i], name[i:]+rest
+	}
+	switch {
+	case strings.HasPrefix(name, "(") && strings.HasSuffix(name, ")"):
+		return nil, nil
+	case strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]"):
+		name = name[1 : len(name)-1]
+	}
+	a, err := r.account(name)
+	if err != nil {
+		return nil, err
+	}
+	p := &posting{account: a}
+	if amt, assertion, ok := strings.Cut(rest, "="); ok {
+		rest, assertion = amt, strings.TrimPrefix(assertion, "=")
+		if strings.HasPrefix(assertion, "*") {
+			assertion, p.subtree = assertion[1:], true
+		}
+		res, err := r.parseAmount(assertion)
+		if err != nil {
+			return nil, err
+		}
+		p.assertion = &res
+	}
+	var (
+		price string
+		total bool
+	)
+	if amt, pr, ok := strings.Cut(rest, "@@"); ok {
+		rest, price, total = amt, pr, true
+	} else if amt, pr, ok := strings.Cut(rest, "@"); ok {
+		rest, price = amt, pr
+	}
+	if m := lotRegex.FindStringSubmatch(rest); m != nil && len(strings.TrimSpace(price)) == 0 {
+		price, total = m[2], len(m[1]) > 0
+		if total {
+			price = m[1]
+		}
+	}
+	rest = strings.TrimSpace(annotationRegex.ReplaceAllString(lotRegex.ReplaceAllString(rest, ""), ""))
+	if len(rest) == 0 {
+		if p.assertion != nil {
+			return nil, fmt.Errorf("balance assignments are not supported")
+		}
+		if len(price) > 0 {
+			return nil, fmt.Errorf("posting without amount has a price")
+		}
+		return p, nil
+	}
+	amt, err := r.parseAmount(rest)
+	if err != nil {
+		return nil, err
+	}
+	p.amount = &amt
+	if len(strings.TrimSpace(price)) == 0 {
+		return p, nil
+	}
+	pr, err := r.parseAmount(price)
+	if err != nil {
+		return nil, err
+	}
+	if pr.commodity == amt.commodity {
+		return p, nil
+	}
+	if total {
+		pr.quantity = pr.quantity.Abs()
+		if amt.quantity.IsNegative() {
+			pr.quantity = pr.quantity.Neg()
+		}
+	} else {
+		pr.quantity = pr.quantity.Mul(amt.quantity)
+	}
+	p.cost = &pr
+	return p, nil
+}
+
+// parseAmount parses an amount with the commodity before or after the
+// quantity, e.g. "-1,000.50 CHF", "$-12" or "EUR 3".
+func (r *reader) parseAmount(s string) (amount, error) {
+	s = strings.TrimSpace(s)
+	orig := s
+	var neg bool
+	if strings.HasPrefix(s, "-") {
+		neg, s = true, strings.TrimSpace(s[1:])
+	}
+	var num, com string
+	if len(s) > 0 && (unicode.IsDigit(rune(s[0])) || s[0] == '.') {
+		i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' && r != ',' })
+		if i < 0 {
+			i = len(s)
+		}
+		num, com = s[:i], strings.TrimSpace(s[i:])
+	} else {
+		com, num = splitCommodity(s)
+		num = strings.TrimSpace(num)
+		if strings.HasPrefix(num, "-") {
+			neg, num = !neg, strings.TrimSpace(num[1:])
+		}
+	}
+	q, err := decimal.NewFromString(strings.ReplaceAll(num, ",", ""))
+	if err != nil {
+		return amount{}, fmt.Errorf("invalid amount %q", orig)
+	}
+	if neg {
+		q = q.Neg()
+	}
+	c, err := r.commodity(strings.Trim(com, `"`))
+	if err != nil {
+		return amount{}, err
+	}
+	return amount{q, c}, nil
+}
+
+func splitCommodity(s string) (string, string) {
+	if strings.HasPrefix(s, `"`) {
+		if i := strings.Index(s[1:], `"`); i >= 0 {
+			return s[:i+2], s[i+2:]
+		}
+	}
+	if i := strings.IndexFunc(s, func(r rune) bool { return unicode.IsDigit(r) || unicode.IsSpace(r) || r == '-' }); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
+
+// symbols maps currency symbols to commodities.
+var symbols = map[string]string{
+	"$": "USD",
+	"€": "EUR",
+	"£": "GBP",
+	"¥": "JPY",
+}
+
+func (r *reader) commodity(name string) (*journal.Commodity, error) {
+	if s, ok := symbols[name]; ok {
+		name = s
+	}
+	if len(name) == 0 {
+		return nil, fmt.Errorf("amount without commodity")
+	}
+	return r.context.GetCommodity(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name))
+}
+
+// accountTypes maps the names of top-level accounts to knut's account types.
+var accountTypes = map[string]string{
+	"asset":       "Assets",
+	"assets":      "Assets",
+	"liability":   "Liabilities",
+	"liabilities": "Liabilities",
+	"equity":      "Equity",
+	"income":      "Income",
+	"revenue":     "Income",
+	"revenues":    "Income",
+	"expense":     "Expenses",
+	"expenses":    "Expenses",
+}
+
+// account converts a ledger account name into a knut account. Segments are
+// converted to camel case, dropping characters other than letters and
+// digits, e.g. "assets:checking account" becomes "Assets:CheckingAccount".
+func (r *reader) account(name string) (*journal.Account, error) {
+	segments := strings.Split(strings.TrimSpace(name), ":")
+	t, ok := accountTypes[strings.ToLower(segments[0])]
+	if !ok {
+		return nil, fmt.Errorf("account %q has an invalid account type %q", name, segments[0])
+	}
+	segments[0] = t
+	for i, s := range segments[1:] {
+		segments[i+1] = camelCase(s)
+	}
+	return r.context.GetAccount(strings.Join(segments, ":"))
+}
+
+func camelCase(s string) string {
+	var b strings.Builder
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		rs := []rune(w)
+		b.WriteRune(unicode.ToUpper(rs[0]))
+		b.WriteString(string(rs[1:]))
+	}
+	return b.String()
+}
+
+var (
+	ledgerTagRegex  = regexp.MustCompile(`(?:^|\s):((?:[^:\s]+:)+)`)
+	hledgerTagRegex = regexp.MustCompile(`(?:^|[\s,])([\p{L}\p{N}_-]+):[ \t]*([^,]*)`)
+)
+
+// parseTags parses ledger tags (":tag1:tag2:") and hledger tags ("tag1:,
+// tag2: value") in a comment.
+func parseTags(comment string) []journal.Tag {
+	var res []journal.Tag
+	for _, m := range ledgerTagRegex.FindAllStringSubmatch(comment, -1) {
+		for _, t := range strings.Split(strings.TrimSuffix(m[1], ":"), ":") {
+			res = appendTag(res, t, "")
+		}
+	}
+	comment = ledgerTagRegex.ReplaceAllString(comment, " ")
+	for _, m := range hledgerTagRegex.FindAllStringSubmatch(comment, -1) {
+		res = appendTag(res, m[1], m[2])
+	}
+	return res
+}
+
+// appendTag appends the tag with the given name and value, without the
+// characters which knut does not allow in tags.
+func appendTag(tags []journal.Tag, name, value string) []journal.Tag {
+	name = identifier(name)
+	if len(name) == 0 {
+		return tags
+	}
+	if v := identifier(value); len(v) > 0 {
+		name += ":" + v
+	}
+	return append(tags, journal.Tag("#"+name))
+}
+
+func identifier(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func dedupe(tags []journal.Tag) []journal.Tag {
+	var res []journal.Tag
+	seen := make(map[journal.Tag]bool)
+	for _, t := range tags {
+		if !seen[t] {
+			seen[t] = true
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+func isIndented(line string) bool {
+	return len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(strings.TrimSpace(line)) > 0
+}
+
+func firstField(line string) string {
+	if fs := strings.Fields(line); len(fs) > 0 && !isIndented(line) {
+		return fs[0]
+	}
+	return ""
+}
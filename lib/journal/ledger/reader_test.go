@@ -0,0 +1,228 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ledger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		desc, input, want string
+	}{
+		{
+			desc: "elided amount",
+			input: `2020/01/15 * (42) Groceries  ; :food:
+    Expenses:Food                $120.50
+    Assets:Checking
+`,
+			want: `2020-01-15 open Assets:Checking
+2020-01-15 open Expenses:Food
+2020-01-15 * "Groceries" #food
+Assets:Checking Expenses:Food 120.5 USD
+`,
+		},
+		{
+			desc: "multiple commodities",
+			input: `2020-01-15 Transfer
+    assets:bank account:usd       100 USD
+    assets:bank account:chf       90 CHF
+    equity:opening balances
+`,
+			want: `2020-01-15 open Assets:BankAccount:Chf
+2020-01-15 open Assets:BankAccount:Usd
+2020-01-15 open Equity:OpeningBalances
+2020-01-15 "Transfer"
+Equity:OpeningBalances Assets:BankAccount:Usd 100 USD
+Equity:OpeningBalances Assets:BankAccount:Chf 90 CHF
+`,
+		},
+		{
+			desc: "unit price",
+			input: `2020-02-01 Buy shares  ; broker:, tax:
+    Assets:Broker                 10 AAPL @ 150 USD
+    Assets:Broker                 -1,500 USD
+`,
+			want: `2020-02-01 open Assets:Broker
+2020-02-01 open Equity:Conversions
+2020-02-01 "Buy shares" #broker #tax
+Equity:Conversions Assets:Broker 10 AAPL
+Assets:Broker Equity:Conversions 1500 USD
+`,
+		},
+		{
+			desc: "tag values",
+			input: `2020-03-01 Shoes  ; :clothing:
+    ; member: bob
+    Expenses:Clothing             100 CHF
+    Assets:Joint
+`,
+			want: `2020-03-01 open Assets:Joint
+2020-03-01 open Expenses:Clothing
+2020-03-01 "Shoes" #clothing #member:bob
+Assets:Joint Expenses:Clothing 100 CHF
+`,
+		},
+		{
+			desc: "total price and lot",
+			input: `2020-02-01 Sell shares
+    Assets:Broker                 -5 AAPL {150 USD} [2020-01-01] @@ 800 USD
+    Assets:Broker                 800 USD
+    Income:Gains
+
+2020-02-02 Sell shares
+    Assets:Broker                 -5 AAPL {150 USD}
+    Assets:Broker
+`,
+			want: `2020-02-01 open Assets:Broker
+2020-02-01 open Equity:Conversions
+2020-02-01 "Sell shares"
+Assets:Broker Equity:Conversions 5 AAPL
+Equity:Conversions Assets:Broker 800 USD
+2020-02-02 "Sell shares"
+Assets:Broker Equity:Conversions 5 AAPL
+Equity:Conversions Assets:Broker 750 USD
+`,
+		},
+		{
+			desc: "assertions and prices",
+			input: `; a comment
+comment
+2020-01-01 ignored
+end comment
+account Assets:Bank
+    note a bank
+
+P 2020-01-01 00:00:00 EUR 1.1 USD
+P 2020-01-02 "AAPL" $300
+
+2020-01-03 Opening balance
+    Assets:Bank                    EUR 100 = EUR 100
+    (Assets:Budget)                 EUR 50
+    [Equity:Opening]
+
+2020-01-04 Assertion
+    Assets:Bank                    0 EUR == 100 EUR
+
+2020-01-05 Subtree assertion
+    Assets                         0 EUR ==* 100 EUR
+`,
+			want: `2020-01-03 open Assets:Bank
+2020-01-03 open Equity:Opening
+2020-01-01 price EUR 1.1 USD
+2020-01-02 price AAPL 300 USD
+2020-01-03 "Opening balance"
+Equity:Opening Assets:Bank 100 EUR
+2020-01-03 balance Assets:Bank 100 EUR
+2020-01-04 balance Assets:Bank 100 EUR
+2020-01-05 balance Assets* 100 EUR
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.ledger")
+			if err := os.WriteFile(path, []byte(test.input), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			ds, err := Read(journal.NewContext(), journal.FileSystem{}, path)
+
+			if err != nil {
+				t.Fatalf("Read() returned unexpected error: %v", err)
+			}
+			var (
+				b strings.Builder
+				p journal.Printer
+			)
+			for _, d := range ds {
+				p.PrintDirective(&b, d)
+				b.WriteString("\n")
+			}
+			if diff := cmp.Diff(test.want, normalize(b.String())); diff != "" {
+				t.Errorf("Read() returned unexpected directives (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		desc, input, want string
+	}{
+		{
+			desc:  "unbalanced",
+			input: "2020-01-01 Test\n    Assets:A  1 USD\n    Assets:B  2 USD\n",
+			want:  "test.ledger:1: transaction does not balance: 3 USD",
+		},
+		{
+			desc:  "two elided amounts",
+			input: "2020-01-01 Test\n    Assets:A  1 USD\n    Assets:B\n    Assets:C\n",
+			want:  "test.ledger:1: more than one posting without amount",
+		},
+		{
+			desc:  "invalid account type",
+			input: "2020-01-01 Test\n    Cash  1 USD\n    Assets:B\n",
+			want:  `test.ledger:1: account "Cash" has an invalid account type "Cash"`,
+		},
+		{
+			desc:  "balance assignment",
+			input: "2020-01-01 Test\n    Assets:A  = 1 USD\n    Assets:B\n",
+			want:  "test.ledger:1: balance assignments are not supported",
+		},
+		{
+			desc:  "unsupported directive",
+			input: "alias checking=Assets:Checking\n",
+			want:  `test.ledger:1: unsupported directive "alias"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "test.ledger")
+			if err := os.WriteFile(path, []byte(test.input), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Read(journal.NewContext(), journal.FileSystem{}, path)
+
+			if err == nil {
+				t.Fatal("Read() returned no error")
+			}
+			if got := strings.TrimPrefix(err.Error(), dir+string(filepath.Separator)); got != test.want {
+				t.Errorf("Read() returned error %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// normalize collapses white space and removes empty lines.
+func normalize(s string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(s, "\n") {
+		if fs := strings.Fields(line); len(fs) > 0 {
+			b.WriteString(strings.Join(fs, " "))
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
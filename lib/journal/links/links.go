@@ -0,0 +1,126 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package links groups transactions by their links, e.g. an invoice and
+// its payment.
+package links
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/common/regex"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// Group is a link with the transactions which carry it, in the order of
+// the journal.
+type Group struct {
+	Link         journal.Link
+	Transactions []*journal.Transaction
+}
+
+// Links collects the transactions in a period by link.
+type Links struct {
+	period date.Period
+	links  regex.Regexes
+
+	groups map[journal.Link]*Group
+}
+
+// New creates a new Links, which collects the links matching one of the
+// regexes, or all links if there are none. The regexes are matched against
+// the links without the leading '^'.
+func New(period date.Period, rx []*regexp.Regexp) *Links {
+	return &Links{
+		period: period,
+		links:  regex.Regexes(rx),
+		groups: make(map[journal.Link]*Group),
+	}
+}
+
+// Process processes a day. It must run after Sort.
+func (l *Links) Process(d *journal.Day) error {
+	if !l.period.Contains(d.Date) {
+		return nil
+	}
+	for _, t := range d.Transactions {
+		for _, link := range t.Links {
+			if len(l.links) > 0 && !l.links.MatchString(strings.TrimPrefix(string(link), "^")) {
+				continue
+			}
+			g := dict.GetDefault(l.groups, link, func() *Group { return &Group{Link: link} })
+			g.Transactions = append(g.Transactions, t)
+		}
+	}
+	return nil
+}
+
+// Groups returns the groups, sorted by the date of their first transaction
+// and by link.
+func (l *Links) Groups() []*Group {
+	return dict.SortedValues(l.groups, func(g1, g2 *Group) compare.Order {
+		if o := compare.Time(g1.Transactions[0].Date, g2.Transactions[0].Date); o != compare.Equal {
+			return o
+		}
+		return compare.Ordered(g1.Link, g2.Link)
+	})
+}
+
+// Render renders the groups with the bookings of their transactions.
+func Render(groups []*Group) *table.Table {
+	tbl := table.New(1, 1, 1, 1, 1, 1)
+	tbl.AddSeparatorRow()
+	tbl.AddHeaderRow().
+		AddText("Date", table.Center).
+		AddText("Description", table.Center).
+		AddText("Credit", table.Center).
+		AddText("Debit", table.Center).
+		AddText("Amount", table.Center).
+		AddText("Comm", table.Center)
+	for _, g := range groups {
+		tbl.AddSeparatorRow()
+		tbl.AddRow().
+			AddText(string(g.Link), table.Left).
+			AddEmpty().
+			AddEmpty().
+			AddEmpty().
+			AddEmpty().
+			AddEmpty()
+		for _, t := range g.Transactions {
+			for i, p := range t.Postings {
+				// the postings of a booking come in pairs, print the debit
+				if i%2 == 0 {
+					continue
+				}
+				row := tbl.AddRow()
+				if i == 1 {
+					row.AddIndented(t.Date.Format("2006-01-02"), 2).AddText(t.Description, table.Left)
+				} else {
+					row.AddEmpty().AddEmpty()
+				}
+				row.AddText(p.Other.Name(), table.Left).
+					AddText(p.Account.Name(), table.Left).
+					AddNumber(p.Amount).
+					AddText(p.Commodity.Name(), table.Left)
+			}
+		}
+	}
+	tbl.AddSeparatorRow()
+	return tbl
+}
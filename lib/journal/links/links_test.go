@@ -0,0 +1,91 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package links
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestLinks(t *testing.T) {
+	var (
+		jctx        = journal.NewContext()
+		sales       = jctx.Account("Income:Sales")
+		receivables = jctx.Account("Assets:Receivables")
+		bank        = jctx.Account("Assets:Bank")
+		chf         = jctx.Commodity("CHF")
+		j           = journal.New(jctx)
+	)
+	transaction := func(d time.Time, desc string, credit, debit *journal.Account, links ...journal.Link) *journal.Transaction {
+		t := journal.TransactionBuilder{
+			Date:        d,
+			Description: desc,
+			Links:       links,
+			Postings: journal.PostingBuilder{
+				Credit:    credit,
+				Debit:     debit,
+				Commodity: chf,
+				Amount:    decimal.NewFromInt(100),
+			}.Build(),
+		}.Build()
+		j.AddTransaction(t)
+		return t
+	}
+	inv1 := transaction(date.Date(2020, 1, 10), "Invoice 1", sales, receivables, "^inv-1")
+	inv2 := transaction(date.Date(2020, 1, 5), "Invoice 2", sales, receivables, "^inv-2")
+	pay := transaction(date.Date(2020, 2, 1), "Payment", receivables, bank, "^inv-1", "^inv-2")
+	transaction(date.Date(2020, 2, 2), "Unrelated", sales, bank)
+	period := date.Period{Start: date.Date(2020, 1, 1), End: date.Date(2020, 12, 31)}
+
+	tests := []struct {
+		desc string
+		rx   []*regexp.Regexp
+		want []*Group
+	}{
+		{
+			desc: "all links",
+			want: []*Group{
+				{Link: "^inv-2", Transactions: []*journal.Transaction{inv2, pay}},
+				{Link: "^inv-1", Transactions: []*journal.Transaction{inv1, pay}},
+			},
+		},
+		{
+			desc: "filtered links",
+			rx:   []*regexp.Regexp{regexp.MustCompile("^inv-1$")},
+			want: []*Group{
+				{Link: "^inv-1", Transactions: []*journal.Transaction{inv1, pay}},
+			},
+		},
+	}
+	for _, test := range tests {
+		l := New(period, test.rx)
+		if _, err := j.Process(journal.Sort(), l.Process); err != nil {
+			t.Fatalf("%s: Process() returned unexpected error: %v", test.desc, err)
+		}
+
+		got := l.Groups()
+
+		if diff := cmp.Diff(test.want, got, cmp.Comparer(func(a, b *journal.Transaction) bool { return a == b })); diff != "" {
+			t.Errorf("%s: Groups() returned unexpected groups (-want/+got):\n%s", test.desc, diff)
+		}
+	}
+}
@@ -0,0 +1,528 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lots tracks the lots of the positions in asset and liability
+// accounts with their cost basis.
+package lots
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+)
+
+// Method is the method to select the lots which are reduced.
+type Method int
+
+const (
+	// Average reduces all lots proportionally, such that the cost basis
+	// is the average cost of all acquisitions.
+	Average Method = iota
+	// FIFO reduces the oldest lots first.
+	FIFO
+	// LIFO reduces the newest lots first.
+	LIFO
+)
+
+var methods = map[string]Method{
+	"average": Average,
+	"fifo":    FIFO,
+	"lifo":    LIFO,
+}
+
+// ParseMethod parses a method, which is average, fifo or lifo.
+func ParseMethod(s string) (Method, error) {
+	m, ok := methods[s]
+	if !ok {
+		return 0, fmt.Errorf("invalid method %q, expected average, fifo or lifo", s)
+	}
+	return m, nil
+}
+
+func (m Method) String() string {
+	for s, m2 := range methods {
+		if m == m2 {
+			return s
+		}
+	}
+	return fmt.Sprintf("Method(%d)", int(m))
+}
+
+// Lot is a part of a position which was acquired at the same time and
+// cost.
+type Lot struct {
+	Date  time.Time
+	Label string
+
+	// Quantity is the remaining quantity of the lot.
+	Quantity decimal.Decimal
+
+	// Cost is the cost basis of the remaining quantity in the valuation
+	// commodity.
+	Cost decimal.Decimal
+}
+
+// scale returns the fraction f of the lot.
+func (l Lot) scale(f decimal.Decimal) Lot {
+	l.Quantity, l.Cost = l.Quantity.Mul(f), l.Cost.Mul(f)
+	return l
+}
+
+// Disposal is the disposal of a lot or a part of it.
+type Disposal struct {
+	Date      time.Time
+	Account   *journal.Account
+	Commodity *journal.Commodity
+
+	// Lot is the disposed lot, with its quantity and cost basis.
+	Lot Lot
+
+	// Proceeds is the value of the disposed lot at the time of the
+	// disposal.
+	Proceeds decimal.Decimal
+}
+
+// Gain returns the realized gain of the disposal.
+func (d Disposal) Gain() decimal.Decimal {
+	return d.Proceeds.Sub(d.Lot.Cost)
+}
+
+// Inventory is the set of lots of a commodity in an account.
+type Inventory struct {
+	Account   *journal.Account
+	Commodity *journal.Commodity
+	Lots      []Lot
+}
+
+// Quantity returns the quantity of all lots.
+func (inv *Inventory) Quantity() decimal.Decimal {
+	var res decimal.Decimal
+	for _, l := range inv.Lots {
+		res = res.Add(l.Quantity)
+	}
+	return res
+}
+
+// Cost returns the cost basis of all lots.
+func (inv *Inventory) Cost() decimal.Decimal {
+	var res decimal.Decimal
+	for _, l := range inv.Lots {
+		res = res.Add(l.Cost)
+	}
+	return res
+}
+
+// Add adds a lot. Lots are kept sorted by date.
+func (inv *Inventory) Add(l Lot) {
+	if l.Quantity.IsZero() {
+		return
+	}
+	i := sort.Search(len(inv.Lots), func(i int) bool { return inv.Lots[i].Date.After(l.Date) })
+	inv.Lots = append(inv.Lots, Lot{})
+	copy(inv.Lots[i+1:], inv.Lots[i:])
+	inv.Lots[i] = l
+}
+
+// Reduce reduces the position by the given amount, which must have the
+// opposite sign of the position. Lots matching the given lot annotation,
+// if any, are reduced first, followed by the other lots in the order of
+// the method. Reduce returns the removed lots and the part of the amount
+// which exceeds the position.
+func (inv *Inventory) Reduce(amount decimal.Decimal, m Method, match *journal.Lot) ([]Lot, decimal.Decimal) {
+	var removed []Lot
+	remaining := amount.Neg()
+	for _, pass := range []bool{true, false} {
+		if match == nil && pass {
+			continue
+		}
+		var idx []int
+		for i, l := range inv.Lots {
+			if !pass || matches(l, match) {
+				idx = append(idx, i)
+			}
+		}
+		if m == LIFO {
+			for i, j := 0, len(idx)-1; i < j; i, j = i+1, j-1 {
+				idx[i], idx[j] = idx[j], idx[i]
+			}
+		}
+		removed, remaining = inv.reduce(removed, remaining, idx, m)
+	}
+	var lots []Lot
+	for _, l := range inv.Lots {
+		if !l.Quantity.IsZero() {
+			lots = append(lots, l)
+		}
+	}
+	inv.Lots = lots
+	return removed, remaining.Neg()
+}
+
+// reduce reduces the lots with the given indexes by the remaining quantity
+// and returns the removed lots and the quantity which still remains.
+func (inv *Inventory) reduce(removed []Lot, remaining decimal.Decimal, idx []int, m Method) ([]Lot, decimal.Decimal) {
+	if m == Average {
+		var total decimal.Decimal
+		for _, i := range idx {
+			total = total.Add(inv.Lots[i].Quantity)
+		}
+		if total.IsZero() || total.Sign() != remaining.Sign() {
+			return removed, remaining
+		}
+		f := decimal.NewFromInt(1)
+		if remaining.Abs().LessThan(total.Abs()) {
+			f = remaining.Div(total)
+		}
+		for _, i := range idx {
+			r := inv.Lots[i].scale(f)
+			inv.Lots[i].Quantity = inv.Lots[i].Quantity.Sub(r.Quantity)
+			inv.Lots[i].Cost = inv.Lots[i].Cost.Sub(r.Cost)
+			removed = append(removed, r)
+			remaining = remaining.Sub(r.Quantity)
+		}
+		return removed, remaining
+	}
+	for _, i := range idx {
+		l := &inv.Lots[i]
+		if remaining.IsZero() || l.Quantity.IsZero() || l.Quantity.Sign() != remaining.Sign() {
+			continue
+		}
+		r := *l
+		if remaining.Abs().LessThan(l.Quantity.Abs()) {
+			r = l.scale(remaining.Div(l.Quantity))
+		}
+		l.Quantity, l.Cost = l.Quantity.Sub(r.Quantity), l.Cost.Sub(r.Cost)
+		removed = append(removed, r)
+		remaining = remaining.Sub(r.Quantity)
+	}
+	return removed, remaining
+}
+
+func matches(l Lot, match *journal.Lot) bool {
+	if match.Label == "" && match.Date.IsZero() {
+		return false
+	}
+	return (match.Label == "" || match.Label == l.Label) && (match.Date.IsZero() || match.Date.Equal(l.Date))
+}
+
+// scale scales the quantities of the lots to the given total quantity,
+// keeping their cost.
+func scale(lots []Lot, quantity decimal.Decimal) []Lot {
+	var total decimal.Decimal
+	for _, l := range lots {
+		total = total.Add(l.Quantity)
+	}
+	if total.IsZero() {
+		return nil
+	}
+	res := make([]Lot, 0, len(lots))
+	for _, l := range lots {
+		l.Quantity = l.Quantity.Mul(quantity).Div(total)
+		res = append(res, l)
+	}
+	return res
+}
+
+// take removes lots with the given total quantity from the front of
+// lots. It returns the taken lots, the remaining lots and the quantity
+// which could not be taken.
+func take(lots []Lot, quantity decimal.Decimal) ([]Lot, []Lot, decimal.Decimal) {
+	var res []Lot
+	for len(lots) > 0 && !quantity.IsZero() && lots[0].Quantity.Sign() == quantity.Sign() {
+		l := lots[0]
+		if quantity.Abs().LessThan(l.Quantity.Abs()) {
+			l = l.scale(quantity.Div(l.Quantity))
+			lots[0].Quantity, lots[0].Cost = lots[0].Quantity.Sub(l.Quantity), lots[0].Cost.Sub(l.Cost)
+		} else {
+			lots = lots[1:]
+		}
+		res = append(res, l)
+		quantity = quantity.Sub(l.Quantity)
+	}
+	return res, lots, quantity
+}
+
+// Tracker tracks the lots of all asset and liability accounts.
+//
+// An acquisition is booked as a new lot at the price of its lot
+// annotation, if the posting has one, or otherwise at its value at the
+// time of the booking. Reductions remove lots according to the method.
+// Transfers between asset and liability accounts carry over the lots with
+// their dates and cost basis, as do renames of commodities. Splits change
+// the quantities of the lots, but not their cost basis. Renames and splits
+// are recognized by the directives their transactions were generated for;
+// other bookings against the valuation account, such as value
+// adjustments, are booked like any other acquisition or reduction. Other
+// reductions are disposals, which realize the difference between the
+// value of the reduction and the cost basis of the removed lots.
+type Tracker struct {
+	jctx      journal.Context
+	valuation *journal.Commodity
+	method    Method
+	gains     *journal.Account
+
+	inventories map[journal.Key]*Inventory
+	disposals   []Disposal
+}
+
+// New creates a new tracker, which values lots in v and reduces them
+// with the given method.
+func New(jctx journal.Context, v *journal.Commodity, m Method) *Tracker {
+	return &Tracker{
+		jctx:        jctx,
+		valuation:   v,
+		method:      m,
+		inventories: make(map[journal.Key]*Inventory),
+	}
+}
+
+// BookGains books the realized gain of each disposal to the given
+// account, moving it from the valuation account of the disposing account.
+// It requires a valuation commodity.
+func (t *Tracker) BookGains(a *journal.Account) {
+	t.gains = a
+}
+
+// Process processes a day. It must run after Balance.
+func (t *Tracker) Process(d *journal.Day) error {
+	var disposals []Disposal
+	for _, trx := range d.Transactions {
+		// Reductions are booked first, such that the lots removed from a
+		// position can be carried over to the receiving position.
+		origin := d.Origins[trx]
+		if _, ok := origin.(*journal.Split); ok {
+			for _, p := range trx.Postings {
+				if p.Account.IsAL() {
+					inv := t.Inventory(p.Account, p.Commodity)
+					inv.Lots = scale(inv.Lots, inv.Quantity().Add(p.Amount))
+				}
+			}
+			continue
+		}
+		_, rename := origin.(*journal.Rename)
+		var (
+			transfers = make(map[journal.Key][]Lot)
+			renames   = make(map[*journal.Account][]Lot)
+			reduced   = make([]bool, len(trx.Postings))
+		)
+		for i, p := range trx.Postings {
+			if !p.Account.IsAL() {
+				continue
+			}
+			inv := t.Inventory(p.Account, p.Commodity)
+			qty := inv.Quantity()
+			if qty.IsZero() || p.Amount.IsZero() || qty.Sign() == p.Amount.Sign() {
+				continue
+			}
+			reduced[i] = true
+			removed, rest := inv.Reduce(p.Amount, t.method, p.Lot)
+			if !rest.IsZero() {
+				cost, err := t.cost(d, p)
+				if err != nil {
+					return err
+				}
+				inv.Add(Lot{Date: d.Date, Quantity: rest, Cost: cost.Mul(rest).Div(p.Amount)})
+			}
+			switch {
+			case rename:
+				renames[p.Account] = append(renames[p.Account], removed...)
+			case p.Other.IsAL():
+				k := journal.Key{Account: p.Other, Other: p.Account, Commodity: p.Commodity}
+				transfers[k] = append(transfers[k], removed...)
+			case t.valuation != nil && p.Commodity != t.valuation:
+				for _, l := range removed {
+					disposals = append(disposals, Disposal{
+						Date:      d.Date,
+						Account:   p.Account,
+						Commodity: p.Commodity,
+						Lot:       l,
+						Proceeds:  p.Value.Mul(l.Quantity).Div(p.Amount),
+					})
+				}
+			}
+		}
+		for i, p := range trx.Postings {
+			if !p.Account.IsAL() || reduced[i] || p.Amount.IsZero() {
+				continue
+			}
+			inv := t.Inventory(p.Account, p.Commodity)
+			if rename {
+				for _, l := range scale(renames[p.Account], p.Amount) {
+					inv.Add(l)
+				}
+				delete(renames, p.Account)
+				continue
+			}
+			amount := p.Amount
+			if p.Other.IsAL() {
+				k := journal.Key{Account: p.Account, Other: p.Other, Commodity: p.Commodity}
+				var lots []Lot
+				lots, transfers[k], amount = take(transfers[k], amount)
+				for _, l := range lots {
+					inv.Add(l)
+				}
+				if amount.IsZero() {
+					continue
+				}
+			}
+			cost, err := t.cost(d, p)
+			if err != nil {
+				return err
+			}
+			l := Lot{Date: d.Date, Quantity: amount, Cost: cost.Mul(amount).Div(p.Amount)}
+			if p.Lot != nil {
+				if !p.Lot.Date.IsZero() {
+					l.Date = p.Lot.Date
+				}
+				l.Label = p.Lot.Label
+			}
+			inv.Add(l)
+		}
+	}
+	t.disposals = append(t.disposals, disposals...)
+	if t.gains != nil {
+		t.bookGains(d, disposals)
+	}
+	return nil
+}
+
+// bookGains books the realized gains of the disposals of a day.
+func (t *Tracker) bookGains(d *journal.Day, disposals []Disposal) {
+	gains := make(map[journal.Key]decimal.Decimal)
+	for _, dsp := range disposals {
+		k := journal.AccountCommodityKey(dsp.Account, dsp.Commodity)
+		gains[k] = gains[k].Add(dsp.Gain())
+	}
+	keys := dict.SortedKeys(gains, func(k1, k2 journal.Key) compare.Order {
+		if o := journal.CompareAccounts(k1.Account, k2.Account); o != compare.Equal {
+			return o
+		}
+		return journal.CompareCommodities(k1.Commodity, k2.Commodity)
+	})
+	for _, k := range keys {
+		if gains[k].IsZero() {
+			continue
+		}
+		d.Transactions = append(d.Transactions, journal.TransactionBuilder{
+			Date:        d.Date,
+			Description: fmt.Sprintf("Realize gain of %s in %s", k.Commodity.Name(), k.Account.Name()),
+			Postings: journal.PostingBuilder{
+				Credit:    t.gains,
+				Debit:     t.jctx.ValuationAccountFor(k.Account),
+				Commodity: k.Commodity,
+				Value:     gains[k],
+			}.Build(),
+		}.Build())
+	}
+}
+
+// Disposals returns the disposals.
+func (t *Tracker) Disposals() []Disposal {
+	return t.disposals
+}
+
+// cost returns the acquisition cost of the posting in the valuation
+// commodity.
+func (t *Tracker) cost(d *journal.Day, p *journal.Posting) (decimal.Decimal, error) {
+	if p.Lot == nil || p.Lot.Commodity == nil {
+		return p.Value, nil
+	}
+	cost := p.Amount.Mul(decimal.NewFromFloat(p.Lot.Price))
+	if p.Lot.Commodity == t.valuation || t.valuation == nil {
+		return cost, nil
+	}
+	v, err := d.Normalized.Valuate(p.Lot.Commodity, cost)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("valuating lot of %s in %s: %w", p.Commodity.Name(), p.Account.Name(), err)
+	}
+	return v, nil
+}
+
+// Inventory returns the inventory of the given account and commodity.
+func (t *Tracker) Inventory(a *journal.Account, c *journal.Commodity) *Inventory {
+	return dict.GetDefault(t.inventories, journal.AccountCommodityKey(a, c), func() *Inventory {
+		return &Inventory{Account: a, Commodity: c}
+	})
+}
+
+// Inventories returns the nonempty inventories, sorted by account and
+// commodity.
+func (t *Tracker) Inventories() []*Inventory {
+	var res []*Inventory
+	for _, inv := range t.inventories {
+		if len(inv.Lots) > 0 {
+			res = append(res, inv)
+		}
+	}
+	compare.Sort(res, func(i1, i2 *Inventory) compare.Order {
+		if o := journal.CompareAccounts(i1.Account, i2.Account); o != compare.Equal {
+			return o
+		}
+		return journal.CompareCommodities(i1.Commodity, i2.Commodity)
+	})
+	return res
+}
+
+// RenderDisposals renders the disposals with the acquisition date of the
+// disposed lots, their cost basis, the proceeds and the realized gain,
+// followed by the totals.
+func RenderDisposals(disposals []Disposal) *table.Table {
+	tbl := table.New(1, 1, 1, 1, 1, 1, 1, 1)
+	tbl.AddSeparatorRow()
+	tbl.AddHeaderRow().
+		AddText("Date", table.Center).
+		AddText("Account", table.Center).
+		AddText("Comm", table.Center).
+		AddText("Acquired", table.Center).
+		AddText("Quantity", table.Center).
+		AddText("Cost", table.Center).
+		AddText("Proceeds", table.Center).
+		AddText("Gain", table.Center)
+	tbl.AddSeparatorRow()
+	var cost, proceeds decimal.Decimal
+	for _, d := range disposals {
+		acquired := d.Lot.Date.Format("2006-01-02")
+		if d.Lot.Label != "" {
+			acquired += " " + d.Lot.Label
+		}
+		tbl.AddRow().
+			AddText(d.Date.Format("2006-01-02"), table.Left).
+			AddText(d.Account.Name(), table.Left).
+			AddText(d.Commodity.Name(), table.Left).
+			AddText(acquired, table.Left).
+			AddNumber(d.Lot.Quantity).
+			AddNumber(d.Lot.Cost).
+			AddNumber(d.Proceeds).
+			AddNumber(d.Gain())
+		cost, proceeds = cost.Add(d.Lot.Cost), proceeds.Add(d.Proceeds)
+	}
+	tbl.AddSeparatorRow()
+	tbl.AddRow().
+		AddText("Total", table.Left).
+		AddEmpty().
+		AddEmpty().
+		AddEmpty().
+		AddEmpty().
+		AddNumber(cost).
+		AddNumber(proceeds).
+		AddNumber(proceeds.Sub(cost))
+	tbl.AddSeparatorRow()
+	return tbl
+}
@@ -0,0 +1,326 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func inventory() *Inventory {
+	inv := new(Inventory)
+	inv.Add(Lot{Date: date.Date(2020, 2, 1), Label: "b", Quantity: decimal.NewFromInt(10), Cost: decimal.NewFromInt(200)})
+	inv.Add(Lot{Date: date.Date(2020, 1, 1), Label: "a", Quantity: decimal.NewFromInt(10), Cost: decimal.NewFromInt(100)})
+	inv.Add(Lot{Date: date.Date(2020, 3, 1), Label: "c", Quantity: decimal.NewFromInt(10), Cost: decimal.NewFromInt(300)})
+	return inv
+}
+
+func lot(d time.Time, label string, qty, cost int64) Lot {
+	return Lot{Date: d, Label: label, Quantity: decimal.NewFromInt(qty), Cost: decimal.NewFromInt(cost)}
+}
+
+func TestReduce(t *testing.T) {
+	tests := []struct {
+		desc                 string
+		method               Method
+		amount               int64
+		match                *journal.Lot
+		wantRemoved, wantInv []Lot
+		wantRest             int64
+	}{
+		{
+			desc:        "fifo",
+			method:      FIFO,
+			amount:      -15,
+			wantRemoved: []Lot{lot(date.Date(2020, 1, 1), "a", 10, 100), lot(date.Date(2020, 2, 1), "b", 5, 100)},
+			wantInv:     []Lot{lot(date.Date(2020, 2, 1), "b", 5, 100), lot(date.Date(2020, 3, 1), "c", 10, 300)},
+		},
+		{
+			desc:        "lifo",
+			method:      LIFO,
+			amount:      -15,
+			wantRemoved: []Lot{lot(date.Date(2020, 3, 1), "c", 10, 300), lot(date.Date(2020, 2, 1), "b", 5, 100)},
+			wantInv:     []Lot{lot(date.Date(2020, 1, 1), "a", 10, 100), lot(date.Date(2020, 2, 1), "b", 5, 100)},
+		},
+		{
+			desc:        "average",
+			method:      Average,
+			amount:      -15,
+			wantRemoved: []Lot{lot(date.Date(2020, 1, 1), "a", 5, 50), lot(date.Date(2020, 2, 1), "b", 5, 100), lot(date.Date(2020, 3, 1), "c", 5, 150)},
+			wantInv:     []Lot{lot(date.Date(2020, 1, 1), "a", 5, 50), lot(date.Date(2020, 2, 1), "b", 5, 100), lot(date.Date(2020, 3, 1), "c", 5, 150)},
+		},
+		{
+			desc:        "matching label first",
+			method:      FIFO,
+			amount:      -15,
+			match:       &journal.Lot{Label: "c"},
+			wantRemoved: []Lot{lot(date.Date(2020, 3, 1), "c", 10, 300), lot(date.Date(2020, 1, 1), "a", 5, 50)},
+			wantInv:     []Lot{lot(date.Date(2020, 1, 1), "a", 5, 50), lot(date.Date(2020, 2, 1), "b", 10, 200)},
+		},
+		{
+			desc:        "reversal",
+			method:      FIFO,
+			amount:      -35,
+			wantRemoved: []Lot{lot(date.Date(2020, 1, 1), "a", 10, 100), lot(date.Date(2020, 2, 1), "b", 10, 200), lot(date.Date(2020, 3, 1), "c", 10, 300)},
+			wantRest:    -5,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			inv := inventory()
+
+			removed, rest := inv.Reduce(decimal.NewFromInt(test.amount), test.method, test.match)
+
+			if diff := cmp.Diff(test.wantRemoved, removed, cmp.Comparer(func(a, b decimal.Decimal) bool { return a.Equal(b) })); diff != "" {
+				t.Errorf("Reduce() returned unexpected lots (-want/+got):\n%s", diff)
+			}
+			if !rest.Equal(decimal.NewFromInt(test.wantRest)) {
+				t.Errorf("Reduce() returned rest %s, want %d", rest, test.wantRest)
+			}
+			if diff := cmp.Diff(test.wantInv, inv.Lots, cmp.Comparer(func(a, b decimal.Decimal) bool { return a.Equal(b) })); diff != "" {
+				t.Errorf("Reduce() left unexpected lots (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTrackerSplit(t *testing.T) {
+	var (
+		jctx      = journal.NewContext()
+		equity    = jctx.Account("Equity:Equity")
+		portfolio = jctx.Account("Assets:Portfolio")
+		chf       = jctx.Commodity("CHF")
+		abc       = jctx.Commodity("ABC")
+		j         = journal.New(jctx)
+	)
+	for _, a := range []*journal.Account{equity, portfolio} {
+		j.AddOpen(&journal.Open{Date: date.Date(2020, 1, 1), Account: a})
+	}
+	j.AddPrice(&journal.Price{Date: date.Date(2020, 1, 1), Commodity: abc, Target: chf, Price: decimal.NewFromInt(10)})
+	for _, d := range []time.Time{date.Date(2020, 1, 2), date.Date(2020, 1, 3)} {
+		j.AddTransaction(journal.TransactionBuilder{
+			Date:        d,
+			Description: "Buy",
+			Postings: journal.PostingBuilder{
+				Credit:    equity,
+				Debit:     portfolio,
+				Commodity: abc,
+				Amount:    decimal.NewFromInt(10),
+			}.Build(),
+		}.Build())
+	}
+	j.AddSplit(&journal.Split{Date: date.Date(2020, 2, 1), Commodity: abc, Numerator: decimal.NewFromInt(2), Denominator: decimal.NewFromInt(1)})
+	tr := New(jctx, chf, FIFO)
+
+	if _, err := j.Process(journal.ComputePrices(chf), journal.Balance(jctx, chf), tr.Process); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	got := tr.Inventory(portfolio, abc).Lots
+
+	want := []Lot{lot(date.Date(2020, 1, 2), "", 20, 100), lot(date.Date(2020, 1, 3), "", 20, 100)}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b decimal.Decimal) bool { return a.Equal(b) })); diff != "" {
+		t.Errorf("Inventory() returned unexpected lots (-want/+got):\n%s", diff)
+	}
+}
+
+func TestTrackerValuationAdjustment(t *testing.T) {
+	tests := []struct {
+		desc string
+		add  func(j *journal.Journal, portfolio, valuation *journal.Account, abc *journal.Commodity)
+	}{
+		{
+			desc: "value directive",
+			add: func(j *journal.Journal, portfolio, _ *journal.Account, abc *journal.Commodity) {
+				j.AddValue(&journal.Value{Date: date.Date(2020, 2, 1), Account: portfolio, Amount: decimal.NewFromInt(25), Commodity: abc})
+			},
+		},
+		{
+			desc: "booking against the valuation account",
+			add: func(j *journal.Journal, portfolio, valuation *journal.Account, abc *journal.Commodity) {
+				j.AddTransaction(journal.TransactionBuilder{
+					Date:        date.Date(2020, 2, 1),
+					Description: "Adjustment",
+					Postings: journal.PostingBuilder{
+						Credit:    valuation,
+						Debit:     portfolio,
+						Commodity: abc,
+						Amount:    decimal.NewFromInt(5),
+					}.Build(),
+				}.Build())
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var (
+				jctx      = journal.NewContext()
+				equity    = jctx.Account("Equity:Equity")
+				portfolio = jctx.Account("Assets:Portfolio")
+				valuation = jctx.ValuationAccountFor(portfolio)
+				chf       = jctx.Commodity("CHF")
+				abc       = jctx.Commodity("ABC")
+				j         = journal.New(jctx)
+			)
+			for _, a := range []*journal.Account{equity, portfolio, valuation} {
+				j.AddOpen(&journal.Open{Date: date.Date(2020, 1, 1), Account: a})
+			}
+			j.AddPrice(&journal.Price{Date: date.Date(2020, 1, 1), Commodity: abc, Target: chf, Price: decimal.NewFromInt(10)})
+			for _, d := range []time.Time{date.Date(2020, 1, 2), date.Date(2020, 1, 3)} {
+				j.AddTransaction(journal.TransactionBuilder{
+					Date:        d,
+					Description: "Buy",
+					Postings: journal.PostingBuilder{
+						Credit:    equity,
+						Debit:     portfolio,
+						Commodity: abc,
+						Amount:    decimal.NewFromInt(10),
+					}.Build(),
+				}.Build())
+			}
+			test.add(j, portfolio, valuation, abc)
+			tr := New(jctx, chf, FIFO)
+
+			if _, err := j.Process(journal.ComputePrices(chf), journal.Balance(jctx, chf), tr.Process); err != nil {
+				t.Fatalf("Process() returned unexpected error: %v", err)
+			}
+			got := tr.Inventory(portfolio, abc).Lots
+
+			want := []Lot{
+				lot(date.Date(2020, 1, 2), "", 10, 100),
+				lot(date.Date(2020, 1, 3), "", 10, 100),
+				lot(date.Date(2020, 2, 1), "", 5, 50),
+			}
+			if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b decimal.Decimal) bool { return a.Equal(b) })); diff != "" {
+				t.Errorf("Inventory() returned unexpected lots (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTrackerRename(t *testing.T) {
+	var (
+		jctx      = journal.NewContext()
+		equity    = jctx.Account("Equity:Equity")
+		portfolio = jctx.Account("Assets:Portfolio")
+		chf       = jctx.Commodity("CHF")
+		abc       = jctx.Commodity("ABC")
+		xyz       = jctx.Commodity("XYZ")
+		j         = journal.New(jctx)
+	)
+	for _, a := range []*journal.Account{equity, portfolio} {
+		j.AddOpen(&journal.Open{Date: date.Date(2020, 1, 1), Account: a})
+	}
+	j.AddPrice(&journal.Price{Date: date.Date(2020, 1, 1), Commodity: abc, Target: chf, Price: decimal.NewFromInt(10)})
+	j.AddPrice(&journal.Price{Date: date.Date(2020, 2, 1), Commodity: xyz, Target: chf, Price: decimal.NewFromInt(5)})
+	j.AddTransaction(journal.TransactionBuilder{
+		Date:        date.Date(2020, 1, 2),
+		Description: "Buy",
+		Postings: journal.PostingBuilder{
+			Credit:    equity,
+			Debit:     portfolio,
+			Commodity: abc,
+			Amount:    decimal.NewFromInt(10),
+		}.Build(),
+	}.Build())
+	j.AddRename(&journal.Rename{Date: date.Date(2020, 2, 1), Commodity: abc, Target: xyz, Ratio: decimal.NewFromInt(2)})
+	tr := New(jctx, chf, FIFO)
+
+	if _, err := j.Process(journal.ComputePrices(chf), journal.Balance(jctx, chf), tr.Process); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+
+	if got := tr.Inventory(portfolio, abc).Lots; len(got) != 0 {
+		t.Errorf("Inventory() returned lots %v for the renamed commodity, want none", got)
+	}
+	want := []Lot{lot(date.Date(2020, 1, 2), "", 20, 100)}
+	if diff := cmp.Diff(want, tr.Inventory(portfolio, xyz).Lots, cmp.Comparer(func(a, b decimal.Decimal) bool { return a.Equal(b) })); diff != "" {
+		t.Errorf("Inventory() returned unexpected lots (-want/+got):\n%s", diff)
+	}
+	if got := tr.Disposals(); len(got) != 0 {
+		t.Errorf("Disposals() returned %v, want none", got)
+	}
+}
+
+func TestTrackerBookGains(t *testing.T) {
+	var (
+		jctx      = journal.NewContext()
+		equity    = jctx.Account("Equity:Equity")
+		portfolio = jctx.Account("Assets:Portfolio")
+		gains     = jctx.Account("Income:CapitalGains")
+		chf       = jctx.Commodity("CHF")
+		abc       = jctx.Commodity("ABC")
+		j         = journal.New(jctx)
+	)
+	for _, a := range []*journal.Account{equity, portfolio} {
+		j.AddOpen(&journal.Open{Date: date.Date(2020, 1, 1), Account: a})
+	}
+	j.AddPrice(&journal.Price{Date: date.Date(2020, 1, 1), Commodity: abc, Target: chf, Price: decimal.NewFromInt(10)})
+	j.AddPrice(&journal.Price{Date: date.Date(2020, 2, 1), Commodity: abc, Target: chf, Price: decimal.NewFromInt(15)})
+	for _, b := range []struct {
+		date   time.Time
+		amount int64
+	}{{date.Date(2020, 1, 2), 10}, {date.Date(2020, 2, 2), 10}, {date.Date(2020, 3, 1), -15}} {
+		credit, debit := equity, portfolio
+		if b.amount < 0 {
+			credit, debit = portfolio, equity
+		}
+		j.AddTransaction(journal.TransactionBuilder{
+			Date:        b.date,
+			Description: "Trade",
+			Postings: journal.PostingBuilder{
+				Credit:    credit,
+				Debit:     debit,
+				Commodity: abc,
+				Amount:    decimal.NewFromInt(b.amount).Abs(),
+			}.Build(),
+		}.Build())
+	}
+	tr := New(jctx, chf, FIFO)
+	tr.BookGains(gains)
+	var booked decimal.Decimal
+	book := func(d *journal.Day) error {
+		for _, trx := range d.Transactions {
+			for _, p := range trx.Postings {
+				if p.Account == gains {
+					booked = booked.Add(p.Value)
+				}
+			}
+		}
+		return nil
+	}
+
+	if _, err := j.Process(journal.ComputePrices(chf), journal.Balance(jctx, chf), tr.Process, book); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	got := tr.Disposals()
+
+	want := []Disposal{
+		{Date: date.Date(2020, 3, 1), Account: portfolio, Commodity: abc, Lot: lot(date.Date(2020, 1, 2), "", 10, 100), Proceeds: decimal.NewFromInt(150)},
+		{Date: date.Date(2020, 3, 1), Account: portfolio, Commodity: abc, Lot: lot(date.Date(2020, 2, 2), "", 5, 75), Proceeds: decimal.NewFromInt(75)},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b decimal.Decimal) bool { return a.Equal(b) }), cmp.Comparer(func(a, b *journal.Account) bool { return a == b }), cmp.Comparer(func(a, b *journal.Commodity) bool { return a == b })); diff != "" {
+		t.Errorf("Disposals() returned unexpected disposals (-want/+got):\n%s", diff)
+	}
+	if !booked.Equal(decimal.NewFromInt(-50)) {
+		t.Errorf("booked gains %s, want -50", booked)
+	}
+}
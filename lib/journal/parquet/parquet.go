@@ -0,0 +1,105 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package parquet writes postings as Parquet files.
+package parquet
+
+import (
+	"io"
+	"time"
+
+	"github.com/xitongsys/parquet-go/writer"
+
+	"github.com/sboehler/knut/lib/common/filter"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+// Posting is a row of the Parquet file. Dates are stored as days since
+// 1970-01-01, and amounts and values as doubles.
+type Posting struct {
+	Date        int32    `parquet:"name=date, type=DATE"`
+	Account     string   `parquet:"name=account, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	Other       string   `parquet:"name=other, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	Commodity   string   `parquet:"name=commodity, type=UTF8, encoding=PLAIN_DICTIONARY"`
+	Amount      float64  `parquet:"name=amount, type=DOUBLE"`
+	Value       *float64 `parquet:"name=value, type=DOUBLE, repetitiontype=OPTIONAL"`
+	Description string   `parquet:"name=description, type=UTF8"`
+	Tags        string   `parquet:"name=tags, type=UTF8"`
+}
+
+// Writer writes postings into a Parquet file.
+type Writer struct {
+	pw *writer.ParquetWriter
+}
+
+// NewWriter creates a new writer.
+func NewWriter(w io.Writer) (*Writer, error) {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(Posting), 1)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{pw: pw}, nil
+}
+
+// Write returns a processor which writes the postings matching the filter.
+// The value column is null if v is nil.
+func (w *Writer) Write(f filter.Filter[journal.Key], v *journal.Commodity) journal.DayFn {
+	if f == nil {
+		f = filter.AllowAll[journal.Key]
+	}
+	return func(d *journal.Day) error {
+		date := int32(d.Date.Unix() / int64(24*time.Hour/time.Second))
+		for _, t := range d.Transactions {
+			for _, p := range t.Postings {
+				k := journal.Key{
+					Date:        t.Date,
+					Account:     p.Account,
+					Other:       p.Other,
+					Commodity:   p.Commodity,
+					Valuation:   v,
+					Description: t.Description,
+					Member:      t.Member(),
+					Tags:        t.PostingTags(p),
+				}
+				if !f(k) {
+					continue
+				}
+				amount, _ := p.Amount.Float64()
+				row := Posting{
+					Date:        date,
+					Account:     p.Account.Name(),
+					Other:       p.Other.Name(),
+					Commodity:   p.Commodity.Name(),
+					Amount:      amount,
+					Description: t.Description,
+					Tags:        k.Tags,
+				}
+				if v != nil {
+					value, _ := p.Value.Float64()
+					row.Value = &value
+				}
+				if err := w.pw.Write(row); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// Close writes the footer of the file. It does not close the underlying
+// writer.
+func (w *Writer) Close() error {
+	return w.pw.WriteStop()
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parquet
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.knut")
+	if err := os.WriteFile(path, []byte(`2020-01-01 open Equity:Equity
+2020-01-01 open Assets:Bank
+
+2020-01-01 price USD 0.5 CHF
+
+2020-01-02 "Deposit" #work
+Equity:Equity Assets:Bank 100 USD
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	jctx := journal.NewContext()
+	chf := jctx.Commodity("CHF")
+	j, err := journal.FromPath(context.Background(), jctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := j.Process(journal.ComputePrices(chf), journal.Balance(jctx, chf), journal.Sort(), w.Write(nil, chf)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := reader.NewParquetReader(&file{bytes.NewReader(buf.Bytes())}, new(Posting), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.ReadStop()
+	got := make([]Posting, r.GetNumRows())
+	if err := r.Read(&got); err != nil {
+		t.Fatal(err)
+	}
+	minus50, plus50 := -50.0, 50.0
+	want := []Posting{
+		{Date: 18263, Account: "Equity:Equity", Other: "Assets:Bank", Commodity: "USD", Amount: -100, Value: &minus50, Description: "Deposit", Tags: "#work"},
+		{Date: 18263, Account: "Assets:Bank", Other: "Equity:Equity", Commodity: "USD", Amount: 100, Value: &plus50, Description: "Deposit", Tags: "#work"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected rows (-want/+got):\n%s", diff)
+	}
+}
+
+// file is a read-only source.ParquetFile in memory.
+type file struct {
+	*bytes.Reader
+}
+
+func (f *file) Write([]byte) (int, error) { return 0, os.ErrPermission }
+
+func (f *file) Close() error { return nil }
+
+func (f *file) Open(string) (source.ParquetFile, error) {
+	return &file{bytes.NewReader(readAll(f.Reader))}, nil
+}
+
+func (f *file) Create(string) (source.ParquetFile, error) { return nil, os.ErrPermission }
+
+func readAll(r *bytes.Reader) []byte {
+	b := make([]byte, r.Size())
+	r.ReadAt(b, 0)
+	return b
+}
@@ -16,22 +16,25 @@ package journal
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
-	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 	"unicode"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/sboehler/knut/lib/common/cpr"
 	"github.com/sboehler/knut/lib/common/date"
 	"github.com/sboehler/knut/lib/journal/scanner"
 	"github.com/shopspring/decimal"
+	"go.uber.org/multierr"
 )
 
 // Parser parses a journal
@@ -39,6 +42,10 @@ type Parser struct {
 	context  Context
 	scanner  *scanner.Scanner
 	startPos scanner.Location
+
+	// failed is set after an error, done after an error which parsing
+	// cannot recover from.
+	failed, done bool
 }
 
 func (p *Parser) markStart() {
@@ -65,17 +72,62 @@ func newParser(ctx Context, path string, r io.RuneReader) (*Parser, error) {
 	}, nil
 }
 
-// ParserFromPath creates a new parser for the given file.
+// ParserFromPath creates a new parser for the given file. Files ending in
+// .gz or .zst are decompressed transparently.
 func ParserFromPath(ctx Context, path string) (*Parser, func() error, error) {
-	f, err := os.Open(path)
+	return ParserFromSource(ctx, FileSystem{}, path)
+}
+
+// ParserFromSource creates a new parser for the file at the given path in
+// the source. Files ending in .gz or .zst are decompressed transparently.
+func ParserFromSource(ctx Context, src Source, path string) (*Parser, func() error, error) {
+	r, cls, err := open(src, path)
 	if err != nil {
 		return nil, nil, err
 	}
-	p, err := newParser(ctx, path, bufio.NewReader(f))
+	p, err := newParser(ctx, path, bufio.NewReader(r))
+	if err != nil {
+		return nil, nil, multierr.Append(err, cls())
+	}
+	return p, cls, nil
+}
+
+// ParserFromReader creates a new parser for the contents of r, which are
+// attributed to the given path.
+func ParserFromReader(ctx Context, r io.Reader, path string) (*Parser, error) {
+	return newParser(ctx, path, bufio.NewReader(r))
+}
+
+// IsCompressed returns whether the file is decompressed when it is parsed.
+func IsCompressed(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".zst":
+		return true
+	}
+	return false
+}
+
+// open opens the file, decompressing it depending on its extension.
+func open(src Source, path string) (io.Reader, func() error, error) {
+	f, err := src.Open(path)
 	if err != nil {
 		return nil, nil, err
 	}
-	return p, f.Close, nil
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, nil, multierr.Append(fmt.Errorf("%s: %w", path, err), f.Close())
+		}
+		return r, func() error { return multierr.Append(r.Close(), f.Close()) }, nil
+	case ".zst":
+		r, err := zstd.NewReader(f)
+		if err != nil {
+			return nil, nil, multierr.Append(fmt.Errorf("%s: %w", path, err), f.Close())
+		}
+		return r, func() error { r.Close(); return f.Close() }, nil
+	}
+	return f, f.Close, nil
 }
 
 // current returns the current rune.
@@ -83,14 +135,52 @@ func (p *Parser) current() rune {
 	return p.scanner.Current()
 }
 
-// Next returns the Next directive
+// Next returns the next directive. It returns io.EOF at the end of the
+// input. After a syntax error, the next call resumes parsing at the next
+// directive, such that all syntax errors of a file can be reported.
 func (p *Parser) Next() (Directive, error) {
+	if p.done {
+		return nil, io.EOF
+	}
+	if p.failed {
+		p.failed = false
+		if err := p.skipDirective(); err != nil {
+			p.done = true
+			return nil, err
+		}
+	}
+	d, err := p.next()
+	if err != nil && err != io.EOF {
+		p.failed = true
+	}
+	return d, err
+}
+
+// skipDirective skips the rest of the current line and all following
+// lines up to the start of the next directive, which is a line starting
+// with a date, an add-on or a comment, or an empty line.
+func (p *Parser) skipDirective() error {
+	for p.current() != scanner.EOF {
+		if err := p.scanner.ConsumeUntil(isNewlineOrEOF); err != nil {
+			return err
+		}
+		if err := p.consumeNewline(); err != nil {
+			return err
+		}
+		if ch := p.current(); unicode.IsDigit(ch) || isNewline(ch) || ch == '@' || isCommentStart(ch) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *Parser) next() (Directive, error) {
 	for p.current() != scanner.EOF {
 		if err := p.scanner.ConsumeWhile(isWhitespaceOrNewline); err != nil {
 			return nil, p.scanner.ParseError(err)
 		}
 		switch {
-		case p.current() == '*' || p.current() == '#':
+		case isCommentStart(p.current()):
 			if err := p.consumeComment(); err != nil {
 				return nil, p.scanner.ParseError(err)
 			}
@@ -110,12 +200,24 @@ func (p *Parser) Next() (Directive, error) {
 				return nil, p.scanner.ParseError(err)
 			}
 			return i, nil
+		case p.current() == 'r':
+			r, err := p.parseRates()
+			if err != nil {
+				return nil, p.scanner.ParseError(err)
+			}
+			return r, nil
 		case p.current() == 'c':
-			c, err := p.parseCurrency()
+			c, err := p.parseDeclaration()
 			if err != nil {
 				return nil, p.scanner.ParseError(err)
 			}
 			return c, nil
+		case p.current() == 'o':
+			o, err := p.parseOption()
+			if err != nil {
+				return nil, p.scanner.ParseError(err)
+			}
+			return o, nil
 		case unicode.IsDigit(p.current()):
 			d, err := p.parseDirective(nil)
 			if err != nil {
@@ -150,8 +252,10 @@ func (p *Parser) parseDirective(a *Accrual) (Directive, error) {
 	}
 	var result Directive
 	switch p.current() {
-	case '"':
+	case '"', rune(Cleared), rune(Pending):
 		result, err = p.parseTransaction(d, a)
+	case 'a':
+		result, err = p.parseAuto(d)
 	case 'o':
 		result, err = p.parseOpen(d)
 	case 'c':
@@ -159,9 +263,35 @@ func (p *Parser) parseDirective(a *Accrual) (Directive, error) {
 	case 'p':
 		result, err = p.parsePrice(d)
 	case 'b':
-		result, err = p.parseBalanceAssertion(d)
+		var keyword string
+		if keyword, err = p.scanner.ReadWhile(unicode.IsLetter); err != nil {
+			return nil, err
+		}
+		switch keyword {
+		case "balance":
+			result, err = p.parseBalanceAssertion(d)
+		case "budget":
+			result, err = p.parseBudget(d)
+		default:
+			return nil, fmt.Errorf("expected \"balance\" or \"budget\", got %q", keyword)
+		}
 	case 'v':
-		result, err = p.parseValue(d)
+		var keyword string
+		if keyword, err = p.scanner.ReadWhile(unicode.IsLetter); err != nil {
+			return nil, err
+		}
+		switch keyword {
+		case "valuation":
+			result, err = p.parseValuation(d)
+		case "value":
+			result, err = p.parseValue(d)
+		default:
+			return nil, fmt.Errorf("expected \"valuation\" or \"value\", got %q", keyword)
+		}
+	case 'r':
+		result, err = p.parseRename(d)
+	case 's':
+		result, err = p.parseSplit(d)
 	default:
 		return nil, fmt.Errorf("expected directive, got %q", p.current())
 	}
@@ -172,22 +302,36 @@ func (p *Parser) parseDirective(a *Accrual) (Directive, error) {
 }
 
 func (p *Parser) parseTransaction(d time.Time, a *Accrual) (*Transaction, error) {
-	desc, err := p.parseQuotedString()
+	var flag Flag
+	if p.current() == rune(Cleared) || p.current() == rune(Pending) {
+		flag = Flag(p.current())
+		if err := p.scanner.Advance(); err != nil {
+			return nil, err
+		}
+		if err := p.consumeWhitespace1(); err != nil {
+			return nil, err
+		}
+	}
+	desc, more, err := p.parseDescription()
 	if err != nil {
 		return nil, err
 	}
-
-	if err := p.consumeWhitespace1(); err != nil {
-		return nil, err
+	var (
+		tags  []Tag
+		links []Link
+	)
+	if more {
+		if tags, links, err = p.parseTagsAndLinks(); err != nil {
+			return nil, err
+		}
+		if err := p.consumeRestOfWhitespaceLine(); err != nil {
+			return nil, err
+		}
 	}
-
-	tags, err := p.parseTags()
+	metadata, err := p.parseMetadata()
 	if err != nil {
 		return nil, err
 	}
-	if err := p.consumeRestOfWhitespaceLine(); err != nil {
-		return nil, err
-	}
 	postings, err := p.parsePostings()
 	if err != nil {
 		return nil, err
@@ -199,20 +343,63 @@ func (p *Parser) parseTransaction(d time.Time, a *Accrual) (*Transaction, error)
 	return TransactionBuilder{
 		Range:       r,
 		Date:        d,
+		Flag:        flag,
 		Description: desc,
 		Tags:        tags,
+		Links:       links,
+		Metadata:    metadata,
 		Postings:    postings,
 		Accrual:     a,
 	}.Build(), nil
 
 }
 
+// parseDescription parses the description of a transaction. A description
+// can be continued on the following lines, each indented and holding
+// another quoted string, and its parts are concatenated. It returns
+// whether the line of the last part continues, e.g. with tags, or whether
+// its newline has been consumed.
+func (p *Parser) parseDescription() (string, bool, error) {
+	var b strings.Builder
+	for {
+		s, err := p.parseQuotedString()
+		if err != nil {
+			return "", false, err
+		}
+		b.WriteString(s)
+		if err := p.consumeWhitespace1(); err != nil {
+			return "", false, err
+		}
+		if !isNewline(p.current()) {
+			return b.String(), true, nil
+		}
+		if err := p.consumeNewline(); err != nil {
+			return "", false, err
+		}
+		if !isWhitespace(p.current()) {
+			return b.String(), false, nil
+		}
+		if err := p.scanner.ConsumeWhile(isWhitespace); err != nil {
+			return "", false, err
+		}
+		if isNewlineOrEOF(p.current()) {
+			return b.String(), false, nil
+		}
+	}
+}
+
 func (p *Parser) parseAddOn() (*Accrual, error) {
 	p.markStart()
 	if err := p.scanner.ConsumeRune('@'); err != nil {
 		return nil, err
 	}
-	if err := p.scanner.ParseString("accrue"); err != nil {
+	var reverse bool
+	if p.current() == 'r' {
+		if err := p.scanner.ParseString("reverse-accrual"); err != nil {
+			return nil, err
+		}
+		reverse = true
+	} else if err := p.scanner.ParseString("accrue"); err != nil {
 		return nil, err
 	}
 	if err := p.consumeWhitespace1(); err != nil {
@@ -222,6 +409,9 @@ func (p *Parser) parseAddOn() (*Accrual, error) {
 	if err != nil {
 		return nil, err
 	}
+	if periodStr == "schedule" {
+		return p.parseSchedule(reverse)
+	}
 	var interval date.Interval
 	switch periodStr {
 	case "once":
@@ -237,7 +427,7 @@ func (p *Parser) parseAddOn() (*Accrual, error) {
 	case "yearly":
 		interval = date.Yearly
 	default:
-		return nil, fmt.Errorf("expected \"once\", \"daily\", \"weekly\", \"monthly\", \"quarterly\" or \"yearly\", got %q", periodStr)
+		return nil, fmt.Errorf("expected \"once\", \"daily\", \"weekly\", \"monthly\", \"quarterly\", \"yearly\" or \"schedule\", got %q", periodStr)
 	}
 	if err := p.consumeWhitespace1(); err != nil {
 		return nil, err
@@ -260,19 +450,88 @@ func (p *Parser) parseAddOn() (*Accrual, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err := p.consumeRestOfWhitespaceLine(); err != nil {
-		return nil, err
-	}
-	return &Accrual{
-		Range:    p.getRange(),
+	accrual := &Accrual{
 		Period:   date.Period{Start: dateFrom, End: dateTo},
 		Interval: interval,
 		Account:  account,
-	}, nil
+		Reverse:  reverse,
+	}
+	if err := p.parseWeights(accrual); err != nil {
+		return nil, err
+	}
+	accrual.Range = p.getRange()
+	return accrual, nil
+}
+
+func (p *Parser) parseSchedule(reverse bool) (*Accrual, error) {
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	var dates []time.Time
+	for unicode.IsDigit(p.current()) {
+		d, err := p.parseDate()
+		if err != nil {
+			return nil, err
+		}
+		dates = append(dates, d)
+		if err := p.consumeWhitespace1(); err != nil {
+			return nil, err
+		}
+	}
+	if len(dates) == 0 {
+		return nil, fmt.Errorf("expected a date, got %q", p.current())
+	}
+	account, err := p.parseAccount()
+	if err != nil {
+		return nil, err
+	}
+	accrual := &Accrual{
+		Period:  date.Period{Start: dates[0], End: dates[len(dates)-1]},
+		Account: account,
+		Reverse: reverse,
+		Dates:   dates,
+	}
+	if err := p.parseWeights(accrual); err != nil {
+		return nil, err
+	}
+	accrual.Range = p.getRange()
+	return accrual, nil
+}
+
+// parseWeights parses the optional comma-separated weights of the
+// accrual schedule, and the rest of the line.
+func (p *Parser) parseWeights(a *Accrual) error {
+	if err := p.scanner.ConsumeWhile(isWhitespace); err != nil {
+		return err
+	}
+	for unicode.IsDigit(p.current()) {
+		w, err := p.parseDecimal()
+		if err != nil {
+			return err
+		}
+		if !w.IsPositive() {
+			return fmt.Errorf("weights must be positive, got %s", w)
+		}
+		a.Weights = append(a.Weights, w)
+		if p.current() != ',' {
+			break
+		}
+		if err := p.scanner.ConsumeRune(','); err != nil {
+			return err
+		}
+	}
+	if n := len(a.scheduleDates()); len(a.Weights) > 0 && len(a.Weights) != n {
+		return fmt.Errorf("expected %d weights, got %d", n, len(a.Weights))
+	}
+	return p.consumeRestOfWhitespaceLine()
 }
 
 func (p *Parser) parsePostings() ([]*Posting, error) {
-	var postings PostingBuilders
+	var (
+		postings PostingBuilders
+		omitted  *PostingBuilder
+		index    int
+	)
 	for !unicode.IsSpace(p.current()) && p.current() != scanner.EOF {
 		var (
 			credit, debit *Account
@@ -280,6 +539,8 @@ func (p *Parser) parsePostings() ([]*Posting, error) {
 			commodity     *Commodity
 			targets       []*Commodity
 			lot           *Lot
+			conversion    *Conversion
+			tags          []Tag
 
 			err error
 		)
@@ -295,6 +556,16 @@ func (p *Parser) parsePostings() ([]*Posting, error) {
 		if err = p.consumeWhitespace1(); err != nil {
 			return nil, err
 		}
+		if p.current() == '\n' || p.current() == scanner.EOF || p.current() == '#' || p.current() == ';' {
+			if omitted != nil {
+				return nil, fmt.Errorf("more than one posting with omitted amount")
+			}
+			if omitted, err = p.parseOmitted(credit, debit); err != nil {
+				return nil, err
+			}
+			index = len(postings)
+			continue
+		}
 		if amount, err = p.parseDecimal(); err != nil {
 			return nil, err
 		}
@@ -307,7 +578,7 @@ func (p *Parser) parsePostings() ([]*Posting, error) {
 		if err = p.consumeWhitespace1(); err != nil {
 			return nil, err
 		}
-		for p.current() == '{' || p.current() == '(' {
+		for p.current() == '{' || p.current() == '(' || p.current() == '@' || p.current() == '#' {
 			switch p.current() {
 			case '{':
 				if lot != nil {
@@ -329,23 +600,215 @@ func (p *Parser) parsePostings() ([]*Posting, error) {
 				if err = p.consumeWhitespace1(); err != nil {
 					return nil, err
 				}
+			case '@':
+				if conversion != nil {
+					return nil, fmt.Errorf("duplicate conversion")
+				}
+				if conversion, err = p.parseConversion(amount, commodity); err != nil {
+					return nil, err
+				}
+				if err = p.consumeWhitespace1(); err != nil {
+					return nil, err
+				}
+			case '#':
+				tag, err := p.parseTag()
+				if err != nil {
+					return nil, err
+				}
+				tags = append(tags, tag)
+				if err = p.consumeWhitespace1(); err != nil {
+					return nil, err
+				}
 			}
 		}
+		comment, err := p.parseTrailingComment()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.consumeRestOfWhitespaceLine(); err != nil {
+			return nil, err
+		}
+		metadata, err := p.parseMetadata()
+		if err != nil {
+			return nil, err
+		}
 		postings = append(postings, PostingBuilder{
-			Credit:    credit,
-			Debit:     debit,
-			Amount:    amount,
-			Commodity: commodity,
-			Targets:   targets,
-			Lot:       lot,
+			Credit:     credit,
+			Debit:      debit,
+			Amount:     amount,
+			Commodity:  commodity,
+			Targets:    targets,
+			Lot:        lot,
+			Conversion: conversion,
+			Tags:       tags,
+			Metadata:   metadata,
+			Comment:    comment,
 		})
-		if err = p.consumeRestOfWhitespaceLine(); err != nil {
+	}
+	if omitted != nil {
+		pbs, err := balancePostings(postings, omitted)
+		if err != nil {
 			return nil, err
 		}
+		postings = append(postings[:index], append(pbs, postings[index:]...)...)
 	}
 	return postings.Build(), nil
 }
 
+// parseOmitted parses the rest of a posting whose amount is omitted, which
+// can only have tags, a comment and metadata.
+func (p *Parser) parseOmitted(credit, debit *Account) (*PostingBuilder, error) {
+	var tags []Tag
+	for p.current() == '#' {
+		tag, err := p.parseTag()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+		if err = p.consumeWhitespace1(); err != nil {
+			return nil, err
+		}
+	}
+	comment, err := p.parseTrailingComment()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consumeRestOfWhitespaceLine(); err != nil {
+		return nil, err
+	}
+	metadata, err := p.parseMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return &PostingBuilder{
+		Credit:   credit,
+		Debit:    debit,
+		Tags:     tags,
+		Metadata: metadata,
+		Comment:  comment,
+		Omitted:  true,
+	}, nil
+}
+
+// parseTrailingComment parses a comment from a semicolon to the end of the
+// line, e.g. at the end of a posting. It returns the text of the comment
+// without the semicolon and surrounding white space.
+func (p *Parser) parseTrailingComment() (string, error) {
+	if p.current() != ';' {
+		return "", nil
+	}
+	if err := p.scanner.ConsumeRune(';'); err != nil {
+		return "", err
+	}
+	s, err := p.scanner.ReadWhile(func(r rune) bool {
+		return !isNewlineOrEOF(r)
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// balancePostings computes the postings for a posting with omitted amount.
+// Exactly one of its accounts must occur in the other postings, and the
+// computed postings balance the net flow of this account. There is one
+// posting per commodity, in the order of their first occurrence.
+func balancePostings(postings PostingBuilders, omitted *PostingBuilder) (PostingBuilders, error) {
+	flow := func(a *Account) ([]*Commodity, map[*Commodity]decimal.Decimal) {
+		var (
+			commodities []*Commodity
+			flows       = make(map[*Commodity]decimal.Decimal)
+		)
+		for _, pb := range postings {
+			if pb.Credit != a && pb.Debit != a {
+				continue
+			}
+			if _, ok := flows[pb.Commodity]; !ok {
+				commodities = append(commodities, pb.Commodity)
+			}
+			if pb.Debit == a {
+				flows[pb.Commodity] = flows[pb.Commodity].Add(pb.Amount)
+			}
+			if pb.Credit == a {
+				flows[pb.Commodity] = flows[pb.Commodity].Sub(pb.Amount)
+			}
+		}
+		return commodities, flows
+	}
+	credits, creditFlows := flow(omitted.Credit)
+	debits, debitFlows := flow(omitted.Debit)
+	var (
+		account     *Account
+		commodities []*Commodity
+		amounts     = make(map[*Commodity]decimal.Decimal)
+	)
+	switch {
+	case len(credits) > 0 && len(debits) > 0:
+		return nil, fmt.Errorf("cannot compute omitted amount, both %s and %s occur in other postings", omitted.Credit, omitted.Debit)
+	case len(credits) > 0:
+		account, commodities, amounts = omitted.Credit, credits, creditFlows
+	case len(debits) > 0:
+		account, commodities = omitted.Debit, debits
+		for c, f := range debitFlows {
+			amounts[c] = f.Neg()
+		}
+	default:
+		return nil, fmt.Errorf("cannot compute omitted amount, neither %s nor %s occur in other postings", omitted.Credit, omitted.Debit)
+	}
+	var res PostingBuilders
+	for _, c := range commodities {
+		if amounts[c].IsZero() {
+			continue
+		}
+		pb := *omitted
+		pb.Commodity, pb.Amount = c, amounts[c]
+		res = append(res, pb)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("cannot compute omitted amount, account %s is balanced by the other postings", account)
+	}
+	return res, nil
+}
+
+// parseConversion parses the conversion of a posting with the given amount
+// and commodity, "@ <unit price> <commodity>" or "@@ <total price> <commodity>".
+func (p *Parser) parseConversion(amount decimal.Decimal, c *Commodity) (*Conversion, error) {
+	if err := p.scanner.ConsumeRune('@'); err != nil {
+		return nil, err
+	}
+	var total bool
+	if p.current() == '@' {
+		if err := p.scanner.ConsumeRune('@'); err != nil {
+			return nil, err
+		}
+		total = true
+	}
+	if total && amount.IsZero() {
+		return nil, fmt.Errorf("total price of a posting without amount")
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	price, err := p.parseDecimal()
+	if err != nil {
+		return nil, err
+	}
+	if !price.IsPositive() {
+		return nil, fmt.Errorf("price must be positive, got %s", price)
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	target, err := p.parseCommodity()
+	if err != nil {
+		return nil, err
+	}
+	if target == c {
+		return nil, fmt.Errorf("conversion of %s into itself", c.Name())
+	}
+	return &Conversion{Price: price, Commodity: target, Total: total}, nil
+}
+
 func (p *Parser) parseOpen(d time.Time) (*Open, error) {
 	if err := p.scanner.ParseString("open"); err != nil {
 		return nil, err
@@ -357,17 +820,145 @@ func (p *Parser) parseOpen(d time.Time) (*Open, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := p.scanner.ConsumeWhile(isWhitespace); err != nil {
+		return nil, err
+	}
+	var commodities []*Commodity
+	if unicode.IsLetter(p.current()) || unicode.IsDigit(p.current()) {
+		if commodities, err = p.parseCommodities(); err != nil {
+			return nil, err
+		}
+	}
 	return &Open{
+		Range:       p.getRange(),
+		Date:        d,
+		Account:     account,
+		Commodities: commodities,
+	}, nil
+}
+
+func (p *Parser) parseCommodities() ([]*Commodity, error) {
+	c, err := p.parseCommodity()
+	if err != nil {
+		return nil, err
+	}
+	res := []*Commodity{c}
+	for p.current() == ',' {
+		if err := p.scanner.ConsumeRune(','); err != nil {
+			return nil, err
+		}
+		c, err := p.parseCommodity()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+func (p *Parser) parseClose(d time.Time) (*Close, error) {
+	if err := p.scanner.ParseString("close"); err != nil {
+		return nil, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	account, err := p.parseAccount()
+	if err != nil {
+		return nil, err
+	}
+	res := &Close{
 		Range:   p.getRange(),
 		Date:    d,
 		Account: account,
+	}
+	if err := p.scanner.ConsumeWhile(isWhitespace); err != nil {
+		return nil, err
+	}
+	if unicode.IsLetter(p.current()) {
+		if res.Residual, err = p.parseAccount(); err != nil {
+			return nil, err
+		}
+		res.Range = p.getRange()
+	}
+	return res, nil
+}
+
+func (p *Parser) parsePrice(d time.Time) (*Price, error) {
+	if err := p.scanner.ParseString("price"); err != nil {
+		return nil, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	commodity, err := p.parseCommodity()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+
+	price, err := p.parseDecimal()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	target, err := p.parseCommodity()
+	if err != nil {
+		return nil, err
+	}
+	return &Price{
+		Range:     p.getRange(),
+		Date:      d,
+		Commodity: commodity,
+		Price:     price,
+		Target:    target,
 	}, nil
 }
 
-func (p *Parser) parseClose(d time.Time) (*Close, error) {
-	if err := p.scanner.ParseString("close"); err != nil {
+func (p *Parser) parseBalanceAssertion(d time.Time) (*Assertion, error) {
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	account, err := p.parseAccount()
+	if err != nil {
+		return nil, err
+	}
+	var subtree bool
+	if p.current() == '*' {
+		if err := p.scanner.ConsumeRune('*'); err != nil {
+			return nil, err
+		}
+		subtree = true
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	amount, err := p.parseDecimal()
+	if err != nil {
 		return nil, err
 	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	commodity, err := p.parseCommodity()
+	if err != nil {
+		return nil, err
+	}
+	return &Assertion{
+		Range:     p.getRange(),
+		Date:      d,
+		Account:   account,
+		Amount:    amount,
+		Commodity: commodity,
+		Subtree:   subtree,
+	}, nil
+}
+
+func (p *Parser) parseBudget(d time.Time) (*Budget, error) {
 	if err := p.consumeWhitespace1(); err != nil {
 		return nil, err
 	}
@@ -375,15 +966,166 @@ func (p *Parser) parseClose(d time.Time) (*Close, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Close{
-		Range:   p.getRange(),
-		Date:    d,
-		Account: account,
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	amount, err := p.parseDecimal()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	commodity, err := p.parseCommodity()
+	if err != nil {
+		return nil, err
+	}
+	res := &Budget{
+		Range:     p.getRange(),
+		Date:      d,
+		Account:   account,
+		Amount:    amount,
+		Commodity: commodity,
+	}
+	if err := p.scanner.ConsumeWhile(isWhitespace); err != nil {
+		return nil, err
+	}
+	if p.current() == 'a' {
+		if res.Alert, err = p.parseAlert(); err != nil {
+			return nil, err
+		}
+		res.Range = p.getRange()
+	}
+	return res, nil
+}
+
+func (p *Parser) parseAuto(d time.Time) (*Auto, error) {
+	if err := p.scanner.ParseString("auto"); err != nil {
+		return nil, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	pattern, err := p.parseQuotedString()
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	credit, err := p.parseAccount()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	debit, err := p.parseAccount()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	pct, err := p.parseDecimal()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.scanner.ConsumeRune('%'); err != nil {
+		return nil, err
+	}
+	return &Auto{
+		Range:    p.getRange(),
+		Date:     d,
+		Accounts: accounts,
+		Credit:   credit,
+		Debit:    debit,
+		Ratio:    pct.Shift(-2),
+	}, nil
+}
+
+// parseAlert parses an alert threshold such as "alert 80%" and returns it
+// as a fraction.
+func (p *Parser) parseAlert() (decimal.Decimal, error) {
+	if err := p.scanner.ParseString("alert"); err != nil {
+		return decimal.Zero, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return decimal.Zero, err
+	}
+	pct, err := p.parseDecimal()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if err := p.scanner.ConsumeRune('%'); err != nil {
+		return decimal.Zero, err
+	}
+	if !pct.IsPositive() {
+		return decimal.Zero, fmt.Errorf("invalid alert threshold %s%%", pct)
+	}
+	return pct.Shift(-2), nil
+}
+
+func (p *Parser) parseValuation(d time.Time) (*Valuation, error) {
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	account, err := p.parseAccount()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	target, err := p.parseAccount()
+	if err != nil {
+		return nil, err
+	}
+	return &Valuation{
+		Range:   p.getRange(),
+		Date:    d,
+		Account: account,
+		Target:  target,
+	}, nil
+}
+
+func (p *Parser) parseValue(d time.Time) (*Value, error) {
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	account, err := p.parseAccount()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	amount, err := p.parseDecimal()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	commodity, err := p.parseCommodity()
+	if err != nil {
+		return nil, err
+	}
+	return &Value{
+		Range:     p.getRange(),
+		Date:      d,
+		Account:   account,
+		Amount:    amount,
+		Commodity: commodity,
 	}, nil
 }
 
-func (p *Parser) parsePrice(d time.Time) (*Price, error) {
-	if err := p.scanner.ParseString("price"); err != nil {
+func (p *Parser) parseRename(d time.Time) (*Rename, error) {
+	if err := p.scanner.ParseString("rename"); err != nil {
 		return nil, err
 	}
 	if err := p.consumeWhitespace1(); err != nil {
@@ -396,76 +1138,96 @@ func (p *Parser) parsePrice(d time.Time) (*Price, error) {
 	if err := p.consumeWhitespace1(); err != nil {
 		return nil, err
 	}
-
-	price, err := p.parseDecimal()
+	target, err := p.parseCommodity()
 	if err != nil {
 		return nil, err
 	}
 	if err := p.consumeWhitespace1(); err != nil {
 		return nil, err
 	}
-	target, err := p.parseCommodity()
-	if err != nil {
-		return nil, err
+	ratio := decimal.NewFromInt(1)
+	if unicode.IsDigit(p.current()) {
+		if ratio, err = p.parseDecimal(); err != nil {
+			return nil, err
+		}
 	}
-	return &Price{
+	return &Rename{
 		Range:     p.getRange(),
 		Date:      d,
 		Commodity: commodity,
-		Price:     price,
 		Target:    target,
+		Ratio:     ratio,
 	}, nil
 }
 
-func (p *Parser) parseBalanceAssertion(d time.Time) (*Assertion, error) {
-	if err := p.scanner.ParseString("balance"); err != nil {
+func (p *Parser) parseSplit(d time.Time) (*Split, error) {
+	if err := p.scanner.ParseString("split"); err != nil {
 		return nil, err
 	}
 	if err := p.consumeWhitespace1(); err != nil {
 		return nil, err
 	}
-	account, err := p.parseAccount()
+	commodity, err := p.parseCommodity()
 	if err != nil {
 		return nil, err
 	}
 	if err := p.consumeWhitespace1(); err != nil {
 		return nil, err
 	}
-	amount, err := p.parseDecimal()
+	numerator, err := p.parseDecimal()
 	if err != nil {
 		return nil, err
 	}
-	if err := p.consumeWhitespace1(); err != nil {
+	if err := p.scanner.ConsumeRune(':'); err != nil {
 		return nil, err
 	}
-	commodity, err := p.parseCommodity()
+	denominator, err := p.parseDecimal()
 	if err != nil {
 		return nil, err
 	}
-	return &Assertion{
-		Range:     p.getRange(),
-		Date:      d,
-		Account:   account,
-		Amount:    amount,
-		Commodity: commodity,
+	if !numerator.IsPositive() || !denominator.IsPositive() {
+		return nil, fmt.Errorf("invalid split ratio %s:%s", numerator, denominator)
+	}
+	return &Split{
+		Range:       p.getRange(),
+		Date:        d,
+		Commodity:   commodity,
+		Numerator:   numerator,
+		Denominator: denominator,
 	}, nil
 }
 
-func (p *Parser) parseValue(d time.Time) (*Value, error) {
-	if err := p.scanner.ParseString("value"); err != nil {
+func (p *Parser) parseInclude() (*Include, error) {
+	p.markStart()
+	if err := p.scanner.ParseString("include"); err != nil {
 		return nil, err
 	}
 	if err := p.consumeWhitespace1(); err != nil {
 		return nil, err
 	}
-	account, err := p.parseAccount()
+	i, err := p.parseQuotedString()
 	if err != nil {
 		return nil, err
 	}
+	result := &Include{
+		Range: p.getRange(),
+		Path:  i,
+	}
+	if err := p.consumeRestOfWhitespaceLine(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (p *Parser) parseRates() (*Rates, error) {
+	p.markStart()
+	if err := p.scanner.ParseString("rates"); err != nil {
+		return nil, err
+	}
 	if err := p.consumeWhitespace1(); err != nil {
 		return nil, err
 	}
-	amount, err := p.parseDecimal()
+	path, err := p.parseQuotedString()
 	if err != nil {
 		return nil, err
 	}
@@ -476,30 +1238,51 @@ func (p *Parser) parseValue(d time.Time) (*Value, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Value{
+	if err := p.consumeWhitespace1(); err != nil {
+		return nil, err
+	}
+	target, err := p.parseCommodity()
+	if err != nil {
+		return nil, err
+	}
+	result := &Rates{
 		Range:     p.getRange(),
-		Date:      d,
-		Account:   account,
-		Amount:    amount,
+		Path:      path,
 		Commodity: commodity,
-	}, nil
+		Target:    target,
+	}
+	if err := p.consumeRestOfWhitespaceLine(); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-func (p *Parser) parseInclude() (*Include, error) {
+// parseDeclaration parses a currency or a commodity declaration.
+func (p *Parser) parseDeclaration() (Directive, error) {
 	p.markStart()
-	if err := p.scanner.ParseString("include"); err != nil {
+	keyword, err := p.scanner.ReadWhile(unicode.IsLetter)
+	if err != nil {
 		return nil, err
 	}
+	if keyword != "currency" && keyword != "commodity" {
+		return nil, fmt.Errorf("expected \"commodity\" or \"currency\", got %q", keyword)
+	}
 	if err := p.consumeWhitespace1(); err != nil {
 		return nil, err
 	}
-	i, err := p.parseQuotedString()
+	c, err := p.parseCommodity()
 	if err != nil {
 		return nil, err
 	}
-	result := &Include{
-		Range: p.getRange(),
-		Path:  i,
+	var result Directive = &Currency{
+		Range:     p.getRange(),
+		Commodity: c,
+	}
+	if keyword == "commodity" {
+		result = &Declaration{
+			Range:     p.getRange(),
+			Commodity: c,
+		}
 	}
 	if err := p.consumeRestOfWhitespaceLine(); err != nil {
 		return nil, err
@@ -507,21 +1290,24 @@ func (p *Parser) parseInclude() (*Include, error) {
 	return result, nil
 }
 
-func (p *Parser) parseCurrency() (*Currency, error) {
+func (p *Parser) parseOption() (*Option, error) {
 	p.markStart()
-	if err := p.scanner.ParseString("currency"); err != nil {
+	if err := p.scanner.ParseString("option"); err != nil {
 		return nil, err
 	}
 	if err := p.consumeWhitespace1(); err != nil {
 		return nil, err
 	}
-	i, err := p.parseCommodity()
+	name, err := p.parseIdentifier()
 	if err != nil {
 		return nil, err
 	}
-	result := &Currency{
-		Range:     p.getRange(),
-		Commodity: i,
+	if name != OptionStrict {
+		return nil, fmt.Errorf("unknown option %q", name)
+	}
+	result := &Option{
+		Range: p.getRange(),
+		Name:  name,
 	}
 	if err := p.consumeRestOfWhitespaceLine(); err != nil {
 		return nil, err
@@ -665,19 +1451,48 @@ func (p *Parser) parseTargetCommodities() ([]*Commodity, error) {
 	return res, nil
 }
 
-func (p *Parser) parseTags() ([]Tag, error) {
-	var tags []Tag
-	for p.current() == '#' {
-		tag, err := p.parseTag()
-		if err != nil {
-			return nil, err
+func (p *Parser) parseTagsAndLinks() ([]Tag, []Link, error) {
+	var (
+		tags  []Tag
+		links []Link
+	)
+	for p.current() == '#' || p.current() == '^' {
+		if p.current() == '#' {
+			tag, err := p.parseTag()
+			if err != nil {
+				return nil, nil, err
+			}
+			tags = append(tags, tag)
+		} else {
+			link, err := p.parseLink()
+			if err != nil {
+				return nil, nil, err
+			}
+			links = append(links, link)
 		}
-		tags = append(tags, tag)
 		if err := p.consumeWhitespace1(); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
-	return tags, nil
+	return tags, links, nil
+}
+
+func (p *Parser) parseLink() (Link, error) {
+	if err := p.scanner.ConsumeRune('^'); err != nil {
+		return "", err
+	}
+	name, err := p.scanner.ReadWhile(isLinkName)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", fmt.Errorf("expected link name, got %q", p.current())
+	}
+	return Link("^" + name), nil
+}
+
+func isLinkName(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || strings.ContainsRune("-_./", ch)
 }
 
 func (p *Parser) parseTag() (Tag, error) {
@@ -694,6 +1509,17 @@ func (p *Parser) parseTag() (Tag, error) {
 		return "", err
 	}
 	b.WriteString(i)
+	if p.current() == ':' {
+		if err := p.scanner.ConsumeRune(':'); err != nil {
+			return "", err
+		}
+		v, err := p.parseIdentifier()
+		if err != nil {
+			return "", err
+		}
+		b.WriteRune(':')
+		b.WriteString(v)
+	}
 	return Tag(b.String()), nil
 }
 
@@ -714,6 +1540,38 @@ func (p *Parser) parseQuotedString() (string, error) {
 	return s, nil
 }
 
+// parseMetadata parses the metadata lines following a transaction header
+// or a posting, e.g. import-id: "1234". Keys start with a lowercase letter,
+// which distinguishes them from accounts.
+func (p *Parser) parseMetadata() (Metadata, error) {
+	var res Metadata
+	for unicode.IsLower(p.current()) {
+		key, err := p.scanner.ReadWhile(isMetadataKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.scanner.ConsumeRune(':'); err != nil {
+			return nil, err
+		}
+		if err := p.consumeWhitespace1(); err != nil {
+			return nil, err
+		}
+		value, err := p.parseQuotedString()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.consumeRestOfWhitespaceLine(); err != nil {
+			return nil, err
+		}
+		res = append(res, Meta{Key: key, Value: value})
+	}
+	return res, nil
+}
+
+func isMetadataKey(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '-' || ch == '_'
+}
+
 // parseIdentifier parses an identifier
 func (p *Parser) parseIdentifier() (string, error) {
 	var s strings.Builder
@@ -770,6 +1628,12 @@ func (p *Parser) parseCommodity() (*Commodity, error) {
 	}
 	return p.context.GetCommodity(i)
 }
+
+// isCommentStart returns whether a line starting with ch is a comment.
+func isCommentStart(ch rune) bool {
+	return ch == '#' || ch == '*' || ch == ';'
+}
+
 func isWhitespace(ch rune) bool {
 	return ch == ' ' || ch == '\t' || ch == '\r'
 }
@@ -778,68 +1642,338 @@ func isNewline(ch rune) bool {
 	return ch == '\n'
 }
 
+func isNewlineOrEOF(ch rune) bool {
+	return ch == '\n' || ch == scanner.EOF
+}
+
 func isWhitespaceOrNewline(ch rune) bool {
 	return isNewline(ch) || isWhitespace(ch)
 }
 
-// RecursiveParser parses a file hierarchy recursively.
+// Loader reads all directives of a file in another format than knut's,
+// including the files it includes.
+type Loader func(jctx Context, src Source, path string) ([]Directive, error)
+
+var loaders = make(map[string]Loader)
+
+// RegisterLoader registers a loader for files with the given extension,
+// e.g. ".ledger". It must be called during initialization.
+func RegisterLoader(ext string, l Loader) {
+	loaders[strings.ToLower(ext)] = l
+}
+
+// RecursiveParser parses a file hierarchy recursively. Included files are
+// read in parallel, but the directives are emitted in a deterministic
+// order: the directives of a file are followed by those of the files it
+// includes, in the order of the include directives.
 type RecursiveParser struct {
 	File    string
 	Context Context
 
-	wg sync.WaitGroup
+	// Source holds the files of the journal. It defaults to the local
+	// file system.
+	Source Source
+
+	// Input, if set, is read instead of File. File then only names the
+	// input, and the files it includes are resolved relative to its
+	// directory.
+	Input io.Reader
+
+	// Cache, if set, holds the parsed directives of unchanged files.
+	Cache *ParseCache
+
+	// IncludeOrder emits the directives of an included file in place of
+	// the include directive, as if the file was inserted into the
+	// including file.
+	IncludeOrder bool
+
+	// included holds the files emitted so far, and whether they have
+	// been included by name rather than by a glob pattern.
+	included map[string]bool
+}
+
+// parsedFile holds the directives and errors of a file, and the files it
+// includes, once done is closed.
+type parsedFile struct {
+	path    string
+	include *Include
+	parent  *parsedFile
+	items   []any
+	done    chan struct{}
+}
+
+// add adds a directive, an error or an included file.
+func (pf *parsedFile) add(ctx context.Context, item any) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	pf.items = append(pf.items, item)
+	return nil
+}
+
+// isAncestor returns whether the file at the given path is pf or one of
+// the files which include it.
+func (pf *parsedFile) isAncestor(path string) bool {
+	for ; pf != nil; pf = pf.parent {
+		if pf.path == path {
+			return true
+		}
+	}
+	return false
 }
 
 // Parse parses the journal at the path, and branches out for include files
 func (rp *RecursiveParser) Parse(ctx context.Context) <-chan any {
 	resCh := make(chan any, 1000)
-
-	rp.wg.Add(1)
-	go func() {
-		defer rp.wg.Done()
-		err := rp.parseRecursively(ctx, resCh, rp.File)
-		if err != nil && ctx.Err() == nil {
-			cpr.Push[any](ctx, resCh, err)
+	if rp.Source == nil {
+		rp.Source = FileSystem{}
+	}
+	root := rp.start(ctx, &parsedFile{path: path.Clean(rp.File)}, func(pf *parsedFile) error {
+		if rp.Input != nil {
+			return rp.parseInput(ctx, pf)
 		}
-	}()
-
-	// Parse and eventually close input channel
+		return rp.parseRecursively(ctx, pf, rp.File)
+	})
+	rp.included = map[string]bool{root.path: true}
 	go func() {
 		defer close(resCh)
-		rp.wg.Wait()
+		rp.emit(ctx, resCh, root)
 	}()
 	return resCh
 }
 
-func (rp *RecursiveParser) parseRecursively(ctx context.Context, resCh chan<- any, file string) error {
-	p, cls, err := ParserFromPath(rp.Context, file)
+// start parses the file in a new goroutine.
+func (rp *RecursiveParser) start(ctx context.Context, pf *parsedFile, parse func(*parsedFile) error) *parsedFile {
+	pf.done = make(chan struct{})
+	go func() {
+		defer close(pf.done)
+		if err := parse(pf); err != nil && ctx.Err() == nil {
+			pf.items = append(pf.items, err)
+		}
+	}()
+	return pf
+}
+
+// emit pushes the directives and errors of the file and of the files it
+// includes, skipping files which have been emitted before.
+func (rp *RecursiveParser) emit(ctx context.Context, resCh chan<- any, pf *parsedFile) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-pf.done:
+	}
+	var includes []*parsedFile
+	for _, item := range pf.items {
+		inc, ok := item.(*parsedFile)
+		if !ok {
+			if err := cpr.Push(ctx, resCh, item); err != nil {
+				return err
+			}
+			continue
+		}
+		if rp.IncludeOrder {
+			if err := rp.emitIncluded(ctx, resCh, inc); err != nil {
+				return err
+			}
+			continue
+		}
+		includes = append(includes, inc)
+	}
+	for _, inc := range includes {
+		if err := rp.emitIncluded(ctx, resCh, inc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emitIncluded emits an included file, unless it has been emitted before.
+// Including the same file twice by name is an error.
+func (rp *RecursiveParser) emitIncluded(ctx context.Context, resCh chan<- any, pf *parsedFile) error {
+	isGlob := isGlob(pf.include.Path)
+	explicit, ok := rp.included[pf.path]
+	rp.included[pf.path] = explicit || !isGlob
+	if ok && !isGlob && explicit {
+		err := Error{Code: ErrParse, Directive: pf.include, Message: fmt.Sprintf("file %s is included more than once", pf.path)}
+		return cpr.Push[any](ctx, resCh, err)
+	}
+	if ok {
+		return nil
+	}
+	return rp.emit(ctx, resCh, pf)
+}
+
+func (rp *RecursiveParser) parseRecursively(ctx context.Context, pf *parsedFile, file string) error {
+	if l, ok := loaders[strings.ToLower(filepath.Ext(file))]; ok {
+		ds, err := l(rp.Context, rp.Source, file)
+		if err != nil {
+			return err
+		}
+		for _, d := range ds {
+			if err := pf.add(ctx, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if rp.Cache != nil {
+		return rp.parseCached(ctx, pf, file)
+	}
+	p, cls, err := ParserFromSource(rp.Context, rp.Source, file)
 	if err != nil {
 		return err
 	}
 	defer cls()
+	return rp.parse(ctx, pf, file, p)
+}
+
+// parseCached parses the file, unless its directives are in the cache. The
+// directives of files without errors are stored in the cache.
+func (rp *RecursiveParser) parseCached(ctx context.Context, pf *parsedFile, file string) error {
+	r, cls, err := open(rp.Source, file)
+	if err != nil {
+		return err
+	}
+	bs, err := io.ReadAll(r)
+	if err := multierr.Append(err, cls()); err != nil {
+		return err
+	}
+	sum := digest(bs)
+	if ds, ok := rp.Cache.load(rp.Context, file, sum); ok {
+		for _, d := range ds {
+			if err := rp.handle(ctx, pf, file, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	p, err := newParser(rp.Context, file, bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+	var (
+		ds     []Directive
+		failed bool
+	)
+	for {
+		d, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			failed = true
+			if err := pf.add(ctx, err); err != nil {
+				return err
+			}
+			continue
+		}
+		ds = append(ds, d)
+		if err := rp.handle(ctx, pf, file, d); err != nil {
+			return err
+		}
+	}
+	if !failed {
+		// the cache is an optimization, failing to store an entry
+		// only means that the file is parsed again
+		_ = rp.Cache.store(file, sum, ds)
+	}
+	return nil
+}
+
+// parseInput parses the input of the parser in place of its file.
+func (rp *RecursiveParser) parseInput(ctx context.Context, pf *parsedFile) error {
+	p, err := newParser(rp.Context, rp.File, bufio.NewReader(rp.Input))
+	if err != nil {
+		return err
+	}
+	return rp.parse(ctx, pf, rp.File, p)
+}
 
+// parse adds the directives of the parser for the given file.
+func (rp *RecursiveParser) parse(ctx context.Context, pf *parsedFile, file string, p *Parser) error {
 	for {
 		d, err := p.Next()
 		if err == io.EOF {
 			return nil
 		}
 		if err != nil {
+			// report the error and continue with the next directive
+			if err := pf.add(ctx, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := rp.handle(ctx, pf, file, d); err != nil {
 			return err
 		}
-		switch t := d.(type) {
-		case *Include:
-			rp.wg.Add(1)
-			go func() {
-				defer rp.wg.Done()
-				err := rp.parseRecursively(ctx, resCh, path.Join(filepath.Dir(file), t.Path))
-				if err != nil && ctx.Err() == nil {
-					cpr.Push[any](ctx, resCh, err)
-				}
-			}()
-		default:
-			if err := cpr.Push[any](ctx, resCh, d); err != nil {
+	}
+}
+
+// handle adds a directive of the given file, and starts parsing the files
+// it includes.
+func (rp *RecursiveParser) handle(ctx context.Context, pf *parsedFile, file string, d Directive) error {
+	switch t := d.(type) {
+	case *Include:
+		files, err := rp.expand(file, t)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			f := f
+			inc := &parsedFile{path: f, include: t, parent: pf}
+			if pf.isAncestor(f) {
+				// an include cycle, which is skipped when emitting
+				inc.done = make(chan struct{})
+				close(inc.done)
+			} else {
+				rp.start(ctx, inc, func(inc *parsedFile) error {
+					return rp.parseRecursively(ctx, inc, f)
+				})
+			}
+			if err := pf.add(ctx, inc); err != nil {
+				return err
+			}
+		}
+	case *Rates:
+		prices, err := readRates(rp.Source, t, path.Join(filepath.Dir(file), t.Path))
+		if err != nil {
+			return err
+		}
+		for _, pr := range prices {
+			if err := pf.add(ctx, pr); err != nil {
 				return err
 			}
 		}
+	default:
+		return pf.add(ctx, d)
+	}
+	return nil
+}
+
+// isGlob returns whether the path of an include directive is a glob
+// pattern.
+func isGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// expand returns the files included by the include directive in file, in
+// lexical order. The path of the directive is relative to file and may be
+// a glob pattern, such as "imports/*.knut".
+func (rp *RecursiveParser) expand(file string, inc *Include) ([]string, error) {
+	pattern := path.Join(filepath.Dir(file), inc.Path)
+	files := []string{pattern}
+	if isGlob(inc.Path) {
+		var err error
+		if files, err = rp.Source.List(pattern); err != nil {
+			return nil, Error{Code: ErrParse, Directive: inc, Message: err.Error()}
+		}
+		if len(files) == 0 {
+			return nil, Error{Code: ErrParse, Directive: inc, Message: fmt.Sprintf("no files match %s", pattern)}
+		}
 	}
+	res := make([]string, 0, len(files))
+	for _, f := range files {
+		res = append(res, path.Clean(f))
+	}
+	return res, nil
 }
@@ -0,0 +1,294 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestFromPathCompressed(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, compress func(io.Writer) io.WriteCloser, content string) {
+		var buf bytes.Buffer
+		w := compress(&buf)
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.knut", func(w io.Writer) io.WriteCloser { return nopCloser{w} }, `include "2015.knut.gz"
+include "2016.knut.zst"
+`)
+	write("2015.knut.gz", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }, `2015-01-01 open Assets:Bank
+2015-01-01 open Equity:Equity
+`)
+	write("2016.knut.zst", func(w io.Writer) io.WriteCloser {
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return enc
+	}, `2016-01-01 "Deposit"
+Equity:Equity Assets:Bank 100 CHF
+`)
+
+	j, err := FromPath(context.Background(), NewContext(), filepath.Join(dir, "main.knut"))
+
+	if err != nil {
+		t.Fatalf("FromPath() returned unexpected error: %v", err)
+	}
+	l, err := j.Process()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opens, trxs int
+	for _, d := range l.Days {
+		opens += len(d.Openings)
+		trxs += len(d.Transactions)
+	}
+	if opens != 2 || trxs != 1 {
+		t.Fatalf("got %d openings and %d transactions, want 2 and 1", opens, trxs)
+	}
+}
+
+func TestParseOmittedAmount(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		want  []string
+		err   string
+	}{
+		{
+			desc: "single commodity",
+			input: `2022-01-25 "Paycheck"
+Income:Salary Assets:Bank 5000 CHF
+Assets:Bank Expenses:Tax 1000 CHF
+Assets:Bank Assets:Savings
+`,
+			want: []string{
+				"Income:Salary Assets:Bank 5000 CHF",
+				"Assets:Bank Expenses:Tax 1000 CHF",
+				"Assets:Bank Assets:Savings 4000 CHF",
+			},
+		},
+		{
+			desc: "multiple commodities",
+			input: `2022-01-25 "Transfer"
+Assets:Savings Assets:Wallet
+Assets:Wallet Expenses:Food 20 CHF
+Assets:Wallet Expenses:Food 10 EUR
+`,
+			want: []string{
+				"Assets:Savings Assets:Wallet 20 CHF",
+				"Assets:Savings Assets:Wallet 10 EUR",
+				"Assets:Wallet Expenses:Food 20 CHF",
+				"Assets:Wallet Expenses:Food 10 EUR",
+			},
+		},
+		{
+			desc: "balanced",
+			input: `2022-01-25 "Paycheck"
+Income:Salary Assets:Bank 5000 CHF
+Assets:Bank Expenses:Tax 5000 CHF
+Assets:Bank Assets:Savings
+`,
+			err: "account Assets:Bank is balanced by the other postings",
+		},
+		{
+			desc: "unrelated",
+			input: `2022-01-25 "Paycheck"
+Income:Salary Assets:Bank 5000 CHF
+Assets:Savings Assets:Wallet
+`,
+			err: "neither Assets:Savings nor Assets:Wallet occur in other postings",
+		},
+		{
+			desc: "more than one",
+			input: `2022-01-25 "Paycheck"
+Income:Salary Assets:Bank 5000 CHF
+Assets:Bank Expenses:Tax
+Assets:Bank Assets:Savings
+`,
+			err: "more than one posting with omitted amount",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			p, err := newParser(NewContext(), "", strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d, err := p.Next()
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Next() returned error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Next() returned unexpected error: %v", err)
+			}
+			var got []string
+			for i, po := range d.(*Transaction).Postings {
+				if i%2 == 1 {
+					got = append(got, fmt.Sprintf("%s %s %s %s", po.Other, po.Account, po.Amount, po.Commodity.Name()))
+				}
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Next() returned unexpected postings (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseDescriptionAndComments(t *testing.T) {
+	tests := []struct {
+		desc     string
+		input    string
+		want     string
+		comments []string
+		err      string
+	}{
+		{
+			desc: "continued description",
+			input: `2022-01-25 "Dinner at the restaurant "
+  "by the lake" #food
+Assets:Bank Expenses:Food 80 CHF
+`,
+			want:     "Dinner at the restaurant by the lake",
+			comments: []string{"", ""},
+		},
+		{
+			desc: "trailing comments",
+			input: `2022-01-25 "Dinner"
+Assets:Bank Expenses:Food 80 CHF #food ;  card  
+Assets:Bank Expenses:Tips ; tip
+`,
+			want:     "Dinner",
+			comments: []string{"card", "card", "tip", "tip"},
+		},
+		{
+			desc: "indented posting",
+			input: `2022-01-25 "Dinner"
+  Assets:Bank Expenses:Food 80 CHF
+`,
+			err: "expected",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			p, err := newParser(NewContext(), "", strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d, err := p.Next()
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Next() returned error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Next() returned unexpected error: %v", err)
+			}
+			trx := d.(*Transaction)
+			if trx.Description != test.want {
+				t.Errorf("Next() returned description %q, want %q", trx.Description, test.want)
+			}
+			var comments []string
+			for _, po := range trx.Postings {
+				comments = append(comments, po.Comment)
+			}
+			if diff := cmp.Diff(test.comments, comments); diff != "" {
+				t.Errorf("Next() returned unexpected comments (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseMultipleErrors(t *testing.T) {
+	input := `2020-01-01 open Assets:Bank
+2020-01-01 opn Equity:Equity
+
+2020-01-05 "Deposit"
+Equity:Equity Assets:Bank 100 CHF
+Equity:Equity Assets:Bank ten CHF
+Equity:Equity Assets:Bank 5 CHF
+
+2020-01-06 "Balanced"
+Income:Salary Assets:Bank 5000 CHF
+Assets:Bank Expenses:Tax 5000 CHF
+Assets:Bank Assets:Savings
+
+2020-01-10 close Assets:Bank
+`
+	p, err := newParser(NewContext(), "journal.knut", strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		directives int
+		got        []string
+	)
+	for {
+		_, err := p.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			got = append(got, err.Error())
+			continue
+		}
+		directives++
+	}
+
+	want := []string{
+		"journal.knut:2:14: expected open, got opn\n2020-01-01 opn Equity:Equity\n             ^",
+		"journal.knut:6:27: can't convert  to decimal\nEquity:Equity Assets:Bank ten CHF\n                          ^",
+		"journal.knut:12:27: cannot compute omitted amount, account Assets:Bank is balanced by the other postings\nAssets:Bank Assets:Savings\n                          ^",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Next() returned unexpected errors (-want/+got):\n%s", diff)
+	}
+	if directives != 2 {
+		t.Errorf("Next() returned %d directives, want 2", directives)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
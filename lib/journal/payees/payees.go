@@ -0,0 +1,196 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package payees aggregates expenses by payee, which is derived from the
+// descriptions of the transactions.
+package payees
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/common/mapper"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+)
+
+// Rule assigns descriptions matching a regex to a payee.
+type Rule struct {
+	Regex *regexp.Regexp
+	Payee string
+}
+
+// ParseRule parses a rule of the form "<regex> -> <payee>".
+func ParseRule(s string) (Rule, error) {
+	r, p, ok := strings.Cut(s, "->")
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid rule %q, expected <regex> -> <payee>", s)
+	}
+	rx, err := regexp.Compile(strings.TrimSpace(r))
+	if err != nil {
+		return Rule{}, err
+	}
+	payee := strings.TrimSpace(p)
+	if len(payee) == 0 {
+		return Rule{}, fmt.Errorf("invalid rule %q, payee is empty", s)
+	}
+	return Rule{Regex: rx, Payee: payee}, nil
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s -> %s", r.Regex, r.Payee)
+}
+
+// Rules is a normalization table for payees.
+type Rules []Rule
+
+func (rs Rules) String() string {
+	var ss []string
+	for _, r := range rs {
+		ss = append(ss, r.String())
+	}
+	return strings.Join(ss, ", ")
+}
+
+// Payee returns the payee of the first rule whose regex matches the
+// description. If no rule matches, the payee is the description with
+// whitespace collapsed.
+func (rs Rules) Payee(desc string) string {
+	for _, r := range rs {
+		if r.Regex.MatchString(desc) {
+			return r.Payee
+		}
+	}
+	return strings.Join(strings.Fields(desc), " ")
+}
+
+// Mapper returns a mapper which replaces descriptions by their payee.
+func (rs Rules) Mapper() mapper.Mapper[string] {
+	return rs.Payee
+}
+
+// Row holds the expenses for a payee in a commodity per period.
+type Row struct {
+	Payee     string
+	Commodity *journal.Commodity
+	Amounts   []decimal.Decimal
+}
+
+// Report is a collection which aggregates the postings on expense accounts
+// by description and commodity per period. Map the descriptions to payees
+// with Rules.Mapper before inserting. Each period ends at one of the dates
+// and starts the day after the previous date; the first period starts at
+// the given start date. Valuated postings are aggregated in the valuation
+// commodity.
+type Report struct {
+	start time.Time
+	dates []time.Time
+
+	rows map[rowKey]*Row
+}
+
+type rowKey struct {
+	payee     string
+	commodity *journal.Commodity
+}
+
+// New creates a new report.
+func New(start time.Time, dates []time.Time) *Report {
+	return &Report{
+		start: start,
+		dates: dates,
+		rows:  make(map[rowKey]*Row),
+	}
+}
+
+// Insert inserts a posting.
+func (r *Report) Insert(k journal.Key, v decimal.Decimal) {
+	if k.Account == nil || k.Account.Type() != journal.EXPENSES || k.Date.Before(r.start) {
+		return
+	}
+	i := sort.Search(len(r.dates), func(i int) bool { return !r.dates[i].Before(k.Date) })
+	if i == len(r.dates) {
+		return
+	}
+	c := k.Commodity
+	if k.Valuation != nil {
+		c = k.Valuation
+	}
+	rw := dict.GetDefault(r.rows, rowKey{k.Description, c}, func() *Row {
+		return &Row{Payee: k.Description, Commodity: c, Amounts: make([]decimal.Decimal, len(r.dates))}
+	})
+	rw.Amounts[i] = rw.Amounts[i].Add(v)
+}
+
+// Rows returns the rows of the report, sorted by payee and commodity.
+func (r *Report) Rows() []*Row {
+	return dict.SortedValues(r.rows, func(r1, r2 *Row) compare.Order {
+		if o := compare.Ordered(strings.ToLower(r1.Payee), strings.ToLower(r2.Payee)); o != compare.Equal {
+			return o
+		}
+		if o := compare.Ordered(r1.Payee, r2.Payee); o != compare.Equal {
+			return o
+		}
+		return journal.CompareCommodities(r1.Commodity, r2.Commodity)
+	})
+}
+
+// Render renders the rows, followed by the totals per commodity.
+func Render(dates []time.Time, rows []*Row) *table.Table {
+	tbl := table.New(1, 1, len(dates))
+	tbl.AddSeparatorRow()
+	header := tbl.AddHeaderRow().AddText("Payee", table.Center).AddText("Comm", table.Center)
+	for _, d := range dates {
+		header.AddText(d.Format("2006-01-02"), table.Center)
+	}
+	tbl.AddSeparatorRow()
+	var (
+		commodities []*journal.Commodity
+		totals      = make(map[*journal.Commodity][]decimal.Decimal)
+	)
+	for _, rw := range rows {
+		renderRow(tbl, rw.Payee, rw.Commodity, rw.Amounts)
+		total, ok := totals[rw.Commodity]
+		if !ok {
+			total = make([]decimal.Decimal, len(dates))
+			totals[rw.Commodity] = total
+			commodities = append(commodities, rw.Commodity)
+		}
+		for i := range total {
+			total[i] = total[i].Add(rw.Amounts[i])
+		}
+	}
+	tbl.AddSeparatorRow()
+	compare.Sort(commodities, journal.CompareCommodities)
+	for _, c := range commodities {
+		renderRow(tbl, "Total", c, totals[c])
+	}
+	if len(commodities) > 0 {
+		tbl.AddSeparatorRow()
+	}
+	return tbl
+}
+
+func renderRow(tbl *table.Table, name string, c *journal.Commodity, amounts []decimal.Decimal) {
+	row := tbl.AddRow().AddText(name, table.Left).AddText(c.Name(), table.Left)
+	for _, a := range amounts {
+		row.AddNumber(a)
+	}
+}
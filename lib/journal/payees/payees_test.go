@@ -0,0 +1,50 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package payees
+
+import (
+	"testing"
+)
+
+func TestRulesPayee(t *testing.T) {
+	var rules Rules
+	for _, s := range []string{"(?i)migros -> Migros", "^SBB|CFF -> SBB"} {
+		r, err := ParseRule(s)
+		if err != nil {
+			t.Fatalf("ParseRule(%q) returned unexpected error: %v", s, err)
+		}
+		rules = append(rules, r)
+	}
+	for _, test := range []struct {
+		desc, want string
+	}{
+		{"MIGROS ZURICH HB", "Migros"},
+		{"Einkauf migros", "Migros"},
+		{"SBB Mobile", "SBB"},
+		{"  IKEA   Spreitenbach ", "IKEA Spreitenbach"},
+	} {
+		if got := rules.Payee(test.desc); got != test.want {
+			t.Errorf("Payee(%q) = %q, want %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestParseRuleInvalid(t *testing.T) {
+	for _, s := range []string{"migros", "(migros -> Migros", "migros -> "} {
+		if _, err := ParseRule(s); err == nil {
+			t.Errorf("ParseRule(%q) returned no error", s)
+		}
+	}
+}
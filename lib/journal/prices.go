@@ -16,7 +16,9 @@ package journal
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/sboehler/knut/lib/common/compare"
 	"github.com/sboehler/knut/lib/common/dict"
 	"github.com/shopspring/decimal"
 )
@@ -40,22 +42,26 @@ func (pr Prices) addPrice(target, commodity *Commodity, p decimal.Decimal) {
 }
 
 // Normalize creates a normalized price map for the given commodity.
+// Commodities without a direct price are priced through the shortest chain
+// of prices, e.g. GBP through GBP/USD and USD/CHF. Of several chains of the
+// same length, the one through the first intermediate commodities in
+// alphabetical order is used.
 func (pr Prices) Normalize(t *Commodity) NormalizedPrices {
 	res := NormalizedPrices{t: one}
-	pr.normalize(t, res)
-	return res
-}
-
-// normalize recursively computes prices by traversing the price graph.
-// res must already contain a price for c.
-func (pr Prices) normalize(c *Commodity, res NormalizedPrices) {
-	for neighbor, price := range pr[c] {
-		if _, done := res[neighbor]; done {
-			continue
+	// breadth-first search, visiting each commodity once
+	queue := []*Commodity{t}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		for _, neighbor := range dict.SortedKeys(pr[c], CompareCommodities) {
+			if _, done := res[neighbor]; done {
+				continue
+			}
+			res[neighbor] = multiply(pr[c][neighbor], res[c])
+			queue = append(queue, neighbor)
 		}
-		res[neighbor] = multiply(price, res[c])
-		pr.normalize(neighbor, res)
 	}
+	return res
 }
 
 // NormalizedPrices is a map representing the price of
@@ -78,3 +84,48 @@ func (n NormalizedPrices) Valuate(c *Commodity, a decimal.Decimal) (decimal.Deci
 func multiply(n1, n2 decimal.Decimal) decimal.Decimal {
 	return n1.Mul(n2).Truncate(8)
 }
+
+// PriceQuote is the price of a commodity in the valuation commodity on a
+// given date.
+type PriceQuote struct {
+	Date      time.Time
+	Commodity *Commodity
+	Price     decimal.Decimal
+}
+
+// PriceHistory returns the prices in the valuation commodity of the given
+// days, which must be sorted and processed by ComputePrices(valuation). If
+// dates is empty, the prices
+// are returned for each day on which a price is given, otherwise the most
+// recent prices as of each of the given dates are returned. The quotes of a
+// date are sorted by commodity, and the valuation commodity is omitted.
+func PriceHistory(days []*Day, valuation *Commodity, dates []time.Time) []PriceQuote {
+	var res []PriceQuote
+	add := func(d time.Time, np NormalizedPrices) {
+		for _, c := range dict.SortedKeys(np, CompareCommodities) {
+			if c == valuation {
+				continue
+			}
+			res = append(res, PriceQuote{Date: d, Commodity: c, Price: np[c]})
+		}
+	}
+	if len(dates) == 0 {
+		for _, d := range days {
+			if len(d.Prices) > 0 {
+				add(d.Date, d.Normalized)
+			}
+		}
+		return res
+	}
+	var (
+		i       int
+		current NormalizedPrices
+	)
+	for _, t := range dates {
+		for ; i < len(days) && compare.Time(days[i].Date, t) != compare.Greater; i++ {
+			current = days[i].Normalized
+		}
+		add(t, current)
+	}
+	return res
+}
@@ -2,8 +2,10 @@ package journal
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/sboehler/knut/lib/common/date"
 
 	"github.com/shopspring/decimal"
 )
@@ -56,7 +58,7 @@ func TestNormalize(t *testing.T) {
 	com1 := jctx.Commodity("COM1")
 	com2 := jctx.Commodity("COM2")
 	com3 := jctx.Commodity("COM3")
-	// com4 := jctx.Commodity("COM2")
+	aapl, chf, gbp, usd := jctx.Commodity("AAPL"), jctx.Commodity("CHF"), jctx.Commodity("GBP"), jctx.Commodity("USD")
 
 	tests := []struct {
 		desc   string
@@ -116,6 +118,51 @@ func TestNormalize(t *testing.T) {
 				com3: decimal.RequireFromString("1"),
 			},
 		},
+		{
+			desc: "multiple hops",
+			input: []*Price{
+				{Commodity: gbp, Price: decimal.RequireFromString("1.25"), Target: usd},
+				{Commodity: usd, Price: decimal.RequireFromString("0.9"), Target: chf},
+				{Commodity: aapl, Price: decimal.RequireFromString("200"), Target: usd},
+			},
+			target: chf,
+			want: NormalizedPrices{
+				chf:  decimal.RequireFromString("1"),
+				usd:  decimal.RequireFromString("0.9"),
+				gbp:  decimal.RequireFromString("1.125"),
+				aapl: decimal.RequireFromString("180"),
+			},
+		},
+		{
+			desc: "shortest path",
+			input: []*Price{
+				{Commodity: gbp, Price: decimal.RequireFromString("1.25"), Target: usd},
+				{Commodity: usd, Price: decimal.RequireFromString("0.9"), Target: chf},
+				{Commodity: gbp, Price: decimal.RequireFromString("1.1"), Target: chf},
+			},
+			target: chf,
+			want: NormalizedPrices{
+				chf: decimal.RequireFromString("1"),
+				usd: decimal.RequireFromString("0.9"),
+				gbp: decimal.RequireFromString("1.1"),
+			},
+		},
+		{
+			desc: "deterministic path",
+			input: []*Price{
+				{Commodity: aapl, Price: decimal.RequireFromString("200"), Target: usd},
+				{Commodity: aapl, Price: decimal.RequireFromString("150"), Target: gbp},
+				{Commodity: usd, Price: decimal.RequireFromString("0.9"), Target: chf},
+				{Commodity: gbp, Price: decimal.RequireFromString("1.1"), Target: chf},
+			},
+			target: chf,
+			want: NormalizedPrices{
+				chf:  decimal.RequireFromString("1"),
+				usd:  decimal.RequireFromString("0.9"),
+				gbp:  decimal.RequireFromString("1.1"),
+				aapl: decimal.RequireFromString("165"),
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -133,3 +180,82 @@ func TestNormalize(t *testing.T) {
 		})
 	}
 }
+
+func TestPriceHistory(t *testing.T) {
+	jctx := NewContext()
+	chf, usd := jctx.Commodity("CHF"), jctx.Commodity("USD")
+	var (
+		d1 = date.Date(2020, 1, 1)
+		d2 = date.Date(2020, 1, 2)
+		d3 = date.Date(2020, 1, 15)
+	)
+	j := New(jctx)
+	j.AddPrice(&Price{Date: d1, Commodity: usd, Target: chf, Price: decimal.RequireFromString("0.9")})
+	j.AddTransaction(&Transaction{Date: d2})
+	j.AddPrice(&Price{Date: d3, Commodity: usd, Target: chf, Price: decimal.RequireFromString("0.95")})
+	l, err := j.Process(ComputePrices(chf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc  string
+		dates []time.Time
+		want  []PriceQuote
+	}{
+		{
+			desc: "days with prices",
+			want: []PriceQuote{
+				{Date: d1, Commodity: usd, Price: decimal.RequireFromString("0.9")},
+				{Date: d3, Commodity: usd, Price: decimal.RequireFromString("0.95")},
+			},
+		},
+		{
+			desc:  "given dates",
+			dates: []time.Time{date.Date(2019, 12, 31), date.Date(2020, 1, 10), date.Date(2020, 1, 31)},
+			want: []PriceQuote{
+				{Date: date.Date(2020, 1, 10), Commodity: usd, Price: decimal.RequireFromString("0.9")},
+				{Date: date.Date(2020, 1, 31), Commodity: usd, Price: decimal.RequireFromString("0.95")},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got := PriceHistory(l.Days, chf, test.dates)
+
+			if diff := cmp.Diff(test.want, got, cmp.AllowUnexported(Commodity{})); diff != "" {
+				t.Errorf("PriceHistory() returned unexpected quotes (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestComputeLatestPrices(t *testing.T) {
+	jctx := NewContext()
+	chf, usd := jctx.Commodity("CHF"), jctx.Commodity("USD")
+	j := New(jctx)
+	j.AddPrice(&Price{Date: date.Date(2020, 1, 1), Commodity: usd, Target: chf, Price: decimal.RequireFromString("0.9")})
+	j.AddTransaction(&Transaction{Date: date.Date(2020, 1, 2)})
+	j.AddPrice(&Price{Date: date.Date(2020, 1, 15), Commodity: usd, Target: chf, Price: decimal.RequireFromString("0.95")})
+
+	tests := []struct {
+		date time.Time
+		want decimal.Decimal
+	}{
+		{date: date.Date(2020, 1, 10), want: decimal.RequireFromString("0.9")},
+		{date: date.Date(2020, 1, 31), want: decimal.RequireFromString("0.95")},
+	}
+	for _, test := range tests {
+		t.Run(test.date.Format("2006-01-02"), func(t *testing.T) {
+			l, err := j.Process(ComputeLatestPrices(j, chf, test.date))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range l.Days {
+				if got := d.Normalized[usd]; !got.Equal(test.want) {
+					t.Errorf("price of USD on %s is %s, want %s", d.Date.Format("2006-01-02"), got, test.want)
+				}
+			}
+		})
+	}
+}
@@ -19,11 +19,17 @@ import (
 	"io"
 	"strings"
 	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
 )
 
 // Printer prints directives.
 type Printer struct {
 	Padding int
+
+	// Wrap is the width beyond which the descriptions of transactions are
+	// continued on the following lines, or zero to not wrap them.
+	Wrap int
 }
 
 // New creates a new Printer.
@@ -46,8 +52,26 @@ func (p Printer) PrintDirective(w io.Writer, directive Directive) (n int, err er
 		return p.printInclude(w, d)
 	case *Price:
 		return p.printPrice(w, d)
+	case *Rates:
+		return p.printRates(w, d)
+	case *Rename:
+		return p.printRename(w, d)
+	case *Split:
+		return p.printSplit(w, d)
+	case *Budget:
+		return p.printBudget(w, d)
+	case *Auto:
+		return p.printAuto(w, d)
+	case *Valuation:
+		return p.printValuation(w, d)
 	case *Value:
 		return p.printValue(w, d)
+	case *Currency:
+		return p.printCurrency(w, d)
+	case *Declaration:
+		return p.printDeclaration(w, d)
+	case *Option:
+		return p.printOption(w, d)
 	}
 	return 0, fmt.Errorf("unknown directive: %v", directive)
 }
@@ -60,11 +84,34 @@ func (p Printer) printTransaction(w io.Writer, t *Transaction) (n int, err error
 			return n, err
 		}
 	}
-	c, err := fmt.Fprintf(w, "%s \"%s\"", t.Date.Format("2006-01-02"), t.Description)
+	c, err := io.WriteString(w, t.Date.Format("2006-01-02"))
 	n += c
 	if err != nil {
 		return n, err
 	}
+	if t.Flag != Unflagged {
+		c, err = fmt.Fprintf(w, " %c", t.Flag)
+		n += c
+		if err != nil {
+			return n, err
+		}
+	}
+	// the description follows the date and the flag
+	prefix := 10
+	if t.Flag != Unflagged {
+		prefix += 2
+	}
+	for i, part := range p.wrapDescription(prefix, t.Description) {
+		sep := " "
+		if i > 0 {
+			sep = "\n  "
+		}
+		c, err = fmt.Fprintf(w, "%s\"%s\"", sep, part)
+		n += c
+		if err != nil {
+			return n, err
+		}
+	}
 	for _, tag := range t.Tags {
 		c, err := fmt.Fprintf(w, " %s", tag)
 		n += c
@@ -72,16 +119,57 @@ func (p Printer) printTransaction(w io.Writer, t *Transaction) (n int, err error
 			return n, err
 		}
 	}
+	for _, link := range t.Links {
+		c, err := fmt.Fprintf(w, " %s", link)
+		n += c
+		if err != nil {
+			return n, err
+		}
+	}
 	err = p.newline(w, &n)
 	if err != nil {
 		return n, err
 	}
+	c, err = p.printMetadata(w, t.Metadata)
+	n += c
+	if err != nil {
+		return n, err
+	}
+	var (
+		omitted  bool
+		postings []*Posting
+		lines    []string
+		column   int
+	)
 	for i, po := range t.Postings {
 		if i%2 == 0 {
 			continue
 		}
-		d, err := p.printPosting(w, po)
-		n += d
+		if po.Omitted {
+			// the postings of all commodities come from a single line
+			if omitted {
+				continue
+			}
+			omitted = true
+		}
+		var b strings.Builder
+		if _, err := p.printPosting(&b, po); err != nil {
+			return n, err
+		}
+		postings = append(postings, po)
+		lines = append(lines, b.String())
+		// trailing comments are aligned after the longest commented posting
+		if l := utf8.RuneCountInString(b.String()); po.Comment != "" && l > column {
+			column = l
+		}
+	}
+	for i, po := range postings {
+		line := lines[i]
+		if po.Comment != "" {
+			line += strings.Repeat(" ", column-utf8.RuneCountInString(line)) + " ; " + po.Comment
+		}
+		c, err := io.WriteString(w, line)
+		n += c
 		if err != nil {
 			return n, err
 		}
@@ -89,16 +177,94 @@ func (p Printer) printTransaction(w io.Writer, t *Transaction) (n int, err error
 		if err != nil {
 			return n, err
 		}
+		c, err = p.printMetadata(w, po.Metadata)
+		n += c
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// wrapDescription splits the description into parts at spaces, such that
+// the first line, which starts with a prefix of the given width, and the
+// indented continuation lines do not exceed the width of the printer, as
+// far as possible. The spaces end the parts, such that the concatenation
+// of the parts is the description.
+func (p Printer) wrapDescription(prefix int, desc string) []string {
+	// the first line adds a space and the quotes to the prefix
+	overhead := prefix + 3
+	if p.Wrap <= 0 || strings.Contains(desc, "\n") || overhead+utf8.RuneCountInString(desc) <= p.Wrap {
+		return []string{desc}
+	}
+	var (
+		parts []string
+		part  string
+	)
+	for _, word := range strings.SplitAfter(desc, " ") {
+		if part != "" && overhead+utf8.RuneCountInString(part+word) > p.Wrap {
+			parts = append(parts, part)
+			// continuation lines are indented by two spaces
+			part, overhead = "", 4
+		}
+		part += word
+	}
+	return append(parts, part)
+}
+
+// printMetadata prints each entry of the metadata on its own line.
+func (p Printer) printMetadata(w io.Writer, md Metadata) (n int, err error) {
+	for _, m := range md {
+		c, err := fmt.Fprintf(w, "%s: \"%s\"\n", m.Key, m.Value)
+		n += c
+		if err != nil {
+			return n, err
+		}
 	}
 	return n, nil
 }
 
 func (p Printer) printAccrual(w io.Writer, a *Accrual) (n int, err error) {
-	return fmt.Fprintf(w, "@accrue %s %s %s %s\n", a.Interval, a.Period.Start.Format("2006-01-02"), a.Period.End.Format("2006-01-02"), a.Account)
+	keyword := "accrue"
+	if a.Reverse {
+		keyword = "reverse-accrual"
+	}
+	var b strings.Builder
+	if a.Dates != nil {
+		b.WriteString("schedule")
+		for _, d := range a.Dates {
+			b.WriteString(" " + d.Format("2006-01-02"))
+		}
+	} else {
+		fmt.Fprintf(&b, "%s %s %s", a.Interval, a.Period.Start.Format("2006-01-02"), a.Period.End.Format("2006-01-02"))
+	}
+	if len(a.Weights) > 0 {
+		ws := make([]string, 0, len(a.Weights))
+		for _, w := range a.Weights {
+			ws = append(ws, w.String())
+		}
+		return fmt.Fprintf(w, "@%s %s %s %s\n", keyword, b.String(), a.Account, strings.Join(ws, ","))
+	}
+	return fmt.Fprintf(w, "@%s %s %s\n", keyword, b.String(), a.Account)
 }
 
 func (p Printer) printPosting(w io.Writer, t *Posting) (int, error) {
 	var n int
+	if t.Omitted {
+		c, err := fmt.Fprintf(w, "%s %s", p.rightPad(t.Other), t.Account)
+		n += c
+		if err != nil {
+			return n, err
+		}
+		for _, tag := range t.Tags {
+			c, err = fmt.Fprintf(w, " %s", tag)
+			n += c
+			if err != nil {
+				return n, err
+			}
+		}
+		return n, nil
+	}
 	c, err := fmt.Fprintf(w, "%s %s %s %s", p.rightPad(t.Other), p.rightPad(t.Account), leftPad(10, t.Amount.String()), t.Commodity.Name())
 	n += c
 	if err != nil {
@@ -127,6 +293,24 @@ func (p Printer) printPosting(w io.Writer, t *Posting) (int, error) {
 			return n, err
 		}
 	}
+	if t.Conversion != nil {
+		op := "@"
+		if t.Conversion.Total {
+			op = "@@"
+		}
+		c, err = fmt.Fprintf(w, " %s %s %s", op, t.Conversion.Price, t.Conversion.Commodity.Name())
+		n += c
+		if err != nil {
+			return n, err
+		}
+	}
+	for _, tag := range t.Tags {
+		c, err = fmt.Fprintf(w, " %s", tag)
+		n += c
+		if err != nil {
+			return n, err
+		}
+	}
 	return n, nil
 }
 
@@ -153,10 +337,20 @@ func (p Printer) printLot(w io.Writer, l *Lot) (int, error) {
 }
 
 func (p Printer) printOpen(w io.Writer, o *Open) (int, error) {
+	if len(o.Commodities) > 0 {
+		names := make([]string, 0, len(o.Commodities))
+		for _, c := range o.Commodities {
+			names = append(names, c.Name())
+		}
+		return fmt.Fprintf(w, "%s open %s %s", o.Date.Format("2006-01-02"), o.Account, strings.Join(names, ","))
+	}
 	return fmt.Fprintf(w, "%s open %s", o.Date.Format("2006-01-02"), o.Account)
 }
 
 func (p Printer) printClose(w io.Writer, c *Close) (int, error) {
+	if c.Residual != nil {
+		return fmt.Fprintf(w, "%s close %s %s", c.Date.Format("2006-01-02"), c.Account, c.Residual)
+	}
 	return fmt.Fprintf(w, "%s close %s", c.Date.Format("2006-01-02"), c.Account)
 }
 
@@ -168,10 +362,55 @@ func (p Printer) printInclude(w io.Writer, i *Include) (int, error) {
 	return fmt.Fprintf(w, "include \"%s\"", i.Path)
 }
 
+func (p Printer) printRates(w io.Writer, r *Rates) (int, error) {
+	return fmt.Fprintf(w, "rates \"%s\" %s %s", r.Path, r.Commodity.Name(), r.Target.Name())
+}
+
+func (p Printer) printCurrency(w io.Writer, c *Currency) (int, error) {
+	return fmt.Fprintf(w, "currency %s", c.Commodity.Name())
+}
+
+func (p Printer) printDeclaration(w io.Writer, d *Declaration) (int, error) {
+	return fmt.Fprintf(w, "commodity %s", d.Commodity.Name())
+}
+
+func (p Printer) printOption(w io.Writer, o *Option) (int, error) {
+	return fmt.Fprintf(w, "option %s", o.Name)
+}
+
+func (p Printer) printRename(w io.Writer, r *Rename) (int, error) {
+	if r.Ratio.Equal(decimal.NewFromInt(1)) {
+		return fmt.Fprintf(w, "%s rename %s %s", r.Date.Format("2006-01-02"), r.Commodity.Name(), r.Target.Name())
+	}
+	return fmt.Fprintf(w, "%s rename %s %s %s", r.Date.Format("2006-01-02"), r.Commodity.Name(), r.Target.Name(), r.Ratio)
+}
+
+func (p Printer) printSplit(w io.Writer, s *Split) (int, error) {
+	return fmt.Fprintf(w, "%s split %s %s:%s", s.Date.Format("2006-01-02"), s.Commodity.Name(), s.Numerator, s.Denominator)
+}
+
 func (p Printer) printAssertion(w io.Writer, a *Assertion) (int, error) {
+	if a.Subtree {
+		return fmt.Fprintf(w, "%s balance %s* %s %s", a.Date.Format("2006-01-02"), a.Account, a.Amount, a.Commodity.Name())
+	}
 	return fmt.Fprintf(w, "%s balance %s %s %s", a.Date.Format("2006-01-02"), a.Account, a.Amount, a.Commodity.Name())
 }
 
+func (p Printer) printBudget(w io.Writer, b *Budget) (int, error) {
+	if b.Alert.IsZero() {
+		return fmt.Fprintf(w, "%s budget %s %s %s", b.Date.Format("2006-01-02"), b.Account, b.Amount, b.Commodity.Name())
+	}
+	return fmt.Fprintf(w, "%s budget %s %s %s alert %s%%", b.Date.Format("2006-01-02"), b.Account, b.Amount, b.Commodity.Name(), b.Alert.Shift(2))
+}
+
+func (p Printer) printAuto(w io.Writer, a *Auto) (int, error) {
+	return fmt.Fprintf(w, "%s auto \"%s\" %s %s %s%%", a.Date.Format("2006-01-02"), a.Accounts, a.Credit, a.Debit, a.Ratio.Shift(2))
+}
+
+func (p Printer) printValuation(w io.Writer, v *Valuation) (int, error) {
+	return fmt.Fprintf(w, "%s valuation %s %s", v.Date.Format("2006-01-02"), v.Account, v.Target)
+}
+
 func (p Printer) printValue(w io.Writer, v *Value) (int, error) {
 	return fmt.Fprintf(w, "%s value %s %s %s", v.Date.Format("2006-01-02"), v.Account, v.Amount, v.Commodity.Name())
 }
@@ -220,6 +459,56 @@ func (p *Printer) PrintLedger(w io.Writer, l *Ledger) (int, error) {
 				return n, err
 			}
 		}
+		for _, r := range day.Renames {
+			if err := p.writeLn(w, r, &n); err != nil {
+				return n, err
+			}
+		}
+		if len(day.Renames) > 0 {
+			if err := p.newline(w, &n); err != nil {
+				return n, err
+			}
+		}
+		for _, s := range day.Splits {
+			if err := p.writeLn(w, s, &n); err != nil {
+				return n, err
+			}
+		}
+		if len(day.Splits) > 0 {
+			if err := p.newline(w, &n); err != nil {
+				return n, err
+			}
+		}
+		for _, b := range day.Budgets {
+			if err := p.writeLn(w, b, &n); err != nil {
+				return n, err
+			}
+		}
+		if len(day.Budgets) > 0 {
+			if err := p.newline(w, &n); err != nil {
+				return n, err
+			}
+		}
+		for _, a := range day.Autos {
+			if err := p.writeLn(w, a, &n); err != nil {
+				return n, err
+			}
+		}
+		if len(day.Autos) > 0 {
+			if err := p.newline(w, &n); err != nil {
+				return n, err
+			}
+		}
+		for _, v := range day.Valuations {
+			if err := p.writeLn(w, v, &n); err != nil {
+				return n, err
+			}
+		}
+		if len(day.Valuations) > 0 {
+			if err := p.newline(w, &n); err != nil {
+				return n, err
+			}
+		}
 		for _, a := range day.Assertions {
 			if err := p.writeLn(w, a, &n); err != nil {
 				return n, err
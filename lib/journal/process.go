@@ -1,11 +1,14 @@
 package journal
 
 import (
+	"encoding/csv"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
 	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/dict"
 	"github.com/sboehler/knut/lib/common/filter"
 	"github.com/sboehler/knut/lib/common/mapper"
 	"github.com/sboehler/knut/lib/common/set"
@@ -18,22 +21,36 @@ func NoOp[T any](_ T) error {
 	return nil
 }
 
-// Error is a processing error, with a reference to a directive with
-// a source location.
-type Error struct {
-	directive Directive
-	msg       string
+// recentPostings keeps the most recent postings per account and commodity,
+// to help locating missing bookings when an assertion fails.
+type recentPostings map[Key][]recentPosting
+
+type recentPosting struct {
+	transaction *Transaction
+	posting     *Posting
 }
 
-func (be Error) Error() string {
-	var (
-		p Printer
-		b strings.Builder
-	)
-	fmt.Fprintf(&b, "%s:\n", be.directive.Position().Start)
-	p.PrintDirective(&b, be.directive)
-	fmt.Fprintf(&b, "\n%s\n", be.msg)
-	return b.String()
+const maxRecentPostings = 5
+
+func (rp recentPostings) add(t *Transaction, p *Posting) {
+	k := AccountCommodityKey(p.Account, p.Commodity)
+	ps := append(rp[k], recentPosting{t, p})
+	if len(ps) > maxRecentPostings {
+		ps = ps[len(ps)-maxRecentPostings:]
+	}
+	rp[k] = ps
+}
+
+func (rp recentPostings) describe(w io.Writer, k Key) {
+	ps := rp[k]
+	if len(ps) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nmost recent postings:")
+	for i := len(ps) - 1; i >= 0; i-- {
+		t, p := ps[i].transaction, ps[i].posting
+		fmt.Fprintf(w, "\n  %s %q %s %s %s", t.Date.Format("2006-01-02"), t.Description, p.Other, p.Amount, p.Commodity.Name())
+	}
 }
 
 // ComputePrices updates prices.
@@ -57,17 +74,135 @@ func ComputePrices(v *Commodity) DayFn {
 	}
 }
 
+// ComputeLatestPrices sets the prices of every day to the latest prices
+// known at the given date, such that the whole journal is valuated
+// uniformly at these prices.
+func ComputeLatestPrices(j *Journal, v *Commodity, t time.Time) DayFn {
+	if v == nil {
+		return NoOp[*Day]
+	}
+	latest := LatestPrices(j, v, t)
+	return func(day *Day) error {
+		day.Normalized = latest
+		return nil
+	}
+}
+
+// LatestPrices returns the latest prices in v known at the given date.
+func LatestPrices(j *Journal, v *Commodity, t time.Time) NormalizedPrices {
+	prc := make(Prices)
+	for _, day := range dict.SortedValues(j.Days, CompareDays) {
+		if day.Date.After(t) {
+			break
+		}
+		for _, p := range day.Prices {
+			prc.Insert(p.Commodity, p.Price, p.Target)
+		}
+	}
+	return prc.Normalize(v)
+}
+
 // Balance balances the journal.
 func Balance(jctx Context, v *Commodity) DayFn {
 	amounts, values := make(Amounts), make(Amounts)
 	accounts := set.New[*Account]()
+	recent := make(recentPostings)
+
+	// permitted holds the permitted commodities of accounts whose open
+	// directive restricts them.
+	permitted := make(map[*Account][]*Commodity)
 
 	processOpenings := func(d *Day) error {
 		for _, o := range d.Openings {
 			if accounts.Has(o.Account) {
-				return Error{o, "account is already open"}
+				return Error{
+					Code:      ErrAccountAlreadyOpen,
+					Directive: o,
+					Message:   "account is already open",
+					Fix:       "remove the duplicate open directive",
+				}
 			}
 			accounts.Add(o.Account)
+			if len(o.Commodities) > 0 {
+				permitted[o.Account] = o.Commodities
+			}
+		}
+		return nil
+	}
+
+	// valuations holds the valuation directives by account.
+	valuations := make(map[*Account]*Valuation)
+
+	processValuations := func(d *Day) error {
+		for _, v := range d.Valuations {
+			if _, ok := valuations[v.Account]; ok {
+				return Error{
+					Code:      ErrDuplicateValuation,
+					Directive: v,
+					Message:   fmt.Sprintf("valuation account of %s is already overridden", v.Account),
+					Fix:       "remove the duplicate valuation directive",
+				}
+			}
+			valuations[v.Account] = v
+			if d.Restored {
+				continue
+			}
+			for _, a := range []*Account{v.Account, v.Target} {
+				if !accounts.Has(a) {
+					return Error{
+						Code:      ErrAccountNotOpen,
+						Directive: v,
+						Message:   fmt.Sprintf("account %s is not open", a),
+						Fix:       fmt.Sprintf("add \"%s open %s\" before this directive", v.Date.Format("2006-01-02"), a),
+					}
+				}
+			}
+		}
+		return nil
+	}
+
+	// autos holds the active auto rules, in the order of their declaration.
+	var autos []*Auto
+
+	processAutos := func(d *Day) error {
+		for _, a := range d.Autos {
+			i := 0
+			for i < len(autos) && (autos[i].Accounts.String() != a.Accounts.String() || autos[i].Credit != a.Credit || autos[i].Debit != a.Debit) {
+				i++
+			}
+			switch {
+			case i == len(autos):
+				if !a.Ratio.IsZero() {
+					autos = append(autos, a)
+				}
+			case a.Ratio.IsZero():
+				autos = append(autos[:i], autos[i+1:]...)
+			default:
+				autos[i] = a
+			}
+		}
+		if d.Restored {
+			return nil
+		}
+		for _, t := range d.Transactions {
+			for _, a := range autos {
+				for _, p := range t.Postings {
+					if !a.Accounts.MatchString(p.Account.Name()) {
+						continue
+					}
+					d.Transactions = append(d.Transactions, TransactionBuilder{
+						Date:        t.Date,
+						Description: fmt.Sprintf("Auto %s%% of %s (%s)", a.Ratio.Shift(2), p.Account.Name(), t.Description),
+						Flag:        t.Flag,
+						Postings: PostingBuilder{
+							Credit:    a.Credit,
+							Debit:     a.Debit,
+							Commodity: p.Commodity,
+							Amount:    p.Amount.Mul(a.Ratio),
+						}.Build(),
+					}.Build())
+				}
+			}
 		}
 		return nil
 	}
@@ -76,10 +211,24 @@ func Balance(jctx Context, v *Commodity) DayFn {
 		for _, t := range d.Transactions {
 			for _, p := range t.Postings {
 				if !accounts.Has(p.Account) {
-					return Error{t, fmt.Sprintf("account %s is not open", p.Account)}
+					return Error{
+						Code:      ErrAccountNotOpen,
+						Directive: t,
+						Message:   fmt.Sprintf("account %s is not open", p.Account),
+						Fix:       fmt.Sprintf("add \"%s open %s\" before this transaction", t.Date.Format("2006-01-02"), p.Account),
+					}
+				}
+				if cs, ok := permitted[p.Account]; ok && !containsCommodity(cs, p.Commodity) {
+					return Error{
+						Code:      ErrCommodityNotAllowed,
+						Directive: t,
+						Message:   fmt.Sprintf("commodity %s is not allowed in account %s", p.Commodity.Name(), p.Account),
+						Fix:       fmt.Sprintf("book %s to another account or add it to the open directive of %s", p.Commodity.Name(), p.Account),
+					}
 				}
 				if p.Account.IsAL() {
 					amounts.Add(AccountCommodityKey(p.Account, p.Commodity), p.Amount)
+					recent.add(t, p)
 				}
 			}
 		}
@@ -89,7 +238,12 @@ func Balance(jctx Context, v *Commodity) DayFn {
 	processValues := func(d *Day) error {
 		for _, v := range d.Values {
 			if !accounts.Has(v.Account) {
-				return Error{v, "account is not open"}
+				return Error{
+					Code:      ErrAccountNotOpen,
+					Directive: v,
+					Message:   "account is not open",
+					Fix:       fmt.Sprintf("add \"%s open %s\" before this directive", v.Date.Format("2006-01-02"), v.Account),
+				}
 			}
 			valAcc := jctx.ValuationAccountFor(v.Account)
 			amount := v.Amount.Sub(amounts.Amount(AccountCommodityKey(v.Account, v.Commodity)))
@@ -111,14 +265,177 @@ func Balance(jctx Context, v *Commodity) DayFn {
 		return nil
 	}
 
+	processRenames := func(d *Day) error {
+		for _, r := range d.Renames {
+			var positions []Key
+			for pos, amount := range amounts {
+				if pos.Commodity == r.Commodity && !amount.IsZero() {
+					positions = append(positions, pos)
+				}
+			}
+			compare.Sort(positions, func(k1, k2 Key) compare.Order {
+				return CompareAccounts(k1.Account, k2.Account)
+			})
+			for _, pos := range positions {
+				var (
+					amount = amounts[pos]
+					valAcc = jctx.ValuationAccountFor(pos.Account)
+					target = amount.Mul(r.Ratio)
+				)
+				d.generate(r, TransactionBuilder{
+					Date:        r.Date,
+					Description: fmt.Sprintf("Rename %s to %s in %s", r.Commodity.Name(), r.Target.Name(), pos.Account.Name()),
+					Postings: PostingBuilders{
+						{Credit: pos.Account, Debit: valAcc, Commodity: r.Commodity, Amount: amount},
+						{Credit: valAcc, Debit: pos.Account, Commodity: r.Target, Amount: target},
+					}.Build(),
+				}.Build())
+				amounts.Add(pos, amount.Neg())
+				amounts.Add(AccountCommodityKey(pos.Account, r.Target), target)
+			}
+		}
+		return nil
+	}
+
+	processSplits := func(d *Day) error {
+		for _, s := range d.Splits {
+			var positions []Key
+			for pos, amount := range amounts {
+				if pos.Commodity == s.Commodity && !amount.IsZero() {
+					positions = append(positions, pos)
+				}
+			}
+			compare.Sort(positions, func(k1, k2 Key) compare.Order {
+				return CompareAccounts(k1.Account, k2.Account)
+			})
+			for _, pos := range positions {
+				amount := amounts[pos]
+				delta := s.Apply(amount).Sub(amount)
+				t := TransactionBuilder{
+					Date:        s.Date,
+					Description: fmt.Sprintf("Split %s %s:%s in %s", s.Commodity.Name(), s.Numerator, s.Denominator, pos.Account.Name()),
+					Postings: PostingBuilder{
+						Credit:    jctx.ValuationAccountFor(pos.Account),
+						Debit:     pos.Account,
+						Commodity: s.Commodity,
+						Amount:    delta,
+					}.Build(),
+				}.Build()
+				for _, p := range t.Postings {
+					if p.Account == pos.Account {
+						recent.add(t, p)
+					}
+				}
+				d.generate(s, t)
+				amounts.Add(pos, delta)
+			}
+		}
+		return nil
+	}
+
+	// checkSubtree checks an assertion on the combined balance of an
+	// account and its descendants.
+	checkSubtree := func(a *Assertion) error {
+		var (
+			va        decimal.Decimal
+			positions []Key
+		)
+		for pos, amount := range amounts {
+			if pos.Commodity == a.Commodity && a.Account.Contains(pos.Account) {
+				va = va.Add(amount)
+				positions = append(positions, pos)
+			}
+		}
+		if va.Equal(a.Amount) {
+			return nil
+		}
+		compare.Sort(positions, func(k1, k2 Key) compare.Order {
+			return CompareAccounts(k1.Account, k2.Account)
+		})
+		var b strings.Builder
+		fmt.Fprintf(&b, "account and its subaccounts have position: %s %s (difference: %s %s)", va, a.Commodity.Name(), a.Amount.Sub(va), a.Commodity.Name())
+		for _, pos := range positions {
+			fmt.Fprintf(&b, "\n  %s: %s %s", pos.Account.Name(), amounts[pos], a.Commodity.Name())
+		}
+		return Error{
+			Code:      ErrAssertionFailed,
+			Directive: a,
+			Message:   b.String(),
+			Fix:       fmt.Sprintf("book the missing %s %s or correct the assertion", a.Amount.Sub(va), a.Commodity.Name()),
+		}
+	}
+
 	processAssertions := func(d *Day) error {
 		for _, a := range d.Assertions {
+			if a.Subtree {
+				if err := checkSubtree(a); err != nil {
+					return err
+				}
+				continue
+			}
 			if !accounts.Has(a.Account) {
-				return Error{a, "account is not open"}
+				return Error{
+					Code:      ErrAccountNotOpen,
+					Directive: a,
+					Message:   "account is not open",
+					Fix:       fmt.Sprintf("add \"%s open %s\" before this directive", a.Date.Format("2006-01-02"), a.Account),
+				}
 			}
 			position := AccountCommodityKey(a.Account, a.Commodity)
 			if va, ok := amounts[position]; !ok || !va.Equal(a.Amount) {
-				return Error{a, fmt.Sprintf("account has position: %s %s", va, position.Commodity.Name())}
+				var b strings.Builder
+				fmt.Fprintf(&b, "account has position: %s %s (difference: %s %s)", va, position.Commodity.Name(), a.Amount.Sub(va), position.Commodity.Name())
+				recent.describe(&b, position)
+				return Error{
+					Code:       ErrAssertionFailed,
+					Directive:  a,
+					Message:    b.String(),
+					Fix:        fmt.Sprintf("book the missing %s %s or correct the assertion", a.Amount.Sub(va), position.Commodity.Name()),
+					Difference: a.Amount.Sub(va),
+				}
+			}
+		}
+		return nil
+	}
+
+	processResiduals := func(d *Day) error {
+		for _, c := range d.Closings {
+			if c.Residual == nil {
+				continue
+			}
+			if !accounts.Has(c.Residual) {
+				return Error{
+					Code:      ErrAccountNotOpen,
+					Directive: c,
+					Message:   fmt.Sprintf("account %s is not open", c.Residual),
+					Fix:       fmt.Sprintf("add \"%s open %s\" before this directive", c.Date.Format("2006-01-02"), c.Residual),
+				}
+			}
+			var positions []Key
+			for pos, amount := range amounts {
+				if pos.Account == c.Account && !amount.IsZero() {
+					positions = append(positions, pos)
+				}
+			}
+			compare.Sort(positions, func(k1, k2 Key) compare.Order {
+				return CompareCommodities(k1.Commodity, k2.Commodity)
+			})
+			for _, pos := range positions {
+				amount := amounts[pos]
+				d.Transactions = append(d.Transactions, TransactionBuilder{
+					Date:        c.Date,
+					Description: fmt.Sprintf("Book remaining %s in %s to %s", pos.Commodity.Name(), c.Account.Name(), c.Residual.Name()),
+					Postings: PostingBuilder{
+						Credit:    c.Account,
+						Debit:     c.Residual,
+						Commodity: pos.Commodity,
+						Amount:    amount,
+					}.Build(),
+				}.Build())
+				amounts.Add(pos, amount.Neg())
+				if c.Residual.IsAL() {
+					amounts.Add(AccountCommodityKey(c.Residual, pos.Commodity), amount)
+				}
 			}
 		}
 		return nil
@@ -131,25 +448,53 @@ func Balance(jctx Context, v *Commodity) DayFn {
 					continue
 				}
 				if !amount.IsZero() {
-					return Error{c, fmt.Sprintf("account has nonzero position: %s %s", amount, pos.Commodity.Name())}
+					return Error{
+						Code:      ErrNonzeroPosition,
+						Directive: c,
+						Message:   fmt.Sprintf("account has nonzero position: %s %s", amount, pos.Commodity.Name()),
+						Fix:       fmt.Sprintf("book the remaining %s %s to another account before closing", amount, pos.Commodity.Name()),
+					}
 				}
 				delete(amounts, pos)
 			}
 			if !accounts.Has(c.Account) {
-				return Error{c, "account is not open"}
+				return Error{
+					Code:      ErrAccountNotOpen,
+					Directive: c,
+					Message:   "account is not open",
+					Fix:       "remove the close directive or open the account first",
+				}
 			}
 			accounts.Remove(c.Account)
+			delete(permitted, c.Account)
 		}
 		return nil
 	}
 
 	valuateTransactions := func(d *Day) error {
 		for _, t := range d.Transactions {
+			if d.Restored {
+				for _, posting := range t.Postings {
+					if posting.Account.IsAL() {
+						values.Add(AccountCommodityKey(posting.Account, posting.Commodity), posting.Value)
+					}
+				}
+				continue
+			}
+			if _, ok := d.Origins[t].(*Split); ok {
+				// splits only adjust quantities
+				continue
+			}
 			for _, posting := range t.Postings {
 				if v != posting.Commodity {
 					v, err := d.Normalized.Valuate(posting.Commodity, posting.Amount)
 					if err != nil {
-						return err
+						return Error{
+							Code:      ErrNoPrice,
+							Directive: t,
+							Message:   err.Error(),
+							Fix:       fmt.Sprintf("add a price directive for %s on or before %s", posting.Commodity.Name(), t.Date.Format("2006-01-02")),
+						}
 					}
 					posting.Value = v
 				} else {
@@ -202,15 +547,30 @@ func Balance(jctx Context, v *Commodity) DayFn {
 		if err := processOpenings(d); err != nil {
 			return err
 		}
+		if err := processValuations(d); err != nil {
+			return err
+		}
+		if err := processAutos(d); err != nil {
+			return err
+		}
 		if err := processTransactions(d); err != nil {
 			return err
 		}
+		if err := processRenames(d); err != nil {
+			return err
+		}
+		if err := processSplits(d); err != nil {
+			return err
+		}
 		if err := processValues(d); err != nil {
 			return err
 		}
 		if err := processAssertions(d); err != nil {
 			return err
 		}
+		if err := processResiduals(d); err != nil {
+			return err
+		}
 		if v != nil {
 			if err := valuateTransactions(d); err != nil {
 				return err
@@ -226,6 +586,15 @@ func Balance(jctx Context, v *Commodity) DayFn {
 	}
 }
 
+func containsCommodity(cs []*Commodity, c *Commodity) bool {
+	for _, c2 := range cs {
+		if c2 == c {
+			return true
+		}
+	}
+	return false
+}
+
 // Balance balances the journal.
 func CloseAccounts(j *Journal, ds []time.Time) DayFn {
 	var (
@@ -299,6 +668,12 @@ func Query(f filter.Filter[Key], m mapper.Mapper[Key], v *Commodity, c Collectio
 					Commodity:   b.Commodity,
 					Valuation:   v,
 					Description: t.Description,
+					Member:      t.Member(),
+					Flag:        t.Flag,
+					Tags:        t.PostingTags(b),
+					Links:       t.JoinedLinks(),
+					Metadata:    joinMetadata(t.Metadata, b.Metadata),
+					Transaction: t,
 				}
 				if f(kc) {
 					c.Insert(m(kc), amt)
@@ -308,3 +683,53 @@ func Query(f filter.Filter[Key], m mapper.Mapper[Key], v *Commodity, c Collectio
 		return nil
 	}
 }
+
+// CSVHeader is the header of the rows written by WriteCSV.
+var CSVHeader = []string{"date", "account", "other", "commodity", "amount", "value", "description", "tags"}
+
+// WriteCSV writes the postings matching the filter as CSV rows. The value
+// column is empty if v is nil.
+func WriteCSV(w *csv.Writer, f filter.Filter[Key], v *Commodity) DayFn {
+	if f == nil {
+		f = filter.AllowAll[Key]
+	}
+	return func(d *Day) error {
+		for _, t := range d.Transactions {
+			for _, p := range t.Postings {
+				k := Key{
+					Date:        t.Date,
+					Account:     p.Account,
+					Other:       p.Other,
+					Commodity:   p.Commodity,
+					Valuation:   v,
+					Description: t.Description,
+					Member:      t.Member(),
+					Flag:        t.Flag,
+					Tags:        t.PostingTags(p),
+					Links:       t.JoinedLinks(),
+					Metadata:    joinMetadata(t.Metadata, p.Metadata),
+				}
+				if !f(k) {
+					continue
+				}
+				var value string
+				if v != nil {
+					value = p.Value.String()
+				}
+				if err := w.Write([]string{
+					t.Date.Format("2006-01-02"),
+					p.Account.Name(),
+					p.Other.Name(),
+					p.Commodity.Name(),
+					p.Amount.String(),
+					value,
+					t.Description,
+					k.Tags,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,541 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/shopspring/decimal"
+)
+
+func TestBalanceAssertionError(t *testing.T) {
+	var (
+		jctx   = NewContext()
+		bank   = jctx.Account("Assets:Bank")
+		salary = jctx.Account("Income:Salary")
+		chf    = jctx.Commodity("CHF")
+		d1     = date.Date(2022, 1, 1)
+		d2     = date.Date(2022, 1, 2)
+		j      = New(jctx)
+	)
+	j.AddOpen(&Open{Date: d1, Account: bank})
+	j.AddOpen(&Open{Date: d1, Account: salary})
+	j.AddTransaction(TransactionBuilder{
+		Date:        d1,
+		Description: "Salary",
+		Postings: PostingBuilder{
+			Credit:    salary,
+			Debit:     bank,
+			Commodity: chf,
+			Amount:    decimal.NewFromInt(100),
+		}.Build(),
+	}.Build())
+	j.AddAssertion(&Assertion{Date: d2, Account: bank, Commodity: chf, Amount: decimal.NewFromInt(150)})
+
+	_, err := j.Process(Balance(jctx, nil))
+
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	for _, want := range []string{
+		"account has position: 100 CHF (difference: 50 CHF)",
+		`2022-01-01 "Salary" Income:Salary 100 CHF`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%s", want, err.Error())
+		}
+	}
+}
+
+func TestBalanceRename(t *testing.T) {
+	var (
+		jctx      = NewContext()
+		portfolio = jctx.Account("Assets:Portfolio")
+		equity    = jctx.Account("Equity:Equity")
+		csgn      = jctx.Commodity("CSGN")
+		ubsg      = jctx.Commodity("UBSG")
+		d1        = date.Date(2023, 1, 1)
+		d2        = date.Date(2023, 6, 12)
+		j         = New(jctx)
+	)
+	j.AddOpen(&Open{Date: d1, Account: portfolio})
+	j.AddOpen(&Open{Date: d1, Account: equity})
+	j.AddTransaction(TransactionBuilder{
+		Date:        d1,
+		Description: "Buy",
+		Postings: PostingBuilder{
+			Credit:    equity,
+			Debit:     portfolio,
+			Commodity: csgn,
+			Amount:    decimal.NewFromInt(1000),
+		}.Build(),
+	}.Build())
+	j.AddRename(&Rename{Date: d2, Commodity: csgn, Target: ubsg, Ratio: decimal.RequireFromString("0.04448")})
+	j.AddAssertion(&Assertion{Date: d2, Account: portfolio, Commodity: ubsg, Amount: decimal.RequireFromString("44.48")})
+	j.AddAssertion(&Assertion{Date: d2, Account: portfolio, Commodity: csgn, Amount: decimal.Zero})
+
+	if _, err := j.Process(Balance(jctx, nil)); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+}
+
+func TestBalanceSplit(t *testing.T) {
+	var (
+		jctx      = NewContext()
+		portfolio = jctx.Account("Assets:Portfolio")
+		equity    = jctx.Account("Equity:Equity")
+		aapl      = jctx.Commodity("AAPL")
+		usd       = jctx.Commodity("USD")
+		d1        = date.Date(2024, 1, 1)
+		d2        = date.Date(2024, 6, 10)
+		j         = New(jctx)
+	)
+	j.AddOpen(&Open{Date: d1, Account: portfolio})
+	j.AddOpen(&Open{Date: d1, Account: equity})
+	j.AddPrice(&Price{Date: d1, Commodity: aapl, Target: usd, Price: decimal.NewFromInt(200)})
+	j.AddPrice(&Price{Date: d2, Commodity: aapl, Target: usd, Price: decimal.NewFromInt(50)})
+	j.AddTransaction(TransactionBuilder{
+		Date:        d1,
+		Description: "Buy",
+		Postings: PostingBuilder{
+			Credit:    equity,
+			Debit:     portfolio,
+			Commodity: aapl,
+			Amount:    decimal.NewFromInt(10),
+		}.Build(),
+	}.Build())
+	j.AddSplit(&Split{Date: d2, Commodity: aapl, Numerator: decimal.NewFromInt(4), Denominator: decimal.NewFromInt(1)})
+	j.AddAssertion(&Assertion{Date: d2, Account: portfolio, Commodity: aapl, Amount: decimal.NewFromInt(40)})
+
+	l, err := j.Process(ComputePrices(usd), Balance(jctx, usd))
+
+	if err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	for _, d := range l.Days {
+		for _, trx := range d.Transactions {
+			for _, p := range trx.Postings {
+				if p.Account.IsIE() && !p.Value.IsZero() {
+					t.Errorf("%s: unexpected valuation gain %s in %s", d.Date.Format("2006-01-02"), p.Value, p.Account)
+				}
+			}
+		}
+	}
+}
+
+func TestBalanceSplitAssertionError(t *testing.T) {
+	var (
+		jctx      = NewContext()
+		portfolio = jctx.Account("Assets:Portfolio")
+		equity    = jctx.Account("Equity:Equity")
+		aapl      = jctx.Commodity("AAPL")
+		d1        = date.Date(2024, 1, 1)
+		d2        = date.Date(2024, 6, 10)
+		j         = New(jctx)
+	)
+	j.AddOpen(&Open{Date: d1, Account: portfolio})
+	j.AddOpen(&Open{Date: d1, Account: equity})
+	j.AddTransaction(TransactionBuilder{
+		Date:        d1,
+		Description: "Buy",
+		Postings: PostingBuilder{
+			Credit:    equity,
+			Debit:     portfolio,
+			Commodity: aapl,
+			Amount:    decimal.NewFromInt(10),
+		}.Build(),
+	}.Build())
+	j.AddSplit(&Split{Date: d2, Commodity: aapl, Numerator: decimal.NewFromInt(4), Denominator: decimal.NewFromInt(1)})
+	j.AddAssertion(&Assertion{Date: d2, Account: portfolio, Commodity: aapl, Amount: decimal.NewFromInt(10)})
+
+	_, err := j.Process(Balance(jctx, nil))
+
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if want := `2024-06-10 "Split AAPL 4:1 in Assets:Portfolio" Income:Investments:CapitalGain:Portfolio 30 AAPL`; !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error to contain %q, got:\n%s", want, err.Error())
+	}
+}
+
+func TestBalanceSplitNonTerminatingRatio(t *testing.T) {
+	for _, test := range []struct {
+		numerator, denominator, amount, want int64
+	}{
+		{1, 3, 300, 100},
+		{2, 3, 300, 200},
+		{3, 7, 700, 300},
+	} {
+		t.Run(fmt.Sprintf("%d:%d", test.numerator, test.denominator), func(t *testing.T) {
+			var (
+				jctx      = NewContext()
+				portfolio = jctx.Account("Assets:Portfolio")
+				equity    = jctx.Account("Equity:Equity")
+				xyz       = jctx.Commodity("XYZ")
+				d1        = date.Date(2024, 1, 1)
+				d2        = date.Date(2024, 6, 10)
+				j         = New(jctx)
+			)
+			j.AddOpen(&Open{Date: d1, Account: portfolio})
+			j.AddOpen(&Open{Date: d1, Account: equity})
+			j.AddTransaction(TransactionBuilder{
+				Date:        d1,
+				Description: "Buy",
+				Postings: PostingBuilder{
+					Credit:    equity,
+					Debit:     portfolio,
+					Commodity: xyz,
+					Amount:    decimal.NewFromInt(test.amount),
+				}.Build(),
+			}.Build())
+			j.AddSplit(&Split{Date: d2, Commodity: xyz, Numerator: decimal.NewFromInt(test.numerator), Denominator: decimal.NewFromInt(test.denominator)})
+			j.AddAssertion(&Assertion{Date: d2, Account: portfolio, Commodity: xyz, Amount: decimal.NewFromInt(test.want)})
+
+			if _, err := j.Process(Balance(jctx, nil)); err != nil {
+				t.Fatalf("Process() returned unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestBalanceAuto(t *testing.T) {
+	var (
+		jctx      = NewContext()
+		bank      = jctx.Account("Assets:Bank")
+		savings   = jctx.Account("Assets:Savings")
+		groceries = jctx.Account("Expenses:Groceries")
+		chf       = jctx.Commodity("CHF")
+		d1        = date.Date(2024, 1, 1)
+		d2        = date.Date(2024, 2, 1)
+		d3        = date.Date(2024, 3, 1)
+		j         = New(jctx)
+	)
+	for _, a := range []*Account{bank, savings, groceries} {
+		j.AddOpen(&Open{Date: d1, Account: a})
+	}
+	for _, d := range []time.Time{d1, d2, d3} {
+		j.AddTransaction(TransactionBuilder{
+			Date:        d,
+			Description: "Groceries",
+			Postings: PostingBuilder{
+				Credit:    bank,
+				Debit:     groceries,
+				Commodity: chf,
+				Amount:    decimal.NewFromInt(200),
+			}.Build(),
+		}.Build())
+	}
+	j.AddAuto(&Auto{Date: d2, Accounts: regexp.MustCompile("^Expenses:"), Credit: bank, Debit: savings, Ratio: decimal.RequireFromString("0.1")})
+	j.AddAuto(&Auto{Date: d3, Accounts: regexp.MustCompile("^Expenses:"), Credit: bank, Debit: savings, Ratio: decimal.Zero})
+	j.AddAssertion(&Assertion{Date: d3, Account: savings, Commodity: chf, Amount: decimal.NewFromInt(20)})
+	j.AddAssertion(&Assertion{Date: d3, Account: bank, Commodity: chf, Amount: decimal.NewFromInt(-620)})
+
+	l, err := j.Process(Balance(jctx, nil))
+
+	if err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	var got []string
+	for _, d := range l.Days {
+		for _, t := range d.Transactions {
+			got = append(got, t.Description)
+		}
+	}
+	want := []string{"Groceries", "Auto 10% of Expenses:Groceries (Groceries)", "Groceries", "Groceries"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Process() returned unexpected transactions (-want/+got):\n%s", diff)
+	}
+}
+
+func TestBalanceSubtreeAssertion(t *testing.T) {
+	var (
+		jctx   = NewContext()
+		equity = jctx.Account("Equity:Equity")
+		stocks = jctx.Account("Assets:Portfolio:Stocks")
+		cash   = jctx.Account("Assets:Portfolio:Cash")
+		bank   = jctx.Account("Assets:Bank")
+		usd    = jctx.Commodity("USD")
+		d1     = date.Date(2022, 1, 1)
+		d2     = date.Date(2022, 1, 2)
+	)
+	tests := []struct {
+		desc   string
+		amount int64
+		want   []string
+	}{
+		{desc: "valid", amount: 150},
+		{
+			desc:   "invalid",
+			amount: 200,
+			want: []string{
+				"account and its subaccounts have position: 150 USD (difference: 50 USD)",
+				"Assets:Portfolio:Cash: 50 USD",
+				"Assets:Portfolio:Stocks: 100 USD",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			j := New(jctx)
+			for _, a := range []*Account{equity, stocks, cash, bank} {
+				j.AddOpen(&Open{Date: d1, Account: a})
+			}
+			j.AddTransaction(TransactionBuilder{
+				Date:        d1,
+				Description: "Deposit",
+				Postings: PostingBuilders{
+					{Credit: equity, Debit: stocks, Commodity: usd, Amount: decimal.NewFromInt(100)},
+					{Credit: equity, Debit: cash, Commodity: usd, Amount: decimal.NewFromInt(50)},
+					{Credit: equity, Debit: bank, Commodity: usd, Amount: decimal.NewFromInt(1000)},
+				}.Build(),
+			}.Build())
+			j.AddAssertion(&Assertion{Date: d2, Account: jctx.Account("Assets:Portfolio"), Commodity: usd, Amount: decimal.NewFromInt(test.amount), Subtree: true})
+
+			_, err := j.Process(Balance(jctx, nil))
+
+			if len(test.want) == 0 {
+				if err != nil {
+					t.Fatalf("Process() returned unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+			for _, want := range test.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q, got:\n%s", want, err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestBalanceCloseResidual(t *testing.T) {
+	var (
+		jctx     = NewContext()
+		equity   = jctx.Account("Equity:Equity")
+		residual = jctx.Account("Equity:Residual")
+		bank     = jctx.Account("Assets:Bank")
+		chf      = jctx.Commodity("CHF")
+		usd      = jctx.Commodity("USD")
+		d1       = date.Date(2022, 1, 1)
+		d2       = date.Date(2022, 1, 2)
+		j        = New(jctx)
+	)
+	for _, a := range []*Account{equity, residual, bank} {
+		j.AddOpen(&Open{Date: d1, Account: a})
+	}
+	j.AddPrice(&Price{Date: d1, Commodity: usd, Target: chf, Price: decimal.NewFromInt(1)})
+	j.AddPrice(&Price{Date: d2, Commodity: usd, Target: chf, Price: decimal.RequireFromString("0.9")})
+	j.AddTransaction(TransactionBuilder{
+		Date:        d1,
+		Description: "Deposit",
+		Postings: PostingBuilder{
+			Credit:    equity,
+			Debit:     bank,
+			Commodity: usd,
+			Amount:    decimal.NewFromInt(100),
+		}.Build(),
+	}.Build())
+	j.AddClose(&Close{Date: d2, Account: bank, Residual: residual})
+
+	l, err := j.Process(ComputePrices(chf), Balance(jctx, chf))
+
+	if err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	var got []string
+	for _, trx := range l.Days[1].Transactions {
+		for _, p := range trx.Postings {
+			if p.Account == bank {
+				got = append(got, fmt.Sprintf("%s: %s USD, %s CHF", trx.Description, p.Amount, p.Value))
+			}
+		}
+	}
+	want := []string{
+		"Book remaining USD in Assets:Bank to Equity:Residual: -100 USD, -90 CHF",
+		"Adjust value of USD in account Assets:Bank: 0 USD, -10 CHF",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Process() returned unexpected postings (-want/+got):\n%s", diff)
+	}
+}
+
+func TestBalanceOpenCommodities(t *testing.T) {
+	var (
+		jctx   = NewContext()
+		bank   = jctx.Account("Assets:Bank")
+		salary = jctx.Account("Income:Salary")
+		chf    = jctx.Commodity("CHF")
+		eur    = jctx.Commodity("EUR")
+		usd    = jctx.Commodity("USD")
+		d1     = date.Date(2022, 1, 1)
+	)
+	tests := []struct {
+		desc      string
+		commodity *Commodity
+		want      string
+	}{
+		{desc: "permitted", commodity: eur},
+		{desc: "not permitted", commodity: usd, want: "commodity USD is not allowed in account Assets:Bank"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			j := New(jctx)
+			j.AddOpen(&Open{Date: d1, Account: bank, Commodities: []*Commodity{chf, eur}})
+			j.AddOpen(&Open{Date: d1, Account: salary})
+			j.AddTransaction(TransactionBuilder{
+				Date:        d1,
+				Description: "Salary",
+				Postings: PostingBuilder{
+					Credit:    salary,
+					Debit:     bank,
+					Commodity: test.commodity,
+					Amount:    decimal.NewFromInt(100),
+				}.Build(),
+			}.Build())
+
+			_, err := j.Process(Balance(jctx, nil))
+
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("Process() returned unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("expected error to contain %q, got:\n%s", test.want, err.Error())
+			}
+		})
+	}
+}
+
+func TestBalanceValuationAccount(t *testing.T) {
+	var (
+		jctx    = NewContext()
+		equity  = jctx.Account("Equity:Equity")
+		pension = jctx.Account("Assets:Pension")
+		income  = jctx.Account("Income:Pension")
+		chf     = jctx.Commodity("CHF")
+		usd     = jctx.Commodity("USD")
+		d1      = date.Date(2022, 1, 1)
+		d2      = date.Date(2022, 1, 2)
+		j       = New(jctx)
+	)
+	for _, a := range []*Account{equity, pension, income} {
+		j.AddOpen(&Open{Date: d1, Account: a})
+	}
+	j.AddValuation(&Valuation{Date: d1, Account: pension, Target: income})
+	j.AddPrice(&Price{Date: d1, Commodity: usd, Target: chf, Price: decimal.NewFromInt(1)})
+	j.AddPrice(&Price{Date: d2, Commodity: usd, Target: chf, Price: decimal.RequireFromString("1.1")})
+	j.AddTransaction(TransactionBuilder{
+		Date:        d1,
+		Description: "Deposit",
+		Postings: PostingBuilder{
+			Credit:    equity,
+			Debit:     pension,
+			Commodity: usd,
+			Amount:    decimal.NewFromInt(100),
+		}.Build(),
+	}.Build())
+	j.AddTransaction(TransactionBuilder{
+		Date:        d2,
+		Description: "Deposit",
+		Postings: PostingBuilder{
+			Credit:    equity,
+			Debit:     pension,
+			Commodity: usd,
+			Amount:    decimal.NewFromInt(1),
+		}.Build(),
+	}.Build())
+
+	l, err := j.Process(ComputePrices(chf), Balance(jctx, chf))
+
+	if err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	var got []string
+	for _, trx := range l.Days[1].Transactions {
+		for _, p := range trx.Postings {
+			if p.Account == pension && p.Amount.IsZero() {
+				got = append(got, fmt.Sprintf("%s: %s %s CHF", trx.Description, p.Other, p.Value))
+			}
+		}
+	}
+	want := []string{
+		"Adjust value of USD in account Assets:Pension: Income:Pension 10 CHF",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Process() returned unexpected postings (-want/+got):\n%s", diff)
+	}
+}
+
+func TestBalanceValuationAccountError(t *testing.T) {
+	var (
+		jctx    = NewContext()
+		pension = jctx.Account("Assets:Pension")
+		income  = jctx.Account("Income:Pension")
+		d1      = date.Date(2022, 1, 1)
+	)
+	tests := []struct {
+		desc       string
+		valuations []*Valuation
+		want       string
+	}{
+		{
+			desc:       "target not open",
+			valuations: []*Valuation{{Date: d1, Account: pension, Target: jctx.Account("Income:Other")}},
+			want:       "account Income:Other is not open",
+		},
+		{
+			desc: "duplicate",
+			valuations: []*Valuation{
+				{Date: d1, Account: pension, Target: income},
+				{Date: d1, Account: pension, Target: income},
+			},
+			want: "valuation account of Assets:Pension is already overridden",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			j := New(jctx)
+			for _, a := range []*Account{pension, income} {
+				j.AddOpen(&Open{Date: d1, Account: a})
+			}
+			for _, v := range test.valuations {
+				j.AddValuation(v)
+			}
+
+			_, err := j.Process(Balance(jctx, nil))
+
+			if err == nil {
+				t.Fatal("expected an error, got nil")
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("expected error to contain %q, got:\n%s", test.want, err.Error())
+			}
+		})
+	}
+}
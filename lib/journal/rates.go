@@ -0,0 +1,79 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sboehler/knut/lib/common/csvkit"
+	"github.com/sboehler/knut/lib/journal/scanner"
+	"github.com/shopspring/decimal"
+)
+
+// readRates reads the prices referenced by a rates directive from the CSV
+// file at the given path. Each row consists of a date (YYYY-MM-DD) and the
+// price of the commodity in the target commodity. Rows with an invalid date
+// in the first column, such as a header, are skipped.
+func readRates(src Source, r *Rates, path string) ([]*Price, error) {
+	f, err := src.Open(path)
+	if err != nil {
+		return nil, Error{Directive: r, Message: err.Error(), Code: ErrParse}
+	}
+	defer f.Close()
+	reader, err := csvkit.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	reader.FieldsPerRecord = -1
+	var (
+		res  []*Price
+		line int
+	)
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(rec) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected date and price, got %v", path, line, rec)
+		}
+		d, err := time.Parse("2006-01-02", strings.TrimSpace(rec[0]))
+		if err != nil {
+			continue
+		}
+		price, err := decimal.NewFromString(strings.TrimSpace(rec[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid price %q: %w", path, line, rec[1], err)
+		}
+		res = append(res, &Price{
+			Range: Range{
+				Path:  path,
+				Start: scanner.Location{Line: line, Column: 1},
+				End:   scanner.Location{Line: line, Column: 1},
+			},
+			Date:      d,
+			Commodity: r.Commodity,
+			Target:    r.Target,
+			Price:     price,
+		})
+	}
+}
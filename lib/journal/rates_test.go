@@ -0,0 +1,68 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sboehler/knut/lib/common/cpr"
+)
+
+func TestRates(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"journal.knut": "rates \"rates/eurchf.csv\" EUR CHF\n",
+		"rates/eurchf.csv": "Date;Rate\n" +
+			"2022-01-03;1.0367\n" +
+			"2022-01-04;1.0395\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var (
+		ctx  = context.Background()
+		jctx = NewContext()
+		p    = RecursiveParser{Context: jctx, File: filepath.Join(dir, "journal.knut")}
+		got  []string
+	)
+
+	err := cpr.Consume(ctx, p.Parse(ctx), func(d any) error {
+		switch t := d.(type) {
+		case error:
+			return t
+		case *Price:
+			got = append(got, fmt.Sprintf("%s %s %s %s", t.Date.Format("2006-01-02"), t.Commodity.Name(), t.Price, t.Target.Name()))
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Parse() returned unexpected error: %v", err)
+	}
+	want := []string{"2022-01-03 EUR 1.0367 CHF", "2022-01-04 EUR 1.0395 CHF"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected diff (-want, +got):\n%s", diff)
+	}
+}
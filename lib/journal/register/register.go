@@ -44,6 +44,12 @@ type Renderer struct {
 	ShowSource         bool
 	ShowDescriptions   bool
 	SortAlphabetically bool
+
+	// CollapseSplits renders the postings of a transaction which only
+	// differ in the other account as a single row, with the other account
+	// shown as "(split)". It requires the keys of the report to hold
+	// their transaction.
+	CollapseSplits bool
 }
 
 func (rn *Renderer) Render(r *Report) *table.Table {
@@ -59,7 +65,7 @@ func (rn *Renderer) Render(r *Report) *table.Table {
 	}
 	tbl := table.New(cols...)
 	tbl.AddSeparatorRow()
-	header := tbl.AddRow().AddText("Date", table.Center)
+	header := tbl.AddHeaderRow().AddText("Date", table.Center)
 	if rn.ShowSource {
 		header.AddText("Source", table.Center)
 	}
@@ -88,7 +94,11 @@ func (rn *Renderer) renderNode(tbl *table.Table, n *Node) {
 	} else {
 		cmp = compareAccount
 	}
-	idx := n.Amounts.Index(cmp)
+	amounts := n.Amounts
+	if rn.CollapseSplits {
+		amounts = collapseSplits(amounts)
+	}
+	idx := amounts.Index(cmp)
 	for i, k := range idx {
 		row := tbl.AddRow()
 		if i == 0 {
@@ -99,8 +109,12 @@ func (rn *Renderer) renderNode(tbl *table.Table, n *Node) {
 		if rn.ShowSource {
 			row.AddText(k.Account.Name(), table.Left)
 		}
-		row.AddText(k.Other.Name(), table.Left)
-		row.AddNumber(n.Amounts[k].Neg())
+		if k.Other == nil {
+			row.AddText("(split)", table.Left)
+		} else {
+			row.AddText(k.Other.Name(), table.Left)
+		}
+		row.AddNumber(amounts[k].Neg())
 		if rn.ShowCommodities {
 			row.AddText(k.Commodity.Name(), table.Left)
 		}
@@ -115,13 +129,74 @@ func (rn *Renderer) renderNode(tbl *table.Table, n *Node) {
 	tbl.AddSeparatorRow()
 }
 
+// collapseSplits merges the keys of each transaction which only differ in
+// the other account. The other account of the merged keys of a transaction
+// with more than one other account is nil. The transactions are dropped
+// from the keys afterwards, such that equal keys of different transactions
+// are merged as well.
+func collapseSplits(amounts journal.Amounts) journal.Amounts {
+	var (
+		others = make(map[journal.Key]*journal.Account)
+		split  = make(map[journal.Key]bool)
+	)
+	for k := range amounts {
+		m := k
+		m.Other = nil
+		if o, ok := others[m]; !ok {
+			others[m] = k.Other
+		} else if o != k.Other {
+			split[m] = true
+		}
+	}
+	res := make(journal.Amounts)
+	for k, v := range amounts {
+		m := k
+		m.Other = nil
+		if !split[m] {
+			m.Other = k.Other
+		}
+		m.Transaction = nil
+		res.Add(m, v)
+	}
+	return res
+}
+
 func compareAccount(k1, k2 journal.Key) compare.Order {
-	return journal.CompareAccounts(k1.Other, k2.Other)
+	if c := compareOther(k1.Other, k2.Other); c != compare.Equal {
+		return c
+	}
+	return tieBreak(k1, k2)
 }
 
 func compareAccountAndCommodities(k1, k2 journal.Key) compare.Order {
-	if c := journal.CompareAccounts(k1.Other, k2.Other); c != compare.Equal {
+	if c := compareOther(k1.Other, k2.Other); c != compare.Equal {
+		return c
+	}
+	if c := journal.CompareCommodities(k1.Commodity, k2.Commodity); c != compare.Equal {
+		return c
+	}
+	return tieBreak(k1, k2)
+}
+
+// tieBreak orders the rows of the same other account deterministically,
+// by source account and description.
+func tieBreak(k1, k2 journal.Key) compare.Order {
+	if c := compareOther(k1.Account, k2.Account); c != compare.Equal {
 		return c
 	}
-	return journal.CompareCommodities(k1.Commodity, k2.Commodity)
+	return compare.Ordered(k1.Description, k2.Description)
+}
+
+// compareOther compares other accounts, with the nil account of collapsed
+// splits last.
+func compareOther(a1, a2 *journal.Account) compare.Order {
+	switch {
+	case a1 == a2:
+		return compare.Equal
+	case a1 == nil:
+		return compare.Greater
+	case a2 == nil:
+		return compare.Smaller
+	}
+	return journal.CompareAccounts(a1, a2)
 }
@@ -0,0 +1,76 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"encoding/json"
+
+	"github.com/shopspring/decimal"
+)
+
+type jsonModel struct {
+	Dates    []string `json:"dates"`
+	AL       []Row    `json:"al"`
+	EIE      []Row    `json:"eie"`
+	TotalAL  []Row    `json:"totalAL"`
+	TotalEIE []Row    `json:"totalEIE"`
+	Delta    []Row    `json:"delta"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (m Model) MarshalJSON() ([]byte, error) {
+	dates := make([]string, 0, len(m.Dates))
+	for _, d := range m.Dates {
+		dates = append(dates, d.Format("2006-01-02"))
+	}
+	return json.Marshal(jsonModel{
+		Dates:    dates,
+		AL:       nonNil(m.AL),
+		EIE:      nonNil(m.EIE),
+		TotalAL:  nonNil(m.TotalAL),
+		TotalEIE: nonNil(m.TotalEIE),
+		Delta:    nonNil(m.Delta),
+	})
+}
+
+type jsonRow struct {
+	Account   string            `json:"account,omitempty"`
+	Depth     int               `json:"depth"`
+	Commodity string            `json:"commodity,omitempty"`
+	Values    []decimal.Decimal `json:"values"`
+}
+
+// MarshalJSON implements json.Marshaler. Values are encoded as strings to
+// preserve their precision.
+func (r Row) MarshalJSON() ([]byte, error) {
+	res := jsonRow{Depth: r.Depth, Values: r.Values}
+	if r.Account != nil {
+		res.Account = r.Account.Name()
+	}
+	if r.Commodity != nil {
+		res.Commodity = r.Commodity.Name()
+	}
+	if res.Values == nil {
+		res.Values = []decimal.Decimal{}
+	}
+	return json.Marshal(res)
+}
+
+func nonNil(rows []Row) []Row {
+	if rows == nil {
+		return []Row{}
+	}
+	return rows
+}
@@ -15,88 +15,249 @@
 package report
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/dict"
 	"github.com/sboehler/knut/lib/common/mapper"
+	"github.com/sboehler/knut/lib/common/set"
 	"github.com/sboehler/knut/lib/common/table"
 	"github.com/sboehler/knut/lib/journal"
 	"github.com/shopspring/decimal"
 )
 
+// Pivot selects the columns of a report.
+type Pivot int
+
+const (
+	// PivotDates shows a column per date.
+	PivotDates Pivot = iota
+	// PivotTags shows a column per combination of tags.
+	PivotTags
+	// PivotCommodities shows a column per commodity.
+	PivotCommodities
+)
+
 // Renderer renders a report.
 type Renderer struct {
 	ShowCommodities    bool
 	SortAlphabetically bool
 	Diff               bool
+	Totals             bool
+
+	// PercentOfTotal adds a column after each date with the share of the
+	// row in the total of its section, such as Assets or Expenses.
+	PercentOfTotal bool
+
+	// PercentChange adds a column after each date with the change of the
+	// row versus the previous date.
+	PercentChange bool
 
-	dates []time.Time
+	// Rolling adds a column after each date with the average of the row
+	// over the trailing Rolling dates, if it is greater than zero.
+	Rolling int
+
+	// Pivot selects the columns of the report. Reports pivoted by tags or
+	// commodities show the totals over all dates, and reports pivoted by
+	// commodities ignore ShowCommodities.
+	Pivot Pivot
+
+	// ISOWeeks titles the date columns with the ISO 8601 week of the
+	// date, such as 2020-W05, instead of the date.
+	ISOWeeks bool
+
+	columns []column
 }
 
-// Render renders a report.
-func (rn *Renderer) Render(r *Report) *table.Table {
-	rn.dates = r.dates
+// column is a column of a report.
+type column struct {
+	key   journal.Key
+	title string
+}
+
+// init initializes the columns of the renderer for the given report.
+func (rn *Renderer) init(r *Report) {
 	if !rn.SortAlphabetically {
 		r.ComputeWeights()
 	}
+	rn.columns = nil
+	switch rn.Pivot {
+	case PivotDates:
+		for _, d := range r.dates {
+			title := d.Format("2006-01-02")
+			if rn.ISOWeeks {
+				title = date.ISOWeek(d)
+			}
+			rn.columns = append(rn.columns, column{key: journal.DateKey(d), title: title})
+		}
+	case PivotTags:
+		tags := set.New[string]()
+		for _, am := range rn.totals(r) {
+			for k := range am {
+				tags.Add(k.Tags)
+			}
+		}
+		for _, t := range dict.SortedKeys(tags, compareTags) {
+			title := t
+			if t == "" {
+				title = "(untagged)"
+			}
+			rn.columns = append(rn.columns, column{key: journal.Key{Tags: t}, title: title})
+		}
+	case PivotCommodities:
+		rn.ShowCommodities = false
+		commodities := set.New[*journal.Commodity]()
+		for _, am := range rn.totals(r) {
+			for k := range am {
+				commodities.Add(k.Commodity)
+			}
+		}
+		for _, c := range dict.SortedKeys(commodities, journal.CompareCommodities) {
+			rn.columns = append(rn.columns, column{key: journal.CommodityKey(c), title: c.Name()})
+		}
+	}
+}
+
+// compareTags sorts tags alphabetically, with the untagged column last.
+func compareTags(t1, t2 string) compare.Order {
+	if (t1 == "") != (t2 == "") {
+		if t1 == "" {
+			return compare.Greater
+		}
+		return compare.Smaller
+	}
+	return compare.Ordered(t1, t2)
+}
+
+// keyMapper returns the mapper which maps the keys of the report to the
+// keys of the columns and rows.
+func (rn *Renderer) keyMapper() mapper.Mapper[journal.Key] {
+	km := journal.KeyMapper{
+		Commodity: journal.MapCommodity(rn.ShowCommodities),
+	}
+	switch rn.Pivot {
+	case PivotDates:
+		km.Date = mapper.Identity[time.Time]
+	case PivotTags:
+		km.Tags = mapper.Identity[string]
+	case PivotCommodities:
+		km.Commodity = mapper.Identity[*journal.Commodity]
+	}
+	return km.Build()
+}
+
+// totals returns the totals of the A+L and E+I+E sections.
+func (rn *Renderer) totals(r *Report) [2]journal.Amounts {
+	al, eie := r.Totals(rn.keyMapper())
+	return [2]journal.Amounts{al, eie}
+}
+
+// Render renders a report.
+func (rn *Renderer) Render(r *Report) *table.Table {
+	rn.init(r)
+	columns := len(rn.columns)
+	if rn.PercentOfTotal {
+		columns += len(rn.columns)
+	}
+	if rn.PercentChange {
+		columns += len(rn.columns)
+	}
+	if rn.Rolling > 0 {
+		columns += len(rn.columns)
+	}
 	var tbl *table.Table
 	if rn.ShowCommodities {
-		tbl = table.New(1, 1, len(rn.dates))
+		tbl = table.New(1, 1, columns)
 	} else {
-		tbl = table.New(1, len(rn.dates))
+		tbl = table.New(1, columns)
 	}
 	tbl.AddSeparatorRow()
-	header := tbl.AddRow().AddText("Account", table.Center)
+	header := tbl.AddHeaderRow().AddText("Account", table.Center)
 	if rn.ShowCommodities {
 		header.AddText("Comm", table.Center)
 	}
-	for _, d := range rn.dates {
-		header.AddText(d.Format("2006-01-02"), table.Center)
+	for _, col := range rn.columns {
+		header.AddText(col.title, table.Center)
+		if rn.PercentOfTotal {
+			header.AddText("%", table.Center)
+		}
+		if rn.PercentChange {
+			header.AddText("Δ%", table.Center)
+		}
+		if rn.Rolling > 0 {
+			header.AddText(fmt.Sprintf("Avg %d", rn.Rolling), table.Center)
+		}
 	}
 	tbl.AddSeparatorRow()
 
-	totalAL, totalEIE := r.Totals(journal.KeyMapper{
-		Date:      mapper.Identity[time.Time],
-		Commodity: journal.MapCommodity(rn.ShowCommodities),
-	}.Build())
+	totalAL, totalEIE := r.Totals(rn.keyMapper())
 
+	sections := make(map[journal.AccountType]journal.Amounts)
 	for _, n := range r.AL.Children() {
-		rn.renderNode(tbl, 0, n)
-		tbl.AddEmptyRow()
+		sections[n.Account.Type()] = rn.renderSection(tbl, n)
 	}
-	rn.render(tbl, 0, "Total (A+L)", false, totalAL)
+	rn.render(tbl, 0, "Total (A+L)", false, totalAL, nil)
 	tbl.AddSeparatorRow()
 	for _, n := range r.EIE.Children() {
-		rn.renderNode(tbl, 0, n)
-		tbl.AddEmptyRow()
+		sections[n.Account.Type()] = rn.renderSection(tbl, n)
 	}
-	rn.render(tbl, 0, "Total (E+I+E)", true, totalEIE)
+	rn.render(tbl, 0, "Total (E+I+E)", true, totalEIE, nil)
 	tbl.AddSeparatorRow()
 	totalAL.Plus(totalEIE)
-	rn.render(tbl, 0, "Delta", false, totalAL)
+	rn.render(tbl, 0, "Delta", false, totalAL, nil)
 	tbl.AddSeparatorRow()
+	if rn.Totals {
+		// liabilities and equity have negative balances, so the sums are
+		// the differences A-L and A-L-E
+		net := make(journal.Amounts).Plus(sections[journal.ASSETS]).Plus(sections[journal.LIABILITIES])
+		rn.render(tbl, 0, "Net (A-L)", false, net, nil)
+		check := net.Clone().Plus(sections[journal.EQUITY])
+		rn.render(tbl, 0, "Check (A-L-E)", false, check, nil)
+		tbl.AddSeparatorRow()
+	}
 
 	return tbl
 }
 
-func (rn *Renderer) renderNode(t *table.Table, indent int, n *Node) {
+func (rn *Renderer) renderNode(t *table.Table, indent int, n *Node, total journal.Amounts) {
 	if n.Account != nil {
-		vals := n.Amounts.SumBy(nil, journal.KeyMapper{
-			Date:      mapper.Identity[time.Time],
-			Commodity: journal.MapCommodity(rn.ShowCommodities),
-		}.Build())
-		rn.render(t, indent, n.Account.Segment(), !n.Account.IsAL(), vals)
+		vals := n.Amounts.SumBy(nil, rn.keyMapper())
+		rn.render(t, indent, n.Account.Segment(), !n.Account.IsAL(), vals, total)
 	}
 	for _, ch := range n.Children() {
-		rn.renderNode(t, indent+2, ch)
+		rn.renderNode(t, indent+2, ch, total)
 	}
 }
 
-func (rn *Renderer) render(t *table.Table, indent int, name string, neg bool, vals journal.Amounts) {
+// total computes the total of a top-level node, such as Assets or Income.
+func (rn *Renderer) total(n *Node) journal.Amounts {
+	total := make(journal.Amounts)
+	n.computeTotals(total, rn.keyMapper())
+	return total
+}
+
+// renderSection renders a top-level node, such as Assets or Income, and
+// with Totals its total, which it returns.
+func (rn *Renderer) renderSection(t *table.Table, n *Node) journal.Amounts {
+	total := rn.total(n)
+	rn.renderNode(t, 0, n, total)
+	if rn.Totals {
+		rn.render(t, 0, "Total "+n.Segment(), !n.Account.IsAL(), total, total)
+	}
+	t.AddEmptyRow()
+	return total
+}
+
+// render renders the values of a row. If total is not nil, the share of
+// the values in total is shown with PercentOfTotal.
+func (rn *Renderer) render(t *table.Table, indent int, name string, neg bool, vals, total journal.Amounts) {
 	if len(vals) == 0 {
 		t.AddRow().AddIndented(name, indent).FillEmpty()
 		return
 	}
-	for i, c := range vals.CommoditiesSorted() {
+	for i, c := range rn.commodities(vals) {
 		row := t.AddRow()
 		if i == 0 {
 			row.AddIndented(name, indent)
@@ -106,21 +267,90 @@ func (rn *Renderer) render(t *table.Table, indent int, name string, neg bool, va
 		if rn.ShowCommodities {
 			row.AddText(c.Name(), table.Left)
 		}
-		var total decimal.Decimal
-		for _, d := range rn.dates {
-			v := vals[journal.DateCommodityKey(d, c)]
-			if !rn.Diff {
-				total = total.Add(v)
-				v = total
-			}
-			if neg {
-				v = v.Neg()
-			}
+		var (
+			values = rn.values(vals, c, neg)
+			totals []decimal.Decimal
+		)
+		if total != nil {
+			totals = rn.values(total, c, neg)
+		}
+		for i, v := range values {
 			if v.IsZero() {
 				row.AddEmpty()
 			} else {
 				row.AddNumber(v)
 			}
+			if rn.PercentOfTotal {
+				if totals == nil || totals[i].IsZero() || v.IsZero() {
+					row.AddEmpty()
+				} else {
+					row.AddText(percent(v.Div(totals[i])), table.Right)
+				}
+			}
+			if rn.PercentChange {
+				if i == 0 || values[i-1].IsZero() {
+					row.AddEmpty()
+				} else {
+					row.AddText(percent(v.Sub(values[i-1]).Div(values[i-1].Abs())), table.Right)
+				}
+			}
+			if rn.Rolling > 0 {
+				if avg := average(values, i, rn.Rolling); avg.IsZero() {
+					row.AddEmpty()
+				} else {
+					row.AddNumber(avg)
+				}
+			}
 		}
 	}
 }
+
+// commodities returns the commodities of the rows of the given values.
+func (rn *Renderer) commodities(vals journal.Amounts) []*journal.Commodity {
+	if rn.Pivot == PivotCommodities {
+		return []*journal.Commodity{nil}
+	}
+	return vals.CommoditiesSorted()
+}
+
+// values returns the values to be displayed for the given commodity, one per column.
+func (rn *Renderer) values(vals journal.Amounts, c *journal.Commodity, neg bool) []decimal.Decimal {
+	var (
+		total decimal.Decimal
+		res   = make([]decimal.Decimal, 0, len(rn.columns))
+	)
+	for _, col := range rn.columns {
+		k := col.key
+		if rn.Pivot != PivotCommodities {
+			k.Commodity = c
+		}
+		v := vals[k]
+		if rn.Pivot == PivotDates && !rn.Diff {
+			total = total.Add(v)
+			v = total
+		}
+		if neg {
+			v = v.Neg()
+		}
+		res = append(res, v)
+	}
+	return res
+}
+
+// average returns the average of the n values up to and including index
+// i, or zero if there are less than n values.
+func average(values []decimal.Decimal, i, n int) decimal.Decimal {
+	if i+1 < n {
+		return decimal.Zero
+	}
+	var sum decimal.Decimal
+	for _, v := range values[i+1-n : i+1] {
+		sum = sum.Add(v)
+	}
+	return sum.Div(decimal.NewFromInt(int64(n)))
+}
+
+// percent formats a ratio as a percentage with one decimal.
+func percent(r decimal.Decimal) string {
+	return r.Shift(2).StringFixed(1) + "%"
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"io"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/sboehler/knut/lib/common/mapper"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+)
+
+// Model is a flat representation of a rendered report, which is passed to
+// user-supplied templates.
+type Model struct {
+	Dates                    []time.Time
+	AL, EIE                  []Row
+	TotalAL, TotalEIE, Delta []Row
+}
+
+// Row is a row of a report, with one value per date. Values have the same
+// sign as in the rendered table.
+type Row struct {
+	Account   *journal.Account
+	Depth     int
+	Commodity *journal.Commodity
+	Values    []decimal.Decimal
+}
+
+// Model computes the model of the given report.
+func (rn *Renderer) Model(r *Report) *Model {
+	rn.init(r)
+	km := rn.keyMapper()
+	totalAL, totalEIE := r.Totals(km)
+	res := &Model{
+		Dates:    r.dates,
+		TotalAL:  rn.rows(nil, 0, false, totalAL),
+		TotalEIE: rn.rows(nil, 0, true, totalEIE),
+	}
+	for _, n := range r.AL.Children() {
+		res.AL = rn.appendNode(res.AL, 0, n, km)
+	}
+	for _, n := range r.EIE.Children() {
+		res.EIE = rn.appendNode(res.EIE, 0, n, km)
+	}
+	res.Delta = rn.rows(nil, 0, false, totalAL.Plus(totalEIE))
+	return res
+}
+
+func (rn *Renderer) appendNode(rows []Row, depth int, n *Node, km mapper.Mapper[journal.Key]) []Row {
+	rows = append(rows, rn.rows(n.Account, depth, !n.Account.IsAL(), n.Amounts.SumBy(nil, km))...)
+	for _, ch := range n.Children() {
+		rows = rn.appendNode(rows, depth+1, ch, km)
+	}
+	return rows
+}
+
+func (rn *Renderer) rows(a *journal.Account, depth int, neg bool, vals journal.Amounts) []Row {
+	if len(vals) == 0 {
+		return []Row{{Account: a, Depth: depth}}
+	}
+	var res []Row
+	for _, c := range rn.commodities(vals) {
+		res = append(res, Row{
+			Account:   a,
+			Depth:     depth,
+			Commodity: c,
+			Values:    rn.values(vals, c, neg),
+		})
+	}
+	return res
+}
+
+// TemplateFuncs are the functions available in report templates.
+var TemplateFuncs = template.FuncMap{
+	"date": func(t time.Time) string {
+		return t.Format("2006-01-02")
+	},
+	"round": func(places int32, d decimal.Decimal) string {
+		return d.StringFixed(places)
+	},
+	"add": func(a, b int) int {
+		return a + b
+	},
+}
+
+// ParseTemplate parses the template file at the given path.
+func ParseTemplate(path string) (*template.Template, error) {
+	return template.New(filepath.Base(path)).Funcs(TemplateFuncs).ParseFiles(path)
+}
+
+// RenderTemplate renders the report using the given template.
+func (rn *Renderer) RenderTemplate(r *Report, t *template.Template, w io.Writer) error {
+	return t.Execute(w, rn.Model(r))
+}
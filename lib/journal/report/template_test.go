@@ -0,0 +1,101 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	for _, test := range []struct {
+		desc, template string
+		data           any
+		want           string
+	}{
+		{
+			desc:     "date",
+			template: `{{ date . }}`,
+			data:     time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC),
+			want:     "2022-03-04",
+		},
+		{
+			desc:     "round",
+			template: `{{ round 2 . }}`,
+			data:     decimal.RequireFromString("1.005"),
+			want:     "1.01",
+		},
+		{
+			desc:     "round pads with zeros",
+			template: `{{ round 2 . }}`,
+			data:     decimal.RequireFromString("-3"),
+			want:     "-3.00",
+		},
+		{
+			desc:     "round to integer",
+			template: `{{ round 0 . }}`,
+			data:     decimal.RequireFromString("1234.5"),
+			want:     "1235",
+		},
+		{
+			desc:     "add",
+			template: `{{ add . -1 }}`,
+			data:     3,
+			want:     "2",
+		},
+		{
+			desc:     "pipeline",
+			template: `{{ index . (len . | add -1) | round 1 }}`,
+			data:     []decimal.Decimal{decimal.NewFromInt(1), decimal.RequireFromString("2.25")},
+			want:     "2.3",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.tmpl")
+			if err := os.WriteFile(path, []byte(test.template), 0644); err != nil {
+				t.Fatal(err)
+			}
+			tmpl, err := ParseTemplate(path)
+			if err != nil {
+				t.Fatalf("ParseTemplate() returned unexpected error: %v", err)
+			}
+			var got strings.Builder
+
+			if err := tmpl.Execute(&got, test.data); err != nil {
+				t.Fatalf("Execute() returned unexpected error: %v", err)
+			}
+
+			if got.String() != test.want {
+				t.Errorf("Execute() = %q, want %q", got.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestParseTemplateError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.tmpl")
+	if err := os.WriteFile(path, []byte(`{{ unknown . }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseTemplate(path); err == nil {
+		t.Error("ParseTemplate() did not return an error for an unknown function")
+	}
+}
@@ -26,6 +26,11 @@ type Scanner struct {
 	reader io.RuneReader
 	// current contains the current rune
 	current rune
+	// ahead contains the runes which have been read ahead of current.
+	ahead []rune
+	// line contains the runes of the current line before current, prev
+	// the runes of the previous line.
+	line, prev []rune
 	// Path is the file path.
 	Path string
 	// Location is the current position in the stream.
@@ -67,27 +72,67 @@ func (s *Scanner) Current() rune {
 	return s.current
 }
 
-// ParseError creates a new parser error with the current position.
+// ParseError creates a new parser error with the current position and
+// the source line containing it. An error at the start of an empty line,
+// such as an error detected after the last line of a directive, is
+// reported at the end of the previous line.
 func (s *Scanner) ParseError(err error) error {
-	return fmt.Errorf("%s:%s: %v", s.Path, s.Location, err)
+	res := &Error{
+		Path:     s.Path,
+		Location: s.Location,
+		Line:     string(s.line) + s.restOfLine(),
+		Err:      err,
+	}
+	if res.Location.Column == 1 && res.Line == "" && res.Location.Line > 1 {
+		res.Location.Line--
+		res.Location.Column = len(s.prev) + 1
+		res.Line = string(s.prev)
+	}
+	return res
+}
+
+// restOfLine returns the runes from current to the end of the line,
+// without advancing the scanner.
+func (s *Scanner) restOfLine() string {
+	var b strings.Builder
+	ch := s.current
+	for i := 0; ch != '\n' && ch != EOF; i++ {
+		b.WriteRune(ch)
+		if i == len(s.ahead) {
+			next, _, err := s.reader.ReadRune()
+			if err != nil {
+				break
+			}
+			s.ahead = append(s.ahead, next)
+		}
+		ch = s.ahead[i]
+	}
+	return b.String()
 }
 
 // Advance reads a rune.
 func (s *Scanner) Advance() error {
-	ch, _, err := s.reader.ReadRune()
-	if err != nil {
-		if err != io.EOF {
-			return err
+	var ch rune
+	if len(s.ahead) > 0 {
+		ch, s.ahead = s.ahead[0], s.ahead[1:]
+	} else {
+		var err error
+		if ch, _, err = s.reader.ReadRune(); err != nil {
+			if err != io.EOF {
+				return err
+			}
+			ch = EOF
 		}
-		ch = EOF
 	}
 	s.Location.BytePos += utf8.RuneLen(s.current)
 	s.Location.RunePos++
 	if s.current == '\n' {
 		s.Location.Line++
 		s.Location.Column = 1
+		s.line, s.prev = s.prev[:0], s.line
 	} else {
 		s.Location.Column++
+		s.line = append(s.line, s.current)
 	}
 	s.current = ch
 	return nil
@@ -165,6 +210,39 @@ func (s *Scanner) ReadN(n int) (string, error) {
 	return b.String(), nil
 }
 
+// Error is a syntax error at a location, with the source line containing
+// the location.
+type Error struct {
+	Path     string
+	Location Location
+	Line     string
+	Err      error
+}
+
+// Error implements error. The message is followed by the source line and
+// a caret marking the column of the error.
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:%s: %v\n%s\n", e.Path, e.Location, e.Err, e.Line)
+	for i, ch := range []rune(e.Line) {
+		if i >= e.Location.Column-1 {
+			break
+		}
+		if ch == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	b.WriteRune('^')
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 // Location describes a location in the Scanner's stream.
 type Location struct {
 	BytePos, RunePos, Line, Column int
@@ -15,6 +15,7 @@
 package scanner
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -45,3 +46,27 @@ func TestWithoutBacktracking(t *testing.T) {
 		t.Fatalf("Expected EOF, got %c", c)
 	}
 }
+
+func TestParseError(t *testing.T) {
+	s := "a\tbc\nde"
+	b, err := New(strings.NewReader(s), "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Advance()
+	b.Advance()
+
+	err = b.ParseError(errors.New("invalid"))
+
+	if want := "file:1:3: invalid\na\tbc\n \t^"; err.Error() != want {
+		t.Fatalf("Expected %q, got %q", want, err.Error())
+	}
+	var got strings.Builder
+	for b.Current() != EOF {
+		got.WriteRune(b.Current())
+		b.Advance()
+	}
+	if want := "bc\nde"; got.String() != want {
+		t.Fatalf("Expected %q after the error, got %q", want, got.String())
+	}
+}
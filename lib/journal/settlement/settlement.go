@@ -0,0 +1,208 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package settlement computes what the members of a household, who keep a
+// single journal, owe each other.
+package settlement
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/common/set"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+)
+
+// Owner assigns the accounts matching a regex to a member. Expenses paid
+// from these accounts are paid by the member.
+type Owner struct {
+	Member string
+	Regex  *regexp.Regexp
+}
+
+// ParseOwner parses an owner of the form <member>=<regex>.
+func ParseOwner(s string) (Owner, error) {
+	m, rx, ok := strings.Cut(s, "=")
+	if !ok || m == "" {
+		return Owner{}, fmt.Errorf("invalid owner %q, expected <member>=<regex>", s)
+	}
+	r, err := regexp.Compile(rx)
+	if err != nil {
+		return Owner{}, err
+	}
+	return Owner{Member: m, Regex: r}, nil
+}
+
+// Settlement is a collection which accumulates the expenses paid and
+// consumed by each member. Expenses of transactions tagged with
+// #member:<name> are consumed by that member, all others are shared
+// equally. Expenses paid from an account without an owner are paid by all
+// members equally.
+type Settlement struct {
+	owners   []Owner
+	members  set.Set[string]
+	paid     map[string]decimal.Decimal
+	consumed map[string]decimal.Decimal
+}
+
+// New creates a new settlement.
+func New(owners []Owner) *Settlement {
+	s := &Settlement{
+		owners:   owners,
+		members:  set.New[string](),
+		paid:     make(map[string]decimal.Decimal),
+		consumed: make(map[string]decimal.Decimal),
+	}
+	for _, o := range owners {
+		s.members.Add(o.Member)
+	}
+	return s
+}
+
+// Insert inserts a posting. Only postings on expense accounts are
+// considered.
+func (s *Settlement) Insert(k journal.Key, v decimal.Decimal) {
+	if k.Account == nil || k.Account.Type() != journal.EXPENSES {
+		return
+	}
+	if k.Member != "" {
+		s.members.Add(k.Member)
+	}
+	payer := s.owner(k.Other)
+	s.paid[payer] = s.paid[payer].Add(v)
+	s.consumed[k.Member] = s.consumed[k.Member].Add(v)
+}
+
+func (s *Settlement) owner(a *journal.Account) string {
+	if a == nil {
+		return ""
+	}
+	for _, o := range s.owners {
+		if o.Regex.MatchString(a.Name()) {
+			return o.Member
+		}
+	}
+	return ""
+}
+
+// Balance is the balance of a member. A positive balance means that the
+// member is owed money.
+type Balance struct {
+	Member                  string
+	Paid, Consumed, Balance decimal.Decimal
+}
+
+// Transfer is a payment which settles the balances.
+type Transfer struct {
+	From, To string
+	Amount   decimal.Decimal
+}
+
+// Balances returns the balances of the members, sorted by name, with the
+// shared amounts split equally among them. The balances are rounded to the
+// given number of digits.
+func (s *Settlement) Balances(digits int32) []Balance {
+	members := dict.SortedKeys(s.members, compare.Ordered[string])
+	if len(members) == 0 {
+		return nil
+	}
+	n := decimal.NewFromInt(int64(len(members)))
+	res := make([]Balance, 0, len(members))
+	for _, m := range members {
+		b := Balance{
+			Member:   m,
+			Paid:     s.paid[m].Add(s.paid[""].Div(n)).Round(digits),
+			Consumed: s.consumed[m].Add(s.consumed[""].Div(n)).Round(digits),
+		}
+		b.Balance = b.Paid.Sub(b.Consumed)
+		res = append(res, b)
+	}
+	return res
+}
+
+// Transfers returns transfers which settle the given balances. Members who
+// owe the most pay first, to those who are owed the most.
+func Transfers(bs []Balance) []Transfer {
+	var debtors, creditors []Balance
+	for _, b := range bs {
+		switch b.Balance.Sign() {
+		case -1:
+			debtors = append(debtors, Balance{Member: b.Member, Balance: b.Balance.Neg()})
+		case 1:
+			creditors = append(creditors, b)
+		}
+	}
+	byAmount := func(bs []Balance) func(i, j int) bool {
+		return func(i, j int) bool {
+			if c := bs[i].Balance.Cmp(bs[j].Balance); c != 0 {
+				return c > 0
+			}
+			return bs[i].Member < bs[j].Member
+		}
+	}
+	sort.SliceStable(debtors, byAmount(debtors))
+	sort.SliceStable(creditors, byAmount(creditors))
+	var res []Transfer
+	for len(debtors) > 0 && len(creditors) > 0 {
+		d, c := &debtors[0], &creditors[0]
+		amt := decimal.Min(d.Balance, c.Balance)
+		res = append(res, Transfer{From: d.Member, To: c.Member, Amount: amt})
+		d.Balance = d.Balance.Sub(amt)
+		c.Balance = c.Balance.Sub(amt)
+		if d.Balance.IsZero() {
+			debtors = debtors[1:]
+		}
+		if c.Balance.IsZero() {
+			creditors = creditors[1:]
+		}
+	}
+	return res
+}
+
+// Render renders the balances and the transfers settling them.
+func Render(bs []Balance) *table.Table {
+	tbl := table.New(1, 1, 1, 1)
+	tbl.AddSeparatorRow()
+	tbl.AddHeaderRow().
+		AddText("Member", table.Center).
+		AddText("Paid", table.Center).
+		AddText("Consumed", table.Center).
+		AddText("Balance", table.Center)
+	tbl.AddSeparatorRow()
+	for _, b := range bs {
+		tbl.AddRow().
+			AddText(b.Member, table.Left).
+			AddNumber(b.Paid).
+			AddNumber(b.Consumed).
+			AddNumber(b.Balance)
+	}
+	tbl.AddSeparatorRow()
+	if ts := Transfers(bs); len(ts) > 0 {
+		for _, t := range ts {
+			tbl.AddRow().
+				AddText(t.From, table.Left).
+				AddText("pays", table.Left).
+				AddText(t.To, table.Left).
+				AddNumber(t.Amount)
+		}
+		tbl.AddSeparatorRow()
+	}
+	return tbl
+}
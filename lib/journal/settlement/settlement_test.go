@@ -0,0 +1,80 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package settlement
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestSettlement(t *testing.T) {
+	var (
+		jctx      = journal.NewContext()
+		joint     = jctx.Account("Assets:Joint")
+		alice     = jctx.Account("Assets:Alice")
+		bob       = jctx.Account("Liabilities:Bob")
+		groceries = jctx.Account("Expenses:Groceries")
+		clothing  = jctx.Account("Expenses:Clothing")
+	)
+	s := New([]Owner{
+		{Member: "alice", Regex: regexp.MustCompile("^Assets:Alice")},
+		{Member: "bob", Regex: regexp.MustCompile("^Liabilities:Bob")},
+	})
+	insert := func(member string, from, to *journal.Account, amount int64) {
+		s.Insert(journal.Key{Account: to, Other: from, Member: member}, decimal.NewFromInt(amount))
+		s.Insert(journal.Key{Account: from, Other: to, Member: member}, decimal.NewFromInt(-amount))
+	}
+	insert("", alice, groceries, 120)
+	insert("", bob, groceries, 30)
+	insert("bob", joint, clothing, 100)
+	insert("alice", bob, clothing, 80)
+	insert("carol", joint, clothing, 10)
+
+	got := s.Balances(2)
+
+	want := []Balance{
+		{Member: "alice", Paid: decimal.RequireFromString("156.67"), Consumed: decimal.NewFromInt(130), Balance: decimal.RequireFromString("26.67")},
+		{Member: "bob", Paid: decimal.RequireFromString("146.67"), Consumed: decimal.NewFromInt(150), Balance: decimal.RequireFromString("-3.33")},
+		{Member: "carol", Paid: decimal.RequireFromString("36.67"), Consumed: decimal.NewFromInt(60), Balance: decimal.RequireFromString("-23.33")},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Balances() returned unexpected diff (-want/+got):\n%s\n", diff)
+	}
+}
+
+func TestTransfers(t *testing.T) {
+	bs := []Balance{
+		{Member: "alice", Balance: decimal.NewFromInt(50)},
+		{Member: "bob", Balance: decimal.NewFromInt(-20)},
+		{Member: "carol", Balance: decimal.NewFromInt(-40)},
+		{Member: "dave", Balance: decimal.NewFromInt(10)},
+	}
+
+	got := Transfers(bs)
+
+	want := []Transfer{
+		{From: "carol", To: "alice", Amount: decimal.NewFromInt(40)},
+		{From: "bob", To: "alice", Amount: decimal.NewFromInt(10)},
+		{From: "bob", To: "dave", Amount: decimal.NewFromInt(10)},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("Transfers() returned unexpected diff (-want/+got):\n%s\n", diff)
+	}
+}
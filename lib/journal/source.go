@@ -0,0 +1,240 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/natefinch/atomic"
+)
+
+// Source provides access to the files of a journal, such as a directory,
+// a git repository or files held in memory.
+type Source interface {
+	// Open opens the file at the given path for reading.
+	Open(path string) (io.ReadCloser, error)
+
+	// List returns the paths of the files matching the glob pattern, in
+	// lexical order.
+	List(pattern string) ([]string, error)
+
+	// Watch sends the path of each of the given files when it changes,
+	// until the context is done.
+	Watch(ctx context.Context, paths []string) (<-chan string, error)
+
+	// Write replaces the contents of the file at the given path with
+	// what write writes. Readers never see a partially written file.
+	Write(path string, write func(io.Writer) error) error
+}
+
+// FileSystem is the Source of files on the local file system.
+type FileSystem struct {
+	// Interval is the interval at which Watch polls the modification
+	// times of the files. It defaults to one second.
+	Interval time.Duration
+}
+
+var _ Source = FileSystem{}
+
+// Open implements Source.
+func (FileSystem) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// List implements Source.
+func (FileSystem) List(pattern string) ([]string, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Watch implements Source.
+func (fsys FileSystem) Watch(ctx context.Context, paths []string) (<-chan string, error) {
+	interval := fsys.Interval
+	if interval == 0 {
+		interval = time.Second
+	}
+	modTime := func(p string) time.Time {
+		info, err := os.Stat(p)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	times := make([]time.Time, len(paths))
+	for i, p := range paths {
+		times[i] = modTime(p)
+	}
+	return poll(ctx, interval, paths, func(i int) bool {
+		t := modTime(paths[i])
+		changed := !t.Equal(times[i])
+		times[i] = t
+		return changed
+	}), nil
+}
+
+// Write implements Source. The file is replaced atomically.
+func (FileSystem) Write(path string, write func(io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	return atomic.WriteFile(path, &buf)
+}
+
+// poll calls changed for every path at the given interval and sends the
+// paths for which it returns true.
+func poll(ctx context.Context, interval time.Duration, paths []string, changed func(int) bool) <-chan string {
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for i, p := range paths {
+				if !changed(i) {
+					continue
+				}
+				select {
+				case ch <- p:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// Memory is a Source which holds files in memory, e.g. for tests or for
+// journals received over the network. It is safe for concurrent use.
+type Memory struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	watchers map[string][]chan<- string
+}
+
+var _ Source = (*Memory)(nil)
+
+// NewMemory creates a Source holding the given files, keyed by path.
+func NewMemory(files map[string]string) *Memory {
+	m := &Memory{
+		files:    make(map[string][]byte),
+		watchers: make(map[string][]chan<- string),
+	}
+	for p, content := range files {
+		m.files[path.Clean(p)] = []byte(content)
+	}
+	return m
+}
+
+// Open implements Source.
+func (m *Memory) Open(p string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	content, ok := m.files[path.Clean(p)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// List implements Source.
+func (m *Memory) List(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []string
+	for p := range m.files {
+		if ok, _ := path.Match(path.Clean(pattern), p); ok {
+			res = append(res, p)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// Watch implements Source. Changes are sent when files are written.
+func (m *Memory) Watch(ctx context.Context, paths []string) (<-chan string, error) {
+	ch := make(chan string, len(paths))
+	m.mu.Lock()
+	for _, p := range paths {
+		p = path.Clean(p)
+		m.watchers[p] = append(m.watchers[p], ch)
+	}
+	m.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for _, p := range paths {
+			p = path.Clean(p)
+			ws := m.watchers[p][:0]
+			for _, w := range m.watchers[p] {
+				if w != ch {
+					ws = append(ws, w)
+				}
+			}
+			m.watchers[p] = ws
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// Write implements Source. Watchers which are not ready to receive miss
+// the change.
+func (m *Memory) Write(p string, write func(io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return err
+	}
+	p = path.Clean(p)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[p] = buf.Bytes()
+	for _, w := range m.watchers[p] {
+		select {
+		case w <- p:
+		default:
+		}
+	}
+	return nil
+}
+
+// errReadOnly is returned when writing to a read-only source.
+func errReadOnly(s Source, path string) error {
+	return fmt.Errorf("%s: cannot write to read-only source %T", path, s)
+}
@@ -0,0 +1,360 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func readAll(t *testing.T, src Source, path string) string {
+	t.Helper()
+	f, err := src.Open(path)
+	if err != nil {
+		t.Fatalf("Open(%q) returned unexpected error: %v", path, err)
+	}
+	defer f.Close()
+	bs, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
+
+func writeString(src Source, path, content string) error {
+	return src.Write(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, content)
+		return err
+	})
+}
+
+func TestMemory(t *testing.T) {
+	src := NewMemory(map[string]string{
+		"main.knut":         "main",
+		"./2020/jan.knut":   "jan",
+		"2020/feb.knut":     "feb",
+		"2020/prices.csv":   "prices",
+		"2021/archive.knut": "archive",
+	})
+
+	if got := readAll(t, src, "2020/jan.knut"); got != "jan" {
+		t.Errorf("Open() returned %q, want %q", got, "jan")
+	}
+	if _, err := src.Open("missing.knut"); !os.IsNotExist(err) {
+		t.Errorf("Open() returned error %v, want not exist", err)
+	}
+	paths, err := src.List("2020/*.knut")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"2020/feb.knut", "2020/jan.knut"}, paths); diff != "" {
+		t.Errorf("List() returned unexpected paths (-want/+got):\n%s", diff)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := src.Watch(ctx, []string{"main.knut"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeString(src, "main.knut", "changed"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-ch; got != "main.knut" {
+		t.Errorf("Watch() sent %q, want %q", got, "main.knut")
+	}
+	if got := readAll(t, src, "main.knut"); got != "changed" {
+		t.Errorf("Open() returned %q, want %q", got, "changed")
+	}
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Errorf("Watch() did not close the channel")
+	}
+}
+
+func TestFileSystem(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.knut", "a.knut", "c.csv"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src := FileSystem{Interval: 10 * time.Millisecond}
+
+	paths, err := src.List(filepath.Join(dir, "*.knut"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "a.knut"), filepath.Join(dir, "b.knut")}
+	if diff := cmp.Diff(want, paths); diff != "" {
+		t.Errorf("List() returned unexpected paths (-want/+got):\n%s", diff)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(dir, "a.knut")
+	ch, err := src.Watch(ctx, []string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeString(src, path, "changed"); err != nil {
+		t.Fatal(err)
+	}
+	// make sure the modification time changes on coarse file systems
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-ch; got != path {
+		t.Errorf("Watch() sent %q, want %q", got, path)
+	}
+	if got := readAll(t, src, path); got != "changed" {
+		t.Errorf("Open() returned %q, want %q", got, "changed")
+	}
+}
+
+func TestGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"sub/a.knut": "v1", "sub/b.knut": "b", "c.knut": "c"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("add", "-A")
+	run("commit", "-q", "-m", "first")
+	if err := os.WriteFile(filepath.Join(dir, "sub/a.knut"), []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("commit", "-q", "-a", "-m", "second")
+
+	src := Git{Dir: filepath.Join(dir, "sub"), Revision: "HEAD~1"}
+
+	if got := readAll(t, src, "a.knut"); got != "v1" {
+		t.Errorf("Open() returned %q, want %q", got, "v1")
+	}
+	if got := readAll(t, Git{Dir: dir}, "sub/a.knut"); got != "v2" {
+		t.Errorf("Open() returned %q, want %q", got, "v2")
+	}
+	paths, err := src.List("*.knut")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"a.knut", "b.knut"}, paths); diff != "" {
+		t.Errorf("List() returned unexpected paths (-want/+got):\n%s", diff)
+	}
+	if err := writeString(src, "a.knut", "v3"); err == nil {
+		t.Errorf("Write() returned no error")
+	}
+}
+
+func TestFromSource(t *testing.T) {
+	src := NewMemory(map[string]string{
+		"journal/main.knut": `include "accounts.knut"
+
+2020-01-01 "Deposit"
+Equity:Equity Assets:Bank 100 CHF
+`,
+		"journal/accounts.knut": `2020-01-01 open Equity:Equity
+2020-01-01 open Assets:Bank
+`,
+	})
+
+	j, err := FromSource(context.Background(), NewContext(), src, "journal/main.knut")
+
+	if err != nil {
+		t.Fatalf("FromSource() returned unexpected error: %v", err)
+	}
+	var opens, trxs int
+	for _, d := range j.Days {
+		opens += len(d.Openings)
+		trxs += len(d.Transactions)
+	}
+	if opens != 2 || trxs != 1 {
+		t.Fatalf("got %d openings and %d transactions, want 2 and 1", opens, trxs)
+	}
+}
+
+func TestFromSourceGlob(t *testing.T) {
+	src := NewMemory(map[string]string{
+		"journal/main.knut": `include "*.knut"
+include "imports/*.knut"
+include "imports/bank.knut"
+`,
+		"journal/accounts.knut": `2020-01-01 open Equity:Equity
+2020-01-01 open Assets:Bank
+2020-01-01 open Assets:Broker
+`,
+		"journal/imports/bank.knut": `2020-01-01 "Deposit"
+Equity:Equity Assets:Bank 100 CHF
+`,
+		"journal/imports/broker.knut": `2020-01-01 "Deposit"
+Equity:Equity Assets:Broker 100 CHF
+`,
+	})
+
+	j, err := FromSource(context.Background(), NewContext(), src, "journal/main.knut")
+
+	if err != nil {
+		t.Fatalf("FromSource() returned unexpected error: %v", err)
+	}
+	var opens, trxs int
+	for _, d := range j.Days {
+		opens += len(d.Openings)
+		trxs += len(d.Transactions)
+	}
+	if opens != 3 || trxs != 2 {
+		t.Fatalf("got %d openings and %d transactions, want 3 and 2", opens, trxs)
+	}
+}
+
+func TestFromSourceIncludeErrors(t *testing.T) {
+	tests := []struct {
+		desc, main, want string
+	}{
+		{
+			desc: "no matches",
+			main: `include "imports/*.knut"`,
+			want: "no files match journal/imports/*.knut",
+		},
+		{
+			desc: "duplicate include",
+			main: "include \"accounts.knut\"\ninclude \"accounts.knut\"\n",
+			want: "file journal/accounts.knut is included more than once",
+		},
+		{
+			desc: "include cycle",
+			main: "include \"accounts.knut\"\n",
+			want: "file journal/main.knut is included more than once",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			src := NewMemory(map[string]string{
+				"journal/main.knut":     test.main,
+				"journal/accounts.knut": "2020-01-01 open Assets:Bank\ninclude \"main.knut\"\n",
+			})
+
+			_, err := FromSource(context.Background(), NewContext(), src, "journal/main.knut")
+
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("FromSource() returned error %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestFromReader(t *testing.T) {
+	dir := t.TempDir()
+	accounts := "2020-01-01 open Equity:Equity\n2020-01-01 open Assets:Bank\n"
+	if err := os.WriteFile(filepath.Join(dir, "accounts.knut"), []byte(accounts), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := strings.NewReader(`include "accounts.knut"
+
+2020-01-01 "Deposit"
+Equity:Equity Assets:Bank 100 CHF
+`)
+
+	j, err := FromReader(context.Background(), NewContext(), r, filepath.Join(dir, "<stdin>"))
+
+	if err != nil {
+		t.Fatalf("FromReader() returned unexpected error: %v", err)
+	}
+	var opens, trxs int
+	for _, d := range j.Days {
+		opens += len(d.Openings)
+		trxs += len(d.Transactions)
+	}
+	if opens != 2 || trxs != 1 {
+		t.Fatalf("got %d openings and %d transactions, want 2 and 1", opens, trxs)
+	}
+}
+
+func TestFromReaderError(t *testing.T) {
+	r := strings.NewReader("2020-01-01 opn Assets:Bank\n")
+
+	_, err := FromReader(context.Background(), NewContext(), r, "<stdin>")
+
+	if err == nil || !strings.HasPrefix(err.Error(), "<stdin>:1:") {
+		t.Errorf("FromReader() returned error %v, want an error at <stdin>:1", err)
+	}
+}
+
+func TestRecursiveParserOrder(t *testing.T) {
+	src := NewMemory(map[string]string{
+		"main.knut": `2020-01-01 open Assets:Main1
+include "a.knut"
+include "b.knut"
+2020-01-01 open Assets:Main2
+`,
+		"a.knut": `2020-01-01 open Assets:A1
+include "c.knut"
+2020-01-01 open Assets:A2
+`,
+		"b.knut": "2020-01-01 open Assets:B\n",
+		"c.knut": "2020-01-01 open Assets:C\n",
+	})
+	tests := []struct {
+		includeOrder bool
+		want         []string
+	}{
+		{
+			want: []string{"Assets:Main1", "Assets:Main2", "Assets:A1", "Assets:A2", "Assets:C", "Assets:B"},
+		},
+		{
+			includeOrder: true,
+			want:         []string{"Assets:Main1", "Assets:A1", "Assets:C", "Assets:A2", "Assets:B", "Assets:Main2"},
+		},
+	}
+	for _, test := range tests {
+		// repeat to detect orderings which depend on scheduling
+		for i := 0; i < 20; i++ {
+			p := RecursiveParser{Context: NewContext(), File: "main.knut", Source: src, IncludeOrder: test.includeOrder}
+			var got []string
+			for d := range p.Parse(context.Background()) {
+				o, ok := d.(*Open)
+				if !ok {
+					t.Fatalf("Parse() returned unexpected %v", d)
+				}
+				got = append(got, o.Account.Name())
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Fatalf("IncludeOrder=%t: Parse() returned unexpected order (-want/+got):\n%s", test.includeOrder, diff)
+			}
+		}
+	}
+}
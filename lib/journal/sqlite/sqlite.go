@@ -0,0 +1,239 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqlite exports a ledger into a SQLite database.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/journal"
+	"go.uber.org/multierr"
+
+	// register the pure Go sqlite driver, which does not require cgo
+	_ "modernc.org/sqlite"
+)
+
+// Schema is the schema of the exported database. Dates are stored as
+// YYYY-MM-DD and decimals as text, to keep their precision.
+const Schema = `
+CREATE TABLE accounts (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	type TEXT NOT NULL,
+	open_date TEXT,
+	close_date TEXT
+);
+
+CREATE TABLE commodities (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	is_currency INTEGER NOT NULL
+);
+
+CREATE TABLE transactions (
+	id INTEGER PRIMARY KEY,
+	date TEXT NOT NULL,
+	description TEXT NOT NULL,
+	tags TEXT NOT NULL
+);
+
+CREATE TABLE postings (
+	id INTEGER PRIMARY KEY,
+	transaction_id INTEGER NOT NULL REFERENCES transactions (id),
+	account_id INTEGER NOT NULL REFERENCES accounts (id),
+	other_account_id INTEGER NOT NULL REFERENCES accounts (id),
+	commodity_id INTEGER NOT NULL REFERENCES commodities (id),
+	amount TEXT NOT NULL,
+	value TEXT
+);
+
+CREATE TABLE prices (
+	id INTEGER PRIMARY KEY,
+	date TEXT NOT NULL,
+	commodity_id INTEGER NOT NULL REFERENCES commodities (id),
+	target_id INTEGER NOT NULL REFERENCES commodities (id),
+	price TEXT NOT NULL
+);
+
+CREATE INDEX postings_transaction_id ON postings (transaction_id);
+CREATE INDEX postings_account_id ON postings (account_id);
+CREATE INDEX transactions_date ON transactions (date);
+`
+
+// Open opens the database at the given path.
+func Open(path string) (*sql.DB, error) {
+	return sql.Open("sqlite", path)
+}
+
+// Export creates the schema in the given database and writes the ledger
+// into it, in a single transaction. The values of the postings are only
+// written if valuation is not nil.
+func Export(ctx context.Context, db *sql.DB, l []*journal.Day, valuation *journal.Commodity) (errors error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if errors != nil {
+			errors = multierr.Append(errors, tx.Rollback())
+		}
+	}()
+	if _, err := tx.ExecContext(ctx, Schema); err != nil {
+		return err
+	}
+	e := exporter{
+		ctx:         ctx,
+		tx:          tx,
+		valuation:   valuation,
+		accounts:    make(map[*journal.Account]int64),
+		commodities: make(map[*journal.Commodity]int64),
+	}
+	for _, day := range l {
+		if err := e.exportDay(day); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type exporter struct {
+	ctx         context.Context
+	tx          *sql.Tx
+	valuation   *journal.Commodity
+	accounts    map[*journal.Account]int64
+	commodities map[*journal.Commodity]int64
+}
+
+func (e *exporter) exportDay(day *journal.Day) error {
+	date := day.Date.Format("2006-01-02")
+	for _, o := range day.Openings {
+		id, err := e.account(o.Account)
+		if err != nil {
+			return err
+		}
+		if _, err := e.tx.ExecContext(e.ctx, "UPDATE accounts SET open_date = ? WHERE id = ?", date, id); err != nil {
+			return err
+		}
+	}
+	for _, p := range day.Prices {
+		c, err := e.commodity(p.Commodity)
+		if err != nil {
+			return err
+		}
+		t, err := e.commodity(p.Target)
+		if err != nil {
+			return err
+		}
+		if _, err := e.tx.ExecContext(e.ctx,
+			"INSERT INTO prices (date, commodity_id, target_id, price) VALUES (?, ?, ?, ?)",
+			date, c, t, p.Price.String()); err != nil {
+			return err
+		}
+	}
+	compare.Sort(day.Transactions, journal.CompareTransactions)
+	for _, trx := range day.Transactions {
+		if err := e.exportTransaction(date, trx); err != nil {
+			return err
+		}
+	}
+	for _, c := range day.Closings {
+		id, err := e.account(c.Account)
+		if err != nil {
+			return err
+		}
+		if _, err := e.tx.ExecContext(e.ctx, "UPDATE accounts SET close_date = ? WHERE id = ?", date, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *exporter) exportTransaction(date string, trx *journal.Transaction) error {
+	tags := make([]string, 0, len(trx.Tags))
+	for _, t := range trx.Tags {
+		tags = append(tags, string(t))
+	}
+	res, err := e.tx.ExecContext(e.ctx,
+		"INSERT INTO transactions (date, description, tags) VALUES (?, ?, ?)",
+		date, trx.Description, strings.Join(tags, " "))
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, p := range trx.Postings {
+		a, err := e.account(p.Account)
+		if err != nil {
+			return err
+		}
+		o, err := e.account(p.Other)
+		if err != nil {
+			return err
+		}
+		c, err := e.commodity(p.Commodity)
+		if err != nil {
+			return err
+		}
+		var value any
+		if e.valuation != nil {
+			value = p.Value.String()
+		}
+		if _, err := e.tx.ExecContext(e.ctx,
+			"INSERT INTO postings (transaction_id, account_id, other_account_id, commodity_id, amount, value) VALUES (?, ?, ?, ?, ?, ?)",
+			id, a, o, c, p.Amount.String(), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// account returns the id of the account, inserting it if necessary.
+func (e *exporter) account(a *journal.Account) (int64, error) {
+	if id, ok := e.accounts[a]; ok {
+		return id, nil
+	}
+	res, err := e.tx.ExecContext(e.ctx, "INSERT INTO accounts (name, type) VALUES (?, ?)", a.Name(), a.Type().String())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	e.accounts[a] = id
+	return id, nil
+}
+
+// commodity returns the id of the commodity, inserting it if necessary.
+func (e *exporter) commodity(c *journal.Commodity) (int64, error) {
+	if id, ok := e.commodities[c]; ok {
+		return id, nil
+	}
+	res, err := e.tx.ExecContext(e.ctx, "INSERT INTO commodities (name, is_currency) VALUES (?, ?)", c.Name(), c.IsCurrency)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	e.commodities[c] = id
+	return id, nil
+}
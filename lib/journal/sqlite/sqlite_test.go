@@ -0,0 +1,108 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sboehler/knut/lib/journal"
+)
+
+const input = `2020-01-01 open Equity:Equity
+2020-01-01 open Assets:Bank
+2020-01-01 open Income:Salary
+
+2020-01-01 price USD 0.9 CHF
+
+2020-01-25 "Salary" #work
+Income:Salary Assets:Bank 5000 CHF
+
+2020-02-01 "Transfer"
+Equity:Equity Assets:Bank 100 USD
+
+2020-03-01 close Income:Salary
+`
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.knut")
+	if err := os.WriteFile(path, []byte(input), 0600); err != nil {
+		t.Fatal(err)
+	}
+	jctx := journal.NewContext()
+	chf := jctx.Commodity("CHF")
+	j, err := journal.FromPath(ctx, jctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := j.Process(journal.ComputePrices(chf), journal.Balance(jctx, chf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(filepath.Join(dir, "out.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := Export(ctx, db, l.Days, chf); err != nil {
+		t.Fatalf("Export() returned unexpected error: %v", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT t.date, t.description, t.tags, a.name, c.name, p.amount, p.value
+		FROM postings p
+		JOIN transactions t ON t.id = p.transaction_id
+		JOIN accounts a ON a.id = p.account_id
+		JOIN commodities c ON c.id = p.commodity_id
+		WHERE a.name = 'Assets:Bank'
+		ORDER BY p.id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got [][]string
+	for rows.Next() {
+		row := make([]string, 7)
+		if err := rows.Scan(&row[0], &row[1], &row[2], &row[3], &row[4], &row[5], &row[6]); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"2020-01-25", "Salary", "#work", "Assets:Bank", "CHF", "5000", "5000"},
+		{"2020-02-01", "Transfer", "", "Assets:Bank", "USD", "100", "90"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected postings (-want, +got):\n%s", diff)
+	}
+
+	var open, closed string
+	if err := db.QueryRowContext(ctx, "SELECT open_date, close_date FROM accounts WHERE name = 'Income:Salary'").Scan(&open, &closed); err != nil {
+		t.Fatal(err)
+	}
+	if open != "2020-01-01" || closed != "2020-03-01" {
+		t.Fatalf("got open %s and close %s, want 2020-01-01 and 2020-03-01", open, closed)
+	}
+}
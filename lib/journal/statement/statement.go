@@ -0,0 +1,145 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statement lists the postings of a single account with their
+// running balance, like a bank statement.
+package statement
+
+import (
+	"time"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+)
+
+// Entry is a posting on the account.
+type Entry struct {
+	Date        time.Time
+	Description string
+	Other       *journal.Account
+	Amount      decimal.Decimal
+}
+
+// Section is the statement of the account in one commodity.
+type Section struct {
+	Commodity        *journal.Commodity
+	Opening, Closing decimal.Decimal
+	Entries          []Entry
+}
+
+// Statement collects the postings of an account in a period, by
+// commodity. If the statement is valuated, all postings are collected in
+// the valuation commodity, including the adjustments of the value to
+// market prices.
+type Statement struct {
+	account   *journal.Account
+	period    date.Period
+	valuation *journal.Commodity
+
+	sections map[*journal.Commodity]*Section
+}
+
+// New creates a new statement.
+func New(a *journal.Account, period date.Period, v *journal.Commodity) *Statement {
+	return &Statement{
+		account:   a,
+		period:    period,
+		valuation: v,
+		sections:  make(map[*journal.Commodity]*Section),
+	}
+}
+
+// Process processes a day. It must run after Balance and Sort.
+func (s *Statement) Process(d *journal.Day) error {
+	if d.Date.After(s.period.End) {
+		return nil
+	}
+	for _, t := range d.Transactions {
+		for _, p := range t.Postings {
+			if p.Account != s.account {
+				continue
+			}
+			c, amt := p.Commodity, p.Amount
+			if s.valuation != nil {
+				c, amt = s.valuation, p.Value
+			}
+			sec := dict.GetDefault(s.sections, c, func() *Section { return &Section{Commodity: c} })
+			sec.Closing = sec.Closing.Add(amt)
+			if d.Date.Before(s.period.Start) {
+				sec.Opening = sec.Opening.Add(amt)
+				continue
+			}
+			if amt.IsZero() {
+				continue
+			}
+			sec.Entries = append(sec.Entries, Entry{
+				Date:        d.Date,
+				Description: t.Description,
+				Other:       p.Other,
+				Amount:      amt,
+			})
+		}
+	}
+	return nil
+}
+
+// Sections returns the sections of the statement, sorted by commodity.
+func (s *Statement) Sections() []*Section {
+	return dict.SortedValues(s.sections, func(s1, s2 *Section) compare.Order {
+		return journal.CompareCommodities(s1.Commodity, s2.Commodity)
+	})
+}
+
+// Render renders a section with the opening balance at the start of the
+// period, the entries with their running balance and the closing balance at
+// the end of the period.
+func Render(period date.Period, sec *Section) *table.Table {
+	tbl := table.New(1, 1, 1, 1, 1)
+	tbl.AddSeparatorRow()
+	tbl.AddHeaderRow().
+		AddText("Date", table.Center).
+		AddText("Description", table.Center).
+		AddText("Account", table.Center).
+		AddText("Amount", table.Center).
+		AddText("Balance", table.Center)
+	tbl.AddSeparatorRow()
+	tbl.AddRow().
+		AddText(period.Start.Format("2006-01-02"), table.Left).
+		AddText("Opening balance", table.Left).
+		AddEmpty().
+		AddEmpty().
+		AddNumber(sec.Opening)
+	balance := sec.Opening
+	for _, e := range sec.Entries {
+		balance = balance.Add(e.Amount)
+		tbl.AddRow().
+			AddText(e.Date.Format("2006-01-02"), table.Left).
+			AddText(e.Description, table.Left).
+			AddText(e.Other.Name(), table.Left).
+			AddNumber(e.Amount).
+			AddNumber(balance)
+	}
+	tbl.AddRow().
+		AddText(period.End.Format("2006-01-02"), table.Left).
+		AddText("Closing balance", table.Left).
+		AddEmpty().
+		AddEmpty().
+		AddNumber(sec.Closing)
+	tbl.AddSeparatorRow()
+	return tbl
+}
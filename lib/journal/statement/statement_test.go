@@ -0,0 +1,77 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestStatementValuated(t *testing.T) {
+	var (
+		jctx      = journal.NewContext()
+		equity    = jctx.Account("Equity:Equity")
+		portfolio = jctx.Account("Assets:Portfolio")
+		chf       = jctx.Commodity("CHF")
+		usd       = jctx.Commodity("USD")
+		j         = journal.New(jctx)
+	)
+	for _, a := range []*journal.Account{equity, portfolio} {
+		j.AddOpen(&journal.Open{Date: date.Date(2020, 1, 1), Account: a})
+	}
+	j.AddPrice(&journal.Price{Date: date.Date(2020, 1, 1), Commodity: usd, Target: chf, Price: decimal.NewFromInt(1)})
+	j.AddPrice(&journal.Price{Date: date.Date(2020, 2, 10), Commodity: usd, Target: chf, Price: decimal.RequireFromString("0.9")})
+	j.AddTransaction(journal.TransactionBuilder{
+		Date:        date.Date(2020, 1, 2),
+		Description: "Deposit",
+		Postings: journal.PostingBuilder{
+			Credit:    equity,
+			Debit:     portfolio,
+			Commodity: usd,
+			Amount:    decimal.NewFromInt(100),
+		}.Build(),
+	}.Build())
+	period := date.Period{Start: date.Date(2020, 2, 1), End: date.Date(2020, 2, 29)}
+	s := New(portfolio, period, chf)
+
+	if _, err := j.Process(journal.ComputePrices(chf), journal.Balance(jctx, chf), journal.Sort(), s.Process); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	got := s.Sections()
+
+	want := []*Section{
+		{
+			Commodity: chf,
+			Opening:   decimal.NewFromInt(100),
+			Closing:   decimal.NewFromInt(90),
+			Entries: []Entry{
+				{
+					Date:        date.Date(2020, 2, 10),
+					Description: "Adjust value of USD in account Assets:Portfolio",
+					Other:       jctx.ValuationAccountFor(portfolio),
+					Amount:      decimal.NewFromInt(-10),
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b *journal.Account) bool { return a == b }), cmp.Comparer(func(a, b *journal.Commodity) bool { return a == b })); diff != "" {
+		t.Errorf("Sections() returned unexpected sections (-want/+got):\n%s", diff)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"fmt"
+
+	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/common/set"
+	"go.uber.org/multierr"
+)
+
+// CheckDeclarations checks that every account is opened on or before the
+// date it is first used, and that every commodity is declared as a
+// commodity or a currency. It reports the first use of each account and
+// commodity which is not, such that typos are caught before processing.
+func (j *Journal) CheckDeclarations() error {
+	var (
+		errs        error
+		opened      = set.New[*Account]()
+		accounts    = set.New[*Account]()
+		commodities = set.New[*Commodity]()
+	)
+	checkAccount := func(d Directive, a *Account) {
+		if a == nil || opened.Has(a) || accounts.Has(a) {
+			return
+		}
+		accounts.Add(a)
+		errs = multierr.Append(errs, Error{
+			Code:      ErrAccountNotOpen,
+			Directive: d,
+			Message:   fmt.Sprintf("account %s is used before it is opened", a),
+		})
+	}
+	checkCommodity := func(d Directive, c *Commodity) {
+		if c == nil || j.declared.Has(c) || commodities.Has(c) {
+			return
+		}
+		commodities.Add(c)
+		errs = multierr.Append(errs, Error{
+			Code:      ErrCommodityNotDeclared,
+			Directive: d,
+			Message:   fmt.Sprintf("commodity %s is not declared", c.Name()),
+			Fix:       fmt.Sprintf("add \"commodity %s\" or \"currency %s\" to the journal", c.Name(), c.Name()),
+		})
+	}
+	for _, day := range dict.SortedValues(j.Days, CompareDays) {
+		for _, o := range day.Openings {
+			opened.Add(o.Account)
+			for _, c := range o.Commodities {
+				checkCommodity(o, c)
+			}
+		}
+		for _, p := range day.Prices {
+			checkCommodity(p, p.Commodity)
+			checkCommodity(p, p.Target)
+		}
+		for _, t := range day.Transactions {
+			for _, p := range t.Postings {
+				checkAccount(t, p.Account)
+				checkCommodity(t, p.Commodity)
+				for _, c := range p.Targets {
+					checkCommodity(t, c)
+				}
+			}
+		}
+		for _, a := range day.Assertions {
+			checkAccount(a, a.Account)
+			checkCommodity(a, a.Commodity)
+		}
+		for _, v := range day.Values {
+			checkAccount(v, v.Account)
+			checkCommodity(v, v.Commodity)
+		}
+		for _, r := range day.Renames {
+			checkCommodity(r, r.Commodity)
+			checkCommodity(r, r.Target)
+		}
+		for _, s := range day.Splits {
+			checkCommodity(s, s.Commodity)
+		}
+		for _, b := range day.Budgets {
+			checkAccount(b, b.Account)
+			checkCommodity(b, b.Commodity)
+		}
+		for _, a := range day.Autos {
+			checkAccount(a, a.Credit)
+			checkAccount(a, a.Debit)
+		}
+		for _, v := range day.Valuations {
+			checkAccount(v, v.Account)
+			checkAccount(v, v.Target)
+		}
+		for _, c := range day.Closings {
+			checkAccount(c, c.Account)
+			checkAccount(c, c.Residual)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/multierr"
+)
+
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		desc    string
+		journal string
+		want    []string
+	}{
+		{
+			desc: "declared",
+			journal: `option strict
+currency CHF
+commodity AAPL
+
+2020-01-01 open Assets:Bank
+2020-01-01 open Assets:Portfolio
+2020-01-01 open Equity:Equity
+
+2020-01-02 "Deposit"
+Equity:Equity Assets:Bank 1000 CHF
+
+2020-01-03 price AAPL 100 CHF
+`,
+		},
+		{
+			desc: "undeclared",
+			journal: `option strict
+currency CHF
+
+2020-01-01 open Assets:Bank
+2020-01-01 open Equity:Equity
+
+2020-01-02 "Deposit"
+Equity:Equity Assets:Bnak 1000 CHF
+
+2020-01-03 price AAPL 100 CHF
+
+2020-01-04 "Deposit"
+Equity:Equity Assets:Bnak 1000 CHF
+`,
+			want: []string{
+				"account Assets:Bnak is used before it is opened",
+				"commodity AAPL is not declared",
+			},
+		},
+		{
+			desc: "opened later",
+			journal: `option strict
+currency CHF
+
+2020-01-02 open Assets:Bank
+2020-01-01 budget Assets:Bank 100 CHF
+`,
+			want: []string{
+				"account Assets:Bank is used before it is opened",
+			},
+		},
+		{
+			desc: "not strict",
+			journal: `2020-01-01 open Assets:Bank
+2020-01-01 balance Assets:Bank 0 CHF
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			src := NewMemory(map[string]string{"main.knut": test.journal})
+
+			_, err := FromSource(context.Background(), NewContext(), src, "main.knut")
+
+			var got []string
+			for _, e := range multierr.Errors(err) {
+				var je Error
+				if !errors.As(e, &je) {
+					t.Fatalf("FromSource() returned unexpected error: %v", e)
+				}
+				got = append(got, je.Message)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("FromSource() returned unexpected errors (-want/+got):\n%s", diff)
+			}
+		})
+	}
+}
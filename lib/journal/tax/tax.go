@@ -0,0 +1,165 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tax aggregates income and expenses by the tags of their
+// transactions, e.g. #deductible or #vat, to prepare tax filings.
+package tax
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/common/regex"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+)
+
+// Row holds the amounts of an account in a commodity per period, for the
+// transactions with the given tag.
+type Row struct {
+	Tag       journal.Tag
+	Account   *journal.Account
+	Commodity *journal.Commodity
+	Amounts   []decimal.Decimal
+}
+
+// Report is a collection which aggregates the postings on income and
+// expense accounts by tag, account and commodity per period. Each period
+// ends at one of the dates and starts the day after the previous date; the
+// first period starts at the given start date. A posting counts towards
+// each tag of its transaction which matches one of the regexes, or towards
+// all of its tags if there are no regexes. Valuated postings are
+// aggregated in the valuation commodity.
+type Report struct {
+	start time.Time
+	dates []time.Time
+	tags  regex.Regexes
+
+	rows map[rowKey]*Row
+}
+
+type rowKey struct {
+	tag       journal.Tag
+	account   *journal.Account
+	commodity *journal.Commodity
+}
+
+// New creates a new report.
+func New(start time.Time, dates []time.Time, tags regex.Regexes) *Report {
+	return &Report{
+		start: start,
+		dates: dates,
+		tags:  tags,
+		rows:  make(map[rowKey]*Row),
+	}
+}
+
+// Insert inserts a posting.
+func (r *Report) Insert(k journal.Key, v decimal.Decimal) {
+	if k.Account == nil || !k.Account.IsIE() || k.Date.Before(r.start) {
+		return
+	}
+	i := sort.Search(len(r.dates), func(i int) bool { return !r.dates[i].Before(k.Date) })
+	if i == len(r.dates) {
+		return
+	}
+	c := k.Commodity
+	if k.Valuation != nil {
+		c = k.Valuation
+	}
+	for _, tag := range k.TagList() {
+		if len(r.tags) > 0 && !r.tags.MatchString(strings.TrimPrefix(string(tag), "#")) {
+			continue
+		}
+		rk := rowKey{tag, k.Account, c}
+		rw := dict.GetDefault(r.rows, rk, func() *Row {
+			return &Row{Tag: tag, Account: k.Account, Commodity: c, Amounts: make([]decimal.Decimal, len(r.dates))}
+		})
+		rw.Amounts[i] = rw.Amounts[i].Add(v)
+	}
+}
+
+// Rows returns the rows of the report, sorted by tag, account and
+// commodity.
+func (r *Report) Rows() []*Row {
+	return dict.SortedValues(r.rows, func(r1, r2 *Row) compare.Order {
+		if o := compare.Ordered(r1.Tag, r2.Tag); o != compare.Equal {
+			return o
+		}
+		if o := journal.CompareAccounts(r1.Account, r2.Account); o != compare.Equal {
+			return o
+		}
+		return journal.CompareCommodities(r1.Commodity, r2.Commodity)
+	})
+}
+
+// Render renders the rows grouped by tag, each group followed by its
+// totals per commodity. The rows must be sorted by tag.
+func Render(dates []time.Time, rows []*Row) *table.Table {
+	tbl := table.New(1, 1, len(dates))
+	tbl.AddSeparatorRow()
+	header := tbl.AddHeaderRow().AddText("Account", table.Center).AddText("Comm", table.Center)
+	for _, d := range dates {
+		header.AddText(d.Format("2006-01-02"), table.Center)
+	}
+	tbl.AddSeparatorRow()
+	for len(rows) > 0 {
+		n := 1
+		for n < len(rows) && rows[n].Tag == rows[0].Tag {
+			n++
+		}
+		renderTag(tbl, len(dates), rows[:n])
+		rows = rows[n:]
+	}
+	return tbl
+}
+
+func renderTag(tbl *table.Table, n int, rows []*Row) {
+	row := tbl.AddRow().AddText(string(rows[0].Tag), table.Left).AddEmpty()
+	for i := 0; i < n; i++ {
+		row.AddEmpty()
+	}
+	var (
+		commodities []*journal.Commodity
+		totals      = make(map[*journal.Commodity][]decimal.Decimal)
+	)
+	for _, rw := range rows {
+		renderRow(tbl, rw.Account.Name(), 2, rw.Commodity, rw.Amounts)
+		total, ok := totals[rw.Commodity]
+		if !ok {
+			total = make([]decimal.Decimal, n)
+			totals[rw.Commodity] = total
+			commodities = append(commodities, rw.Commodity)
+		}
+		for i := range total {
+			total[i] = total[i].Add(rw.Amounts[i])
+		}
+	}
+	compare.Sort(commodities, journal.CompareCommodities)
+	for _, c := range commodities {
+		renderRow(tbl, "Total", 2, c, totals[c])
+	}
+	tbl.AddSeparatorRow()
+}
+
+func renderRow(tbl *table.Table, name string, indent int, c *journal.Commodity, amounts []decimal.Decimal) {
+	row := tbl.AddRow().AddIndented(name, indent).AddText(c.Name(), table.Left)
+	for _, a := range amounts {
+		row.AddNumber(a)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tax
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/regex"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestReport(t *testing.T) {
+	var (
+		jctx      = journal.NewContext()
+		bank      = jctx.Account("Assets:Bank")
+		donations = jctx.Account("Expenses:Donations")
+		office    = jctx.Account("Expenses:Office")
+		chf       = jctx.Commodity("CHF")
+		r         = New(date.Date(2020, 1, 1), []time.Time{date.Date(2020, 12, 31), date.Date(2021, 12, 31)}, regex.Regexes{regexp.MustCompile("^(deductible|vat)")})
+	)
+	insert := func(d time.Time, a *journal.Account, tags string, v int64) {
+		r.Insert(journal.Key{Date: d, Account: a, Other: bank, Commodity: chf, Tags: tags}, decimal.NewFromInt(v))
+		r.Insert(journal.Key{Date: d, Account: bank, Other: a, Commodity: chf, Tags: tags}, decimal.NewFromInt(-v))
+	}
+	// before the first period
+	insert(date.Date(2019, 12, 1), donations, "#deductible", 10)
+	insert(date.Date(2020, 3, 1), donations, "#deductible #private", 100)
+	insert(date.Date(2020, 5, 1), office, "#deductible #vat:standard", 500)
+	insert(date.Date(2021, 3, 1), donations, "#deductible", 150)
+	// after the last period
+	insert(date.Date(2022, 1, 1), donations, "#deductible", 20)
+
+	got := r.Rows()
+
+	want := []*Row{
+		{Tag: "#deductible", Account: donations, Commodity: chf, Amounts: []decimal.Decimal{decimal.NewFromInt(100), decimal.NewFromInt(150)}},
+		{Tag: "#deductible", Account: office, Commodity: chf, Amounts: []decimal.Decimal{decimal.NewFromInt(500), decimal.Zero}},
+		{Tag: "#vat:standard", Account: office, Commodity: chf, Amounts: []decimal.Decimal{decimal.NewFromInt(500), decimal.Zero}},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b *journal.Account) bool { return a == b }), cmp.Comparer(func(a, b *journal.Commodity) bool { return a == b })); diff != "" {
+		t.Errorf("Rows() returned unexpected rows (-want/+got):\n%s", diff)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package top finds the largest expenses of a period.
+package top
+
+import (
+	"time"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/common/filter"
+	"github.com/sboehler/knut/lib/common/table"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+)
+
+// Entry is the amount a transaction books on an expense account.
+type Entry struct {
+	Date        time.Time
+	Description string
+	Account     *journal.Account
+	Commodity   *journal.Commodity
+	Amount      decimal.Decimal
+}
+
+// Report collects the expenses of the transactions in a period. The
+// amounts a transaction books on an expense account are added up, such
+// that each entry corresponds to a transaction and an account. If the
+// report is valuated, the entries are in the valuation commodity.
+type Report struct {
+	period    date.Period
+	valuation *journal.Commodity
+	filter    filter.Filter[journal.Key]
+
+	entries []Entry
+}
+
+// New creates a new report for the expense accounts accepted by the filter.
+func New(period date.Period, v *journal.Commodity, f filter.Filter[journal.Key]) *Report {
+	if f == nil {
+		f = filter.AllowAll[journal.Key]
+	}
+	return &Report{
+		period:    period,
+		valuation: v,
+		filter:    f,
+	}
+}
+
+// Process processes a day. It must run after Balance.
+func (r *Report) Process(d *journal.Day) error {
+	if !r.period.Contains(d.Date) {
+		return nil
+	}
+	for _, t := range d.Transactions {
+		amounts := make(journal.Amounts)
+		for _, p := range t.Postings {
+			if p.Account.Type() != journal.EXPENSES || !r.filter(journal.AccountKey(p.Account)) {
+				continue
+			}
+			if r.valuation != nil {
+				amounts.Add(journal.AccountCommodityKey(p.Account, r.valuation), p.Value)
+			} else {
+				amounts.Add(journal.AccountCommodityKey(p.Account, p.Commodity), p.Amount)
+			}
+		}
+		for k, amount := range amounts {
+			if amount.IsZero() {
+				continue
+			}
+			r.entries = append(r.entries, Entry{
+				Date:        d.Date,
+				Description: t.Description,
+				Account:     k.Account,
+				Commodity:   k.Commodity,
+				Amount:      amount,
+			})
+		}
+	}
+	return nil
+}
+
+// Top returns the n largest entries per commodity, or per account and
+// commodity if byAccount is set. The groups are sorted by account and
+// commodity, the entries in a group by decreasing amount.
+func (r *Report) Top(n int, byAccount bool) [][]Entry {
+	groups := make(map[journal.Key][]Entry)
+	for _, e := range r.entries {
+		k := journal.CommodityKey(e.Commodity)
+		if byAccount {
+			k.Account = e.Account
+		}
+		groups[k] = append(groups[k], e)
+	}
+	keys := dict.SortedKeys(groups, func(k1, k2 journal.Key) compare.Order {
+		if byAccount {
+			if o := journal.CompareAccounts(k1.Account, k2.Account); o != compare.Equal {
+				return o
+			}
+		}
+		return journal.CompareCommodities(k1.Commodity, k2.Commodity)
+	})
+	res := make([][]Entry, 0, len(keys))
+	for _, k := range keys {
+		es := groups[k]
+		compare.Sort(es, compareEntries)
+		if len(es) > n {
+			es = es[:n]
+		}
+		res = append(res, es)
+	}
+	return res
+}
+
+// compareEntries orders entries by decreasing amount, then by date, account
+// and description.
+func compareEntries(e1, e2 Entry) compare.Order {
+	if o := compare.Decimal(e2.Amount, e1.Amount); o != compare.Equal {
+		return o
+	}
+	if o := compare.Time(e1.Date, e2.Date); o != compare.Equal {
+		return o
+	}
+	if o := journal.CompareAccounts(e1.Account, e2.Account); o != compare.Equal {
+		return o
+	}
+	return compare.Ordered(e1.Description, e2.Description)
+}
+
+// Render renders the groups of entries.
+func Render(groups [][]Entry) *table.Table {
+	tbl := table.New(1, 1, 1, 1, 1)
+	tbl.AddSeparatorRow()
+	tbl.AddHeaderRow().
+		AddText("Date", table.Center).
+		AddText("Description", table.Center).
+		AddText("Account", table.Center).
+		AddText("Comm", table.Center).
+		AddText("Amount", table.Center)
+	tbl.AddSeparatorRow()
+	for _, es := range groups {
+		for _, e := range es {
+			tbl.AddRow().
+				AddText(e.Date.Format("2006-01-02"), table.Left).
+				AddText(e.Description, table.Left).
+				AddText(e.Account.Name(), table.Left).
+				AddText(e.Commodity.Name(), table.Left).
+				AddNumber(e.Amount)
+		}
+		tbl.AddSeparatorRow()
+	}
+	return tbl
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestTop(t *testing.T) {
+	var (
+		jctx   = journal.NewContext()
+		equity = jctx.Account("Equity:Equity")
+		bank   = jctx.Account("Assets:Bank")
+		food   = jctx.Account("Expenses:Food")
+		travel = jctx.Account("Expenses:Travel")
+		chf    = jctx.Commodity("CHF")
+		eur    = jctx.Commodity("EUR")
+		j      = journal.New(jctx)
+	)
+	for _, a := range []*journal.Account{equity, bank, food, travel} {
+		j.AddOpen(&journal.Open{Date: date.Date(2020, 1, 1), Account: a})
+	}
+	book := func(desc string, day int, pbs ...journal.PostingBuilder) {
+		j.AddTransaction(journal.TransactionBuilder{
+			Date:        date.Date(2020, 1, day),
+			Description: desc,
+			Postings:    journal.PostingBuilders(pbs).Build(),
+		}.Build())
+	}
+	expense := func(a *journal.Account, c *journal.Commodity, amount int64) journal.PostingBuilder {
+		return journal.PostingBuilder{Credit: bank, Debit: a, Commodity: c, Amount: decimal.NewFromInt(amount)}
+	}
+	book("Groceries", 2, expense(food, chf, 50))
+	book("Train and lunch", 3, expense(travel, chf, 30), expense(food, chf, 20), expense(food, chf, 15))
+	book("Hotel", 4, expense(travel, eur, 200))
+	book("Dinner", 5, expense(food, chf, 40))
+	// outside of the period
+	book("Flight", 20, expense(travel, chf, 900))
+	r := New(date.Period{Start: date.Date(2020, 1, 1), End: date.Date(2020, 1, 10)}, nil, nil)
+
+	if _, err := j.Process(journal.Balance(jctx, nil), r.Process); err != nil {
+		t.Fatalf("Process() returned unexpected error: %v", err)
+	}
+	got := r.Top(2, false)
+
+	want := [][]Entry{
+		{
+			{Date: date.Date(2020, 1, 2), Description: "Groceries", Account: food, Commodity: chf, Amount: decimal.NewFromInt(50)},
+			{Date: date.Date(2020, 1, 5), Description: "Dinner", Account: food, Commodity: chf, Amount: decimal.NewFromInt(40)},
+		},
+		{
+			{Date: date.Date(2020, 1, 4), Description: "Hotel", Account: travel, Commodity: eur, Amount: decimal.NewFromInt(200)},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b *journal.Account) bool { return a == b }), cmp.Comparer(func(a, b *journal.Commodity) bool { return a == b })); diff != "" {
+		t.Errorf("Top() returned unexpected entries (-want/+got):\n%s", diff)
+	}
+}
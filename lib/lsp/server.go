@@ -0,0 +1,462 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lsp implements a language server for knut journals, which
+// speaks the Language Server Protocol over a stream such as stdio.
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/sboehler/knut/lib/common/compare"
+	"github.com/sboehler/knut/lib/common/dict"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/sboehler/knut/lib/journal/format"
+	"github.com/sboehler/knut/lib/journal/scanner"
+	"go.uber.org/multierr"
+)
+
+// Server is a language server. It publishes the errors of parsing and
+// balancing the journal as diagnostics, completes account and commodity
+// names, resolves include directives and formats documents.
+type Server struct {
+	journal string
+	docs    *overlay
+	out     io.Writer
+
+	// context is the context of the last check, which holds the accounts
+	// and commodities for completion.
+	context journal.Context
+
+	// published holds the paths with published diagnostics.
+	published map[string]bool
+}
+
+// New creates a server for the journal at the given path. If the path is
+// empty, each document is checked as a journal of its own.
+func New(path string) *Server {
+	return &Server{
+		journal:   path,
+		docs:      &overlay{docs: make(map[string]string)},
+		context:   journal.NewContext(),
+		published: make(map[string]bool),
+	}
+}
+
+// Serve reads requests from r and writes responses and notifications to
+// w, until the client sends the exit notification or r is exhausted.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	var (
+		in  = bufio.NewReader(r)
+		out = bufio.NewWriter(w)
+	)
+	s.out = out
+	for {
+		content, err := readMessage(in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(content, &req); err != nil {
+			return err
+		}
+		if req.Method == "exit" {
+			return out.Flush()
+		}
+		result, err := s.handle(ctx, &req)
+		if req.ID != nil {
+			res := response{JSONRPC: "2.0", ID: req.ID}
+			if err != nil {
+				var re *responseError
+				if !errors.As(err, &re) {
+					re = &responseError{Code: codeRequestFailed, Message: err.Error()}
+				}
+				res.Error = re
+			} else if res.Result, err = json.Marshal(result); err != nil {
+				return err
+			}
+			if err := writeMessage(out, res); err != nil {
+				return err
+			}
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+// handle handles a request or a notification and returns the result.
+func (s *Server) handle(ctx context.Context, req *request) (any, error) {
+	switch req.Method {
+	case "initialize":
+		var res initializeResult
+		res.Capabilities.TextDocumentSync = syncFull
+		res.Capabilities.DefinitionProvider = true
+		res.Capabilities.DocumentFormattingProvider = true
+		res.Capabilities.CompletionProvider.TriggerCharacters = []string{":"}
+		res.ServerInfo.Name = "knut"
+		return res, nil
+
+	case "initialized", "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		p, err := uriToPath(params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		s.docs.set(p, params.TextDocument.Text)
+		return nil, s.check(ctx, p)
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		p, err := uriToPath(params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.docs.set(p, params.ContentChanges[n-1].Text)
+		}
+		return nil, s.check(ctx, p)
+
+	case "textDocument/didSave":
+		var params textDocumentParams
+		if err := unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		p, err := uriToPath(params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.check(ctx, p)
+
+	case "textDocument/didClose":
+		var params textDocumentParams
+		if err := unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		p, err := uriToPath(params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		s.docs.remove(p)
+		return nil, nil
+
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.complete(params)
+
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(params)
+
+	case "textDocument/formatting":
+		var params textDocumentParams
+		if err := unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.format(params.TextDocument.URI)
+	}
+	if req.ID == nil {
+		// notifications which are not supported are ignored
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %s is not supported", req.Method)}
+}
+
+func unmarshal(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// check parses and balances the journal containing the document at the
+// given path and publishes the errors as diagnostics.
+func (s *Server) check(ctx context.Context, doc string) error {
+	root := s.journal
+	if root == "" {
+		root = doc
+	}
+	jctx := journal.NewContext()
+	j, err := journal.FromSource(ctx, jctx, s.docs, root)
+	if err == nil {
+		_, err = j.Process(journal.ComputePrices(nil), journal.Balance(jctx, nil))
+	}
+	s.context = jctx
+	diagnostics := make(map[string][]diagnostic)
+	for _, e := range multierr.Errors(err) {
+		p, d := toDiagnostic(root, e)
+		diagnostics[p] = append(diagnostics[p], d)
+	}
+	for p := range s.published {
+		if _, ok := diagnostics[p]; !ok {
+			diagnostics[p] = []diagnostic{}
+		}
+	}
+	s.published = make(map[string]bool)
+	for _, p := range dict.SortedKeys(diagnostics, compare.Ordered[string]) {
+		ds := diagnostics[p]
+		if len(ds) > 0 {
+			s.published[p] = true
+		}
+		if err := writeMessage(s.out, notification{
+			JSONRPC: "2.0",
+			Method:  "textDocument/publishDiagnostics",
+			Params:  publishDiagnosticsParams{URI: pathToURI(p), Diagnostics: ds},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toDiagnostic converts an error into a diagnostic and the path of the
+// file it belongs to. Errors without a position are reported at the start
+// of the journal.
+func toDiagnostic(root string, err error) (string, diagnostic) {
+	var (
+		se  *scanner.Error
+		je  journal.Error
+		res = diagnostic{Severity: severityError, Source: "knut", Message: err.Error()}
+	)
+	switch {
+	case errors.As(err, &se):
+		start := toPosition(se.Location)
+		res.Range = textRange{Start: start, End: position{Line: start.Line, Character: start.Character + 1}}
+		res.Message = se.Err.Error()
+		return filepath.Clean(se.Path), res
+	case errors.As(err, &je) && je.Directive != nil:
+		r := je.Directive.Position()
+		res.Range = textRange{Start: toPosition(r.Start), End: toPosition(r.End)}
+		res.Code = string(je.Code)
+		res.Message = je.Message
+		if je.Fix != "" {
+			res.Message += "\nsuggested fix: " + je.Fix
+		}
+		if je.Code == journal.WarnBudget {
+			res.Severity = severityWarning
+		}
+		return filepath.Clean(r.Path), res
+	}
+	return root, res
+}
+
+func toPosition(l scanner.Location) position {
+	return position{Line: l.Line - 1, Character: l.Column - 1}
+}
+
+// complete returns the account and commodity names which start with the
+// word before the position.
+func (s *Server) complete(params textDocumentPositionParams) ([]completionItem, error) {
+	p, err := uriToPath(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	text, _ := s.docs.get(p)
+	line := []rune(lineAt(text, params.Position.Line))
+	end := params.Position.Character
+	if end > len(line) {
+		end = len(line)
+	}
+	start := end
+	for start > 0 && !unicode.IsSpace(line[start-1]) {
+		start--
+	}
+	var (
+		prefix = string(line[start:end])
+		r      = textRange{
+			Start: position{Line: params.Position.Line, Character: start},
+			End:   position{Line: params.Position.Line, Character: end},
+		}
+		res = []completionItem{}
+	)
+	add := func(name string, kind int, detail string) {
+		if strings.HasPrefix(name, prefix) {
+			res = append(res, completionItem{
+				Label:    name,
+				Kind:     kind,
+				Detail:   detail,
+				TextEdit: &textEdit{Range: r, NewText: name},
+			})
+		}
+	}
+	for _, a := range s.context.Accounts().All() {
+		add(a.Name(), kindModule, "account")
+	}
+	for _, c := range s.context.Commodities().All() {
+		add(c.Name(), kindUnit, "commodity")
+	}
+	return res, nil
+}
+
+// definition returns the files included by the include directive at the
+// position, if any.
+func (s *Server) definition(params textDocumentPositionParams) ([]location, error) {
+	p, err := uriToPath(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	directives, _, err := s.parse(p)
+	if err != nil {
+		return nil, err
+	}
+	res := []location{}
+	for _, d := range directives {
+		inc, ok := d.(*journal.Include)
+		if !ok || params.Position.Line < inc.Range.Start.Line-1 || params.Position.Line > inc.Range.End.Line-1 {
+			continue
+		}
+		pattern := path.Join(filepath.Dir(p), inc.Path)
+		files := []string{pattern}
+		if strings.ContainsAny(inc.Path, "*?[") {
+			if files, err = s.docs.List(pattern); err != nil {
+				return nil, err
+			}
+		}
+		for _, f := range files {
+			res = append(res, location{URI: pathToURI(f)})
+		}
+	}
+	return res, nil
+}
+
+// format returns an edit which replaces the document with its formatted
+// text, or no edits if it is formatted already.
+func (s *Server) format(uri string) ([]textEdit, error) {
+	p, err := uriToPath(uri)
+	if err != nil {
+		return nil, err
+	}
+	directives, text, err := s.parse(p)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := format.Format(directives, strings.NewReader(text), &buf); err != nil {
+		return nil, err
+	}
+	if buf.String() == text {
+		return []textEdit{}, nil
+	}
+	lines := strings.Split(text, "\n")
+	end := position{Line: len(lines) - 1, Character: len([]rune(lines[len(lines)-1]))}
+	return []textEdit{{Range: textRange{End: end}, NewText: buf.String()}}, nil
+}
+
+// parse parses the directives of the open document at the given path.
+func (s *Server) parse(p string) ([]journal.Directive, string, error) {
+	text, ok := s.docs.get(p)
+	if !ok {
+		return nil, "", fmt.Errorf("document %s is not open", p)
+	}
+	parser, cls, err := journal.ParserFromSource(journal.NewContext(), s.docs, p)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cls()
+	var (
+		directives []journal.Directive
+		errs       error
+	)
+	for {
+		d, err := parser.Next()
+		if err == io.EOF {
+			return directives, text, errs
+		}
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		directives = append(directives, d)
+	}
+}
+
+// lineAt returns the line with the given index.
+func lineAt(text string, n int) string {
+	lines := strings.Split(text, "\n")
+	if n < 0 || n >= len(lines) {
+		return ""
+	}
+	return lines[n]
+}
+
+// overlay is a Source which serves the open documents from memory and all
+// other files from the file system.
+type overlay struct {
+	journal.FileSystem
+
+	mu   sync.Mutex
+	docs map[string]string
+}
+
+var _ journal.Source = (*overlay)(nil)
+
+// Open implements journal.Source.
+func (o *overlay) Open(p string) (io.ReadCloser, error) {
+	if text, ok := o.get(p); ok {
+		return io.NopCloser(strings.NewReader(text)), nil
+	}
+	return o.FileSystem.Open(p)
+}
+
+func (o *overlay) get(p string) (string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	text, ok := o.docs[filepath.Clean(p)]
+	return text, ok
+}
+
+func (o *overlay) set(p, text string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.docs[filepath.Clean(p)] = text
+}
+
+func (o *overlay) remove(p string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.docs, filepath.Clean(p))
+}
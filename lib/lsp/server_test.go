@@ -0,0 +1,151 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	var (
+		main     = filepath.Join(dir, "main.knut")
+		accounts = filepath.Join(dir, "accounts.knut")
+		text     = "include \"accounts.knut\"\n\n2020-01-02   \"Deposit\"\nEquity:Equity Assets:Bnak 100 CHF\n"
+	)
+	for p, content := range map[string]string{
+		main:     text,
+		accounts: "2020-01-01 open Equity:Equity\n2020-01-01 open Assets:Bank\n",
+	} {
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var in bytes.Buffer
+	send := func(id int, method string, params any) {
+		msg := map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+		if id > 0 {
+			msg["id"] = id
+		}
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc := map[string]any{"uri": pathToURI(main)}
+	send(1, "initialize", map[string]any{})
+	send(0, "initialized", map[string]any{})
+	send(0, "textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": pathToURI(main), "text": text}})
+	send(2, "textDocument/completion", map[string]any{"textDocument": doc, "position": position{Line: 3, Character: 22}})
+	send(3, "textDocument/definition", map[string]any{"textDocument": doc, "position": position{Line: 0, Character: 10}})
+	send(4, "textDocument/formatting", map[string]any{"textDocument": doc})
+	send(5, "shutdown", nil)
+	send(0, "exit", nil)
+	var out bytes.Buffer
+
+	if err := New(main).Serve(context.Background(), &in, &out); err != nil {
+		t.Fatalf("Serve() returned unexpected error: %v", err)
+	}
+
+	var got []json.RawMessage
+	r := bufio.NewReader(&out)
+	for {
+		content, err := readMessage(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, content)
+	}
+	if len(got) != 6 {
+		t.Fatalf("Serve() wrote %d messages, want 6", len(got))
+	}
+	t.Run("diagnostics", func(t *testing.T) {
+		var msg struct {
+			Params publishDiagnosticsParams `json:"params"`
+		}
+		if err := json.Unmarshal(got[1], &msg); err != nil {
+			t.Fatal(err)
+		}
+		want := publishDiagnosticsParams{
+			URI: pathToURI(main),
+			Diagnostics: []diagnostic{
+				{
+					Range:    textRange{Start: position{Line: 2}, End: position{Line: 4}},
+					Severity: severityError,
+					Code:     "ERR_ACCOUNT_NOT_OPEN",
+					Source:   "knut",
+					Message:  "account Assets:Bnak is not open\nsuggested fix: add \"2020-01-02 open Assets:Bnak\" before this transaction",
+				},
+			},
+		}
+		if diff := cmp.Diff(want, msg.Params); diff != "" {
+			t.Errorf("unexpected diagnostics (-want/+got):\n%s", diff)
+		}
+	})
+	t.Run("completion", func(t *testing.T) {
+		var msg struct {
+			Result []completionItem `json:"result"`
+		}
+		if err := json.Unmarshal(got[2], &msg); err != nil {
+			t.Fatal(err)
+		}
+		r := textRange{Start: position{Line: 3, Character: 14}, End: position{Line: 3, Character: 22}}
+		want := []completionItem{
+			{Label: "Assets:Bank", Kind: kindModule, Detail: "account", TextEdit: &textEdit{Range: r, NewText: "Assets:Bank"}},
+			{Label: "Assets:Bnak", Kind: kindModule, Detail: "account", TextEdit: &textEdit{Range: r, NewText: "Assets:Bnak"}},
+		}
+		if diff := cmp.Diff(want, msg.Result); diff != "" {
+			t.Errorf("unexpected completions (-want/+got):\n%s", diff)
+		}
+	})
+	t.Run("definition", func(t *testing.T) {
+		var msg struct {
+			Result []location `json:"result"`
+		}
+		if err := json.Unmarshal(got[3], &msg); err != nil {
+			t.Fatal(err)
+		}
+		want := []location{{URI: pathToURI(accounts)}}
+		if diff := cmp.Diff(want, msg.Result); diff != "" {
+			t.Errorf("unexpected locations (-want/+got):\n%s", diff)
+		}
+	})
+	t.Run("formatting", func(t *testing.T) {
+		var msg struct {
+			Result []textEdit `json:"result"`
+		}
+		if err := json.Unmarshal(got[4], &msg); err != nil {
+			t.Fatal(err)
+		}
+		want := []textEdit{{
+			Range:   textRange{End: position{Line: 4}},
+			NewText: "include \"accounts.knut\"\n\n2020-01-02 \"Deposit\"\nEquity:Equity Assets:Bnak          100 CHF\n",
+		}}
+		if diff := cmp.Diff(want, msg.Result); diff != "" {
+			t.Errorf("unexpected edits (-want/+got):\n%s", diff)
+		}
+	})
+}
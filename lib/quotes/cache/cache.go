@@ -0,0 +1,187 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache persists fetched quotes in a local directory, such that
+// they can be reused without network access.
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/natefinch/atomic"
+	"github.com/sboehler/knut/lib/journal"
+	"github.com/shopspring/decimal"
+)
+
+// Key identifies the quotes of a commodity in a target commodity from a
+// source.
+type Key struct {
+	Source    string `json:"source"`
+	Symbol    string `json:"symbol"`
+	Commodity string `json:"commodity"`
+	Target    string `json:"target"`
+}
+
+func (k Key) filename() string {
+	fields := []string{k.Source, k.Symbol, k.Commodity, k.Target}
+	for i, f := range fields {
+		fields[i] = url.PathEscape(f)
+	}
+	return strings.Join(fields, "_") + ".json"
+}
+
+// Entry is the cached quotes of a key, with the time they have last been
+// fetched.
+type Entry struct {
+	Key     Key                           `json:"key"`
+	Fetched time.Time                     `json:"fetched"`
+	Quotes  map[time.Time]decimal.Decimal `json:"quotes"`
+}
+
+// Cache is a directory with an entry per key.
+type Cache struct {
+	dir string
+}
+
+// New creates a cache in the given directory.
+func New(dir string) *Cache {
+	return &Cache{dir}
+}
+
+// DefaultDir returns the default cache directory, which is knut/quotes in
+// the user's cache directory, e.g. $XDG_CACHE_HOME/knut/quotes on Linux.
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "knut", "quotes"), nil
+}
+
+// Load loads the entry for the given key. It returns nil if there is no
+// entry.
+func (c *Cache) Load(k Key) (*Entry, error) {
+	return c.load(filepath.Join(c.dir, k.filename()))
+}
+
+func (c *Cache) load(path string) (*Entry, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e Entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &e, nil
+}
+
+// Store stores the entry.
+func (c *Cache) Store(e *Entry) error {
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomic.WriteFile(filepath.Join(c.dir, e.Key.filename()), bytes.NewReader(b))
+}
+
+// Fetch returns the quotes for the given key. If the entry is older than
+// maxAge, it is refreshed with the quotes returned by fetch, which are
+// merged into the cached quotes. If fetch fails, the cached quotes are
+// returned, as long as there are any.
+func (c *Cache) Fetch(k Key, maxAge time.Duration, fetch func() (map[time.Time]decimal.Decimal, error)) (map[time.Time]decimal.Decimal, error) {
+	e, err := c.Load(k)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil && time.Since(e.Fetched) < maxAge {
+		return e.Quotes, nil
+	}
+	quotes, err := fetch()
+	if err != nil {
+		if e != nil {
+			return e.Quotes, nil
+		}
+		return nil, err
+	}
+	if e == nil {
+		e = &Entry{Key: k, Quotes: make(map[time.Time]decimal.Decimal)}
+	}
+	for d, q := range quotes {
+		e.Quotes[d] = q
+	}
+	e.Fetched = time.Now()
+	if err := c.Store(e); err != nil {
+		return nil, err
+	}
+	return e.Quotes, nil
+}
+
+// Entries returns all entries of the cache.
+func (c *Cache) Entries() ([]*Entry, error) {
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var res []*Entry
+	for _, path := range paths {
+		e, err := c.load(path)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+// AddPrices adds the cached quotes up to the end of the journal as prices
+// to the journal.
+func (c *Cache) AddPrices(j *journal.Journal) error {
+	entries, err := c.Entries()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		commodity, err := j.Context.GetCommodity(e.Key.Commodity)
+		if err != nil {
+			return err
+		}
+		target, err := j.Context.GetCommodity(e.Key.Target)
+		if err != nil {
+			return err
+		}
+		for d, q := range e.Quotes {
+			if d.After(j.Max()) {
+				continue
+			}
+			j.AddPrice(&journal.Price{Date: d, Commodity: commodity, Target: target, Price: q})
+		}
+	}
+	return nil
+}
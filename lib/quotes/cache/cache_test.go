@@ -0,0 +1,86 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+)
+
+func TestFetch(t *testing.T) {
+	var (
+		c   = New(t.TempDir())
+		k   = Key{Source: "yahoo", Symbol: "AAPL", Commodity: "AAPL", Target: "USD"}
+		d1  = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		d2  = time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+		opt = cmp.Comparer(func(a, b decimal.Decimal) bool { return a.Equal(b) })
+	)
+	fetch := func(quotes map[time.Time]decimal.Decimal, err error) func() (map[time.Time]decimal.Decimal, error) {
+		return func() (map[time.Time]decimal.Decimal, error) { return quotes, err }
+	}
+	tests := []struct {
+		desc   string
+		maxAge time.Duration
+		fetch  func() (map[time.Time]decimal.Decimal, error)
+		want   map[time.Time]decimal.Decimal
+	}{
+		{
+			desc:  "empty cache",
+			fetch: fetch(map[time.Time]decimal.Decimal{d1: decimal.NewFromInt(180)}, nil),
+			want:  map[time.Time]decimal.Decimal{d1: decimal.NewFromInt(180)},
+		},
+		{
+			desc:   "fresh entry",
+			maxAge: time.Hour,
+			fetch:  fetch(nil, errors.New("unexpected fetch")),
+			want:   map[time.Time]decimal.Decimal{d1: decimal.NewFromInt(180)},
+		},
+		{
+			desc:  "stale entry",
+			fetch: fetch(map[time.Time]decimal.Decimal{d2: decimal.NewFromInt(175)}, nil),
+			want:  map[time.Time]decimal.Decimal{d1: decimal.NewFromInt(180), d2: decimal.NewFromInt(175)},
+		},
+		{
+			desc:  "offline",
+			fetch: fetch(nil, errors.New("offline")),
+			want:  map[time.Time]decimal.Decimal{d1: decimal.NewFromInt(180), d2: decimal.NewFromInt(175)},
+		},
+	}
+	for _, test := range tests {
+		got, err := c.Fetch(k, test.maxAge, test.fetch)
+		if err != nil {
+			t.Fatalf("%s: Fetch() returned unexpected error: %v", test.desc, err)
+		}
+		if diff := cmp.Diff(test.want, got, opt); diff != "" {
+			t.Errorf("%s: Fetch() returned unexpected quotes (-want/+got):\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestFetchError(t *testing.T) {
+	c := New(t.TempDir())
+
+	_, err := c.Fetch(Key{Source: "yahoo", Symbol: "AAPL"}, time.Hour, func() (map[time.Time]decimal.Decimal, error) {
+		return nil, errors.New("offline")
+	})
+
+	if err == nil {
+		t.Errorf("Fetch() returned no error for an empty cache")
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package coingecko fetches the prices of crypto currencies from
+// CoinGecko.
+package coingecko
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const coingeckoURL string = "https://api.coingecko.com/api/v3/coins"
+
+// Quote is the price of a coin on a given day.
+type Quote struct {
+	Date  time.Time
+	Price decimal.Decimal
+}
+
+// Client is a client for CoinGecko prices.
+type Client struct {
+	url string
+}
+
+// New creates a new client with the default URL.
+func New() Client {
+	return Client{coingeckoURL}
+}
+
+// Fetch fetches the daily prices of the coin with the given id, such as
+// bitcoin, in the given currency between t0 and t1.
+func (c *Client) Fetch(id, currency string, t0, t1 time.Time) ([]Quote, error) {
+	u, err := createURL(c.url, id, currency, t0, t1)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching CoinGecko prices for %s: %s", id, resp.Status)
+	}
+	return decodeResponse(resp.Body)
+}
+
+// createURL creates a URL for the given root URL and parameters.
+func createURL(rootURL, id, currency string, t0, t1 time.Time) (*url.URL, error) {
+	u, err := url.Parse(rootURL)
+	if err != nil {
+		return u, err
+	}
+	u.Path = path.Join(u.Path, url.PathEscape(id), "market_chart", "range")
+	u.RawQuery = url.Values{
+		"vs_currency": {strings.ToLower(currency)},
+		"from":        {fmt.Sprint(t0.Unix())},
+		"to":          {fmt.Sprint(t1.Unix())},
+	}.Encode()
+	return u, nil
+}
+
+// decodeResponse takes a reader for the response and returns the parsed
+// quotes. If there are several prices on a day, the last one is used.
+func decodeResponse(r io.Reader) ([]Quote, error) {
+	var body struct {
+		Prices [][2]json.Number `json:"prices"`
+	}
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return nil, err
+	}
+	var res []Quote
+	for _, p := range body.Prices {
+		ms, err := p[0].Int64()
+		if err != nil {
+			return nil, err
+		}
+		price, err := decimal.NewFromString(p[1].String())
+		if err != nil {
+			return nil, err
+		}
+		t := time.UnixMilli(ms).UTC()
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		if len(res) > 0 && res[len(res)-1].Date.Equal(d) {
+			res[len(res)-1].Price = price
+			continue
+		}
+		res = append(res, Quote{Date: d, Price: price})
+	}
+	return res, nil
+}
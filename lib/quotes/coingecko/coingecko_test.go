@@ -0,0 +1,66 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package coingecko
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+)
+
+func TestFetch(t *testing.T) {
+	var (
+		gotPath  string
+		gotQuery map[string][]string
+		response = `{"prices":[[1709251200000,55874.12],[1709337600000,56170.5],[1709380800000,56301.25]],"market_caps":[],"total_volumes":[]}`
+		srv      = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotPath = r.URL.Path
+			gotQuery = r.URL.Query()
+			w.Write([]byte(response))
+		}))
+	)
+	defer srv.Close()
+	var (
+		want = []Quote{
+			{Date: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Price: decimal.RequireFromString("55874.12")},
+			{Date: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), Price: decimal.RequireFromString("56301.25")},
+		}
+		wantQuery = map[string][]string{
+			"vs_currency": {"chf"},
+			"from":        {"1709251200"},
+			"to":          {"1709424000"},
+		}
+		client = Client{srv.URL}
+	)
+
+	got, err := client.Fetch("bitcoin", "CHF", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC))
+
+	if err != nil {
+		t.Fatalf("client.Fetch(): returned unexpected error %v", err)
+	}
+	if gotPath != "/bitcoin/market_chart/range" {
+		t.Errorf("client.Fetch(): requested path %q, want %q", gotPath, "/bitcoin/market_chart/range")
+	}
+	if diff := cmp.Diff(wantQuery, gotQuery); diff != "" {
+		t.Errorf("client.Fetch(): unexpected diff in query parameters (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("client.Fetch() returned difference (-want, +got):\n%s", diff)
+	}
+}
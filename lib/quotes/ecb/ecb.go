@@ -0,0 +1,128 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ecb fetches the euro foreign exchange reference rates of the
+// European Central Bank.
+package ecb
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const ecbURL string = "https://data-api.ecb.europa.eu/service/data/EXR"
+
+// Quote is the reference rate of a currency on a given day, in units of
+// the currency per euro.
+type Quote struct {
+	Date time.Time
+	Rate decimal.Decimal
+}
+
+// Client is a client for the ECB reference rates.
+type Client struct {
+	url string
+}
+
+// New creates a new client with the default URL.
+func New() Client {
+	return Client{ecbURL}
+}
+
+// Fetch fetches the daily reference rates of the given currency, such as
+// USD, between t0 and t1.
+func (c *Client) Fetch(currency string, t0, t1 time.Time) ([]Quote, error) {
+	u, err := createURL(c.url, currency, t0, t1)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching ECB rates for %s: %s", currency, resp.Status)
+	}
+	return decodeResponse(resp.Body)
+}
+
+// createURL creates a URL for the given root URL and parameters.
+func createURL(rootURL, currency string, t0, t1 time.Time) (*url.URL, error) {
+	u, err := url.Parse(rootURL)
+	if err != nil {
+		return u, err
+	}
+	u.Path = path.Join(u.Path, url.PathEscape(fmt.Sprintf("D.%s.EUR.SP00.A", currency)))
+	u.RawQuery = url.Values{
+		"format":      {"csvdata"},
+		"startPeriod": {t0.Format("2006-01-02")},
+		"endPeriod":   {t1.Format("2006-01-02")},
+	}.Encode()
+	return u, nil
+}
+
+// decodeResponse takes a reader for the response and returns the parsed
+// quotes. The columns are identified by the header.
+func decodeResponse(r io.Reader) ([]Quote, error) {
+	csvReader := csv.NewReader(r)
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		// no rates in the period
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	date, value := -1, -1
+	for i, h := range header {
+		switch h {
+		case "TIME_PERIOD":
+			date = i
+		case "OBS_VALUE":
+			value = i
+		}
+	}
+	if date < 0 || value < 0 {
+		return nil, fmt.Errorf("invalid header %v, expected TIME_PERIOD and OBS_VALUE columns", header)
+	}
+	var res []Quote
+	for {
+		r, err := csvReader.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r[value] == "" || r[value] == "NaN" {
+			continue
+		}
+		var quote Quote
+		if quote.Date, err = time.Parse("2006-01-02", r[date]); err != nil {
+			return nil, err
+		}
+		if quote.Rate, err = decimal.NewFromString(r[value]); err != nil {
+			return nil, err
+		}
+		res = append(res, quote)
+	}
+}
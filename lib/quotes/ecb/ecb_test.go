@@ -0,0 +1,69 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ecb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shopspring/decimal"
+)
+
+func TestFetch(t *testing.T) {
+	var (
+		gotPath  string
+		gotQuery map[string][]string
+		response = "KEY,FREQ,CURRENCY,CURRENCY_DENOM,EXR_TYPE,EXR_SUFFIX,TIME_PERIOD,OBS_VALUE,OBS_STATUS\n" +
+			"EXR.D.USD.EUR.SP00.A,D,USD,EUR,SP00,A,2024-03-01,1.0822,A\n" +
+			"EXR.D.USD.EUR.SP00.A,D,USD,EUR,SP00,A,2024-03-04,1.0849,A\n" +
+			"EXR.D.USD.EUR.SP00.A,D,USD,EUR,SP00,A,2024-03-05,NaN,A\n"
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gotPath = r.URL.Path
+			gotQuery = r.URL.Query()
+			w.Write([]byte(response))
+		}))
+	)
+	defer srv.Close()
+	var (
+		want = []Quote{
+			{Date: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Rate: decimal.RequireFromString("1.0822")},
+			{Date: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), Rate: decimal.RequireFromString("1.0849")},
+		}
+		wantQuery = map[string][]string{
+			"format":      {"csvdata"},
+			"startPeriod": {"2024-03-01"},
+			"endPeriod":   {"2024-03-05"},
+		}
+		client = Client{srv.URL}
+	)
+
+	got, err := client.Fetch("USD", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC))
+
+	if err != nil {
+		t.Fatalf("client.Fetch(): returned unexpected error %v", err)
+	}
+	if gotPath != "/D.USD.EUR.SP00.A" {
+		t.Errorf("client.Fetch(): requested path %q, want %q", gotPath, "/D.USD.EUR.SP00.A")
+	}
+	if diff := cmp.Diff(wantQuery, gotQuery); diff != "" {
+		t.Errorf("client.Fetch(): unexpected diff in query parameters (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("client.Fetch() returned difference (-want, +got):\n%s", diff)
+	}
+}
@@ -22,14 +22,25 @@ import (
 	"github.com/sboehler/knut/cmd"
 
 	// enable importers here
+	_ "github.com/sboehler/knut/cmd/importer/binance"
+	_ "github.com/sboehler/knut/cmd/importer/camt"
+	_ "github.com/sboehler/knut/cmd/importer/cembra"
 	_ "github.com/sboehler/knut/cmd/importer/cumulus"
+	_ "github.com/sboehler/knut/cmd/importer/fidelity"
+	_ "github.com/sboehler/knut/cmd/importer/imap"
 	_ "github.com/sboehler/knut/cmd/importer/interactivebrokers"
+	_ "github.com/sboehler/knut/cmd/importer/migrosbank"
+	_ "github.com/sboehler/knut/cmd/importer/monzo"
+	_ "github.com/sboehler/knut/cmd/importer/mt940"
+	_ "github.com/sboehler/knut/cmd/importer/nordigen"
 	_ "github.com/sboehler/knut/cmd/importer/postfinance"
 	_ "github.com/sboehler/knut/cmd/importer/revolut"
 	_ "github.com/sboehler/knut/cmd/importer/revolut2"
+	_ "github.com/sboehler/knut/cmd/importer/starling"
 	_ "github.com/sboehler/knut/cmd/importer/supercard"
 	_ "github.com/sboehler/knut/cmd/importer/swisscard"
 	_ "github.com/sboehler/knut/cmd/importer/swissquote"
+	_ "github.com/sboehler/knut/cmd/importer/vanguard"
 	_ "github.com/sboehler/knut/cmd/importer/viac"
 )
 
@@ -2,13 +2,20 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/improbable-eng/grpc-web/go/grpcweb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/sboehler/knut/cmd/output"
+	"github.com/sboehler/knut/lib/common/date"
+	"github.com/sboehler/knut/lib/journal"
 	"github.com/sboehler/knut/web"
 
 	pb "github.com/sboehler/knut/server/proto"
@@ -17,9 +24,11 @@ import (
 // Start REPL with:
 // evans --proto proto/service.proto --host localhost --port 7777 --web
 
-// NewServer runs the GRPC server.
-func NewServer(address string) error {
-	srv := new(Server)
+// NewServer runs the GRPC server. If file is not empty, the journal at
+// this path is read from the source, and the processed journal is served
+// at /days and its errors at /check.
+func NewServer(address string, source journal.Source, file string) error {
+	srv := &Server{source: source, file: file}
 	grpcServer := grpc.NewServer()
 	pb.RegisterKnutServiceServer(grpcServer, srv)
 	reflection.Register(grpcServer)
@@ -31,6 +40,10 @@ func NewServer(address string) error {
 	f := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
 		if grpcWebServer.IsGrpcWebRequest(req) {
 			grpcWebServer.ServeHTTP(resp, req)
+		} else if req.URL.Path == "/days" && srv.file != "" {
+			srv.ServeDays(resp, req)
+		} else if req.URL.Path == "/check" && srv.file != "" {
+			srv.ServeCheck(resp, req)
 		} else {
 			assets.ServeHTTP(resp, req)
 		}
@@ -40,6 +53,9 @@ func NewServer(address string) error {
 
 type Server struct {
 	pb.UnimplementedKnutServiceServer
+
+	source journal.Source
+	file   string
 }
 
 var _ pb.KnutServiceServer = (*Server)(nil)
@@ -47,3 +63,124 @@ var _ pb.KnutServiceServer = (*Server)(nil)
 func (srv *Server) Hello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloResponse, error) {
 	return &pb.HelloResponse{Greeting: fmt.Sprintf("Hello, %s", req.Name)}, nil
 }
+
+// ServeDays serves the days of the processed journal as JSON, with the
+// balances of the positions which changed on each day. The journal is read
+// on every request. The query parameters from and to (YYYY-MM-DD) restrict
+// the days, and val valuates the journal in the given commodity.
+func (srv *Server) ServeDays(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var (
+		jctx      = journal.NewContext()
+		q         = req.URL.Query()
+		from, to  = q.Get("from"), q.Get("to")
+		valuation *journal.Commodity
+		err       error
+	)
+	if v := q.Get("val"); v != "" {
+		if valuation, err = jctx.GetCommodity(v); err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	for name, v := range map[string]string{"from": from, "to": to} {
+		if _, err := time.Parse("2006-01-02", v); v != "" && err != nil {
+			http.Error(resp, fmt.Sprintf("invalid %s: %v", name, err), http.StatusBadRequest)
+			return
+		}
+	}
+	j, err := journal.FromSource(req.Context(), jctx, srv.source, srv.file)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	l, err := j.Process(
+		journal.ComputePrices(valuation),
+		journal.Balance(jctx, valuation),
+	)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// balances are accumulated over all days, so the days are only
+	// filtered afterwards; dates in YYYY-MM-DD format compare as strings
+	res := journal.NewJSONJournal(l.Days, valuation, true)
+	days := res.Days[:0]
+	for _, d := range res.Days {
+		if (from == "" || d.Date >= from) && (to == "" || d.Date <= to) {
+			days = append(days, d)
+		}
+	}
+	res.Days = days
+	resp.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(resp).Encode(res); err != nil {
+		log.Printf("/days: %v", err)
+	}
+}
+
+// ServeCheck serves the errors of the journal in the envelope of
+// "knut check --format json", for editor integrations. The journal is read
+// on every request. The query parameters val, date (YYYY-MM-DD) and strict
+// correspond to the flags of the command. Repairs are not suggested.
+func (srv *Server) ServeCheck(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var (
+		jctx      = journal.NewContext()
+		q         = req.URL.Query()
+		t         = date.Today()
+		strict    bool
+		valuation *journal.Commodity
+		err       error
+	)
+	if v := q.Get("val"); v != "" {
+		if valuation, err = jctx.GetCommodity(v); err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("date"); v != "" {
+		if t, err = time.Parse("2006-01-02", v); err != nil {
+			http.Error(resp, fmt.Sprintf("invalid date: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("strict"); v != "" {
+		if strict, err = strconv.ParseBool(v); err != nil {
+			http.Error(resp, fmt.Sprintf("invalid strict: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	var errs []journal.Error
+	if j, err := journal.FromSource(req.Context(), jctx, srv.source, srv.file); err != nil {
+		errs = journal.Errors(err)
+	} else {
+		errs = j.Check(t, valuation, strict)
+	}
+	for i := range errs {
+		errs[i].Repair = nil
+	}
+	if errs == nil {
+		errs = []journal.Error{}
+	}
+	params := make(map[string]string)
+	for k := range q {
+		params[k] = q.Get(k)
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(resp).Encode(output.Envelope{
+		Version:    output.Version,
+		Command:    "check",
+		Parameters: params,
+		Args:       []string{srv.file},
+		Data:       errs,
+	})
+	if err != nil {
+		log.Printf("/check: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 Silvio Böhler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/sboehler/knut/lib/journal"
+)
+
+func TestServeDays(t *testing.T) {
+	src := journal.NewMemory(map[string]string{"journal.knut": `2020-01-01 open Equity:Equity
+2020-01-01 open Assets:Bank
+
+2020-01-01 price USD 0.9 CHF
+
+2020-01-01 "Deposit"
+Equity:Equity Assets:Bank 100 USD
+
+2020-01-02 "Deposit"
+Equity:Equity Assets:Bank 50 USD
+`})
+	srv := &Server{source: src, file: "journal.knut"}
+	resp := httptest.NewRecorder()
+
+	srv.ServeDays(resp, httptest.NewRequest(http.MethodGet, "/days?from=2020-01-02&val=CHF", nil))
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Code, resp.Body)
+	}
+	var got journal.JSONJournal
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := journal.JSONJournal{
+		Valuation: "CHF",
+		Days: []journal.JSONDay{
+			{
+				Date: "2020-01-02",
+				Transactions: []journal.JSONTransaction{
+					{
+						Description: "Deposit",
+						Postings: []journal.JSONPosting{
+							{Account: "Equity:Equity", Other: "Assets:Bank", Commodity: "USD", Amount: "-50", Value: "-45"},
+							{Account: "Assets:Bank", Other: "Equity:Equity", Commodity: "USD", Amount: "50", Value: "45"},
+						},
+					},
+				},
+				Balances: []journal.JSONBalance{
+					{Account: "Assets:Bank", Commodity: "USD", Amount: "150", Value: "135"},
+					{Account: "Equity:Equity", Commodity: "USD", Amount: "-150", Value: "-135"},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected response (-want/+got):\n%s", diff)
+	}
+}
+
+func TestServeDaysInvalidDate(t *testing.T) {
+	srv := &Server{file: "journal.knut"}
+	resp := httptest.NewRecorder()
+
+	srv.ServeDays(resp, httptest.NewRequest(http.MethodGet, "/days?to=yesterday", nil))
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", resp.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServeCheck(t *testing.T) {
+	src := journal.NewMemory(map[string]string{"journal.knut": `2020-01-01 open Equity:Equity
+2020-01-01 open Assets:Bank
+
+2020-01-01 "Deposit"
+Equity:Equity Assets:Bank 100 USD
+
+2020-01-02 balance Assets:Bank 50 USD
+`})
+	srv := &Server{source: src, file: "journal.knut"}
+	resp := httptest.NewRecorder()
+
+	srv.ServeCheck(resp, httptest.NewRequest(http.MethodGet, "/check?date=2020-01-31", nil))
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Code, resp.Body)
+	}
+	type position struct {
+		Path  string `json:"path"`
+		Start struct {
+			Line int `json:"line"`
+		} `json:"start"`
+	}
+	type jsonError struct {
+		Code     journal.ErrorCode `json:"code"`
+		Position position          `json:"position"`
+	}
+	type envelope struct {
+		Version    int               `json:"version"`
+		Command    string            `json:"command"`
+		Parameters map[string]string `json:"parameters"`
+		Args       []string          `json:"args"`
+		Data       []jsonError       `json:"data"`
+	}
+	var got envelope
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	pos := position{Path: "journal.knut"}
+	pos.Start.Line = 7
+	want := envelope{
+		Version:    1,
+		Command:    "check",
+		Parameters: map[string]string{"date": "2020-01-31"},
+		Args:       []string{"journal.knut"},
+		Data:       []jsonError{{Code: journal.ErrAssertionFailed, Position: pos}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected response (-want/+got):\n%s", diff)
+	}
+}
+
+func TestServeCheckParseError(t *testing.T) {
+	src := journal.NewMemory(map[string]string{"journal.knut": "2020-01-01 foo\n"})
+	srv := &Server{source: src, file: "journal.knut"}
+	resp := httptest.NewRecorder()
+
+	srv.ServeCheck(resp, httptest.NewRequest(http.MethodGet, "/check", nil))
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", resp.Code, resp.Body)
+	}
+	var got struct {
+		Data []struct {
+			Code journal.ErrorCode `json:"code"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Data) != 1 || got.Data[0].Code != journal.ErrParse {
+		t.Fatalf("got %+v, want a single %s error", got.Data, journal.ErrParse)
+	}
+}